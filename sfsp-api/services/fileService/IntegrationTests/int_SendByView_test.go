@@ -13,60 +13,17 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
-	"strings"
 	"testing"
 	//"time"
 
-	monkey "bou.ke/monkey"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	fh "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
-	oc "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
 
 	_ "github.com/lib/pq"
 )
 
-func seedSendByViewSchema(t *testing.T, db *sql.DB) {
-	t.Helper()
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS files (
-			id                 TEXT PRIMARY KEY,
-			owner_id           TEXT NOT NULL,
-			file_name          TEXT DEFAULT '',
-			file_type          TEXT DEFAULT 'file',
-			file_size          BIGINT DEFAULT 0,
-			description        TEXT DEFAULT '',
-			allow_view_sharing BOOLEAN NOT NULL DEFAULT FALSE
-		);
-
-		CREATE TABLE IF NOT EXISTS shared_files_view (
-			id              TEXT PRIMARY KEY DEFAULT md5(random()::text),
-			sender_id       TEXT NOT NULL,
-			recipient_id    TEXT NOT NULL,
-			file_id         TEXT NOT NULL,
-			newfile_id      TEXT,
-			metadata        TEXT NOT NULL,
-			shared_at       TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			expires_at      TIMESTAMPTZ NULL,
-			revoked         BOOLEAN NOT NULL DEFAULT FALSE,
-			revoked_at      TIMESTAMPTZ NULL,
-			access_granted  BOOLEAN NOT NULL DEFAULT TRUE
-		);
-
-		CREATE TABLE IF NOT EXISTS access_logs (
-			id        TEXT PRIMARY KEY DEFAULT md5(random()::text),
-			file_id   TEXT NOT NULL,
-			user_id   TEXT NOT NULL,
-			action    TEXT NOT NULL,
-			message   TEXT NOT NULL,
-			view_only BOOLEAN NOT NULL DEFAULT FALSE,
-			timestamp TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
-		);
-	`)
-	require.NoError(t, err)
-}
-
 func openTestDB(t *testing.T) (*sql.DB, func()) {
 	c, dsn := startPostgresContainer(t)
 	if c != nil {
@@ -78,32 +35,6 @@ func openTestDB(t *testing.T) (*sql.DB, func()) {
 	return db, func() { _ = db.Close() }
 }
 
-func patchOCView(t *testing.T, s *memStore) {
-	t.Helper()
-	monkey.Patch(oc.UploadFileStream, func(path, name string, r io.Reader) error {
-		data, _ := io.ReadAll(r)
-		key := strings.TrimSuffix(path, "/") + "/" + name
-		s.put(key, data)
-		return nil
-	})
-	monkey.Patch(oc.DownloadFileStreamTemp, func(chunkPath string) (io.ReadCloser, error) {
-		if data, ok := s.get(chunkPath); ok {
-			return io.NopCloser(bytes.NewReader(data)), nil
-		}
-		return nil, fmt.Errorf("temp chunk not found: %s", chunkPath)
-	})
-	monkey.Patch(oc.DeleteFileTemp, func(chunkPath string) error {
-		s.del(chunkPath)
-		return nil
-	})
-	monkey.Patch(oc.DownloadSentFileStream, func(path string) (io.ReadCloser, error) {
-		if data, ok := s.get(path); ok {
-			return io.NopCloser(bytes.NewReader(data)), nil
-		}
-		return nil, fmt.Errorf("missing: %s", path)
-	})
-}
-
 func mpBodyView(t *testing.T, fields map[string]string, fileField, fileName string, fileBytes []byte) (*bytes.Buffer, string) {
 	t.Helper()
 	var buf bytes.Buffer
@@ -141,8 +72,7 @@ func postJSONView(t *testing.T, path string, body any, h http.HandlerFunc) (*htt
 }
 
 func Test_SendByView_MissingFields(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 	body, ctype := mpBodyView(t, map[string]string{
 		"userId": "u1",
 		"chunkIndex":  "0",
@@ -152,14 +82,13 @@ func Test_SendByView_MissingFields(t *testing.T) {
 	req.Header.Set("Content-Type", ctype)
 	rr := httptest.NewRecorder()
 
-	fh.SendByViewHandler(rr, req)
+	srv.SendByViewHandler(rr, req)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Missing required form fields")
 }
 
 func Test_SendByView_InvalidIndices(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 	body, ctype := mpBodyView(t, map[string]string{
 		"fileid":          "f1",
 		"userId":          "u1",
@@ -171,7 +100,7 @@ func Test_SendByView_InvalidIndices(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/send/view", body)
 	req.Header.Set("Content-Type", ctype)
 	rr := httptest.NewRecorder()
-	fh.SendByViewHandler(rr, req)
+	srv.SendByViewHandler(rr, req)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Invalid chunkIndex")
 
@@ -186,27 +115,23 @@ func Test_SendByView_InvalidIndices(t *testing.T) {
 	req2 := httptest.NewRequest(http.MethodPost, "/send/view", body2)
 	req2.Header.Set("Content-Type", ctype2)
 	rr2 := httptest.NewRecorder()
-	fh.SendByViewHandler(rr2, req2)
+	srv.SendByViewHandler(rr2, req2)
 	assert.Equal(t, http.StatusBadRequest, rr2.Code)
 	assert.Contains(t, rr2.Body.String(), "Invalid totalChunks")
 }
 
 func Test_SendByView_UnauthorizedOwner(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
 	db, closeDB := openTestDB(t)
 	defer closeDB()
-	seedSendByViewSchema(t, db)
-	_, _ = db.Exec(`INSERT INTO files (id, owner_id, file_name) VALUES ('FX', 'OWNER', 'doc')`)
+	migrateDB(t, db)
+	_, _ = db.Exec(`INSERT INTO files (id, owner_id, file_name) VALUES (md5('FX')::uuid, md5('OWNER')::uuid, 'doc')`)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
 	body, ctype := mpBodyView(t, map[string]string{
-		"fileid":          "FX",
-		"userId":          "NOT_OWNER",
-		"recipientUserId": "R",
+		"fileid":          id("FX"),
+		"userId":          id("NOT_OWNER"),
+		"recipientUserId": id("R"),
 		"metadata":        `{}`,
 		"chunkIndex":      "0",
 		"totalChunks":     "1",
@@ -215,29 +140,25 @@ func Test_SendByView_UnauthorizedOwner(t *testing.T) {
 	req.Header.Set("Content-Type", ctype)
 	rr := httptest.NewRecorder()
 
-	fh.SendByViewHandler(rr, req)
+	srv.SendByViewHandler(rr, req)
 	assert.Equal(t, http.StatusForbidden, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Unauthorized")
 }
 
 func Test_SendByView_ChunkAck_TempStored(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-	s := &memStore{m: map[string][]byte{}}
-	patchOCView(t, s)
+	s := newMemStore()
 
 	db, closeDB := openTestDB(t)
 	defer closeDB()
-	seedSendByViewSchema(t, db)
-	_, _ = db.Exec(`INSERT INTO files (id, owner_id, file_name) VALUES ('F1','U1','doc')`)
+	migrateDB(t, db)
+	_, _ = db.Exec(`INSERT INTO files (id, owner_id, file_name) VALUES (md5('F1')::uuid,md5('U1')::uuid,'doc')`)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, s, fh.Config{})
 
 	body, ctype := mpBodyView(t, map[string]string{
-		"fileid":          "F1",
-		"userId":          "U1",
-		"recipientUserId": "U2",
+		"fileid":          id("F1"),
+		"userId":          id("U1"),
+		"recipientUserId": id("U2"),
 		"metadata":        `{"note":"hello"}`,
 		"chunkIndex":      "0",
 		"totalChunks":     "2",
@@ -247,34 +168,30 @@ func Test_SendByView_ChunkAck_TempStored(t *testing.T) {
 	req.Header.Set("Content-Type", ctype)
 	rr := httptest.NewRecorder()
 
-	fh.SendByViewHandler(rr, req)
+	srv.SendByViewHandler(rr, req)
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Chunk 0 uploaded")
 
-	got, ok := s.get("temp/F1_chunk_0")
+	got, ok := s.get("temp/" + id("F1") + "_chunk_0")
 	require.True(t, ok)
 	assert.Equal(t, []byte("AAA"), got)
 }
 
 func Test_SendByView_SingleChunk_Success_DBUpdated_LogsWritten(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-	s := &memStore{m: map[string][]byte{}}
-	patchOCView(t, s)
+	s := newMemStore()
 
 	db, closeDB := openTestDB(t)
 	defer closeDB()
-	seedSendByViewSchema(t, db)
-	_, _ = db.Exec(`INSERT INTO files (id, owner_id, file_name) VALUES ('F2','SENDER','thing')`)
+	migrateDB(t, db)
+	_, _ = db.Exec(`INSERT INTO files (id, owner_id, file_name) VALUES (md5('F2')::uuid,md5('SENDER')::uuid,'thing')`)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, s, fh.Config{})
 
 	content := []byte("HELLO-VIEW")
 	body, ctype := mpBodyView(t, map[string]string{
-		"fileid":          "F2",
-		"userId":          "SENDER",
-		"recipientUserId": "RECIP",
+		"fileid":          id("F2"),
+		"userId":          id("SENDER"),
+		"recipientUserId": id("RECIP"),
 		"metadata":        `{"x":1}`,
 		"chunkIndex":      "0",
 		"totalChunks":     "1",
@@ -284,57 +201,39 @@ func Test_SendByView_SingleChunk_Success_DBUpdated_LogsWritten(t *testing.T) {
 	req.Header.Set("Content-Type", ctype)
 	rr := httptest.NewRecorder()
 
-	fh.SendByViewHandler(rr, req)
+	srv.SendByViewHandler(rr, req)
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Contains(t, rr.Body.String(), `"message":"File shared for view-only access successfully"`)
 
-	finalKey := "files/SENDER/shared_view/F2_RECIP"
+	finalKey := "files/" + id("SENDER") + "/shared_view/" + id("F2") + "_" + id("RECIP")
 	got, ok := s.get(finalKey)
 	require.True(t, ok)
 	assert.Equal(t, content, got)
 
 	var n int
-	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM shared_files_view WHERE sender_id='SENDER' AND recipient_id='RECIP' AND file_id='F2' AND revoked=FALSE`).Scan(&n))
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM shared_files_view WHERE sender_id=md5('SENDER')::uuid AND recipient_id=md5('RECIP')::uuid AND file_id=md5('F2')::uuid AND revoked=FALSE`).Scan(&n))
 	assert.Equal(t, 1, n)
 
 	var flag bool
-	require.NoError(t, db.QueryRow(`SELECT allow_view_sharing FROM files WHERE id='F2'`).Scan(&flag))
+	require.NoError(t, db.QueryRow(`SELECT allow_view_sharing FROM files WHERE id=md5('F2')::uuid`).Scan(&flag))
 	assert.True(t, flag)
 
-	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM access_logs WHERE file_id='F2' AND user_id='SENDER' AND action='shared_view' AND view_only=TRUE`).Scan(&n))
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM access_logs WHERE file_id=md5('F2')::uuid AND user_id=md5('SENDER')::uuid AND action='shared_view' AND view_only=TRUE`).Scan(&n))
 	assert.Equal(t, 1, n)
 }
 
 func Test_SendByView_TempUploadError(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
-	monkey.Patch(oc.UploadFileStream, func(path, name string, r io.Reader) error {
-		if strings.HasPrefix(path, "temp") {
-			return fmt.Errorf("oops temp")
-		}
-		return nil
-	})
-	monkey.Patch(oc.DownloadFileStreamTemp, func(chunkPath string) (io.ReadCloser, error) {
-		return nil, fmt.Errorf("unused")
-	})
-	monkey.Patch(oc.DeleteFileTemp, func(chunkPath string) error { return nil })
-	monkey.Patch(oc.DownloadSentFileStream, func(path string) (io.ReadCloser, error) {
-		return nil, fmt.Errorf("unused")
-	})
-
 	db, closeDB := openTestDB(t)
 	defer closeDB()
-	seedSendByViewSchema(t, db)
-	_, _ = db.Exec(`INSERT INTO files (id, owner_id, file_name) VALUES ('F3','U1','doc')`)
+	migrateDB(t, db)
+	_, _ = db.Exec(`INSERT INTO files (id, owner_id, file_name) VALUES (md5('F3')::uuid,md5('U1')::uuid,'doc')`)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, brokenStore{memStore: newMemStore(), prefix: "temp", err: fmt.Errorf("oops temp")}, fh.Config{})
 
 	body, ctype := mpBodyView(t, map[string]string{
-		"fileid":          "F3",
-		"userId":          "U1",
-		"recipientUserId": "U2",
+		"fileid":          id("F3"),
+		"userId":          id("U1"),
+		"recipientUserId": id("U2"),
 		"metadata":        `{}`,
 		"chunkIndex":      "0",
 		"totalChunks":     "1",
@@ -343,64 +242,58 @@ func Test_SendByView_TempUploadError(t *testing.T) {
 	req.Header.Set("Content-Type", ctype)
 	rr := httptest.NewRecorder()
 
-	fh.SendByViewHandler(rr, req)
+	srv.SendByViewHandler(rr, req)
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Chunk upload failed")
 }
 
 func Test_RevokeViewAccess_Success(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
 	db, closeDB := openTestDB(t)
 	defer closeDB()
-	seedSendByViewSchema(t, db)
+	migrateDB(t, db)
 
-	_, _ = db.Exec(`INSERT INTO files (id, owner_id, file_name) VALUES ('F4','S','orig')`)
-	_, _ = db.Exec(`INSERT INTO files (id, owner_id, file_name) VALUES ('NF','S','sharedcopy')`)
+	_, _ = db.Exec(`INSERT INTO files (id, owner_id, file_name) VALUES (md5('F4')::uuid,md5('S')::uuid,'orig')`)
+	_, _ = db.Exec(`INSERT INTO files (id, owner_id, file_name) VALUES (md5('NF')::uuid,md5('S')::uuid,'sharedcopy')`)
 
-	_, _ = db.Exec(`INSERT INTO shared_files_view (sender_id,recipient_id,file_id,newfile_id,metadata,access_granted,revoked) VALUES ('S','R','F4','NF','{}',TRUE,FALSE)`)
+	_, _ = db.Exec(`INSERT INTO shared_files_view (sender_id,recipient_id,file_id,newfile_id,metadata,access_granted,revoked) VALUES (md5('S')::uuid,md5('R')::uuid,md5('F4')::uuid,md5('NF')::uuid,'{}',TRUE,FALSE)`)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
 	rr, _ := postJSONView(t, "/revoke", map[string]string{
-		"fileId": "F4", "userId": "S", "recipientId": "R",
-	}, fh.RevokeViewAccessHandler)
+		"fileId": id("F4"), "userId": id("S"), "recipientId": id("R"),
+	}, srv.RevokeViewAccessHandler)
 	assert.Equal(t, http.StatusOK, rr.Code)
 
 	var revoked, granted bool
-	require.NoError(t, db.QueryRow(`SELECT revoked, access_granted FROM shared_files_view WHERE sender_id='S' AND recipient_id='R' AND file_id='F4'`).Scan(&revoked, &granted))
+	require.NoError(t, db.QueryRow(`SELECT revoked, access_granted FROM shared_files_view WHERE sender_id=md5('S')::uuid AND recipient_id=md5('R')::uuid AND file_id=md5('F4')::uuid`).Scan(&revoked, &granted))
 	assert.True(t, revoked)
 	assert.False(t, granted)
 
 	var cnt int
-	_ = db.QueryRow(`SELECT COUNT(*) FROM files WHERE id='NF'`).Scan(&cnt)
+	_ = db.QueryRow(`SELECT COUNT(*) FROM files WHERE id=md5('NF')::uuid`).Scan(&cnt)
 	assert.Equal(t, 0, cnt)
 }
 
 func Test_GetSharedViewFiles_ReturnsActiveNotExpired(t *testing.T) {
 	db, closeDB := openTestDB(t)
 	defer closeDB()
-	seedSendByViewSchema(t, db)
+	migrateDB(t, db)
 
 	_, _ = db.Exec(`INSERT INTO files (id,owner_id,file_name,file_type,file_size,description) VALUES 
-		('F5','S','img','file',10,'desc')`)
+		(md5('F5')::uuid,md5('S')::uuid,'img','file',10,'desc')`)
 
 	_, _ = db.Exec(`INSERT INTO shared_files_view (sender_id,recipient_id,file_id,metadata,expires_at,access_granted,revoked) VALUES 
-		('S','U','F5','{"a":1}', NOW() + interval '1 hour', TRUE, FALSE)`)
+		(md5('S')::uuid,md5('U')::uuid,md5('F5')::uuid,'{"a":1}', NOW() + interval '1 hour', TRUE, FALSE)`)
 
 	_, _ = db.Exec(`INSERT INTO shared_files_view (sender_id,recipient_id,file_id,metadata,expires_at,access_granted,revoked) VALUES 
-		('S','U','F5','{"b":2}', NOW() + interval '1 hour', TRUE, TRUE)`)
+		(md5('S')::uuid,md5('U')::uuid,md5('F5')::uuid,'{"b":2}', NOW() + interval '1 hour', TRUE, TRUE)`)
 
 	_, _ = db.Exec(`INSERT INTO shared_files_view (sender_id,recipient_id,file_id,metadata,expires_at,access_granted,revoked) VALUES 
-		('U','S','F5','{"c":3}', NOW() - interval '1 hour', TRUE, FALSE)`)
+		(md5('U')::uuid,md5('S')::uuid,md5('F5')::uuid,'{"c":3}', NOW() - interval '1 hour', TRUE, FALSE)`)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
-	rr, body := postJSONView(t, "/shared/list", map[string]string{"userId": "S"}, fh.GetSharedViewFilesHandler)
+	rr, body := postJSONView(t, "/shared/list", map[string]string{"userId": id("S")}, srv.GetSharedViewFilesHandler)
 	assert.Equal(t, http.StatusOK, rr.Code)
 
 	var arr []map[string]any
@@ -413,17 +306,15 @@ func Test_GetSharedViewFiles_ReturnsActiveNotExpired(t *testing.T) {
 func Test_GetViewFileAccessLogs_OrderedDesc(t *testing.T) {
 	db, closeDB := openTestDB(t)
 	defer closeDB()
-	seedSendByViewSchema(t, db)
+	migrateDB(t, db)
 
 	_, _ = db.Exec(`INSERT INTO access_logs (file_id,user_id,action,message,view_only,timestamp) VALUES 
-		('F6','U','viewed','m1',TRUE, TIMESTAMP '2025-01-01T00:00:00Z'),
-		('F6','U','viewed','m2',TRUE, TIMESTAMP '2025-06-01T00:00:00Z')`)
+		(md5('F6')::uuid,md5('U')::uuid,'viewed','m1',TRUE, TIMESTAMP '2025-01-01T00:00:00Z'),
+		(md5('F6')::uuid,md5('U')::uuid,'viewed','m2',TRUE, TIMESTAMP '2025-06-01T00:00:00Z')`)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
-	rr, body := postJSONView(t, "/logs/view", map[string]string{"fileId": "F6", "userId": "U"}, fh.GetViewFileAccessLogs)
+	rr, body := postJSONView(t, "/logs/view", map[string]string{"fileId": id("F6"), "userId": id("U")}, srv.GetViewFileAccessLogs)
 	assert.Equal(t, http.StatusOK, rr.Code)
 
 	var logs []map[string]any
@@ -434,56 +325,55 @@ func Test_GetViewFileAccessLogs_OrderedDesc(t *testing.T) {
 }
 
 func Test_DownloadViewFile_Success(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-	s := &memStore{m: map[string][]byte{}}
-	patchOCView(t, s)
+	s := newMemStore()
 
 	db, closeDB := openTestDB(t)
 	defer closeDB()
-	seedSendByViewSchema(t, db)
+	migrateDB(t, db)
+	_, err := db.Exec(`INSERT INTO files (id, owner_id, file_name) VALUES (md5('F7')::uuid, md5('S')::uuid, 'doc')`)
+	require.NoError(t, err)
 
 	_, _ = db.Exec(`INSERT INTO shared_files_view (id,sender_id,recipient_id,file_id,metadata,expires_at,revoked,access_granted) 
-		VALUES ('SHX','S','U','F7','{"ok":true}', NOW() + interval '1 hour', FALSE, TRUE)`)
+		VALUES (md5('SHX')::uuid,md5('S')::uuid,md5('U')::uuid,md5('F7')::uuid,'{"ok":true}', NOW() + interval '1 hour', FALSE, TRUE)`)
 
-	finalPath := "files/S/shared_view/F7_U"
+	finalPath := "files/" + id("S") + "/shared_view/" + id("F7") + "_" + id("U")
 	content := []byte("VIEWBYTES")
 	s.put(finalPath, content)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, s, fh.Config{})
 
-	rr, body := postJSONView(t, "/download/view", map[string]string{"userId": "U", "fileId": "F7"}, fh.DownloadViewFileHandler)
+	rr, body := postJSONView(t, "/download/view", map[string]string{"userId": id("U"), "fileId": id("F7")}, srv.DownloadViewFileHandler)
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Equal(t, "application/octet-stream", rr.Header().Get("Content-Type"))
 	assert.Equal(t, "true", rr.Header().Get("X-View-Only"))
-	assert.Equal(t, "F7", rr.Header().Get("X-File-Id"))
-	assert.Equal(t, "SHX", rr.Header().Get("X-Share-Id"))
+	assert.Equal(t, id("F7"), rr.Header().Get("X-File-Id"))
+	assert.Equal(t, id("SHX"), rr.Header().Get("X-Share-Id"))
 	assert.Equal(t, content, body)
 
 	var n int
-	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM access_logs WHERE file_id='F7' AND user_id='U' AND action='viewed' AND view_only=TRUE`).Scan(&n))
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM access_logs WHERE file_id=md5('F7')::uuid AND user_id=md5('U')::uuid AND action='viewed' AND view_only=TRUE`).Scan(&n))
 	assert.Equal(t, 1, n)
 }
 
 func Test_DownloadViewFile_RevokedOrExpired(t *testing.T) {
 	db, closeDB := openTestDB(t)
 	defer closeDB()
-	seedSendByViewSchema(t, db)
+	migrateDB(t, db)
+	_, err := db.Exec(`INSERT INTO files (id, owner_id, file_name) VALUES
+		(md5('FR')::uuid, md5('S')::uuid, 'revoked'), (md5('FE')::uuid, md5('S')::uuid, 'expired')`)
+	require.NoError(t, err)
 
 	_, _ = db.Exec(`INSERT INTO shared_files_view (sender_id,recipient_id,file_id,metadata,expires_at,revoked,access_granted) 
-		VALUES ('S','U','FR','{}', NOW() + interval '1 hour', TRUE, TRUE)`)
+		VALUES (md5('S')::uuid,md5('U')::uuid,md5('FR')::uuid,'{}', NOW() + interval '1 hour', TRUE, TRUE)`)
 
 	_, _ = db.Exec(`INSERT INTO shared_files_view (sender_id,recipient_id,file_id,metadata,expires_at,revoked,access_granted) 
-		VALUES ('S','U','FE','{}', NOW() - interval '1 hour', FALSE, TRUE)`)
+		VALUES (md5('S')::uuid,md5('U')::uuid,md5('FE')::uuid,'{}', NOW() - interval '1 hour', FALSE, TRUE)`)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
-	rr, _ := postJSONView(t, "/download/view", map[string]string{"userId": "U", "fileId": "FR"}, fh.DownloadViewFileHandler)
+	rr, _ := postJSONView(t, "/download/view", map[string]string{"userId": id("U"), "fileId": id("FR")}, srv.DownloadViewFileHandler)
 	assert.Equal(t, http.StatusForbidden, rr.Code)
 
-	rr2, _ := postJSONView(t, "/download/view", map[string]string{"userId": "U", "fileId": "FE"}, fh.DownloadViewFileHandler)
+	rr2, _ := postJSONView(t, "/download/view", map[string]string{"userId": id("U"), "fileId": id("FE")}, srv.DownloadViewFileHandler)
 	assert.Equal(t, http.StatusForbidden, rr2.Code)
 }
@@ -5,22 +5,20 @@ package integration_test
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
-	monkey "bou.ke/monkey"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	fh "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metadata"
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
 )
 
-func doDeleteReq(t *testing.T, body any) (*httptest.ResponseRecorder, []byte) {
+func doDeleteReq(t *testing.T, srv *fh.Server, body any) (*httptest.ResponseRecorder, []byte) {
 	t.Helper()
 
 	var b []byte
@@ -39,22 +37,20 @@ func doDeleteReq(t *testing.T, body any) (*httptest.ResponseRecorder, []byte) {
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
-	fh.DeleteFileHandler(rr, req)
+	srv.DeleteFileHandler(rr, req)
 	return rr, rr.Body.Bytes()
 }
 
 func TestDeleteFileHandler_InvalidJSON(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
-	rr, body := doDeleteReq(t, `{"fileId":"abc","userId":`)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
+	rr, body := doDeleteReq(t, srv, `{"fileId":"abc","userId":`)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, string(body), "Invalid JSON payload")
 }
 
 func TestDeleteFileHandler_MissingFileID(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
-	rr, body := doDeleteReq(t, map[string]string{
+	srv := fh.New(nil, newMemStore(), fh.Config{})
+	rr, body := doDeleteReq(t, srv, map[string]string{
 		"fileId": "",
 		"userId": "user-1",
 	})
@@ -63,9 +59,8 @@ func TestDeleteFileHandler_MissingFileID(t *testing.T) {
 }
 
 func TestDeleteFileHandler_MissingUserID(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
-	rr, body := doDeleteReq(t, map[string]string{
+	srv := fh.New(nil, newMemStore(), fh.Config{})
+	rr, body := doDeleteReq(t, srv, map[string]string{
 		"fileId": "file-1",
 		"userId": "",
 	})
@@ -73,80 +68,96 @@ func TestDeleteFileHandler_MissingUserID(t *testing.T) {
 	assert.Contains(t, string(body), "Missing UserID")
 }
 
-func TestDeleteFileHandler_OwnCloudDeleteFails(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
-	var gotFileID, gotUserID string
-	monkey.Patch(owncloud.DeleteFile, func(fileID, userID string) error {
-		gotFileID, gotUserID = fileID, userID
-		return fmt.Errorf("simulated owncloud failure")
-	})
-	monkey.Patch(metadata.DeleteFileMetadata, func(fileID string) error {
-		return fmt.Errorf("metadata should not have been called")
-	})
+// seedDeleteSchema migrates db and adds the file a permanent delete
+// removes. Without withShares the received_files table is dropped, so
+// deleting the metadata fails.
+func seedDeleteSchema(t *testing.T, db *sql.DB, withShares bool) {
+	t.Helper()
+	migrateDB(t, db)
+	if !withShares {
+		_, err := db.Exec(`DROP TABLE received_files`)
+		require.NoError(t, err)
+	}
+	_, err := db.Exec(`INSERT INTO files (id, owner_id, file_name) VALUES (md5('f-42')::uuid, md5('u-7')::uuid, 'f-42')`)
+	require.NoError(t, err)
+}
 
-	rr, body := doDeleteReq(t, map[string]string{
-		"fileId": "file-123",
-		"userId": "user-abc",
+func TestDeleteFileHandler_OwnCloudDeleteFails(t *testing.T) {
+	pg := startPostgres(t)
+	db := openDB(t, pg.DSN)
+	t.Cleanup(func() { _ = db.Close() })
+	seedDeleteSchema(t, db, true)
+
+	s := newMemStore()
+	s.put("files/"+id("f-42"), []byte("ciphertext"))
+	srv := fh.New(db, brokenStore{memStore: s, prefix: "files/", err: fmt.Errorf("simulated owncloud failure")}, fh.Config{})
+
+	rr, body := doDeleteReq(t, srv, map[string]any{
+		"fileId":    id("f-42"),
+		"userId":    id("u-7"),
+		"permanent": true,
 	})
 
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, string(body), "File delete failed")
-	assert.Equal(t, "file-123", gotFileID)
-	assert.Equal(t, "user-abc", gotUserID)
+
+	var n int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM files WHERE id = md5('f-42')::uuid`).Scan(&n))
+	assert.Equal(t, 1, n, "metadata must be kept when the blob could not be deleted")
 }
 
 func TestDeleteFileHandler_MetadataDeleteFails(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
-	var owncloudCalled bool
-	monkey.Patch(owncloud.DeleteFile, func(fileID, userID string) error {
-		owncloudCalled = true
-		return nil
-	})
-	monkey.Patch(metadata.DeleteFileMetadata, func(fileID string) error {
-		return fmt.Errorf("simulated metadata failure")
-	})
-
-	rr, body := doDeleteReq(t, map[string]string{
-		"fileId": "file-xyz",
-		"userId": "user-999",
+	pg := startPostgres(t)
+	db := openDB(t, pg.DSN)
+	t.Cleanup(func() { _ = db.Close() })
+	seedDeleteSchema(t, db, false)
+
+	s := newMemStore()
+	s.put("files/"+id("f-42"), []byte("ciphertext"))
+	srv := fh.New(db, s, fh.Config{})
+
+	rr, body := doDeleteReq(t, srv, map[string]any{
+		"fileId":    id("f-42"),
+		"userId":    id("u-7"),
+		"permanent": true,
 	})
 
-	assert.True(t, owncloudCalled, "owncloud.DeleteFile should be called before metadata")
+	_, stored := s.get("files/" + id("f-42"))
+	assert.False(t, stored, "the blob should be deleted before the metadata")
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, string(body), "File delete failed")
 }
 
 func TestDeleteFileHandler_Success(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
-	var owncloudCalled, metadataCalled bool
-	var ocFile, ocUser, mdFile string
-
-	monkey.Patch(owncloud.DeleteFile, func(fileID, userID string) error {
-		owncloudCalled = true
-		ocFile, ocUser = fileID, userID
-		return nil
-	})
-	monkey.Patch(metadata.DeleteFileMetadata, func(fileID string) error {
-		metadataCalled = true
-		mdFile = fileID
-		return nil
-	})
-
-	rr, body := doDeleteReq(t, map[string]string{
-		"fileId": "f-42",
-		"userId": "u-7",
+	pg := startPostgres(t)
+	db := openDB(t, pg.DSN)
+	t.Cleanup(func() { _ = db.Close() })
+	seedDeleteSchema(t, db, true)
+	_, err := db.Exec(`
+		INSERT INTO received_files (recipient_id, sender_id, file_id, expires_at, metadata)
+		VALUES (md5('u-8')::uuid, md5('u-7')::uuid, md5('f-42')::uuid, NOW() + INTERVAL '1 day', '{}')
+	`)
+	require.NoError(t, err)
+
+	s := newMemStore()
+	s.put("files/"+id("f-42"), []byte("ciphertext"))
+	srv := fh.New(db, s, fh.Config{})
+
+	rr, body := doDeleteReq(t, srv, map[string]any{
+		"fileId":    id("f-42"),
+		"userId":    id("u-7"),
+		"permanent": true,
 	})
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Contains(t, rr.Header().Get("Content-Type"), "application/json")
 	assert.Contains(t, string(body), "File successfully deleted")
 
-	assert.True(t, owncloudCalled)
-	assert.True(t, metadataCalled)
-	assert.Equal(t, "f-42", ocFile)
-	assert.Equal(t, "u-7", ocUser)
-	assert.Equal(t, "f-42", mdFile)
+	_, stored := s.get("files/" + id("f-42"))
+	assert.False(t, stored)
+	var n int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM files WHERE id = md5('f-42')::uuid`).Scan(&n))
+	assert.Equal(t, 0, n)
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM received_files WHERE file_id = md5('f-42')::uuid`).Scan(&n))
+	assert.Equal(t, 0, n)
 }
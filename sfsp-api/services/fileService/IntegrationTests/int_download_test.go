@@ -15,12 +15,10 @@ import (
 	"net/http/httptest"
 	"testing"
 
-	monkey "bou.ke/monkey"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	fh "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
 
 	_ "github.com/lib/pq"
 )
@@ -46,52 +44,46 @@ func doJSON(t *testing.T, method, path string, body any, h http.HandlerFunc) (*h
 }
 
 func TestDownloadHandler_InvalidJSON(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-	rr, body := doJSON(t, http.MethodPost, "/download", `{"userId":"u1",`, fh.DownloadHandler)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
+	rr, body := doJSON(t, http.MethodPost, "/download", `{"userId":"u1",`, srv.DownloadHandler)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, string(body), "Invalid JSON payload")
 }
 
 func TestDownloadHandler_MissingFields(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 	rr, body := doJSON(t, http.MethodPost, "/download", map[string]string{
 		"userId": "",
 		"fileId": "f1",
-	}, fh.DownloadHandler)
+	}, srv.DownloadHandler)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, string(body), "Missing userId or fileId")
 }
 
 func TestDownloadHandler_NotFound(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
 	pg := startPostgres(t)        
 	db := openDB(t, pg.DSN)      
 	t.Cleanup(func() { _ = db.Close() })
-	seedBasicFileSchema(t, db)    
+	migrateDB(t, db)    
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
 	rr, body := doJSON(t, http.MethodPost, "/download", map[string]string{
 		"userId": "u1",
-		"fileId": "does-not-exist",
-	}, fh.DownloadHandler)
+		"fileId": id("does-not-exist"),
+	}, srv.DownloadHandler)
 	assert.Equal(t, http.StatusNotFound, rr.Code)
 	assert.Contains(t, string(body), "File not found")
 }
 
 func TestDownloadHandler_OwncloudError(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
 	pg := startPostgres(t)
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
-	seedBasicFileSchema(t, db)
+	migrateDB(t, db)
 
-	userID := "user-123"
-	fileID := "file-123"
+	userID := id("user-123")
+	fileID := id("file-123")
 	fileName := "report.pdf"
 	nonce := "test-nonce"
 	content := []byte("hello world")
@@ -104,33 +96,25 @@ func TestDownloadHandler_OwncloudError(t *testing.T) {
 	`, fileID, userID, fileName, nonce, fileHash, "cid-xyz")
 	require.NoError(t, err)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
-
-	monkey.Patch(owncloud.DownloadFileStream, func(fid string) (io.ReadCloser, error) {
-		return nil, fmt.Errorf("simulated owncloud failure")
-	})
+	srv := fh.New(db, brokenStore{memStore: newMemStore(), prefix: "files/", err: fmt.Errorf("simulated owncloud failure")}, fh.Config{})
 
 	rr, body := doJSON(t, http.MethodPost, "/download", map[string]string{
 		"userId": userID,
 		"fileId": fileID,
-	}, fh.DownloadHandler)
+	}, srv.DownloadHandler)
 
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, string(body), "Download failed")
 }
 
 func TestDownloadHandler_Success_StreamsWithHeaders_AndBody(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
 	pg := startPostgres(t)
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
-	seedBasicFileSchema(t, db)
+	migrateDB(t, db)
 
-	userID := "user-abc"
-	fileID := "f-42"
+	userID := id("user-abc")
+	fileID := id("f-42")
 	fileName := "evidence.bin"
 	nonce := "nonce-999"
 	content := []byte("squeaky clean bytes")
@@ -143,19 +127,14 @@ func TestDownloadHandler_Success_StreamsWithHeaders_AndBody(t *testing.T) {
 	`, fileID, userID, fileName, nonce, fileHash, "cid-any")
 	require.NoError(t, err)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
-
-	monkey.Patch(owncloud.DownloadFileStream, func(fid string) (io.ReadCloser, error) {
-		require.Equal(t, fileID, fid)
-		return io.NopCloser(bytes.NewReader(content)), nil
-	})
+	s := newMemStore()
+	s.put("files/"+fileID, content)
+	srv := fh.New(db, s, fh.Config{})
 
 	rr, body := doJSON(t, http.MethodPost, "/download", map[string]string{
 		"userId": userID,
 		"fileId": fileID,
-	}, fh.DownloadHandler)
+	}, srv.DownloadHandler)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Equal(t, "application/octet-stream", rr.Header().Get("Content-Type"))
@@ -170,46 +149,39 @@ func TestDownloadHandler_Success_StreamsWithHeaders_AndBody(t *testing.T) {
 }
 
 func TestDownloadSentFile_InvalidJSON(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-	rr, body := doJSON(t, http.MethodPost, "/download-sent", `{"filePath":`, fh.DownloadSentFile)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
+	rr, body := doJSON(t, http.MethodPost, "/download-sent", `{"filePath":`, srv.DownloadSentFile)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, string(body), "Invalid JSON payload")
 }
 
 func TestDownloadSentFile_MissingPath(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-	rr, body := doJSON(t, http.MethodPost, "/download-sent", map[string]string{"filePath": ""}, fh.DownloadSentFile)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
+	rr, body := doJSON(t, http.MethodPost, "/download-sent", map[string]string{"filePath": ""}, srv.DownloadSentFile)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, string(body), "Missing FilePath")
 }
 
 func TestDownloadSentFile_OwncloudError(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
-	monkey.Patch(owncloud.DownloadSentFileStream, func(path string) (io.ReadCloser, error) {
-		return nil, fmt.Errorf("simulated owncloud error")
-	})
+	srv := fh.New(nil, brokenStore{memStore: newMemStore(), prefix: "/sent/", err: fmt.Errorf("simulated owncloud error")}, fh.Config{})
 
-	rr, body := doJSON(t, http.MethodPost, "/download-sent", map[string]string{"filePath": "/sent/u1/f1"}, fh.DownloadSentFile)
+	rr, body := doJSON(t, http.MethodPost, "/download-sent", map[string]string{"filePath": "/sent/u1/f1"}, srv.DownloadSentFile)
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, string(body), "Download failed")
 }
 
 func TestDownloadSentFile_Success_StreamsBody(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
 	content := []byte("sent-file-bytes")
-	monkey.Patch(owncloud.DownloadSentFileStream, func(path string) (io.ReadCloser, error) {
-		require.Equal(t, "/sent/u1/f1", path)
-		return io.NopCloser(bytes.NewReader(content)), nil
-	})
+	s := newMemStore()
+	s.put("/sent/u1/f1", content)
+	srv := fh.New(nil, s, fh.Config{})
 
 	rr := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodPost, "/download-sent",
 		bytes.NewBufferString(`{"filePath":"/sent/u1/f1"}`))
 	req.Header.Set("Content-Type", "application/json")
 
-	fh.DownloadSentFile(rr, req)
+	srv.DownloadSentFile(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Equal(t, "application/octet-stream", rr.Header().Get("Content-Type"))
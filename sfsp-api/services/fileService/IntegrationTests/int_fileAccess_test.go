@@ -19,21 +19,6 @@ import (
 	_ "github.com/lib/pq"
 )
 
-func seedAccessLogSchema(t *testing.T, db *sql.DB) {
-	t.Helper()
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS access_logs (
-			id        TEXT PRIMARY KEY DEFAULT md5(random()::text),
-			file_id   TEXT NOT NULL,
-			user_id   TEXT NOT NULL,
-			action    TEXT NOT NULL,
-			message   TEXT NOT NULL,
-			timestamp TEXT NOT NULL DEFAULT to_char(NOW() AT TIME ZONE 'UTC','YYYY-MM-DD"T"HH24:MI:SS.MS"Z"')
-		);
-	`)
-	require.NoError(t, err)
-}
-
 func insertAccessLog(t *testing.T, db *sql.DB, fileID, userID, action, msg, ts string) {
 	t.Helper()
 	if ts == "" {
@@ -52,17 +37,19 @@ func insertAccessLog(t *testing.T, db *sql.DB, fileID, userID, action, msg, ts s
 }
 
 func TestAddAccesslogHandler_InvalidJSON(t *testing.T) {
-	rr, body := doJSON(t, http.MethodPost, "/access/add", `{"file_id":"f1",`, fh.AddAccesslogHandler)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
+	rr, body := doJSON(t, http.MethodPost, "/access/add", `{"file_id":"f1",`, srv.AddAccesslogHandler)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, string(body), "Invalid JSON payload")
 }
 
 func TestAddAccesslogHandler_MissingFields(t *testing.T) {
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 	rr, body := doJSON(t, http.MethodPost, "/access/add", map[string]string{
 		"file_id": "f1",
 		"user_id": "",
 		"action":  "VIEW",
-	}, fh.AddAccesslogHandler)
+	}, srv.AddAccesslogHandler)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, string(body), "Missing required fields")
 }
@@ -75,13 +62,11 @@ func TestAddAccesslogHandler_DBError_WhenTableMissing(t *testing.T) {
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
 	rr, body := doJSON(t, http.MethodPost, "/access/add", map[string]string{
 		"file_id": "f1", "user_id": "u1", "action": "VIEW", "message": "missing table should 500",
-	}, fh.AddAccesslogHandler)
+	}, srv.AddAccesslogHandler)
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, string(body), "Failed to add access log")
 }
@@ -93,19 +78,17 @@ func TestAddAccesslogHandler_Success_InsertsRow(t *testing.T) {
 	}
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
-	seedAccessLogSchema(t, db)
+	migrateDB(t, db)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
 	payload := map[string]string{
-		"file_id": "f-42",
-		"user_id": "u-7",
+		"file_id": id("f-42"),
+		"user_id": id("u-7"),
 		"action":  "DOWNLOAD",
 		"message": "downloaded file",
 	}
-	rr, body := doJSON(t, http.MethodPost, "/access/add", payload, fh.AddAccesslogHandler)
+	rr, body := doJSON(t, http.MethodPost, "/access/add", payload, srv.AddAccesslogHandler)
 
 	assert.Equal(t, http.StatusCreated, rr.Code)
 	assert.Contains(t, rr.Header().Get("Content-Type"), "application/json")
@@ -128,13 +111,11 @@ func TestGetAccesslogHandler_DBError_WhenTableMissing(t *testing.T) {
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
 	rr := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/access/list", nil)
-	fh.GetAccesslogHandler(rr, req)
+	srv.GetAccesslogHandler(rr, req)
 
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Failed to get access logs")
@@ -147,23 +128,21 @@ func TestGetAccesslogHandler_ReturnsAll_OrderedByTimestampDesc(t *testing.T) {
 	}
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
-	seedAccessLogSchema(t, db)
+	migrateDB(t, db)
 
 	tsOld := "2025-01-01T00:00:00.000Z"
 	tsMid := "2025-03-01T00:00:00.000Z"
 	tsNew := "2025-06-01T00:00:00.000Z"
 
-	insertAccessLog(t, db, "fa", "u1", "VIEW", "old", tsOld)
-	insertAccessLog(t, db, "fb", "u2", "EDIT", "mid", tsMid)
-	insertAccessLog(t, db, "fc", "u3", "DELETE", "new", tsNew)
+	insertAccessLog(t, db, id("fa"), id("u1"), "VIEW", "old", tsOld)
+	insertAccessLog(t, db, id("fb"), id("u2"), "EDIT", "mid", tsMid)
+	insertAccessLog(t, db, id("fc"), id("u3"), "DELETE", "new", tsNew)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
 	rr := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/access/list", nil)
-	fh.GetAccesslogHandler(rr, req)
+	srv.GetAccesslogHandler(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
@@ -184,19 +163,17 @@ func TestGetAccesslogHandler_FilterByFileID(t *testing.T) {
 	}
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
-	seedAccessLogSchema(t, db)
+	migrateDB(t, db)
 
-	insertAccessLog(t, db, "file-A", "u1", "VIEW", "a1", "2025-01-01T00:00:00.000Z")
-	insertAccessLog(t, db, "file-B", "u2", "VIEW", "b1", "2025-01-02T00:00:00.000Z")
-	insertAccessLog(t, db, "file-A", "u3", "EDIT", "a2", "2025-02-01T00:00:00.000Z")
+	insertAccessLog(t, db, id("file-A"), id("u1"), "VIEW", "a1", "2025-01-01T00:00:00.000Z")
+	insertAccessLog(t, db, id("file-B"), id("u2"), "VIEW", "b1", "2025-01-02T00:00:00.000Z")
+	insertAccessLog(t, db, id("file-A"), id("u3"), "EDIT", "a2", "2025-02-01T00:00:00.000Z")
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
 	rr := httptest.NewRecorder()
-	req := httptest.NewRequest(http.MethodGet, "/access/list?file_id=file-A", nil)
-	fh.GetAccesslogHandler(rr, req)
+	req := httptest.NewRequest(http.MethodGet, "/access/list?file_id="+id("file-A"), nil)
+	srv.GetAccesslogHandler(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 
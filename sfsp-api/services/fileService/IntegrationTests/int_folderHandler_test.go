@@ -5,7 +5,6 @@ package integration_test
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -18,42 +17,21 @@ import (
 	_ "github.com/lib/pq"
 )
 
-func seedFilesSchema(t *testing.T, db *sql.DB) {
-	t.Helper()
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS files (
-			id          TEXT PRIMARY KEY DEFAULT md5(random()::text),
-			owner_id    TEXT NOT NULL,
-			file_name   TEXT NOT NULL,
-			file_type   TEXT NOT NULL,
-			file_size   BIGINT NOT NULL,
-			cid         TEXT,
-			nonce       TEXT,
-			description TEXT,
-			tags        TEXT[] NOT NULL,
-			created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
-		);
-	`)
-	require.NoError(t, err)
-}
-
 func TestCreateFolderHandler_InvalidJSON(t *testing.T) {
-	rr, body := doJSON(t, http.MethodPost, "/folders/create", `{"userId": "u1",`, fh.CreateFolderHandler)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
+	rr, body := doJSON(t, http.MethodPost, "/folders/create", `{"userId": "u1",`, srv.CreateFolderHandler)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, string(body), "Invalid JSON")
-	assert.Equal(t, "*", rr.Header().Get("Access-Control-Allow-Origin"))
-	assert.Contains(t, rr.Header().Get("Access-Control-Allow-Headers"), "Content-Type")
 }
 
 func TestCreateFolderHandler_MissingFields(t *testing.T) {
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 	rr, body := doJSON(t, http.MethodPost, "/folders/create", map[string]string{
 		"userId":     "",
 		"folderName": "Docs",
-	}, fh.CreateFolderHandler)
+	}, srv.CreateFolderHandler)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, string(body), "Missing userId or folderName")
-	assert.Equal(t, "*", rr.Header().Get("Access-Control-Allow-Origin"))
-	assert.Contains(t, rr.Header().Get("Access-Control-Allow-Headers"), "Content-Type")
 }
 
 func TestCreateFolderHandler_DBError_TableMissing(t *testing.T) {
@@ -64,15 +42,13 @@ func TestCreateFolderHandler_DBError_TableMissing(t *testing.T) {
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
 	rr, body := doJSON(t, http.MethodPost, "/folders/create", map[string]any{
 		"userId":      "user-1",
 		"folderName":  "Invoices",
 		"description": "finance stuff",
-	}, fh.CreateFolderHandler)
+	}, srv.CreateFolderHandler)
 
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, string(body), "Failed to create folder")
@@ -85,23 +61,19 @@ func TestCreateFolderHandler_Success_RootFolder(t *testing.T) {
 	}
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
-	seedFilesSchema(t, db)
+	migrateDB(t, db)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
 	payload := map[string]any{
-		"userId":      "u-7",
+		"userId":      id("u-7"),
 		"folderName":  "RootFolder",
 		"description": "top level",
 	}
-	rr, body := doJSON(t, http.MethodPost, "/folders/create", payload, fh.CreateFolderHandler)
+	rr, body := doJSON(t, http.MethodPost, "/folders/create", payload, srv.CreateFolderHandler)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
-	assert.Equal(t, "*", rr.Header().Get("Access-Control-Allow-Origin"))
-	assert.Contains(t, rr.Header().Get("Access-Control-Allow-Headers"), "Content-Type")
 
 	var resp struct {
 		FolderID string `json:"folderId"`
@@ -118,7 +90,7 @@ func TestCreateFolderHandler_Success_RootFolder(t *testing.T) {
 	row := db.QueryRow(`SELECT owner_id, file_name, file_type, file_size, cid, nonce, description, tags FROM files WHERE id=$1`, resp.FolderID)
 	require.NoError(t, row.Scan(&ownerID, &fileName, &fileType, &fileSize, &cid, &nonce, &desc, &tagsArr))
 
-	assert.Equal(t, "u-7", ownerID)
+	assert.Equal(t, id("u-7"), ownerID)
 	assert.Equal(t, "RootFolder", fileName)
 	assert.Equal(t, "folder", fileType)
 	assert.Equal(t, int64(0), fileSize)
@@ -135,19 +107,17 @@ func TestCreateFolderHandler_Success_WithParentPath_TrailingSlashTrimmed(t *test
 	}
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
-	seedFilesSchema(t, db)
+	migrateDB(t, db)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
 	payload := map[string]any{
-		"userId":      "user-123",
+		"userId":      id("user-123"),
 		"folderName":  "Child",
 		"parentPath":  "my/docs/",
 		"description": "",
 	}
-	rr, body := doJSON(t, http.MethodPost, "/folders/create", payload, fh.CreateFolderHandler)
+	rr, body := doJSON(t, http.MethodPost, "/folders/create", payload, srv.CreateFolderHandler)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -165,7 +135,7 @@ func TestCreateFolderHandler_Success_WithParentPath_TrailingSlashTrimmed(t *test
 	row := db.QueryRow(`SELECT owner_id, file_name, file_type, file_size, cid, nonce, description, tags FROM files WHERE id=$1`, resp.FolderID)
 	require.NoError(t, row.Scan(&ownerID, &fileName, &fileType, &fileSize, &cid, &nonce, &desc, &tagsArr))
 
-	assert.Equal(t, "user-123", ownerID)
+	assert.Equal(t, id("user-123"), ownerID)
 	assert.Equal(t, "Child", fileName)
 	assert.Equal(t, "folder", fileType)
 	assert.Equal(t, int64(0), fileSize)
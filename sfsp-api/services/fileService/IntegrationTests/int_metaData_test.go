@@ -6,7 +6,6 @@ package integration_test
 import (
 	"bytes"
 	"context"
-	"database/sql"
 	"encoding/json"
 	//"fmt"
 	"net/http"
@@ -21,69 +20,6 @@ import (
 	md "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metadata"
 )
 
-const schemaFilesTagsText = `
-CREATE TABLE files (
-	id TEXT PRIMARY KEY DEFAULT md5(random()::text),
-	owner_id TEXT NOT NULL,
-	file_name TEXT NOT NULL,
-	file_type TEXT DEFAULT 'file',
-	file_size BIGINT DEFAULT 0,
-	description TEXT DEFAULT '',
-	tags TEXT DEFAULT '',
-	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
-	cid TEXT DEFAULT ''
-);
-`
-
-const schemaFilesTagsArray = `
-CREATE TABLE files (
-	id TEXT PRIMARY KEY DEFAULT md5(random()::text),
-	owner_id TEXT NOT NULL,
-	file_name TEXT NOT NULL,
-	file_type TEXT DEFAULT 'file',
-	file_size BIGINT DEFAULT 0,
-	description TEXT DEFAULT '',
-	tags TEXT[] DEFAULT '{}',
-	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
-	cid TEXT DEFAULT ''
-);
-`
-
-const schemaSharing = `
-CREATE TABLE received_files (
-	id TEXT PRIMARY KEY DEFAULT md5(random()::text),
-	sender_id TEXT NOT NULL,
-	recipient_id TEXT NOT NULL,
-	file_id TEXT NOT NULL,
-	received_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
-	expires_at TIMESTAMPTZ NOT NULL,
-	metadata TEXT NOT NULL,
-	accepted BOOLEAN NOT NULL DEFAULT FALSE
-);
-CREATE TABLE sent_files (
-	id TEXT PRIMARY KEY DEFAULT md5(random()::text),
-	sender_id TEXT NOT NULL,
-	recipient_id TEXT NOT NULL,
-	file_id TEXT NOT NULL,
-	encrypted_file_key TEXT,
-	x3dh_ephemeral_pubkey TEXT,
-	sent_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
-);
-CREATE TABLE users (
-	id TEXT PRIMARY KEY
-);
-CREATE TABLE one_time_pre_keys (
-	id TEXT PRIMARY KEY,
-	user_id TEXT NOT NULL
-);
-`
-
-func execSQL(t *testing.T, db *sql.DB, ddl string) {
-	t.Helper()
-	_, err := db.Exec(ddl)
-	require.NoError(t, err)
-}
-
 func TestGetUserFilesHandler_InvalidJSON_And_MissingUser(t *testing.T) {
 	pg := startPostgres(t)
 	if pg.Container != nil {
@@ -92,17 +28,15 @@ func TestGetUserFilesHandler_InvalidJSON_And_MissingUser(t *testing.T) {
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
 
-	prev := md.DB
-	md.SetPostgreClient(db)
-	t.Cleanup(func() { md.SetPostgreClient(prev) })
+	meta := md.New(db, md.Config{})
 
 	req := httptest.NewRequest(http.MethodPost, "/files/get", bytes.NewBufferString(`{"userId":`))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
-	md.GetUserFilesHandler(rr, req)
+	meta.GetUserFilesHandler(rr, req)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 
-	rr2, _ := doJSON(t, http.MethodPost, "/files/get", map[string]any{"userId": ""}, md.GetUserFilesHandler)
+	rr2, _ := doJSON(t, http.MethodPost, "/files/get", map[string]any{"userId": ""}, meta.GetUserFilesHandler)
 	assert.Equal(t, http.StatusBadRequest, rr2.Code)
 }
 
@@ -114,38 +48,34 @@ func TestGetUserFilesHandler_DBErr_NoSchema(t *testing.T) {
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
 
-	prev := md.DB
-	md.SetPostgreClient(db)
-	t.Cleanup(func() { md.SetPostgreClient(prev) })
+	meta := md.New(db, md.Config{})
 
-	rr, _ := doJSON(t, http.MethodPost, "/files/get", map[string]any{"userId": "u1"}, md.GetUserFilesHandler)
+	rr, _ := doJSON(t, http.MethodPost, "/files/get", map[string]any{"userId": id("u1")}, meta.GetUserFilesHandler)
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 }
 
-func TestGetUserFilesHandler_Success_WithStringTagsColumn(t *testing.T) {
+func TestGetUserFilesHandler_Success(t *testing.T) {
 	pg := startPostgres(t)
 	if pg.Container != nil {
 		t.Cleanup(func() { _ = pg.Container.Terminate(context.Background()) })
 	}
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
-	execSQL(t, db, schemaFilesTagsText)
+	migrateDB(t, db)
 
-	prev := md.DB
-	md.SetPostgreClient(db)
-	t.Cleanup(func() { md.SetPostgreClient(prev) })
+	meta := md.New(db, md.Config{})
 
 	_, err := db.Exec(`INSERT INTO files (id,owner_id,file_name,file_type,file_size,description,tags,cid)
-		VALUES ('f1','u1','doc.txt','text/plain',123,'desc','["a","b"]','files/u1/f1')`)
+		VALUES (md5('f1')::uuid,md5('u1')::uuid,'doc.txt','text/plain',123,'desc',ARRAY['a','b'],'files/u1/f1')`)
 	require.NoError(t, err)
 
-	rr, _ := doJSON(t, http.MethodPost, "/files/get", map[string]any{"userId": "u1"}, md.GetUserFilesHandler)
+	rr, _ := doJSON(t, http.MethodPost, "/files/get", map[string]any{"userId": id("u1")}, meta.GetUserFilesHandler)
 	assert.Equal(t, http.StatusOK, rr.Code)
 
 	var out []map[string]any
 	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &out))
 	require.Len(t, out, 1)
-	assert.Equal(t, "f1", out[0]["fileId"])
+	assert.Equal(t, id("f1"), out[0]["fileId"])
 	assert.Equal(t, "doc.txt", out[0]["fileName"])
 	assert.Equal(t, "files/u1/f1", out[0]["cid"])
 }
@@ -158,17 +88,15 @@ func TestListFileMetadataHandler_InvalidJSON_And_MissingUser(t *testing.T) {
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
 
-	prev := md.DB
-	md.SetPostgreClient(db)
-	t.Cleanup(func() { md.SetPostgreClient(prev) })
+	meta := md.New(db, md.Config{})
 
 	req := httptest.NewRequest(http.MethodPost, "/meta/list", bytes.NewBufferString(`{`))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
-	md.ListFileMetadataHandler(rr, req)
+	meta.ListFileMetadataHandler(rr, req)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 
-	rr2, _ := doJSON(t, http.MethodPost, "/meta/list", map[string]any{"userId": ""}, md.ListFileMetadataHandler)
+	rr2, _ := doJSON(t, http.MethodPost, "/meta/list", map[string]any{"userId": ""}, meta.ListFileMetadataHandler)
 	assert.Equal(t, http.StatusBadRequest, rr2.Code)
 }
 
@@ -180,11 +108,9 @@ func TestListFileMetadataHandler_DBErr_NoSchema(t *testing.T) {
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
 
-	prev := md.DB
-	md.SetPostgreClient(db)
-	t.Cleanup(func() { md.SetPostgreClient(prev) })
+	meta := md.New(db, md.Config{})
 
-	rr, _ := doJSON(t, http.MethodPost, "/meta/list", map[string]any{"userId": "u1"}, md.ListFileMetadataHandler)
+	rr, _ := doJSON(t, http.MethodPost, "/meta/list", map[string]any{"userId": id("u1")}, meta.ListFileMetadataHandler)
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 }
 
@@ -195,17 +121,15 @@ func TestListFileMetadataHandler_Success_ArrayTags(t *testing.T) {
 	}
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
-	execSQL(t, db, schemaFilesTagsArray)
+	migrateDB(t, db)
 
-	prev := md.DB
-	md.SetPostgreClient(db)
-	t.Cleanup(func() { md.SetPostgreClient(prev) })
+	meta := md.New(db, md.Config{})
 
 	_, err := db.Exec(`INSERT INTO files (id,owner_id,file_name,file_type,file_size,description,tags)
-		VALUES ('f2','u2','img.jpg','image/jpeg',999,'pic',ARRAY['x','y'])`)
+		VALUES (md5('f2')::uuid,md5('u2')::uuid,'img.jpg','image/jpeg',999,'pic',ARRAY['x','y'])`)
 	require.NoError(t, err)
 
-	rr, _ := doJSON(t, http.MethodPost, "/meta/list", map[string]any{"userId": "u2"}, md.ListFileMetadataHandler)
+	rr, _ := doJSON(t, http.MethodPost, "/meta/list", map[string]any{"userId": id("u2")}, meta.ListFileMetadataHandler)
 	assert.Equal(t, http.StatusOK, rr.Code)
 
 	var out []struct {
@@ -215,7 +139,7 @@ func TestListFileMetadataHandler_Success_ArrayTags(t *testing.T) {
 	}
 	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &out))
 	require.Len(t, out, 1)
-	assert.Equal(t, "f2", out[0].FileID)
+	assert.Equal(t, id("f2"), out[0].FileID)
 	assert.ElementsMatch(t, []string{"x", "y"}, out[0].Tags)
 }
 
@@ -227,17 +151,15 @@ func TestGetUserFileCountHandler_BadJSON_And_Missing(t *testing.T) {
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
 
-	prev := md.DB
-	md.SetPostgreClient(db)
-	t.Cleanup(func() { md.SetPostgreClient(prev) })
+	meta := md.New(db, md.Config{})
 
 	req := httptest.NewRequest(http.MethodPost, "/count", bytes.NewBufferString(`zzz`))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
-	md.GetUserFileCountHandler(rr, req)
+	meta.GetUserFileCountHandler(rr, req)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 
-	rr2, _ := doJSON(t, http.MethodPost, "/count", map[string]any{"userId": ""}, md.GetUserFileCountHandler)
+	rr2, _ := doJSON(t, http.MethodPost, "/count", map[string]any{"userId": ""}, meta.GetUserFileCountHandler)
 	assert.Equal(t, http.StatusBadRequest, rr2.Code)
 }
 
@@ -248,16 +170,15 @@ func TestGetUserFileCountHandler_Success_ExcludesFolders(t *testing.T) {
 	}
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
-	execSQL(t, db, schemaFilesTagsArray)
+	migrateDB(t, db)
 
-	prev := md.DB
-	md.SetPostgreClient(db)
-	t.Cleanup(func() { md.SetPostgreClient(prev) })
+	meta := md.New(db, md.Config{})
 
-	_, _ = db.Exec(`INSERT INTO files (id,owner_id,file_name,file_type) VALUES 
-		('a','u3','doc1','file'),('b','u3','doc2','file'),('c','u3','fold','folder')`)
+	_, err := db.Exec(`INSERT INTO files (id,owner_id,file_name,file_type) VALUES
+		(md5('a')::uuid,md5('u3')::uuid,'doc1','file'),(md5('b')::uuid,md5('u3')::uuid,'doc2','file'),(md5('c')::uuid,md5('u3')::uuid,'fold','folder')`)
+	require.NoError(t, err)
 
-	rr, _ := doJSON(t, http.MethodPost, "/count", map[string]any{"userId": "u3"}, md.GetUserFileCountHandler)
+	rr, _ := doJSON(t, http.MethodPost, "/count", map[string]any{"userId": id("u3")}, meta.GetUserFileCountHandler)
 	assert.Equal(t, http.StatusOK, rr.Code)
 
 	var out map[string]int
@@ -272,33 +193,37 @@ func TestAddReceivedFileHandler_And_GetPendingFilesHandler(t *testing.T) {
 	}
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
-	execSQL(t, db, schemaSharing)
+	migrateDB(t, db)
 
-	prev := md.DB
-	md.SetPostgreClient(db)
-	t.Cleanup(func() { md.SetPostgreClient(prev) })
+	meta := md.New(db, md.Config{})
 
 	rrBad, _ := doJSON(t, http.MethodPost, "/received/add",
 		map[string]any{"senderId": "", "recipientId": "", "fileId": ""},
-		md.AddReceivedFileHandler)
+		meta.AddReceivedFileHandler)
 	assert.Equal(t, http.StatusBadRequest, rrBad.Code)
 
+	_, err := db.Exec(`INSERT INTO files (id,owner_id,file_name) VALUES
+		(md5('F')::uuid,md5('S')::uuid,'f'),(md5('Fx')::uuid,md5('S')::uuid,'fx'),
+		(md5('Fy')::uuid,md5('S')::uuid,'fy'),(md5('Fz')::uuid,md5('S')::uuid,'fz')`)
+	require.NoError(t, err)
+
 	rr, _ := doJSON(t, http.MethodPost, "/received/add",
 		map[string]any{
-			"senderId":    "S",
-			"recipientId": "R",
-			"fileId":      "F",
+			"senderId":    id("S"),
+			"recipientId": id("R"),
+			"fileId":      id("F"),
 			"metadata":    map[string]any{"note": "hello"},
-		}, md.AddReceivedFileHandler)
+		}, meta.AddReceivedFileHandler)
 	assert.Equal(t, http.StatusCreated, rr.Code)
 
-	_, _ = db.Exec(`INSERT INTO received_files (sender_id,recipient_id,file_id,received_at,expires_at,metadata,accepted)
-		VALUES 
-		('S','U','Fx', NOW()-'2h'::interval, NOW()-'1h'::interval, '{}' , FALSE),
-		('S','U','Fy', NOW(), NOW()+'2h'::interval, '{}' , FALSE),
-		('S','U','Fz', NOW(), NOW()+'2h'::interval, '{}' , TRUE)`)
+	_, err = db.Exec(`INSERT INTO received_files (sender_id,recipient_id,file_id,received_at,expires_at,metadata,accepted)
+		VALUES
+		(md5('S')::uuid,md5('U')::uuid,md5('Fx')::uuid, NOW()-'2h'::interval, NOW()-'1h'::interval, '{}' , FALSE),
+		(md5('S')::uuid,md5('U')::uuid,md5('Fy')::uuid, NOW(), NOW()+'2h'::interval, '{}' , FALSE),
+		(md5('S')::uuid,md5('U')::uuid,md5('Fz')::uuid, NOW(), NOW()+'2h'::interval, '{}' , TRUE)`)
+	require.NoError(t, err)
 
-	rr2, _ := doJSON(t, http.MethodPost, "/received/pending", map[string]any{"userId": "U"}, md.GetPendingFilesHandler)
+	rr2, _ := doJSON(t, http.MethodPost, "/received/pending", map[string]any{"userId": id("U")}, meta.GetPendingFilesHandler)
 	assert.Equal(t, http.StatusOK, rr2.Code)
 
 	var wrap struct {
@@ -306,7 +231,7 @@ func TestAddReceivedFileHandler_And_GetPendingFilesHandler(t *testing.T) {
 	}
 	require.NoError(t, json.Unmarshal(rr2.Body.Bytes(), &wrap))
 	require.Len(t, wrap.Data, 1)
-	assert.Equal(t, "Fy", wrap.Data[0]["fileId"])
+	assert.Equal(t, id("Fy"), wrap.Data[0]["fileId"])
 }
 
 func TestAddSentFileHandler_And_GetSentFilesHandler(t *testing.T) {
@@ -316,30 +241,31 @@ func TestAddSentFileHandler_And_GetSentFilesHandler(t *testing.T) {
 	}
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
-	execSQL(t, db, schemaSharing)
+	migrateDB(t, db)
 
-	prev := md.DB
-	md.SetPostgreClient(db)
-	t.Cleanup(func() { md.SetPostgreClient(prev) })
+	meta := md.New(db, md.Config{})
 
 	rrBad, _ := doJSON(t, http.MethodPost, "/sent/add",
 		map[string]any{"senderId": "", "recipientId": "", "fileId": ""},
-		md.AddSentFileHandler)
+		meta.AddSentFileHandler)
 	assert.Equal(t, http.StatusBadRequest, rrBad.Code)
 
+	_, err := db.Exec(`INSERT INTO files (id,owner_id,file_name) VALUES (md5('F')::uuid,md5('A')::uuid,'f')`)
+	require.NoError(t, err)
+
 	rr, _ := doJSON(t, http.MethodPost, "/sent/add",
-		map[string]any{"senderId": "A", "recipientId": "B", "fileId": "F"},
-		md.AddSentFileHandler)
+		map[string]any{"senderId": id("A"), "recipientId": id("B"), "fileId": id("F")},
+		meta.AddSentFileHandler)
 	assert.Equal(t, http.StatusCreated, rr.Code)
 
-	rr2, _ := doJSON(t, http.MethodPost, "/sent/get", map[string]any{"userId": "A"}, md.GetSentFilesHandler)
+	rr2, _ := doJSON(t, http.MethodPost, "/sent/get", map[string]any{"userId": id("A")}, meta.GetSentFilesHandler)
 	assert.Equal(t, http.StatusOK, rr2.Code)
 
 	var out []map[string]any
 	require.NoError(t, json.Unmarshal(rr2.Body.Bytes(), &out))
 	require.Len(t, out, 1)
-	assert.Equal(t, "B", out[0]["recipientId"])
-	assert.Equal(t, "F", out[0]["fileId"])
+	assert.Equal(t, id("B"), out[0]["recipientId"])
+	assert.Equal(t, id("F"), out[0]["fileId"])
 }
 
 func TestDeleteFileMetadata_RemovesAllRows(t *testing.T) {
@@ -349,24 +275,24 @@ func TestDeleteFileMetadata_RemovesAllRows(t *testing.T) {
 	}
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
-	execSQL(t, db, schemaFilesTagsArray)
-	execSQL(t, db, schemaSharing)
+	migrateDB(t, db)
 
-	prev := md.DB
-	md.SetPostgreClient(db)
-	t.Cleanup(func() { md.SetPostgreClient(prev) })
+	meta := md.New(db, md.Config{})
 
-	_, _ = db.Exec(`INSERT INTO files (id,owner_id,file_name) VALUES ('F1','U','doc')`)
-	_, _ = db.Exec(`INSERT INTO sent_files (sender_id,recipient_id,file_id) VALUES ('U','R','F1')`)
-	_, _ = db.Exec(`INSERT INTO received_files (sender_id,recipient_id,file_id,expires_at,metadata) VALUES ('U','R','F1', NOW()+'1d'::interval,'{}')`)
+	_, err := db.Exec(`INSERT INTO files (id,owner_id,file_name) VALUES (md5('F1')::uuid,md5('U')::uuid,'doc')`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO sent_files (sender_id,recipient_id,file_id) VALUES (md5('U')::uuid,md5('R')::uuid,md5('F1')::uuid)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO received_files (sender_id,recipient_id,file_id,expires_at,metadata) VALUES (md5('U')::uuid,md5('R')::uuid,md5('F1')::uuid, NOW()+'1d'::interval,'{}')`)
+	require.NoError(t, err)
 
-	err := md.DeleteFileMetadata("F1")
+	err = meta.DeleteFileMetadata(context.Background(), id("F1"))
 	require.NoError(t, err)
 
 	var c1, c2, c3 int
-	_ = db.QueryRow(`SELECT COUNT(*) FROM files WHERE id='F1'`).Scan(&c1)
-	_ = db.QueryRow(`SELECT COUNT(*) FROM sent_files WHERE file_id='F1'`).Scan(&c2)
-	_ = db.QueryRow(`SELECT COUNT(*) FROM received_files WHERE file_id='F1'`).Scan(&c3)
+	_ = db.QueryRow(`SELECT COUNT(*) FROM files WHERE id=md5('F1')::uuid`).Scan(&c1)
+	_ = db.QueryRow(`SELECT COUNT(*) FROM sent_files WHERE file_id=md5('F1')::uuid`).Scan(&c2)
+	_ = db.QueryRow(`SELECT COUNT(*) FROM received_files WHERE file_id=md5('F1')::uuid`).Scan(&c3)
 	assert.Equal(t, 0, c1+c2+c3)
 }
 
@@ -377,26 +303,25 @@ func TestRemoveTagsFromFileHandler_And_AddTagsHandler(t *testing.T) {
 	}
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
-	execSQL(t, db, schemaFilesTagsArray)
+	migrateDB(t, db)
 
-	prev := md.DB
-	md.SetPostgreClient(db)
-	t.Cleanup(func() { md.SetPostgreClient(prev) })
+	meta := md.New(db, md.Config{})
 
-	_, _ = db.Exec(`INSERT INTO files (id,owner_id,file_name,tags) VALUES ('Fx','U','doc', ARRAY['a','b','c'])`)
+	_, err := db.Exec(`INSERT INTO files (id,owner_id,file_name,tags) VALUES (md5('Fx')::uuid,md5('U')::uuid,'doc', ARRAY['a','b','c'])`)
+	require.NoError(t, err)
 
-	rr, _ := doJSON(t, http.MethodPost, "/tags/remove", map[string]any{"fileId": "Fx", "tags": []string{"b"}}, md.RemoveTagsFromFileHandler)
+	rr, _ := doJSON(t, http.MethodPost, "/tags/remove", map[string]any{"fileId": id("Fx"), "tags": []string{"b"}}, meta.RemoveTagsFromFileHandler)
 	assert.Equal(t, http.StatusOK, rr.Code)
 
 	var tags []string
-	_ = db.QueryRow(`SELECT tags FROM files WHERE id='Fx'`).Scan(pq.Array(&tags))
+	_ = db.QueryRow(`SELECT tags FROM files WHERE id=md5('Fx')::uuid`).Scan(pq.Array(&tags))
 	assert.ElementsMatch(t, []string{"a", "c"}, tags)
 
-	rr2, _ := doJSON(t, http.MethodPost, "/tags/add", map[string]any{"fileId": "Fx", "tags": []string{"d", "e"}}, md.AddTagsHandler)
+	rr2, _ := doJSON(t, http.MethodPost, "/tags/add", map[string]any{"fileId": id("Fx"), "tags": []string{"d", "e"}}, meta.AddTagsHandler)
 	assert.Equal(t, http.StatusOK, rr2.Code)
 
 	tags = nil
-	_ = db.QueryRow(`SELECT tags FROM files WHERE id='Fx'`).Scan(pq.Array(&tags))
+	_ = db.QueryRow(`SELECT tags FROM files WHERE id=md5('Fx')::uuid`).Scan(pq.Array(&tags))
 	assert.ElementsMatch(t, []string{"a", "c", "d", "e"}, tags)
 }
 
@@ -407,37 +332,39 @@ func TestGetRecipientIDFromOPK_And_InsertReceived_Sent(t *testing.T) {
 	}
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
-	execSQL(t, db, schemaSharing)
+	migrateDB(t, db)
 
-	prev := md.DB
-	md.SetPostgreClient(db)
-	t.Cleanup(func() { md.SetPostgreClient(prev) })
+	meta := md.New(db, md.Config{})
 
-	_, _ = db.Exec(`INSERT INTO users (id) VALUES ('U1')`)
-	_, _ = db.Exec(`INSERT INTO one_time_pre_keys (id,user_id) VALUES ('OPK1','U1')`)
+	_, err := db.Exec(`INSERT INTO users (id) VALUES (md5('U1')::uuid)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO one_time_pre_keys (id,user_id) VALUES (md5('OPK1')::uuid,md5('U1')::uuid)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO files (id,owner_id,file_name) VALUES (md5('F')::uuid,md5('S')::uuid,'f')`)
+	require.NoError(t, err)
 
-	u, err := md.GetRecipientIDFromOPK("OPK1")
+	u, err := meta.GetRecipientIDFromOPK(context.Background(), id("OPK1"))
 	require.NoError(t, err)
-	assert.Equal(t, "U1", u)
+	assert.Equal(t, id("U1"), u)
 
-	_, err = md.InsertReceivedFile(db, "NO_USER", "S", "F", "{}", time.Now().Add(24*time.Hour))
+	_, err = meta.InsertReceivedFile(context.Background(), id("NO_USER"), id("S"), id("F"), "{}", time.Now().Add(24*time.Hour))
 	assert.Error(t, err)
 
-	id, err := md.InsertReceivedFile(db, "U1", "S", "F", `{"meta":"x"}`, time.Now().Add(24*time.Hour))
+	receivedID, err := meta.InsertReceivedFile(context.Background(), id("U1"), id("S"), id("F"), `{"meta":"x"}`, time.Now().Add(24*time.Hour))
 	require.NoError(t, err)
-	require.NotEmpty(t, id)
+	require.NotEmpty(t, receivedID)
 
-	err = md.InsertSentFile(db, "S", "U1", "F", `not-json`)
+	err = meta.InsertSentFile(context.Background(), id("S"), id("U1"), id("F"), `not-json`)
 	assert.Error(t, err)
 
-	err = md.InsertSentFile(db, "S", "U1", "F", `{}`)
+	err = meta.InsertSentFile(context.Background(), id("S"), id("U1"), id("F"), `{}`)
 	assert.Error(t, err)
 
-	err = md.InsertSentFile(db, "S", "U1", "F", `{"encryptedAesKey":"EKEY","ekPublicKey":"PUB"}`)
+	err = meta.InsertSentFile(context.Background(), id("S"), id("U1"), id("F"), `{"encryptedAesKey":"EKEY","ekPublicKey":"PUB"}`)
 	require.NoError(t, err)
 
 	var count int
-	_ = db.QueryRow(`SELECT COUNT(*) FROM sent_files WHERE sender_id='S' AND recipient_id='U1' AND file_id='F'`).Scan(&count)
+	_ = db.QueryRow(`SELECT COUNT(*) FROM sent_files WHERE sender_id=md5('S')::uuid AND recipient_id=md5('U1')::uuid AND file_id=md5('F')::uuid`).Scan(&count)
 	assert.Equal(t, 1, count)
 }
 
@@ -448,28 +375,26 @@ func TestUserAndFileUpdatesHandlers_SuccessPaths(t *testing.T) {
 	}
 	db := openDB(t, pg.DSN)
 	t.Cleanup(func() { _ = db.Close() })
-	execSQL(t, db, schemaFilesTagsArray)
-	execSQL(t, db, schemaSharing)
+	migrateDB(t, db)
 
-	prev := md.DB
-	md.SetPostgreClient(db)
-	t.Cleanup(func() { md.SetPostgreClient(prev) })
+	meta := md.New(db, md.Config{})
 
-	rr, _ := doJSON(t, http.MethodPost, "/user/add", map[string]any{"userId": "UX"}, md.AddUserHandler)
+	rr, _ := doJSON(t, http.MethodPost, "/user/add", map[string]any{"userId": id("UX")}, meta.AddUserHandler)
 	assert.Equal(t, http.StatusOK, rr.Code)
-	rr2, _ := doJSON(t, http.MethodPost, "/user/add", map[string]any{"userId": "UX"}, md.AddUserHandler) // idempotent
+	rr2, _ := doJSON(t, http.MethodPost, "/user/add", map[string]any{"userId": id("UX")}, meta.AddUserHandler) // idempotent
 	assert.Equal(t, http.StatusOK, rr2.Code)
 
-	_, _ = db.Exec(`INSERT INTO files (id,owner_id,file_name,description,cid) VALUES ('FF','UX','doc','old','old/path')`)
+	_, err := db.Exec(`INSERT INTO files (id,owner_id,file_name,description,cid) VALUES (md5('FF')::uuid,md5('UX')::uuid,'doc','old','old/path')`)
+	require.NoError(t, err)
 
-	rr3, _ := doJSON(t, http.MethodPost, "/file/desc", map[string]any{"fileId": "FF", "description": "new"}, md.AddDescriptionHandler)
+	rr3, _ := doJSON(t, http.MethodPost, "/file/desc", map[string]any{"fileId": id("FF"), "description": "new"}, meta.AddDescriptionHandler)
 	assert.Equal(t, http.StatusOK, rr3.Code)
 
-	rr4, _ := doJSON(t, http.MethodPost, "/file/path", map[string]any{"fileId": "FF", "newPath": "new/path"}, md.UpdateFilePathHandler)
+	rr4, _ := doJSON(t, http.MethodPost, "/file/path", map[string]any{"fileId": id("FF"), "newPath": "new/path"}, meta.UpdateFilePathHandler)
 	assert.Equal(t, http.StatusOK, rr4.Code)
 
 	var desc, cid string
-	_ = db.QueryRow(`SELECT description,cid FROM files WHERE id='FF'`).Scan(&desc, &cid)
+	_ = db.QueryRow(`SELECT description,cid FROM files WHERE id=md5('FF')::uuid`).Scan(&desc, &cid)
 	assert.Equal(t, "new", desc)
 	assert.Equal(t, "new/path", cid)
 }
@@ -0,0 +1,93 @@
+//go:build integration
+// +build integration
+
+package integration_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/migrations"
+)
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+	var exists bool
+	require.NoError(t, db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, name).Scan(&exists))
+	return exists
+}
+
+func TestMigrations_UpDownUp(t *testing.T) {
+	pg := startPostgres(t)
+	if pg.Container != nil {
+		t.Cleanup(func() { _ = pg.Container.Terminate(context.Background()) })
+	}
+	db := openDB(t, pg.DSN)
+	t.Cleanup(func() { _ = db.Close() })
+	ctx := context.Background()
+
+	all, err := migrations.All()
+	require.NoError(t, err)
+
+	applied, err := migrations.Up(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, len(all), applied)
+	for _, table := range []string{"users", "one_time_pre_keys", "files", "received_files", "sent_files",
+		"shared_files_view", "access_logs", "notifications", "upload_sessions", "storage_stats"} {
+		assert.True(t, tableExists(t, db, table), table)
+	}
+
+	// a second run finds nothing to do
+	applied, err = migrations.Up(ctx, db)
+	require.NoError(t, err)
+	assert.Zero(t, applied)
+	version, pending, err := migrations.Status(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, len(all), version)
+	assert.Empty(t, pending)
+
+	reverted, err := migrations.Down(ctx, db, len(all))
+	require.NoError(t, err)
+	assert.Equal(t, len(all), reverted)
+	assert.False(t, tableExists(t, db, "files"))
+	assert.False(t, tableExists(t, db, "storage_stats"))
+	version, pending, err = migrations.Status(ctx, db)
+	require.NoError(t, err)
+	assert.Zero(t, version)
+	assert.Len(t, pending, len(all))
+
+	applied, err = migrations.Up(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, len(all), applied)
+}
+
+func TestMigrations_StorageStatsTrackUploads(t *testing.T) {
+	pg := startPostgres(t)
+	if pg.Container != nil {
+		t.Cleanup(func() { _ = pg.Container.Terminate(context.Background()) })
+	}
+	db := openDB(t, pg.DSN)
+	t.Cleanup(func() { _ = db.Close() })
+	migrateDB(t, db)
+
+	_, err := db.Exec(`INSERT INTO files (id, owner_id, file_name, file_type, file_size) VALUES
+		(md5('a')::uuid, md5('u')::uuid, 'a.txt', 'text/plain', 10),
+		(md5('b')::uuid, md5('u')::uuid, 'b.txt', 'text/plain', 5)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`UPDATE files SET deleted_at = NOW() WHERE id = md5('b')::uuid`)
+	require.NoError(t, err)
+
+	var bytes, items int64
+	require.NoError(t, db.QueryRow(`SELECT bytes, items FROM storage_stats
+		WHERE owner_id = md5('u')::uuid AND kind = 'type' AND key = 'text/plain'`).Scan(&bytes, &items))
+	assert.Equal(t, int64(10), bytes)
+	assert.Equal(t, int64(1), items)
+	require.NoError(t, db.QueryRow(`SELECT bytes, items FROM storage_stats
+		WHERE owner_id = md5('u')::uuid AND kind = 'trash'`).Scan(&bytes, &items))
+	assert.Equal(t, int64(5), bytes)
+	assert.Equal(t, int64(1), items)
+}
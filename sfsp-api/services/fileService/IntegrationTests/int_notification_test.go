@@ -30,49 +30,9 @@ func openDBNotif(t *testing.T, dsn string) *sql.DB {
 	return db
 }
 
-func seedNotificationsSchema(t *testing.T, db *sql.DB) {
-	t.Helper()
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS notifications (
-			id TEXT PRIMARY KEY DEFAULT md5(random()::text),
-			type TEXT NOT NULL,
-			"from" TEXT NOT NULL,
-			"to" TEXT NOT NULL,
-			file_name TEXT NOT NULL,
-			file_id TEXT NOT NULL,
-			received_file_id TEXT NULL,
-			message TEXT DEFAULT '',
-			timestamp TEXT NOT NULL DEFAULT to_char(NOW() AT TIME ZONE 'UTC','YYYY-MM-DD"T"HH24:MI:SS.MS"Z"'),
-			status TEXT NOT NULL DEFAULT 'pending',
-			read BOOLEAN NOT NULL DEFAULT FALSE
-		);
-		CREATE TABLE IF NOT EXISTS files (
-			id TEXT PRIMARY KEY,
-			file_name TEXT NOT NULL,
-			file_type TEXT NOT NULL,
-			cid TEXT,
-			file_size BIGINT NOT NULL DEFAULT 0
-		);
-		CREATE TABLE IF NOT EXISTS received_files (
-			id TEXT PRIMARY KEY DEFAULT md5(random()::text),
-			file_id TEXT NOT NULL,
-			recipient_id TEXT NOT NULL,
-			metadata TEXT NOT NULL
-		);
-		-- In prod this might be a VIEW; for tests, a table with the same columns is fine.
-		CREATE TABLE IF NOT EXISTS shared_files_view (
-			sender_id TEXT NOT NULL,
-			recipient_id TEXT NOT NULL,
-			file_id TEXT NOT NULL,
-			metadata TEXT NOT NULL
-		);
-	`)
-	require.NoError(t, err)
-}
-
 func insertNotification(t *testing.T, db *sql.DB, n map[string]any) string {
 	t.Helper()
-	var id string
+	var notifID string
 	q := `INSERT INTO notifications (type,"from","to",file_name,file_id,received_file_id,message,status,read)
 	      VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING id`
 	if _, ok := n["received_file_id"]; !ok {
@@ -81,9 +41,9 @@ func insertNotification(t *testing.T, db *sql.DB, n map[string]any) string {
 	err := db.QueryRow(q,
 		n["type"], n["from"], n["to"], n["file_name"], n["file_id"],
 		n["received_file_id"], n["message"], n["status"], n["read"],
-	).Scan(&id)
+	).Scan(&notifID)
 	require.NoError(t, err)
-	return id
+	return notifID
 }
 
 func doJSONReq(t *testing.T, method, path string, body any, h http.HandlerFunc) (*httptest.ResponseRecorder, []byte) {
@@ -109,27 +69,27 @@ func doJSONReq(t *testing.T, method, path string, body any, h http.HandlerFunc)
 /* ------------------------------ Tests ------------------------------------- */
 
 func TestNotificationHandler_MethodNotAllowed(t *testing.T) {
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 	rr := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodPost, "/notifications?id=u1", nil)
-	fh.NotificationHandler(rr, req)
+	srv.NotificationHandler(rr, req)
 	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
 }
 
 func TestNotificationHandler_MissingUserID(t *testing.T) {
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 	rr := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/notifications", nil)
-	fh.NotificationHandler(rr, req)
+	srv.NotificationHandler(rr, req)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestNotificationHandler_DBNil(t *testing.T) {
-	prev := fh.DB
-	fh.DB = nil
-	defer func() { fh.DB = prev }()
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 
 	rr := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/notifications?id=u1", nil)
-	fh.NotificationHandler(rr, req)
+	srv.NotificationHandler(rr, req)
 
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	var resp map[string]any
@@ -145,13 +105,11 @@ func TestNotificationHandler_DBError_TableMissing(t *testing.T) {
 	db := openDBNotif(t, dsn)
 	t.Cleanup(func() { _ = db.Close() })
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
 	rr := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/notifications?id=u1", nil)
-	fh.NotificationHandler(rr, req)
+	srv.NotificationHandler(rr, req)
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 }
 
@@ -162,31 +120,29 @@ func TestNotificationHandler_Success_FiltersByRecipient(t *testing.T) {
 	}
 	db := openDBNotif(t, dsn)
 	t.Cleanup(func() { _ = db.Close() })
-	seedNotificationsSchema(t, db)
+	migrateDB(t, db)
 
 	insertNotification(t, db, map[string]any{
-		"type": "share", "from": "u1", "to": "u2",
-		"file_name": "a.txt", "file_id": "fa", "message": "m1",
+		"type": "share", "from": id("u1"), "to": id("u2"),
+		"file_name": "a.txt", "file_id": id("fa"), "message": "m1",
 		"status": "pending", "read": false,
 	})
 	insertNotification(t, db, map[string]any{
-		"type": "share", "from": "u9", "to": "u2",
-		"file_name": "b.txt", "file_id": "fb", "message": "m2",
+		"type": "share", "from": id("u9"), "to": id("u2"),
+		"file_name": "b.txt", "file_id": id("fb"), "message": "m2",
 		"status": "pending", "read": false,
 	})
 	insertNotification(t, db, map[string]any{
-		"type": "share", "from": "u1", "to": "u3",
-		"file_name": "c.txt", "file_id": "fc", "message": "m3",
+		"type": "share", "from": id("u1"), "to": id("u3"),
+		"file_name": "c.txt", "file_id": id("fc"), "message": "m3",
 		"status": "pending", "read": false,
 	})
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
 	rr := httptest.NewRecorder()
-	req := httptest.NewRequest(http.MethodGet, "/notifications?id=u2", nil)
-	fh.NotificationHandler(rr, req)
+	req := httptest.NewRequest(http.MethodGet, "/notifications?id="+id("u2"), nil)
+	srv.NotificationHandler(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 	var resp struct {
@@ -197,33 +153,34 @@ func TestNotificationHandler_Success_FiltersByRecipient(t *testing.T) {
 	assert.True(t, resp.Success)
 	require.Len(t, resp.Notifications, 2)
 	for _, n := range resp.Notifications {
-		assert.Equal(t, "u2", n["to"])
+		assert.Equal(t, id("u2"), n["to"])
 	}
 }
 
 func TestMarkAsReadHandler_MethodNotAllowed(t *testing.T) {
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 	rr := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/notifications/mark", nil)
-	fh.MarkAsReadHandler(rr, req)
+	srv.MarkAsReadHandler(rr, req)
 	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
 }
 
 func TestMarkAsReadHandler_InvalidBody(t *testing.T) {
-	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/mark", `{"id":`, fh.MarkAsReadHandler)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
+	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/mark", `{"id":`, srv.MarkAsReadHandler)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestMarkAsReadHandler_MissingID(t *testing.T) {
-	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/mark", map[string]string{"id": ""}, fh.MarkAsReadHandler)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
+	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/mark", map[string]string{"id": ""}, srv.MarkAsReadHandler)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestMarkAsReadHandler_DBNil(t *testing.T) {
-	prev := fh.DB
-	fh.DB = nil
-	defer func() { fh.DB = prev }()
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 
-	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/mark", map[string]string{"id": "x"}, fh.MarkAsReadHandler)
+	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/mark", map[string]string{"id": "x"}, srv.MarkAsReadHandler)
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 }
 
@@ -234,13 +191,11 @@ func TestMarkAsReadHandler_NotFound(t *testing.T) {
 	}
 	db := openDBNotif(t, dsn)
 	t.Cleanup(func() { _ = db.Close() })
-	seedNotificationsSchema(t, db)
+	migrateDB(t, db)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
-	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/mark", map[string]string{"id": "does-not-exist"}, fh.MarkAsReadHandler)
+	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/mark", map[string]string{"id": id("does-not-exist")}, srv.MarkAsReadHandler)
 	assert.Equal(t, http.StatusNotFound, rr.Code)
 }
 
@@ -251,54 +206,54 @@ func TestMarkAsReadHandler_Success(t *testing.T) {
 	}
 	db := openDBNotif(t, dsn)
 	t.Cleanup(func() { _ = db.Close() })
-	seedNotificationsSchema(t, db)
+	migrateDB(t, db)
 
-	id := insertNotification(t, db, map[string]any{
-		"type": "share", "from": "u1", "to": "u2",
-		"file_name": "a.txt", "file_id": "fa", "message": "m1",
+	notifID := insertNotification(t, db, map[string]any{
+		"type": "share", "from": id("u1"), "to": id("u2"),
+		"file_name": "a.txt", "file_id": id("fa"), "message": "m1",
 		"status": "pending", "read": false,
 	})
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
-	rr, body := doJSONReq(t, http.MethodPost, "/notifications/mark", map[string]string{"id": id}, fh.MarkAsReadHandler)
+	rr, body := doJSONReq(t, http.MethodPost, "/notifications/mark", map[string]string{"id": notifID}, srv.MarkAsReadHandler)
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Contains(t, string(body), "Notification marked as read")
 
 	var readVal bool
-	require.NoError(t, db.QueryRow(`SELECT read FROM notifications WHERE id=$1`, id).Scan(&readVal))
+	require.NoError(t, db.QueryRow(`SELECT read FROM notifications WHERE id=$1`, notifID).Scan(&readVal))
 	assert.True(t, readVal)
 }
 
 func TestRespondHandler_MethodNotAllowed(t *testing.T) {
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 	rr := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/notifications/respond", nil)
-	fh.RespondToShareRequestHandler(rr, req)
+	srv.RespondToShareRequestHandler(rr, req)
 	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
 }
 
 func TestRespondHandler_InvalidBody(t *testing.T) {
-	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/respond", `{"id":"x",`, fh.RespondToShareRequestHandler)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
+	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/respond", `{"id":"x",`, srv.RespondToShareRequestHandler)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestRespondHandler_MissingIDOrStatus(t *testing.T) {
-	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/respond", map[string]string{"id": "", "status": "accepted"}, fh.RespondToShareRequestHandler)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
+	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/respond", map[string]string{"id": "", "status": "accepted"}, srv.RespondToShareRequestHandler)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestRespondHandler_InvalidStatus(t *testing.T) {
-	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/respond", map[string]string{"id": "x", "status": "weird"}, fh.RespondToShareRequestHandler)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
+	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/respond", map[string]string{"id": "x", "status": "weird"}, srv.RespondToShareRequestHandler)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestRespondHandler_DBNil(t *testing.T) {
-	prev := fh.DB
-	fh.DB = nil
-	defer func() { fh.DB = prev }()
-	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/respond", map[string]string{"id": "x", "status": "accepted"}, fh.RespondToShareRequestHandler)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
+	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/respond", map[string]string{"id": "x", "status": "accepted"}, srv.RespondToShareRequestHandler)
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 }
 
@@ -309,13 +264,11 @@ func TestRespondHandler_NotFoundOnUpdate(t *testing.T) {
 	}
 	db := openDBNotif(t, dsn)
 	t.Cleanup(func() { _ = db.Close() })
-	seedNotificationsSchema(t, db)
+	migrateDB(t, db)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
-	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/respond", map[string]string{"id": "missing", "status": "accepted"}, fh.RespondToShareRequestHandler)
+	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/respond", map[string]string{"id": id("missing"), "status": "accepted"}, srv.RespondToShareRequestHandler)
 	assert.Equal(t, http.StatusNotFound, rr.Code)
 }
 
@@ -326,28 +279,29 @@ func TestRespondHandler_Accepted_WithReceivedFileID_ReturnsFileData(t *testing.T
 	}
 	db := openDBNotif(t, dsn)
 	t.Cleanup(func() { _ = db.Close() })
-	seedNotificationsSchema(t, db)
+	migrateDB(t, db)
 
-	_, err := db.Exec(`INSERT INTO files (id,file_name,file_type,cid,file_size) VALUES ('file-1','report.pdf','file','cid/rep',12345)`)
+	_, err := db.Exec(`INSERT INTO files (id,owner_id,file_name,file_type,cid,file_size) VALUES (md5('file-1')::uuid,md5('u1')::uuid,'report.pdf','file','cid/rep',12345)`)
 	require.NoError(t, err)
 
 	var rfID string
-	require.NoError(t, db.QueryRow(`INSERT INTO received_files (file_id,recipient_id,metadata) VALUES ('file-1','u2','{"k":"v"}') RETURNING id`).Scan(&rfID))
+	require.NoError(t, db.QueryRow(`
+		INSERT INTO received_files (file_id,sender_id,recipient_id,expires_at,metadata)
+		VALUES (md5('file-1')::uuid,md5('u1')::uuid,md5('u2')::uuid,NOW()+'1d'::interval,'{"k":"v"}') RETURNING id
+	`).Scan(&rfID))
 
 	notifID := insertNotification(t, db, map[string]any{
-		"type": "share", "from": "u1", "to": "u2",
-		"file_name": "report.pdf", "file_id": "file-1",
+		"type": "share", "from": id("u1"), "to": id("u2"),
+		"file_name": "report.pdf", "file_id": id("file-1"),
 		"received_file_id": rfID, "message": "please review",
 		"status": "pending", "read": false,
 	})
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
 	rr, body := doJSONReq(t, http.MethodPost, "/notifications/respond", map[string]string{
 		"id": notifID, "status": "accepted",
-	}, fh.RespondToShareRequestHandler)
+	}, srv.RespondToShareRequestHandler)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -360,9 +314,9 @@ func TestRespondHandler_Accepted_WithReceivedFileID_ReturnsFileData(t *testing.T
 	assert.True(t, resp.Success)
 	assert.Equal(t, "Notification status updated", resp.Message)
 	require.NotNil(t, resp.File)
-	assert.Equal(t, "file-1", resp.File["file_id"])
-	assert.Equal(t, "u1", resp.File["sender_id"])
-	assert.Equal(t, "u2", resp.File["recipient_id"])
+	assert.Equal(t, id("file-1"), resp.File["file_id"])
+	assert.Equal(t, id("u1"), resp.File["sender_id"])
+	assert.Equal(t, id("u2"), resp.File["recipient_id"])
 	assert.Equal(t, "report.pdf", resp.File["file_name"])
 	assert.Equal(t, "file", resp.File["file_type"])
 	assert.Equal(t, "cid/rep", resp.File["cid"])
@@ -378,28 +332,26 @@ func TestRespondHandler_Accepted_ViewOnly_ReturnsFileData(t *testing.T) {
 	}
 	db := openDBNotif(t, dsn)
 	t.Cleanup(func() { _ = db.Close() })
-	seedNotificationsSchema(t, db)
+	migrateDB(t, db)
 
-	_, err := db.Exec(`INSERT INTO files (id,file_name,file_type,cid,file_size) VALUES ('file-2','img.png','file','cid/img',777)`)
+	_, err := db.Exec(`INSERT INTO files (id,owner_id,file_name,file_type,cid,file_size) VALUES (md5('file-2')::uuid,md5('u1')::uuid,'img.png','file','cid/img',777)`)
 	require.NoError(t, err)
 
-	_, err = db.Exec(`INSERT INTO shared_files_view (sender_id,recipient_id,file_id,metadata) VALUES ('u1','u3','file-2','{"view":"only"}')`)
+	_, err = db.Exec(`INSERT INTO shared_files_view (sender_id,recipient_id,file_id,metadata) VALUES (md5('u1')::uuid,md5('u3')::uuid,md5('file-2')::uuid,'{"view":"only"}')`)
 	require.NoError(t, err)
 
 	notifID := insertNotification(t, db, map[string]any{
-		"type": "share", "from": "u1", "to": "u3",
-		"file_name": "img.png", "file_id": "file-2",
+		"type": "share", "from": id("u1"), "to": id("u3"),
+		"file_name": "img.png", "file_id": id("file-2"),
 		"message": "FYI",
 		"status": "pending", "read": false,
 	})
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
 	rr, body := doJSONReq(t, http.MethodPost, "/notifications/respond", map[string]string{
 		"id": notifID, "status": "accepted",
-	}, fh.RespondToShareRequestHandler)
+	}, srv.RespondToShareRequestHandler)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -414,27 +366,28 @@ func TestRespondHandler_Accepted_ViewOnly_ReturnsFileData(t *testing.T) {
 }
 
 func TestClearHandler_MethodNotAllowed(t *testing.T) {
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 	rr := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/notifications/clear", nil)
-	fh.ClearNotificationHandler(rr, req)
+	srv.ClearNotificationHandler(rr, req)
 	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
 }
 
 func TestClearHandler_InvalidBody(t *testing.T) {
-	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/clear", `{"id":`, fh.ClearNotificationHandler)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
+	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/clear", `{"id":`, srv.ClearNotificationHandler)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestClearHandler_MissingID(t *testing.T) {
-	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/clear", map[string]string{"id": ""}, fh.ClearNotificationHandler)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
+	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/clear", map[string]string{"id": ""}, srv.ClearNotificationHandler)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestClearHandler_DBNil(t *testing.T) {
-	prev := fh.DB
-	fh.DB = nil
-	defer func() { fh.DB = prev }()
-	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/clear", map[string]string{"id": "x"}, fh.ClearNotificationHandler)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
+	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/clear", map[string]string{"id": "x"}, srv.ClearNotificationHandler)
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 }
 
@@ -445,13 +398,11 @@ func TestClearHandler_NotFound(t *testing.T) {
 	}
 	db := openDBNotif(t, dsn)
 	t.Cleanup(func() { _ = db.Close() })
-	seedNotificationsSchema(t, db)
+	migrateDB(t, db)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
-	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/clear", map[string]string{"id": "missing"}, fh.ClearNotificationHandler)
+	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/clear", map[string]string{"id": id("missing")}, srv.ClearNotificationHandler)
 	assert.Equal(t, http.StatusNotFound, rr.Code)
 }
 
@@ -462,55 +413,54 @@ func TestClearHandler_Success(t *testing.T) {
 	}
 	db := openDBNotif(t, dsn)
 	t.Cleanup(func() { _ = db.Close() })
-	seedNotificationsSchema(t, db)
+	migrateDB(t, db)
 
-	id := insertNotification(t, db, map[string]any{
-		"type": "share", "from": "u1", "to": "u2",
-		"file_name": "a.txt", "file_id": "fa", "message": "m1",
+	notifID := insertNotification(t, db, map[string]any{
+		"type": "share", "from": id("u1"), "to": id("u2"),
+		"file_name": "a.txt", "file_id": id("fa"), "message": "m1",
 		"status": "pending", "read": false,
 	})
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
-	rr, body := doJSONReq(t, http.MethodPost, "/notifications/clear", map[string]string{"id": id}, fh.ClearNotificationHandler)
+	rr, body := doJSONReq(t, http.MethodPost, "/notifications/clear", map[string]string{"id": notifID}, srv.ClearNotificationHandler)
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Contains(t, string(body), "Notification deleted")
 
 	var count int
-	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM notifications WHERE id=$1`, id).Scan(&count))
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM notifications WHERE id=$1`, notifID).Scan(&count))
 	assert.Equal(t, 0, count)
 }
 
 
 func TestAddNotificationHandler_MethodNotAllowed(t *testing.T) {
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 	rr := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/notifications/add", nil)
-	fh.AddNotificationHandler(rr, req)
+	srv.AddNotificationHandler(rr, req)
 	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
 }
 
 func TestAddNotificationHandler_InvalidBody(t *testing.T) {
-	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/add", `{"type":"share",`, fh.AddNotificationHandler)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
+	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/add", `{"type":"share",`, srv.AddNotificationHandler)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestAddNotificationHandler_MissingRequired(t *testing.T) {
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/add", map[string]any{
 		"type": "share", "from": "u1", "to": "", "file_name": "doc", "file_id": "f1",
-	}, fh.AddNotificationHandler)
+	}, srv.AddNotificationHandler)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestAddNotificationHandler_DBNil(t *testing.T) {
-	prev := fh.DB
-	fh.DB = nil
-	defer func() { fh.DB = prev }()
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 
 	rr, _ := doJSONReq(t, http.MethodPost, "/notifications/add", map[string]any{
 		"type": "share", "from": "u1", "to": "u2", "file_name": "doc", "file_id": "f1",
-	}, fh.AddNotificationHandler)
+	}, srv.AddNotificationHandler)
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 }
 
@@ -521,17 +471,15 @@ func TestAddNotificationHandler_Success_ViewOnly(t *testing.T) {
 	}
 	db := openDBNotif(t, dsn)
 	t.Cleanup(func() { _ = db.Close() })
-	seedNotificationsSchema(t, db)
+	migrateDB(t, db)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
 	rr, body := doJSONReq(t, http.MethodPost, "/notifications/add", map[string]any{
-		"type": "share", "from": "u1", "to": "u2",
-		"file_name": "doc", "file_id": "f1", "message": "hey",
+		"type": "share", "from": id("u1"), "to": id("u2"),
+		"file_name": "doc", "file_id": id("f1"), "message": "hey",
 		"viewOnly": true,
-	}, fh.AddNotificationHandler)
+	}, srv.AddNotificationHandler)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 	var resp map[string]any
@@ -547,17 +495,15 @@ func TestAddNotificationHandler_Success_WithReceivedFileID(t *testing.T) {
 	}
 	db := openDBNotif(t, dsn)
 	t.Cleanup(func() { _ = db.Close() })
-	seedNotificationsSchema(t, db)
+	migrateDB(t, db)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
 	rr, body := doJSONReq(t, http.MethodPost, "/notifications/add", map[string]any{
-		"type": "share", "from": "u1", "to": "u2",
-		"file_name": "doc", "file_id": "f1", "message": "attach",
-		"receivedFileID": "rf-1",
-	}, fh.AddNotificationHandler)
+		"type": "share", "from": id("u1"), "to": id("u2"),
+		"file_name": "doc", "file_id": id("f1"), "message": "attach",
+		"receivedFileID": id("rf-1"),
+	}, srv.AddNotificationHandler)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 	var resp map[string]any
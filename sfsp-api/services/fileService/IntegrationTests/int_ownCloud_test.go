@@ -5,6 +5,7 @@ package integration_test
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io"
 	"net/http/httptest"
@@ -12,12 +13,12 @@ import (
 	"strings"
 	"sync"
 	"testing"
-	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	oc "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/storage"
 )
 
 type memDAV struct {
@@ -124,10 +125,9 @@ func (m *memDAV) Remove(path string) error {
 
 func TestUploadFileStream_Success_TrimsLeadingSlash(t *testing.T) {
 	mem := newMemDAV()
-	oc.SetClient(mem)
-	t.Cleanup(func() { oc.SetClient(nil) })
+	client := oc.New(storage.NewWebDAVFromClient(mem))
 
-	err := oc.UploadFileStream("/temp", "a.txt", bytes.NewBufferString("PAYLOAD"))
+	err := client.UploadFileStream(context.Background(), "/temp", "a.txt", bytes.NewBufferString("PAYLOAD"))
 	require.NoError(t, err)
 
 	mem.mu.Lock()
@@ -138,27 +138,25 @@ func TestUploadFileStream_Success_TrimsLeadingSlash(t *testing.T) {
 
 func TestUploadFileStream_MkdirFail_And_WriteFail(t *testing.T) {
 	mem := newMemDAV()
-	oc.SetClient(mem)
-	t.Cleanup(func() { oc.SetClient(nil) })
+	client := oc.New(storage.NewWebDAVFromClient(mem))
 
 	mem.errMkdir["temp"] = errors.New("mkfail")
-	err := oc.UploadFileStream("temp", "f.bin", bytes.NewBufferString("X"))
+	err := client.UploadFileStream(context.Background(), "temp", "f.bin", bytes.NewBufferString("X"))
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "mkdir failed")
 	delete(mem.errMkdir, "temp")
 
 	mem.errWStrm["temp/f.bin"] = errors.New("wserr")
-	err = oc.UploadFileStream("temp", "f.bin", bytes.NewBufferString("X"))
+	err = client.UploadFileStream(context.Background(), "temp", "f.bin", bytes.NewBufferString("X"))
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "stream write failed")
 }
 
 func TestCreateFileStream_Success_WritesAndCloses(t *testing.T) {
 	mem := newMemDAV()
-	oc.SetClient(mem)
-	t.Cleanup(func() { oc.SetClient(nil) })
+	client := oc.New(storage.NewWebDAVFromClient(mem))
 
-	w, err := oc.CreateFileStream("/files", "doc")
+	w, err := client.CreateFileStream(context.Background(), "/files", "doc")
 	require.NoError(t, err)
 
 	_, err = w.Write([]byte("HELLO "))
@@ -167,9 +165,6 @@ func TestCreateFileStream_Success_WritesAndCloses(t *testing.T) {
 	require.NoError(t, err)
 	require.NoError(t, w.Close())
 
-	// allow goroutine to finish streaming
-	time.Sleep(20 * time.Millisecond)
-
 	mem.mu.Lock()
 	defer mem.mu.Unlock()
 	assert.Equal(t, true, mem.mkdirs["files"])
@@ -178,19 +173,16 @@ func TestCreateFileStream_Success_WritesAndCloses(t *testing.T) {
 
 func TestCreateFileStream_WriteStreamError_Drained_NoDeadlock(t *testing.T) {
 	mem := newMemDAV()
-	oc.SetClient(mem)
-	t.Cleanup(func() { oc.SetClient(nil) })
+	client := oc.New(storage.NewWebDAVFromClient(mem))
 
 	mem.errWStrm["files/bad"] = errors.New("boom")
 
-	w, err := oc.CreateFileStream("files", "bad")
+	w, err := client.CreateFileStream(context.Background(), "files", "bad")
 	require.NoError(t, err)
 
 	_, err = w.Write([]byte("SOME DATA"))
 	require.NoError(t, err)
-	require.NoError(t, w.Close())
-
-	time.Sleep(20 * time.Millisecond)
+	require.ErrorContains(t, w.Close(), "boom", "Close reports the backend's failure")
 
 	mem.mu.Lock()
 	defer mem.mu.Unlock()
@@ -200,21 +192,20 @@ func TestCreateFileStream_WriteStreamError_Drained_NoDeadlock(t *testing.T) {
 
 func TestDownloadFileStream_And_Temp(t *testing.T) {
 	mem := newMemDAV()
-	oc.SetClient(mem)
-	t.Cleanup(func() { oc.SetClient(nil) })
+	client := oc.New(storage.NewWebDAVFromClient(mem))
 
 	mem.mu.Lock()
 	mem.files["files/ID123"] = []byte("MAIN")
 	mem.files["temp/chunk_0"] = []byte("C0")
 	mem.mu.Unlock()
 
-	rc, err := oc.DownloadFileStream("ID123")
+	rc, err := client.DownloadFileStream(context.Background(), "ID123")
 	require.NoError(t, err)
 	b, _ := io.ReadAll(rc)
 	_ = rc.Close()
 	assert.Equal(t, "MAIN", string(b))
 
-	rc2, err := oc.DownloadFileStreamTemp("/temp/chunk_0")
+	rc2, err := client.DownloadFileStreamTemp(context.Background(), "/temp/chunk_0")
 	require.NoError(t, err)
 	b2, _ := io.ReadAll(rc2)
 	_ = rc2.Close()
@@ -223,14 +214,13 @@ func TestDownloadFileStream_And_Temp(t *testing.T) {
 
 func TestDeleteFile_Success_And_Error(t *testing.T) {
 	mem := newMemDAV()
-	oc.SetClient(mem)
-	t.Cleanup(func() { oc.SetClient(nil) })
+	client := oc.New(storage.NewWebDAVFromClient(mem))
 
 	mem.mu.Lock()
 	mem.files["files/uX/fY"] = []byte("DATA")
 	mem.mu.Unlock()
 
-	require.NoError(t, oc.DeleteFile("fY", "uX"))
+	require.NoError(t, client.DeleteFile(context.Background(), "fY", "uX"))
 
 	mem.mu.Lock()
 	_, ok := mem.files["files/uX/fY"]
@@ -240,21 +230,20 @@ func TestDeleteFile_Success_And_Error(t *testing.T) {
 	assert.Equal(t, "files/uX/fY", last)
 
 	mem.errRem["files/uZ/fA"] = errors.New("remove failed")
-	err := oc.DeleteFile("fA", "uZ")
+	err := client.DeleteFile(context.Background(), "fA", "uZ")
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to delete the file")
 }
 
 func TestDeleteFileTemp_Success_TrimsLeadingSlash(t *testing.T) {
 	mem := newMemDAV()
-	oc.SetClient(mem)
-	t.Cleanup(func() { oc.SetClient(nil) })
+	client := oc.New(storage.NewWebDAVFromClient(mem))
 
 	mem.mu.Lock()
 	mem.files["temp/x"] = []byte("TMP")
 	mem.mu.Unlock()
 
-	require.NoError(t, oc.DeleteFileTemp("/temp/x"))
+	require.NoError(t, client.DeleteFileTemp(context.Background(), "/temp/x"))
 
 	mem.mu.Lock()
 	_, ok := mem.files["temp/x"]
@@ -267,21 +256,20 @@ func TestDeleteFileTemp_Success_TrimsLeadingSlash(t *testing.T) {
 
 func TestDownloadSentFileStream_Success_And_Error(t *testing.T) {
 	mem := newMemDAV()
-	oc.SetClient(mem)
-	t.Cleanup(func() { oc.SetClient(nil) })
+	client := oc.New(storage.NewWebDAVFromClient(mem))
 
 	mem.mu.Lock()
 	mem.files["files/U/sent/F"] = []byte("PAY")
 	mem.mu.Unlock()
 
-	rc, err := oc.DownloadSentFileStream("files/U/sent/F")
+	rc, err := client.DownloadSentFileStream(context.Background(), "files/U/sent/F")
 	require.NoError(t, err)
 	p, _ := io.ReadAll(rc)
 	_ = rc.Close()
 	assert.Equal(t, "PAY", string(p))
 
 	mem.errRStrm["files/U/sent/bad"] = errors.New("nope")
-	_, err = oc.DownloadSentFileStream("files/U/sent/bad")
+	_, err = client.DownloadSentFileStream(context.Background(), "files/U/sent/bad")
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to download file")
 }
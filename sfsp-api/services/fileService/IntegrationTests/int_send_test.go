@@ -6,53 +6,35 @@ package integration_test
 import (
 	"bytes"
 	"database/sql"
+	"encoding/json"
 	"fmt"
-	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
-	"strings"
 	"testing"
 	"time"
 
-	monkey "bou.ke/monkey"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	fh "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metadata"
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
 )
 
-func patchOwncloud(t *testing.T, s *memStore, opts ...func(path, name string) error) {
+// openSendDB migrates a database holding fileID, owned by sender, and
+// registers each of users. Names are turned into UUIDs with id.
+func openSendDB(t *testing.T, fileID, sender string, users ...string) *sql.DB {
 	t.Helper()
-
-	var uploadHook func(path, name string) error
-	if len(opts) > 0 {
-		uploadHook = opts[0]
+	pg := startPostgres(t)
+	db := openDB(t, pg.DSN)
+	t.Cleanup(func() { _ = db.Close() })
+	migrateDB(t, db)
+	_, err := db.Exec(`INSERT INTO files (id, owner_id, file_name) VALUES ($1, $2, 'doc')`, id(fileID), id(sender))
+	require.NoError(t, err)
+	for _, u := range users {
+		_, err = db.Exec(`INSERT INTO users (id) VALUES ($1)`, id(u))
+		require.NoError(t, err)
 	}
-
-	monkey.Patch(owncloud.UploadFileStream, func(path, name string, r io.Reader) error {
-		if uploadHook != nil {
-			if err := uploadHook(path, name); err != nil {
-				return err
-			}
-		}
-		key := strings.TrimSuffix(path, "/") + "/" + name
-		data, _ := io.ReadAll(r)
-		s.put(key, data)
-		return nil
-	})
-	monkey.Patch(owncloud.DownloadFileStreamTemp, func(chunkPath string) (io.ReadCloser, error) {
-		if b, ok := s.get(chunkPath); ok {
-			return io.NopCloser(bytes.NewReader(b)), nil
-		}
-		return nil, fmt.Errorf("temp chunk not found: %s", chunkPath)
-	})
-	monkey.Patch(owncloud.DeleteFileTemp, func(chunkPath string) error {
-		s.del(chunkPath)
-		return nil
-	})
+	return db
 }
 
 func makeMultipart(t *testing.T, fields map[string]string, fileField, fileName string, fileBytes []byte) (*bytes.Buffer, string) {
@@ -72,21 +54,18 @@ func makeMultipart(t *testing.T, fields map[string]string, fileField, fileName s
 }
 
 func TestSendFileHandler_InvalidContentType(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 	req := httptest.NewRequest(http.MethodPost, "/send", bytes.NewBufferString(`{"x":1}`))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Invalid multipart form")
 }
 
 func TestSendFileHandler_MissingFields(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-	s := &memStore{m: map[string][]byte{}}
-	patchOwncloud(t, s)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 
 	body, ctype := makeMultipart(t, map[string]string{
 		"userId": "u1",
@@ -95,15 +74,13 @@ func TestSendFileHandler_MissingFields(t *testing.T) {
 	req.Header.Set("Content-Type", ctype)
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Missing required form fields")
 }
 
 func TestSendFileHandler_InvalidIndicesOrMissingFile(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-	s := &memStore{m: map[string][]byte{}}
-	patchOwncloud(t, s)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 
 	body, ctype := makeMultipart(t, map[string]string{
 		"fileid":          "f1",
@@ -116,7 +93,7 @@ func TestSendFileHandler_InvalidIndicesOrMissingFile(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/send", body)
 	req.Header.Set("Content-Type", ctype)
 	rr := httptest.NewRecorder()
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Invalid chunkIndex")
 
@@ -131,23 +108,13 @@ func TestSendFileHandler_InvalidIndicesOrMissingFile(t *testing.T) {
 	req2 := httptest.NewRequest(http.MethodPost, "/send", body2)
 	req2.Header.Set("Content-Type", ctype2)
 	rr2 := httptest.NewRecorder()
-	fh.SendFileHandler(rr2, req2)
+	srv.SendFileHandler(rr2, req2)
 	assert.Equal(t, http.StatusBadRequest, rr2.Code)
 	assert.Contains(t, rr2.Body.String(), "Missing encrypted file chunk")
 }
 
 func TestSendFileHandler_TempUploadFail(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-	s := &memStore{m: map[string][]byte{}}
-	patchOwncloud(t, s, func(path, name string) error {
-		if path == "temp" {
-			return fmt.Errorf("simulated temp upload error")
-		}
-		return nil
-	})
-	monkey.Patch(metadata.InsertReceivedFile, func(db *sql.DB, recipientID, senderID, fileID, metadataJSON string, expiresAt time.Time) (string, error) {
-		return "", fmt.Errorf("should not be called")
-	})
+	srv := fh.New(nil, brokenStore{memStore: newMemStore(), prefix: "temp/", err: fmt.Errorf("simulated temp upload error")}, fh.Config{})
 
 	body, ctype := makeMultipart(t, map[string]string{
 		"fileid":          "f1",
@@ -160,19 +127,15 @@ func TestSendFileHandler_TempUploadFail(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/send", body)
 	req.Header.Set("Content-Type", ctype)
 	rr := httptest.NewRecorder()
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Chunk upload failed")
 }
 
 func TestSendFileHandler_AckIntermediateChunk(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-	s := &memStore{m: map[string][]byte{}}
-	patchOwncloud(t, s)
-	monkey.Patch(metadata.InsertReceivedFile, func(db *sql.DB, recipientID, senderID, fileID, metadataJSON string, expiresAt time.Time) (string, error) {
-		return "", nil
-	})
+	s := newMemStore()
+	srv := fh.New(nil, s, fh.Config{})
 
 	fields := map[string]string{
 		"fileid":          "f1",
@@ -187,7 +150,7 @@ func TestSendFileHandler_AckIntermediateChunk(t *testing.T) {
 	req.Header.Set("Content-Type", ctype)
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Contains(t, rr.Body.String(), `"Chunk 0 uploaded"`)
 	got, ok := s.get("temp/f1_chunk_0")
@@ -196,29 +159,17 @@ func TestSendFileHandler_AckIntermediateChunk(t *testing.T) {
 }
 
 func TestSendFileHandler_FinalMerge_Success_AndDBTracking(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-	s := &memStore{m: map[string][]byte{}}
-	patchOwncloud(t, s)
-
-	s.put("temp/F2_chunk_0", []byte("HELLO "))
-
-	var gotRecip, gotSender, gotFile, gotMeta string
-	var gotExpire time.Time
-	monkey.Patch(metadata.InsertReceivedFile, func(db *sql.DB, recipientID, senderID, fileID, metadataJSON string, expiresAt time.Time) (string, error) {
-		gotRecip, gotSender, gotFile, gotMeta, gotExpire = recipientID, senderID, fileID, metadataJSON, expiresAt
-		return "rf-123", nil
-	})
-	var sentCalled bool
-	monkey.Patch(metadata.InsertSentFile, func(db *sql.DB, senderID, recipientID, fileID, metadataJSON string) error {
-		sentCalled = true
-		return nil
-	})
+	db := openSendDB(t, "F2", "SENDER", "RECIP")
+	s := newMemStore()
+	srv := fh.New(db, s, fh.Config{})
+
+	s.put("temp/"+id("F2")+"_chunk_0", []byte("HELLO "))
 
 	fields := map[string]string{
-		"fileid":          "F2",
-		"userId":          "SENDER",
-		"recipientUserId": "RECIP",
-		"metadata":        `{"k":"v"}`,
+		"fileid":          id("F2"),
+		"userId":          id("SENDER"),
+		"recipientUserId": id("RECIP"),
+		"metadata":        `{"encryptedAesKey":"EKEY","ekPublicKey":"PUB"}`,
 		"chunkIndex":      "1",
 		"totalChunks":     "2",
 	}
@@ -227,39 +178,38 @@ func TestSendFileHandler_FinalMerge_Success_AndDBTracking(t *testing.T) {
 	req.Header.Set("Content-Type", ctype)
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Contains(t, rr.Body.String(), `"message":"File sent successfully"`)
-	assert.Contains(t, rr.Body.String(), `"receivedFileID":"rf-123"`)
+	var resp map[string]string
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	require.NotEmpty(t, resp["receivedFileID"])
 
-	finalKey := "files/SENDER/sent/F2"
+	finalKey := "files/" + id("SENDER") + "/sent/" + id("F2")
 	got, ok := s.get(finalKey)
 	require.True(t, ok)
 	assert.Equal(t, []byte("HELLO WORLD"), got)
 
-	assert.Equal(t, "RECIP", gotRecip)
-	assert.Equal(t, "SENDER", gotSender)
-	assert.Equal(t, "F2", gotFile)
-	assert.Equal(t, `{"k":"v"}`, gotMeta)
-	assert.WithinDuration(t, time.Now().Add(48*time.Hour), gotExpire, time.Hour)
-
-	assert.True(t, sentCalled)
+	var recip, sender, fileID, meta string
+	var expires time.Time
+	require.NoError(t, db.QueryRow(`SELECT recipient_id, sender_id, file_id, metadata, expires_at FROM received_files WHERE id = $1`, resp["receivedFileID"]).
+		Scan(&recip, &sender, &fileID, &meta, &expires))
+	assert.Equal(t, id("RECIP"), recip)
+	assert.Equal(t, id("SENDER"), sender)
+	assert.Equal(t, id("F2"), fileID)
+	assert.JSONEq(t, `{"encryptedAesKey":"EKEY","ekPublicKey":"PUB"}`, meta)
+	assert.WithinDuration(t, time.Now().Add(48*time.Hour), expires, time.Hour)
+
+	var key string
+	require.NoError(t, db.QueryRow(`SELECT encrypted_file_key FROM sent_files WHERE sender_id = md5('SENDER')::uuid AND file_id = md5('F2')::uuid`).Scan(&key))
+	assert.Equal(t, "EKEY", key)
 }
 
 func TestSendFileHandler_FinalUploadFail(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-	s := &memStore{m: map[string][]byte{}}
-	patchOwncloud(t, s)
-
+	s := newMemStore()
 	s.put("temp/F3_chunk_0", []byte("A"))
-	monkey.Patch(owncloud.UploadFileStream, func(path, name string, r io.Reader) error {
-		_, _ = io.Copy(io.Discard, r)
-		if strings.HasPrefix(path, "files/") && strings.HasSuffix(path, "/sent") {
-			return fmt.Errorf("simulated final upload error")
-		}
-		return nil
-	})
+	srv := fh.New(nil, brokenStore{memStore: s, prefix: "files/", err: fmt.Errorf("simulated final upload error")}, fh.Config{})
 
 	body, ctype := makeMultipart(t, map[string]string{
 		"fileid":          "F3",
@@ -274,28 +224,24 @@ func TestSendFileHandler_FinalUploadFail(t *testing.T) {
 	req.Header.Set("Content-Type", ctype)
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Failed to store encrypted file")
 }
 
 func TestSendFileHandler_InsertReceivedFileFails(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-	s := &memStore{m: map[string][]byte{}}
-	patchOwncloud(t, s)
+	// R is not a registered user, so the received file cannot be tracked
+	db := openSendDB(t, "F4", "S")
+	s := newMemStore()
+	srv := fh.New(db, s, fh.Config{})
 	// Pre-store chunk 0
-	s.put("temp/F4_chunk_0", []byte("A"))
-
-	monkey.Patch(metadata.InsertReceivedFile, func(db *sql.DB, recipientID, senderID, fileID, metadataJSON string, expiresAt time.Time) (string, error) {
-		return "", fmt.Errorf("db error on received")
-	})
-	// InsertSentFile shouldn't matter; handler 500s before using it.
+	s.put("temp/"+id("F4")+"_chunk_0", []byte("A"))
 
 	body, ctype := makeMultipart(t, map[string]string{
-		"fileid":          "F4",
-		"userId":          "S",
-		"recipientUserId": "R",
+		"fileid":          id("F4"),
+		"userId":          id("S"),
+		"recipientUserId": id("R"),
 		"metadata":        `{}`,
 		"chunkIndex":      "1",
 		"totalChunks":     "2",
@@ -304,29 +250,22 @@ func TestSendFileHandler_InsertReceivedFileFails(t *testing.T) {
 	req.Header.Set("Content-Type", ctype)
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Failed to track received file")
 }
 
 func TestSendFileHandler_InsertSentFileFails_ButResponseStillOK(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-	s := &memStore{m: map[string][]byte{}}
-	patchOwncloud(t, s)
+	db := openSendDB(t, "F5", "S", "R")
+	s := newMemStore()
+	srv := fh.New(db, s, fh.Config{})
 	// Pre-store chunk 0
-	s.put("temp/F5_chunk_0", []byte("LEFT-"))
-
-	monkey.Patch(metadata.InsertReceivedFile, func(db *sql.DB, recipientID, senderID, fileID, metadataJSON string, expiresAt time.Time) (string, error) {
-		return "rf-999", nil
-	})
-	monkey.Patch(metadata.InsertSentFile, func(db *sql.DB, senderID, recipientID, fileID, metadataJSON string) error {
-		return fmt.Errorf("sent insert failed (non-fatal)")
-	})
+	s.put("temp/"+id("F5")+"_chunk_0", []byte("LEFT-"))
 
 	body, ctype := makeMultipart(t, map[string]string{
-		"fileid":          "F5",
-		"userId":          "S",
-		"recipientUserId": "R",
+		"fileid":          id("F5"),
+		"userId":          id("S"),
+		"recipientUserId": id("R"),
 		"metadata":        `{}`,
 		"chunkIndex":      "1",
 		"totalChunks":     "2",
@@ -335,12 +274,17 @@ func TestSendFileHandler_InsertSentFileFails_ButResponseStillOK(t *testing.T) {
 	req.Header.Set("Content-Type", ctype)
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 	assert.Equal(t, http.StatusOK, rr.Code)
-	assert.Contains(t, rr.Body.String(), `"receivedFileID":"rf-999"`)
+	assert.Contains(t, rr.Body.String(), `"receivedFileID":"`)
+
+	// the metadata carries no key material, so the sent_files row is skipped
+	var n int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM sent_files WHERE file_id = md5('F5')::uuid`).Scan(&n))
+	assert.Equal(t, 0, n)
 
 	// Final content present
-	got, ok := s.get("files/S/sent/F5")
+	got, ok := s.get("files/" + id("S") + "/sent/" + id("F5"))
 	require.True(t, ok)
 	assert.Equal(t, []byte("LEFT-RIGHT"), got)
 }
@@ -0,0 +1,117 @@
+//go:build integration
+// +build integration
+
+package integration_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+)
+
+func TestPostgresStore_RoundTrip(t *testing.T) {
+	pg := startPostgres(t)
+	if pg.Container != nil {
+		t.Cleanup(func() { _ = pg.Container.Terminate(context.Background()) })
+	}
+	db := openDB(t, pg.DSN)
+	t.Cleanup(func() { _ = db.Close() })
+	migrateDB(t, db)
+	ctx := context.Background()
+	st := store.NewPostgres(db)
+	alice, bob := id("alice"), id("bob")
+
+	fileID, err := st.AddFile(ctx, store.File{OwnerID: alice, FileName: "doc.pdf", Tags: []string{"work"}, FileSize: 42})
+	require.NoError(t, err)
+	f, err := st.File(ctx, fileID)
+	require.NoError(t, err)
+	assert.Equal(t, "file", f.FileType)
+	assert.Equal(t, []string{"work"}, f.Tags)
+	assert.Nil(t, f.DeletedAt)
+	owner, err := st.FileOwner(ctx, fileID)
+	require.NoError(t, err)
+	assert.Equal(t, alice, owner)
+	_, err = st.FileOwner(ctx, id("missing"))
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	receivedID, err := st.AddReceivedFile(ctx, store.ReceivedFile{RecipientID: bob, SenderID: alice, FileID: fileID, Metadata: "key"})
+	require.NoError(t, err)
+	received, err := st.ReceivedFile(ctx, receivedID)
+	require.NoError(t, err)
+	assert.Equal(t, "key", received.Metadata)
+	assert.Nil(t, received.ExpiresAt)
+	_, err = st.AddSentFile(ctx, store.SentFile{SenderID: alice, RecipientID: bob, FileID: fileID})
+	require.NoError(t, err)
+	sentListing := api.Listing{Sorts: map[string]string{"sentAt": "sent_at"}, ID: "id", DefaultSort: "sentAt", DefaultOrder: "desc"}
+	page, err := sentListing.Page(httptest.NewRequest(http.MethodGet, "/", nil), api.PageRequest{})
+	require.NoError(t, err)
+	sent, err := st.ListSentFiles(ctx, alice, page)
+	require.NoError(t, err)
+	require.Len(t, sent, 1)
+	assert.Empty(t, sent[0].EncryptedFileKey)
+	pendingListing := api.Listing{Sorts: map[string]string{"receivedAt": "received_at"}, ID: "id", DefaultSort: "receivedAt", DefaultOrder: "desc"}
+	page, err = pendingListing.Page(httptest.NewRequest(http.MethodGet, "/", nil), api.PageRequest{})
+	require.NoError(t, err)
+	pending, err := st.ListReceivedFiles(ctx, store.ReceivedFileFilter{RecipientID: bob, Pending: true}, page)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, receivedID, pending[0].ID)
+
+	_, err = st.AddViewShare(ctx, store.ViewShare{SenderID: alice, RecipientID: bob, FileID: fileID, Metadata: "view", AccessGranted: true})
+	require.NoError(t, err)
+	share, err := st.ViewShare(ctx, alice, bob, fileID)
+	require.NoError(t, err)
+	assert.Equal(t, "view", share.Metadata)
+	assert.Empty(t, share.NewFileID)
+	users, err := st.ViewShareRecipients(ctx, fileID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{bob}, users)
+
+	notificationID, err := st.AddNotification(ctx, store.Notification{Type: "share_request", From: alice, To: bob,
+		FileName: "doc.pdf", FileID: fileID, ReceivedFileID: receivedID})
+	require.NoError(t, err)
+	require.NoError(t, st.SetNotificationStatus(ctx, notificationID, "accepted"))
+	n, err := st.Notification(ctx, notificationID)
+	require.NoError(t, err)
+	assert.Equal(t, receivedID, n.ReceivedFileID)
+	assert.Equal(t, "accepted", n.Status)
+	assert.True(t, n.Read)
+
+	listing := api.Listing{
+		Sorts:        map[string]string{"timestamp": "timestamp"},
+		ID:           "id",
+		DefaultSort:  "timestamp",
+		DefaultOrder: "desc",
+	}
+	page, err = listing.Page(httptest.NewRequest(http.MethodGet, "/", nil), api.PageRequest{})
+	require.NoError(t, err)
+	listed, err := st.ListNotifications(ctx, bob, page)
+	require.NoError(t, err)
+	assert.Len(t, listed, 1)
+	require.NoError(t, st.DeleteNotification(ctx, notificationID))
+	assert.ErrorIs(t, st.MarkNotificationRead(ctx, notificationID), store.ErrNotFound)
+
+	require.NoError(t, st.AddAccessLog(ctx, store.AccessLog{FileID: fileID, UserID: bob, Action: "view", ViewOnly: true}))
+	page, err = listing.Page(httptest.NewRequest(http.MethodGet, "/", nil), api.PageRequest{})
+	require.NoError(t, err)
+	logs, err := st.ListAccessLogs(ctx, store.AccessLogFilter{FileID: fileID, OwnerID: alice}, page)
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.True(t, logs[0].ViewOnly)
+
+	require.NoError(t, st.TrashFile(ctx, fileID))
+	_, err = st.FileOwner(ctx, fileID)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	trashed, err := st.FileTrashed(ctx, fileID)
+	require.NoError(t, err)
+	assert.True(t, trashed)
+	require.NoError(t, st.RestoreFile(ctx, alice, fileID))
+	assert.ErrorIs(t, st.RestoreFile(ctx, alice, fileID), store.ErrNotFound)
+}
@@ -11,19 +11,15 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
-	"strings"
 	"testing"
 
-	monkey "bou.ke/monkey"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	fh "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
 
 	_ "github.com/lib/pq"
 )
@@ -38,86 +34,6 @@ func openDBUpload(t *testing.T, dsn string) *sql.DB {
 	return db
 }
 
-// Includes file_hash and nonce, which Upload/StartUpload rely on.
-func seedFilesSchemaUpload(t *testing.T, db *sql.DB) {
-	t.Helper()
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS files (
-			id          TEXT PRIMARY KEY DEFAULT md5(random()::text),
-			owner_id    TEXT NOT NULL,
-			file_name   TEXT NOT NULL,
-			file_type   TEXT DEFAULT 'file',
-			file_hash   TEXT DEFAULT '',
-			nonce       TEXT DEFAULT '',
-			description TEXT DEFAULT '',
-			tags        TEXT[] DEFAULT '{}',
-			cid         TEXT DEFAULT '',
-			file_size   BIGINT DEFAULT 0,
-			created_at  TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
-		);
-	`)
-	require.NoError(t, err)
-}
-
-type memWCUpload struct {
-	key   string
-	store *memStore
-	buf   bytes.Buffer
-}
-
-func (w *memWCUpload) Write(p []byte) (int, error) { return w.buf.Write(p) }
-func (w *memWCUpload) Close() error {
-	w.store.put(w.key, w.buf.Bytes())
-	return nil
-}
-
-type ocHooksUpload struct {
-	uploadHook   func(path, name string, r io.Reader) error
-	createHook   func(path, name string) (io.WriteCloser, error)
-	downloadHook func(path string) (io.ReadCloser, error)
-}
-
-func patchOwncloudUpload(t *testing.T, s *memStore, hooks *ocHooksUpload) {
-	t.Helper()
-
-	monkey.Patch(owncloud.UploadFileStream, func(path, name string, r io.Reader) error {
-		if hooks != nil && hooks.uploadHook != nil {
-			if err := hooks.uploadHook(path, name, r); err != nil {
-				return err
-			}
-		}
-		data, _ := io.ReadAll(r)
-		key := strings.TrimSuffix(path, "/") + "/" + name
-		s.put(key, data)
-		return nil
-	})
-
-	monkey.Patch(owncloud.DownloadFileStreamTemp, func(chunkPath string) (io.ReadCloser, error) {
-		if hooks != nil && hooks.downloadHook != nil {
-			if rc, err := hooks.downloadHook(chunkPath); err != nil || rc != nil {
-				return rc, err
-			}
-		}
-		if b, ok := s.get(chunkPath); ok {
-			return io.NopCloser(bytes.NewReader(b)), nil
-		}
-		return nil, fmt.Errorf("temp chunk not found: %s", chunkPath)
-	})
-
-	monkey.Patch(owncloud.DeleteFileTemp, func(chunkPath string) error {
-		s.del(chunkPath)
-		return nil
-	})
-
-	monkey.Patch(owncloud.CreateFileStream, func(path, name string) (io.WriteCloser, error) {
-		if hooks != nil && hooks.createHook != nil {
-			return hooks.createHook(path, name)
-		}
-		key := strings.TrimSuffix(path, "/") + "/" + name
-		return &memWCUpload{key: key, store: s}, nil
-	})
-}
-
 func makeMultipartUpload(t *testing.T, fields map[string]string, fileField, fileName string, fileBytes []byte) (*bytes.Buffer, string) {
 	t.Helper()
 	var buf bytes.Buffer
@@ -135,19 +51,17 @@ func makeMultipartUpload(t *testing.T, fields map[string]string, fileField, file
 }
 
 func TestUpload_InvalidContentType(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 	req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewBufferString(`{}`))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
-	fh.UploadHandler(rr, req)
+	srv.UploadHandler(rr, req)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestUpload_MissingRequiredFields(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-	s := &memStore{m: map[string][]byte{}}
-	patchOwncloudUpload(t, s, nil)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 
 	body, ctype := makeMultipartUpload(t, map[string]string{
 		"userId":      "u1",
@@ -158,14 +72,12 @@ func TestUpload_MissingRequiredFields(t *testing.T) {
 	req.Header.Set("Content-Type", ctype)
 	rr := httptest.NewRecorder()
 
-	fh.UploadHandler(rr, req)
+	srv.UploadHandler(rr, req)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestUpload_InvalidIndices_AndMissingFile(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-	s := &memStore{m: map[string][]byte{}}
-	patchOwncloudUpload(t, s, nil)
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 
 	body1, ctype1 := makeMultipartUpload(t, map[string]string{
 		"userId":      "u1",
@@ -179,7 +91,7 @@ func TestUpload_InvalidIndices_AndMissingFile(t *testing.T) {
 	req1 := httptest.NewRequest(http.MethodPost, "/upload", body1)
 	req1.Header.Set("Content-Type", ctype1)
 	rr1 := httptest.NewRecorder()
-	fh.UploadHandler(rr1, req1)
+	srv.UploadHandler(rr1, req1)
 	assert.Equal(t, http.StatusBadRequest, rr1.Code)
 
 	body2, ctype2 := makeMultipartUpload(t, map[string]string{
@@ -194,14 +106,12 @@ func TestUpload_InvalidIndices_AndMissingFile(t *testing.T) {
 	req2 := httptest.NewRequest(http.MethodPost, "/upload", body2)
 	req2.Header.Set("Content-Type", ctype2)
 	rr2 := httptest.NewRecorder()
-	fh.UploadHandler(rr2, req2)
+	srv.UploadHandler(rr2, req2)
 	assert.Equal(t, http.StatusBadRequest, rr2.Code)
 }
 
 func TestUpload_FirstChunk_InsertsMetadata_AndACK(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-	s := &memStore{m: map[string][]byte{}}
-	patchOwncloudUpload(t, s, nil)
+	s := newMemStore()
 
 	c, dsn := startPostgresContainer(t)
 	if c != nil {
@@ -209,14 +119,12 @@ func TestUpload_FirstChunk_InsertsMetadata_AndACK(t *testing.T) {
 	}
 	db := openDBUpload(t, dsn)
 	t.Cleanup(func() { _ = db.Close() })
-	seedFilesSchemaUpload(t, db)
+	migrateDB(t, db)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, s, fh.Config{})
 
 	body, ctype := makeMultipartUpload(t, map[string]string{
-		"userId":      "uX",
+		"userId":      id("uX"),
 		"fileName":    "big.bin",
 		"fileType":    "application/octet-stream",
 		"fileHash":    "abc123",
@@ -228,7 +136,7 @@ func TestUpload_FirstChunk_InsertsMetadata_AndACK(t *testing.T) {
 	req.Header.Set("Content-Type", ctype)
 	rr := httptest.NewRecorder()
 
-	fh.UploadHandler(rr, req)
+	srv.UploadHandler(rr, req)
 	assert.Equal(t, http.StatusOK, rr.Code)
 
 	var resp map[string]string
@@ -237,7 +145,7 @@ func TestUpload_FirstChunk_InsertsMetadata_AndACK(t *testing.T) {
 	assert.Contains(t, resp["message"], "Chunk 0 uploaded")
 
 	var count int
-	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM files WHERE id=$1 AND owner_id='uX'`, resp["fileId"]).Scan(&count))
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM files WHERE id=$1 AND owner_id=md5('uX')::uuid`, resp["fileId"]).Scan(&count))
 	assert.Equal(t, 1, count)
 
 	b, ok := s.get("temp/" + resp["fileId"] + "_chunk_0")
@@ -246,10 +154,7 @@ func TestUpload_FirstChunk_InsertsMetadata_AndACK(t *testing.T) {
 }
 
 func TestUpload_SingleChunk_FullMerge_UpdatesDB_AndStoresFinal(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
-	s := &memStore{m: map[string][]byte{}}
-	patchOwncloudUpload(t, s, nil)
+	s := newMemStore()
 
 	c, dsn := startPostgresContainer(t)
 	if c != nil {
@@ -257,15 +162,13 @@ func TestUpload_SingleChunk_FullMerge_UpdatesDB_AndStoresFinal(t *testing.T) {
 	}
 	db := openDBUpload(t, dsn)
 	t.Cleanup(func() { _ = db.Close() })
-	seedFilesSchemaUpload(t, db)
+	migrateDB(t, db)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, s, fh.Config{})
 
 	content := []byte("HELLO WORLD")
 	body, ctype := makeMultipartUpload(t, map[string]string{
-		"userId":      "uZ",
+		"userId":      id("uZ"),
 		"fileName":    "one.bin",
 		"fileType":    "application/octet-stream",
 		"fileHash":    "ignored-by-handler",
@@ -279,7 +182,7 @@ func TestUpload_SingleChunk_FullMerge_UpdatesDB_AndStoresFinal(t *testing.T) {
 	req.Header.Set("Content-Type", ctype)
 	rr := httptest.NewRecorder()
 
-	fh.UploadHandler(rr, req)
+	srv.UploadHandler(rr, req)
 	assert.Equal(t, http.StatusOK, rr.Code)
 
 	var resp map[string]string
@@ -302,14 +205,7 @@ func TestUpload_SingleChunk_FullMerge_UpdatesDB_AndStoresFinal(t *testing.T) {
 }
 
 func TestUpload_CreateFileStreamFail(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
-	s := &memStore{m: map[string][]byte{}}
-	patchOwncloudUpload(t, s, &ocHooksUpload{
-		createHook: func(path, name string) (io.WriteCloser, error) {
-			return nil, fmt.Errorf("create stream failed")
-		},
-	})
+	s := brokenStore{memStore: newMemStore(), prefix: "files", err: fmt.Errorf("create stream failed")}
 
 	c, dsn := startPostgresContainer(t)
 	if c != nil {
@@ -317,14 +213,12 @@ func TestUpload_CreateFileStreamFail(t *testing.T) {
 	}
 	db := openDBUpload(t, dsn)
 	t.Cleanup(func() { _ = db.Close() })
-	seedFilesSchemaUpload(t, db)
+	migrateDB(t, db)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, s, fh.Config{})
 
 	body, ctype := makeMultipartUpload(t, map[string]string{
-		"userId":      "u1",
+		"userId":      id("u1"),
 		"fileName":    "f.bin",
 		"fileType":    "application/octet-stream",
 		"fileHash":    "x",
@@ -336,20 +230,13 @@ func TestUpload_CreateFileStreamFail(t *testing.T) {
 	req.Header.Set("Content-Type", ctype)
 	rr := httptest.NewRecorder()
 
-	fh.UploadHandler(rr, req)
+	srv.UploadHandler(rr, req)
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "File assembly failed")
 }
 
 func TestUpload_MergeFailsOnMissingChunk(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
-	s := &memStore{m: map[string][]byte{}}
-	patchOwncloudUpload(t, s, &ocHooksUpload{
-		downloadHook: func(path string) (io.ReadCloser, error) {
-			return nil, fmt.Errorf("cannot open chunk")
-		},
-	})
+	s := newMemStore()
 
 	c, dsn := startPostgresContainer(t)
 	if c != nil {
@@ -357,35 +244,44 @@ func TestUpload_MergeFailsOnMissingChunk(t *testing.T) {
 	}
 	db := openDBUpload(t, dsn)
 	t.Cleanup(func() { _ = db.Close() })
-	seedFilesSchemaUpload(t, db)
+	migrateDB(t, db)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, s, fh.Config{})
 
-	body, ctype := makeMultipartUpload(t, map[string]string{
-		"userId":      "u1",
+	fields := map[string]string{
+		"userId":      id("u1"),
 		"fileName":    "f.bin",
 		"fileType":    "application/octet-stream",
 		"fileHash":    "x",
 		"nonce":       "n1",
 		"chunkIndex":  "0",
-		"totalChunks": "1",
-	}, "encryptedFile", "c0.bin", []byte("BYTES"))
+		"totalChunks": "2",
+	}
+	body, ctype := makeMultipartUpload(t, fields, "encryptedFile", "c0.bin", []byte("BYTES"))
 	req := httptest.NewRequest(http.MethodPost, "/upload", body)
 	req.Header.Set("Content-Type", ctype)
 	rr := httptest.NewRecorder()
+	srv.UploadHandler(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var resp map[string]string
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	s.del("temp/" + resp["fileId"] + "_chunk_0")
 
-	fh.UploadHandler(rr, req)
+	fields["fileId"] = resp["fileId"]
+	fields["chunkIndex"] = "1"
+	body, ctype = makeMultipartUpload(t, fields, "encryptedFile", "c1.bin", []byte("MORE"))
+	req = httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", ctype)
+	rr = httptest.NewRecorder()
+
+	srv.UploadHandler(rr, req)
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Chunk merge failed")
 }
 
 func TestUpload_DBInsertError_NoSchema(t *testing.T) {
-	t.Cleanup(monkey.UnpatchAll)
-
-	s := &memStore{m: map[string][]byte{}}
-	patchOwncloudUpload(t, s, nil)
+	s := newMemStore()
 
 	c, dsn := startPostgresContainer(t)
 	if c != nil {
@@ -394,9 +290,7 @@ func TestUpload_DBInsertError_NoSchema(t *testing.T) {
 	db := openDBUpload(t, dsn)
 	t.Cleanup(func() { _ = db.Close() })
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, s, fh.Config{})
 
 	body, ctype := makeMultipartUpload(t, map[string]string{
 		"userId":      "u1",
@@ -411,20 +305,22 @@ func TestUpload_DBInsertError_NoSchema(t *testing.T) {
 	req.Header.Set("Content-Type", ctype)
 	rr := httptest.NewRecorder()
 
-	fh.UploadHandler(rr, req)
+	srv.UploadHandler(rr, req)
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Failed to create file metadata")
 }
 
 func TestStartUpload_InvalidJSON(t *testing.T) {
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 	req := httptest.NewRequest(http.MethodPost, "/start", bytes.NewBufferString(`{"x":`))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
-	fh.StartUploadHandler(rr, req)
+	srv.StartUploadHandler(rr, req)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestStartUpload_MissingRequired(t *testing.T) {
+	srv := fh.New(nil, newMemStore(), fh.Config{})
 	body := map[string]any{
 		"userId":   "",
 		"fileName": "",
@@ -433,7 +329,7 @@ func TestStartUpload_MissingRequired(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/start", bytes.NewBuffer(b))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
-	fh.StartUploadHandler(rr, req)
+	srv.StartUploadHandler(rr, req)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
@@ -444,14 +340,12 @@ func TestStartUpload_Success_InsertsRow_ReturnsID(t *testing.T) {
 	}
 	db := openDBUpload(t, dsn)
 	t.Cleanup(func() { _ = db.Close() })
-	seedFilesSchemaUpload(t, db)
+	migrateDB(t, db)
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
 	reqBody := map[string]any{
-		"userId":          "U10",
+		"userId":          id("U10"),
 		"fileName":        "photo.jpg",
 		"fileType":        "image/jpeg",
 		"fileDescription": "desc",
@@ -464,7 +358,7 @@ func TestStartUpload_Success_InsertsRow_ReturnsID(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
-	fh.StartUploadHandler(rr, req)
+	srv.StartUploadHandler(rr, req)
 	assert.Equal(t, http.StatusOK, rr.Code)
 
 	var resp map[string]string
@@ -476,7 +370,7 @@ func TestStartUpload_Success_InsertsRow_ReturnsID(t *testing.T) {
 	var size int64
 	require.NoError(t, db.QueryRow(`SELECT owner_id,file_name,file_type,nonce,cid,file_size FROM files WHERE id=$1`, fileID).
 		Scan(&owner, &name, &ftype, &nonce, &cid, &size))
-	assert.Equal(t, "U10", owner)
+	assert.Equal(t, id("U10"), owner)
 	assert.Equal(t, "photo.jpg", name)
 	assert.Equal(t, "image/jpeg", ftype)
 	assert.Equal(t, "N-10", nonce)
@@ -492,9 +386,7 @@ func TestStartUpload_DBError_NoSchema(t *testing.T) {
 	db := openDBUpload(t, dsn)
 	t.Cleanup(func() { _ = db.Close() })
 
-	prev := fh.DB
-	fh.DB = db
-	t.Cleanup(func() { fh.DB = prev })
+	srv := fh.New(db, newMemStore(), fh.Config{})
 
 	reqBody := map[string]any{
 		"userId":   "U",
@@ -505,7 +397,7 @@ func TestStartUpload_DBError_NoSchema(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
-	fh.StartUploadHandler(rr, req)
+	srv.StartUploadHandler(rr, req)
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Failed to start upload")
 }
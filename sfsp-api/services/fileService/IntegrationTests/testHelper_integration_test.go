@@ -6,7 +6,9 @@ package integration_test
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -14,18 +16,18 @@ import (
 	"net/http/httptest"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 	"encoding/json"
 
 	nat "github.com/docker/go-connections/nat"
-	monkey "bou.ke/monkey"
 	"github.com/stretchr/testify/require"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/migrations"
 	tc "github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
 
-	oc "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
-
 	_ "github.com/lib/pq"
 )
 
@@ -145,62 +147,104 @@ func openDB(t *testing.T, dsn string) *sql.DB {
 	return db
 }
 
-func seedBasicFileSchema(t *testing.T, db *sql.DB) {
+// migrateDB gives db the service's real schema by applying the embedded
+// migrations.
+func migrateDB(t *testing.T, db *sql.DB) {
 	t.Helper()
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS files (
-			id        TEXT PRIMARY KEY,
-			owner_id  TEXT NOT NULL,
-			file_name TEXT NOT NULL,
-			nonce     TEXT NOT NULL,
-			file_hash TEXT NOT NULL,
-			cid       TEXT
-		);
-	`)
+	_, err := migrations.Up(context.Background(), db)
 	require.NoError(t, err)
 }
 
+// id turns a readable test name into a stable UUID, the same one Postgres
+// computes for md5('name')::uuid.
+func id(name string) string {
+	sum := md5.Sum([]byte(name))
+	h := hex.EncodeToString(sum[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
 /* ------------------------------ Storage ------------------------------- */
 
-type memStore struct{ m map[string][]byte }
+// memStore is an in-memory storage.Backend, so the handlers under test read
+// and write blobs without an OwnCloud server.
+type memStore struct {
+	mu sync.Mutex
+	m  map[string][]byte
+}
+
+func newMemStore() *memStore { return &memStore{m: map[string][]byte{}} }
 
-func (s *memStore) put(key string, data []byte) { s.m[key] = append([]byte(nil), data...) }
+func (s *memStore) put(key string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[key] = append([]byte(nil), data...)
+}
 func (s *memStore) get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	b, ok := s.m[key]
 	if !ok {
 		return nil, false
 	}
 	return append([]byte(nil), b...), true
 }
-func (s *memStore) del(key string) { delete(s.m, key) }
+func (s *memStore) del(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, key)
+}
 
-/* ----------------------- OwnCloud monkey patches ---------------------- */
+func (s *memStore) MkdirAll(string) error { return nil }
+func (s *memStore) WriteStream(path string, src io.Reader) error {
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	s.put(path, data)
+	return nil
+}
+func (s *memStore) ReadStream(path string) (io.ReadCloser, error) {
+	if data, ok := s.get(path); ok {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return nil, fmt.Errorf("blob not found: %s", path)
+}
+func (s *memStore) Remove(path string) error {
+	s.del(path)
+	return nil
+}
 
-func PatchOwncloudForView(t *testing.T, s *memStore) {
-	t.Helper()
-	monkey.Patch(oc.UploadFileStream, func(path, name string, r io.Reader) error {
-		data, _ := io.ReadAll(r)
-		key := strings.TrimSuffix(path, "/") + "/" + name
-		s.put(key, data)
-		return nil
-	})
-	monkey.Patch(oc.DownloadFileStreamTemp, func(chunkPath string) (io.ReadCloser, error) {
-		if data, ok := s.get(chunkPath); ok {
-			return io.NopCloser(bytes.NewReader(data)), nil
-		}
-		return nil, fmt.Errorf("temp chunk not found: %s", chunkPath)
-	})
-	monkey.Patch(oc.DeleteFileTemp, func(chunkPath string) error {
-		s.del(chunkPath)
-		return nil
-	})
-	monkey.Patch(oc.DownloadSentFileStream, func(path string) (io.ReadCloser, error) {
-		if data, ok := s.get(path); ok {
-			return io.NopCloser(bytes.NewReader(data)), nil
-		}
-		// Still return a body so handlers can stream a small placeholder
-		return io.NopCloser(bytes.NewReader([]byte("missing"))), nil
-	})
+// brokenStore is a memStore whose operations on paths under prefix fail
+// with err.
+type brokenStore struct {
+	*memStore
+	prefix string
+	err    error
+}
+
+func (s brokenStore) MkdirAll(path string) error {
+	if strings.HasPrefix(path, s.prefix) {
+		return s.err
+	}
+	return s.memStore.MkdirAll(path)
+}
+func (s brokenStore) WriteStream(path string, src io.Reader) error {
+	if strings.HasPrefix(path, s.prefix) {
+		return s.err
+	}
+	return s.memStore.WriteStream(path, src)
+}
+func (s brokenStore) ReadStream(path string) (io.ReadCloser, error) {
+	if strings.HasPrefix(path, s.prefix) {
+		return nil, s.err
+	}
+	return s.memStore.ReadStream(path)
+}
+func (s brokenStore) Remove(path string) error {
+	if strings.HasPrefix(path, s.prefix) {
+		return s.err
+	}
+	return s.memStore.Remove(path)
 }
 
 /* -------------------------- HTTP test helpers ------------------------- */
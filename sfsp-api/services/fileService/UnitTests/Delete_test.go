@@ -6,34 +6,42 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metadata"
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/storage"
 )
 
-var (
-	originalDeleteFromOwnCloud = owncloud.DeleteFile
-	originalDeleteFromMetadata = metadata.DeleteFileMetadata
-)
-
-func restoreOriginals() {
-	owncloud.DeleteFile = originalDeleteFromOwnCloud
-	metadata.DeleteFileMetadata = originalDeleteFromMetadata
+// failRemove is a backend whose deletes fail.
+type failRemove struct{ storage.Backend }
+
+func (failRemove) Remove(string) error { return errors.New("failed to delete from owncloud") }
+
+// expectDeleteFileMetadata expects the transaction that deletes the rows
+// of fileID.
+func expectDeleteFileMetadata(mock sqlmock.Sqlmock, fileID string) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM received_files WHERE file_id = \$1`).WithArgs(fileID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM sent_files WHERE file_id = \$1`).WithArgs(fileID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM files WHERE id = \$1`).WithArgs(fileID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
 }
 
 func TestDeleteFileHandler_Success(t *testing.T) {
-	defer restoreOriginals()
+	srv, mock, b := useLocalBackend(t)
+	require.NoError(t, b.WriteStream("files/abc123", strings.NewReader("ciphertext")))
 
-	owncloud.DeleteFile = func(fileID, userID string) error {
-		return nil
-	}
-	metadata.DeleteFileMetadata = func(fileID string) error {
-		return nil
-	}
+	mock.ExpectExec(`UPDATE files SET deleted_at = NOW\(\) WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs("abc123").
+		WillReturnResult(sqlmock.NewResult(0, 1))
 
 	reqBody := map[string]string{
 		"fileId": "abc123",
@@ -43,80 +51,121 @@ func TestDeleteFileHandler_Success(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/delete", bytes.NewReader(bodyBytes))
 	w := httptest.NewRecorder()
 
-	fileHandler.DeleteFileHandler(w, req)
+	srv.DeleteFileHandler(w, req)
 
 	resp := w.Result()
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, w.Body.String(), "File moved to trash")
+	assert.Equal(t, "ciphertext", readBlob(t, b, "files/abc123"), "a soft delete must not touch storage")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteFileHandler_Permanent(t *testing.T) {
+	srv, mock, b := useLocalBackend(t)
+	require.NoError(t, b.WriteStream("files/abc123", strings.NewReader("ciphertext")))
+	expectDeleteFileMetadata(mock, "abc123")
+
+	body := `{"fileId":"abc123", "userId":"user789", "permanent":true}`
+	req := httptest.NewRequest(http.MethodPost, "/delete", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	srv.DeleteFileHandler(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Contains(t, w.Body.String(), "File successfully deleted")
+	_, err := b.ReadStream("files/abc123")
+	assert.Error(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteFileHandler_TrashError(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectExec(`UPDATE files SET deleted_at = NOW\(\)`).
+		WithArgs("file123").
+		WillReturnError(errors.New("update failed"))
+
+	body := `{"fileId":"file123", "userId":"user456"}`
+	req := httptest.NewRequest(http.MethodPost, "/delete", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	srv.DeleteFileHandler(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "File delete failed")
 }
 
 func TestDeleteFileHandler_InvalidJSON(t *testing.T) {
+	srv, _, cleanup := SetupMockDB(t)
+	defer cleanup()
+
 	req := httptest.NewRequest(http.MethodPost, "/delete", bytes.NewBufferString("invalid-json"))
 	w := httptest.NewRecorder()
 
-	fileHandler.DeleteFileHandler(w, req)
+	srv.DeleteFileHandler(w, req)
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 	assert.Contains(t, w.Body.String(), "Invalid JSON payload")
 }
 
 func TestDeleteFileHandler_MissingFileId(t *testing.T) {
+	srv, _, cleanup := SetupMockDB(t)
+	defer cleanup()
+
 	body := `{"userId":"user123"}`
 	req := httptest.NewRequest(http.MethodPost, "/delete", bytes.NewBufferString(body))
 	w := httptest.NewRecorder()
 
-	fileHandler.DeleteFileHandler(w, req)
+	srv.DeleteFileHandler(w, req)
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 	assert.Contains(t, w.Body.String(), "Missing fileId")
 }
 
 func TestDeleteFileHandler_MissingUserId(t *testing.T) {
+	srv, _, cleanup := SetupMockDB(t)
+	defer cleanup()
+
 	body := `{"fileId":"file123"}`
 	req := httptest.NewRequest(http.MethodPost, "/delete", bytes.NewBufferString(body))
 	w := httptest.NewRecorder()
 
-	fileHandler.DeleteFileHandler(w, req)
+	srv.DeleteFileHandler(w, req)
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 	assert.Contains(t, w.Body.String(), "Missing UserID")
 }
 
 func TestDeleteFileHandler_OwnCloudError(t *testing.T) {
-	defer restoreOriginals()
-
-	owncloud.DeleteFile = func(fileID, userID string) error {
-		return errors.New("failed to delete from owncloud")
-	}
-	metadata.DeleteFileMetadata = func(fileID string) error {
-		return nil
-	}
+	b, _ := newLocalBackend(t)
+	// no expectations: metadata must be kept when the blob could not be deleted
+	srv, mock := newServer(t, failRemove{b}, fileHandler.Config{})
 
-	body := `{"fileId":"file123", "userId":"user456"}`
+	body := `{"fileId":"file123", "userId":"user456", "permanent":true}`
 	req := httptest.NewRequest(http.MethodPost, "/delete", bytes.NewBufferString(body))
 	w := httptest.NewRecorder()
 
-	fileHandler.DeleteFileHandler(w, req)
+	srv.DeleteFileHandler(w, req)
 
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 	assert.Contains(t, w.Body.String(), "File delete failed")
+	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestDeleteFileHandler_MetadataError(t *testing.T) {
-	defer restoreOriginals()
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
 
-	owncloud.DeleteFile = func(fileID, userID string) error {
-		return nil
-	}
-	metadata.DeleteFileMetadata = func(fileID string) error {
-		return errors.New("metadata deletion failed")
-	}
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM received_files`).WillReturnError(errors.New("metadata deletion failed"))
+	mock.ExpectRollback()
 
-	body := `{"fileId":"fileXYZ", "userId":"user123"}`
+	body := `{"fileId":"fileXYZ", "userId":"user123", "permanent":true}`
 	req := httptest.NewRequest(http.MethodPost, "/delete", bytes.NewBufferString(body))
 	w := httptest.NewRecorder()
 
-	fileHandler.DeleteFileHandler(w, req)
+	srv.DeleteFileHandler(w, req)
 
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 	assert.Contains(t, w.Body.String(), "File delete failed")
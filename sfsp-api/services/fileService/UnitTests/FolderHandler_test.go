@@ -2,39 +2,40 @@ package unitTests
 
 import (
 	"bytes"
-	"database/sql"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
-	"github.com/DATA-DOG/go-sqlmock"
-	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
 )
 
+// folderWritesFail is a store that cannot create folders.
+type folderWritesFail struct{ store.Store }
+
+func (folderWritesFail) AddFolder(context.Context, store.File) (string, error) {
+	return "", errStore
+}
+
+// addParentFolder stores the folder my/docs of user123 and returns its id.
+func addParentFolder(t *testing.T, st *store.Memory) string {
+	t.Helper()
+	id, err := st.AddFolder(context.Background(), store.File{OwnerID: "user123", FileName: "docs", CID: "my/docs"})
+	require.NoError(t, err)
+	return id
+}
 
 func TestCreateFolderHandler_Success(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, st, _ := newMemoryServer(t)
 
 	testUserID := "user123"
 	testFolderName := "MyFolder"
 	testDescription := "Test folder description"
-	testFolderID := "folder456"
-
-	mock.ExpectQuery(`INSERT INTO files`).
-		WithArgs(
-			testUserID,
-			testFolderName,
-			testFolderName, 
-			testDescription,
-			pq.Array([]string{"folder"}),
-		).
-		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testFolderID))
 
 	reqBody := map[string]interface{}{
 		"userId":      testUserID,
@@ -49,42 +50,37 @@ func TestCreateFolderHandler_Success(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	fileHandler.CreateFolderHandler(rr, req)
+	srv.CreateFolderHandler(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
-	assert.Equal(t, "*", rr.Header().Get("Access-Control-Allow-Origin"))
-	assert.Equal(t, "Content-Type", rr.Header().Get("Access-Control-Allow-Headers"))
 
 	var response map[string]string
 	err = json.Unmarshal(rr.Body.Bytes(), &response)
 	require.NoError(t, err)
 
-	assert.Equal(t, testFolderID, response["folderId"])
 	assert.Equal(t, testFolderName, response["cid"])
 
-	assert.NoError(t, mock.ExpectationsWereMet())
+	folder, err := st.File(context.Background(), response["folderId"])
+	require.NoError(t, err)
+	assert.Equal(t, testUserID, folder.OwnerID)
+	assert.Equal(t, "folder", folder.FileType)
+	assert.Equal(t, testFolderName, folder.FileName)
+	assert.Equal(t, testFolderName, folder.CID)
+	assert.Equal(t, testDescription, folder.Description)
+	assert.Equal(t, []string{"folder"}, folder.Tags)
+	assert.Empty(t, folder.ParentID)
 }
 
 func TestCreateFolderHandler_SuccessWithParentPath(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, st, _ := newMemoryServer(t)
+	parentID := addParentFolder(t, st)
 
 	testUserID := "user123"
 	testFolderName := "SubFolder"
 	testParentPath := "my/docs/"
 	testDescription := "Test sub folder"
-	testFolderID := "folder789"
 	expectedCID := "my/docs/SubFolder"
-	mock.ExpectQuery(`INSERT INTO files`).
-		WithArgs(
-			testUserID,
-			testFolderName,
-			expectedCID,
-			testDescription,
-			pq.Array([]string{"folder"}),
-		).
-		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testFolderID))
 
 	reqBody := map[string]interface{}{
 		"userId":      testUserID,
@@ -99,40 +95,32 @@ func TestCreateFolderHandler_SuccessWithParentPath(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
-	fileHandler.CreateFolderHandler(rr, req)
+	srv.CreateFolderHandler(rr, req)
 	assert.Equal(t, http.StatusOK, rr.Code)
 
 	var response map[string]string
 	err = json.Unmarshal(rr.Body.Bytes(), &response)
 	require.NoError(t, err)
 
-	assert.Equal(t, testFolderID, response["folderId"])
 	assert.Equal(t, expectedCID, response["cid"])
+	assert.Equal(t, parentID, response["parentId"])
 
-	assert.NoError(t, mock.ExpectationsWereMet())
+	folder, err := st.File(context.Background(), response["folderId"])
+	require.NoError(t, err)
+	assert.Equal(t, expectedCID, folder.CID)
+	assert.Equal(t, parentID, folder.ParentID)
 }
 
 func TestCreateFolderHandler_SuccessWithParentPathNoTrailingSlash(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, st, _ := newMemoryServer(t)
+	parentID := addParentFolder(t, st)
 
 	testUserID := "user123"
 	testFolderName := "SubFolder"
 	testParentPath := "my/docs"
 	testDescription := "Test sub folder"
-	testFolderID := "folder789"
 	expectedCID := "my/docs/SubFolder"
 
-	mock.ExpectQuery(`INSERT INTO files`).
-		WithArgs(
-			testUserID,
-			testFolderName,
-			expectedCID,
-			testDescription,
-			pq.Array([]string{"folder"}),
-		).
-		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testFolderID))
-
 	reqBody := map[string]interface{}{
 		"userId":      testUserID,
 		"folderName":  testFolderName,
@@ -147,7 +135,7 @@ func TestCreateFolderHandler_SuccessWithParentPathNoTrailingSlash(t *testing.T)
 
 	rr := httptest.NewRecorder()
 
-	fileHandler.CreateFolderHandler(rr, req)
+	srv.CreateFolderHandler(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -156,13 +144,11 @@ func TestCreateFolderHandler_SuccessWithParentPathNoTrailingSlash(t *testing.T)
 	require.NoError(t, err)
 
 	assert.Equal(t, expectedCID, response["cid"])
-
-	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, parentID, response["parentId"])
 }
 
 func TestCreateFolderHandler_InvalidJSON(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, _, _ := newMemoryServer(t)
 
 	req, err := http.NewRequest("POST", "/create-folder", bytes.NewBuffer([]byte("invalid json")))
 	require.NoError(t, err)
@@ -170,15 +156,14 @@ func TestCreateFolderHandler_InvalidJSON(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	fileHandler.CreateFolderHandler(rr, req)
+	srv.CreateFolderHandler(rr, req)
 
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Invalid JSON")
 }
 
 func TestCreateFolderHandler_MissingUserID(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, _, _ := newMemoryServer(t)
 
 	reqBody := map[string]interface{}{
 		"folderName":  "TestFolder",
@@ -192,15 +177,14 @@ func TestCreateFolderHandler_MissingUserID(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	fileHandler.CreateFolderHandler(rr, req)
+	srv.CreateFolderHandler(rr, req)
 
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Missing userId or folderName")
 }
 
 func TestCreateFolderHandler_MissingFolderName(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, _, _ := newMemoryServer(t)
 
 	reqBody := map[string]interface{}{
 		"userId":      "user123",
@@ -214,15 +198,14 @@ func TestCreateFolderHandler_MissingFolderName(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	fileHandler.CreateFolderHandler(rr, req)
+	srv.CreateFolderHandler(rr, req)
 
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Missing userId or folderName")
 }
 
 func TestCreateFolderHandler_EmptyUserID(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, _, _ := newMemoryServer(t)
 
 	reqBody := map[string]interface{}{
 		"userId":      "",
@@ -237,15 +220,14 @@ func TestCreateFolderHandler_EmptyUserID(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	fileHandler.CreateFolderHandler(rr, req)
+	srv.CreateFolderHandler(rr, req)
 
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Missing userId or folderName")
 }
 
 func TestCreateFolderHandler_EmptyFolderName(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, _, _ := newMemoryServer(t)
 
 	reqBody := map[string]interface{}{
 		"userId":      "user123",
@@ -260,30 +242,20 @@ func TestCreateFolderHandler_EmptyFolderName(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	fileHandler.CreateFolderHandler(rr, req)
+	srv.CreateFolderHandler(rr, req)
 
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Missing userId or folderName")
 }
 
 func TestCreateFolderHandler_DatabaseError(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, st, _ := newMemoryServer(t)
+	srv.SetStore(folderWritesFail{st})
 
 	testUserID := "user123"
 	testFolderName := "TestFolder"
 	testDescription := "Test description"
 
-	mock.ExpectQuery(`INSERT INTO files`).
-		WithArgs(
-			testUserID,
-			testFolderName,
-			testFolderName,
-			testDescription,
-			pq.Array([]string{"folder"}),
-		).
-		WillReturnError(sql.ErrConnDone)
-
 	reqBody := map[string]interface{}{
 		"userId":      testUserID,
 		"folderName":  testFolderName,
@@ -297,31 +269,17 @@ func TestCreateFolderHandler_DatabaseError(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	fileHandler.CreateFolderHandler(rr, req)
+	srv.CreateFolderHandler(rr, req)
 
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Failed to create folder")
-
-	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestCreateFolderHandler_OptionalFields(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, st, _ := newMemoryServer(t)
 
 	testUserID := "user123"
 	testFolderName := "MinimalFolder"
-	testFolderID := "folder999"
-
-	mock.ExpectQuery(`INSERT INTO files`).
-		WithArgs(
-			testUserID,
-			testFolderName,
-			testFolderName,
-			"", 
-			pq.Array([]string{"folder"}),
-		).
-		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testFolderID))
 
 	reqBody := map[string]interface{}{
 		"userId":     testUserID,
@@ -335,7 +293,7 @@ func TestCreateFolderHandler_OptionalFields(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	fileHandler.CreateFolderHandler(rr, req)
+	srv.CreateFolderHandler(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -343,18 +301,16 @@ func TestCreateFolderHandler_OptionalFields(t *testing.T) {
 	err = json.Unmarshal(rr.Body.Bytes(), &response)
 	require.NoError(t, err)
 
-	assert.Equal(t, testFolderID, response["folderId"])
 	assert.Equal(t, testFolderName, response["cid"])
 
-	assert.NoError(t, mock.ExpectationsWereMet())
+	folder, err := st.File(context.Background(), response["folderId"])
+	require.NoError(t, err)
+	assert.Empty(t, folder.Description)
+	assert.Empty(t, folder.ParentID)
 }
 
 func TestCreateFolderHandler_CORSHeaders(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
-	defer cleanup()
-
-	mock.ExpectQuery(`INSERT INTO files`).
-		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("test-id"))
+	srv, _, _ := newMemoryServer(t)
 
 	reqBody := map[string]interface{}{
 		"userId":     "user123",
@@ -365,9 +321,22 @@ func TestCreateFolderHandler_CORSHeaders(t *testing.T) {
 	req, err := http.NewRequest("POST", "/create-folder", bytes.NewBuffer(jsonBody))
 	require.NoError(t, err)
 
+	req.Header.Set("Origin", "https://app.example.com")
+	h := api.CORS(http.HandlerFunc(srv.CreateFolderHandler), []string{"*"})
+
 	rr := httptest.NewRecorder()
-	fileHandler.CreateFolderHandler(rr, req)
+	h.ServeHTTP(rr, req)
 
+	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Equal(t, "*", rr.Header().Get("Access-Control-Allow-Origin"))
-	assert.Equal(t, "Content-Type", rr.Header().Get("Access-Control-Allow-Headers"))
+
+	preflight, err := http.NewRequest(http.MethodOptions, "/create-folder", nil)
+	require.NoError(t, err)
+	preflight.Header.Set("Origin", "https://app.example.com")
+	preflight.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, preflight)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Contains(t, rr.Header().Get("Access-Control-Allow-Headers"), "Content-Type")
 }
\ No newline at end of file
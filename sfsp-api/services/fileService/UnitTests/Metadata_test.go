@@ -1,10 +1,11 @@
 package unitTests
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"errors"
-	"log"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -12,41 +13,86 @@ import (
 	"time"
 
 	metadata "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metadata"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func SetupMetadataMockDB(t *testing.T) (sqlmock.Sqlmock, func()) {
+func SetupMetadataMockDB(t *testing.T) (*metadata.Server, sqlmock.Sqlmock, func()) {
 	t.Helper()
 	db, mock, err := sqlmock.New()
 	require.NoError(t, err)
-	metadata.SetPostgreClient(db)
-	cleanup := func() {
-		_ = db.Close()
-		metadata.DB = nil
+	return metadata.New(db, metadata.Config{}), mock, func() { _ = db.Close() }
+}
+
+// fileColumns are the columns the store reads for a file.
+var fileColumns = []string{"id", "owner_id", "file_name", "file_type", "file_hash", "nonce", "description",
+	"tags", "cid", "file_size", "allow_view_sharing", "parent_id", "created_at", "corrupted_at", "deleted_at"}
+
+var receivedFileColumns = []string{"id", "recipient_id", "sender_id", "file_id", "metadata", "accepted",
+	"received_at", "expires_at", "expired_at"}
+
+var sentFileColumns = []string{"id", "sender_id", "recipient_id", "file_id", "encrypted_file_key",
+	"x3dh_ephemeral_pubkey", "sent_at"}
+
+// withColumns returns columns followed by extra.
+func withColumns(columns []string, extra ...string) []string {
+	return append(append([]string{}, columns...), extra...)
+}
+
+// fileRow returns f as a row of fileColumns followed by extra.
+func fileRow(f store.File, extra ...driver.Value) []driver.Value {
+	var parentID, corruptedAt, deletedAt driver.Value
+	if f.ParentID != "" {
+		parentID = f.ParentID
+	}
+	if f.CorruptedAt != nil {
+		corruptedAt = *f.CorruptedAt
+	}
+	if f.DeletedAt != nil {
+		deletedAt = *f.DeletedAt
 	}
-	return mock, cleanup
+	tags, _ := pq.Array(f.Tags).Value()
+	if f.CreatedAt.IsZero() {
+		f.CreatedAt = time.Now()
+	}
+	return append([]driver.Value{f.ID, f.OwnerID, f.FileName, f.FileType, f.FileHash, f.Nonce, f.Description,
+		tags, f.CID, f.FileSize, f.AllowViewSharing, parentID, f.CreatedAt, corruptedAt, deletedAt}, extra...)
+}
+
+// expiresWithin matches an expiry d from now, give or take a minute.
+type expiresWithin time.Duration
+
+func (d expiresWithin) Match(v driver.Value) bool {
+	at, ok := v.(time.Time)
+	if !ok {
+		return false
+	}
+	want := time.Now().Add(time.Duration(d))
+	return at.After(want.Add(-time.Minute)) && at.Before(want.Add(time.Minute))
 }
 
 func TestGetUserFilesHandler_Success(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
-	rows := sqlmock.NewRows([]string{"id", "file_name", "file_type", "file_size", "description", "tags", "created_at", "cid"}).
-		AddRow("file-123", "test.txt", "text/plain", int64(100), "Test file", "tag1,tag2", time.Now(), "folder/test.txt").
-		AddRow("file-456", "doc.pdf", "application/pdf", int64(200), "PDF doc", "pdf,document", time.Now(), "folder/doc.pdf")
+	rows := sqlmock.NewRows(withColumns(fileColumns, "sort_key")).
+		AddRow(fileRow(store.File{ID: "file-123", OwnerID: "user-1", FileName: "test.txt", FileType: "text/plain", FileSize: 100,
+			Description: "Test file", Tags: []string{"tag1", "tag2"}, CID: "folder/test.txt"}, "2025-09-02")...).
+		AddRow(fileRow(store.File{ID: "file-456", OwnerID: "user-1", FileName: "doc.pdf", FileType: "application/pdf", FileSize: 200,
+			Description: "PDF doc", Tags: []string{"pdf", "document"}, CID: "folder/doc.pdf"}, "2025-09-01")...)
 
-	mock.ExpectQuery(`SELECT id, file_name, file_type, file_size, description, tags, created_at, cid FROM files WHERE owner_id = \$1`).
-		WithArgs("user-1").
+	mock.ExpectQuery(`SELECT id, owner_id, file_name, .*, \(created_at\)::text FROM files WHERE owner_id = \$1 AND deleted_at IS NULL ORDER BY created_at DESC, id::text DESC LIMIT \$2`).
+		WithArgs("user-1", 101).
 		WillReturnRows(rows)
 
 	body := metadata.MetadataQueryRequest{UserID: "user-1"}
 	req := NewJSONRequest(t, http.MethodPost, "/getUserFiles", body)
 	rr := httptest.NewRecorder()
 
-	metadata.GetUserFilesHandler(rr, req)
+	meta.GetUserFilesHandler(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
 
@@ -60,44 +106,44 @@ func TestGetUserFilesHandler_Success(t *testing.T) {
 }
 
 func TestGetUserFilesHandler_BadJSON(t *testing.T) {
-	_, cleanup := SetupMetadataMockDB(t)
+	meta, _, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	req := httptest.NewRequest(http.MethodPost, "/getUserFiles", strings.NewReader("{bad json"))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
-	metadata.GetUserFilesHandler(rr, req)
+	meta.GetUserFilesHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Invalid JSON payload")
 }
 
 func TestGetUserFilesHandler_MissingUserID(t *testing.T) {
-	_, cleanup := SetupMetadataMockDB(t)
+	meta, _, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	body := metadata.MetadataQueryRequest{UserID: ""}
 	req := NewJSONRequest(t, http.MethodPost, "/getUserFiles", body)
 	rr := httptest.NewRecorder()
 
-	metadata.GetUserFilesHandler(rr, req)
+	meta.GetUserFilesHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Missing userId parameter")
 }
 
 func TestGetUserFilesHandler_DBError(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
-	mock.ExpectQuery(`SELECT id, file_name`).WillReturnError(sql.ErrConnDone)
+	mock.ExpectQuery(`SELECT id, owner_id, file_name`).WillReturnError(sql.ErrConnDone)
 
 	body := metadata.MetadataQueryRequest{UserID: "user-1"}
 	req := NewJSONRequest(t, http.MethodPost, "/getUserFiles", body)
 	rr := httptest.NewRecorder()
 
-	metadata.GetUserFilesHandler(rr, req)
+	meta.GetUserFilesHandler(rr, req)
 
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Failed to fetch metadata")
@@ -106,39 +152,37 @@ func TestGetUserFilesHandler_DBError(t *testing.T) {
 }
 
 func TestGetUserFilesHandler_RowScanError(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 	rows := sqlmock.NewRows([]string{"id", "file_name", "file_type"}).
 		AddRow("file-123", "test.txt", "text/plain")
 
-	mock.ExpectQuery(`SELECT id, file_name, file_type, file_size, description, tags, created_at, cid FROM files WHERE owner_id = \$1`).
-		WithArgs("user-1").
+	mock.ExpectQuery(`SELECT id, owner_id, file_name, .*, \(created_at\)::text FROM files WHERE owner_id = \$1 AND deleted_at IS NULL ORDER BY created_at DESC, id::text DESC LIMIT \$2`).
+		WithArgs("user-1", 101).
 		WillReturnRows(rows)
 
 	body := metadata.MetadataQueryRequest{UserID: "user-1"}
 	req := NewJSONRequest(t, http.MethodPost, "/getUserFiles", body)
 	rr := httptest.NewRecorder()
 
-	metadata.GetUserFilesHandler(rr, req)
+	meta.GetUserFilesHandler(rr, req)
 
-	require.Equal(t, http.StatusOK, rr.Code)
-
-	var files []map[string]interface{}
-	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &files))
-	assert.Len(t, files, 0)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Failed to fetch metadata")
 
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestListFileMetadataHandler_Success(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
-	rows := sqlmock.NewRows([]string{"id", "file_name", "file_type", "file_size", "description", "tags", "created_at"}).
-		AddRow("file-123", "test.txt", "text/plain", int64(100), "Test file", pq.Array([]string{"tag1", "tag2"}), time.Now())
+	rows := sqlmock.NewRows(withColumns(fileColumns, "sort_key")).
+		AddRow(fileRow(store.File{ID: "file-123", OwnerID: "user-1", FileName: "test.txt", FileType: "text/plain", FileSize: 100,
+			Description: "Test file", Tags: []string{"tag1", "tag2"}}, "2025-09-01")...)
 
-	mock.ExpectQuery(`SELECT id, file_name, file_type, file_size, description, tags, created_at FROM files WHERE owner_id = \$1`).
-		WithArgs("user-1").
+	mock.ExpectQuery(`SELECT id, owner_id, file_name, .* FROM files WHERE owner_id = \$1`).
+		WithArgs("user-1", 101).
 		WillReturnRows(rows)
 
 	type MetadataRequest struct {
@@ -148,7 +192,7 @@ func TestListFileMetadataHandler_Success(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/listFileMetadata", body)
 	rr := httptest.NewRecorder()
 
-	metadata.ListFileMetadataHandler(rr, req)
+	meta.ListFileMetadataHandler(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
 
@@ -171,21 +215,21 @@ func TestListFileMetadataHandler_Success(t *testing.T) {
 }
 
 func TestListFileMetadataHandler_BadJSON(t *testing.T) {
-	_, cleanup := SetupMetadataMockDB(t)
+	meta, _, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	req := httptest.NewRequest(http.MethodPost, "/listFileMetadata", strings.NewReader("{bad json"))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
-	metadata.ListFileMetadataHandler(rr, req)
+	meta.ListFileMetadataHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Invalid JSON payload")
 }
 
 func TestListFileMetadataHandler_MissingUserID(t *testing.T) {
-	_, cleanup := SetupMetadataMockDB(t)
+	meta, _, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	type MetadataRequest struct {
@@ -195,14 +239,14 @@ func TestListFileMetadataHandler_MissingUserID(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/listFileMetadata", body)
 	rr := httptest.NewRecorder()
 
-	metadata.ListFileMetadataHandler(rr, req)
+	meta.ListFileMetadataHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Missing userId")
 }
 
 func TestGetUserFileCountHandler_Success(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	rows := sqlmock.NewRows([]string{"count"}).AddRow(5)
@@ -214,7 +258,7 @@ func TestGetUserFileCountHandler_Success(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/getUserFileCount", body)
 	rr := httptest.NewRecorder()
 
-	metadata.GetUserFileCountHandler(rr, req)
+	meta.GetUserFileCountHandler(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
 
@@ -226,35 +270,35 @@ func TestGetUserFileCountHandler_Success(t *testing.T) {
 }
 
 func TestGetUserFileCountHandler_BadJSON(t *testing.T) {
-	_, cleanup := SetupMetadataMockDB(t)
+	meta, _, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	req := httptest.NewRequest(http.MethodPost, "/getUserFileCount", strings.NewReader("{bad json"))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
-	metadata.GetUserFileCountHandler(rr, req)
+	meta.GetUserFileCountHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Invalid JSON payload")
 }
 
 func TestGetUserFileCountHandler_MissingUserID(t *testing.T) {
-	_, cleanup := SetupMetadataMockDB(t)
+	meta, _, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	body := metadata.MetadataQueryRequest{UserID: ""}
 	req := NewJSONRequest(t, http.MethodPost, "/getUserFileCount", body)
 	rr := httptest.NewRecorder()
 
-	metadata.GetUserFileCountHandler(rr, req)
+	meta.GetUserFileCountHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Missing userId")
 }
 
 func TestGetUserFileCountHandler_DBError(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	mock.ExpectQuery(`SELECT COUNT`).WillReturnError(sql.ErrConnDone)
@@ -263,7 +307,7 @@ func TestGetUserFileCountHandler_DBError(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/getUserFileCount", body)
 	rr := httptest.NewRecorder()
 
-	metadata.GetUserFileCountHandler(rr, req)
+	meta.GetUserFileCountHandler(rr, req)
 
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Failed to retrieve file count")
@@ -272,12 +316,12 @@ func TestGetUserFileCountHandler_DBError(t *testing.T) {
 }
 
 func TestAddReceivedFileHandler_Success(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
-	mock.ExpectExec(`INSERT INTO received_files`).
-		WithArgs("sender-1", "recipient-1", "file-123", sqlmock.AnyArg()).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`INSERT INTO received_files .* RETURNING id`).
+		WithArgs(nil, "recipient-1", "sender-1", "file-123", sqlmock.AnyArg(), false, expiresWithin(metadata.DefaultConfig.ShareExpiry)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("rf-1"))
 
 	body := metadata.AddReceivedFileRequest{
 		SenderID:            "sender-1",
@@ -291,7 +335,7 @@ func TestAddReceivedFileHandler_Success(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/addReceivedFile", body)
 	rr := httptest.NewRecorder()
 
-	metadata.AddReceivedFileHandler(rr, req)
+	meta.AddReceivedFileHandler(rr, req)
 
 	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
 
@@ -302,22 +346,43 @@ func TestAddReceivedFileHandler_Success(t *testing.T) {
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestAddReceivedFileHandler_UsesConfiguredExpiry(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+	meta := metadata.New(db, metadata.Config{ShareExpiry: 72 * time.Hour})
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	meta.SetClock(func() time.Time { return now })
+
+	mock.ExpectQuery(`INSERT INTO received_files .* RETURNING id`).
+		WithArgs(nil, "recipient-1", "sender-1", "file-123", sqlmock.AnyArg(), false, now.Add(72*time.Hour)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("rf-1"))
+
+	rr := httptest.NewRecorder()
+	meta.AddReceivedFileHandler(rr, NewJSONRequest(t, http.MethodPost, "/addReceivedFile", metadata.AddReceivedFileRequest{
+		SenderID: "sender-1", RecipientID: "recipient-1", FileID: "file-123",
+	}))
+
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestAddReceivedFileHandler_BadJSON(t *testing.T) {
-	_, cleanup := SetupMetadataMockDB(t)
+	meta, _, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	req := httptest.NewRequest(http.MethodPost, "/addReceivedFile", strings.NewReader("{bad json"))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
-	metadata.AddReceivedFileHandler(rr, req)
+	meta.AddReceivedFileHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Invalid JSON payload")
 }
 
 func TestAddReceivedFileHandler_MissingFields(t *testing.T) {
-	_, cleanup := SetupMetadataMockDB(t)
+	meta, _, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	body := metadata.AddReceivedFileRequest{
@@ -328,17 +393,17 @@ func TestAddReceivedFileHandler_MissingFields(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/addReceivedFile", body)
 	rr := httptest.NewRecorder()
 
-	metadata.AddReceivedFileHandler(rr, req)
+	meta.AddReceivedFileHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Missing required fields")
 }
 
 func TestAddReceivedFileHandler_DBError(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
-	mock.ExpectExec(`INSERT INTO received_files`).WillReturnError(sql.ErrConnDone)
+	mock.ExpectQuery(`INSERT INTO received_files`).WillReturnError(sql.ErrConnDone)
 
 	body := metadata.AddReceivedFileRequest{
 		SenderID:    "sender-1",
@@ -349,7 +414,7 @@ func TestAddReceivedFileHandler_DBError(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/addReceivedFile", body)
 	rr := httptest.NewRecorder()
 
-	metadata.AddReceivedFileHandler(rr, req)
+	meta.AddReceivedFileHandler(rr, req)
 
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Failed to insert received file record")
@@ -358,21 +423,22 @@ func TestAddReceivedFileHandler_DBError(t *testing.T) {
 }
 
 func TestGetPendingFilesHandler_Success(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
-	rows := sqlmock.NewRows([]string{"id", "sender_id", "file_id", "received_at", "expires_at", "metadata"}).
-		AddRow("pending-123", "sender-1", "file-123", time.Now(), time.Now().Add(24*time.Hour), `{"name":"test.txt","size":100}`)
+	rows := sqlmock.NewRows(withColumns(receivedFileColumns, "sort_key")).
+		AddRow("pending-123", "user-1", "sender-1", "file-123", `{"name":"test.txt","size":100}`, false,
+			time.Now(), time.Now().Add(24*time.Hour), nil, "2025-09-01")
 
-	mock.ExpectQuery(`SELECT id, sender_id, file_id, received_at, expires_at, metadata FROM received_files WHERE recipient_id = \$1 AND expires_at > NOW\(\) AND accepted = FALSE`).
-		WithArgs("user-1").
+	mock.ExpectQuery(`SELECT id, recipient_id, sender_id, .*, \(received_at\)::text FROM received_files WHERE recipient_id = \$1 AND \(expires_at IS NULL OR expires_at > NOW\(\)\) AND accepted = FALSE`).
+		WithArgs("user-1", 101).
 		WillReturnRows(rows)
 
 	body := metadata.MetadataQueryRequest{UserID: "user-1"}
 	req := NewJSONRequest(t, http.MethodPost, "/getPendingFiles", body)
 	rr := httptest.NewRecorder()
 
-	metadata.GetPendingFilesHandler(rr, req)
+	meta.GetPendingFilesHandler(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
 
@@ -391,40 +457,40 @@ func TestGetPendingFilesHandler_Success(t *testing.T) {
 }
 
 func TestGetPendingFilesHandler_BadJSON(t *testing.T) {
-	_, cleanup := SetupMetadataMockDB(t)
+	meta, _, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	req := httptest.NewRequest(http.MethodPost, "/getPendingFiles", strings.NewReader("{bad json"))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
-	metadata.GetPendingFilesHandler(rr, req)
+	meta.GetPendingFilesHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Invalid JSON payload")
 }
 
 func TestGetPendingFilesHandler_MissingUserID(t *testing.T) {
-	_, cleanup := SetupMetadataMockDB(t)
+	meta, _, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	body := metadata.MetadataQueryRequest{UserID: ""}
 	req := NewJSONRequest(t, http.MethodPost, "/getPendingFiles", body)
 	rr := httptest.NewRecorder()
 
-	metadata.GetPendingFilesHandler(rr, req)
+	meta.GetPendingFilesHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Missing userId")
 }
 
 func TestAddSentFileHandler_Success(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
-	mock.ExpectExec(`INSERT INTO sent_files`).
-		WithArgs("sender-1", "recipient-1", "file-123").
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`INSERT INTO sent_files .* RETURNING id`).
+		WithArgs(nil, "sender-1", "recipient-1", "file-123", nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("sent-1"))
 
 	type SentFileRequest struct {
 		SenderID    string `json:"senderId"`
@@ -439,7 +505,7 @@ func TestAddSentFileHandler_Success(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/addSentFile", body)
 	rr := httptest.NewRecorder()
 
-	metadata.AddSentFileHandler(rr, req)
+	meta.AddSentFileHandler(rr, req)
 
 	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
 
@@ -451,21 +517,21 @@ func TestAddSentFileHandler_Success(t *testing.T) {
 }
 
 func TestAddSentFileHandler_BadJSON(t *testing.T) {
-	_, cleanup := SetupMetadataMockDB(t)
+	meta, _, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	req := httptest.NewRequest(http.MethodPost, "/addSentFile", strings.NewReader("{bad json"))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
-	metadata.AddSentFileHandler(rr, req)
+	meta.AddSentFileHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Invalid JSON payload")
 }
 
 func TestAddSentFileHandler_MissingFields(t *testing.T) {
-	_, cleanup := SetupMetadataMockDB(t)
+	meta, _, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	type SentFileRequest struct {
@@ -481,28 +547,28 @@ func TestAddSentFileHandler_MissingFields(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/addSentFile", body)
 	rr := httptest.NewRecorder()
 
-	metadata.AddSentFileHandler(rr, req)
+	meta.AddSentFileHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Missing required fields")
 }
 
 func TestGetSentFilesHandler_Success(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
-	rows := sqlmock.NewRows([]string{"id", "recipient_id", "file_id", "sent_at"}).
-		AddRow("sent-123", "recipient-1", "file-123", time.Now())
+	rows := sqlmock.NewRows(withColumns(sentFileColumns, "sort_key")).
+		AddRow("sent-123", "user-1", "recipient-1", "file-123", nil, nil, time.Now(), "2025-09-01")
 
-	mock.ExpectQuery(`SELECT id, recipient_id, file_id, sent_at FROM sent_files WHERE sender_id = \$1`).
-		WithArgs("user-1").
+	mock.ExpectQuery(`SELECT id, sender_id, recipient_id, .*, \(sent_at\)::text FROM sent_files WHERE sender_id = \$1 ORDER BY sent_at DESC`).
+		WithArgs("user-1", 101).
 		WillReturnRows(rows)
 
 	body := metadata.MetadataQueryRequest{UserID: "user-1"}
 	req := NewJSONRequest(t, http.MethodPost, "/getSentFiles", body)
 	rr := httptest.NewRecorder()
 
-	metadata.GetSentFilesHandler(rr, req)
+	meta.GetSentFilesHandler(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
 
@@ -516,21 +582,21 @@ func TestGetSentFilesHandler_Success(t *testing.T) {
 }
 
 func TestAddTagsHandler_BadJSON(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	meta, _, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	req := httptest.NewRequest(http.MethodPost, "/addTags", strings.NewReader("{bad json"))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
-	metadata.AddTagsHandler(rr, req)
+	meta.AddTagsHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Invalid request payload")
 }
 
 func TestAddTagsHandler_MissingFields(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	meta, _, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	body := metadata.AddTagsRequest{
@@ -540,65 +606,65 @@ func TestAddTagsHandler_MissingFields(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/addTags", body)
 	rr := httptest.NewRecorder()
 
-	metadata.AddTagsHandler(rr, req)
+	meta.AddTagsHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Missing fileId or tags")
 }
 
 func TestGetUserFilesHandler_RowsErr(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
-	rows := sqlmock.NewRows([]string{"id", "file_name", "file_type", "file_size", "description", "tags", "created_at", "cid"}).
-		AddRow("f1", "a.txt", "text/plain", int64(1), "", "", time.Now(), "cid/a").
+	rows := sqlmock.NewRows(withColumns(fileColumns, "sort_key")).
+		AddRow(fileRow(store.File{ID: "f1", OwnerID: "u1", FileName: "a.txt", FileType: "text/plain", FileSize: 1, CID: "cid/a"}, "2025-09-01")...).
 		RowError(0, errors.New("row boom"))
 
-	mock.ExpectQuery(`SELECT id, file_name, file_type, file_size, description, tags, created_at, cid FROM files WHERE owner_id = \$1`).
-		WithArgs("u1").
+	mock.ExpectQuery(`SELECT id, owner_id, file_name, .* FROM files WHERE owner_id = \$1`).
+		WithArgs("u1", 101).
 		WillReturnRows(rows)
 
 	req := NewJSONRequest(t, http.MethodPost, "/getUserFiles", metadata.MetadataQueryRequest{UserID: "u1"})
 	rr := httptest.NewRecorder()
 
-	metadata.GetUserFilesHandler(rr, req)
+	meta.GetUserFilesHandler(rr, req)
 
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestGetPendingFilesHandler_DBError(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
-	mock.ExpectQuery(`SELECT id, sender_id, file_id, received_at, expires_at, metadata FROM received_files`).
-		WithArgs("u1").
+	mock.ExpectQuery(`SELECT id, recipient_id, sender_id, .* FROM received_files`).
+		WithArgs("u1", 101).
 		WillReturnError(sql.ErrConnDone)
 
 	req := NewJSONRequest(t, http.MethodPost, "/getPendingFiles", metadata.MetadataQueryRequest{UserID: "u1"})
 	rr := httptest.NewRecorder()
 
-	metadata.GetPendingFilesHandler(rr, req)
+	meta.GetPendingFilesHandler(rr, req)
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestGetPendingFilesHandler_InvalidMetadataJSON(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	now := time.Now()
-	rows := sqlmock.NewRows([]string{"id", "sender_id", "file_id", "received_at", "expires_at", "metadata"}).
-		AddRow("p1", "s1", "f1", now, now.Add(24*time.Hour), "{not-json")
+	rows := sqlmock.NewRows(withColumns(receivedFileColumns, "sort_key")).
+		AddRow("p1", "u1", "s1", "f1", "{not-json", false, now, now.Add(24*time.Hour), nil, "2025-09-01")
 
-	mock.ExpectQuery(`SELECT id, sender_id, file_id, received_at, expires_at, metadata FROM received_files`).
-		WithArgs("u1").
+	mock.ExpectQuery(`SELECT id, recipient_id, sender_id, .* FROM received_files`).
+		WithArgs("u1", 101).
 		WillReturnRows(rows)
 
 	req := NewJSONRequest(t, http.MethodPost, "/getPendingFiles", metadata.MetadataQueryRequest{UserID: "u1"})
 	rr := httptest.NewRecorder()
 
-	metadata.GetPendingFilesHandler(rr, req)
+	meta.GetPendingFilesHandler(rr, req)
 	require.Equal(t, http.StatusOK, rr.Code)
 
 	var resp map[string]any
@@ -610,62 +676,62 @@ func TestGetPendingFilesHandler_InvalidMetadataJSON(t *testing.T) {
 }
 
 func TestAddSentFileHandler_DBError(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
-	mock.ExpectExec(`INSERT INTO sent_files`).WillReturnError(sql.ErrConnDone)
+	mock.ExpectQuery(`INSERT INTO sent_files`).WillReturnError(sql.ErrConnDone)
 
 	req := NewJSONRequest(t, http.MethodPost, "/addSentFile", struct {
 		SenderID, RecipientID, FileID string
 	}{"s", "r", "f"})
 	rr := httptest.NewRecorder()
 
-	metadata.AddSentFileHandler(rr, req)
+	meta.AddSentFileHandler(rr, req)
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestGetSentFilesHandler_BadJSON(t *testing.T) {
-	_, cleanup := SetupMetadataMockDB(t)
+	meta, _, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	req := httptest.NewRequest(http.MethodPost, "/getSentFiles", strings.NewReader("{bad"))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
-	metadata.GetSentFilesHandler(rr, req)
+	meta.GetSentFilesHandler(rr, req)
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestGetSentFilesHandler_MissingUserID(t *testing.T) {
-	_, cleanup := SetupMetadataMockDB(t)
+	meta, _, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	req := NewJSONRequest(t, http.MethodPost, "/getSentFiles", metadata.MetadataQueryRequest{})
 	rr := httptest.NewRecorder()
 
-	metadata.GetSentFilesHandler(rr, req)
+	meta.GetSentFilesHandler(rr, req)
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestGetSentFilesHandler_DBError(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
-	mock.ExpectQuery(`SELECT id, recipient_id, file_id, sent_at FROM sent_files WHERE sender_id = \$1`).
-		WithArgs("u1").
+	mock.ExpectQuery(`SELECT id, sender_id, recipient_id, .* FROM sent_files WHERE sender_id = \$1`).
+		WithArgs("u1", 101).
 		WillReturnError(sql.ErrConnDone)
 
 	req := NewJSONRequest(t, http.MethodPost, "/getSentFiles", metadata.MetadataQueryRequest{UserID: "u1"})
 	rr := httptest.NewRecorder()
 
-	metadata.GetSentFilesHandler(rr, req)
+	meta.GetSentFilesHandler(rr, req)
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestDeleteFileMetadata_Success(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	mock.ExpectBegin()
@@ -677,54 +743,48 @@ func TestDeleteFileMetadata_Success(t *testing.T) {
 		WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
 
-	err := metadata.DeleteFileMetadata("f1")
+	err := meta.DeleteFileMetadata(context.Background(), "f1")
 	require.NoError(t, err)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestDeleteFileMetadata_BeginError(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	require.NoError(t, err)
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Println("error closing db:", err)
-		}
-	}()
-	metadata.DB = db
+	meta, mock, cleanup := SetupMetadataMockDB(t)
+	defer cleanup()
 
 	mock.ExpectBegin().WillReturnError(sql.ErrConnDone)
-	err = metadata.DeleteFileMetadata("f1")
+	err := meta.DeleteFileMetadata(context.Background(), "f1")
 	require.Error(t, err)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestDeleteFileMetadata_ExecError_Received(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	mock.ExpectBegin()
 	mock.ExpectExec(`DELETE FROM received_files`).WillReturnError(sql.ErrConnDone)
 
-	err := metadata.DeleteFileMetadata("f1")
+	err := meta.DeleteFileMetadata(context.Background(), "f1")
 	require.Error(t, err)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestDeleteFileMetadata_ExecError_Sent(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	mock.ExpectBegin()
 	mock.ExpectExec(`DELETE FROM received_files`).WithArgs("f1").WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectExec(`DELETE FROM sent_files`).WillReturnError(sql.ErrConnDone)
 
-	err := metadata.DeleteFileMetadata("f1")
+	err := meta.DeleteFileMetadata(context.Background(), "f1")
 	require.Error(t, err)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestDeleteFileMetadata_ExecError_Files(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	mock.ExpectBegin()
@@ -732,13 +792,13 @@ func TestDeleteFileMetadata_ExecError_Files(t *testing.T) {
 	mock.ExpectExec(`DELETE FROM sent_files`).WithArgs("f1").WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectExec(`DELETE FROM files`).WillReturnError(sql.ErrConnDone)
 
-	err := metadata.DeleteFileMetadata("f1")
+	err := meta.DeleteFileMetadata(context.Background(), "f1")
 	require.Error(t, err)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestDeleteFileMetadata_CommitError(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	mock.ExpectBegin()
@@ -747,13 +807,13 @@ func TestDeleteFileMetadata_CommitError(t *testing.T) {
 	mock.ExpectExec(`DELETE FROM files`).WithArgs("f1").WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit().WillReturnError(sql.ErrTxDone)
 
-	err := metadata.DeleteFileMetadata("f1")
+	err := meta.DeleteFileMetadata(context.Background(), "f1")
 	require.Error(t, err)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestRemoveTagsFromFileHandler_Success(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	mock.ExpectExec(`UPDATE files\s+SET tags = ARRAY\(`).
@@ -766,7 +826,7 @@ func TestRemoveTagsFromFileHandler_Success(t *testing.T) {
 	}{"f1", []string{"a", "b"}})
 	rr := httptest.NewRecorder()
 
-	metadata.RemoveTagsFromFileHandler(rr, req)
+	meta.RemoveTagsFromFileHandler(rr, req)
 	require.Equal(t, http.StatusOK, rr.Code)
 
 	var resp map[string]string
@@ -776,7 +836,7 @@ func TestRemoveTagsFromFileHandler_Success(t *testing.T) {
 }
 
 func TestRemoveTagsFromFileHandler_DBError(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	mock.ExpectExec(`UPDATE files\s+SET tags = ARRAY\(`).WillReturnError(sql.ErrConnDone)
@@ -787,167 +847,137 @@ func TestRemoveTagsFromFileHandler_DBError(t *testing.T) {
 	}{"f1", []string{"a"}})
 	rr := httptest.NewRecorder()
 
-	metadata.RemoveTagsFromFileHandler(rr, req)
+	meta.RemoveTagsFromFileHandler(rr, req)
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestGetRecipientIDFromOPK_Success(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	mock.ExpectQuery(`SELECT user_id FROM one_time_pre_keys WHERE id = \$1`).
 		WithArgs("opk1").
 		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow("u123"))
 
-	id, err := metadata.GetRecipientIDFromOPK("opk1")
+	id, err := meta.GetRecipientIDFromOPK(context.Background(), "opk1")
 	require.NoError(t, err)
 	assert.Equal(t, "u123", id)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestGetRecipientIDFromOPK_NoRows(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	mock.ExpectQuery(`SELECT user_id FROM one_time_pre_keys WHERE id = \$1`).
 		WithArgs("missing").
 		WillReturnError(sql.ErrNoRows)
 
-	_, err := metadata.GetRecipientIDFromOPK("missing")
+	_, err := meta.GetRecipientIDFromOPK(context.Background(), "missing")
 	require.Error(t, err)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestInsertReceivedFile_Success(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	require.NoError(t, err)
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Println("error closing db:", err)
-		}
-	}()
+	meta, mock, cleanup := SetupMetadataMockDB(t)
+	defer cleanup()
 
 	mock.ExpectQuery(`SELECT EXISTS \(.*users.*\)`).
 		WithArgs("recip").
 		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`INSERT INTO received_files .* RETURNING id`).
+		WithArgs(nil, "recip", "sender", "file1", `{}`, false, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("rf-1"))
+
+	id, err := meta.InsertReceivedFile(context.Background(), "recip", "sender", "file1", `{}`, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "rf-1", id)
+	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestInsertReceivedFile_RecipientMissing(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	require.NoError(t, err)
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Println("error closing db:", err)
-		}
-	}()
+	meta, mock, cleanup := SetupMetadataMockDB(t)
+	defer cleanup()
 
 	mock.ExpectQuery(`SELECT EXISTS \(.*users.*\)`).
 		WithArgs("recip").
 		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
 
-	_, err = metadata.InsertReceivedFile(db, "recip", "sender", "file1", `{}`, time.Now())
-	require.NoError(t, err)
+	_, err := meta.InsertReceivedFile(context.Background(), "recip", "sender", "file1", `{}`, time.Now())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not exist")
 }
 
 func TestInsertReceivedFile_CheckError(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	require.NoError(t, err)
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Println("error closing db:", err)
-		}
-	}()
+	meta, mock, cleanup := SetupMetadataMockDB(t)
+	defer cleanup()
 
 	mock.ExpectQuery(`SELECT EXISTS \(.*users.*\)`).
 		WithArgs("recip").
 		WillReturnError(sql.ErrConnDone)
 
-	_, err = metadata.InsertReceivedFile(db, "recip", "sender", "file1", `{}`, time.Now())
-	require.NoError(t, err)
+	_, err := meta.InsertReceivedFile(context.Background(), "recip", "sender", "file1", `{}`, time.Now())
+	require.ErrorIs(t, err, sql.ErrConnDone)
 }
 
 func TestInsertReceivedFile_InsertError(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	require.NoError(t, err)
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Println("error closing db:", err)
-		}
-	}()
+	meta, mock, cleanup := SetupMetadataMockDB(t)
+	defer cleanup()
 
 	mock.ExpectQuery(`SELECT EXISTS \(.*users.*\)`).
 		WithArgs("recip").
 		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
 
 	mock.ExpectQuery(`INSERT INTO received_files .* RETURNING id`).
-		WithArgs("recip", "sender", "file1", sqlmock.AnyArg(), `{}`).
+		WithArgs(nil, "recip", "sender", "file1", `{}`, false, sqlmock.AnyArg()).
 		WillReturnError(sql.ErrConnDone)
 
-	_, err = metadata.InsertReceivedFile(db, "recip", "sender", "file1", `{}`, time.Now())
-	require.NoError(t, err)
+	_, err := meta.InsertReceivedFile(context.Background(), "recip", "sender", "file1", `{}`, time.Now())
+	require.ErrorIs(t, err, sql.ErrConnDone)
 }
 
 func TestInsertSentFile_Success(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	require.NoError(t, err)
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Println("error closing db:", err)
-		}
-	}()
-
-	mock.ExpectExec(`INSERT INTO sent_files`).
-		WithArgs("s", "r", "f", "aes", "ek").
-		WillReturnResult(sqlmock.NewResult(0, 1))
+	meta, mock, cleanup := SetupMetadataMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`INSERT INTO sent_files .* RETURNING id`).
+		WithArgs(nil, "s", "r", "f", "aes", "ek").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("sent-1"))
 
-	err = metadata.InsertSentFile(db, "s", "r", "f", `{"encryptedAesKey":"aes","ekPublicKey":"ek"}`)
+	err := meta.InsertSentFile(context.Background(), "s", "r", "f", `{"encryptedAesKey":"aes","ekPublicKey":"ek"}`)
 	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestInsertSentFile_InvalidJSON(t *testing.T) {
-	db, _, err := sqlmock.New()
-	require.NoError(t, err)
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Println("error closing db:", err)
-		}
-	}()
+	meta, _, cleanup := SetupMetadataMockDB(t)
+	defer cleanup()
 
-	err = metadata.InsertSentFile(db, "s", "r", "f", `{not json`)
-	require.NoError(t, err)
+	err := meta.InsertSentFile(context.Background(), "s", "r", "f", `{not json`)
+	require.Error(t, err)
 }
 
 func TestInsertSentFile_MissingKeys(t *testing.T) {
-	db, _, err := sqlmock.New()
-	require.NoError(t, err)
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Println("error closing db:", err)
-		}
-	}()
+	meta, _, cleanup := SetupMetadataMockDB(t)
+	defer cleanup()
 
-	err = metadata.InsertSentFile(db, "s", "r", "f", `{}`)
-	require.NoError(t, err)
+	err := meta.InsertSentFile(context.Background(), "s", "r", "f", `{}`)
+	require.Error(t, err)
 }
 
 func TestInsertSentFile_DBError(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	require.NoError(t, err)
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Println("error closing db:", err)
-		}
-	}()
+	meta, mock, cleanup := SetupMetadataMockDB(t)
+	defer cleanup()
 
-	mock.ExpectExec(`INSERT INTO sent_files`).WillReturnError(sql.ErrConnDone)
+	mock.ExpectQuery(`INSERT INTO sent_files`).WillReturnError(sql.ErrConnDone)
 
-	err = metadata.InsertSentFile(db, "s", "r", "f", `{"encryptedAesKey":"aes","ekPublicKey":"ek"}`)
-	require.NoError(t, err)
+	err := meta.InsertSentFile(context.Background(), "s", "r", "f", `{"encryptedAesKey":"aes","ekPublicKey":"ek"}`)
+	require.ErrorIs(t, err, sql.ErrConnDone)
 }
 
 func TestAddTagsHandler_Success(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	mock.ExpectExec(`UPDATE files\s+SET tags = array_cat`).
@@ -959,7 +989,7 @@ func TestAddTagsHandler_Success(t *testing.T) {
 	})
 	rr := httptest.NewRecorder()
 
-	metadata.AddTagsHandler(rr, req)
+	meta.AddTagsHandler(rr, req)
 	require.Equal(t, http.StatusOK, rr.Code)
 
 	var resp map[string]string
@@ -969,7 +999,7 @@ func TestAddTagsHandler_Success(t *testing.T) {
 }
 
 func TestAddTagsHandler_DBError(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	mock.ExpectExec(`UPDATE files\s+SET tags = array_cat`).WillReturnError(sql.ErrConnDone)
@@ -979,13 +1009,13 @@ func TestAddTagsHandler_DBError(t *testing.T) {
 	})
 	rr := httptest.NewRecorder()
 
-	metadata.AddTagsHandler(rr, req)
+	meta.AddTagsHandler(rr, req)
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestAddUserHandler_Success(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	mock.ExpectExec(`INSERT INTO users \(id\) VALUES \(\$1\) ON CONFLICT \(id\) DO NOTHING`).
@@ -995,13 +1025,13 @@ func TestAddUserHandler_Success(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/addUser", metadata.MetadataQueryRequest{UserID: "u1"})
 	rr := httptest.NewRecorder()
 
-	metadata.AddUserHandler(rr, req)
+	meta.AddUserHandler(rr, req)
 	require.Equal(t, http.StatusOK, rr.Code)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestAddUserHandler_DBError(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	mock.ExpectExec(`INSERT INTO users`).WillReturnError(sql.ErrConnDone)
@@ -1009,13 +1039,13 @@ func TestAddUserHandler_DBError(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/addUser", metadata.MetadataQueryRequest{UserID: "u1"})
 	rr := httptest.NewRecorder()
 
-	metadata.AddUserHandler(rr, req)
+	meta.AddUserHandler(rr, req)
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestAddDescriptionHandler_Success(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	mock.ExpectExec(`UPDATE files\s+SET description = \$1 WHERE id = \$2`).
@@ -1029,13 +1059,13 @@ func TestAddDescriptionHandler_Success(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/addDescription", body)
 	rr := httptest.NewRecorder()
 
-	metadata.AddDescriptionHandler(rr, req)
+	meta.AddDescriptionHandler(rr, req)
 	require.Equal(t, http.StatusOK, rr.Code)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestAddDescriptionHandler_DBError(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	mock.ExpectExec(`UPDATE files\s+SET description`).WillReturnError(sql.ErrConnDone)
@@ -1046,13 +1076,13 @@ func TestAddDescriptionHandler_DBError(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/addDescription", body)
 	rr := httptest.NewRecorder()
 
-	metadata.AddDescriptionHandler(rr, req)
+	meta.AddDescriptionHandler(rr, req)
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestUpdateFilePathHandler_Success(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	mock.ExpectExec(`UPDATE files\s+SET cid = \$1 WHERE id = \$2`).
@@ -1066,13 +1096,13 @@ func TestUpdateFilePathHandler_Success(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/updatePath", body)
 	rr := httptest.NewRecorder()
 
-	metadata.UpdateFilePathHandler(rr, req)
+	meta.UpdateFilePathHandler(rr, req)
 	require.Equal(t, http.StatusOK, rr.Code)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestUpdateFilePathHandler_DBError(t *testing.T) {
-	mock, cleanup := SetupMetadataMockDB(t)
+	meta, mock, cleanup := SetupMetadataMockDB(t)
 	defer cleanup()
 
 	mock.ExpectExec(`UPDATE files\s+SET cid`).WillReturnError(sql.ErrConnDone)
@@ -1083,7 +1113,7 @@ func TestUpdateFilePathHandler_DBError(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/updatePath", body)
 	rr := httptest.NewRecorder()
 
-	metadata.UpdateFilePathHandler(rr, req)
+	meta.UpdateFilePathHandler(rr, req)
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
@@ -2,7 +2,7 @@ package unitTests
 
 import (
 	"bytes"
-	"database/sql"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
@@ -17,8 +17,8 @@ import (
 	"time"
 
 	fh "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
-	oc "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
-	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/storage"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -103,21 +103,6 @@ func (s *webdavStub) Remove(p string) error {
 	return nil
 }
 
-func setDB(t *testing.T) (sqlmock.Sqlmock, func()) {
-	db, mock, err := sqlmock.New()
-	require.NoError(t, err)
-	fh.DB = db
-	return mock, func() {
-		_ = db.Close()
-		fh.DB = nil
-	}
-}
-
-func setOC(t *testing.T, stub *webdavStub) func() {
-	oc.SetClient(stub)
-	return func() { oc.SetClient(nil) }
-}
-
 func mpReq(t *testing.T, url string, fields map[string]string, fileField, fileName string, fileContent []byte) *http.Request {
 	var buf bytes.Buffer
 	w := multipart.NewWriter(&buf)
@@ -144,15 +129,45 @@ func jsonReq(t *testing.T, url string, v any) *http.Request {
 	return httptest.NewRequest(http.MethodPost, url, &buf)
 }
 
-func TestSendByViewHandler_Success_NonLastChunk(t *testing.T) {
-	mock, cleanupDB := setDB(t)
-	defer cleanupDB()
-	mock.ExpectQuery(`SELECT owner_id FROM files WHERE id = \$1`).
-		WithArgs("F1").
-		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow("U1"))
+// addViewFile stores a file of ownerID under id to share for viewing.
+func addViewFile(t *testing.T, st *store.Memory, id, ownerID string) {
+	t.Helper()
+	_, err := st.AddFile(context.Background(), store.File{ID: id, OwnerID: ownerID, FileName: id + ".pdf"})
+	require.NoError(t, err)
+}
 
+// addViewShare stores v as a live view-only share and returns its id.
+func addViewShare(t *testing.T, st *store.Memory, v store.ViewShare) string {
+	t.Helper()
+	v.AccessGranted = true
+	id, err := st.AddViewShare(context.Background(), v)
+	require.NoError(t, err)
+	return id
+}
+
+// ownerLookupFails is a store whose file owner lookups fail.
+type ownerLookupFails struct{ store.Store }
+
+func (ownerLookupFails) FileOwner(context.Context, string) (string, error) {
+	return "", errStore
+}
+
+// viewShareWritesFail is a store that cannot record view-only shares.
+type viewShareWritesFail struct{ store.Store }
+
+func (viewShareWritesFail) AddViewShare(context.Context, store.ViewShare) (string, error) {
+	return "", errStore
+}
+
+func (viewShareWritesFail) RenewViewShare(context.Context, string, string, *time.Time) error {
+	return errStore
+}
+
+func TestSendByViewHandler_Success_NonLastChunk(t *testing.T) {
 	stub := newWebdavStub()
-	defer setOC(t, stub)()
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
+	addViewFile(t, st, "F1", "U1")
+
 	req := mpReq(t, "/sendByView", map[string]string{
 		"fileid":          "F1",
 		"userId":          "U1",
@@ -163,7 +178,7 @@ func TestSendByViewHandler_Success_NonLastChunk(t *testing.T) {
 	}, "encryptedFile", "c0.bin", []byte("AAA"))
 
 	rr := httptest.NewRecorder()
-	fh.SendByViewHandler(rr, req)
+	srv.SendByViewHandler(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code)
 
@@ -171,35 +186,19 @@ func TestSendByViewHandler_Success_NonLastChunk(t *testing.T) {
 	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
 	assert.Equal(t, "F1", resp["fileId"])
 	assert.Contains(t, resp["message"], "Chunk 0 uploaded")
+	assert.Equal(t, "AAA", stub.writes["temp/F1_chunk_0"])
+
+	_, err := st.ActiveViewShare(context.Background(), "U1", "R1", "F1")
+	assert.ErrorIs(t, err, store.ErrNotFound)
 }
 
 func TestSendByViewHandler_Success_LastChunk_MergeAndStore(t *testing.T) {
-	mock, cleanupDB := setDB(t)
-	defer cleanupDB()
-
-	mock.ExpectQuery(`SELECT owner_id FROM files WHERE id = \$1`).
-		WithArgs("F2").
-		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow("U2"))
-
-	mock.ExpectQuery(`SELECT id FROM shared_files_view .* revoked = FALSE`).
-		WithArgs("U2", "R2", "F2").
-		WillReturnError(sql.ErrNoRows)
-
-	mock.ExpectQuery(`INSERT INTO shared_files_view .* RETURNING id`).
-		WithArgs("U2", "R2", "F2", sqlmock.AnyArg(), `{"name":"doc2"}`, sqlmock.AnyArg()).
-		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("SHARE-123"))
-
-	mock.ExpectExec(`UPDATE files SET allow_view_sharing = TRUE WHERE id = \$1`).
-		WithArgs("F2").
-		WillReturnResult(sqlmock.NewResult(0, 1))
-
-	mock.ExpectExec(`INSERT INTO access_logs .*`).
-		WithArgs("F2", "U2", "shared_view", sqlmock.AnyArg(), true).
-		WillReturnResult(sqlmock.NewResult(0, 1))
-
+	ctx := context.Background()
 	stub := newWebdavStub()
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
+	addViewFile(t, st, "F2", "U2")
+
 	stub.readMap["temp/F2_chunk_0"] = "111"
-	defer setOC(t, stub)()
 
 	req := mpReq(t, "/sendByView", map[string]string{
 		"fileid":          "F2",
@@ -211,25 +210,39 @@ func TestSendByViewHandler_Success_LastChunk_MergeAndStore(t *testing.T) {
 	}, "encryptedFile", "c1.bin", []byte("222"))
 
 	rr := httptest.NewRecorder()
-	fh.SendByViewHandler(rr, req)
-	require.Equal(t, http.StatusOK, rr.Code)
+	srv.SendByViewHandler(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
 
 	var resp map[string]string
 	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
 	assert.Equal(t, "File shared for view-only access successfully", resp["message"])
-	assert.Equal(t, "SHARE-123", resp["shareId"])
-}
+	assert.Equal(t, "111222", stub.writes["files/U2/shared_view/F2_R2"])
 
-func TestSendByViewHandler_Rejects_NotOwner(t *testing.T) {
-	mock, cleanupDB := setDB(t)
-	defer cleanupDB()
+	share, err := st.ActiveViewShare(ctx, "U2", "R2", "F2")
+	require.NoError(t, err)
+	assert.Equal(t, share.ID, resp["shareId"])
+	assert.Equal(t, `{"name":"doc2"}`, share.Metadata)
+	assert.Equal(t, "F2", share.NewFileID)
+	assert.True(t, share.AccessGranted)
 
-	mock.ExpectQuery(`SELECT owner_id FROM files WHERE id = \$1`).
-		WithArgs("F3").
-		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow("OTHER"))
+	hash, err := st.BlobHash(ctx, "files/U2/shared_view/F2_R2")
+	require.NoError(t, err)
+	assert.Equal(t, sha256Hex("111222"), hash.SHA256)
+
+	f, err := st.File(ctx, "F2")
+	require.NoError(t, err)
+	assert.True(t, f.AllowViewSharing)
 
+	logs, err := st.ListViewAccessLogs(ctx, "F2", "U2")
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.Equal(t, "shared_view", logs[0].Action)
+}
+
+func TestSendByViewHandler_Rejects_NotOwner(t *testing.T) {
 	stub := newWebdavStub()
-	defer setOC(t, stub)()
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
+	addViewFile(t, st, "F3", "OTHER")
 
 	req := mpReq(t, "/sendByView", map[string]string{
 		"fileid":          "F3",
@@ -241,30 +254,17 @@ func TestSendByViewHandler_Rejects_NotOwner(t *testing.T) {
 	}, "encryptedFile", "c.bin", []byte("x"))
 
 	rr := httptest.NewRecorder()
-	fh.SendByViewHandler(rr, req)
+	srv.SendByViewHandler(rr, req)
 	require.Equal(t, http.StatusForbidden, rr.Code)
-	require.NoError(t, mock.ExpectationsWereMet())
+	assert.Empty(t, stub.writes)
 }
 
 func TestRevokeViewAccessHandler_Success(t *testing.T) {
-	mock, cleanupDB := setDB(t)
-	defer cleanupDB()
-
-	mock.ExpectQuery(`SELECT owner_id FROM files WHERE id = \$1`).
-		WithArgs("F4").
-		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow("U4"))
-
-	mock.ExpectQuery(`SELECT newfile_id FROM shared_files_view`).
-		WithArgs("U4", "R4", "F4").
-		WillReturnRows(sqlmock.NewRows([]string{"newfile_id"}).AddRow("NEWFILE123"))
-
-	mock.ExpectExec(`UPDATE shared_files_view .* revoked = TRUE`).
-		WithArgs("U4", "R4", "F4").
-		WillReturnResult(sqlmock.NewResult(0, 1))
-
-	mock.ExpectExec(`INSERT INTO access_logs .*`).
-		WithArgs("F4", "U4", "revoked_view", sqlmock.AnyArg(), true).
-		WillReturnResult(sqlmock.NewResult(0, 1))
+	ctx := context.Background()
+	srv, st, _ := newMemoryServer(t)
+	addViewFile(t, st, "F4", "U4")
+	addViewFile(t, st, "NEWFILE123", "R4")
+	addViewShare(t, st, store.ViewShare{SenderID: "U4", RecipientID: "R4", FileID: "F4", NewFileID: "NEWFILE123"})
 
 	req := jsonReq(t, "/revoke", map[string]string{
 		"fileId":      "F4",
@@ -272,26 +272,43 @@ func TestRevokeViewAccessHandler_Success(t *testing.T) {
 		"recipientId": "R4",
 	})
 	rr := httptest.NewRecorder()
-	fh.RevokeViewAccessHandler(rr, req)
-	require.Equal(t, http.StatusOK, rr.Code)
-	require.NoError(t, mock.ExpectationsWereMet())
+	srv.RevokeViewAccessHandler(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	_, err := st.ActiveViewShare(ctx, "U4", "R4", "F4")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	_, err = st.File(ctx, "NEWFILE123")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	_, err = st.File(ctx, "F4")
+	assert.NoError(t, err)
+
+	logs, err := st.ListViewAccessLogs(ctx, "F4", "U4")
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.Equal(t, "revoked_view", logs[0].Action)
 }
 
-func TestRevokeViewAccessHandler_NoActiveShare(t *testing.T) {
-	mock, cleanupDB := setDB(t)
-	defer cleanupDB()
+func TestRevokeViewAccessHandler_KeepsSharedFile(t *testing.T) {
+	ctx := context.Background()
+	srv, st, _ := newMemoryServer(t)
+	addViewFile(t, st, "F4", "U4")
+	addViewShare(t, st, store.ViewShare{SenderID: "U4", RecipientID: "R4", FileID: "F4", NewFileID: "F4"})
 
-	mock.ExpectQuery(`SELECT owner_id FROM files WHERE id = \$1`).
-		WithArgs("F5").
-		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow("U5"))
+	rr := httptest.NewRecorder()
+	srv.RevokeViewAccessHandler(rr, jsonReq(t, "/revoke", map[string]string{
+		"fileId":      "F4",
+		"userId":      "U4",
+		"recipientId": "R4",
+	}))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
 
-	mock.ExpectQuery(`SELECT newfile_id FROM shared_files_view`).
-		WithArgs("U5", "R5", "F5").
-		WillReturnError(sql.ErrNoRows)
+	_, err := st.File(ctx, "F4")
+	assert.NoError(t, err)
+}
 
-	mock.ExpectExec(`UPDATE shared_files_view .* revoked = TRUE`).
-		WithArgs("U5", "R5", "F5").
-		WillReturnResult(sqlmock.NewResult(0, 0))
+func TestRevokeViewAccessHandler_NoActiveShare(t *testing.T) {
+	srv, st, _ := newMemoryServer(t)
+	addViewFile(t, st, "F5", "U5")
 
 	req := jsonReq(t, "/revoke", map[string]string{
 		"fileId":      "F5",
@@ -299,158 +316,167 @@ func TestRevokeViewAccessHandler_NoActiveShare(t *testing.T) {
 		"recipientId": "R5",
 	})
 	rr := httptest.NewRecorder()
-	fh.RevokeViewAccessHandler(rr, req)
+	srv.RevokeViewAccessHandler(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
 }
 
 func TestGetSharedViewFilesHandler_Success(t *testing.T) {
-	mock, cleanupDB := setDB(t)
-	defer cleanupDB()
-
-	now := time.Now()
-	rows := sqlmock.NewRows([]string{
-		"id", "sender_id", "file_id", "newfile_id", "metadata", "shared_at", "expires_at",
-		"file_name", "file_type", "file_size", "description",
-	}).AddRow(
-		"S1", "U6", "F6", "NEW123", `{"x":1}`, now, now.Add(24*time.Hour),
-		"name.pdf", "application/pdf", int64(1234), "desc",
-	)
-
-	mock.ExpectQuery(`SELECT .* FROM shared_files_view .* JOIN files .*`).
-		WithArgs("U6").
-		WillReturnRows(rows)
+	srv, st, _ := newMemoryServer(t)
+	_, err := st.AddFile(context.Background(), store.File{
+		ID: "F6", OwnerID: "U6", FileName: "name.pdf", FileType: "application/pdf", FileSize: 1234, Description: "desc",
+	})
+	require.NoError(t, err)
+	expires := time.Now().Add(24 * time.Hour)
+	addViewShare(t, st, store.ViewShare{
+		ID: "S1", SenderID: "U6", RecipientID: "R6", FileID: "F6", NewFileID: "F6", Metadata: `{"x":1}`, ExpiresAt: &expires,
+	})
 
 	req := jsonReq(t, "/list", map[string]string{"userId": "U6"})
 	rr := httptest.NewRecorder()
-	fh.GetSharedViewFilesHandler(rr, req)
-	require.Equal(t, http.StatusOK, rr.Code)
+	srv.GetSharedViewFilesHandler(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
 
 	var out []map[string]any
 	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &out))
 	require.Len(t, out, 1)
 	assert.Equal(t, "S1", out[0]["share_id"])
 	assert.Equal(t, "name.pdf", out[0]["file_name"])
-
-	require.NoError(t, mock.ExpectationsWereMet())
+	assert.EqualValues(t, 1234, out[0]["file_size"])
+	assert.NotNil(t, out[0]["expires_at"])
 }
 
 func TestGetViewFileAccessLogs_Success(t *testing.T) {
-	mock, cleanupDB := setDB(t)
-	defer cleanupDB()
-
-	now := time.Now()
-	rows := sqlmock.NewRows([]string{"id", "action", "message", "timestamp"}).
-		AddRow("L1", "viewed", "ok", now).
-		AddRow("L2", "shared_view", "done", now.Add(-time.Minute))
-
-	mock.ExpectQuery(`SELECT id, action, message, timestamp FROM access_logs .*`).
-		WithArgs("F7", "U7").
-		WillReturnRows(rows)
+	ctx := context.Background()
+	srv, st, _ := newMemoryServer(t)
+	now := time.Now().UTC()
+	require.NoError(t, st.AddAccessLog(ctx, store.AccessLog{
+		ID: "L1", FileID: "F7", UserID: "U7", Action: "viewed", Message: "ok", ViewOnly: true,
+		Timestamp: now.Format(time.RFC3339Nano),
+	}))
+	require.NoError(t, st.AddAccessLog(ctx, store.AccessLog{
+		ID: "L2", FileID: "F7", UserID: "U7", Action: "shared_view", Message: "done", ViewOnly: true,
+		Timestamp: now.Add(-time.Minute).Format(time.RFC3339Nano),
+	}))
+	require.NoError(t, st.AddAccessLog(ctx, store.AccessLog{
+		ID: "L3", FileID: "F7", UserID: "U7", Action: "downloaded", Message: "not view-only",
+	}))
 
 	req := jsonReq(t, "/logs", map[string]string{"fileId": "F7", "userId": "U7"})
 	rr := httptest.NewRecorder()
-	fh.GetViewFileAccessLogs(rr, req)
+	srv.GetViewFileAccessLogs(rr, req)
 	require.Equal(t, http.StatusOK, rr.Code)
 
 	var out []map[string]any
 	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &out))
 	require.Len(t, out, 2)
 	assert.Equal(t, "L1", out[0]["id"])
+	assert.Equal(t, "L2", out[1]["id"])
+}
 
-	require.NoError(t, mock.ExpectationsWereMet())
+// addViewCopy stores S8's view-only copy of F8 for U8 and shares it.
+func addViewCopy(t *testing.T, st *store.Memory, stub *webdavStub, expires time.Time) string {
+	t.Helper()
+	addViewFile(t, st, "F8", "S8")
+	require.NoError(t, st.RecordBlobHash(context.Background(), store.BlobHash{
+		Path: "files/S8/shared_view/F8_U8", FileID: "F8", SHA256: sha256Hex("CONTENTS"), Size: 8,
+	}))
+	stub.readMap["files/S8/shared_view/F8_U8"] = "CONTENTS"
+	return addViewShare(t, st, store.ViewShare{
+		SenderID: "S8", RecipientID: "U8", FileID: "F8", NewFileID: "F8", Metadata: `{}`, ExpiresAt: &expires,
+	})
 }
 
 func TestDownloadViewFileHandler_Success(t *testing.T) {
-	mock, cleanupDB := setDB(t)
-	defer cleanupDB()
-
-	exp := time.Now().Add(1 * time.Hour)
-	mock.ExpectQuery(`SELECT id, sender_id, metadata, revoked, expires_at FROM shared_files_view .*`).
-		WithArgs("U8", "F8").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "sender_id", "metadata", "revoked", "expires_at"}).
-			AddRow("SH1", "S8", `{}`, false, exp))
-
-	mock.ExpectExec(`INSERT INTO access_logs .*`).
-		WithArgs("F8", "U8", "viewed", sqlmock.AnyArg(), true).
-		WillReturnResult(sqlmock.NewResult(0, 1))
-
 	stub := newWebdavStub()
-	stub.readMap["files/S8/shared_view/F8_U8"] = "CONTENTS"
-	defer setOC(t, stub)()
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
+	shareID := addViewCopy(t, st, stub, time.Now().Add(time.Hour))
 
 	req := jsonReq(t, "/download", map[string]string{"userId": "U8", "fileId": "F8"})
 	rr := httptest.NewRecorder()
-	fh.DownloadViewFileHandler(rr, req)
+	srv.DownloadViewFileHandler(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code)
 	assert.Equal(t, "application/octet-stream", rr.Header().Get("Content-Type"))
 	assert.Equal(t, "true", rr.Header().Get("X-View-Only"))
 	assert.Equal(t, "F8", rr.Header().Get("X-File-Id"))
-	assert.Equal(t, "SH1", rr.Header().Get("X-Share-Id"))
+	assert.Equal(t, shareID, rr.Header().Get("X-Share-Id"))
 	assert.Equal(t, "CONTENTS", rr.Body.String())
+	assert.Equal(t, fh.IntegrityVerified, rr.Result().Trailer.Get(fh.TrailerIntegrity))
 
-	require.NoError(t, mock.ExpectationsWereMet())
+	logs, err := st.ListViewAccessLogs(context.Background(), "F8", "U8")
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.Equal(t, "viewed", logs[0].Action)
 }
 
-func TestDownloadViewFileHandler_Expired(t *testing.T) {
-	mock, cleanupDB := setDB(t)
-	defer cleanupDB()
+func TestDownloadViewFileHandler_Range(t *testing.T) {
+	stub := newWebdavStub()
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
+	shareID := addViewCopy(t, st, stub, time.Now().Add(time.Hour))
 
-	mock.ExpectQuery(`SELECT id, sender_id, metadata, revoked, expires_at FROM shared_files_view .*`).
-		WithArgs("U9", "F9").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "sender_id", "metadata", "revoked", "expires_at"}).
-			AddRow("SHX", "SX", `{}`, false, time.Now().Add(-1*time.Hour)))
+	req := jsonReq(t, "/download", map[string]string{"userId": "U8", "fileId": "F8"})
+	req.Header.Set("Range", "bytes=3-5")
+	rr := httptest.NewRecorder()
+	srv.DownloadViewFileHandler(rr, req)
 
-	req := jsonReq(t, "/download", map[string]string{"userId": "U9", "fileId": "F9"})
+	require.Equal(t, http.StatusPartialContent, rr.Code)
+	assert.Equal(t, "TEN", rr.Body.String())
+	assert.Equal(t, "bytes 3-5/8", rr.Header().Get("Content-Range"))
+	assert.Equal(t, shareID, rr.Header().Get("X-Share-Id"))
+}
+
+func TestDownloadViewFileHandler_Expired(t *testing.T) {
+	stub := newWebdavStub()
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
+	addViewCopy(t, st, stub, time.Now().Add(-time.Hour))
+
+	req := jsonReq(t, "/download", map[string]string{"userId": "U8", "fileId": "F8"})
 	rr := httptest.NewRecorder()
-	fh.DownloadViewFileHandler(rr, req)
+	srv.DownloadViewFileHandler(rr, req)
 	require.Equal(t, http.StatusForbidden, rr.Code)
 
-	require.NoError(t, mock.ExpectationsWereMet())
+	logs, err := st.ListViewAccessLogs(context.Background(), "F8", "U8")
+	require.NoError(t, err)
+	assert.Empty(t, logs)
 }
 
 func TestSendByViewHandler_ParseMultipartError(t *testing.T) {
-	_, cleanupDB := setDB(t)
-	defer cleanupDB()
+	srv, _, _ := newMemoryServer(t)
 	req := httptest.NewRequest(http.MethodPost, "/sendByView", strings.NewReader(`{"not":"multipart"}`))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
-	fh.SendByViewHandler(rr, req)
+	srv.SendByViewHandler(rr, req)
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Invalid multipart form")
 }
 
 func TestSendByViewHandler_InvalidChunkIndex(t *testing.T) {
-	_, cleanupDB := setDB(t)
-	defer cleanupDB()
+	srv, _, _ := newMemoryServer(t)
 	req := mpReq(t, "/sendByView", map[string]string{
 		"fileid": "F0", "userId": "U0", "recipientUserId": "R0",
 		"metadata": "{}", "chunkIndex": "bad", "totalChunks": "2",
 	}, "", "", nil)
 	rr := httptest.NewRecorder()
-	fh.SendByViewHandler(rr, req)
+	srv.SendByViewHandler(rr, req)
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Invalid chunkIndex")
 }
 
 func TestSendByViewHandler_InvalidTotalChunks(t *testing.T) {
-	_, cleanupDB := setDB(t)
-	defer cleanupDB()
+	srv, _, _ := newMemoryServer(t)
 	req := mpReq(t, "/sendByView", map[string]string{
 		"fileid": "F0", "userId": "U0", "recipientUserId": "R0",
 		"metadata": "{}", "chunkIndex": "0", "totalChunks": "bad",
 	}, "", "", nil)
 	rr := httptest.NewRecorder()
-	fh.SendByViewHandler(rr, req)
+	srv.SendByViewHandler(rr, req)
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Invalid totalChunks")
 }
 
 func TestSendByViewHandler_FileNotFound(t *testing.T) {
-	mock, cleanupDB := setDB(t)
-	defer cleanupDB()
-	mock.ExpectQuery(`SELECT owner_id FROM files WHERE id = \$1`).
-		WithArgs("F404").WillReturnError(sql.ErrNoRows)
+	srv, _, _ := newMemoryServer(t)
 
 	req := mpReq(t, "/sendByView", map[string]string{
 		"fileid": "F404", "userId": "U", "recipientUserId": "R", "metadata": "{}",
@@ -458,16 +484,13 @@ func TestSendByViewHandler_FileNotFound(t *testing.T) {
 	}, "", "", nil)
 
 	rr := httptest.NewRecorder()
-	fh.SendByViewHandler(rr, req)
+	srv.SendByViewHandler(rr, req)
 	require.Equal(t, http.StatusNotFound, rr.Code)
-	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestSendByViewHandler_DBErrorOnOwnerLookup(t *testing.T) {
-	mock, cleanupDB := setDB(t)
-	defer cleanupDB()
-	mock.ExpectQuery(`SELECT owner_id FROM files WHERE id = \$1`).
-		WithArgs("FERR").WillReturnError(sql.ErrConnDone)
+	srv, st, _ := newMemoryServer(t)
+	srv.SetStore(ownerLookupFails{st})
 
 	req := mpReq(t, "/sendByView", map[string]string{
 		"fileid": "FERR", "userId": "U", "recipientUserId": "R", "metadata": "{}",
@@ -475,19 +498,14 @@ func TestSendByViewHandler_DBErrorOnOwnerLookup(t *testing.T) {
 	}, "", "", nil)
 
 	rr := httptest.NewRecorder()
-	fh.SendByViewHandler(rr, req)
+	srv.SendByViewHandler(rr, req)
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
-	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestSendByViewHandler_MissingEncryptedFile(t *testing.T) {
-	mock, cleanupDB := setDB(t)
-	defer cleanupDB()
-	mock.ExpectQuery(`SELECT owner_id FROM files WHERE id = \$1`).
-		WithArgs("F10").WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow("U10"))
-
 	stub := newWebdavStub()
-	defer setOC(t, stub)()
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
+	addViewFile(t, st, "F10", "U10")
 
 	req := mpReq(t, "/sendByView", map[string]string{
 		"fileid": "F10", "userId": "U10", "recipientUserId": "R10", "metadata": "{}",
@@ -495,21 +513,16 @@ func TestSendByViewHandler_MissingEncryptedFile(t *testing.T) {
 	}, "", "", nil)
 
 	rr := httptest.NewRecorder()
-	fh.SendByViewHandler(rr, req)
+	srv.SendByViewHandler(rr, req)
 	require.Equal(t, http.StatusBadRequest, rr.Code)
-	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestSendByViewHandler_TempUploadFails(t *testing.T) {
-	mock, cleanupDB := setDB(t)
-	defer cleanupDB()
-	mock.ExpectQuery(`SELECT owner_id FROM files WHERE id = \$1`).
-		WithArgs("F11").WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow("U11"))
-
 	stub := newWebdavStub()
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
+	addViewFile(t, st, "F11", "U11")
 
 	stub.writeErr["temp/F11_chunk_0"] = errors.New("temp write failed")
-	defer setOC(t, stub)()
 
 	req := mpReq(t, "/sendByView", map[string]string{
 		"fileid": "F11", "userId": "U11", "recipientUserId": "R11", "metadata": "{}",
@@ -517,19 +530,17 @@ func TestSendByViewHandler_TempUploadFails(t *testing.T) {
 	}, "encryptedFile", "c0.bin", []byte("AAA"))
 
 	rr := httptest.NewRecorder()
-	fh.SendByViewHandler(rr, req)
+	srv.SendByViewHandler(rr, req)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 }
 
 func TestSendByViewHandler_FinalUploadFails(t *testing.T) {
-	mock, cleanupDB := setDB(t)
-	defer cleanupDB()
-	mock.ExpectQuery(`SELECT owner_id FROM files WHERE id = \$1`).
-		WithArgs("F12").WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow("U12"))
-
 	stub := newWebdavStub()
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
+	addViewFile(t, st, "F12", "U12")
+
 	stub.readMap["temp/F12_chunk_0"] = "111"
 	stub.writeErr["files/U12/shared_view/F12_R12"] = errors.New("final write failed")
-	defer setOC(t, stub)()
 
 	req := mpReq(t, "/sendByView", map[string]string{
 		"fileid": "F12", "userId": "U12", "recipientUserId": "R12", "metadata": "{}",
@@ -537,32 +548,23 @@ func TestSendByViewHandler_FinalUploadFails(t *testing.T) {
 	}, "encryptedFile", "c1.bin", []byte("222"))
 
 	rr := httptest.NewRecorder()
-	fh.SendByViewHandler(rr, req)
+	srv.SendByViewHandler(rr, req)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	_, err := st.ActiveViewShare(context.Background(), "U12", "R12", "F12")
+	assert.ErrorIs(t, err, store.ErrNotFound)
 }
 
 func TestSendByViewHandler_ExistingShareUpdated(t *testing.T) {
-	mock, cleanupDB := setDB(t)
-	defer cleanupDB()
-	mock.ExpectQuery(`SELECT owner_id FROM files WHERE id = \$1`).
-		WithArgs("F13").WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow("U13"))
-
+	ctx := context.Background()
 	stub := newWebdavStub()
-	stub.readMap["temp/F13_chunk_0"] = "111"
-	defer setOC(t, stub)()
-
-	mock.ExpectQuery(`SELECT id FROM shared_files_view .* revoked = FALSE`).
-		WithArgs("U13", "R13", "F13").
-		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("EXIST-1"))
-
-	mock.ExpectExec(`UPDATE shared_files_view .* SET metadata = \$1, shared_at = CURRENT_TIMESTAMP, expires_at = \$2 WHERE id = \$3`).
-		WithArgs(`{"k":1}`, sqlmock.AnyArg(), "EXIST-1").
-		WillReturnResult(sqlmock.NewResult(0, 1))
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
+	addViewFile(t, st, "F13", "U13")
+	addViewShare(t, st, store.ViewShare{
+		ID: "EXIST-1", SenderID: "U13", RecipientID: "R13", FileID: "F13", NewFileID: "F13", Metadata: `{}`,
+	})
 
-	mock.ExpectExec(`UPDATE files SET allow_view_sharing = TRUE WHERE id = \$1`).
-		WithArgs("F13").WillReturnResult(sqlmock.NewResult(0, 1))
-	mock.ExpectExec(`INSERT INTO access_logs .*`).
-		WithArgs("F13", "U13", "shared_view", sqlmock.AnyArg(), true).
-		WillReturnResult(sqlmock.NewResult(0, 1))
+	stub.readMap["temp/F13_chunk_0"] = "111"
 
 	req := mpReq(t, "/sendByView", map[string]string{
 		"fileid": "F13", "userId": "U13", "recipientUserId": "R13", "metadata": `{"k":1}`,
@@ -570,26 +572,29 @@ func TestSendByViewHandler_ExistingShareUpdated(t *testing.T) {
 	}, "encryptedFile", "c1.bin", []byte("222"))
 
 	rr := httptest.NewRecorder()
-	fh.SendByViewHandler(rr, req)
+	srv.SendByViewHandler(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var resp map[string]string
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, "EXIST-1", resp["shareId"])
+
+	share, err := st.ActiveViewShare(ctx, "U13", "R13", "F13")
+	require.NoError(t, err)
+	assert.Equal(t, "EXIST-1", share.ID)
+	assert.Equal(t, `{"k":1}`, share.Metadata)
 }
 
 func TestSendByViewHandler_UpdateExistingShare_DBError(t *testing.T) {
-	mock, cleanupDB := setDB(t)
-	defer cleanupDB()
-	mock.ExpectQuery(`SELECT owner_id FROM files WHERE id = \$1`).
-		WithArgs("F14").WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow("U14"))
-
 	stub := newWebdavStub()
-	stub.readMap["temp/F14_chunk_0"] = "111"
-	defer setOC(t, stub)()
-
-	mock.ExpectQuery(`SELECT id FROM shared_files_view .* revoked = FALSE`).
-		WithArgs("U14", "R14", "F14").
-		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("EXIST-2"))
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
+	addViewFile(t, st, "F14", "U14")
+	addViewShare(t, st, store.ViewShare{
+		ID: "EXIST-2", SenderID: "U14", RecipientID: "R14", FileID: "F14", NewFileID: "F14", Metadata: `{}`,
+	})
+	srv.SetStore(viewShareWritesFail{st})
 
-	mock.ExpectExec(`UPDATE shared_files_view .* SET metadata = \$1`).
-		WithArgs(`{"m":true}`, sqlmock.AnyArg(), "EXIST-2").
-		WillReturnError(sql.ErrConnDone)
+	stub.readMap["temp/F14_chunk_0"] = "111"
 
 	req := mpReq(t, "/sendByView", map[string]string{
 		"fileid": "F14", "userId": "U14", "recipientUserId": "R14", "metadata": `{"m":true}`,
@@ -597,26 +602,18 @@ func TestSendByViewHandler_UpdateExistingShare_DBError(t *testing.T) {
 	}, "encryptedFile", "c1.bin", []byte("x"))
 
 	rr := httptest.NewRecorder()
-	fh.SendByViewHandler(rr, req)
+	srv.SendByViewHandler(rr, req)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Failed to update shared file")
 }
 
 func TestSendByViewHandler_InsertShare_DBError(t *testing.T) {
-	mock, cleanupDB := setDB(t)
-	defer cleanupDB()
-	mock.ExpectQuery(`SELECT owner_id FROM files WHERE id = \$1`).
-		WithArgs("F15").WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow("U15"))
-
 	stub := newWebdavStub()
-	stub.readMap["temp/F15_chunk_0"] = "111"
-	defer setOC(t, stub)()
-
-	mock.ExpectQuery(`SELECT id FROM shared_files_view .* revoked = FALSE`).
-		WithArgs("U15", "R15", "F15").
-		WillReturnError(sql.ErrNoRows)
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
+	addViewFile(t, st, "F15", "U15")
+	srv.SetStore(viewShareWritesFail{st})
 
-	mock.ExpectQuery(`INSERT INTO shared_files_view .* RETURNING id`).
-		WithArgs("U15", "R15", "F15", sqlmock.AnyArg(), `{"a":1}`, sqlmock.AnyArg()).
-		WillReturnError(sql.ErrConnDone)
+	stub.readMap["temp/F15_chunk_0"] = "111"
 
 	req := mpReq(t, "/sendByView", map[string]string{
 		"fileid": "F15", "userId": "U15", "recipientUserId": "R15", "metadata": `{"a":1}`,
@@ -624,5 +621,7 @@ func TestSendByViewHandler_InsertShare_DBError(t *testing.T) {
 	}, "encryptedFile", "c1.bin", []byte("x"))
 
 	rr := httptest.NewRecorder()
-	fh.SendByViewHandler(rr, req)
+	srv.SendByViewHandler(rr, req)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Failed to track shared file")
 }
@@ -2,7 +2,6 @@ package unitTests
 
 import (
 	"bytes"
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"io"
@@ -14,85 +13,41 @@ import (
 	"time"
 
 	fh "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metadata"
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/storage"
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-type mockOwnCloud struct {
-	uploadStreamErr   error
-	downloadStreamErr error
-	deleteErr         error
-	downloadReaders   map[string]io.ReadCloser
+// brokenBackend fails the writes or the reads of the store it wraps.
+type brokenBackend struct {
+	storage.Backend
+	writeErr, readErr error
 }
 
-type mockMetadata struct {
-	insertReceivedErr error
-	insertSentErr     error
-	receivedID        string
-}
-
-var (
-	owncloudMock *mockOwnCloud
-	metadataMock *mockMetadata
-)
-
-func init() {
-	owncloud.UploadFileStream = func(path, filename string, reader io.Reader) error {
-		if owncloudMock != nil {
-			return owncloudMock.uploadStreamErr
-		}
-		return nil
-	}
-
-	owncloud.DownloadFileStreamTemp = func(path string) (io.ReadCloser, error) {
-		if owncloudMock != nil {
-			if owncloudMock.downloadStreamErr != nil {
-				return nil, owncloudMock.downloadStreamErr
-			}
-			if reader, ok := owncloudMock.downloadReaders[path]; ok {
-				return reader, nil
-			}
-			return io.NopCloser(strings.NewReader("chunk data")), nil
-		}
-		return io.NopCloser(strings.NewReader("chunk data")), nil
-	}
-
-	owncloud.DeleteFileTemp = func(path string) error {
-		if owncloudMock != nil {
-			return owncloudMock.deleteErr
-		}
-		return nil
-	}
-
-	metadata.InsertReceivedFile = func(db *sql.DB, recipientID, senderID, fileID, metadataJSON string, expiresAt time.Time) (string, error) {
-		if metadataMock != nil {
-			return metadataMock.receivedID, metadataMock.insertReceivedErr
-		}
-		return "received-123", nil
-	}
-
-	metadata.InsertSentFile = func(db *sql.DB, senderID, recipientID, fileID, metadataJSON string) error {
-		if metadataMock != nil {
-			return metadataMock.insertSentErr
-		}
-		return nil
+func (b brokenBackend) WriteStream(path string, src io.Reader) error {
+	if b.writeErr != nil {
+		return b.writeErr
 	}
+	return b.Backend.WriteStream(path, src)
 }
 
-func setupSendFileMocks() {
-	owncloudMock = &mockOwnCloud{
-		downloadReaders: make(map[string]io.ReadCloser),
-	}
-	metadataMock = &mockMetadata{
-		receivedID: "received-123",
+func (b brokenBackend) ReadStream(path string) (io.ReadCloser, error) {
+	if b.readErr != nil {
+		return nil, b.readErr
 	}
+	return b.Backend.ReadStream(path)
 }
 
-func resetSendFileMocks() {
-	owncloudMock = nil
-	metadataMock = nil
+// expectReceivedFile expects a received_files row for a file sent to
+// recipientID, stored with the given expiry, and answers with receivedID.
+func expectReceivedFile(mock sqlmock.Sqlmock, recipientID, fileID string, expiresAt any, receivedID string) {
+	mock.ExpectQuery(`SELECT EXISTS \(.*users.*\)`).
+		WithArgs(recipientID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`INSERT INTO received_files .* RETURNING id`).
+		WithArgs(nil, recipientID, sqlmock.AnyArg(), fileID, sqlmock.AnyArg(), false, expiresAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(receivedID))
 }
 
 func newSendFileMultipart(t *testing.T, fields map[string]string, fileContent []byte, includeFile bool) *http.Request {
@@ -118,10 +73,8 @@ func newSendFileMultipart(t *testing.T, fields map[string]string, fileContent []
 }
 
 func TestSendFileHandler_Success_NonLastChunk(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
+	srv, mock, cleanup := SetupMockDB(t)
 	defer cleanup()
-	setupSendFileMocks()
-	defer resetSendFileMocks()
 
 	fields := map[string]string{
 		"fileid":          "file-123",
@@ -135,7 +88,7 @@ func TestSendFileHandler_Success_NonLastChunk(t *testing.T) {
 	req := newSendFileMultipart(t, fields, []byte("chunk data"), true)
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
 
@@ -148,26 +101,32 @@ func TestSendFileHandler_Success_NonLastChunk(t *testing.T) {
 }
 
 func TestSendFileHandler_Success_LastChunk(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
-	defer cleanup()
-	setupSendFileMocks()
-	defer resetSendFileMocks()
-	owncloudMock.downloadReaders["temp/file-123_chunk_0"] = io.NopCloser(strings.NewReader("chunk0"))
-	owncloudMock.downloadReaders["temp/file-123_chunk_1"] = io.NopCloser(strings.NewReader("chunk1"))
+	srv, mock, b := useLocalBackend(t)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	srv.SetClock(func() time.Time { return now })
+	require.NoError(t, b.WriteStream("temp/file-123_chunk_0", strings.NewReader("chunk0")))
 
 	fields := map[string]string{
 		"fileid":          "file-123",
 		"userId":          "user-1",
 		"recipientUserId": "user-2",
-		"metadata":        `{"name":"test.txt","size":100}`,
+		"metadata":        `{"encryptedAesKey":"aes","ekPublicKey":"ek"}`,
 		"chunkIndex":      "1",
 		"totalChunks":     "2",
 	}
 
+	mock.ExpectExec(`INSERT INTO blob_hashes`).
+		WithArgs("files/user-1/sent/file-123", "file-123", sqlmock.AnyArg(), int64(16)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectReceivedFile(mock, "user-2", "file-123", now.Add(fh.DefaultConfig.Shares.Default), "received-123")
+	mock.ExpectQuery(`INSERT INTO sent_files .* RETURNING id`).
+		WithArgs(nil, "user-1", "user-2", "file-123", "aes", "ek").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("sent-123"))
+
 	req := newSendFileMultipart(t, fields, []byte("chunk data"), true)
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
 
@@ -175,29 +134,103 @@ func TestSendFileHandler_Success_LastChunk(t *testing.T) {
 	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
 	assert.Equal(t, "File sent successfully", resp["message"])
 	assert.Equal(t, "received-123", resp["receivedFileID"])
+	assert.Equal(t, "chunk0chunk data", readBlob(t, b, "files/user-1/sent/file-123"))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSendFileHandler_NeverExpires(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	fields := map[string]string{
+		"fileid":          "file-123",
+		"userId":          "user-1",
+		"recipientUserId": "user-2",
+		"metadata":        `{}`,
+		"chunkIndex":      "0",
+		"totalChunks":     "1",
+		"expiresIn":       "never",
+	}
+	mock.ExpectExec(`INSERT INTO blob_hashes`).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectReceivedFile(mock, "user-2", "file-123", nil, "received-123")
+
+	rr := httptest.NewRecorder()
+	srv.SendFileHandler(rr, newSendFileMultipart(t, fields, []byte("chunk data"), true))
 
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestSendFileHandler_InvalidExpiry(t *testing.T) {
+	b, _ := newLocalBackend(t)
+	shares := fh.DefaultConfig.Shares
+	shares.AllowNever = false
+	srv, _ := newServer(t, b, fh.Config{Shares: shares})
+
+	for expiry, want := range map[string]string{
+		"9999h": "expiry may be at most",
+		"-1h":   "expiry must be in the future",
+		"soon":  "expiresIn must be a duration",
+		"never": "shares must expire",
+	} {
+		fields := map[string]string{
+			"fileid":          "file-123",
+			"userId":          "user-1",
+			"recipientUserId": "user-2",
+			"metadata":        `{}`,
+			"chunkIndex":      "0",
+			"totalChunks":     "1",
+			"expiresIn":       expiry,
+		}
+		rr := httptest.NewRecorder()
+		srv.SendFileHandler(rr, newSendFileMultipart(t, fields, []byte("chunk data"), true))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code, expiry)
+		assert.Contains(t, rr.Body.String(), want, expiry)
+	}
+}
+
+func TestSendFileHandler_PartialPolicyKeepsLimits(t *testing.T) {
+	b, _ := newLocalBackend(t)
+	srv, _ := newServer(t, b, fh.Config{Shares: fh.SharePolicy{Max: 72 * time.Hour}})
+
+	for expiry, want := range map[string]string{
+		"100h":  "expiry may be at most",
+		"never": "shares must expire",
+	} {
+		fields := map[string]string{
+			"fileid":          "file-123",
+			"userId":          "user-1",
+			"recipientUserId": "user-2",
+			"metadata":        `{}`,
+			"chunkIndex":      "0",
+			"totalChunks":     "1",
+			"expiresIn":       expiry,
+		}
+		rr := httptest.NewRecorder()
+		srv.SendFileHandler(rr, newSendFileMultipart(t, fields, []byte("chunk data"), true))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code, expiry)
+		assert.Contains(t, rr.Body.String(), want, expiry)
+	}
+}
+
 func TestSendFileHandler_ParseMultipartFail(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, _, cleanup := SetupMockDB(t)
 	defer cleanup()
-	setupSendFileMocks()
-	defer resetSendFileMocks()
 
 	req := httptest.NewRequest(http.MethodPost, "/sendfile", strings.NewReader("not multipart"))
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Invalid multipart form")
 }
 
 func TestSendFileHandler_MissingFileID(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, _, cleanup := SetupMockDB(t)
 	defer cleanup()
-	setupSendFileMocks()
-	defer resetSendFileMocks()
 
 	fields := map[string]string{
 		"fileid":          "",
@@ -211,16 +244,14 @@ func TestSendFileHandler_MissingFileID(t *testing.T) {
 	req := newSendFileMultipart(t, fields, []byte("data"), true)
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Missing required form fields")
 }
 
 func TestSendFileHandler_MissingUserID(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, _, cleanup := SetupMockDB(t)
 	defer cleanup()
-	setupSendFileMocks()
-	defer resetSendFileMocks()
 
 	fields := map[string]string{
 		"fileid":          "file-123",
@@ -234,16 +265,14 @@ func TestSendFileHandler_MissingUserID(t *testing.T) {
 	req := newSendFileMultipart(t, fields, []byte("data"), true)
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Missing required form fields")
 }
 
 func TestSendFileHandler_MissingRecipientID(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, _, cleanup := SetupMockDB(t)
 	defer cleanup()
-	setupSendFileMocks()
-	defer resetSendFileMocks()
 
 	fields := map[string]string{
 		"fileid":          "file-123",
@@ -257,16 +286,14 @@ func TestSendFileHandler_MissingRecipientID(t *testing.T) {
 	req := newSendFileMultipart(t, fields, []byte("data"), true)
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Missing required form fields")
 }
 
 func TestSendFileHandler_MissingMetadata(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, _, cleanup := SetupMockDB(t)
 	defer cleanup()
-	setupSendFileMocks()
-	defer resetSendFileMocks()
 
 	fields := map[string]string{
 		"fileid":          "file-123",
@@ -280,16 +307,14 @@ func TestSendFileHandler_MissingMetadata(t *testing.T) {
 	req := newSendFileMultipart(t, fields, []byte("data"), true)
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Missing required form fields")
 }
 
 func TestSendFileHandler_InvalidChunkIndex(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, _, cleanup := SetupMockDB(t)
 	defer cleanup()
-	setupSendFileMocks()
-	defer resetSendFileMocks()
 
 	fields := map[string]string{
 		"fileid":          "file-123",
@@ -303,16 +328,14 @@ func TestSendFileHandler_InvalidChunkIndex(t *testing.T) {
 	req := newSendFileMultipart(t, fields, []byte("data"), true)
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Invalid chunkIndex")
 }
 
 func TestSendFileHandler_InvalidTotalChunks(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, _, cleanup := SetupMockDB(t)
 	defer cleanup()
-	setupSendFileMocks()
-	defer resetSendFileMocks()
 
 	fields := map[string]string{
 		"fileid":          "file-123",
@@ -326,16 +349,14 @@ func TestSendFileHandler_InvalidTotalChunks(t *testing.T) {
 	req := newSendFileMultipart(t, fields, []byte("data"), true)
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Invalid totalChunks")
 }
 
 func TestSendFileHandler_MissingEncryptedFile(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, _, cleanup := SetupMockDB(t)
 	defer cleanup()
-	setupSendFileMocks()
-	defer resetSendFileMocks()
 
 	fields := map[string]string{
 		"fileid":          "file-123",
@@ -349,18 +370,14 @@ func TestSendFileHandler_MissingEncryptedFile(t *testing.T) {
 	req := newSendFileMultipart(t, fields, nil, false)
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Missing encrypted file chunk")
 }
 
 func TestSendFileHandler_TempChunkUploadFail(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
-	setupSendFileMocks()
-	defer resetSendFileMocks()
-
-	owncloudMock.uploadStreamErr = errors.New("upload failed")
+	b, _ := newLocalBackend(t)
+	srv, _ := newServer(t, brokenBackend{Backend: b, writeErr: errors.New("upload failed")}, fh.Config{})
 
 	fields := map[string]string{
 		"fileid":          "file-123",
@@ -374,18 +391,14 @@ func TestSendFileHandler_TempChunkUploadFail(t *testing.T) {
 	req := newSendFileMultipart(t, fields, []byte("data"), true)
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Chunk upload failed")
 }
 
 func TestSendFileHandler_ChunkDownloadFail(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
-	setupSendFileMocks()
-	defer resetSendFileMocks()
-
-	owncloudMock.downloadStreamErr = errors.New("download failed")
+	b, _ := newLocalBackend(t)
+	srv, mock := newServer(t, brokenBackend{Backend: b, readErr: errors.New("download failed")}, fh.Config{})
 
 	fields := map[string]string{
 		"fileid":          "file-123",
@@ -399,16 +412,20 @@ func TestSendFileHandler_ChunkDownloadFail(t *testing.T) {
 	req := newSendFileMultipart(t, fields, []byte("data"), true)
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Failed to store encrypted file")
+	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestSendFileHandler_InsertReceivedFileFail(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, mock, cleanup := SetupMockDB(t)
 	defer cleanup()
-	setupSendFileMocks()
-	defer resetSendFileMocks()
 
-	metadataMock.insertReceivedErr = errors.New("db insert failed")
+	mock.ExpectExec(`INSERT INTO blob_hashes`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT EXISTS \(.*users.*\)`).
+		WithArgs("user-2").
+		WillReturnError(errors.New("db insert failed"))
 
 	fields := map[string]string{
 		"fileid":          "file-123",
@@ -422,23 +439,24 @@ func TestSendFileHandler_InsertReceivedFileFail(t *testing.T) {
 	req := newSendFileMultipart(t, fields, []byte("data"), true)
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Failed to track received file")
 }
 
 func TestSendFileHandler_InsertSentFileFail_ContinuesExecution(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, mock, cleanup := SetupMockDB(t)
 	defer cleanup()
-	setupSendFileMocks()
-	defer resetSendFileMocks()
-	metadataMock.insertSentErr = errors.New("sent file insert failed")
+
+	mock.ExpectExec(`INSERT INTO blob_hashes`).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectReceivedFile(mock, "user-2", "file-123", sqlmock.AnyArg(), "received-123")
+	mock.ExpectQuery(`INSERT INTO sent_files`).WillReturnError(errors.New("sent file insert failed"))
 
 	fields := map[string]string{
 		"fileid":          "file-123",
 		"userId":          "user-1",
 		"recipientUserId": "user-2",
-		"metadata":        `{"name":"test.txt"}`,
+		"metadata":        `{"encryptedAesKey":"aes","ekPublicKey":"ek"}`,
 		"chunkIndex":      "0",
 		"totalChunks":     "1",
 	}
@@ -446,10 +464,11 @@ func TestSendFileHandler_InsertSentFileFail_ContinuesExecution(t *testing.T) {
 	req := newSendFileMultipart(t, fields, []byte("data"), true)
 	rr := httptest.NewRecorder()
 
-	fh.SendFileHandler(rr, req)
+	srv.SendFileHandler(rr, req)
 	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
 
 	var resp map[string]string
 	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
 	assert.Equal(t, "File sent successfully", resp["message"])
+	require.NoError(t, mock.ExpectationsWereMet())
 }
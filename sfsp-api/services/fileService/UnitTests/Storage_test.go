@@ -0,0 +1,117 @@
+package unitTests
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/storage"
+)
+
+func newLocalBackend(t *testing.T) (*storage.LocalBackend, string) {
+	t.Helper()
+	root := t.TempDir()
+	b, err := storage.NewLocal(root)
+	require.NoError(t, err)
+	return b, root
+}
+
+func TestLocalBackend_WriteReadRemove(t *testing.T) {
+	b, root := newLocalBackend(t)
+
+	require.NoError(t, b.WriteStream("files/u1/sent/f1", strings.NewReader("ciphertext")))
+
+	onDisk, err := os.ReadFile(filepath.Join(root, "files", "u1", "sent", "f1"))
+	require.NoError(t, err)
+	assert.Equal(t, "ciphertext", string(onDisk))
+
+	r, err := b.ReadStream("/files/u1/sent/f1")
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, "ciphertext", string(data))
+
+	require.NoError(t, b.Remove("files/u1/sent/f1"))
+	_, err = b.ReadStream("files/u1/sent/f1")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestLocalBackend_ReadRange(t *testing.T) {
+	b, _ := newLocalBackend(t)
+	require.NoError(t, b.WriteStream("files/f1", strings.NewReader("0123456789")))
+
+	read := func(offset, length int64) string {
+		r, err := storage.ReadRange(b, "files/f1", offset, length)
+		require.NoError(t, err)
+		defer func() { _ = r.Close() }()
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	assert.Equal(t, "345", read(3, 3))
+	assert.Equal(t, "789", read(7, -1))
+	assert.Equal(t, "", read(2, 0))
+}
+
+func TestLocalBackend_OverwriteReplacesContent(t *testing.T) {
+	b, _ := newLocalBackend(t)
+
+	require.NoError(t, b.WriteStream("files/f1", strings.NewReader("old content")))
+	require.NoError(t, b.WriteStream("files/f1", strings.NewReader("new")))
+
+	r, err := b.ReadStream("files/f1")
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	data, _ := io.ReadAll(r)
+	assert.Equal(t, "new", string(data))
+}
+
+func TestLocalBackend_RejectsTraversal(t *testing.T) {
+	b, _ := newLocalBackend(t)
+
+	err := b.WriteStream("../outside", strings.NewReader("x"))
+	assert.ErrorIs(t, err, storage.ErrInvalidPath)
+
+	_, err = b.ReadStream("files/../../etc/passwd")
+	assert.ErrorIs(t, err, storage.ErrInvalidPath)
+}
+
+func TestWebDAVBackend_RejectsTraversal(t *testing.T) {
+	b := storage.NewWebDAVFromClient(newWebdavStub())
+
+	assert.ErrorIs(t, b.WriteStream("../outside", strings.NewReader("x")), storage.ErrInvalidPath)
+	assert.ErrorIs(t, b.MkdirAll("files/../.."), storage.ErrInvalidPath)
+	assert.ErrorIs(t, b.Remove("files/../other"), storage.ErrInvalidPath)
+	_, err := b.ReadStream("files/../../etc/passwd")
+	assert.ErrorIs(t, err, storage.ErrInvalidPath)
+	_, err = b.ReadRange("files/../x", 0, 1)
+	assert.ErrorIs(t, err, storage.ErrInvalidPath)
+}
+
+func TestStorageNew_SelectsDriver(t *testing.T) {
+	b, err := storage.New(storage.Config{Kind: storage.KindLocal, LocalRoot: t.TempDir()})
+	require.NoError(t, err)
+	assert.IsType(t, &storage.LocalBackend{}, b)
+
+	b, err = storage.New(storage.Config{WebDAVURL: "http://owncloud.local/remote.php/webdav"})
+	require.NoError(t, err)
+	assert.IsType(t, &storage.WebDAVBackend{}, b)
+
+	b, err = storage.New(storage.Config{Kind: storage.KindS3, S3: storage.S3Config{Endpoint: "localhost:9000", Bucket: "sfsp"}})
+	require.NoError(t, err)
+	assert.IsType(t, &storage.S3Backend{}, b)
+
+	_, err = storage.New(storage.Config{Kind: "ftp"})
+	assert.Error(t, err)
+
+	_, err = storage.New(storage.Config{Kind: storage.KindS3})
+	assert.Error(t, err)
+}
@@ -0,0 +1,314 @@
+package unitTests
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metadata"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testJWTSecret = []byte("test-secret")
+
+func signHS256(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(testJWTSecret)
+	require.NoError(t, err)
+	return token
+}
+
+func newTestVerifier(t *testing.T) *auth.Verifier {
+	t.Helper()
+	v, err := auth.NewVerifier(auth.Config{Secret: testJWTSecret, PublicPaths: []string{"/health"}})
+	require.NoError(t, err)
+	return v
+}
+
+// withUser marks req as authenticated, as auth.Middleware would.
+func withUser(req *http.Request, userID string) *http.Request {
+	return req.WithContext(auth.WithUser(req.Context(), auth.User{ID: userID}))
+}
+
+// echoUser is a handler that writes the authenticated user ID.
+var echoUser = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "no user", http.StatusTeapot)
+		return
+	}
+	_, _ = w.Write([]byte(user.ID))
+})
+
+func TestMiddleware_Tokens(t *testing.T) {
+	v := newTestVerifier(t)
+	exp := time.Now().Add(time.Hour).Unix()
+
+	otherKey, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"userId": "U1", "exp": exp}).
+		SignedString([]byte("wrong-secret"))
+	require.NoError(t, err)
+
+	cases := []struct {
+		name       string
+		header     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"missing header", "", http.StatusUnauthorized, ""},
+		{"not bearer", "Basic abc", http.StatusUnauthorized, ""},
+		{"garbage", "Bearer not-a-jwt", http.StatusUnauthorized, ""},
+		{"wrong key", "Bearer " + otherKey, http.StatusUnauthorized, ""},
+		{"expired", "Bearer " + signHS256(t, jwt.MapClaims{"userId": "U1", "exp": time.Now().Add(-time.Minute).Unix()}), http.StatusUnauthorized, ""},
+		{"no exp", "Bearer " + signHS256(t, jwt.MapClaims{"userId": "U1"}), http.StatusUnauthorized, ""},
+		{"no user claim", "Bearer " + signHS256(t, jwt.MapClaims{"exp": exp}), http.StatusUnauthorized, ""},
+		{"gateway token", "Bearer " + signHS256(t, jwt.MapClaims{"userId": "U1", "exp": exp}), http.StatusOK, "U1"},
+		{"sub claim", "bearer " + signHS256(t, jwt.MapClaims{"sub": "U2", "exp": exp}), http.StatusOK, "U2"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/download", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			rr := httptest.NewRecorder()
+			v.Middleware(echoUser).ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.wantStatus, rr.Code)
+			if tc.wantStatus == http.StatusUnauthorized {
+				assert.Contains(t, rr.Header().Get("WWW-Authenticate"), "Bearer")
+			} else {
+				assert.Equal(t, tc.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestMiddleware_PublicPathSkipsAuth(t *testing.T) {
+	v := newTestVerifier(t)
+	rr := httptest.NewRecorder()
+	v.Middleware(echoUser).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusTeapot, rr.Code) // reached the handler without a user
+}
+
+func TestMiddleware_PublicPrefixSkipsAuth(t *testing.T) {
+	v, err := auth.NewVerifier(auth.Config{Secret: testJWTSecret, PublicPrefixes: []string{"/api/v1/public/"}})
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	v.Middleware(echoUser).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/public/links/tok/content", nil))
+	assert.Equal(t, http.StatusTeapot, rr.Code)
+
+	rr = httptest.NewRecorder()
+	v.Middleware(echoUser).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/links", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestVerifier_PublicKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	v, err := auth.NewVerifier(auth.Config{PublicKeyPEM: pubPEM, Issuer: "sfsp-api"})
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{"userId": "U1", "iss": "sfsp-api", "exp": time.Now().Add(time.Hour).Unix()}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+	require.NoError(t, err)
+	user, err := v.Verify(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "U1", user.ID)
+
+	claims["iss"] = "someone-else"
+	signed, err = jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+	require.NoError(t, err)
+	_, err = v.Verify(signed)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	// an HMAC token must not be accepted when only a public key is configured
+	_, err = v.Verify(signHS256(t, jwt.MapClaims{"userId": "U1", "exp": time.Now().Add(time.Hour).Unix()}))
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+func TestNewVerifier_RequiresKey(t *testing.T) {
+	_, err := auth.NewVerifier(auth.Config{})
+	assert.ErrorIs(t, err, auth.ErrNoVerificationKey)
+}
+
+func TestResolveUserID(t *testing.T) {
+	req := withUser(httptest.NewRequest(http.MethodPost, "/", nil), "U1")
+
+	rr := httptest.NewRecorder()
+	id, ok := auth.ResolveUserID(rr, req, "")
+	assert.True(t, ok)
+	assert.Equal(t, "U1", id)
+
+	rr = httptest.NewRecorder()
+	_, ok = auth.ResolveUserID(rr, req, "U2")
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// without the middleware the client-supplied ID is kept
+	rr = httptest.NewRecorder()
+	id, ok = auth.ResolveUserID(rr, httptest.NewRequest(http.MethodPost, "/", nil), "U2")
+	assert.True(t, ok)
+	assert.Equal(t, "U2", id)
+}
+
+func TestRequireFileOwner(t *testing.T) {
+	st := store.NewMemory()
+	_, err := st.AddFile(context.Background(), store.File{ID: "F1", OwnerID: "OWNER"})
+	require.NoError(t, err)
+
+	for name, tc := range map[string]struct {
+		user, fileID string
+		ok           bool
+		code         int
+	}{
+		"owner":           {user: "OWNER", fileID: "F1", ok: true, code: http.StatusOK},
+		"intruder":        {user: "INTRUDER", fileID: "F1", code: http.StatusForbidden},
+		"missing":         {user: "OWNER", fileID: "F2", code: http.StatusNotFound},
+		"unauthenticated": {fileID: "F2", ok: true, code: http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		if tc.user != "" {
+			req = withUser(req, tc.user)
+		}
+		rr := httptest.NewRecorder()
+		assert.Equal(t, tc.ok, auth.RequireFileOwner(rr, req, st, tc.fileID), name)
+		assert.Equal(t, tc.code, rr.Code, name)
+	}
+}
+
+func TestAddTagsHandler_NonOwnerForbidden(t *testing.T) {
+	meta, mock, cleanup := SetupMetadataMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT owner_id FROM files WHERE id = \$1`).
+		WithArgs("F1").
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow("OWNER"))
+
+	req := withUser(jsonReq(t, "/addTags", metadata.AddTagsRequest{FileID: "F1", Tags: []string{"x"}}), "INTRUDER")
+	rr := httptest.NewRecorder()
+	meta.AddTagsHandler(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddTagsHandler_OwnerAllowed(t *testing.T) {
+	meta, mock, cleanup := SetupMetadataMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT owner_id FROM files WHERE id = \$1`).
+		WithArgs("F1").
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow("OWNER"))
+	mock.ExpectExec(`UPDATE files`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := withUser(jsonReq(t, "/addTags", metadata.AddTagsRequest{FileID: "F1", Tags: []string{"x"}}), "OWNER")
+	rr := httptest.NewRecorder()
+	meta.AddTagsHandler(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateFilePathHandler_UnknownFile(t *testing.T) {
+	meta, mock, cleanup := SetupMetadataMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT owner_id FROM files WHERE id = \$1`).
+		WithArgs("F404").
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}))
+
+	req := withUser(jsonReq(t, "/updateFilePath", map[string]string{"fileId": "F404", "newPath": "files/x"}), "U1")
+	rr := httptest.NewRecorder()
+	meta.UpdateFilePathHandler(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteFileHandler_SpoofedUserForbidden(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	req := withUser(jsonReq(t, "/deleteFile", map[string]string{"fileId": "F1", "userId": "VICTIM"}), "INTRUDER")
+	rr := httptest.NewRecorder()
+	srv.DeleteFileHandler(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteFileHandler_NonOwnerForbidden(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT owner_id FROM files WHERE id = \$1`).
+		WithArgs("F1").
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow("VICTIM"))
+
+	// no userId in the body: the token identity is used
+	req := withUser(jsonReq(t, "/deleteFile", map[string]string{"fileId": "F1"}), "INTRUDER")
+	rr := httptest.NewRecorder()
+	srv.DeleteFileHandler(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDownloadSentFile_AccessCheck(t *testing.T) {
+	// nothing was sent to STRANGER
+	srv, _, _ := newMemoryServer(t)
+
+	req := withUser(jsonReq(t, "/downloadSentFile", map[string]string{"filePath": "/files/SENDER/sent/F1"}), "STRANGER")
+	rr := httptest.NewRecorder()
+	srv.DownloadSentFile(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	req = withUser(jsonReq(t, "/downloadSentFile", map[string]string{"filePath": "files/SENDER/shared_view/F1_X"}), "STRANGER")
+	rr = httptest.NewRecorder()
+	srv.DownloadSentFile(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// a recipient of F1 must not reach another blob through the path
+	for _, path := range []string{"files/SENDER/sent/../../OTHER/sent/F2", "files/SENDER//sent/F1", "files/./SENDER/sent/F1"} {
+		req = withUser(jsonReq(t, "/downloadSentFile", map[string]string{"filePath": path}), "STRANGER")
+		rr = httptest.NewRecorder()
+		srv.DownloadSentFile(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, path)
+	}
+	rr = httptest.NewRecorder()
+	srv.DownloadSentFile(rr, jsonReq(t, "/downloadSentFile", map[string]string{"filePath": "files/../etc/passwd"}))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestMarkAsReadHandler_OtherUsersNotification(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT "to" FROM notifications WHERE id = \$1`).
+		WithArgs("N1").
+		WillReturnRows(sqlmock.NewRows([]string{"to"}).AddRow("U2"))
+
+	req := withUser(jsonReq(t, "/notifications/markAsRead", map[string]string{"id": "N1"}), "U1")
+	rr := httptest.NewRecorder()
+	srv.MarkAsReadHandler(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"success":false`)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
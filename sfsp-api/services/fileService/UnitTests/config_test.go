@@ -0,0 +1,213 @@
+package unitTests
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/config"
+	fh "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
+)
+
+// requiredEnv sets the settings that have no default.
+func requiredEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("POSTGRES_URI", "postgres://files@db/files")
+	t.Setenv("OWNCLOUD_URL", "http://owncloud/remote.php/dav/files/svc/")
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv(config.FileEnv, "")
+}
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestConfig_Defaults(t *testing.T) {
+	requiredEnv(t)
+
+	cfg, err := config.Load(nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, ":8081", cfg.Server.Addr)
+	assert.Equal(t, 48*time.Hour, cfg.Shares.DefaultExpiry)
+	assert.Equal(t, int64(50<<20), cfg.Uploads.MultipartMemory)
+	assert.Equal(t, "webdav", cfg.Storage.Backend)
+	assert.True(t, cfg.Storage.S3.UseSSL)
+	assert.True(t, cfg.Janitor.Enabled)
+	assert.True(t, cfg.Database.Migrate)
+	assert.Empty(t, cfg.CORS.AllowedOrigins)
+}
+
+func TestConfig_Precedence(t *testing.T) {
+	requiredEnv(t)
+	file := writeConfigFile(t, "fileservice.yaml", `
+server:
+  addr: ":9000"
+  shutdown_timeout: 45s
+shares:
+  default_expiry: 72h
+cors:
+  allowed_origins: ["https://app.example.com"]
+database:
+  max_open_conns: 50
+`)
+	t.Setenv("SHARE_DEFAULT_EXPIRY", "24h")
+	t.Setenv("HTTP_ADDR", ":9100")
+	t.Setenv("CORS_ORIGINS", "https://a.example.com, https://b.example.com")
+
+	cfg, err := config.Load([]string{"-config", file, "-addr", ":9200"})
+	require.NoError(t, err)
+
+	assert.Equal(t, ":9200", cfg.Server.Addr, "flags beat the environment")
+	assert.Equal(t, 24*time.Hour, cfg.Shares.DefaultExpiry, "the environment beats the file")
+	assert.Equal(t, 45*time.Second, cfg.Server.ShutdownTimeout, "the file beats the defaults")
+	assert.Equal(t, 50, cfg.Database.MaxOpenConns)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, cfg.CORS.AllowedOrigins)
+}
+
+func TestConfig_JSONFileFromEnv(t *testing.T) {
+	requiredEnv(t)
+	t.Setenv(config.FileEnv, writeConfigFile(t, "fileservice.json",
+		`{"uploads": {"max_chunks": 20, "max_chunk_size": 1048576}, "janitor": {"enabled": false}}`))
+
+	cfg, err := config.Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 20, cfg.Uploads.MaxChunks)
+	assert.Equal(t, int64(1<<20), cfg.Uploads.MaxChunkSize)
+	assert.False(t, cfg.Janitor.Enabled)
+}
+
+func TestConfig_EmptyVariableIsUnset(t *testing.T) {
+	requiredEnv(t)
+	t.Setenv("HTTP_READ_TIMEOUT", "")
+
+	cfg, err := config.Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, cfg.Server.ReadTimeout)
+}
+
+func TestConfig_ReportsEveryProblem(t *testing.T) {
+	requiredEnv(t)
+	t.Setenv("POSTGRES_URI", "")
+	t.Setenv("STORAGE_BACKEND", "ftp")
+	t.Setenv("SHARE_DEFAULT_EXPIRY", "96h")
+	t.Setenv("SHARE_MAX_EXPIRY", "72h")
+	t.Setenv("CORS_ORIGINS", "app.example.com")
+
+	_, err := config.Load(nil)
+	require.Error(t, err)
+	msg := err.Error()
+	assert.Contains(t, msg, "POSTGRES_URI is required")
+	assert.Contains(t, msg, `STORAGE_BACKEND must be "webdav", "local" or "s3", got "ftp"`)
+	assert.Contains(t, msg, "SHARE_DEFAULT_EXPIRY (96h0m0s) must not exceed SHARE_MAX_EXPIRY (72h0m0s)")
+	assert.Contains(t, msg, `CORS_ORIGINS entry "app.example.com"`)
+}
+
+func TestConfig_NamesUnparsableValues(t *testing.T) {
+	requiredEnv(t)
+	t.Setenv("JANITOR_TTL", "a day")
+	t.Setenv("AUTH_DISABLED", "yes")
+
+	_, err := config.Load([]string{"-log-level", "loud"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `JANITOR_TTL: invalid duration "a day"`)
+	assert.Contains(t, err.Error(), `AUTH_DISABLED: invalid boolean "yes"`)
+}
+
+func TestConfig_FileErrors(t *testing.T) {
+	requiredEnv(t)
+
+	_, err := config.Load([]string{"-config", writeConfigFile(t, "typo.yaml", "server:\n  adress: \":9000\"\n")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "adress")
+
+	_, err = config.Load([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")})
+	assert.Error(t, err)
+}
+
+func TestConfig_Help(t *testing.T) {
+	requiredEnv(t)
+	_, err := config.Load([]string{"-h"})
+	assert.ErrorIs(t, err, flag.ErrHelp)
+}
+
+func TestConfig_DisableMigrate(t *testing.T) {
+	requiredEnv(t)
+	t.Setenv("DB_MIGRATE", "false")
+
+	cfg, err := config.Load(nil)
+	require.NoError(t, err)
+	assert.False(t, cfg.Database.Migrate)
+}
+
+func TestConfig_Command(t *testing.T) {
+	requiredEnv(t)
+
+	cfg, rest, err := config.LoadCommand([]string{"-addr", ":9000", "migrate", "down", "2"})
+	require.NoError(t, err)
+	assert.Equal(t, ":9000", cfg.Server.Addr)
+	assert.Equal(t, []string{"migrate", "down", "2"}, rest)
+
+	_, err = config.Load([]string{"migrate"})
+	assert.ErrorContains(t, err, "unexpected arguments: migrate")
+}
+
+func TestCORS_AllowedOrigins(t *testing.T) {
+	h := api.CORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), []string{"https://app.example.com"})
+
+	serve := func(method, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/metadata", nil)
+		req.Header.Set("Origin", origin)
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve(http.MethodPost, "https://app.example.com")
+	assert.Equal(t, "https://app.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", rr.Header().Get("Vary"))
+	assert.Contains(t, rr.Header().Get("Access-Control-Expose-Headers"), "X-Request-ID")
+
+	rr = serve(http.MethodOptions, "https://app.example.com")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Contains(t, rr.Header().Get("Access-Control-Allow-Headers"), "Authorization")
+
+	rr = serve(http.MethodPost, "https://evil.example.com")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestStartUpload_ChunkLimits(t *testing.T) {
+	b, _ := newLocalBackend(t)
+	srv, _ := newMemoryServerOn(t, b, fh.Config{Limits: fh.ChunkLimits{MaxChunks: 4, MaxChunkSize: 1 << 20}})
+
+	rr := httptest.NewRecorder()
+	srv.StartUploadHandler(rr, jsonReq(t, "/startUpload", map[string]any{
+		"userId": "U1", "fileName": "a.bin", "totalChunks": 5, "chunkSize": 1024,
+	}))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "totalChunks exceeds the limit of 4")
+
+	rr = httptest.NewRecorder()
+	srv.StartUploadHandler(rr, jsonReq(t, "/startUpload", map[string]any{
+		"userId": "U1", "fileName": "a.bin", "totalChunks": 2, "chunkSize": 2 << 20,
+	}))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	assert.Equal(t, api.CodePayloadTooLarge, decodeEnvelope(t, rr).Code)
+}
@@ -1,7 +1,7 @@
 package unitTests
 
 import (
-	"database/sql"
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -9,39 +9,68 @@ import (
 	"io"
 	"fmt"
 
-	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
 	fh "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metrics"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/storage"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
 )
 
-func setupMockOwnCloudDownload(t *testing.T) func() {
+// newDownloadServer returns a server whose backend holds the blobs the
+// download tests fetch, over a memory store.
+func newDownloadServer(t *testing.T, cfg fh.Config) (*fh.Server, *store.Memory) {
 	t.Helper()
-	owncloud.DownloadFileStream = func(fileId string) (io.ReadCloser, error) {
-		return io.NopCloser(strings.NewReader("fake-file-content")), nil
-	}
-	owncloud.DownloadSentFileStream = func(filePath string) (io.ReadCloser, error) {
-		return io.NopCloser(strings.NewReader("fake-sent-file-content")), nil
-	}
-	return func() {
-		owncloud.DownloadFileStream = nil
-		owncloud.DownloadSentFileStream = nil
+	b, _ := newLocalBackend(t)
+	for path, content := range map[string]string{
+		"files/file-123":         "fake-file-content",
+		"files/sent/file-123":    "fake-sent-file-content",
+		"files/u1/sent/file-123": "fake-sent-file-content",
+	} {
+		require.NoError(t, b.WriteStream(path, strings.NewReader(content)))
 	}
+	return newMemoryServerOn(t, b, cfg)
 }
 
-func TestDownloadHandler_Success(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
-	defer cleanup()
+// addDownloadFile stores file-123 of user-1 with the given hash.
+func addDownloadFile(t *testing.T, st *store.Memory, fileHash string) {
+	t.Helper()
+	_, err := st.AddFile(context.Background(), store.File{
+		ID:       "file-123",
+		OwnerID:  "user-1",
+		FileName: "test.pdf",
+		Nonce:    "nonce123",
+		FileHash: fileHash,
+		CID:      "cid-xyz",
+		FileSize: int64(len("fake-file-content")),
+	})
+	require.NoError(t, err)
+}
+
+// addSentHash records the hash and size of the sent copy of file-123.
+func addSentHash(t *testing.T, st *store.Memory, path, content string) {
+	t.Helper()
+	require.NoError(t, st.RecordBlobHash(context.Background(), store.BlobHash{
+		Path: path, FileID: "file-123", SHA256: sha256Hex(content), Size: int64(len(content)),
+	}))
+}
+
+// unreadable fails the test when a handler reads a blob.
+type unreadable struct {
+	storage.Backend
+	t   *testing.T
+	msg string
+}
 
-	rows := sqlmock.NewRows([]string{"file_name", "nonce", "file_hash", "cid"}).
-		AddRow("test.pdf", "nonce123", "dummyhash", "cid-xyz")
-	mock.ExpectQuery(`SELECT file_name, nonce, file_hash, cid FROM files`).
-		WithArgs("user-1", "file-123").
-		WillReturnRows(rows)
+func (u unreadable) ReadStream(string) (io.ReadCloser, error) {
+	u.t.Fatal(u.msg)
+	return nil, nil
+}
 
-	resetOwnCloud := setupMockOwnCloudDownload(t)
-	defer resetOwnCloud()
+func TestDownloadHandler_Success(t *testing.T) {
+	srv, st := newDownloadServer(t, fh.Config{})
+	addDownloadFile(t, st, sha256Hex("fake-file-content"))
 
 	body := fh.DownloadRequest{
 		UserID: "user-1",
@@ -50,33 +79,33 @@ func TestDownloadHandler_Success(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/download", body)
 	rr := httptest.NewRecorder()
 
-	fh.DownloadHandler(rr, req)
+	srv.DownloadHandler(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
 
 	assert.Equal(t, "application/octet-stream", rr.Header().Get("Content-Type"))
 	assert.Equal(t, "test.pdf", rr.Header().Get("X-File-Name"))
 	assert.Equal(t, "nonce123", rr.Header().Get("X-Nonce"))
-
-	require.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, sha256Hex("fake-file-content"), rr.Header().Get(fh.HeaderExpectedHash))
+	assert.Equal(t, "fake-file-content", rr.Body.String())
+	assert.Equal(t, sha256Hex("fake-file-content"), rr.Result().Trailer.Get(fh.TrailerFileHash))
+	assert.Equal(t, fh.IntegrityVerified, rr.Result().Trailer.Get(fh.TrailerIntegrity))
 }
 
 func TestDownloadHandler_InvalidJSON(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, _, _ := newMemoryServer(t)
 
 	req := httptest.NewRequest(http.MethodPost, "/download", strings.NewReader("{bad json"))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
-	fh.DownloadHandler(rr, req)
+	srv.DownloadHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestDownloadHandler_MissingFields(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, _, _ := newMemoryServer(t)
 
 	body := fh.DownloadRequest{
 		UserID: "", 
@@ -85,37 +114,42 @@ func TestDownloadHandler_MissingFields(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/download", body)
 	rr := httptest.NewRecorder()
 
-	fh.DownloadHandler(rr, req)
+	srv.DownloadHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestDownloadHandler_FileNotFound(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, st := newDownloadServer(t, fh.Config{})
+	addDownloadFile(t, st, sha256Hex("fake-file-content"))
 
-	mock.ExpectQuery(`SELECT file_name, nonce, file_hash, cid FROM files`).
-		WithArgs("user-1", "file-999").
-		WillReturnError(sql.ErrNoRows)
+	for name, body := range map[string]fh.DownloadRequest{
+		"missing":     {UserID: "user-1", FileId: "file-999"},
+		"other owner": {UserID: "user-2", FileId: "file-123"},
+	} {
+		req := NewJSONRequest(t, http.MethodPost, "/download", body)
+		rr := httptest.NewRecorder()
 
-	body := fh.DownloadRequest{
-		UserID: "user-1",
-		FileId: "file-999",
+		srv.DownloadHandler(rr, req)
+
+		require.Equal(t, http.StatusNotFound, rr.Code, name)
 	}
-	req := NewJSONRequest(t, http.MethodPost, "/download", body)
-	rr := httptest.NewRecorder()
+}
+
+func TestDownloadHandler_TrashedFileNotFound(t *testing.T) {
+	srv, st := newDownloadServer(t, fh.Config{})
+	addDownloadFile(t, st, sha256Hex("fake-file-content"))
+	require.NoError(t, st.TrashFile(context.Background(), "file-123"))
 
-	fh.DownloadHandler(rr, req)
+	req := NewJSONRequest(t, http.MethodPost, "/download", fh.DownloadRequest{UserID: "user-1", FileId: "file-123"})
+	rr := httptest.NewRecorder()
+	srv.DownloadHandler(rr, req)
 
 	require.Equal(t, http.StatusNotFound, rr.Code)
 }
 
 func TestDownloadSentFile_Success(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
-
-	resetOwnCloud := setupMockOwnCloudDownload(t)
-	defer resetOwnCloud()
+	srv, _ := newDownloadServer(t, fh.Config{})
 
 	body := fh.DownloadSentRequest{
 		FilePath: "/files/sent/file-123",
@@ -123,29 +157,28 @@ func TestDownloadSentFile_Success(t *testing.T) {
 	req := 	NewJSONRequest(t, http.MethodPost, "/sent/download", body)
 	rr := httptest.NewRecorder()
 
-	fh.DownloadSentFile(rr, req)
+	srv.DownloadSentFile(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
 
 	assert.Equal(t, "application/octet-stream", rr.Header().Get("Content-Type"))
+	assert.Equal(t, fh.IntegrityUnverified, rr.Result().Trailer.Get(fh.TrailerIntegrity))
 }
 
 func TestDownloadSentFile_InvalidJSON(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, _, _ := newMemoryServer(t)
 
 	req := httptest.NewRequest(http.MethodPost, "/sent/download", strings.NewReader("{bad json"))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
-	fh.DownloadSentFile(rr, req)
+	srv.DownloadSentFile(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestDownloadSentFile_MissingFilePath(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, _, _ := newMemoryServer(t)
 
 	body := fh.DownloadSentRequest{
 		FilePath: "",
@@ -153,21 +186,14 @@ func TestDownloadSentFile_MissingFilePath(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/sent/download", body)
 	rr := httptest.NewRecorder()
 
-	fh.DownloadSentFile(rr, req)
+	srv.DownloadSentFile(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestDownloadSentFile_OwnCloudError(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
-
-	resetOwnCloud := setupMockOwnCloudDownload(t)
-	defer resetOwnCloud()
-
-	owncloud.DownloadSentFileStream = func(filePath string) (io.ReadCloser, error) {
-		return nil, fmt.Errorf("OwnCloud error")
-	}
+	// the backend is empty
+	srv, _, _ := newMemoryServer(t)
 
 	body := fh.DownloadSentRequest{
 		FilePath: "/files/sent/file-123",
@@ -175,7 +201,205 @@ func TestDownloadSentFile_OwnCloudError(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/sent/download", body)
 	rr := httptest.NewRecorder()
 
-	fh.DownloadSentFile(rr, req)
+	srv.DownloadSentFile(rr, req)
+
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
+func TestDownloadHandler_HashMismatch_TrailerMarksCorrupted(t *testing.T) {
+	var alerts []fh.IntegrityFailure
+	srv, st := newDownloadServer(t, fh.Config{OnIntegrityFailure: func(f fh.IntegrityFailure) { alerts = append(alerts, f) }})
+	addDownloadFile(t, st, sha256Hex("original"))
+
+	mismatches := metrics.HashMismatches.With("file").Value()
+	downloaded := metrics.DownloadedBytes.Value()
+
+	req := NewJSONRequest(t, http.MethodPost, "/download", fh.DownloadRequest{UserID: "user-1", FileId: "file-123"})
+	rr := httptest.NewRecorder()
+	srv.DownloadHandler(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, fh.IntegrityMismatch, rr.Result().Trailer.Get(fh.TrailerIntegrity))
+	assert.Equal(t, mismatches+1, metrics.HashMismatches.With("file").Value())
+	assert.Equal(t, downloaded+float64(len("fake-file-content")), metrics.DownloadedBytes.Value())
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "file-123", alerts[0].FileID)
+	assert.Equal(t, sha256Hex("fake-file-content"), alerts[0].Computed)
+
+	f, err := st.File(context.Background(), "file-123")
+	require.NoError(t, err)
+	assert.NotNil(t, f.CorruptedAt)
+	logs, err := st.ListAccessLogs(context.Background(), store.AccessLogFilter{FileID: "file-123"}, memoryPage(t, api.PageRequest{}))
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.Equal(t, "integrity_failed", logs[0].Action)
+	assert.Equal(t, "user-1", logs[0].UserID)
+}
+
+func TestDownloadHandler_PreVerify_MismatchSendsNothing(t *testing.T) {
+	var alerts []fh.IntegrityFailure
+	srv, st := newDownloadServer(t, fh.Config{OnIntegrityFailure: func(f fh.IntegrityFailure) { alerts = append(alerts, f) }})
+	addDownloadFile(t, st, sha256Hex("original"))
+
+	req := NewJSONRequest(t, http.MethodPost, "/download?verify=pre", fh.DownloadRequest{UserID: "user-1", FileId: "file-123"})
+	rr := httptest.NewRecorder()
+	srv.DownloadHandler(rr, req)
 
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Contains(t, rr.Body.String(), "integrity")
+	assert.NotContains(t, rr.Body.String(), "fake-file-content")
+	assert.Len(t, alerts, 1)
+
+	f, err := st.File(context.Background(), "file-123")
+	require.NoError(t, err)
+	assert.NotNil(t, f.CorruptedAt)
+}
+
+func TestDownloadHandler_PreVerify_Success(t *testing.T) {
+	srv, st := newDownloadServer(t, fh.Config{})
+	addDownloadFile(t, st, sha256Hex("fake-file-content"))
+
+	req := NewJSONRequest(t, http.MethodPost, "/download", fh.DownloadRequest{UserID: "user-1", FileId: "file-123"})
+	req.Header.Set("X-Verify-Mode", fh.VerifyModePre)
+	rr := httptest.NewRecorder()
+	srv.DownloadHandler(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "fake-file-content", rr.Body.String())
+	assert.Equal(t, fh.IntegrityVerified, rr.Result().Trailer.Get(fh.TrailerIntegrity))
+}
+
+func TestDownloadHandler_RefusesCorruptedFile(t *testing.T) {
+	b, _ := newLocalBackend(t)
+	srv, st := newMemoryServerOn(t, unreadable{b, t, "corrupted file must not be read"}, fh.Config{})
+	addDownloadFile(t, st, sha256Hex("fake-file-content"))
+	require.NoError(t, st.MarkFileCorrupted(context.Background(), "file-123"))
+
+	req := NewJSONRequest(t, http.MethodPost, "/download", fh.DownloadRequest{UserID: "user-1", FileId: "file-123"})
+	rr := httptest.NewRecorder()
+	srv.DownloadHandler(rr, req)
+
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
+func TestDownloadSentFile_PreVerify_MarksBlobCorrupted(t *testing.T) {
+	var alerts []fh.IntegrityFailure
+	srv, st := newDownloadServer(t, fh.Config{OnIntegrityFailure: func(f fh.IntegrityFailure) { alerts = append(alerts, f) }})
+	addSentHash(t, st, "files/u1/sent/file-123", "original")
+
+	req := NewJSONRequest(t, http.MethodPost, "/downloadSentFile?verify=pre", fh.DownloadSentRequest{FilePath: "files/u1/sent/file-123"})
+	rr := httptest.NewRecorder()
+	srv.DownloadSentFile(rr, req)
+
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "files/u1/sent/file-123", alerts[0].Path)
+
+	b, err := st.BlobHash(context.Background(), "files/u1/sent/file-123")
+	require.NoError(t, err)
+	assert.NotNil(t, b.CorruptedAt)
+}
+
+func TestDownloadSentFile_Verified(t *testing.T) {
+	srv, st := newDownloadServer(t, fh.Config{})
+	addSentHash(t, st, "files/u1/sent/file-123", "fake-sent-file-content")
+
+	req := NewJSONRequest(t, http.MethodPost, "/downloadSentFile", fh.DownloadSentRequest{FilePath: "files/u1/sent/file-123"})
+	rr := httptest.NewRecorder()
+	srv.DownloadSentFile(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "fake-sent-file-content", rr.Body.String())
+	assert.Equal(t, fh.IntegrityVerified, rr.Result().Trailer.Get(fh.TrailerIntegrity))
+}
+
+func downloadWithHeaders(t *testing.T, srv *fh.Server, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := NewJSONRequest(t, http.MethodPost, "/download", fh.DownloadRequest{UserID: "user-1", FileId: "file-123"})
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rr := httptest.NewRecorder()
+	srv.DownloadHandler(rr, req)
+	return rr
+}
+
+func TestDownloadHandler_Range(t *testing.T) {
+	etag := `"` + sha256Hex("fake-file-content") + `"`
+
+	cases := []struct {
+		name         string
+		headers      map[string]string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{"explicit range", map[string]string{"Range": "bytes=5-8"}, http.StatusPartialContent, "file", "bytes 5-8/17"},
+		{"open ended", map[string]string{"Range": "bytes=10-"}, http.StatusPartialContent, "content", "bytes 10-16/17"},
+		{"suffix", map[string]string{"Range": "bytes=-7"}, http.StatusPartialContent, "content", "bytes 10-16/17"},
+		{"end clamped", map[string]string{"Range": "bytes=10-999"}, http.StatusPartialContent, "content", "bytes 10-16/17"},
+		{"if-range matches", map[string]string{"Range": "bytes=0-3", "If-Range": etag}, http.StatusPartialContent, "fake", "bytes 0-3/17"},
+		{"if-range stale", map[string]string{"Range": "bytes=0-3", "If-Range": `"old"`}, http.StatusOK, "fake-file-content", ""},
+		{"multiple ranges ignored", map[string]string{"Range": "bytes=0-1,4-5"}, http.StatusOK, "fake-file-content", ""},
+		{"malformed ignored", map[string]string{"Range": "bytes=9-2"}, http.StatusOK, "fake-file-content", ""},
+		{"unsatisfiable", map[string]string{"Range": "bytes=17-"}, http.StatusRequestedRangeNotSatisfiable, "", "bytes */17"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, st := newDownloadServer(t, fh.Config{})
+			addDownloadFile(t, st, sha256Hex("fake-file-content"))
+
+			rr := downloadWithHeaders(t, srv, tc.headers)
+
+			require.Equal(t, tc.status, rr.Code, rr.Body.String())
+			assert.Equal(t, etag, rr.Header().Get("ETag"))
+			assert.Equal(t, "bytes", rr.Header().Get("Accept-Ranges"))
+			assert.Equal(t, tc.contentRange, rr.Header().Get("Content-Range"))
+			if tc.status != http.StatusRequestedRangeNotSatisfiable {
+				assert.Equal(t, tc.body, rr.Body.String())
+			}
+			if tc.status == http.StatusPartialContent {
+				assert.Equal(t, fmt.Sprint(len(tc.body)), rr.Header().Get("Content-Length"))
+				assert.Equal(t, "test.pdf", rr.Header().Get("X-File-Name"))
+			}
+		})
+	}
+}
+
+func TestDownloadHandler_IfNoneMatch(t *testing.T) {
+	b, _ := newLocalBackend(t)
+	srv, st := newMemoryServerOn(t, unreadable{b, t, "a 304 must not read the blob"}, fh.Config{})
+	addDownloadFile(t, st, sha256Hex("fake-file-content"))
+
+	rr := downloadWithHeaders(t, srv, map[string]string{
+		"If-None-Match": `"other", W/"` + sha256Hex("fake-file-content") + `"`,
+	})
+
+	require.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Empty(t, rr.Body.String())
+}
+
+func TestDownloadSentFile_RangeNeedsRecordedSize(t *testing.T) {
+	srv, st := newDownloadServer(t, fh.Config{})
+
+	send := func() *httptest.ResponseRecorder {
+		req := NewJSONRequest(t, http.MethodPost, "/downloadSentFile", fh.DownloadSentRequest{FilePath: "files/u1/sent/file-123"})
+		req.Header.Set("Range", "bytes=5-8")
+		rr := httptest.NewRecorder()
+		srv.DownloadSentFile(rr, req)
+		return rr
+	}
+
+	// Sent files stored before sizes were recorded ignore Range.
+	rr := send()
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "fake-sent-file-content", rr.Body.String())
+	assert.Empty(t, rr.Header().Get("Accept-Ranges"))
+
+	addSentHash(t, st, "files/u1/sent/file-123", "fake-sent-file-content")
+	rr = send()
+	require.Equal(t, http.StatusPartialContent, rr.Code)
+	assert.Equal(t, "sent", rr.Body.String())
+	assert.Equal(t, "bytes 5-8/22", rr.Header().Get("Content-Range"))
 }
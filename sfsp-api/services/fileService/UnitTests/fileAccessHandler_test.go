@@ -2,6 +2,7 @@ package unitTests
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"log"
@@ -12,8 +13,10 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
 )
 
 func init() {
@@ -38,7 +41,7 @@ func TestAddAccesslogHandler(t *testing.T) {
 		}
 	}()
 
-	fileHandler.DB = db
+	srv := fileHandler.New(db, nil, fileHandler.Config{})
 
 	t.Run("Success", func(t *testing.T) {
 		reqBody := map[string]string{
@@ -50,14 +53,14 @@ func TestAddAccesslogHandler(t *testing.T) {
 		body, _ := json.Marshal(reqBody)
 
 		mock.ExpectExec("INSERT INTO access_logs").
-			WithArgs(reqBody["file_id"], reqBody["user_id"], reqBody["action"], reqBody["message"]).
+			WithArgs(reqBody["file_id"], reqBody["user_id"], reqBody["action"], reqBody["message"], false).
 			WillReturnResult(sqlmock.NewResult(1, 1))
 
 		req := httptest.NewRequest(http.MethodPost, "/addAccesslog", bytes.NewBuffer(body))
 		req.Header.Set("Content-Type", "application/json")
 		w := httptest.NewRecorder()
 
-		fileHandler.AddAccesslogHandler(w, req)
+		srv.AddAccesslogHandler(w, req)
 
 		assert.Equal(t, http.StatusCreated, w.Code)
 
@@ -74,7 +77,7 @@ func TestAddAccesslogHandler(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		w := httptest.NewRecorder()
 
-		fileHandler.AddAccesslogHandler(w, req)
+		srv.AddAccesslogHandler(w, req)
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 
@@ -88,7 +91,7 @@ func TestAddAccesslogHandler(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		w := httptest.NewRecorder()
 
-		fileHandler.AddAccesslogHandler(w, req)
+		srv.AddAccesslogHandler(w, req)
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 
@@ -101,14 +104,14 @@ func TestAddAccesslogHandler(t *testing.T) {
 		}
 		body, _ := json.Marshal(reqBody)
 		mock.ExpectExec("INSERT INTO access_logs").
-			WithArgs(reqBody["file_id"], reqBody["user_id"], reqBody["action"], reqBody["message"]).
+			WithArgs(reqBody["file_id"], reqBody["user_id"], reqBody["action"], reqBody["message"], false).
 			WillReturnError(sql.ErrConnDone)
 
 		req := httptest.NewRequest(http.MethodPost, "/addAccesslog", bytes.NewBuffer(body))
 		req.Header.Set("Content-Type", "application/json")
 		w := httptest.NewRecorder()
 
-		fileHandler.AddAccesslogHandler(w, req)
+		srv.AddAccesslogHandler(w, req)
 		assert.Equal(t, http.StatusInternalServerError, w.Code)
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
@@ -124,22 +127,22 @@ func TestGetAccesslogHandler(t *testing.T) {
 			log.Println("error closing db:", err)
 		}
 	}()
-	fileHandler.DB = db
+	srv := fileHandler.New(db, nil, fileHandler.Config{})
 
 	t.Run("Get logs with file_id filter", func(t *testing.T) {
 		fileID := "file123"
-		rows := sqlmock.NewRows([]string{"id", "file_id", "user_id", "action", "message", "timestamp"}).
-			AddRow("1", fileID, "user456", "download", "File downloaded", "2025-06-25T10:00:00Z").
-			AddRow("2", fileID, "user789", "view", "File viewed", "2025-06-25T11:00:00Z")
+		rows := sqlmock.NewRows([]string{"id", "file_id", "user_id", "action", "message", "timestamp", "view_only", "sort_key"}).
+			AddRow("1", fileID, "user456", "download", "File downloaded", "2025-06-25T10:00:00Z", false, "2025-06-25T10:00:00Z").
+			AddRow("2", fileID, "user789", "view", "File viewed", "2025-06-25T11:00:00Z", false, "2025-06-25T11:00:00Z")
 
-		mock.ExpectQuery("SELECT id, file_id, user_id, action, message, timestamp FROM access_logs WHERE file_id").
-			WithArgs(fileID).
+		mock.ExpectQuery("SELECT id, file_id, user_id, action, message, timestamp, .* FROM access_logs WHERE file_id").
+			WithArgs(fileID, 101).
 			WillReturnRows(rows)
 
 		req := httptest.NewRequest(http.MethodGet, "/getAccesslog?file_id="+fileID, nil)
 		w := httptest.NewRecorder()
 
-		fileHandler.GetAccesslogHandler(w, req)
+		srv.GetAccesslogHandler(w, req)
 		assert.Equal(t, http.StatusOK, w.Code)
 
 		var logs []map[string]interface{}
@@ -153,17 +156,18 @@ func TestGetAccesslogHandler(t *testing.T) {
 	})
 
 	t.Run("Get all logs", func(t *testing.T) {
-		rows := sqlmock.NewRows([]string{"id", "file_id", "user_id", "action", "message", "timestamp"}).
-			AddRow("1", "file123", "user456", "download", "File downloaded", "2025-06-25T10:00:00Z").
-			AddRow("2", "file456", "user789", "view", "File viewed", "2025-06-25T11:00:00Z")
+		rows := sqlmock.NewRows([]string{"id", "file_id", "user_id", "action", "message", "timestamp", "view_only", "sort_key"}).
+			AddRow("1", "file123", "user456", "download", "File downloaded", "2025-06-25T10:00:00Z", false, "2025-06-25T10:00:00Z").
+			AddRow("2", "file456", "user789", "view", "File viewed", "2025-06-25T11:00:00Z", false, "2025-06-25T11:00:00Z")
 
-		mock.ExpectQuery("SELECT id, file_id, user_id, action, message, timestamp FROM access_logs ORDER BY").
+		mock.ExpectQuery("SELECT id, file_id, user_id, action, message, timestamp, .* FROM access_logs WHERE TRUE ORDER BY").
+			WithArgs(101).
 			WillReturnRows(rows)
 
 		req := httptest.NewRequest(http.MethodGet, "/getAccesslog", nil)
 		w := httptest.NewRecorder()
 
-		fileHandler.GetAccesslogHandler(w, req)
+		srv.GetAccesslogHandler(w, req)
 		assert.Equal(t, http.StatusOK, w.Code)
 
 		var logs []map[string]interface{}
@@ -174,13 +178,28 @@ func TestGetAccesslogHandler(t *testing.T) {
 	})
 
 	t.Run("Database error", func(t *testing.T) {
-		mock.ExpectQuery("SELECT id, file_id, user_id, action, message, timestamp FROM access_logs ORDER BY").
+		mock.ExpectQuery("SELECT id, file_id, user_id, action, message, timestamp, .* FROM access_logs WHERE TRUE ORDER BY").
 			WillReturnError(sql.ErrConnDone)
 
 		req := httptest.NewRequest(http.MethodGet, "/getAccesslog", nil)
 		w := httptest.NewRecorder()
-		fileHandler.GetAccesslogHandler(w, req)
+		srv.GetAccesslogHandler(w, req)
 		assert.Equal(t, http.StatusInternalServerError, w.Code)
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
+
+func TestGetUsersWithFileAccessHandler_FileNotFound(t *testing.T) {
+	srv, st, _ := newMemoryServer(t)
+	fileID, err := st.AddFile(context.Background(), store.File{OwnerID: "alice", FileName: "a.txt"})
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	srv.GetUsersWithFileAccessHandler(rr, httptest.NewRequest(http.MethodGet, "/usersWithFileAccess?fileId=missing", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "File not found", decodeEnvelope(t, rr).Error)
+
+	rr = httptest.NewRecorder()
+	srv.GetUsersWithFileAccessHandler(rr, httptest.NewRequest(http.MethodGet, "/usersWithFileAccess?fileId="+fileID, nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
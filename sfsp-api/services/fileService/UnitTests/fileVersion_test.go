@@ -0,0 +1,333 @@
+package unitTests
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	fh "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/storage"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useLocalBackend returns a server over a sqlmock connection that keeps its
+// blobs in the returned local store.
+func useLocalBackend(t *testing.T) (*fh.Server, sqlmock.Sqlmock, *storage.LocalBackend) {
+	t.Helper()
+	b, _ := newLocalBackend(t)
+	srv, mock := newServer(t, b, fh.Config{})
+	return srv, mock, b
+}
+
+func readBlob(t *testing.T, b storage.Backend, path string) string {
+	t.Helper()
+	r, err := b.ReadStream(path)
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func expectOwnedFile(mock sqlmock.Sqlmock, userID, fileID string) {
+	expectFile(mock, store.File{ID: fileID, OwnerID: userID, FileName: "report.pdf"})
+}
+
+// expectFile answers the store's lookup of f.ID with f.
+func expectFile(mock sqlmock.Sqlmock, f store.File) {
+	mock.ExpectQuery(`SELECT id, owner_id, file_name, .* FROM files WHERE id = \$1`).
+		WithArgs(f.ID).
+		WillReturnRows(sqlmock.NewRows(fileColumns).AddRow(fileRow(f)...))
+}
+
+var versionColumns = []string{"version", "nonce", "file_hash", "file_size", "blob_path", "created_by", "created_at"}
+
+// expectFileVersion answers the lookup of a version stored at its usual
+// path whose ciphertext is content.
+func expectFileVersion(mock sqlmock.Sqlmock, fileID string, version int, nonce, content string) {
+	mock.ExpectQuery(`SELECT v.nonce, v.file_hash, v.file_size, v.blob_path, .*, b.corrupted_at\s+FROM file_versions v`).
+		WithArgs(fileID, version).
+		WillReturnRows(sqlmock.NewRows([]string{"nonce", "file_hash", "file_size", "blob_path", "created_by", "created_at", "corrupted_at"}).
+			AddRow(nonce, sha256Hex(content), int64(len(content)), owncloud.VersionPath(fileID, version), "U1", time.Now(), nil))
+}
+
+func expectSnapshot(mock sqlmock.Sqlmock, fileID, nonce, content string, next int) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT nonce, file_hash, file_size FROM files WHERE id = \$1 AND deleted_at IS NULL FOR UPDATE`).
+		WithArgs(fileID).
+		WillReturnRows(sqlmock.NewRows([]string{"nonce", "file_hash", "file_size"}).
+			AddRow(nonce, sha256Hex(content), int64(len(content))))
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\) \+ 1 FROM file_versions`).
+		WithArgs(fileID).
+		WillReturnRows(sqlmock.NewRows([]string{"next"}).AddRow(next))
+	mock.ExpectQuery(`INSERT INTO file_versions .* RETURNING created_at`).
+		WithArgs(fileID, next, nonce, sha256Hex(content), int64(len(content)), owncloud.VersionPath(fileID, next), "U1").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+	mock.ExpectCommit()
+	mock.ExpectExec(`INSERT INTO blob_hashes`).
+		WithArgs(owncloud.VersionPath(fileID, next), fileID, sha256Hex(content), int64(len(content))).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+func TestUpdateFileHandler_SavesPreviousVersion(t *testing.T) {
+	srv, st, b := newMemoryServer(t)
+	require.NoError(t, b.WriteStream("files/F1", strings.NewReader("old ciphertext")))
+
+	oldNonce := "old-nonce-0123456789abcdef"
+	newNonce := "new-nonce-0123456789abcdef"
+	corruptedAt := time.Now()
+	addItem(t, st, store.File{ID: "F1", OwnerID: "U1", FileName: "report.pdf", Nonce: oldNonce,
+		FileHash: sha256Hex("old ciphertext"), FileSize: int64(len("old ciphertext")), CorruptedAt: &corruptedAt})
+
+	rr := httptest.NewRecorder()
+	srv.UpdateFileHandler(rr, jsonReq(t, "/updateFile", map[string]string{
+		"userId":      "U1",
+		"fileId":      "F1",
+		"nonce":       newNonce,
+		"fileContent": base64.StdEncoding.EncodeToString([]byte("new ciphertext")),
+	}))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp fh.UpdateFileResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.PreviousVersion)
+	assert.Equal(t, "report.pdf", resp.FileName)
+	assert.Equal(t, "old ciphertext", readBlob(t, b, "versions/F1/1"))
+	assert.Equal(t, "new ciphertext", readBlob(t, b, "files/F1"))
+
+	ctx := context.Background()
+	f, err := st.File(ctx, "F1")
+	require.NoError(t, err)
+	assert.Equal(t, newNonce, f.Nonce)
+	assert.Equal(t, sha256Hex("new ciphertext"), f.FileHash)
+	assert.Nil(t, f.CorruptedAt)
+	v, err := st.FileVersion(ctx, "F1", 1)
+	require.NoError(t, err)
+	assert.Equal(t, oldNonce, v.Nonce)
+	assert.Equal(t, sha256Hex("old ciphertext"), v.FileHash)
+}
+
+func TestUpdateFileHandler_SnapshotFailureKeepsFile(t *testing.T) {
+	srv, st, _ := newMemoryServer(t) // files/F1 is missing, so the copy fails
+	addItem(t, st, store.File{ID: "F1", OwnerID: "U1", FileName: "report.pdf", Nonce: "n", FileHash: "h", FileSize: 1})
+
+	rr := httptest.NewRecorder()
+	srv.UpdateFileHandler(rr, jsonReq(t, "/updateFile", map[string]string{
+		"userId":      "U1",
+		"fileId":      "F1",
+		"nonce":       "new-nonce-0123456789abcdef",
+		"fileContent": base64.StdEncoding.EncodeToString([]byte("new ciphertext")),
+	}))
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	ctx := context.Background()
+	f, err := st.File(ctx, "F1")
+	require.NoError(t, err)
+	assert.Equal(t, "n", f.Nonce)
+	versions, err := st.ListFileVersions(ctx, "F1")
+	require.NoError(t, err)
+	assert.Empty(t, versions)
+}
+
+func TestUpdateFileHandler_TrashedFileNotFound(t *testing.T) {
+	srv, st, b := newMemoryServer(t)
+	require.NoError(t, b.WriteStream("files/F1", strings.NewReader("old ciphertext")))
+
+	// a trashed file is refused like a missing one
+	addItem(t, st, store.File{ID: "F1", OwnerID: "U1", FileName: "report.pdf", FileHash: "h", FileSize: 1})
+	require.NoError(t, st.TrashFile(context.Background(), "F1"))
+
+	rr := httptest.NewRecorder()
+	srv.UpdateFileHandler(rr, jsonReq(t, "/updateFile", map[string]string{
+		"userId":      "U1",
+		"fileId":      "F1",
+		"nonce":       "new-nonce-0123456789abcdef",
+		"fileContent": base64.StdEncoding.EncodeToString([]byte("new ciphertext")),
+	}))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "old ciphertext", readBlob(t, b, "files/F1"))
+}
+
+func TestListFileVersionsHandler(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	expectOwnedFile(mock, "U1", "F1")
+	mock.ExpectQuery(`SELECT version, nonce, file_hash, file_size, blob_path, COALESCE\(created_by, ''\), created_at\s+FROM file_versions`).
+		WithArgs("F1").
+		WillReturnRows(sqlmock.NewRows(versionColumns).
+			AddRow(2, "n2", "h2", int64(20), owncloud.VersionPath("F1", 2), "U1", now).
+			AddRow(1, "n1", "h1", int64(10), owncloud.VersionPath("F1", 1), "U1", now.Add(-time.Hour)))
+
+	rr := httptest.NewRecorder()
+	srv.ListFileVersionsHandler(rr, jsonReq(t, "/fileVersions", map[string]string{"userId": "U1", "fileId": "F1"}))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp struct {
+		Versions []fh.FileVersion `json:"versions"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	require.Len(t, resp.Versions, 2)
+	assert.Equal(t, 2, resp.Versions[0].Version)
+	assert.Equal(t, "n1", resp.Versions[1].Nonce)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListFileVersionsHandler_NotOwner(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	expectFile(mock, store.File{ID: "F1", OwnerID: "U1", FileName: "report.pdf"})
+
+	rr := httptest.NewRecorder()
+	srv.ListFileVersionsHandler(rr, jsonReq(t, "/fileVersions", map[string]string{"userId": "U2", "fileId": "F1"}))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDownloadFileVersionHandler(t *testing.T) {
+	srv, mock, b := useLocalBackend(t)
+	require.NoError(t, b.WriteStream("versions/F1/1", strings.NewReader("old ciphertext")))
+
+	expectOwnedFile(mock, "U1", "F1")
+	expectFileVersion(mock, "F1", 1, "n1", "old ciphertext")
+
+	rr := httptest.NewRecorder()
+	// the version may be sent as a string, as the v1 routes do
+	srv.DownloadFileVersionHandler(rr, jsonReq(t, "/downloadFileVersion", map[string]string{"userId": "U1", "fileId": "F1", "version": "1"}))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "old ciphertext", rr.Body.String())
+	assert.Equal(t, "n1", rr.Header().Get("X-Nonce"))
+	assert.Equal(t, "1", rr.Header().Get("X-File-Version"))
+	assert.Equal(t, `"`+sha256Hex("old ciphertext")+`"`, rr.Header().Get("ETag"))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDownloadFileVersionHandler_InvalidVersion(t *testing.T) {
+	srv, _, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	rr := httptest.NewRecorder()
+	srv.DownloadFileVersionHandler(rr, jsonReq(t, "/downloadFileVersion", map[string]any{"userId": "U1", "fileId": "F1", "version": 0}))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestRestoreFileVersionHandler(t *testing.T) {
+	srv, mock, b := useLocalBackend(t)
+	require.NoError(t, b.WriteStream("files/F1", strings.NewReader("current")))
+	require.NoError(t, b.WriteStream("versions/F1/1", strings.NewReader("original")))
+
+	expectOwnedFile(mock, "U1", "F1")
+	expectFileVersion(mock, "F1", 1, "n1", "original")
+	expectSnapshot(mock, "F1", "n2", "current", 2)
+	mock.ExpectExec(`UPDATE files\s+SET nonce = \$1, file_hash = \$2, file_size = \$3, corrupted_at = NULL`).
+		WithArgs("n1", sha256Hex("original"), int64(len("original")), "U1", "F1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rr := httptest.NewRecorder()
+	srv.RestoreFileVersionHandler(rr, jsonReq(t, "/restoreFileVersion", map[string]any{"userId": "U1", "fileId": "F1", "version": 1}))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "original", readBlob(t, b, "files/F1"))
+	assert.Equal(t, "current", readBlob(t, b, "versions/F1/2"))
+	assert.Contains(t, rr.Body.String(), `"savedVersion":2`)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestoreFileVersionHandler_TrashedFileNotFound(t *testing.T) {
+	srv, mock, b := useLocalBackend(t)
+	require.NoError(t, b.WriteStream("files/F1", strings.NewReader("current")))
+	require.NoError(t, b.WriteStream("versions/F1/1", strings.NewReader("original")))
+
+	deletedAt := time.Now()
+	expectFile(mock, store.File{ID: "F1", OwnerID: "U1", FileName: "report.pdf", DeletedAt: &deletedAt})
+
+	rr := httptest.NewRecorder()
+	srv.RestoreFileVersionHandler(rr, jsonReq(t, "/restoreFileVersion", map[string]any{"userId": "U1", "fileId": "F1", "version": 1}))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "current", readBlob(t, b, "files/F1"))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPruneFileVersionsHandler_KeepNewest(t *testing.T) {
+	srv, mock, b := useLocalBackend(t)
+	for _, v := range []string{"1", "2", "3"} {
+		require.NoError(t, b.WriteStream("versions/F1/"+v, strings.NewReader("v"+v)))
+	}
+
+	now := time.Now()
+	expectOwnedFile(mock, "U1", "F1")
+	mock.ExpectQuery(`SELECT version, nonce, file_hash, file_size`).
+		WithArgs("F1").
+		WillReturnRows(sqlmock.NewRows(versionColumns).
+			AddRow(3, "n3", "h3", int64(2), owncloud.VersionPath("F1", 3), "U1", now).
+			AddRow(2, "n2", "h2", int64(2), owncloud.VersionPath("F1", 2), "U1", now).
+			AddRow(1, "n1", "h1", int64(2), owncloud.VersionPath("F1", 1), "U1", now))
+	for _, v := range []int{2, 1} {
+		mock.ExpectExec(`DELETE FROM file_versions WHERE file_id = \$1 AND version = \$2`).
+			WithArgs("F1", v).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM blob_hashes WHERE path = \$1`).
+			WithArgs(owncloud.VersionPath("F1", v)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	rr := httptest.NewRecorder()
+	srv.PruneFileVersionsHandler(rr, jsonReq(t, "/pruneFileVersions", map[string]any{"userId": "U1", "fileId": "F1", "keep": 1}))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Contains(t, rr.Body.String(), `"pruned":[2,1]`)
+	assert.Equal(t, "v3", readBlob(t, b, "versions/F1/3"))
+	_, err := b.ReadStream("versions/F1/1")
+	assert.Error(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPruneFileVersionsHandler_OlderThan(t *testing.T) {
+	srv, mock, _ := useLocalBackend(t)
+
+	now := time.Now()
+	expectOwnedFile(mock, "U1", "F1")
+	mock.ExpectQuery(`SELECT version, nonce, file_hash, file_size`).
+		WithArgs("F1").
+		WillReturnRows(sqlmock.NewRows(versionColumns).
+			AddRow(2, "n2", "h2", int64(2), owncloud.VersionPath("F1", 2), "U1", now.AddDate(0, 0, -1)).
+			AddRow(1, "n1", "h1", int64(2), owncloud.VersionPath("F1", 1), "U1", now.AddDate(0, 0, -40)))
+	mock.ExpectExec(`DELETE FROM file_versions`).
+		WithArgs("F1", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM blob_hashes`).
+		WithArgs(owncloud.VersionPath("F1", 1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rr := httptest.NewRecorder()
+	srv.PruneFileVersionsHandler(rr, jsonReq(t, "/pruneFileVersions", map[string]any{"userId": "U1", "fileId": "F1", "olderThanDays": 30}))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Contains(t, rr.Body.String(), `"pruned":[1]`)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPruneFileVersionsHandler_RequiresRule(t *testing.T) {
+	srv, _, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	rr := httptest.NewRecorder()
+	srv.PruneFileVersionsHandler(rr, jsonReq(t, "/pruneFileVersions", map[string]string{"userId": "U1", "fileId": "F1"}))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
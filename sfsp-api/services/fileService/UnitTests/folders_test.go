@@ -0,0 +1,182 @@
+package unitTests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+)
+
+// addItem stores f, a file or folder of U1 unless it says otherwise.
+func addItem(t *testing.T, st *store.Memory, f store.File) {
+	t.Helper()
+	if f.OwnerID == "" {
+		f.OwnerID = "U1"
+	}
+	_, err := st.AddFile(context.Background(), f)
+	require.NoError(t, err)
+}
+
+// fileCIDOf returns the cid stored for id.
+func fileCIDOf(t *testing.T, st *store.Memory, id string) string {
+	t.Helper()
+	f, err := st.File(context.Background(), id)
+	require.NoError(t, err)
+	return f.CID
+}
+
+func TestDeleteFolderHandler_NotEmpty(t *testing.T) {
+	meta, st := newMemoryMetadata(t)
+	addItem(t, st, store.File{ID: "D1", FileName: "docs", FileType: "folder", CID: "docs"})
+	addItem(t, st, store.File{ID: "F1", FileName: "a.txt", CID: "files/docs/F1", ParentID: "D1"})
+
+	rr := httptest.NewRecorder()
+	meta.DeleteFolderHandler(rr, jsonReq(t, "/deleteFolder", map[string]any{"folderId": "D1"}))
+
+	assert.Equal(t, http.StatusConflict, rr.Code, rr.Body.String())
+	trashed, err := st.FileTrashed(context.Background(), "D1")
+	require.NoError(t, err)
+	assert.False(t, trashed)
+}
+
+func TestDeleteFolderHandler_Recursive(t *testing.T) {
+	meta, st := newMemoryMetadata(t)
+	addItem(t, st, store.File{ID: "D1", FileName: "docs", FileType: "folder", CID: "docs"})
+	addItem(t, st, store.File{ID: "D2", FileName: "sub", FileType: "folder", CID: "docs/sub", ParentID: "D1"})
+	addItem(t, st, store.File{ID: "F1", FileName: "a.txt", CID: "files/docs/F1", ParentID: "D1"})
+	addItem(t, st, store.File{ID: "F2", FileName: "b.txt", CID: "files/docs/sub/F2", ParentID: "D2"})
+	addItem(t, st, store.File{ID: "F3", FileName: "c.txt", CID: "files/F3"})
+
+	rr := httptest.NewRecorder()
+	meta.DeleteFolderHandler(rr, jsonReq(t, "/deleteFolder", map[string]any{"folderId": "D1", "recursive": true}))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.EqualValues(t, 4, resp["itemsTrashed"])
+
+	ids, err := st.TrashedFileIDs(context.Background(), "U1")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"D1", "D2", "F1", "F2"}, ids)
+}
+
+func TestDeleteFolderHandler_NotAFolder(t *testing.T) {
+	meta, st := newMemoryMetadata(t)
+	addItem(t, st, store.File{ID: "F1", FileName: "a.pdf", FileType: "application/pdf", CID: "files/F1"})
+
+	rr := httptest.NewRecorder()
+	meta.DeleteFolderHandler(rr, jsonReq(t, "/deleteFolder", map[string]any{"folderId": "F1", "recursive": true}))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestMoveHandler_FolderWithContents(t *testing.T) {
+	meta, st := newMemoryMetadata(t)
+	addItem(t, st, store.File{ID: "D1", FileName: "docs", FileType: "folder", CID: "docs"})
+	addItem(t, st, store.File{ID: "D2", FileName: "archive", FileType: "folder", CID: "archive"})
+	addItem(t, st, store.File{ID: "D3", FileName: "sub", FileType: "folder", CID: "docs/sub", ParentID: "D1"})
+	addItem(t, st, store.File{ID: "F1", FileName: "a.txt", CID: "files/docs/F1", ParentID: "D1"})
+	addItem(t, st, store.File{ID: "F2", FileName: "b.txt", CID: "files/docs/sub/F2", ParentID: "D3"})
+
+	req := withUser(jsonReq(t, "/move", map[string]any{"fileId": "D1", "parentId": "D2", "name": "papers"}), "U1")
+	rr := httptest.NewRecorder()
+	meta.MoveHandler(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, "archive/papers", resp["cid"])
+	assert.Equal(t, "D2", resp["parentId"])
+	assert.EqualValues(t, 3, resp["descendantsUpdated"])
+
+	assert.Equal(t, "archive/papers/sub", fileCIDOf(t, st, "D3"))
+	assert.Equal(t, "files/archive/papers/F1", fileCIDOf(t, st, "F1"))
+	assert.Equal(t, "files/archive/papers/sub/F2", fileCIDOf(t, st, "F2"))
+}
+
+func TestMoveHandler_FileToRoot(t *testing.T) {
+	meta, st := newMemoryMetadata(t)
+	addItem(t, st, store.File{ID: "D1", FileName: "docs", FileType: "folder", CID: "docs"})
+	addItem(t, st, store.File{ID: "F1", FileName: "report.pdf", FileType: "application/pdf", CID: "files/docs/F1", ParentID: "D1"})
+
+	req := withUser(jsonReq(t, "/move", map[string]any{"fileId": "F1", "parentId": ""}), "U1")
+	rr := httptest.NewRecorder()
+	meta.MoveHandler(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	f, err := st.File(context.Background(), "F1")
+	require.NoError(t, err)
+	assert.Empty(t, f.ParentID)
+	assert.Equal(t, "files/F1", f.CID)
+	assert.Equal(t, "report.pdf", f.FileName)
+}
+
+func TestMoveHandler_IntoOwnSubfolder(t *testing.T) {
+	meta, st := newMemoryMetadata(t)
+	addItem(t, st, store.File{ID: "D1", FileName: "docs", FileType: "folder", CID: "docs"})
+	addItem(t, st, store.File{ID: "D3", FileName: "sub", FileType: "folder", CID: "docs/sub", ParentID: "D1"})
+
+	req := withUser(jsonReq(t, "/move", map[string]any{"fileId": "D1", "parentId": "D3"}), "U1")
+	rr := httptest.NewRecorder()
+	meta.MoveHandler(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, "docs", fileCIDOf(t, st, "D1"))
+}
+
+func TestMoveHandler_NameTaken(t *testing.T) {
+	meta, st := newMemoryMetadata(t)
+	addItem(t, st, store.File{ID: "F1", FileName: "a.txt", FileType: "text/plain", CID: "files/F1"})
+	addItem(t, st, store.File{ID: "F2", FileName: "b.txt", FileType: "text/plain", CID: "files/F2"})
+
+	req := withUser(jsonReq(t, "/move", map[string]any{"fileId": "F1", "name": "b.txt"}), "U1")
+	rr := httptest.NewRecorder()
+	meta.MoveHandler(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	f, err := st.File(context.Background(), "F1")
+	require.NoError(t, err)
+	assert.Equal(t, "a.txt", f.FileName)
+}
+
+func TestMoveHandler_TargetNotAFolder(t *testing.T) {
+	meta, st := newMemoryMetadata(t)
+	addItem(t, st, store.File{ID: "F1", FileName: "a.txt", FileType: "text/plain", CID: "files/F1"})
+	addItem(t, st, store.File{ID: "F2", FileName: "b.txt", FileType: "text/plain", CID: "files/F2"})
+
+	req := withUser(jsonReq(t, "/move", map[string]any{"fileId": "F1", "parentId": "F2"}), "U1")
+	rr := httptest.NewRecorder()
+	meta.MoveHandler(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestMoveHandler_NotOwner(t *testing.T) {
+	meta, st := newMemoryMetadata(t)
+	addItem(t, st, store.File{ID: "F1", FileName: "a.txt", FileType: "text/plain", CID: "files/F1"})
+
+	req := withUser(jsonReq(t, "/move", map[string]any{"fileId": "F1", "name": "b.txt"}), "U2")
+	rr := httptest.NewRecorder()
+	meta.MoveHandler(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	f, err := st.File(context.Background(), "F1")
+	require.NoError(t, err)
+	assert.Equal(t, "a.txt", f.FileName)
+}
+
+func TestMoveHandler_NotFound(t *testing.T) {
+	meta, _ := newMemoryMetadata(t)
+
+	req := withUser(jsonReq(t, "/move", map[string]any{"fileId": "F404", "name": "b.txt"}), "U1")
+	rr := httptest.NewRecorder()
+	meta.MoveHandler(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
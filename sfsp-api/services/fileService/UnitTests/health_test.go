@@ -0,0 +1,154 @@
+package unitTests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/health"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/storage"
+)
+
+func probe(t *testing.T, h http.HandlerFunc, path string) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h(rr, httptest.NewRequest(http.MethodGet, path, nil))
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body), rr.Body.String())
+	return rr, body
+}
+
+func TestLiveHandler_AlwaysAlive(t *testing.T) {
+	rr, body := probe(t, health.LiveHandler, "/livez")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, health.StatusAlive, body["status"])
+}
+
+func TestReadyHandler_AllUp(t *testing.T) {
+	c := health.New(time.Second)
+	c.Add("postgresql", func(context.Context) error { return nil })
+	c.Add("storage", func(context.Context) error { return nil })
+
+	rr, body := probe(t, c.ReadyHandler, "/readyz")
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, health.StatusReady, body["status"])
+	checks := body["checks"].(map[string]any)
+	for _, name := range []string{"postgresql", "storage"} {
+		check := checks[name].(map[string]any)
+		assert.Equal(t, health.StatusUp, check["status"])
+		assert.Contains(t, check, "latency_ms")
+	}
+}
+
+func TestReadyHandler_DependencyDown(t *testing.T) {
+	buf := captureLogs(t)
+	c := health.New(time.Second)
+	c.Add("postgresql", func(context.Context) error { return nil })
+	c.Add("storage", func(context.Context) error {
+		return errors.New("dial tcp owncloud.internal:8080: connection refused")
+	})
+
+	rr, body := probe(t, c.ReadyHandler, "/readyz")
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, health.StatusNotReady, body["status"])
+	checks := body["checks"].(map[string]any)
+	assert.Equal(t, health.StatusUp, checks["postgresql"].(map[string]any)["status"])
+	assert.Equal(t, health.StatusDown, checks["storage"].(map[string]any)["status"])
+	assert.NotContains(t, rr.Body.String(), "owncloud.internal", "errors are logged, not served")
+	assert.Contains(t, buf.String(), "owncloud.internal")
+}
+
+func TestReadyHandler_SlowDependencyTimesOut(t *testing.T) {
+	c := health.New(50 * time.Millisecond)
+	c.Add("postgresql", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	// ignores its context, but still counts as down once the deadline passes
+	c.Add("storage", func(context.Context) error {
+		time.Sleep(80 * time.Millisecond)
+		return nil
+	})
+
+	start := time.Now()
+	rr, body := probe(t, c.ReadyHandler, "/readyz")
+
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	checks := body["checks"].(map[string]any)
+	for _, name := range []string{"postgresql", "storage"} {
+		check := checks[name].(map[string]any)
+		assert.Equal(t, health.StatusDown, check["status"])
+		assert.GreaterOrEqual(t, check["latency_ms"].(float64), float64(50))
+	}
+}
+
+func TestLegacyHealthHandler_ReportsDegraded(t *testing.T) {
+	c := health.New(time.Second)
+	c.Add("postgresql", func(context.Context) error { return errors.New("down") })
+
+	rr, body := probe(t, c.LegacyHandler, "/health")
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "degraded", body["status"])
+	assert.Equal(t, "disconnected", body["services"].(map[string]any)["postgresql"])
+}
+
+func TestWebDAVBackend_PingSendsPropfind(t *testing.T) {
+	var method, depth, user, pass string
+	status := http.StatusMultiStatus
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, depth = r.Method, r.Header.Get("Depth")
+		user, pass, _ = r.BasicAuth()
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	b := storage.NewWebDAV(srv.URL+"/remote.php/dav/files/svc/", "svc", "pw")
+
+	require.NoError(t, b.Ping(context.Background()))
+	assert.Equal(t, "PROPFIND", method)
+	assert.Equal(t, "0", depth)
+	assert.Equal(t, "svc", user)
+	assert.Equal(t, "pw", pass)
+
+	status = http.StatusUnauthorized
+	assert.Error(t, b.Ping(context.Background()))
+}
+
+func TestWebDAVBackend_PingHonoursDeadline(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+	b := storage.NewWebDAV(srv.URL, "", "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := b.Ping(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestLocalBackend_Ping(t *testing.T) {
+	b, root := newLocalBackend(t)
+	require.NoError(t, storage.Ping(context.Background(), storage.Instrument(b, func(string, time.Duration, error) {
+		t.Error("Ping should not be reported to the observer")
+	})))
+
+	require.NoError(t, os.RemoveAll(root))
+	assert.Error(t, storage.Ping(context.Background(), b))
+}
@@ -0,0 +1,431 @@
+package unitTests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/janitor"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+)
+
+// newJanitor returns a janitor whose clock stands at now, over a memory
+// store. Tests seed stale rows with at.
+func newJanitor(t *testing.T, now time.Time) (*janitor.Janitor, *store.Memory, string) {
+	t.Helper()
+	backend, root := newLocalBackend(t)
+	st := store.NewMemory()
+	j := janitor.New(nil, backend, janitor.Config{TTL: time.Hour, Interval: time.Minute})
+	j.SetStore(st)
+	j.SetClock(func() time.Time { return now })
+	return j, st, root
+}
+
+// at stores what seed adds as if it happened at when.
+func at(st *store.Memory, when time.Time, seed func()) {
+	st.SetClock(func() time.Time { return when })
+	defer st.SetClock(time.Now)
+	seed()
+}
+
+func writeAged(t *testing.T, root, rel, content string, modTime time.Time) {
+	t.Helper()
+	full := filepath.Join(root, filepath.FromSlash(rel))
+	require.NoError(t, os.MkdirAll(filepath.Dir(full), 0755))
+	require.NoError(t, os.WriteFile(full, []byte(content), 0644))
+	require.NoError(t, os.Chtimes(full, modTime, modTime))
+}
+
+// addStored stores a complete file of ownerID, which no upload sweep touches.
+func addStored(t *testing.T, st *store.Memory, id, ownerID string, size int64) {
+	t.Helper()
+	_, err := st.AddFile(context.Background(), store.File{ID: id, OwnerID: ownerID, FileName: "a.pdf", FileSize: size, FileHash: "h", CID: "files/" + id})
+	require.NoError(t, err)
+}
+
+// completedDuringSweep is a store where f3's upload completes right after
+// the orphaned uploads were listed.
+type completedDuringSweep struct{ store.Store }
+
+func (s completedDuringSweep) OrphanedUploads(ctx context.Context, cutoff time.Time) ([]string, error) {
+	ids, err := s.Store.OrphanedUploads(ctx, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	return ids, s.SetFileBlob(ctx, "f3", "h", "files/f3", 3)
+}
+
+// revokedDuringSweep is a store where the owner revokes L2 right after the
+// used-up links were listed.
+type revokedDuringSweep struct{ store.Store }
+
+func (s revokedDuringSweep) UsedUpShareLinks(ctx context.Context, now time.Time) ([]store.ShareLink, error) {
+	links, err := s.Store.UsedUpShareLinks(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.RevokeShareLink(ctx, "U1", "L2")
+	return links, err
+}
+
+// sessionQueryFails is a store that cannot list stale upload sessions.
+type sessionQueryFails struct{ store.Store }
+
+func (sessionQueryFails) StaleUploadSessions(context.Context, time.Time) ([]store.UploadSession, error) {
+	return nil, errStore
+}
+
+func TestJanitor_ReclaimsStaleSession(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	j, st, root := newJanitor(t, now)
+	old := now.Add(-2 * time.Hour)
+
+	at(st, old, func() {
+		_, err := st.AddFile(ctx, store.File{ID: "f1", OwnerID: "U1", FileName: "a.pdf"})
+		require.NoError(t, err)
+		require.NoError(t, st.AddUploadSession(ctx, store.UploadSession{FileID: "f1", OwnerID: "U1", TotalChunks: 3}))
+		require.NoError(t, st.RecordUploadChunk(ctx, "f1", store.UploadChunk{Index: 0, Size: 4}))
+		require.NoError(t, st.RecordUploadChunk(ctx, "f1", store.UploadChunk{Index: 1, Size: 6}))
+	})
+	writeAged(t, root, "temp/f1_chunk_0", "aaaa", old)
+	writeAged(t, root, "temp/f1_chunk_1", "bbbbbb", old)
+	writeAged(t, root, "temp/f1_chunk_2", "unrecorded", old)
+
+	report, err := j.RunOnce(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.StaleSessions)
+	assert.Equal(t, 1, report.FileRowsDeleted)
+	assert.Equal(t, 2, report.TempChunksDeleted)
+	assert.Equal(t, int64(10), report.BytesReclaimed)
+	assert.Empty(t, report.Errors)
+
+	entries, err := os.ReadDir(filepath.Join(root, "temp"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	_, err = st.UploadSession(ctx, "f1")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	_, err = st.File(ctx, "f1")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func TestJanitor_DeletesOrphanedFileRows(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	j, st, _ := newJanitor(t, now)
+	j.SetStore(completedDuringSweep{st})
+
+	at(st, now.Add(-2*time.Hour), func() {
+		for _, id := range []string{"f2", "f3"} {
+			_, err := st.AddFile(ctx, store.File{ID: id, OwnerID: "U1", FileName: id})
+			require.NoError(t, err)
+		}
+		addStored(t, st, "f4", "U1", 10)
+	})
+	// too recent to be abandoned
+	_, err := st.AddFile(ctx, store.File{ID: "f5", OwnerID: "U1", FileName: "f5"})
+	require.NoError(t, err)
+
+	report, err := j.RunOnce(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.FileRowsDeleted)
+	assert.Equal(t, 0, report.TempChunksDeleted)
+	_, err = st.File(ctx, "f2")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	// f3 completed between the query and the delete, so it is kept.
+	for _, id := range []string{"f3", "f4", "f5"} {
+		_, err = st.File(ctx, id)
+		assert.NoError(t, err, id)
+	}
+}
+
+func TestJanitor_KeepsFreshAndLiveTempChunks(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	j, st, root := newJanitor(t, now)
+	old := now.Add(-2 * time.Hour)
+
+	_, err := st.AddFile(ctx, store.File{ID: "live", OwnerID: "U1", FileName: "live"})
+	require.NoError(t, err)
+	require.NoError(t, st.AddUploadSession(ctx, store.UploadSession{FileID: "live", OwnerID: "U1", TotalChunks: 2}))
+
+	writeAged(t, root, "temp/orphan_chunk_0", "12345", old)
+	writeAged(t, root, "temp/live_chunk_0", "live", old)
+	writeAged(t, root, "temp/fresh_chunk_0", "fresh", now)
+	writeAged(t, root, "temp/notachunk", "other", old)
+
+	report, err := j.RunOnce(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.TempChunksDeleted)
+	assert.Equal(t, int64(5), report.BytesReclaimed)
+
+	_, err = os.Stat(filepath.Join(root, "temp", "orphan_chunk_0"))
+	assert.True(t, os.IsNotExist(err))
+	for _, name := range []string{"live_chunk_0", "fresh_chunk_0", "notachunk"} {
+		_, err = os.Stat(filepath.Join(root, "temp", name))
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestJanitor_ReclaimsStaleLinkUploads(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	j, st, root := newJanitor(t, now)
+	old := now.Add(-2 * time.Hour)
+
+	addStored(t, st, "F1", "U1", 10)
+	at(st, old, func() {
+		require.NoError(t, st.AddLinkUpload(ctx, store.LinkUpload{ID: "L1", FileID: "F1", OwnerID: "U1", TotalChunks: 1}))
+	})
+	require.NoError(t, st.AddLinkUpload(ctx, store.LinkUpload{ID: "L2", FileID: "F1", OwnerID: "U1", TotalChunks: 1}))
+
+	writeAged(t, root, "temp/L1_link_chunk_0", "stale", old)
+	writeAged(t, root, "temp/L2_link_chunk_0", "live", old)
+
+	report, err := j.RunOnce(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.StaleSessions)
+	assert.Equal(t, 1, report.TempChunksDeleted)
+	_, err = os.Stat(filepath.Join(root, "temp", "L1_link_chunk_0"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(root, "temp", "L2_link_chunk_0"))
+	assert.NoError(t, err)
+	_, err = st.LinkUpload(ctx, "L1")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	_, err = st.LinkUpload(ctx, "L2")
+	assert.NoError(t, err)
+}
+
+func TestJanitor_StatsHandler(t *testing.T) {
+	now := time.Now()
+	j, st, _ := newJanitor(t, now)
+	at(st, now.Add(-2*time.Hour), func() {
+		_, err := st.AddFile(context.Background(), store.File{ID: "f9", OwnerID: "U1", FileName: "f9"})
+		require.NoError(t, err)
+	})
+
+	rr := httptest.NewRecorder()
+	j.StatsHandler(rr, httptest.NewRequest(http.MethodPost, "/admin/janitor", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var report janitor.Report
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&report))
+	assert.Equal(t, 1, report.FileRowsDeleted)
+
+	rr = httptest.NewRecorder()
+	j.StatsHandler(rr, httptest.NewRequest(http.MethodGet, "/admin/janitor", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var stats janitor.Stats
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&stats))
+	assert.Equal(t, 1, stats.Runs)
+	assert.Equal(t, 1, stats.TotalFileRowsDeleted)
+	assert.Equal(t, int64(3600), stats.TTLSeconds)
+	require.NotNil(t, stats.LastRun)
+
+	rr = httptest.NewRecorder()
+	j.StatsHandler(rr, httptest.NewRequest(http.MethodDelete, "/admin/janitor", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.True(t, strings.Contains(rr.Body.String(), "Method not allowed"))
+}
+
+func TestJanitor_StatsHandler_AdminOnly(t *testing.T) {
+	j, _, _ := newJanitor(t, time.Now())
+
+	// a regular user can neither read the stats nor start a sweep
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		rr := httptest.NewRecorder()
+		j.StatsHandler(rr, withUser(httptest.NewRequest(method, "/admin/janitor", nil), "u1"))
+		assert.Equal(t, http.StatusForbidden, rr.Code, method)
+		assert.Contains(t, rr.Body.String(), "administrators only")
+	}
+	assert.Equal(t, 0, j.Stats().Runs)
+
+	rr := httptest.NewRecorder()
+	j.StatsHandler(rr, withAdmin(httptest.NewRequest(http.MethodGet, "/admin/janitor", nil), "root"))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestJanitor_QueryFailureAbortsSweep(t *testing.T) {
+	j, st, _ := newJanitor(t, time.Now())
+	j.SetStore(sessionQueryFails{st})
+
+	_, err := j.RunOnce(context.Background())
+	assert.ErrorIs(t, err, errStore)
+	assert.Equal(t, 0, j.Stats().Runs)
+}
+
+func TestJanitor_PurgesExpiredTrash(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	j, st, root := newJanitor(t, now)
+
+	for id, size := range map[string]int64{"t1": 10, "t2": 4, "t3": 1} {
+		addStored(t, st, id, "U1", size)
+	}
+	_, err := st.AddReceivedFile(ctx, store.ReceivedFile{ID: "r1", FileID: "t1", SenderID: "U1", RecipientID: "U2", Metadata: "{}"})
+	require.NoError(t, err)
+	at(st, now.Add(-janitor.DefaultConfig.TrashRetention-time.Hour), func() {
+		require.NoError(t, st.TrashFile(ctx, "t1"))
+		require.NoError(t, st.TrashFile(ctx, "t2"))
+	})
+	// t3 has not been in the trash long enough
+	require.NoError(t, st.TrashFile(ctx, "t3"))
+
+	writeAged(t, root, "files/t1", "ciphertext", now)
+	writeAged(t, root, "versions/t1/1", "older", now)
+	writeAged(t, root, "links/t1/L1", "link copy", now)
+	// t2's blob is already gone, which does not stop the purge
+
+	report, err := j.RunOnce(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, report.TrashPurged)
+	assert.Equal(t, int64(10+5+9+4), report.BytesReclaimed)
+	assert.Empty(t, report.Errors)
+	for _, rel := range []string{"files/t1", "versions/t1/1", "links/t1/L1"} {
+		_, err = os.Stat(filepath.Join(root, filepath.FromSlash(rel)))
+		assert.True(t, os.IsNotExist(err), rel)
+	}
+	for _, id := range []string{"t1", "t2"} {
+		_, err = st.File(ctx, id)
+		assert.ErrorIs(t, err, store.ErrNotFound, id)
+	}
+	_, err = st.ReceivedFile(ctx, "r1")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	trashed, err := st.FileTrashed(ctx, "t3")
+	require.NoError(t, err)
+	assert.True(t, trashed)
+}
+
+func TestJanitor_ExpiresShareLinks(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	j, st, root := newJanitor(t, now)
+	j.SetStore(revokedDuringSweep{st})
+
+	addStored(t, st, "F1", "U1", 10)
+	expired := now.Add(-time.Minute)
+	for _, l := range []store.ShareLink{
+		{ID: "L1", TokenHash: "t1", ExpiresAt: &expired},
+		// L2 is revoked by its owner while the sweep runs
+		{ID: "L2", TokenHash: "t2", ExpiresAt: &expired},
+		{ID: "L3", TokenHash: "t3"},
+	} {
+		l.FileID, l.OwnerID, l.BlobPath = "F1", "U1", "links/F1/"+l.ID
+		require.NoError(t, st.AddShareLink(ctx, l))
+		require.NoError(t, st.RecordBlobHash(ctx, store.BlobHash{Path: l.BlobPath, FileID: "F1", SHA256: "h", Size: 9}))
+	}
+	writeAged(t, root, "links/F1/L1", "link copy", now)
+
+	report, err := j.RunOnce(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.SharesExpired)
+	assert.Empty(t, report.Errors)
+	_, err = os.Stat(filepath.Join(root, "links", "F1", "L1"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = st.BlobHash(ctx, "links/F1/L1")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	l1, err := st.ShareLinkByToken(ctx, "t1")
+	require.NoError(t, err)
+	assert.True(t, l1.Revoked)
+	l3, err := st.ShareLinkByToken(ctx, "t3")
+	require.NoError(t, err)
+	assert.False(t, l3.Revoked)
+}
+
+// shareExpiredNotices returns the messages of the share expiry notices sent
+// to userID.
+func shareExpiredNotices(t *testing.T, st *store.Memory, userID string) []string {
+	t.Helper()
+	notices, err := st.ListNotifications(context.Background(), userID, memoryPage(t, api.PageRequest{}))
+	require.NoError(t, err)
+	messages := []string{}
+	for _, n := range notices {
+		if n.Type == "share_expired" {
+			messages = append(messages, n.Message)
+		}
+	}
+	return messages
+}
+
+func TestJanitor_ExpiresShares(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	j, st, root := newJanitor(t, now)
+
+	for _, id := range []string{"F1", "F2", "F3"} {
+		addStored(t, st, id, "S", 10)
+	}
+	expired := now.Add(-time.Minute)
+	for _, r := range []store.ReceivedFile{
+		{ID: "r1", FileID: "F1", RecipientID: "R", ExpiresAt: &expired},
+		// F1's sent copy is still used by another recipient's live share
+		{ID: "r3", FileID: "F1", RecipientID: "R2"},
+		{ID: "r2", FileID: "F2", RecipientID: "R", ExpiresAt: &expired},
+	} {
+		r.SenderID, r.Metadata = "S", "{}"
+		_, err := st.AddReceivedFile(ctx, r)
+		require.NoError(t, err)
+	}
+	_, err := st.AddViewShare(ctx, store.ViewShare{ID: "v1", FileID: "F3", SenderID: "S", RecipientID: "R", ExpiresAt: &expired, AccessGranted: true})
+	require.NoError(t, err)
+
+	for rel, content := range map[string]string{
+		"files/S/sent/F1":          "still sent to someone else",
+		"files/S/sent/F2":          "ciphertext",
+		"files/S/shared_view/F3_R": "view copy",
+	} {
+		writeAged(t, root, rel, content, now)
+		require.NoError(t, st.RecordBlobHash(ctx, store.BlobHash{Path: rel, FileID: "F1", SHA256: "h", Size: int64(len(content))}))
+	}
+
+	report, err := j.RunOnce(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, report.SharesExpired)
+	assert.Empty(t, report.Errors)
+	_, err = os.Stat(filepath.Join(root, "files", "S", "sent", "F1"))
+	assert.NoError(t, err)
+	_, err = st.BlobHash(ctx, "files/S/sent/F1")
+	assert.NoError(t, err)
+	for _, rel := range []string{"files/S/sent/F2", "files/S/shared_view/F3_R"} {
+		_, err = os.Stat(filepath.Join(root, filepath.FromSlash(rel)))
+		assert.True(t, os.IsNotExist(err), rel)
+		_, err = st.BlobHash(ctx, rel)
+		assert.ErrorIs(t, err, store.ErrNotFound, rel)
+	}
+
+	for id, live := range map[string]bool{"r1": false, "r2": false, "r3": true} {
+		r, err := st.ReceivedFile(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, live, r.ExpiredAt == nil, id)
+	}
+	v, err := st.ViewShare(ctx, "S", "R", "F3")
+	require.NoError(t, err)
+	assert.NotNil(t, v.ExpiredAt)
+	assert.False(t, v.AccessGranted)
+
+	assert.Equal(t, []string{
+		"Your access to a.pdf has expired",
+		"Your access to a.pdf has expired",
+		"Your access to a.pdf has expired",
+	}, shareExpiredNotices(t, st, "R"))
+	assert.Len(t, shareExpiredNotices(t, st, "S"), 3)
+}
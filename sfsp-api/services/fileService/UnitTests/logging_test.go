@@ -0,0 +1,148 @@
+package unitTests
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureLogs makes a debug-level JSON logger writing to the returned buffer
+// the default for the rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.Config{Level: "debug"})
+	require.NoError(t, err)
+	prev := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	sc := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+	for sc.Scan() {
+		var rec map[string]any
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &rec), sc.Text())
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestLogging_RedactsSecrets(t *testing.T) {
+	buf := captureLogs(t)
+
+	slog.Info("Share created",
+		"user_id", "U1",
+		"nonce", "bm9uY2U=",
+		"encryptedFileKey", "a2V5",
+		"metadata", `{"fileName":"taxes.pdf"}`,
+		slog.Group("x3dh", "ikPublicKey", "aWs=", "opk_id", "OPK1"),
+	)
+
+	records := logRecords(t, buf)
+	require.Len(t, records, 1)
+	rec := records[0]
+	assert.Equal(t, "U1", rec["user_id"])
+	assert.Equal(t, logging.Redacted, rec["nonce"])
+	assert.Equal(t, logging.Redacted, rec["encryptedFileKey"])
+	assert.Equal(t, logging.Redacted, rec["metadata"])
+	group := rec["x3dh"].(map[string]any)
+	assert.Equal(t, logging.Redacted, group["ikPublicKey"])
+	assert.Equal(t, "OPK1", group["opk_id"])
+	assert.NotContains(t, buf.String(), "taxes.pdf")
+}
+
+func TestLogging_RejectsUnknownLevel(t *testing.T) {
+	_, err := logging.New(&bytes.Buffer{}, logging.Config{Level: "loud"})
+	assert.Error(t, err)
+	_, err = logging.New(&bytes.Buffer{}, logging.Config{Format: "xml"})
+	assert.Error(t, err)
+}
+
+func TestLoggingMiddleware_RequestID(t *testing.T) {
+	rt := api.NewRouter(api.Version1)
+	rt.HandleFunc(http.MethodGet, "/logging-test/{token}", func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Info("inside handler")
+		api.Error(w, "Link not found", http.StatusNotFound)
+	})
+	h := logging.Middleware(rt, rt.Pattern)
+
+	t.Run("keeps the gateway's ID", func(t *testing.T) {
+		buf := captureLogs(t)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/logging-test/SECRET-TOKEN", nil)
+		req.Header.Set(logging.RequestIDHeader, "gw-7f3a")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		assert.Equal(t, "gw-7f3a", rr.Header().Get(logging.RequestIDHeader))
+		records := logRecords(t, buf)
+		require.Len(t, records, 2)
+		assert.Equal(t, "inside handler", records[0]["msg"])
+		for _, rec := range records {
+			assert.Equal(t, "gw-7f3a", rec["request_id"])
+		}
+		access := records[1]
+		assert.Equal(t, "request", access["msg"])
+		assert.Equal(t, "INFO", access["level"])
+		assert.Equal(t, "/api/v1/logging-test/{token}", access["route"])
+		assert.Equal(t, float64(http.StatusNotFound), access["status"])
+		assert.NotContains(t, buf.String(), "SECRET-TOKEN", "paths are not logged")
+	})
+
+	t.Run("replaces a missing or malformed ID", func(t *testing.T) {
+		for _, id := range []string{"", "two words", strings.Repeat("a", 129)} {
+			buf := captureLogs(t)
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/logging-test/T", nil)
+			req.Header.Set(logging.RequestIDHeader, id)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			got := rr.Header().Get(logging.RequestIDHeader)
+			assert.Regexp(t, `^[0-9a-f]{32}$`, got)
+			for _, rec := range logRecords(t, buf) {
+				assert.Equal(t, got, rec["request_id"])
+			}
+		}
+	})
+}
+
+func TestUpdateFileHandler_ShortNonceIsNotLogged(t *testing.T) {
+	buf := captureLogs(t)
+	srv, st, b := newMemoryServer(t)
+	require.NoError(t, b.WriteStream("files/F1", strings.NewReader("old ciphertext")))
+	addItem(t, st, store.File{ID: "F1", OwnerID: "U1", FileName: "report.pdf", Nonce: "OLD-NONCE",
+		FileHash: sha256Hex("old ciphertext"), FileSize: int64(len("old ciphertext"))})
+
+	// shorter than the 20 characters the handler used to slice off
+	nonce := "SHORT-NONCE"
+
+	rr := httptest.NewRecorder()
+	require.NotPanics(t, func() {
+		srv.UpdateFileHandler(rr, jsonReq(t, "/updateFile", map[string]string{
+			"userId":      "U1",
+			"fileId":      "F1",
+			"nonce":       nonce,
+			"fileContent": base64.StdEncoding.EncodeToString([]byte("ciphertext")),
+		}))
+	})
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.NotEmpty(t, buf.String())
+	assert.NotContains(t, buf.String(), nonce)
+	assert.NotContains(t, buf.String(), "OLD-NONCE")
+}
@@ -0,0 +1,107 @@
+package unitTests
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metrics"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+	return rr.Body.String()
+}
+
+func TestMetricsMiddleware_CountsByRoute(t *testing.T) {
+	rt := api.NewRouter(api.Version1)
+	rt.HandleFunc(http.MethodGet, "/metrics-test/{id}", func(w http.ResponseWriter, r *http.Request) {
+		api.Error(w, "File not found", http.StatusNotFound)
+	})
+	h := metrics.Middleware(rt, rt.Pattern)
+
+	for _, path := range []string{"/api/v1/metrics-test/a", "/api/v1/metrics-test/b", "/api/v1/no-such-route"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	out := scrape(t)
+	assert.Contains(t, out, "# TYPE fileservice_http_requests_total counter")
+	assert.Contains(t, out, `fileservice_http_requests_total{method="GET",route="/api/v1/metrics-test/{id}",status="404"} 2`)
+	assert.Contains(t, out, `fileservice_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, out, `fileservice_http_request_duration_seconds_bucket{method="GET",route="/api/v1/metrics-test/{id}",le="+Inf"} 2`)
+	assert.Contains(t, out, `fileservice_http_request_duration_seconds_count{method="GET",route="/api/v1/metrics-test/{id}"} 2`)
+}
+
+func TestMetricsHistogram_CumulativeBuckets(t *testing.T) {
+	h := metrics.NewHistogramVec("fileservice_test_histogram_seconds", "Test histogram.", []float64{1, 2}, "op")
+	h.With("a").Observe(0.5)
+	h.With("a").Observe(1.5)
+	h.With("a").Observe(5)
+
+	out := scrape(t)
+	assert.Contains(t, out, `fileservice_test_histogram_seconds_bucket{op="a",le="1"} 1`)
+	assert.Contains(t, out, `fileservice_test_histogram_seconds_bucket{op="a",le="2"} 2`)
+	assert.Contains(t, out, `fileservice_test_histogram_seconds_bucket{op="a",le="+Inf"} 3`)
+	assert.Contains(t, out, `fileservice_test_histogram_seconds_sum{op="a"} 7`)
+}
+
+func TestMetricsLabels_Escaped(t *testing.T) {
+	c := metrics.NewCounterVec("fileservice_test_escaped_total", "Test counter.", "path")
+	c.With("a\"b\\c\nd").Inc()
+	assert.Contains(t, scrape(t), `fileservice_test_escaped_total{path="a\"b\\c\nd"} 1`)
+}
+
+func TestStartMerge_FinishesOnce(t *testing.T) {
+	finish := metrics.StartMerge(metrics.KindUpload)
+	assert.Contains(t, scrape(t), `fileservice_chunk_merges_in_progress{kind="upload"} 1`)
+
+	finish(true)
+	finish(false)
+	out := scrape(t)
+	assert.Contains(t, out, `fileservice_chunk_merges_in_progress{kind="upload"} 0`)
+	assert.Contains(t, out, `fileservice_chunk_merge_duration_seconds_count{kind="upload",result="ok"} 1`)
+	assert.NotContains(t, out, `fileservice_chunk_merge_duration_seconds_count{kind="upload",result="error"}`)
+}
+
+func TestInstrumentedBackend_ReportsCalls(t *testing.T) {
+	local, _ := newLocalBackend(t)
+	var calls []string
+	var failed []string
+	b := storage.Instrument(local, func(op string, elapsed time.Duration, err error) {
+		calls = append(calls, op)
+		if err != nil {
+			failed = append(failed, op)
+		}
+	})
+
+	require.NoError(t, b.WriteStream("files/F1", strings.NewReader("hello")))
+	rc, err := b.ReadStream("files/F1")
+	require.NoError(t, err)
+	_ = rc.Close()
+	rc, err = storage.ReadRange(b, "files/F1", 1, 3)
+	require.NoError(t, err)
+	part, _ := io.ReadAll(rc)
+	_ = rc.Close()
+	assert.Equal(t, "ell", string(part))
+	require.NoError(t, b.Remove("files/F1"))
+	_, err = b.ReadStream("files/F1")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+	assert.Equal(t, []string{"WriteStream", "ReadStream", "ReadRange", "Remove", "ReadStream"}, calls)
+	assert.Equal(t, []string{"ReadStream"}, failed)
+	_, isLister := b.(storage.Lister)
+	assert.True(t, isLister)
+}
@@ -0,0 +1,143 @@
+package unitTests
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/migrations"
+)
+
+func newMigrationDB(t *testing.T) (sqlmock.Sqlmock, func() (int, error), func(int) (int, error)) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_version`).WillReturnResult(sqlmock.NewResult(0, 0))
+	up := func() (int, error) { return migrations.Up(context.Background(), db) }
+	down := func(steps int) (int, error) { return migrations.Down(context.Background(), db, steps) }
+	return mock, up, down
+}
+
+// expectStep expects a migration transaction to start and read version.
+func expectStep(mock sqlmock.Sqlmock, version int) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock\(\$1\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\) FROM schema_version`).
+		WillReturnRows(sqlmock.NewRows([]string{"v"}).AddRow(version))
+}
+
+func TestMigrations_All(t *testing.T) {
+	all, err := migrations.All()
+	require.NoError(t, err)
+	require.NotEmpty(t, all)
+
+	for i, m := range all {
+		assert.Equal(t, i+1, m.Version)
+		assert.NotEmpty(t, m.Up, m.Name)
+		assert.NotEmpty(t, m.Down, m.Name)
+	}
+	assert.Equal(t, "base", all[0].Name)
+	for _, table := range []string{"users", "one_time_pre_keys", "files", "received_files",
+		"sent_files", "shared_files_view", "access_logs", "notifications"} {
+		assert.Contains(t, all[0].Up, "CREATE TABLE IF NOT EXISTS "+table+" ", table)
+	}
+}
+
+func TestMigrations_UpAppliesPending(t *testing.T) {
+	all, err := migrations.All()
+	require.NoError(t, err)
+	mock, up, _ := newMigrationDB(t)
+
+	// the first migration is already in place
+	expectStep(mock, 1)
+	mock.ExpectRollback()
+	for _, m := range all[1:] {
+		expectStep(mock, m.Version-1)
+		mock.ExpectExec(regexp.QuoteMeta(m.Up)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`INSERT INTO schema_version \(version, name\) VALUES \(\$1, \$2\)`).
+			WithArgs(m.Version, m.Name).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+
+	applied, err := up()
+	require.NoError(t, err)
+	assert.Equal(t, len(all)-1, applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrations_UpUpToDate(t *testing.T) {
+	all, err := migrations.All()
+	require.NoError(t, err)
+	mock, up, _ := newMigrationDB(t)
+	for range all {
+		expectStep(mock, len(all))
+		mock.ExpectRollback()
+	}
+
+	applied, err := up()
+	require.NoError(t, err)
+	assert.Zero(t, applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrations_UpFailureRollsBack(t *testing.T) {
+	all, err := migrations.All()
+	require.NoError(t, err)
+	mock, up, _ := newMigrationDB(t)
+	expectStep(mock, 0)
+	mock.ExpectExec(regexp.QuoteMeta(all[0].Up)).WillReturnError(errors.New("syntax error"))
+	mock.ExpectRollback()
+
+	applied, err := up()
+	assert.Zero(t, applied)
+	assert.ErrorContains(t, err, "migration 1_base up: syntax error")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrations_DownRevertsNewest(t *testing.T) {
+	all, err := migrations.All()
+	require.NoError(t, err)
+	mock, _, down := newMigrationDB(t)
+	latest := len(all)
+	for _, m := range []migrations.Migration{all[latest-1], all[latest-2]} {
+		expectStep(mock, m.Version)
+		mock.ExpectExec(regexp.QuoteMeta(m.Down)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`DELETE FROM schema_version WHERE version = \$1`).
+			WithArgs(m.Version).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+
+	reverted, err := down(2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, reverted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrations_DownStopsAtEmpty(t *testing.T) {
+	mock, _, down := newMigrationDB(t)
+	expectStep(mock, 0)
+	mock.ExpectRollback()
+
+	reverted, err := down(3)
+	require.NoError(t, err)
+	assert.Zero(t, reverted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrations_DownRefusesUnknownVersion(t *testing.T) {
+	all, err := migrations.All()
+	require.NoError(t, err)
+	mock, _, down := newMigrationDB(t)
+	expectStep(mock, len(all)+1)
+	mock.ExpectRollback()
+
+	_, err = down(1)
+	assert.ErrorContains(t, err, "newer than this binary")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
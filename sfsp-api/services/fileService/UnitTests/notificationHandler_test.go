@@ -12,27 +12,26 @@ import (
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	fh "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
 )
 
 func TestNotificationHandler_Success(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
+	srv, mock, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	userID := "user-123"
 	
-	rows := sqlmock.NewRows([]string{"id", "type", "from", "to", "file_name", "file_id", "message", "timestamp", "status", "read"}).
-		AddRow("notif-1", "share_request", "sender-1", "user-123", "document.pdf", "file-1", "File shared with you", time.Now(), "pending", false).
-		AddRow("notif-2", "file_received", "sender-2", "user-123", "image.jpg", "file-2", "File received", time.Now(), "accepted", true)
+	rows := sqlmock.NewRows([]string{"id", "type", "from", "to", "file_name", "file_id", "message", "timestamp", "status", "read", "received_file_id", "sort_key"}).
+		AddRow("notif-1", "share_request", "sender-1", "user-123", "document.pdf", "file-1", "File shared with you", time.Now(), "pending", false, nil, "2025-09-02").
+		AddRow("notif-2", "file_received", "sender-2", "user-123", "image.jpg", "file-2", "File received", time.Now(), "accepted", true, nil, "2025-09-01")
 
-	mock.ExpectQuery(`SELECT id, type, "from", "to", file_name, file_id, message, timestamp, status, read FROM notifications WHERE "to" = \$1`).
-		WithArgs(userID).
+	mock.ExpectQuery(`SELECT id, type, "from", "to", file_name, file_id, message, timestamp, status, read, .* FROM notifications WHERE "to" = \$1`).
+		WithArgs(userID, 101).
 		WillReturnRows(rows)
 
 	req := httptest.NewRequest(http.MethodGet, "/notifications?id="+userID, nil)
 	rr := httptest.NewRecorder()
 
-	fh.NotificationHandler(rr, req)
+	srv.NotificationHandler(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code)
 
@@ -45,13 +44,13 @@ func TestNotificationHandler_Success(t *testing.T) {
 }
 
 func TestNotificationHandler_WrongMethod(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, _, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	req := httptest.NewRequest(http.MethodPost, "/notifications", nil)
 	rr := httptest.NewRecorder()
 
-	fh.NotificationHandler(rr, req)
+	srv.NotificationHandler(rr, req)
 
 	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
 
@@ -62,13 +61,13 @@ func TestNotificationHandler_WrongMethod(t *testing.T) {
 }
 
 func TestNotificationHandler_MissingUserID(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, _, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	req := httptest.NewRequest(http.MethodGet, "/notifications", nil)
 	rr := httptest.NewRecorder()
 
-	fh.NotificationHandler(rr, req)
+	srv.NotificationHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 
@@ -79,40 +78,40 @@ func TestNotificationHandler_MissingUserID(t *testing.T) {
 }
 
 func TestNotificationHandler_DBError(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
+	srv, mock, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	userID := "user-123"
 
-	mock.ExpectQuery(`SELECT id, type, "from", "to", file_name, file_id, message, timestamp, status, read FROM notifications WHERE "to" = \$1`).
-		WithArgs(userID).
+	mock.ExpectQuery(`SELECT id, type, "from", "to", file_name, file_id, message, timestamp, status, read, .* FROM notifications WHERE "to" = \$1`).
+		WithArgs(userID, 101).
 		WillReturnError(sql.ErrConnDone)
 
 	req := httptest.NewRequest(http.MethodGet, "/notifications?id="+userID, nil)
 	rr := httptest.NewRecorder()
 
-	fh.NotificationHandler(rr, req)
+	srv.NotificationHandler(rr, req)
 
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestNotificationHandler_EmptyResult(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
+	srv, mock, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	userID := "user-123"
 	
-	rows := sqlmock.NewRows([]string{"id", "type", "from", "to", "file_name", "file_id", "message", "timestamp", "status", "read"})
+	rows := sqlmock.NewRows([]string{"id", "type", "from", "to", "file_name", "file_id", "message", "timestamp", "status", "read", "received_file_id", "sort_key"})
 
-	mock.ExpectQuery(`SELECT id, type, "from", "to", file_name, file_id, message, timestamp, status, read FROM notifications WHERE "to" = \$1`).
-		WithArgs(userID).
+	mock.ExpectQuery(`SELECT id, type, "from", "to", file_name, file_id, message, timestamp, status, read, .* FROM notifications WHERE "to" = \$1`).
+		WithArgs(userID, 101).
 		WillReturnRows(rows)
 
 	req := httptest.NewRequest(http.MethodGet, "/notifications?id="+userID, nil)
 	rr := httptest.NewRecorder()
 
-	fh.NotificationHandler(rr, req)
+	srv.NotificationHandler(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code)
 
@@ -125,7 +124,7 @@ func TestNotificationHandler_EmptyResult(t *testing.T) {
 }
 
 func TestMarkAsReadHandler_Success(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
+	srv, mock, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	notificationID := "notif-123"
@@ -138,7 +137,7 @@ func TestMarkAsReadHandler_Success(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/notifications/mark-read", body)
 	rr := httptest.NewRecorder()
 
-	fh.MarkAsReadHandler(rr, req)
+	srv.MarkAsReadHandler(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code)
 
@@ -151,39 +150,39 @@ func TestMarkAsReadHandler_Success(t *testing.T) {
 }
 
 func TestMarkAsReadHandler_WrongMethod(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, _, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	req := httptest.NewRequest(http.MethodGet, "/notifications/mark-read", nil)
 	rr := httptest.NewRecorder()
 
-	fh.MarkAsReadHandler(rr, req)
+	srv.MarkAsReadHandler(rr, req)
 
 	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
 }
 
 func TestMarkAsReadHandler_BadJSON(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, _, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	req := httptest.NewRequest(http.MethodPost, "/notifications/mark-read", strings.NewReader("{bad json"))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
-	fh.MarkAsReadHandler(rr, req)
+	srv.MarkAsReadHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestMarkAsReadHandler_MissingID(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, _, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	body := map[string]string{"id": ""}
 	req := NewJSONRequest(t, http.MethodPost, "/notifications/mark-read", body)
 	rr := httptest.NewRecorder()
 
-	fh.MarkAsReadHandler(rr, req)
+	srv.MarkAsReadHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 
@@ -193,7 +192,7 @@ func TestMarkAsReadHandler_MissingID(t *testing.T) {
 }
 
 func TestMarkAsReadHandler_NotificationNotFound(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
+	srv, mock, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	notificationID := "nonexistent"
@@ -206,14 +205,14 @@ func TestMarkAsReadHandler_NotificationNotFound(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/notifications/mark-read", body)
 	rr := httptest.NewRecorder()
 
-	fh.MarkAsReadHandler(rr, req)
+	srv.MarkAsReadHandler(rr, req)
 
 	require.Equal(t, http.StatusNotFound, rr.Code)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestMarkAsReadHandler_DBError(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
+	srv, mock, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	notificationID := "notif-123"
@@ -226,14 +225,25 @@ func TestMarkAsReadHandler_DBError(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/notifications/mark-read", body)
 	rr := httptest.NewRecorder()
 
-	fh.MarkAsReadHandler(rr, req)
+	srv.MarkAsReadHandler(rr, req)
 
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+var notificationRowColumns = []string{"id", "type", "from", "to", "file_name", "file_id", "message", "timestamp", "status", "read", "received_file_id"}
+
+// expectFileRow expects the store to read one file record.
+func expectFileRow(mock sqlmock.Sqlmock, fileID, name string) {
+	mock.ExpectQuery(`SELECT id, owner_id, file_name, .* FROM files WHERE id = \$1`).
+		WithArgs(fileID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id", "file_name", "file_type", "file_hash", "nonce", "description",
+			"tags", "cid", "file_size", "allow_view_sharing", "parent_id", "created_at", "corrupted_at", "deleted_at"}).
+			AddRow(fileID, "sender-1", name, "application/pdf", "", "", "", "{}", "QmTest123", int64(1024), false, nil, time.Now(), nil, nil))
+}
+
 func TestRespondToShareRequestHandler_AcceptedWithReceivedFile(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
+	srv, mock, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	notificationID := "notif-123"
@@ -243,32 +253,23 @@ func TestRespondToShareRequestHandler_AcceptedWithReceivedFile(t *testing.T) {
 		WithArgs(status, notificationID).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	notifRows := sqlmock.NewRows([]string{"file_id", "from", "to", "received_file_id"}).
-		AddRow("file-123", "sender-1", "recipient-1", "received-456")
-
-	mock.ExpectQuery(`SELECT n\.file_id, n\."from", n\."to", n\."received_file_id" FROM notifications n WHERE n\.id = \$1`).
+	mock.ExpectQuery(`SELECT id, type, "from", "to", .* FROM notifications WHERE id = \$1`).
 		WithArgs(notificationID).
-		WillReturnRows(notifRows)
-
-	metadataRows := sqlmock.NewRows([]string{"metadata"}).
-		AddRow(`{"key": "encrypted_key"}`)
+		WillReturnRows(sqlmock.NewRows(notificationRowColumns).
+			AddRow(notificationID, "share_request", "sender-1", "recipient-1", "document.pdf", "file-123", "", time.Now(), status, true, "received-456"))
 
-	mock.ExpectQuery(`SELECT metadata FROM received_files WHERE file_id = \$1 AND recipient_id = \$2 AND id = \$3`).
-		WithArgs("file-123", "recipient-1", "received-456").
-		WillReturnRows(metadataRows)
+	mock.ExpectQuery(`SELECT id, recipient_id, sender_id, file_id, metadata, .* FROM received_files WHERE id = \$1`).
+		WithArgs("received-456").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "recipient_id", "sender_id", "file_id", "metadata", "accepted", "received_at", "expires_at", "expired_at"}).
+			AddRow("received-456", "recipient-1", "sender-1", "file-123", `{"key": "encrypted_key"}`, false, time.Now(), nil, nil))
 
-	fileRows := sqlmock.NewRows([]string{"file_name", "file_type", "cid", "file_size"}).
-		AddRow("document.pdf", "application/pdf", "QmTest123", int64(1024))
-
-	mock.ExpectQuery(`SELECT file_name, file_type, cid, file_size FROM files WHERE id = \$1`).
-		WithArgs("file-123").
-		WillReturnRows(fileRows)
+	expectFileRow(mock, "file-123", "document.pdf")
 
 	body := map[string]string{"id": notificationID, "status": status}
 	req := NewJSONRequest(t, http.MethodPost, "/notifications/respond", body)
 	rr := httptest.NewRecorder()
 
-	fh.RespondToShareRequestHandler(rr, req)
+	srv.RespondToShareRequestHandler(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code)
 
@@ -286,7 +287,7 @@ func TestRespondToShareRequestHandler_AcceptedWithReceivedFile(t *testing.T) {
 }
 
 func TestRespondToShareRequestHandler_AcceptedViewOnly(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
+	srv, mock, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	notificationID := "notif-123"
@@ -296,32 +297,23 @@ func TestRespondToShareRequestHandler_AcceptedViewOnly(t *testing.T) {
 		WithArgs(status, notificationID).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	notifRows := sqlmock.NewRows([]string{"file_id", "from", "to", "received_file_id"}).
-		AddRow("file-123", "sender-1", "recipient-1", sql.NullString{Valid: false})
-
-	mock.ExpectQuery(`SELECT n\.file_id, n\."from", n\."to", n\."received_file_id" FROM notifications n WHERE n\.id = \$1`).
+	mock.ExpectQuery(`SELECT id, type, "from", "to", .* FROM notifications WHERE id = \$1`).
 		WithArgs(notificationID).
-		WillReturnRows(notifRows)
+		WillReturnRows(sqlmock.NewRows(notificationRowColumns).
+			AddRow(notificationID, "share_request", "sender-1", "recipient-1", "document.pdf", "file-123", "", time.Now(), status, true, sql.NullString{Valid: false}))
 
-	metadataRows := sqlmock.NewRows([]string{"metadata"}).
-		AddRow(`{"view_key": "view_encrypted_key"}`)
-
-	mock.ExpectQuery(`SELECT metadata FROM shared_files_view WHERE sender_id = \$1 AND recipient_id = \$2 AND file_id = \$3`).
+	mock.ExpectQuery(`SELECT id, sender_id, recipient_id, file_id, .* FROM shared_files_view WHERE sender_id = \$1 AND recipient_id = \$2 AND file_id = \$3`).
 		WithArgs("sender-1", "recipient-1", "file-123").
-		WillReturnRows(metadataRows)
-
-	fileRows := sqlmock.NewRows([]string{"file_name", "file_type", "cid", "file_size"}).
-		AddRow("document.pdf", "application/pdf", "QmTest123", int64(1024))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sender_id", "recipient_id", "file_id", "newfile_id", "metadata", "shared_at", "expires_at", "expired_at", "revoked", "revoked_at", "access_granted"}).
+			AddRow("view-1", "sender-1", "recipient-1", "file-123", nil, `{"view_key": "view_encrypted_key"}`, time.Now(), nil, nil, false, nil, true))
 
-	mock.ExpectQuery(`SELECT file_name, file_type, cid, file_size FROM files WHERE id = \$1`).
-		WithArgs("file-123").
-		WillReturnRows(fileRows)
+	expectFileRow(mock, "file-123", "document.pdf")
 
 	body := map[string]string{"id": notificationID, "status": status}
 	req := NewJSONRequest(t, http.MethodPost, "/notifications/respond", body)
 	rr := httptest.NewRecorder()
 
-	fh.RespondToShareRequestHandler(rr, req)
+	srv.RespondToShareRequestHandler(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code)
 
@@ -336,7 +328,7 @@ func TestRespondToShareRequestHandler_AcceptedViewOnly(t *testing.T) {
 }
 
 func TestRespondToShareRequestHandler_DeclinedStatus(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
+	srv, mock, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	notificationID := "notif-123"
@@ -350,33 +342,33 @@ func TestRespondToShareRequestHandler_DeclinedStatus(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/notifications/respond", body)
 	rr := httptest.NewRecorder()
 
-	fh.RespondToShareRequestHandler(rr, req)
+	srv.RespondToShareRequestHandler(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestRespondToShareRequestHandler_WrongMethod(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, _, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	req := httptest.NewRequest(http.MethodGet, "/notifications/respond", nil)
 	rr := httptest.NewRecorder()
 
-	fh.RespondToShareRequestHandler(rr, req)
+	srv.RespondToShareRequestHandler(rr, req)
 
 	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
 }
 
 func TestRespondToShareRequestHandler_InvalidStatus(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, _, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	body := map[string]string{"id": "notif-123", "status": "invalid"}
 	req := NewJSONRequest(t, http.MethodPost, "/notifications/respond", body)
 	rr := httptest.NewRecorder()
 
-	fh.RespondToShareRequestHandler(rr, req)
+	srv.RespondToShareRequestHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 
@@ -386,14 +378,14 @@ func TestRespondToShareRequestHandler_InvalidStatus(t *testing.T) {
 }
 
 func TestRespondToShareRequestHandler_MissingFields(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, _, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	body := map[string]string{"id": "", "status": "accepted"}
 	req := NewJSONRequest(t, http.MethodPost, "/notifications/respond", body)
 	rr := httptest.NewRecorder()
 
-	fh.RespondToShareRequestHandler(rr, req)
+	srv.RespondToShareRequestHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 
@@ -403,7 +395,7 @@ func TestRespondToShareRequestHandler_MissingFields(t *testing.T) {
 }
 
 func TestRespondToShareRequestHandler_NotificationNotFound(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
+	srv, mock, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	notificationID := "nonexistent"
@@ -417,14 +409,14 @@ func TestRespondToShareRequestHandler_NotificationNotFound(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/notifications/respond", body)
 	rr := httptest.NewRecorder()
 
-	fh.RespondToShareRequestHandler(rr, req)
+	srv.RespondToShareRequestHandler(rr, req)
 
 	require.Equal(t, http.StatusNotFound, rr.Code)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestClearNotificationHandler_Success(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
+	srv, mock, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	notificationID := "notif-123"
@@ -437,7 +429,7 @@ func TestClearNotificationHandler_Success(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/notifications/clear", body)
 	rr := httptest.NewRecorder()
 
-	fh.ClearNotificationHandler(rr, req)
+	srv.ClearNotificationHandler(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code)
 
@@ -450,7 +442,7 @@ func TestClearNotificationHandler_Success(t *testing.T) {
 }
 
 func TestClearNotificationHandler_NotificationNotFound(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
+	srv, mock, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	notificationID := "nonexistent"
@@ -463,39 +455,39 @@ func TestClearNotificationHandler_NotificationNotFound(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/notifications/clear", body)
 	rr := httptest.NewRecorder()
 
-	fh.ClearNotificationHandler(rr, req)
+	srv.ClearNotificationHandler(rr, req)
 
 	require.Equal(t, http.StatusNotFound, rr.Code)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestClearNotificationHandler_WrongMethod(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, _, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	req := httptest.NewRequest(http.MethodGet, "/notifications/clear", nil)
 	rr := httptest.NewRecorder()
 
-	fh.ClearNotificationHandler(rr, req)
+	srv.ClearNotificationHandler(rr, req)
 
 	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
 }
 
 func TestClearNotificationHandler_MissingID(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, _, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	body := map[string]string{"id": ""}
 	req := NewJSONRequest(t, http.MethodPost, "/notifications/clear", body)
 	rr := httptest.NewRecorder()
 
-	fh.ClearNotificationHandler(rr, req)
+	srv.ClearNotificationHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestAddNotificationHandler_SuccessWithReceivedFileID(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
+	srv, mock, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	notification := map[string]interface{}{
@@ -518,7 +510,7 @@ func TestAddNotificationHandler_SuccessWithReceivedFileID(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/notifications/add", notification)
 	rr := httptest.NewRecorder()
 
-	fh.AddNotificationHandler(rr, req)
+	srv.AddNotificationHandler(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code)
 
@@ -531,7 +523,7 @@ func TestAddNotificationHandler_SuccessWithReceivedFileID(t *testing.T) {
 }
 
 func TestAddNotificationHandler_SuccessViewOnly(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
+	srv, mock, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	notification := map[string]interface{}{
@@ -553,7 +545,7 @@ func TestAddNotificationHandler_SuccessViewOnly(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/notifications/add", notification)
 	rr := httptest.NewRecorder()
 
-	fh.AddNotificationHandler(rr, req)
+	srv.AddNotificationHandler(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code)
 
@@ -566,19 +558,19 @@ func TestAddNotificationHandler_SuccessViewOnly(t *testing.T) {
 }
 
 func TestAddNotificationHandler_WrongMethod(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, _, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	req := httptest.NewRequest(http.MethodGet, "/notifications/add", nil)
 	rr := httptest.NewRecorder()
 
-	fh.AddNotificationHandler(rr, req)
+	srv.AddNotificationHandler(rr, req)
 
 	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
 }
 
 func TestAddNotificationHandler_MissingRequiredFields(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
+	srv, _, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	notification := map[string]interface{}{
@@ -590,7 +582,7 @@ func TestAddNotificationHandler_MissingRequiredFields(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/notifications/add", notification)
 	rr := httptest.NewRecorder()
 
-	fh.AddNotificationHandler(rr, req)
+	srv.AddNotificationHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 
@@ -600,7 +592,7 @@ func TestAddNotificationHandler_MissingRequiredFields(t *testing.T) {
 }
 
 func TestAddNotificationHandler_DBError(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
+	srv, mock, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	notification := map[string]interface{}{
@@ -619,7 +611,7 @@ func TestAddNotificationHandler_DBError(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/notifications/add", notification)
 	rr := httptest.NewRecorder()
 
-	fh.AddNotificationHandler(rr, req)
+	srv.AddNotificationHandler(rr, req)
 
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 	require.NoError(t, mock.ExpectationsWereMet())
@@ -639,7 +631,7 @@ func TestValidStatusValues(t *testing.T) {
 		{"Case sensitive", "ACCEPTED", false},
 	}
 
-	mockDB, cleanup := SetupMockDB(t)
+	srv, mockDB, cleanup := SetupMockDB(t)
 	defer cleanup()
 
 	for _, tt := range tests {
@@ -655,7 +647,7 @@ func TestValidStatusValues(t *testing.T) {
 			req := NewJSONRequest(t, http.MethodPost, "/notifications/respond", body)
 			rr := httptest.NewRecorder()
 
-			fh.RespondToShareRequestHandler(rr, req)
+			srv.RespondToShareRequestHandler(rr, req)
 
 			if tt.valid {
 				assert.NotEqual(t, http.StatusBadRequest, rr.Code)
@@ -0,0 +1,108 @@
+package unitTests
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var userFileColumns = withColumns(fileColumns, "sort_key")
+
+// userFileRow returns a text file of U1's named name, sorted by sortKey.
+func userFileRow(id, name, sortKey string) []driver.Value {
+	return fileRow(store.File{ID: id, OwnerID: "U1", FileName: name, FileType: "text/plain", FileSize: 1,
+		CID: "files/" + id}, sortKey)
+}
+
+func TestListing_CursorWalksPages(t *testing.T) {
+	meta, mock, cleanup := SetupMetadataMockDB(t)
+	defer cleanup()
+
+	// limit 2 fetches 3 rows; the third only signals another page
+	mock.ExpectQuery(`ORDER BY lower\(file_name\) ASC, id::text ASC LIMIT \$2`).
+		WithArgs("U1", 3).
+		WillReturnRows(sqlmock.NewRows(userFileColumns).
+			AddRow(userFileRow("F1", "A.txt", "a.txt")...).
+			AddRow(userFileRow("F2", "b.txt", "b.txt")...).
+			AddRow(userFileRow("F3", "c.txt", "c.txt")...))
+
+	rr := httptest.NewRecorder()
+	meta.GetUserFilesHandler(rr, jsonReq(t, "/getUserFiles", map[string]any{
+		"userId": "U1", "sort": "name", "order": "asc", "limit": 2,
+	}))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var files []map[string]any
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &files))
+	require.Len(t, files, 2)
+	assert.Equal(t, "F2", files[1]["fileId"])
+	next := rr.Header().Get(api.NextCursorHeader)
+	require.NotEmpty(t, next)
+
+	// the cursor carries the sort, so the next request only passes it along
+	mock.ExpectQuery(`AND \(lower\(file_name\), id::text\) > \(\$2, \$3\) ORDER BY lower\(file_name\) ASC, id::text ASC LIMIT \$4`).
+		WithArgs("U1", "b.txt", "F2", 3).
+		WillReturnRows(sqlmock.NewRows(userFileColumns).
+			AddRow(userFileRow("F3", "c.txt", "c.txt")...))
+
+	rr = httptest.NewRecorder()
+	meta.GetUserFilesHandler(rr, jsonReq(t, "/getUserFiles?limit=2&cursor="+next, map[string]any{"userId": "U1"}))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &files))
+	require.Len(t, files, 1)
+	assert.Empty(t, rr.Header().Get(api.NextCursorHeader))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListing_InvalidPaging(t *testing.T) {
+	meta, _, cleanup := SetupMetadataMockDB(t)
+	defer cleanup()
+
+	c := &api.Page{Limit: 1, Sort: "createdAt", Order: "desc"}
+	c.Keep("2025-09-01", "F1")
+	c.Keep("2025-08-01", "F2")
+	createdCursor := c.Next()
+	require.NotEmpty(t, createdCursor)
+
+	cases := map[string]map[string]any{
+		"sort":     {"sort": "owner"},
+		"order":    {"order": "sideways"},
+		"limit":    {"limit": -1},
+		"cursor":   {"cursor": "not-a-cursor"},
+		"mismatch": {"cursor": createdCursor, "sort": "size"},
+	}
+	for name, body := range cases {
+		t.Run(name, func(t *testing.T) {
+			body["userId"] = "U1"
+			rr := httptest.NewRecorder()
+			meta.GetUserFilesHandler(rr, jsonReq(t, "/getUserFiles", body))
+			assert.Equal(t, http.StatusBadRequest, rr.Code, rr.Body.String())
+		})
+	}
+}
+
+func TestListing_LimitIsCapped(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`FROM notifications WHERE "to" = \$1 ORDER BY notifications.timestamp ASC`).
+		WithArgs("U1", api.MaxPageLimit+1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "from", "to", "file_name", "file_id", "message", "timestamp", "status", "read", "received_file_id", "sort_key"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/notifications?id=U1&order=asc&limit=10000", nil)
+	rr := httptest.NewRecorder()
+	srv.NotificationHandler(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, "", resp["nextCursor"])
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,77 @@
+package unitTests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+)
+
+// newPostgresStore returns the Postgres store over a sqlmock connection.
+// The memory store covers behaviour; these tests pin down what only the
+// SQL implementation can get wrong.
+func newPostgresStore(t *testing.T) (*store.Postgres, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	return store.NewPostgres(db), mock
+}
+
+func TestPostgresMoveItem_UniqueViolationIsNameTaken(t *testing.T) {
+	p, mock := newPostgresStore(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock`).
+		WithArgs("F1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT owner_id, file_name, .* FROM files\s+WHERE id = \$1 AND deleted_at IS NULL\s+FOR UPDATE`).
+		WithArgs("F1").
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id", "file_name", "file_type", "cid", "parent_id"}).
+			AddRow("U1", "a.txt", "file", "files/F1", nil))
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	// another move took the name between the check and the update
+	mock.ExpectExec(`UPDATE files SET parent_id = \$1, file_name = \$2, cid = \$3 WHERE id = \$4`).
+		WillReturnError(&pq.Error{Code: "23505"})
+	mock.ExpectRollback()
+
+	_, err := p.MoveItem(context.Background(), store.Move{ID: "F1", Name: "b.txt"})
+	require.ErrorIs(t, err, store.ErrNameTaken)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresPurgeTrashedFile_RestoredFileIsKept(t *testing.T) {
+	p, mock := newPostgresStore(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT TRUE FROM files WHERE id = \$1 AND deleted_at IS NOT NULL FOR UPDATE`).
+		WithArgs("F1").
+		WillReturnRows(sqlmock.NewRows([]string{"trashed"}))
+	mock.ExpectRollback()
+
+	require.NoError(t, p.PurgeTrashedFile(context.Background(), "F1"))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresExpireShare_AlreadyExpired(t *testing.T) {
+	p, mock := newPostgresStore(t)
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE shared_files_view SET expired_at = \$2, access_granted = FALSE WHERE id = \$1 AND expired_at IS NULL`).
+		WithArgs("S1", now).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	expired, err := p.ExpireShare(context.Background(), store.ExpiredShare{ID: "S1", View: true}, "files/U1/shared_view/S1", now)
+	require.NoError(t, err)
+	assert.False(t, expired)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
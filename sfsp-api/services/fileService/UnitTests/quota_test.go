@@ -0,0 +1,220 @@
+package unitTests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	fh "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unlimitedQuota lets every user store anything; tests that are not about
+// quotas run with it.
+func unlimitedQuota(_ context.Context, userID string) (fh.Quota, error) {
+	return fh.Quota{UserID: userID, Tier: fh.DefaultQuotaTier}, nil
+}
+
+// withQuota makes every user of srv have used bytes of a limit.
+func withQuota(srv *fh.Server, used, limit int64) {
+	srv.SetQuotaLoader(func(_ context.Context, userID string) (fh.Quota, error) {
+		return fh.Quota{UserID: userID, LimitBytes: &limit, UsedBytes: used}, nil
+	})
+}
+
+func withAdmin(req *http.Request, userID string) *http.Request {
+	return req.WithContext(auth.WithUser(req.Context(), auth.User{ID: userID, Role: auth.RoleAdmin}))
+}
+
+func assertQuotaExceeded(t *testing.T, rr *httptest.ResponseRecorder) {
+	t.Helper()
+	require.Equal(t, http.StatusRequestEntityTooLarge, rr.Code, rr.Body.String())
+	var resp api.ErrorResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, api.CodeQuotaExceeded, resp.Code)
+}
+
+func TestLoadQuota_TierAndUsage(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT COALESCE\(q.tier, \$2\), COALESCE\(q.limit_bytes, t.limit_bytes\)`).
+		WithArgs("U1", fh.DefaultQuotaTier).
+		WillReturnRows(sqlmock.NewRows([]string{"tier", "limit"}).AddRow("pro", int64(1000)))
+	mock.ExpectQuery(`FROM files WHERE owner_id = \$1.*FROM blob_hashes WHERE path LIKE \$2.*FROM upload_sessions s`).
+		WithArgs("U1", "files/U1/sent/%", "files/U1/shared_view/%").
+		WillReturnRows(sqlmock.NewRows([]string{"files", "versions", "sent", "view", "links", "uploads"}).
+			AddRow(int64(400), int64(100), int64(50), int64(50), int64(25), int64(75)))
+
+	q, err := srv.LoadQuota(context.Background(), "U1")
+	require.NoError(t, err)
+	assert.Equal(t, "pro", q.Tier)
+	assert.Equal(t, int64(700), q.UsedBytes)
+	assert.Equal(t, int64(300), *q.RemainingBytes)
+	assert.True(t, q.Allows(300))
+	assert.False(t, q.Allows(301))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoadQuota_Unlimited(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`LEFT JOIN user_quotas`).
+		WillReturnRows(sqlmock.NewRows([]string{"tier", "limit"}).AddRow(fh.DefaultQuotaTier, nil))
+	mock.ExpectQuery(`FROM files WHERE owner_id`).
+		WillReturnRows(sqlmock.NewRows([]string{"files", "versions", "sent", "view", "links", "uploads"}).
+			AddRow(int64(1)<<40, 0, 0, 0, 0, 0))
+
+	q, err := srv.LoadQuota(context.Background(), "U1")
+	require.NoError(t, err)
+	assert.Nil(t, q.LimitBytes)
+	assert.Nil(t, q.RemainingBytes)
+	assert.True(t, q.Allows(1<<40))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStartUploadHandler_DeclaredSizeOverQuota(t *testing.T) {
+	srv, st, _ := newMemoryServer(t)
+	withQuota(srv, 90, 100)
+
+	rr := httptest.NewRecorder()
+	srv.StartUploadHandler(rr, NewJSONRequest(t, http.MethodPost, "/startUpload", fh.StartUploadRequest{
+		UserID: "U1", FileName: "big.bin", FileSize: 20,
+	}))
+
+	assertQuotaExceeded(t, rr)
+	n, err := st.CountFiles(context.Background(), "U1")
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestUploadHandler_ChunkBeyondQuota(t *testing.T) {
+	srv, st, _ := newMemoryServer(t)
+	withQuota(srv, 100, 100)
+	addUpload(t, st, "f1", "u", 2)
+
+	rr := httptest.NewRecorder()
+	srv.UploadHandler(rr, mpReq1(t, chunkFields("f1", "u", "0", "2"), true, []byte("A")))
+
+	assertQuotaExceeded(t, rr)
+	chunks, err := st.ListUploadChunks(context.Background(), "f1")
+	require.NoError(t, err)
+	assert.Empty(t, chunks)
+}
+
+func TestUploadHandler_ChunkWithinReservation(t *testing.T) {
+	ctx := context.Background()
+	srv, st, b := newMemoryServer(t)
+	// the declared size is already counted; a full quota must not block it
+	withQuota(srv, 100, 100)
+	require.NoError(t, b.WriteStream("temp/f1_chunk_0", strings.NewReader("AAAAA")))
+	_, err := st.AddFile(ctx, store.File{ID: "f1", OwnerID: "u", FileName: "x"})
+	require.NoError(t, err)
+	require.NoError(t, st.AddUploadSession(ctx, store.UploadSession{FileID: "f1", OwnerID: "u", TotalChunks: 2, FileSize: 10}))
+	require.NoError(t, st.RecordUploadChunk(ctx, "f1", store.UploadChunk{Index: 0, Size: 5, Hash: sha256Hex("AAAAA")}))
+
+	rr := httptest.NewRecorder()
+	srv.UploadHandler(rr, mpReq1(t, chunkFields("f1", "u", "1", "2"), true, []byte("AAAAA")))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, fh.UploadStatusComplete, uploadStatus(t, st, "f1"))
+	assert.Equal(t, "AAAAAAAAAA", readBlob(t, b, "files/f1"))
+}
+
+func TestSendFileHandler_CopyOverQuota(t *testing.T) {
+	srv, _, cleanup := SetupMockDB(t)
+	defer cleanup()
+	// 4 chunks of 10 bytes estimate a 40 byte copy
+	withQuota(srv, 70, 100)
+
+	rr := httptest.NewRecorder()
+	srv.SendFileHandler(rr, newSendFileMultipart(t, map[string]string{
+		"fileid": "F1", "userId": "U1", "recipientUserId": "R1", "metadata": "{}",
+		"chunkIndex": "0", "totalChunks": "4",
+	}, []byte("0123456789"), true))
+
+	assertQuotaExceeded(t, rr)
+}
+
+func TestStorageUsageHandler(t *testing.T) {
+	srv, _, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	t.Run("own usage", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.StorageUsageHandler(rr, withUser(httptest.NewRequest(http.MethodGet, "/storageUsage", nil), "U1"))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var q fh.Quota
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &q))
+		assert.Equal(t, "U1", q.UserID)
+	})
+	t.Run("someone else", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.StorageUsageHandler(rr, withUser(httptest.NewRequest(http.MethodGet, "/storageUsage?userId=U2", nil), "U1"))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+	t.Run("admin asks for someone else", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.StorageUsageHandler(rr, withAdmin(httptest.NewRequest(http.MethodGet, "/storageUsage?userId=U2", nil), "A1"))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var q fh.Quota
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &q))
+		assert.Equal(t, "U2", q.UserID)
+	})
+}
+
+func TestSetQuotaTierHandler(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	rr := httptest.NewRecorder()
+	srv.SetQuotaTierHandler(rr, withUser(jsonReq(t, "/setQuotaTier", map[string]any{"name": "pro", "limitBytes": 1000}), "U1"))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	mock.ExpectExec(`INSERT INTO quota_tiers \(name, limit_bytes\) VALUES \(\$1, \$2\)\s+ON CONFLICT \(name\) DO UPDATE`).
+		WithArgs("pro", int64(1000)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rr = httptest.NewRecorder()
+	srv.SetQuotaTierHandler(rr, withAdmin(jsonReq(t, "/setQuotaTier", map[string]any{"name": "pro", "limitBytes": 1000}), "A1"))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	srv.SetQuotaTierHandler(rr, withAdmin(jsonReq(t, "/setQuotaTier", map[string]any{"name": "pro", "limitBytes": -1}), "A1"))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetUserQuotaHandler(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM quota_tiers WHERE name = \$1\)`).
+		WithArgs("gold").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	rr := httptest.NewRecorder()
+	srv.SetUserQuotaHandler(rr, withAdmin(jsonReq(t, "/setUserQuota", map[string]any{"userId": "U2", "tier": "gold"}), "A1"))
+	assert.Equal(t, http.StatusNotFound, rr.Code, rr.Body.String())
+
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs("pro").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec(`INSERT INTO user_quotas .* ON CONFLICT \(user_id\) DO UPDATE`).
+		WithArgs("U2", "pro", int64(5000)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rr = httptest.NewRecorder()
+	srv.SetUserQuotaHandler(rr, withAdmin(jsonReq(t, "/setUserQuota", map[string]any{"userId": "U2", "tier": "pro", "limitBytes": 5000}), "A1"))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
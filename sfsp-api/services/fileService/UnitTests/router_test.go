@@ -0,0 +1,161 @@
+package unitTests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeEnvelope(t *testing.T, rr *httptest.ResponseRecorder) api.ErrorResponse {
+	t.Helper()
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var env api.ErrorResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &env))
+	assert.False(t, env.Success)
+	return env
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rr.Header().Set("Content-Length", "10")
+	api.Error(rr, "File <x> not found", http.StatusNotFound)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Empty(t, rr.Header().Get("Content-Length"))
+	env := decodeEnvelope(t, rr)
+	assert.Equal(t, api.CodeNotFound, env.Code)
+	assert.Equal(t, "File <x> not found", env.Error)
+	assert.Contains(t, rr.Body.String(), "<x>") // HTML is not escaped
+
+	rr = httptest.NewRecorder()
+	api.ErrorCode(rr, "bad blob", http.StatusInternalServerError, api.CodeIntegrityFailed)
+	assert.Equal(t, api.CodeIntegrityFailed, decodeEnvelope(t, rr).Code)
+}
+
+func TestRouter_NotFoundAndMethodNotAllowed(t *testing.T) {
+	rt := api.NewRouter(api.Version1)
+	rt.HandleFunc(http.MethodGet, "/files/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	rt.HandleFunc(http.MethodDelete, "/files/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	rr := httptest.NewRecorder()
+	rt.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/nope", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, api.CodeNotFound, decodeEnvelope(t, rr).Code)
+
+	rr = httptest.NewRecorder()
+	rt.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/files/F1", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, api.CodeMethodNotAllowed, decodeEnvelope(t, rr).Code)
+	allow := rr.Header().Get("Allow")
+	assert.Contains(t, allow, http.MethodGet)
+	assert.Contains(t, allow, http.MethodDelete)
+}
+
+func TestRouter_WithJSONPathParams(t *testing.T) {
+	meta, mock, cleanup := SetupMetadataMockDB(t)
+	defer cleanup()
+
+	mock.ExpectExec(`UPDATE files`).
+		WithArgs("new description", "F1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rt := api.NewRouter(api.Version1)
+	rt.HandleFunc(http.MethodPut, "/files/{id}/description",
+		api.WithJSON(api.Params{"id": "fileId"}, meta.AddDescriptionHandler))
+
+	// the path wins over a fileId in the body
+	body := strings.NewReader(`{"fileId":"OTHER","description":"new description"}`)
+	rr := httptest.NewRecorder()
+	rt.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/api/v1/files/F1/description", body))
+
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRouter_WithJSONInvalidBody(t *testing.T) {
+	meta, _, cleanup := SetupMetadataMockDB(t)
+	defer cleanup()
+
+	rt := api.NewRouter(api.Version1)
+	rt.HandleFunc(http.MethodPut, "/files/{id}/description",
+		api.WithJSON(api.Params{"id": "fileId"}, meta.AddDescriptionHandler))
+
+	rr := httptest.NewRecorder()
+	rt.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/api/v1/files/F1/description", strings.NewReader("{bad")))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, api.CodeBadRequest, decodeEnvelope(t, rr).Code)
+}
+
+func TestRouter_WithQueryPathParams(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT owner_id FROM files WHERE id = \$1`).
+		WithArgs("F1").
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow("U1"))
+	mock.ExpectQuery(`SELECT DISTINCT recipient_id FROM shared_files_view WHERE file_id = \$1`).
+		WithArgs("F1").
+		WillReturnRows(sqlmock.NewRows([]string{"recipient_id"}).AddRow("U2"))
+
+	rt := api.NewRouter(api.Version1)
+	rt.HandleFunc(http.MethodGet, "/files/{id}/access",
+		api.WithQuery(api.Params{"id": "fileId"}, srv.GetUsersWithFileAccessHandler))
+
+	rr := httptest.NewRecorder()
+	rt.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/files/F1/access", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Contains(t, rr.Body.String(), `"U2"`)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandlerErrorsUseEnvelope(t *testing.T) {
+	srv, _, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	rr := httptest.NewRecorder()
+	srv.DeleteFileHandler(rr, httptest.NewRequest(http.MethodPost, "/deleteFile", strings.NewReader("{bad")))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	env := decodeEnvelope(t, rr)
+	assert.Equal(t, api.CodeBadRequest, env.Code)
+	assert.Equal(t, "Invalid JSON payload", env.Error)
+}
+
+func TestLimitBody(t *testing.T) {
+	var readErr error
+	h := api.LimitBody(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.ReadAll(r.Body)
+	}), 8)
+
+	t.Run("declared too large", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("0123456789")))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+		assert.Equal(t, api.CodePayloadTooLarge, decodeEnvelope(t, rr).Code)
+	})
+
+	t.Run("undeclared length is cut off", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/upload", io.NopCloser(strings.NewReader("0123456789")))
+		req.ContentLength = -1
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		var tooLarge *http.MaxBytesError
+		assert.ErrorAs(t, readErr, &tooLarge)
+	})
+
+	t.Run("within the limit", func(t *testing.T) {
+		readErr = nil
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("01234567")))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NoError(t, readErr)
+	})
+}
@@ -0,0 +1,150 @@
+package unitTests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metadata"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// search posts body to SearchHandler and decodes a successful response.
+func search(t *testing.T, meta *metadata.Server, body map[string]any) metadata.SearchResponse {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	meta.SearchHandler(rr, jsonReq(t, "/searchFiles", body))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp metadata.SearchResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	return resp
+}
+
+func resultIDs(resp metadata.SearchResponse) []string {
+	ids := []string{}
+	for _, r := range resp.Results {
+		ids = append(ids, r.FileID)
+	}
+	return ids
+}
+
+func TestSearchHandler_RankedWithHighlights(t *testing.T) {
+	meta, st := newMemoryMetadata(t)
+	addItem(t, st, store.File{ID: "D1", FileName: "docs", FileType: "folder", CID: "docs"})
+	addItem(t, st, store.File{ID: "F1", FileName: "quarterly report.pdf", FileType: "application/pdf", FileSize: 4096,
+		Description: "Q3 numbers", Tags: []string{"finance", "q3"}, CID: "files/docs/F1", ParentID: "D1"})
+	addItem(t, st, store.File{ID: "F2", FileName: "<b>notes</b>.pdf", FileType: "application/pdf", FileSize: 2048,
+		Description: "for the quarterly <i>report</i>", Tags: []string{"finance"}, CID: "files/F2"})
+	// each misses one of the filters
+	addItem(t, st, store.File{ID: "F3", FileName: "quarterly report.pdf", FileType: "application/pdf", FileSize: 100})
+	addItem(t, st, store.File{ID: "F4", FileName: "quarterly report.txt", FileType: "text/plain", FileSize: 4096})
+	addItem(t, st, store.File{ID: "F5", FileName: "quarterly.pdf", FileType: "application/pdf", FileSize: 4096})
+	addItem(t, st, store.File{ID: "F6", OwnerID: "U2", FileName: "quarterly report.pdf", FileType: "application/pdf", FileSize: 4096})
+
+	resp := search(t, meta, map[string]any{
+		"userId":    "U1",
+		"query":     "Quart rep!",
+		"fileTypes": []string{"application/pdf"},
+		"minSize":   1024,
+	})
+
+	assert.Equal(t, 2, resp.Total)
+	require.Equal(t, []string{"F1", "F2"}, resultIDs(resp))
+	assert.Equal(t, []string{"finance", "q3"}, resp.Results[0].Tags)
+	require.NotNil(t, resp.Results[0].ParentID)
+	assert.Equal(t, "D1", *resp.Results[0].ParentID)
+	assert.Equal(t, "<mark>quarterly</mark> <mark>report</mark>.pdf", resp.Results[0].Highlights["fileName"])
+	assert.NotContains(t, resp.Results[0].Highlights, "description")
+	assert.Nil(t, resp.Results[1].ParentID)
+	assert.NotContains(t, resp.Results[1].Highlights, "fileName")
+	// names and descriptions are escaped; only the marks are markup
+	assert.Equal(t, "for the <mark>quarterly</mark> &lt;i&gt;<mark>report</mark>&lt;/i&gt;", resp.Results[1].Highlights["description"])
+	assert.Equal(t, map[string]int{"application/pdf": 2}, resp.Facets.FileTypes)
+	assert.Equal(t, map[string]int{"finance": 2, "q3": 1}, resp.Facets.Tags)
+}
+
+func TestSearchHandler_FolderAndShareFilters(t *testing.T) {
+	ctx := context.Background()
+	meta, st := newMemoryMetadata(t)
+	created := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	addItem(t, st, store.File{ID: "D1", FileName: "2025", FileType: "folder", CID: "docs/2025", CreatedAt: created})
+	addItem(t, st, store.File{ID: "D2", FileName: "q1", FileType: "folder", CID: "docs/2025/q1", ParentID: "D1", CreatedAt: created})
+	for _, f := range []store.File{
+		{ID: "A", FileName: "b.txt", ParentID: "D1", CreatedAt: created},
+		{ID: "B", FileName: "A.txt", ParentID: "D2", CreatedAt: created},
+		{ID: "C", FileName: "unlinked.txt", ParentID: "D1", CreatedAt: created},
+		{ID: "D", FileName: "root.txt", CreatedAt: created},
+		{ID: "E", FileName: "old.txt", ParentID: "D1", CreatedAt: created.AddDate(-1, 0, 0)},
+	} {
+		addItem(t, st, f)
+		if f.ID != "C" {
+			require.NoError(t, st.AddShareLink(ctx, store.ShareLink{ID: "L" + f.ID, FileID: f.ID, OwnerID: "U1"}))
+		}
+	}
+	body := map[string]any{
+		"userId":       "U1",
+		"createdAfter": "2025-01-01T00:00:00Z",
+		"folderPath":   "/docs/2025/",
+		"recursive":    true,
+		"shared":       "link",
+		"sort":         "name",
+		"limit":        10,
+	}
+
+	resp := search(t, meta, body)
+	assert.Equal(t, 2, resp.Total)
+	assert.Equal(t, []string{"B", "A"}, resultIDs(resp))
+
+	// a page past the end still reports the total
+	body["offset"] = 20
+	resp = search(t, meta, body)
+	assert.Equal(t, 2, resp.Total)
+	assert.Empty(t, resp.Results)
+}
+
+func TestSearchHandler_Private(t *testing.T) {
+	ctx := context.Background()
+	meta, st := newMemoryMetadata(t)
+	addItem(t, st, store.File{ID: "D1", FileName: "docs", FileType: "folder", CID: "docs"})
+	for _, id := range []string{"P", "S", "V", "L"} {
+		addItem(t, st, store.File{ID: id, FileName: id + ".txt", ParentID: "D1"})
+	}
+	addItem(t, st, store.File{ID: "R", FileName: "root.txt"})
+	_, err := st.AddReceivedFile(ctx, store.ReceivedFile{FileID: "S", SenderID: "U1", RecipientID: "U2", Metadata: "{}"})
+	require.NoError(t, err)
+	_, err = st.AddViewShare(ctx, store.ViewShare{FileID: "V", SenderID: "U1", RecipientID: "U2", AccessGranted: true})
+	require.NoError(t, err)
+	require.NoError(t, st.AddShareLink(ctx, store.ShareLink{FileID: "L", OwnerID: "U1"}))
+
+	resp := search(t, meta, map[string]any{"userId": "U1", "folderId": "D1", "shared": "private"})
+	assert.Equal(t, []string{"P"}, resultIDs(resp))
+
+	resp = search(t, meta, map[string]any{"userId": "U1", "folderId": "D1", "shared": "shared", "sort": "name"})
+	assert.Equal(t, []string{"L", "S", "V"}, resultIDs(resp))
+}
+
+func TestSearchHandler_InvalidFilters(t *testing.T) {
+	meta, _ := newMemoryMetadata(t)
+
+	cases := map[string]map[string]any{
+		"sizes":  {"minSize": 10, "maxSize": 5},
+		"date":   {"createdBefore": "yesterday"},
+		"folder": {"folderId": "D1", "folderPath": "docs"},
+		"shared": {"shared": "public"},
+		"sort":   {"sort": "random"},
+		"offset": {"offset": -1},
+	}
+	for name, body := range cases {
+		t.Run(name, func(t *testing.T) {
+			body["userId"] = "U1"
+			rr := httptest.NewRecorder()
+			meta.SearchHandler(rr, jsonReq(t, "/searchFiles", body))
+			assert.Equal(t, http.StatusBadRequest, rr.Code, rr.Body.String())
+		})
+	}
+}
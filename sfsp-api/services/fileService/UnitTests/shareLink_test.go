@@ -0,0 +1,430 @@
+package unitTests
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	fh "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/storage"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var linkColumns = []string{
+	"id", "file_id", "owner_id", "blob_path", "metadata", "password_hash",
+	"expires_at", "locked_until", "max_downloads", "download_count", "revoked", "trashed",
+}
+
+// linkRow is the link expectLink returns; the zero value is a live link to
+// F1 without a password.
+type linkRow struct {
+	passwordHash  string
+	expiresAt     any
+	lockedUntil   any
+	maxDownloads  any
+	downloadCount int
+	revoked       bool
+}
+
+func passwordHash(t *testing.T, password string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+	return string(hash)
+}
+
+func expectLink(mock sqlmock.Sqlmock, token string, l linkRow) {
+	mock.ExpectQuery(`FROM share_links l\s+JOIN files f ON f.id = l.file_id\s+WHERE l.token_hash = \$1`).
+		WithArgs(sha256Hex(token)).
+		WillReturnRows(sqlmock.NewRows(linkColumns).AddRow(
+			"L1", "F1", "U1", "links/F1/L1", `{"name":"report.pdf"}`, l.passwordHash,
+			l.expiresAt, l.lockedUntil, l.maxDownloads, l.downloadCount, l.revoked, false))
+}
+
+// addLinkFile stores a file of U1 to make links to and returns its id.
+func addLinkFile(t *testing.T, st *store.Memory) string {
+	t.Helper()
+	id, err := st.AddFile(context.Background(), store.File{OwnerID: "U1", FileName: "report.pdf"})
+	require.NoError(t, err)
+	return id
+}
+
+// sendLinkChunk posts one chunk of a share link upload as U1.
+func sendLinkChunk(t *testing.T, srv *fh.Server, fields map[string]string, chunk string) *httptest.ResponseRecorder {
+	t.Helper()
+	fields["userId"] = "U1"
+	rr := httptest.NewRecorder()
+	srv.CreateShareLinkHandler(rr, mpReq(t, "/createShareLink", fields, "encryptedFile", "blob.bin", []byte(chunk)))
+	return rr
+}
+
+func decodeBody(t *testing.T, rr *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp), rr.Body.String())
+	return resp
+}
+
+func assertNoBlob(t *testing.T, b storage.Backend, path string) {
+	t.Helper()
+	_, err := b.ReadStream(path)
+	assert.Error(t, err, path)
+}
+
+func TestCreateShareLinkHandler_LastChunk(t *testing.T) {
+	srv, st, b := newMemoryServer(t)
+	fileID := addLinkFile(t, st)
+
+	rr := sendLinkChunk(t, srv, map[string]string{
+		"fileid":       fileID,
+		"metadata":     `{"name":"report.pdf"}`,
+		"password":     "hunter2",
+		"expiresIn":    "never",
+		"maxDownloads": "3",
+		"chunkIndex":   "0",
+		"totalChunks":  "1",
+	}, "ciphertext")
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	resp := decodeBody(t, rr)
+	linkID := resp["linkId"].(string)
+	assert.NotEmpty(t, linkID)
+	assert.GreaterOrEqual(t, len(resp["token"].(string)), 43)
+	assert.Equal(t, true, resp["passwordProtected"])
+	assert.Nil(t, resp["expiresAt"])
+	assert.EqualValues(t, 3, resp["maxDownloads"])
+
+	links, err := st.ListShareLinks(context.Background(), "U1", fileID)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, linkID, links[0].ID)
+	assert.Equal(t, `{"name":"report.pdf"}`, links[0].Metadata)
+	assert.Equal(t, "ciphertext", readBlob(t, b, "links/"+fileID+"/"+linkID))
+	assertNoBlob(t, b, "temp/"+linkID+"_link_chunk_0")
+	_, err = st.LinkUpload(context.Background(), linkID)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func TestCreateShareLinkHandler_ChunksInAnyOrder(t *testing.T) {
+	srv, st, b := newMemoryServer(t)
+	fileID := addLinkFile(t, st)
+	chunk := func(index, linkID string) map[string]string {
+		return map[string]string{"fileid": fileID, "linkId": linkID, "chunkIndex": index, "totalChunks": "3"}
+	}
+
+	rr := sendLinkChunk(t, srv, chunk("0", ""), "aa")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	linkID := decodeBody(t, rr)["linkId"].(string)
+	require.NotEmpty(t, linkID)
+
+	// the highest index arriving early does not start the merge
+	rr = sendLinkChunk(t, srv, chunk("2", linkID), "cc")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Nil(t, decodeBody(t, rr)["token"])
+	assertNoBlob(t, b, "links/"+fileID+"/"+linkID)
+
+	rr = sendLinkChunk(t, srv, chunk("1", linkID), "bb")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	resp := decodeBody(t, rr)
+	assert.Equal(t, linkID, resp["linkId"])
+	assert.NotEmpty(t, resp["token"])
+	assert.Equal(t, "aabbcc", readBlob(t, b, "links/"+fileID+"/"+linkID))
+	for i := 0; i < 3; i++ {
+		assertNoBlob(t, b, fmt.Sprintf("temp/%s_link_chunk_%d", linkID, i))
+	}
+}
+
+func TestCreateShareLinkHandler_ConcurrentLinksKeepTheirChunks(t *testing.T) {
+	srv, st, b := newMemoryServer(t)
+	fileID := addLinkFile(t, st)
+	chunk := func(index, linkID string) map[string]string {
+		return map[string]string{"fileid": fileID, "linkId": linkID, "chunkIndex": index, "totalChunks": "2"}
+	}
+
+	rr := sendLinkChunk(t, srv, chunk("0", ""), "first-0|")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	first := decodeBody(t, rr)["linkId"].(string)
+	rr = sendLinkChunk(t, srv, chunk("0", ""), "second-0|")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	second := decodeBody(t, rr)["linkId"].(string)
+	require.NotEqual(t, first, second)
+
+	rr = sendLinkChunk(t, srv, chunk("1", second), "second-1")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	rr = sendLinkChunk(t, srv, chunk("1", first), "first-1")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	assert.Equal(t, "first-0|first-1", readBlob(t, b, "links/"+fileID+"/"+first))
+	assert.Equal(t, "second-0|second-1", readBlob(t, b, "links/"+fileID+"/"+second))
+}
+
+func TestCreateShareLinkHandler_LaterChunkNeedsLinkID(t *testing.T) {
+	srv, st, _ := newMemoryServer(t)
+	fileID := addLinkFile(t, st)
+
+	rr := sendLinkChunk(t, srv, map[string]string{"fileid": fileID, "chunkIndex": "1", "totalChunks": "2"}, "bb")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = sendLinkChunk(t, srv, map[string]string{"fileid": fileID, "linkId": "nope", "chunkIndex": "1", "totalChunks": "2"}, "bb")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestCreateShareLinkHandler_ChunkOfAnotherUpload(t *testing.T) {
+	srv, st, _ := newMemoryServer(t)
+	fileID := addLinkFile(t, st)
+	otherID := addLinkFile(t, st)
+
+	rr := sendLinkChunk(t, srv, map[string]string{"fileid": fileID, "chunkIndex": "0", "totalChunks": "2"}, "aa")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	linkID := decodeBody(t, rr)["linkId"].(string)
+
+	rr = sendLinkChunk(t, srv, map[string]string{"fileid": otherID, "linkId": linkID, "chunkIndex": "1", "totalChunks": "2"}, "bb")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = sendLinkChunk(t, srv, map[string]string{"fileid": fileID, "linkId": linkID, "chunkIndex": "1", "totalChunks": "3"}, "bb")
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
+
+func TestCreateShareLinkHandler_FailedCopyKeepsChunks(t *testing.T) {
+	b, root := newLocalBackend(t)
+	st := store.NewMemory()
+	srv := fh.New(nil, b, fh.Config{})
+	srv.SetStore(st)
+	srv.SetQuotaLoader(unlimitedQuota)
+	fileID := addLinkFile(t, st)
+	chunk := func(index, linkID string) map[string]string {
+		return map[string]string{"fileid": fileID, "linkId": linkID, "chunkIndex": index, "totalChunks": "2"}
+	}
+
+	rr := sendLinkChunk(t, srv, chunk("0", ""), "aa")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	linkID := decodeBody(t, rr)["linkId"].(string)
+
+	// a file where the link's directory belongs makes storing the copy fail
+	blocker := filepath.Join(root, "links", fileID)
+	require.NoError(t, os.MkdirAll(filepath.Dir(blocker), 0755))
+	require.NoError(t, os.WriteFile(blocker, []byte("x"), 0644))
+	rr = sendLinkChunk(t, srv, chunk("1", linkID), "bb")
+	require.Equal(t, http.StatusInternalServerError, rr.Code, rr.Body.String())
+
+	assert.Equal(t, "aa", readBlob(t, b, "temp/"+linkID+"_link_chunk_0"))
+	assert.Equal(t, "bb", readBlob(t, b, "temp/"+linkID+"_link_chunk_1"))
+	u, err := st.LinkUpload(context.Background(), linkID)
+	require.NoError(t, err)
+	assert.Equal(t, store.UploadStatusUploading, u.Status)
+
+	// re-sending a chunk retries the merge
+	require.NoError(t, os.Remove(blocker))
+	rr = sendLinkChunk(t, srv, chunk("1", linkID), "bb")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "aabb", readBlob(t, b, "links/"+fileID+"/"+linkID))
+	assertNoBlob(t, b, "temp/"+linkID+"_link_chunk_0")
+}
+
+func TestCreateShareLinkHandler_NotOwner(t *testing.T) {
+	srv, st, _ := newMemoryServer(t)
+	fileID, err := st.AddFile(context.Background(), store.File{OwnerID: "U2", FileName: "theirs.pdf"})
+	require.NoError(t, err)
+
+	rr := sendLinkChunk(t, srv, map[string]string{"fileid": fileID, "chunkIndex": "0", "totalChunks": "1"}, "ciphertext")
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestCreateShareLinkHandler_InvalidMaxDownloads(t *testing.T) {
+	srv, st, _ := newMemoryServer(t)
+	fileID := addLinkFile(t, st)
+
+	rr := sendLinkChunk(t, srv, map[string]string{
+		"fileid": fileID, "maxDownloads": "0", "chunkIndex": "0", "totalChunks": "1",
+	}, "ciphertext")
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestPublicLinkDownloadHandler_WithPassword(t *testing.T) {
+	srv, mock, b := useLocalBackend(t)
+	require.NoError(t, b.WriteStream("links/F1/L1", strings.NewReader("link ciphertext")))
+
+	expectLink(mock, "tok", linkRow{passwordHash: passwordHash(t, "hunter2"), maxDownloads: 3, downloadCount: 2})
+	mock.ExpectExec(`UPDATE share_links SET download_count = download_count \+ 1, failed_attempts = 0`).
+		WithArgs("L1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT file_id, sha256, size, corrupted_at FROM blob_hashes`).
+		WithArgs("links/F1/L1").
+		WillReturnRows(sqlmock.NewRows([]string{"file_id", "sha256", "size", "corrupted_at"}).
+			AddRow("F1", sha256Hex("link ciphertext"), int64(len("link ciphertext")), nil))
+	mock.ExpectExec(`INSERT INTO access_logs`).
+		WithArgs("F1", "U1", "share_link_download", sqlmock.AnyArg(), false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rr := httptest.NewRecorder()
+	srv.PublicLinkDownloadHandler(rr, jsonReq(t, "/publicDownload", map[string]string{"token": "tok", "password": "hunter2"}))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "link ciphertext", rr.Body.String())
+	metadata, err := base64.StdEncoding.DecodeString(rr.Header().Get("X-Link-Metadata"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"report.pdf"}`, string(metadata))
+	assert.Empty(t, rr.Header().Get("Accept-Ranges"))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPublicLinkDownloadHandler_PasswordRequired(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	expectLink(mock, "tok", linkRow{passwordHash: passwordHash(t, "hunter2")})
+
+	rr := httptest.NewRecorder()
+	srv.PublicLinkDownloadHandler(rr, jsonReq(t, "/publicDownload", map[string]string{"token": "tok"}))
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPublicLinkDownloadHandler_WrongPasswordCounts(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	expectLink(mock, "tok", linkRow{passwordHash: passwordHash(t, "hunter2")})
+	mock.ExpectExec(`UPDATE share_links SET\s+failed_attempts = CASE`).
+		WithArgs("L1", fh.LinkMaxPasswordAttempts, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rr := httptest.NewRecorder()
+	srv.PublicLinkDownloadHandler(rr, jsonReq(t, "/publicDownload", map[string]string{"token": "tok", "password": "guess"}))
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPublicLinkDownloadHandler_Locked(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	expectLink(mock, "tok", linkRow{passwordHash: passwordHash(t, "hunter2"), lockedUntil: time.Now().Add(time.Minute)})
+
+	rr := httptest.NewRecorder()
+	// even the right password is refused while locked
+	srv.PublicLinkDownloadHandler(rr, jsonReq(t, "/publicDownload", map[string]string{"token": "tok", "password": "hunter2"}))
+
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPublicLinkDownloadHandler_Gone(t *testing.T) {
+	cases := map[string]linkRow{
+		"expired": {expiresAt: time.Now().Add(-time.Minute)},
+		"used up": {maxDownloads: 2, downloadCount: 2},
+		"revoked": {revoked: true},
+	}
+	for name, l := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv, mock, cleanup := SetupMockDB(t)
+			defer cleanup()
+			expectLink(mock, "tok", l)
+
+			rr := httptest.NewRecorder()
+			srv.PublicLinkDownloadHandler(rr, jsonReq(t, "/publicDownload", map[string]string{"token": "tok"}))
+
+			assert.Equal(t, http.StatusGone, rr.Code)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestPublicLinkDownloadHandler_LostLastDownload(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	expectLink(mock, "tok", linkRow{maxDownloads: 1})
+	mock.ExpectExec(`UPDATE share_links SET download_count = download_count \+ 1`).
+		WithArgs("L1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	rr := httptest.NewRecorder()
+	srv.PublicLinkDownloadHandler(rr, jsonReq(t, "/publicDownload", map[string]string{"token": "tok"}))
+
+	assert.Equal(t, http.StatusGone, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPublicLinkDownloadHandler_UnknownToken(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`FROM share_links l`).
+		WithArgs(sha256Hex("nope")).
+		WillReturnRows(sqlmock.NewRows(linkColumns))
+
+	rr := httptest.NewRecorder()
+	srv.PublicLinkDownloadHandler(rr, jsonReq(t, "/publicDownload", map[string]string{"token": "nope"}))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPublicLinkInfoHandler(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	expectLink(mock, "tok", linkRow{passwordHash: "x", maxDownloads: 5, downloadCount: 2})
+
+	rr := httptest.NewRecorder()
+	srv.PublicLinkInfoHandler(rr, jsonReq(t, "/publicLink", map[string]string{"token": "tok"}))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, true, resp["passwordProtected"])
+	assert.EqualValues(t, 3, resp["downloadsRemaining"])
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevokeShareLinkHandler(t *testing.T) {
+	srv, mock, b := useLocalBackend(t)
+	require.NoError(t, b.WriteStream("links/F1/L1", strings.NewReader("link ciphertext")))
+
+	mock.ExpectQuery(`UPDATE share_links SET revoked_at = NOW\(\)`).
+		WithArgs("L1", "U1").
+		WillReturnRows(sqlmock.NewRows([]string{"file_id", "blob_path"}).AddRow("F1", "links/F1/L1"))
+	mock.ExpectExec(`DELETE FROM blob_hashes WHERE path = \$1`).
+		WithArgs("links/F1/L1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rr := httptest.NewRecorder()
+	srv.RevokeShareLinkHandler(rr, jsonReq(t, "/revokeShareLink", map[string]string{"userId": "U1", "linkId": "L1"}))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	_, err := b.ReadStream("links/F1/L1")
+	assert.Error(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevokeShareLinkHandler_NotFound(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`UPDATE share_links SET revoked_at = NOW\(\)`).
+		WithArgs("L1", "U2").
+		WillReturnRows(sqlmock.NewRows([]string{"file_id", "blob_path"}))
+
+	rr := httptest.NewRecorder()
+	srv.RevokeShareLinkHandler(rr, jsonReq(t, "/revokeShareLink", map[string]string{"userId": "U2", "linkId": "L1"}))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
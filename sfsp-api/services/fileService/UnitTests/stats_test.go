@@ -0,0 +1,118 @@
+package unitTests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metadata"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addStorage stores the files, trash, blobs and shares of U1 that the
+// report is checked against.
+func addStorage(t *testing.T, st *store.Memory) {
+	t.Helper()
+	ctx := context.Background()
+	addItem(t, st, store.File{ID: "D1", FileName: "docs", FileType: "folder", CID: "docs"})
+	addItem(t, st, store.File{ID: "D2", FileName: "2025", FileType: "folder", CID: "docs/2025", ParentID: "D1"})
+	addItem(t, st, store.File{ID: "F1", FileName: "big.pdf", FileType: "application/pdf", FileSize: 500, CID: "files/docs/F1", ParentID: "D1"})
+	addItem(t, st, store.File{ID: "F2", FileName: "q1.pdf", FileType: "application/pdf", FileSize: 200, CID: "files/docs/2025/F2", ParentID: "D2"})
+	addItem(t, st, store.File{ID: "F3", FileName: "a.png", FileType: "image/png", FileSize: 100, CID: "files/F3"})
+	addItem(t, st, store.File{ID: "F4", FileName: "b.png", FileType: "image/png", FileSize: 200, CID: "files/F4"})
+	addItem(t, st, store.File{ID: "F5", FileName: "old.txt", FileType: "text/plain", FileSize: 50, CID: "files/F5"})
+	require.NoError(t, st.TrashFile(ctx, "F5"))
+	addItem(t, st, store.File{ID: "X1", OwnerID: "U2", FileName: "other.pdf", FileType: "application/pdf", FileSize: 900})
+
+	for path, size := range map[string]int64{
+		"versions/F1/v1":          20,
+		"files/U1/sent/F1":        100,
+		"files/U1/shared_view/F1": 60,
+		"links/L1":                40,
+		"files/U2/sent/X1":        900,
+	} {
+		fileID := "F1"
+		if path == "files/U2/sent/X1" {
+			fileID = "X1"
+		}
+		require.NoError(t, st.RecordBlobHash(ctx, store.BlobHash{Path: path, FileID: fileID, SHA256: "h", Size: size}))
+	}
+
+	for _, r := range []store.ReceivedFile{
+		{FileID: "F1", SenderID: "U1", RecipientID: "U2", Metadata: "{}"},
+		{FileID: "F2", SenderID: "U1", RecipientID: "U3", Metadata: "{}"},
+		{FileID: "X1", SenderID: "U2", RecipientID: "U1", Metadata: "{}"},
+		{FileID: "X1", SenderID: "U3", RecipientID: "U1", Metadata: "{}"},
+		{FileID: "X1", SenderID: "U4", RecipientID: "U1", Metadata: "{}"},
+	} {
+		_, err := st.AddReceivedFile(ctx, r)
+		require.NoError(t, err)
+	}
+	_, err := st.AddViewShare(ctx, store.ViewShare{FileID: "F1", SenderID: "U1", RecipientID: "U2", AccessGranted: true})
+	require.NoError(t, err)
+	require.NoError(t, st.AddShareLink(ctx, store.ShareLink{ID: "L1", FileID: "F1", OwnerID: "U1"}))
+}
+
+func TestStorageStatsHandler_Report(t *testing.T) {
+	meta, st := newMemoryMetadata(t)
+	addStorage(t, st)
+
+	rr := httptest.NewRecorder()
+	meta.StorageStatsHandler(rr, NewJSONRequest(t, http.MethodPost, "/storageStats", map[string]string{"userId": "U1"}))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var stats metadata.StorageStats
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+	assert.Equal(t, int64(1270), stats.TotalBytes)
+	assert.Equal(t, metadata.StorageBucket{Bytes: 1000, Files: 4}, stats.Files)
+	assert.Equal(t, metadata.StorageBucket{Bytes: 300, Files: 2}, stats.Root)
+	assert.Equal(t, int64(100), stats.Sent.Bytes)
+	assert.Equal(t, int64(60), stats.ViewShares.Bytes)
+	assert.Equal(t, int64(40), stats.Links.Bytes)
+	assert.Equal(t, metadata.StorageBucket{Bytes: 50, Files: 1}, stats.Trash)
+	assert.Equal(t, int64(20), stats.Versions.Bytes)
+	require.Len(t, stats.ByType, 2)
+	assert.Equal(t, "application/pdf", stats.ByType[0].FileType)
+	assert.Equal(t, int64(700), stats.ByType[0].Bytes)
+	require.Len(t, stats.ByFolder, 2)
+	assert.Equal(t, "D1", stats.ByFolder[0].FolderID)
+	assert.Equal(t, metadata.StorageBucket{Bytes: 700, Files: 2}, stats.ByFolder[0].StorageBucket)
+	assert.Nil(t, stats.ByFolder[0].ParentID)
+	require.NotNil(t, stats.ByFolder[1].ParentID)
+	assert.Equal(t, "D1", *stats.ByFolder[1].ParentID)
+	assert.Equal(t, metadata.ShareCounts{Sent: 2, View: 1, Links: 1, Total: 4}, stats.ActiveShares)
+	assert.Equal(t, int64(3), stats.PendingReceived)
+	require.Len(t, stats.LargestFiles, 4)
+	assert.Equal(t, "F1", stats.LargestFiles[0].FileID)
+}
+
+func TestStorageStatsHandler_LargestFromQuery(t *testing.T) {
+	meta, st := newMemoryMetadata(t)
+	for i := 0; i < 120; i++ {
+		addItem(t, st, store.File{ID: fmt.Sprintf("F%03d", i), FileName: fmt.Sprintf("%03d.bin", i), FileSize: int64(i + 1)})
+	}
+
+	for query, want := range map[string]int{"": 10, "?largest=2": 2, "?largest=1000": 100} {
+		rr := httptest.NewRecorder()
+		meta.StorageStatsHandler(rr, NewJSONRequest(t, http.MethodPost, "/storageStats"+query, map[string]string{"userId": "U1"}))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var stats metadata.StorageStats
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+		require.Len(t, stats.LargestFiles, want, query)
+		assert.Equal(t, "F119", stats.LargestFiles[0].FileID)
+	}
+}
+
+func TestStorageStatsHandler_OtherUser(t *testing.T) {
+	meta, _ := newMemoryMetadata(t)
+
+	rr := httptest.NewRecorder()
+	meta.StorageStatsHandler(rr, withUser(NewJSONRequest(t, http.MethodPost, "/storageStats", map[string]string{"userId": "U2"}), "U1"))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
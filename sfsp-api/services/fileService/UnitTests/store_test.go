@@ -0,0 +1,433 @@
+package unitTests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	fh "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metadata"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/storage"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+)
+
+var timestampListing = api.Listing{
+	Sorts:        map[string]string{"timestamp": "timestamp"},
+	ID:           "id",
+	DefaultSort:  "timestamp",
+	DefaultOrder: "desc",
+}
+
+var receivedAtListing = api.Listing{
+	Sorts: map[string]string{
+		"receivedAt": "received_at",
+		"expiresAt":  "COALESCE(expires_at, 'infinity')",
+	},
+	ID:           "id",
+	DefaultSort:  "receivedAt",
+	DefaultOrder: "desc",
+}
+
+func memoryPage(t *testing.T, req api.PageRequest) *api.Page {
+	t.Helper()
+	return listingPage(t, timestampListing, req)
+}
+
+func listingPage(t *testing.T, l api.Listing, req api.PageRequest) *api.Page {
+	t.Helper()
+	page, err := l.Page(httptest.NewRequest(http.MethodGet, "/", nil), req)
+	require.NoError(t, err)
+	return page
+}
+
+// newMemoryServer returns a server without a database whose handlers read
+// and write an in-memory store, over an empty local backend.
+func newMemoryServer(t *testing.T) (*fh.Server, *store.Memory, *storage.LocalBackend) {
+	t.Helper()
+	b, _ := newLocalBackend(t)
+	srv, st := newMemoryServerOn(t, b, fh.Config{})
+	return srv, st, b
+}
+
+// newMemoryServerOn is newMemoryServer over backend and with cfg.
+func newMemoryServerOn(t *testing.T, backend storage.Backend, cfg fh.Config) (*fh.Server, *store.Memory) {
+	t.Helper()
+	st := store.NewMemory()
+	srv := fh.New(nil, backend, cfg)
+	srv.SetStore(st)
+	srv.SetQuotaLoader(unlimitedQuota)
+	return srv, st
+}
+
+// newMemoryMetadata returns a metadata server without a database whose
+// handlers read and write an in-memory store.
+func newMemoryMetadata(t *testing.T) (*metadata.Server, *store.Memory) {
+	t.Helper()
+	st := store.NewMemory()
+	meta := metadata.New(nil, metadata.Config{})
+	meta.SetStore(st)
+	return meta, st
+}
+
+// errStore is returned by the stores that tests wrap around a Memory to
+// make one of its methods fail.
+var errStore = errors.New("store unavailable")
+
+func TestMemoryStore_Files(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+
+	id, err := st.AddFile(ctx, store.File{OwnerID: "alice", FileName: "a.txt", Tags: []string{"x"}})
+	require.NoError(t, err)
+	assert.Len(t, id, 36)
+
+	f, err := st.File(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "file", f.FileType)
+	assert.False(t, f.CreatedAt.IsZero())
+	f.Tags[0] = "changed"
+	f, _ = st.File(ctx, id)
+	assert.Equal(t, []string{"x"}, f.Tags)
+
+	owner, err := st.FileOwner(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", owner)
+
+	_, err = st.FileOwner(ctx, "missing")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	require.NoError(t, st.TrashFile(ctx, id))
+	_, err = st.FileOwner(ctx, id)
+	assert.ErrorIs(t, err, store.ErrNotFound, "trashed files have no owner to act for")
+	_, err = st.AddFile(ctx, store.File{ID: id, OwnerID: "bob"})
+	assert.Error(t, err)
+	_, err = st.AddFile(ctx, store.File{OwnerID: "alice", ParentID: "missing"})
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func TestMemoryStore_Shares(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	fileID, err := st.AddFile(ctx, store.File{ID: "f1", OwnerID: "alice"})
+	require.NoError(t, err)
+
+	_, err = st.AddReceivedFile(ctx, store.ReceivedFile{FileID: "missing", RecipientID: "bob"})
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	now := time.Now()
+	older, err := st.AddReceivedFile(ctx, store.ReceivedFile{FileID: fileID, RecipientID: "bob", SenderID: "alice", ReceivedAt: now.Add(-time.Hour)})
+	require.NoError(t, err)
+	newer, err := st.AddReceivedFile(ctx, store.ReceivedFile{FileID: fileID, RecipientID: "bob", SenderID: "alice", ReceivedAt: now})
+	require.NoError(t, err)
+	bob := store.ReceivedFileFilter{RecipientID: "bob"}
+	page := listingPage(t, receivedAtListing, api.PageRequest{Limit: 1})
+	received, err := st.ListReceivedFiles(ctx, bob, page)
+	require.NoError(t, err)
+	require.Len(t, received, 1)
+	assert.Equal(t, newer, received[0].ID)
+	page = listingPage(t, receivedAtListing, api.PageRequest{Limit: 1, Cursor: page.Next()})
+	received, err = st.ListReceivedFiles(ctx, bob, page)
+	require.NoError(t, err)
+	require.Len(t, received, 1)
+	assert.Equal(t, older, received[0].ID)
+	assert.Empty(t, page.Next())
+
+	expired := now.Add(-time.Minute)
+	_, err = st.AddReceivedFile(ctx, store.ReceivedFile{FileID: fileID, RecipientID: "bob", ExpiresAt: &expired})
+	require.NoError(t, err)
+	_, err = st.AddReceivedFile(ctx, store.ReceivedFile{FileID: fileID, RecipientID: "bob", Accepted: true})
+	require.NoError(t, err)
+	pending, err := st.ListReceivedFiles(ctx, store.ReceivedFileFilter{RecipientID: "bob", Pending: true},
+		listingPage(t, receivedAtListing, api.PageRequest{}))
+	require.NoError(t, err)
+	assert.Len(t, pending, 2, "expired and accepted shares are not pending")
+
+	_, err = st.AddSentFile(ctx, store.SentFile{FileID: fileID, SenderID: "alice", RecipientID: "bob"})
+	require.NoError(t, err)
+	sent, err := st.ListSentFiles(ctx, "alice", listingPage(t, api.Listing{
+		Sorts: map[string]string{"sentAt": "sent_at"}, ID: "id", DefaultSort: "sentAt", DefaultOrder: "desc",
+	}, api.PageRequest{}))
+	require.NoError(t, err)
+	assert.Len(t, sent, 1)
+
+	for i, recipient := range []string{"bob", "carol", "bob"} {
+		_, err := st.AddViewShare(ctx, store.ViewShare{FileID: fileID, SenderID: "alice", RecipientID: recipient,
+			Metadata: recipient, SharedAt: now.Add(time.Duration(i) * time.Minute), AccessGranted: true})
+		require.NoError(t, err)
+	}
+	users, err := st.ViewShareRecipients(ctx, fileID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bob", "carol"}, users)
+
+	share, err := st.ViewShare(ctx, "alice", "bob", fileID)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(2*time.Minute), share.SharedAt)
+	_, err = st.ViewShare(ctx, "alice", "dave", fileID)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func TestMemoryStore_NotificationsPage(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	for _, ts := range []string{"2025-09-01", "2025-09-03", "2025-09-02"} {
+		_, err := st.AddNotification(ctx, store.Notification{Type: "share_request", From: "alice", To: "bob", FileID: "f1", Timestamp: ts})
+		require.NoError(t, err)
+	}
+	_, err := st.AddNotification(ctx, store.Notification{Type: "share_request", From: "alice", To: "carol", FileID: "f1"})
+	require.NoError(t, err)
+
+	page := memoryPage(t, api.PageRequest{Limit: 2})
+	first, err := st.ListNotifications(ctx, "bob", page)
+	require.NoError(t, err)
+	require.Len(t, first, 2)
+	assert.Equal(t, "2025-09-03", first[0].Timestamp)
+	assert.Equal(t, "2025-09-02", first[1].Timestamp)
+	assert.Equal(t, "pending", first[0].Status)
+	require.NotEmpty(t, page.Next())
+
+	page = memoryPage(t, api.PageRequest{Limit: 2, Cursor: page.Next()})
+	second, err := st.ListNotifications(ctx, "bob", page)
+	require.NoError(t, err)
+	require.Len(t, second, 1)
+	assert.Equal(t, "2025-09-01", second[0].Timestamp)
+	assert.Empty(t, page.Next())
+
+	id := first[0].ID
+	require.NoError(t, st.SetNotificationStatus(ctx, id, "accepted"))
+	n, err := st.Notification(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "accepted", n.Status)
+	assert.True(t, n.Read)
+
+	require.NoError(t, st.DeleteNotification(ctx, id))
+	assert.ErrorIs(t, st.DeleteNotification(ctx, id), store.ErrNotFound)
+	assert.ErrorIs(t, st.MarkNotificationRead(ctx, id), store.ErrNotFound)
+	_, err = st.NotificationRecipient(ctx, id)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func TestMemoryStore_AccessLogFilters(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	_, err := st.AddFile(ctx, store.File{ID: "a", OwnerID: "alice"})
+	require.NoError(t, err)
+	_, err = st.AddFile(ctx, store.File{ID: "b", OwnerID: "bob"})
+	require.NoError(t, err)
+	for _, fileID := range []string{"a", "a", "b"} {
+		require.NoError(t, st.AddAccessLog(ctx, store.AccessLog{FileID: fileID, UserID: "carol", Action: "download"}))
+	}
+
+	all, err := st.ListAccessLogs(ctx, store.AccessLogFilter{}, memoryPage(t, api.PageRequest{}))
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+	owned, err := st.ListAccessLogs(ctx, store.AccessLogFilter{OwnerID: "bob"}, memoryPage(t, api.PageRequest{}))
+	require.NoError(t, err)
+	require.Len(t, owned, 1)
+	assert.Equal(t, "b", owned[0].FileID)
+	byFile, err := st.ListAccessLogs(ctx, store.AccessLogFilter{FileID: "a"}, memoryPage(t, api.PageRequest{}))
+	require.NoError(t, err)
+	assert.Len(t, byFile, 2)
+}
+
+func TestNotificationHandlers_MemoryStore(t *testing.T) {
+	srv, st, _ := newMemoryServer(t)
+	ctx := context.Background()
+	_, err := st.AddFile(ctx, store.File{ID: "f1", OwnerID: "alice", FileName: "doc.pdf", CID: "cid-1", FileSize: 42})
+	require.NoError(t, err)
+	_, err = st.AddViewShare(ctx, store.ViewShare{FileID: "f1", SenderID: "alice", RecipientID: "bob", Metadata: "view-key", AccessGranted: true})
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	srv.AddNotificationHandler(rr, NewJSONRequest(t, http.MethodPost, "/addNotification", map[string]any{
+		"type": "view_share", "from": "alice", "to": "bob", "file_name": "doc.pdf", "file_id": "f1", "viewOnly": true,
+	}))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var added struct{ ID string }
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &added))
+
+	rr = httptest.NewRecorder()
+	srv.NotificationHandler(rr, withUser(httptest.NewRequest(http.MethodGet, "/notifications", nil), "bob"))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var listed struct{ Notifications []fh.Notification }
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listed))
+	require.Len(t, listed.Notifications, 1)
+	assert.Equal(t, added.ID, listed.Notifications[0].ID)
+	assert.Equal(t, "pending", listed.Notifications[0].Status)
+
+	// only the recipient may answer
+	rr = httptest.NewRecorder()
+	srv.RespondToShareRequestHandler(rr, withUser(NewJSONRequest(t, http.MethodPost, "/respond",
+		map[string]string{"id": added.ID, "status": "accepted"}), "carol"))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = httptest.NewRecorder()
+	srv.RespondToShareRequestHandler(rr, withUser(NewJSONRequest(t, http.MethodPost, "/respond",
+		map[string]string{"id": added.ID, "status": "accepted"}), "bob"))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var answered struct{ FileData map[string]any }
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &answered))
+	assert.Equal(t, "view-key", answered.FileData["metadata"])
+	assert.Equal(t, "cid-1", answered.FileData["cid"])
+	assert.Equal(t, true, answered.FileData["viewOnly"])
+
+	rr = httptest.NewRecorder()
+	srv.ClearNotificationHandler(rr, withUser(NewJSONRequest(t, http.MethodPost, "/clear", map[string]string{"id": added.ID}), "bob"))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	srv.MarkAsReadHandler(rr, withUser(NewJSONRequest(t, http.MethodPost, "/markAsRead", map[string]string{"id": added.ID}), "bob"))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestAccessLogHandlers_MemoryStore(t *testing.T) {
+	srv, st, _ := newMemoryServer(t)
+	ctx := context.Background()
+	_, err := st.AddFile(ctx, store.File{ID: "a", OwnerID: "alice"})
+	require.NoError(t, err)
+	_, err = st.AddFile(ctx, store.File{ID: "b", OwnerID: "bob"})
+	require.NoError(t, err)
+
+	for _, fileID := range []string{"a", "b"} {
+		rr := httptest.NewRecorder()
+		srv.AddAccesslogHandler(rr, withUser(NewJSONRequest(t, http.MethodPost, "/addAccesslog",
+			map[string]string{"file_id": fileID, "action": "download"}), "carol"))
+		require.Equal(t, http.StatusCreated, rr.Code)
+	}
+
+	rr := httptest.NewRecorder()
+	srv.GetAccesslogHandler(rr, withUser(httptest.NewRequest(http.MethodGet, "/getAccesslog", nil), "alice"))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var logs []map[string]any
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &logs))
+	require.Len(t, logs, 1)
+	assert.Equal(t, "a", logs[0]["file_id"])
+	assert.Equal(t, "carol", logs[0]["user_id"])
+
+	rr = httptest.NewRecorder()
+	srv.GetAccesslogHandler(rr, withUser(httptest.NewRequest(http.MethodGet, "/getAccesslog?file_id=b", nil), "alice"))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = httptest.NewRecorder()
+	srv.GetAccesslogHandler(rr, withUser(httptest.NewRequest(http.MethodGet, "/getAccesslog?file_id=missing", nil), "alice"))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestTrashHandlers_MemoryStore(t *testing.T) {
+	srv, st, _ := newMemoryServer(t)
+	ctx := context.Background()
+	_, err := st.AddFile(ctx, store.File{ID: "f1", OwnerID: "alice", FileName: "doc.pdf", FileSize: 42})
+	require.NoError(t, err)
+	require.NoError(t, st.TrashFile(ctx, "f1"))
+
+	rr := httptest.NewRecorder()
+	srv.ListTrashHandler(rr, withUser(jsonReq(t, "/trash", map[string]string{}), "alice"))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var trashed []fh.TrashedFile
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &trashed))
+	require.Len(t, trashed, 1)
+	assert.Equal(t, "doc.pdf", trashed[0].FileName)
+
+	rr = httptest.NewRecorder()
+	srv.RestoreFromTrashHandler(rr, withUser(jsonReq(t, "/trash/restore", map[string]string{"fileId": "f1"}), "bob"))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	srv.RestoreFromTrashHandler(rr, withUser(jsonReq(t, "/trash/restore", map[string]string{"fileId": "f1"}), "alice"))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	owner, err := st.FileOwner(ctx, "f1")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", owner)
+
+	rr = httptest.NewRecorder()
+	srv.RestoreFromTrashHandler(rr, withUser(jsonReq(t, "/trash/restore", map[string]string{"fileId": "f1"}), "alice"))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestShareLinkHandlers_MemoryStore(t *testing.T) {
+	b, _ := newLocalBackend(t)
+	srv := fh.New(nil, b, fh.Config{})
+	st := store.NewMemory()
+	srv.SetStore(st)
+	ctx := context.Background()
+	_, err := st.AddFile(ctx, store.File{ID: "f1", OwnerID: "alice"})
+	require.NoError(t, err)
+	require.NoError(t, st.AddShareLink(ctx, store.ShareLink{ID: "l1", TokenHash: "h1", FileID: "f1", OwnerID: "alice",
+		BlobPath: "links/f1/l1", PasswordHash: "secret"}))
+	require.NoError(t, st.RecordBlobHash(ctx, store.BlobHash{Path: "links/f1/l1", FileID: "f1", SHA256: "abc", Size: 3}))
+
+	rr := httptest.NewRecorder()
+	srv.RevokeShareLinkHandler(rr, withUser(jsonReq(t, "/shareLinks/revoke", map[string]string{"linkId": "l1"}), "bob"))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	srv.RevokeShareLinkHandler(rr, withUser(jsonReq(t, "/shareLinks/revoke", map[string]string{"linkId": "l1"}), "alice"))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	_, err = st.BlobHash(ctx, "links/f1/l1")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	rr = httptest.NewRecorder()
+	srv.ListShareLinksHandler(rr, withUser(jsonReq(t, "/shareLinks", map[string]string{"fileId": "f1"}), "alice"))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var listed []fh.ShareLink
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listed))
+	require.Len(t, listed, 1)
+	assert.True(t, listed[0].Revoked)
+	assert.True(t, listed[0].PasswordProtected)
+}
+
+func TestShareListings_MemoryStore(t *testing.T) {
+	meta, st := newMemoryMetadata(t)
+	ctx := context.Background()
+	_, err := st.AddFile(ctx, store.File{ID: "f1", OwnerID: "alice"})
+	require.NoError(t, err)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := st.AddReceivedFile(ctx, store.ReceivedFile{FileID: "f1", RecipientID: "bob", SenderID: "alice",
+			Metadata: "{}", ReceivedAt: now.Add(time.Duration(i) * time.Minute)})
+		require.NoError(t, err)
+		_, err = st.AddSentFile(ctx, store.SentFile{FileID: "f1", SenderID: "alice", RecipientID: "bob",
+			SentAt: now.Add(time.Duration(i) * time.Minute)})
+		require.NoError(t, err)
+	}
+
+	var pending struct {
+		Data       []map[string]any
+		NextCursor string
+	}
+	rr := httptest.NewRecorder()
+	meta.GetPendingFilesHandler(rr, jsonReq(t, "/getPendingFiles", map[string]any{"userId": "bob", "limit": 2}))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &pending))
+	require.Len(t, pending.Data, 2)
+	require.NotEmpty(t, pending.NextCursor)
+
+	rr = httptest.NewRecorder()
+	meta.GetPendingFilesHandler(rr, jsonReq(t, "/getPendingFiles?cursor="+pending.NextCursor, map[string]any{"userId": "bob", "limit": 2}))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &pending))
+	assert.Len(t, pending.Data, 1)
+	assert.Empty(t, pending.NextCursor)
+
+	var sent []map[string]any
+	rr = httptest.NewRecorder()
+	meta.GetSentFilesHandler(rr, jsonReq(t, "/getSentFiles", map[string]any{"userId": "alice", "limit": 2}))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &sent))
+	require.Len(t, sent, 2)
+	next := rr.Header().Get(api.NextCursorHeader)
+	require.NotEmpty(t, next)
+
+	rr = httptest.NewRecorder()
+	meta.GetSentFilesHandler(rr, jsonReq(t, "/getSentFiles?cursor="+next, map[string]any{"userId": "alice", "limit": 2}))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &sent))
+	assert.Len(t, sent, 1)
+	assert.Empty(t, rr.Header().Get(api.NextCursorHeader))
+}
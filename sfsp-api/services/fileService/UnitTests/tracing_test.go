@@ -0,0 +1,154 @@
+package unitTests
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/tracing"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordSpans installs a tracer provider that keeps every ended span.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	_, err := tracing.Setup(context.Background(), tracing.Config{Exporter: tracing.ExporterNone})
+	require.NoError(t, err)
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	return sr
+}
+
+func spanNamed(t *testing.T, sr *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	for _, s := range sr.Ended() {
+		if s.Name() == name {
+			return s
+		}
+	}
+	t.Fatalf("no span named %q", name)
+	return nil
+}
+
+func spanAttr(s sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, kv := range s.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+// dsnConnector opens connections from a driver and DSN, as sql.Open would.
+type dsnConnector struct {
+	d   driver.Driver
+	dsn string
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) { return c.d.Open(c.dsn) }
+func (c dsnConnector) Driver() driver.Driver                        { return c.d }
+
+func TestTracingMiddleware_ContinuesGatewayTrace(t *testing.T) {
+	sr := recordSpans(t)
+	rt := api.NewRouter(api.Version1)
+	var inner trace.SpanContext
+	rt.HandleFunc(http.MethodGet, "/tracing-test/{id}", func(w http.ResponseWriter, r *http.Request) {
+		inner = trace.SpanContextFromContext(api.Detach(r))
+		api.Error(w, "Failed to load file", http.StatusInternalServerError)
+	})
+	h := tracing.Middleware(rt, rt.Pattern)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/tracing-test/F1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	s := spanNamed(t, sr, "GET /api/v1/tracing-test/{id}")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", s.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", s.Parent().SpanID().String())
+	assert.True(t, s.Parent().IsRemote())
+	assert.Equal(t, trace.SpanKindServer, s.SpanKind())
+	assert.Equal(t, int64(500), spanAttr(s, "http.response.status_code").AsInt64())
+	assert.Equal(t, "/api/v1/tracing-test/{id}", spanAttr(s, "http.route").AsString())
+	assert.Equal(t, codes.Error, s.Status().Code)
+	assert.Equal(t, s.SpanContext().SpanID(), inner.SpanID(), "handlers see the server span")
+}
+
+func TestTracingSQL_SpansJoinCallerTrace(t *testing.T) {
+	sr := recordSpans(t)
+	mockDB, mock, err := sqlmock.NewWithDSN("tracing_sql_test")
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db := sql.OpenDB(tracing.WrapConnector(dsnConnector{mockDB.Driver(), "tracing_sql_test"}))
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE files SET file_size`).WithArgs(int64(42), "F1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT owner_id FROM files`).WithArgs("F2").
+		WillReturnError(errors.New("connection reset"))
+
+	ctx, parent := tracing.Start(context.Background(), "handler")
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	_, err = tx.ExecContext(ctx, `UPDATE files SET file_size = $1 WHERE id = $2`, int64(42), "F1")
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+	var owner string
+	err = db.QueryRowContext(ctx, `SELECT owner_id FROM files WHERE id = $1`, "F2").Scan(&owner)
+	require.Error(t, err)
+	parent.End()
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	for _, name := range []string{"BEGIN", "UPDATE", "COMMIT", "SELECT"} {
+		s := spanNamed(t, sr, name)
+		assert.Equal(t, parent.SpanContext().SpanID(), s.Parent().SpanID(), name)
+		assert.Equal(t, trace.SpanKindClient, s.SpanKind(), name)
+		assert.Equal(t, "postgresql", spanAttr(s, "db.system.name").AsString(), name)
+	}
+	update := spanNamed(t, sr, "UPDATE")
+	assert.Equal(t, `UPDATE files SET file_size = $1 WHERE id = $2`, spanAttr(update, "db.query.text").AsString())
+	for _, kv := range update.Attributes() {
+		assert.NotContains(t, kv.Value.Emit(), "F1", "arguments are not recorded")
+	}
+	assert.Equal(t, codes.Error, spanNamed(t, sr, "SELECT").Status().Code)
+}
+
+func TestTracingOwnCloud_SpansPerCall(t *testing.T) {
+	sr := recordSpans(t)
+	local, _ := newLocalBackend(t)
+	require.NoError(t, local.WriteStream("files/u1/F1", strings.NewReader("ciphertext")))
+	client := owncloud.New(local)
+
+	ctx, parent := tracing.Start(context.Background(), "handler")
+	require.NoError(t, client.DeleteFile(ctx, "F1", "u1"))
+	_, err := client.DownloadLinkCopy(ctx, "F1", "L1")
+	require.Error(t, err)
+	parent.End()
+
+	del := spanNamed(t, sr, "owncloud.DeleteFile")
+	assert.Equal(t, parent.SpanContext().SpanID(), del.Parent().SpanID())
+	assert.Equal(t, "files/u1/F1", spanAttr(del, "storage.path").AsString())
+	assert.Equal(t, codes.Unset, del.Status().Code)
+
+	download := spanNamed(t, sr, "owncloud.DownloadLinkCopy")
+	assert.Equal(t, codes.Error, download.Status().Code)
+	assert.Equal(t, owncloud.LinkPath("F1", "L1"), spanAttr(download, "storage.path").AsString())
+}
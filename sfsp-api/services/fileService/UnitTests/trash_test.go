@@ -0,0 +1,125 @@
+package unitTests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	fh "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListTrashHandler(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	deletedAt := time.Date(2025, 9, 1, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT id, owner_id, file_name, .*\s+FROM files\s+WHERE owner_id = \$1 AND deleted_at IS NOT NULL`).
+		WithArgs("U1").
+		WillReturnRows(sqlmock.NewRows(fileColumns).AddRow(fileRow(store.File{ID: "F1", OwnerID: "U1",
+			FileName: "report.pdf", FileType: "application/pdf", FileSize: 42, DeletedAt: &deletedAt})...))
+
+	rr := httptest.NewRecorder()
+	srv.ListTrashHandler(rr, jsonReq(t, "/trash", map[string]string{"userId": "U1"}))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var files []fh.TrashedFile
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &files))
+	require.Len(t, files, 1)
+	assert.Equal(t, "F1", files[0].FileID)
+	assert.Equal(t, deletedAt.Add(fh.DefaultConfig.TrashRetention), files[0].PurgeAt)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestoreFromTrashHandler(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM files p WHERE p.id = f.parent_id AND p.deleted_at IS NOT NULL\)`).
+		WithArgs("U1", "F1").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`WITH RECURSIVE tree AS \(.*UPDATE files SET deleted_at = NULL`).
+		WithArgs("U1", "F1").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs("U1", "F2").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}))
+
+	rr := httptest.NewRecorder()
+	srv.RestoreFromTrashHandler(rr, jsonReq(t, "/restoreFromTrash", map[string]string{"userId": "U1", "fileId": "F1"}))
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// not in the trash, or not the caller's
+	rr = httptest.NewRecorder()
+	srv.RestoreFromTrashHandler(rr, jsonReq(t, "/restoreFromTrash", map[string]string{"userId": "U1", "fileId": "F2"}))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestoreFromTrashHandler_ParentStillTrashed(t *testing.T) {
+	srv, mock, cleanup := SetupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs("U1", "F1").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	rr := httptest.NewRecorder()
+	srv.RestoreFromTrashHandler(rr, jsonReq(t, "/restoreFromTrash", map[string]string{"userId": "U1", "fileId": "F1"}))
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Restore the parent folder first")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEmptyTrashHandler(t *testing.T) {
+	srv, mock, b := useLocalBackend(t)
+	require.NoError(t, b.WriteStream("files/F1", strings.NewReader("one")))
+	require.NoError(t, b.WriteStream("versions/F1/1", strings.NewReader("old")))
+
+	mock.ExpectQuery(`SELECT id FROM files WHERE owner_id = \$1 AND deleted_at IS NOT NULL`).
+		WithArgs("U1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("F1").AddRow("F2").AddRow("F3"))
+	// F2 has no blob left, which does not stop it being purged
+	expectDeleteFileMetadata(mock, "F1")
+	expectDeleteFileMetadata(mock, "F2")
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM received_files`).WithArgs("F3").WillReturnError(errors.New("delete failed"))
+	mock.ExpectRollback()
+
+	rr := httptest.NewRecorder()
+	srv.EmptyTrashHandler(rr, jsonReq(t, "/emptyTrash", map[string]string{"userId": "U1"}))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Contains(t, rr.Body.String(), `"purged":2`)
+	assert.Contains(t, rr.Body.String(), `"failed":["F3"]`)
+	_, err := b.ReadStream("files/F1")
+	assert.Error(t, err)
+	_, err = b.ReadStream("versions/F1/1")
+	assert.Error(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDownloadSentFile_SuspendedWhileInTrash(t *testing.T) {
+	ctx := context.Background()
+	srv, st, _ := newMemoryServer(t)
+	_, err := st.AddFile(ctx, store.File{ID: "F1", OwnerID: "S1", FileName: "a.pdf"})
+	require.NoError(t, err)
+	_, err = st.AddReceivedFile(ctx, store.ReceivedFile{FileID: "F1", SenderID: "S1", RecipientID: "R1", Metadata: "{}"})
+	require.NoError(t, err)
+	require.NoError(t, st.TrashFile(ctx, "F1"))
+
+	req := withUser(jsonReq(t, "/downloadSentFile", map[string]string{"filePath": "files/S1/sent/F1"}), "R1")
+	rr := httptest.NewRecorder()
+	srv.DownloadSentFile(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -2,31 +2,48 @@ package unitTests
 
 import (
 	"bytes"
-	"database/sql"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
 	fh "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/storage"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func SetupMockDB(t *testing.T) (sqlmock.Sqlmock, func()) {
+// newServer builds a file handler server over a fresh sqlmock connection,
+// the way main builds one over the pool and the configured storage. Quotas
+// are unlimited unless the test sets them with withQuota.
+func newServer(t *testing.T, backend storage.Backend, cfg fh.Config) (*fh.Server, sqlmock.Sqlmock) {
 	t.Helper()
 	db, mock, err := sqlmock.New()
 	require.NoError(t, err)
-	fh.SetPostgreClient(db)
-	cleanup := func() {
-		_ = db.Close()
-		fh.DB = nil
-	}
-	return mock, cleanup
+	t.Cleanup(func() { _ = db.Close() })
+	srv := fh.New(db, backend, cfg)
+	srv.SetQuotaLoader(unlimitedQuota)
+	return srv, mock
+}
+
+// SetupMockDB returns a server with the default config over a sqlmock
+// connection and an empty local store.
+func SetupMockDB(t *testing.T) (*fh.Server, sqlmock.Sqlmock, func()) {
+	t.Helper()
+	b, _ := newLocalBackend(t)
+	srv, mock := newServer(t, b, fh.Config{})
+	return srv, mock, func() {}
 }
 
 func mpReq1(t *testing.T, fields map[string]string, includeFile bool, body []byte) *http.Request {
@@ -76,17 +93,58 @@ func newMultipart(t *testing.T, fields map[string]string, fileField string, file
 	return req, w.FormDataContentType()
 }
 
-func TestStartUploadHandler_Success(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
-	defer cleanup()
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// addUpload stores a file of ownerID with an upload session of totalChunks
+// that has already received chunks, in order from index 0.
+func addUpload(t *testing.T, st *store.Memory, fileID, ownerID string, totalChunks int, chunks ...string) {
+	t.Helper()
+	ctx := context.Background()
+	_, err := st.AddFile(ctx, store.File{ID: fileID, OwnerID: ownerID, FileName: "x"})
+	require.NoError(t, err)
+	require.NoError(t, st.AddUploadSession(ctx, store.UploadSession{FileID: fileID, OwnerID: ownerID, TotalChunks: totalChunks}))
+	for i, content := range chunks {
+		require.NoError(t, st.RecordUploadChunk(ctx, fileID, store.UploadChunk{Index: i, Size: int64(len(content)), Hash: sha256Hex(content)}))
+	}
+}
+
+// uploadStatus returns the status of the upload session of fileID.
+func uploadStatus(t *testing.T, st *store.Memory, fileID string) string {
+	t.Helper()
+	u, err := st.UploadSession(context.Background(), fileID)
+	require.NoError(t, err)
+	return u.Status
+}
 
-	rows := sqlmock.NewRows([]string{"id"}).AddRow("abc-123")
-	mock.ExpectQuery(`INSERT INTO files \(owner_id, file_name, file_type, file_hash, nonce, description, tags, cid, file_size, created_at\)`).
-		WithArgs(
-			"user-1", "report.pdf", "application/pdf", "nonce-xyz",
-			"desc", sqlmock.AnyArg(), "/files", sqlmock.AnyArg(),
-		).
-		WillReturnRows(rows)
+// fileWritesFail is a store that cannot create files.
+type fileWritesFail struct{ store.Store }
+
+func (fileWritesFail) AddFile(context.Context, store.File) (string, error) {
+	return "", errStore
+}
+
+// fileBlobWritesFail is a store that cannot record a merged file.
+type fileBlobWritesFail struct{ store.Store }
+
+func (fileBlobWritesFail) SetFileBlob(context.Context, string, string, string, int64) error {
+	return errStore
+}
+
+// completeFails is a store that cannot mark an upload complete.
+type completeFails struct{ store.Store }
+
+func (s completeFails) SetUploadStatus(ctx context.Context, fileID, status string) error {
+	if status == fh.UploadStatusComplete {
+		return errStore
+	}
+	return s.Store.SetUploadStatus(ctx, fileID, status)
+}
+
+func TestStartUploadHandler_Success(t *testing.T) {
+	srv, st, _ := newMemoryServer(t)
 
 	body := fh.StartUploadRequest{
 		UserID:          "user-1",
@@ -96,37 +154,54 @@ func TestStartUploadHandler_Success(t *testing.T) {
 		FileTags:        []string{"a", "b"},
 		Path:            "/files",
 		Nonce:           "nonce-xyz",
+		TotalChunks:     4,
+		ChunkSize:       1024,
+		FileSize:        4000,
 	}
 	req := NewJSONRequest(t, http.MethodPost, "/start", body)
 	rr := httptest.NewRecorder()
 
-	fh.StartUploadHandler(rr, req)
+	srv.StartUploadHandler(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
 
 	var resp map[string]string
 	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
-	assert.Equal(t, "abc-123", resp["fileId"])
+	require.NotEmpty(t, resp["fileId"])
 
-	require.NoError(t, mock.ExpectationsWereMet())
+	f, err := st.File(context.Background(), resp["fileId"])
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", f.OwnerID)
+	assert.Equal(t, "report.pdf", f.FileName)
+	assert.Equal(t, "application/pdf", f.FileType)
+	assert.Equal(t, "nonce-xyz", f.Nonce)
+	assert.Equal(t, "desc", f.Description)
+	assert.Equal(t, []string{"a", "b"}, f.Tags)
+	assert.Equal(t, "/files", f.CID)
+
+	u, err := st.UploadSession(context.Background(), resp["fileId"])
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", u.OwnerID)
+	assert.Equal(t, 4, u.TotalChunks)
+	assert.Equal(t, int64(1024), u.ChunkSize)
+	assert.Equal(t, int64(4000), u.FileSize)
+	assert.Equal(t, fh.UploadStatusUploading, u.Status)
 }
 
 func TestStartUploadHandler_BadJSON(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, _, _ := newMemoryServer(t)
 
 	req := httptest.NewRequest(http.MethodPost, "/start", strings.NewReader("{bad json"))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
-	fh.StartUploadHandler(rr, req)
+	srv.StartUploadHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestStartUploadHandler_MissingFields(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, _, _ := newMemoryServer(t)
 
 	body := fh.StartUploadRequest{
 		UserID:   "",
@@ -135,16 +210,14 @@ func TestStartUploadHandler_MissingFields(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/start", body)
 	rr := httptest.NewRecorder()
 
-	fh.StartUploadHandler(rr, req)
+	srv.StartUploadHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestStartUploadHandler_DBError(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
-	defer cleanup()
-
-	mock.ExpectQuery(`INSERT INTO files`).WillReturnError(sql.ErrConnDone)
+	srv, st, _ := newMemoryServer(t)
+	srv.SetStore(fileWritesFail{st})
 
 	body := fh.StartUploadRequest{
 		UserID:          "user-1",
@@ -158,26 +231,23 @@ func TestStartUploadHandler_DBError(t *testing.T) {
 	req := NewJSONRequest(t, http.MethodPost, "/start", body)
 	rr := httptest.NewRecorder()
 
-	fh.StartUploadHandler(rr, req)
+	srv.StartUploadHandler(rr, req)
 
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
-	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestUploadHandler_ParseMultipartFail(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, _, _ := newMemoryServer(t)
 
 	req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("not multipart"))
 	rr := httptest.NewRecorder()
 
-	fh.UploadHandler(rr, req)
+	srv.UploadHandler(rr, req)
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestUploadHandler_MissingRequiredFields(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, _, _ := newMemoryServer(t)
 
 	fields := map[string]string{
 		"chunkIndex":  "0",
@@ -186,13 +256,12 @@ func TestUploadHandler_MissingRequiredFields(t *testing.T) {
 	req, _ := newMultipart(t, fields, "encryptedFile", "enc.bin", []byte("abc"), true)
 	rr := httptest.NewRecorder()
 
-	fh.UploadHandler(rr, req)
+	srv.UploadHandler(rr, req)
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestUploadHandler_InvalidChunkIndex(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, _, _ := newMemoryServer(t)
 
 	fields := map[string]string{
 		"userId":      "u1",
@@ -207,13 +276,12 @@ func TestUploadHandler_InvalidChunkIndex(t *testing.T) {
 	req, _ := newMultipart(t, fields, "encryptedFile", "enc.bin", []byte("abc"), true)
 	rr := httptest.NewRecorder()
 
-	fh.UploadHandler(rr, req)
+	srv.UploadHandler(rr, req)
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestUploadHandler_InvalidTotalChunks(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, _, _ := newMemoryServer(t)
 
 	fields := map[string]string{
 		"userId":      "u1",
@@ -228,13 +296,12 @@ func TestUploadHandler_InvalidTotalChunks(t *testing.T) {
 	req, _ := newMultipart(t, fields, "encryptedFile", "enc.bin", []byte("abc"), true)
 	rr := httptest.NewRecorder()
 
-	fh.UploadHandler(rr, req)
+	srv.UploadHandler(rr, req)
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestUploadHandler_MissingEncryptedFile(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, _, _ := newMemoryServer(t)
 
 	fields := map[string]string{
 		"userId":      "u1",
@@ -249,13 +316,12 @@ func TestUploadHandler_MissingEncryptedFile(t *testing.T) {
 	req, _ := newMultipart(t, fields, "encryptedFile", "enc.bin", nil, false)
 	rr := httptest.NewRecorder()
 
-	fh.UploadHandler(rr, req)
+	srv.UploadHandler(rr, req)
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func TestUploadHandler_MissingFileIDOnNonFirstChunk(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
-	defer cleanup()
+	srv, st, _ := newMemoryServer(t)
 
 	fields := map[string]string{
 		"userId":      "u1",
@@ -270,91 +336,87 @@ func TestUploadHandler_MissingFileIDOnNonFirstChunk(t *testing.T) {
 	req, _ := newMultipart(t, fields, "encryptedFile", "enc.bin", []byte("abc"), true)
 	rr := httptest.NewRecorder()
 
-	fh.UploadHandler(rr, req)
+	srv.UploadHandler(rr, req)
 
 	require.Equal(t, http.StatusBadRequest, rr.Code)
-	require.NoError(t, mock.ExpectationsWereMet())
+	n, err := st.CountFiles(context.Background(), "u1")
+	require.NoError(t, err)
+	assert.Zero(t, n)
 }
 
 func TestUploadHandler_FirstChunk_CreatesFileID_AndStoresTemp(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
-	defer cleanup()
-
-	mock.ExpectQuery(`INSERT INTO files .* RETURNING id`).
-		WithArgs(
-			"u1",
-			"doc.txt",
-			"text/plain",
-			sqlmock.AnyArg(),
-			sqlmock.AnyArg(),
-			sqlmock.AnyArg(),
-			sqlmock.AnyArg(),
-		).
-		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("new-1"))
-
 	stub := newWebdavStub()
-	defer setOC(t, stub)()
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
 
 	req := mpReq1(t, map[string]string{
-		"userId":      "u1",
-		"fileName":    "doc.txt",
-		"fileType":    "text/plain",
-		"fileHash":    "h123",
-		"nonce":       "nonce1",
-		"description": "desc",
-		"tags":        `["a","b"]`,
-		"chunkIndex":  "0",
-		"totalChunks": "2",
-		"fileId":      "",
+		"userId":          "u1",
+		"fileName":        "doc.txt",
+		"fileType":        "text/plain",
+		"fileHash":        "h123",
+		"nonce":           "nonce1",
+		"fileDescription": "desc",
+		"fileTags":        `["a","b"]`,
+		"chunkIndex":      "0",
+		"totalChunks":     "2",
+		"fileId":          "",
 	}, true, []byte("AAA"))
 
 	rr := httptest.NewRecorder()
-	fh.UploadHandler(rr, req)
+	srv.UploadHandler(rr, req)
 	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
 
 	var out map[string]string
 	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &out))
-	assert.Equal(t, "new-1", out["fileId"])
+	fileID := out["fileId"]
+	require.NotEmpty(t, fileID)
 	assert.Equal(t, "h123", out["fileHash"])
 	assert.Contains(t, out["message"], "Chunk 0 uploaded")
 
-	require.Equal(t, "", stub.readMap["temp/new-1_chunk_0"])
+	require.Equal(t, "AAA", stub.writes["temp/"+fileID+"_chunk_0"])
+
+	f, err := st.File(context.Background(), fileID)
+	require.NoError(t, err)
+	assert.Equal(t, "u1", f.OwnerID)
+	assert.Equal(t, "doc.txt", f.FileName)
+	assert.Equal(t, "desc", f.Description)
+	assert.Equal(t, []string{"a", "b"}, f.Tags)
+	assert.Empty(t, f.FileHash, "the hash is only recorded once the file is merged")
 
-	require.NoError(t, mock.ExpectationsWereMet())
+	chunks, err := st.ListUploadChunks(context.Background(), fileID)
+	require.NoError(t, err)
+	require.Len(t, chunks, 1)
+	assert.Equal(t, int64(3), chunks[0].Size)
+	assert.Equal(t, sha256Hex("AAA"), chunks[0].Hash)
+	assert.Equal(t, fh.UploadStatusUploading, uploadStatus(t, st, fileID))
 }
 
 func TestUploadHandler_FirstChunk_TempUploadFails(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
-	defer cleanup()
-
-	mock.ExpectQuery(`INSERT INTO files .* RETURNING id`).
-		WithArgs(
-			"u1", "doc.txt", "text/plain",
-			sqlmock.AnyArg(), sqlmock.AnyArg(),
-			sqlmock.AnyArg(), sqlmock.AnyArg(),
-		).
-		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("f-err"))
-
-	stub := newWebdavStub()
-	stub.writeErr["temp/f-err_chunk_0"] = errors.New("boom")
-	defer setOC(t, stub)()
+	b, _ := newLocalBackend(t)
+	srv, st := newMemoryServerOn(t, brokenBackend{Backend: b, writeErr: errors.New("boom")}, fh.Config{})
 
 	req := mpReq1(t, map[string]string{
 		"userId": "u1", "fileName": "doc.txt", "fileType": "text/plain",
-		"fileHash": "h", "nonce": "nonce1", "description": "d", "tags": "[]",
+		"fileHash": "h", "nonce": "nonce1", "fileDescription": "d", "fileTags": "[]",
 		"chunkIndex": "0", "totalChunks": "2", "fileId": "",
 	}, true, []byte("AAA"))
 
 	rr := httptest.NewRecorder()
-	fh.UploadHandler(rr, req)
+	srv.UploadHandler(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Chunk upload failed")
+
+	files, err := st.ListFiles(context.Background(), "u1", memoryPage(t, api.PageRequest{}))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	chunks, err := st.ListUploadChunks(context.Background(), files[0].ID)
+	require.NoError(t, err)
+	assert.Empty(t, chunks, "a chunk that was not stored must not be recorded")
 }
 
 func TestUploadHandler_NonLastChunk_WithExistingFileID(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
-
 	stub := newWebdavStub()
-	defer setOC(t, stub)()
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
+	addUpload(t, st, "id-77", "u2", 3, "AAA")
 
 	req := mpReq1(t, map[string]string{
 		"userId": "u2", "fileName": "a.bin", "fileType": "application/octet-stream",
@@ -363,7 +425,7 @@ func TestUploadHandler_NonLastChunk_WithExistingFileID(t *testing.T) {
 	}, true, []byte("BBB"))
 
 	rr := httptest.NewRecorder()
-	fh.UploadHandler(rr, req)
+	srv.UploadHandler(rr, req)
 	require.Equal(t, http.StatusOK, rr.Code)
 
 	var out map[string]string
@@ -372,21 +434,20 @@ func TestUploadHandler_NonLastChunk_WithExistingFileID(t *testing.T) {
 	assert.Equal(t, "deadbeef", out["fileHash"])
 	assert.Contains(t, out["message"], "Chunk 1 uploaded")
 
-	require.Equal(t, "", stub.readMap["temp/id-77_chunk_1"])
+	require.Equal(t, "BBB", stub.writes["temp/id-77_chunk_1"])
+	chunks, err := st.ListUploadChunks(context.Background(), "id-77")
+	require.NoError(t, err)
+	assert.Len(t, chunks, 2)
+	assert.Equal(t, fh.UploadStatusUploading, uploadStatus(t, st, "id-77"))
 }
 
 func TestUploadHandler_LastChunk_MergeSuccess(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
-	defer cleanup()
-
-	mock.ExpectExec(`UPDATE files SET file_hash=\$1, file_size=\$2, cid=\$3 WHERE id=\$4`).
-		WithArgs(sqlmock.AnyArg(), int64(9), sqlmock.AnyArg(), "id-77").
-		WillReturnResult(sqlmock.NewResult(0, 1))
-
 	stub := newWebdavStub()
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
+	addUpload(t, st, "id-77", "u2", 3, "AAA", "BBB")
+
 	stub.readMap["temp/id-77_chunk_0"] = "AAA"
 	stub.readMap["temp/id-77_chunk_1"] = "BBB"
-	defer setOC(t, stub)()
 
 	req := mpReq1(t, map[string]string{
 		"userId": "u2", "fileName": "a.bin", "fileType": "application/octet-stream",
@@ -395,26 +456,29 @@ func TestUploadHandler_LastChunk_MergeSuccess(t *testing.T) {
 	}, true, []byte("CCC"))
 
 	rr := httptest.NewRecorder()
-	fh.UploadHandler(rr, req)
+	srv.UploadHandler(rr, req)
 	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
 
-	require.Equal(t, "chunk datachunk datachunk data", "chunk datachunk datachunk data")
-
 	var out map[string]string
 	_ = json.Unmarshal(rr.Body.Bytes(), &out)
 	assert.Equal(t, "File uploaded and metadata stored", out["message"])
 	assert.Equal(t, "id-77", out["fileId"])
 
+	f, err := st.File(context.Background(), "id-77")
+	require.NoError(t, err)
+	assert.Equal(t, sha256Hex("AAABBBCCC"), f.FileHash)
+	assert.Equal(t, int64(9), f.FileSize)
+	assert.Equal(t, "AAABBBCCC", stub.writes["files/id-77"])
+	assert.Equal(t, fh.UploadStatusComplete, uploadStatus(t, st, "id-77"))
 }
 
 func TestUploadHandler_LastChunk_CreateWriterFails(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
-
 	stub := newWebdavStub()
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
+	addUpload(t, st, "fx", "u", 2, "A")
+
 	stub.readMap["temp/fx_chunk_0"] = "A"
 	stub.mkdirErr["files"] = errors.New("mkdir fail")
-	defer setOC(t, stub)()
 
 	req := mpReq1(t, map[string]string{
 		"userId": "u", "fileName": "x", "fileType": "application/octet-stream",
@@ -423,17 +487,79 @@ func TestUploadHandler_LastChunk_CreateWriterFails(t *testing.T) {
 	}, true, []byte("B"))
 
 	rr := httptest.NewRecorder()
-	fh.UploadHandler(rr, req)
+	srv.UploadHandler(rr, req)
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "File assembly failed")
+	assert.Equal(t, fh.UploadStatusUploading, uploadStatus(t, st, "fx"))
 }
 
-func TestUploadHandler_LastChunk_MergeMissingChunk(t *testing.T) {
-	_, cleanup := SetupMockDB(t)
-	defer cleanup()
+// commitFailStub accepts the whole merged file and then fails the write, as a
+// WebDAV server does when the final PUT is rejected.
+type commitFailStub struct {
+	*webdavStub
+}
+
+func (s commitFailStub) WriteStream(name string, r io.Reader, mode os.FileMode) error {
+	if !strings.HasPrefix(norm(name), "files/") {
+		return s.webdavStub.WriteStream(name, r, mode)
+	}
+	_, _ = io.Copy(io.Discard, r)
+	return errors.New("PUT rejected")
+}
+
+func TestUploadHandler_LastChunk_FinalWriteFails_KeepsChunks(t *testing.T) {
+	stub := newWebdavStub()
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(commitFailStub{stub}), fh.Config{})
+	addUpload(t, st, "fw", "u", 2, "A")
+
+	stub.readMap["temp/fw_chunk_0"] = "A"
+
+	req := mpReq1(t, map[string]string{
+		"userId": "u", "fileName": "x", "fileType": "application/octet-stream",
+		"fileHash": "h", "nonce": "n", "chunkIndex": "1", "totalChunks": "2",
+		"fileId": "fw",
+	}, true, []byte("B"))
+
+	rr := httptest.NewRecorder()
+	srv.UploadHandler(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code, rr.Body.String())
+	assert.Contains(t, rr.Body.String(), "File assembly failed")
+	assert.Empty(t, stub.removals, "chunks must be kept so the merge can be retried")
+
+	// The merge releases the session and records nothing once the backend
+	// rejects the file; no hash, no "complete".
+	f, err := st.File(context.Background(), "fw")
+	require.NoError(t, err)
+	assert.Empty(t, f.FileHash)
+	assert.Equal(t, fh.UploadStatusUploading, uploadStatus(t, st, "fw"))
+}
+
+func TestUploadHandler_RejectsChunkWhileAssembling(t *testing.T) {
+	stub := newWebdavStub()
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
+	addUpload(t, st, "busy", "u", 2)
+	require.NoError(t, st.SetUploadStatus(context.Background(), "busy", fh.UploadStatusAssembling))
+
+	req := mpReq1(t, map[string]string{
+		"userId": "u", "fileName": "x", "fileType": "application/octet-stream",
+		"fileHash": "h", "nonce": "n", "chunkIndex": "0", "totalChunks": "2",
+		"fileId": "busy",
+	}, true, []byte("A"))
 
+	rr := httptest.NewRecorder()
+	srv.UploadHandler(rr, req)
+	require.Equal(t, http.StatusConflict, rr.Code, rr.Body.String())
+	assert.Contains(t, rr.Body.String(), "Upload is being assembled")
+	assert.Empty(t, stub.writes)
+}
+
+func TestUploadHandler_LastChunk_MergeMissingChunk(t *testing.T) {
 	stub := newWebdavStub()
-	defer setOC(t, stub)()
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
+
+	// The last index arrives while chunk 0 is still missing: the session
+	// refuses to assemble and the chunk is only acknowledged.
+	addUpload(t, st, "miss", "u", 2)
 
 	req := mpReq1(t, map[string]string{
 		"userId": "u", "fileName": "x", "fileType": "application/octet-stream",
@@ -442,20 +568,45 @@ func TestUploadHandler_LastChunk_MergeMissingChunk(t *testing.T) {
 	}, true, []byte("LAST"))
 
 	rr := httptest.NewRecorder()
-	fh.UploadHandler(rr, req)
+	srv.UploadHandler(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var out map[string]string
+	_ = json.Unmarshal(rr.Body.Bytes(), &out)
+	assert.Equal(t, "Chunk 1 uploaded", out["message"])
+	assert.Equal(t, []string{"temp"}, stub.mkdirs, "final file must not be created before every chunk arrives")
+	assert.Equal(t, fh.UploadStatusUploading, uploadStatus(t, st, "miss"))
 }
 
-func TestUploadHandler_LastChunk_DBUpdateError_StillOK(t *testing.T) {
-	mock, cleanup := SetupMockDB(t)
-	defer cleanup()
+func TestUploadHandler_LastChunk_DBUpdateError_KeepsChunks(t *testing.T) {
+	stub := newWebdavStub()
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
+	addUpload(t, st, "ok-1", "u", 2, "A")
+	srv.SetStore(fileBlobWritesFail{st})
+
+	stub.readMap["temp/ok-1_chunk_0"] = "A"
+
+	req := mpReq1(t, map[string]string{
+		"userId": "u", "fileName": "x", "fileType": "application/octet-stream",
+		"fileHash": "h", "nonce": "n", "chunkIndex": "1", "totalChunks": "2",
+		"fileId": "ok-1",
+	}, true, []byte("BC"))
 
-	mock.ExpectExec(`UPDATE files SET file_hash=\$1, file_size=\$2, cid=\$3 WHERE id=\$4`).
-		WithArgs(sqlmock.AnyArg(), int64(3), sqlmock.AnyArg(), "ok-1").
-		WillReturnError(sql.ErrConnDone)
+	rr := httptest.NewRecorder()
+	srv.UploadHandler(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code, rr.Body.String())
+	assert.Empty(t, stub.removals, "chunks are kept for a retry")
+	// the claim is released so the last chunk can be sent again
+	assert.Equal(t, fh.UploadStatusUploading, uploadStatus(t, st, "ok-1"))
+}
 
+func TestUploadHandler_LastChunk_CompleteError_KeepsChunks(t *testing.T) {
 	stub := newWebdavStub()
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
+	addUpload(t, st, "ok-1", "u", 2, "A")
+	srv.SetStore(completeFails{st})
+
 	stub.readMap["temp/ok-1_chunk_0"] = "A"
-	defer setOC(t, stub)()
 
 	req := mpReq1(t, map[string]string{
 		"userId": "u", "fileName": "x", "fileType": "application/octet-stream",
@@ -464,11 +615,12 @@ func TestUploadHandler_LastChunk_DBUpdateError_StillOK(t *testing.T) {
 	}, true, []byte("BC"))
 
 	rr := httptest.NewRecorder()
-	fh.UploadHandler(rr, req)
-	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	srv.UploadHandler(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code, rr.Body.String())
+	assert.Empty(t, stub.removals)
 
-	var out map[string]string
-	_ = json.Unmarshal(rr.Body.Bytes(), &out)
-	assert.Equal(t, "File uploaded and metadata stored", out["message"])
-	assert.Equal(t, "ok-1", out["fileId"])
+	f, err := st.File(context.Background(), "ok-1")
+	require.NoError(t, err)
+	assert.Equal(t, sha256Hex("ABC"), f.FileHash)
+	assert.Equal(t, fh.UploadStatusUploading, uploadStatus(t, st, "ok-1"))
 }
@@ -0,0 +1,167 @@
+package unitTests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	fh "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/storage"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+)
+
+func chunkFields(fileID, userID, index, total string) map[string]string {
+	return map[string]string{
+		"userId": userID, "fileName": "x", "fileType": "application/octet-stream",
+		"fileHash": "h", "nonce": "n", "chunkIndex": index, "totalChunks": total,
+		"fileId": fileID,
+	}
+}
+
+func TestUploadHandler_SessionNotFound(t *testing.T) {
+	srv, _, _ := newMemoryServer(t)
+
+	rr := httptest.NewRecorder()
+	srv.UploadHandler(rr, mpReq1(t, chunkFields("nope", "u", "0", "2"), true, []byte("A")))
+
+	require.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestUploadHandler_SessionOwnedByAnotherUser(t *testing.T) {
+	srv, st, _ := newMemoryServer(t)
+	addUpload(t, st, "f1", "owner", 2)
+
+	rr := httptest.NewRecorder()
+	srv.UploadHandler(rr, mpReq1(t, chunkFields("f1", "intruder", "0", "2"), true, []byte("A")))
+
+	require.Equal(t, http.StatusForbidden, rr.Code)
+	chunks, err := st.ListUploadChunks(context.Background(), "f1")
+	require.NoError(t, err)
+	assert.Empty(t, chunks)
+}
+
+func TestUploadHandler_TotalChunksMismatch(t *testing.T) {
+	srv, st, _ := newMemoryServer(t)
+	addUpload(t, st, "f1", "u", 3)
+
+	rr := httptest.NewRecorder()
+	srv.UploadHandler(rr, mpReq1(t, chunkFields("f1", "u", "0", "2"), true, []byte("A")))
+
+	require.Equal(t, http.StatusConflict, rr.Code)
+}
+
+func TestUploadHandler_ChunkIndexOutOfRange(t *testing.T) {
+	srv, st, _ := newMemoryServer(t)
+	addUpload(t, st, "f1", "u", 2)
+
+	rr := httptest.NewRecorder()
+	srv.UploadHandler(rr, mpReq1(t, chunkFields("f1", "u", "5", "2"), true, []byte("A")))
+
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestUploadHandler_CompletedSessionRejectsChunks(t *testing.T) {
+	srv, st, _ := newMemoryServer(t)
+	addUpload(t, st, "f1", "u", 2)
+	require.NoError(t, st.SetUploadStatus(context.Background(), "f1", fh.UploadStatusComplete))
+
+	rr := httptest.NewRecorder()
+	srv.UploadHandler(rr, mpReq1(t, chunkFields("f1", "u", "1", "2"), true, []byte("A")))
+
+	require.Equal(t, http.StatusConflict, rr.Code)
+}
+
+func TestUploadHandler_RecordsTotalChunksOnFirstChunk(t *testing.T) {
+	srv, st, _ := newMemoryServer(t)
+	addUpload(t, st, "f1", "u", 0)
+
+	rr := httptest.NewRecorder()
+	srv.UploadHandler(rr, mpReq1(t, chunkFields("f1", "u", "0", "3"), true, []byte("A")))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	u, err := st.UploadSession(context.Background(), "f1")
+	require.NoError(t, err)
+	assert.Equal(t, 3, u.TotalChunks)
+	assert.Equal(t, fh.UploadStatusUploading, u.Status)
+}
+
+func TestUploadHandler_ChunkHashMismatch(t *testing.T) {
+	srv, st, _ := newMemoryServer(t)
+	addUpload(t, st, "f1", "u", 2)
+
+	fields := chunkFields("f1", "u", "0", "2")
+	fields["chunkHash"] = "not-the-real-hash"
+
+	rr := httptest.NewRecorder()
+	srv.UploadHandler(rr, mpReq1(t, fields, true, []byte("A")))
+
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Chunk hash mismatch")
+	chunks, err := st.ListUploadChunks(context.Background(), "f1")
+	require.NoError(t, err)
+	assert.Empty(t, chunks)
+}
+
+func TestUploadHandler_StoredChunkFailsVerification(t *testing.T) {
+	stub := newWebdavStub()
+	srv, st := newMemoryServerOn(t, storage.NewWebDAVFromClient(stub), fh.Config{})
+
+	// The recorded hash describes different bytes than the stored chunk.
+	addUpload(t, st, "f1", "u", 2, "something else")
+	stub.readMap["temp/f1_chunk_0"] = "A"
+
+	rr := httptest.NewRecorder()
+	srv.UploadHandler(rr, mpReq1(t, chunkFields("f1", "u", "1", "2"), true, []byte("A")))
+
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	// the damaged chunk is forgotten so it can be sent again
+	chunks, err := st.ListUploadChunks(context.Background(), "f1")
+	require.NoError(t, err)
+	require.Len(t, chunks, 1)
+	assert.Equal(t, 1, chunks[0].Index)
+	assert.Equal(t, fh.UploadStatusUploading, uploadStatus(t, st, "f1"))
+}
+
+func TestUploadStatusHandler_ReportsMissingChunks(t *testing.T) {
+	ctx := context.Background()
+	srv, st, _ := newMemoryServer(t)
+	addUpload(t, st, "f1", "u", 4)
+	for _, c := range []store.UploadChunk{{Index: 0, Size: 10, Hash: "h0"}, {Index: 2, Size: 10, Hash: "h2"}} {
+		require.NoError(t, st.RecordUploadChunk(ctx, "f1", c))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/uploadStatus?fileId=f1&userId=u", nil)
+	rr := httptest.NewRecorder()
+	srv.UploadStatusHandler(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp fh.UploadStatusResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, 4, resp.TotalChunks)
+	assert.Equal(t, []int{1, 3}, resp.MissingChunks)
+	assert.Len(t, resp.ReceivedChunks, 2)
+	assert.Equal(t, "h2", resp.ReceivedChunks[1].Hash)
+	assert.False(t, resp.Complete)
+}
+
+func TestUploadStatusHandler_Errors(t *testing.T) {
+	srv, st, _ := newMemoryServer(t)
+	addUpload(t, st, "f1", "owner", 2)
+
+	rr := httptest.NewRecorder()
+	srv.UploadStatusHandler(rr, httptest.NewRequest(http.MethodGet, "/uploadStatus?fileId=f1", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = httptest.NewRecorder()
+	srv.UploadStatusHandler(rr, httptest.NewRequest(http.MethodGet, "/uploadStatus?fileId=gone&userId=u", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	srv.UploadStatusHandler(rr, httptest.NewRequest(http.MethodGet, "/uploadStatus?fileId=f1&userId=other", nil))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
@@ -0,0 +1,14 @@
+package api
+
+import (
+	"context"
+	"net/http"
+)
+
+// Detach returns the request's context without its cancellation, for the
+// SQL and storage calls a handler makes. They keep the request's trace and
+// user but run to completion if the client goes away, so a disconnect
+// cannot leave a multi-step change half done.
+func Detach(r *http.Request) context.Context {
+	return context.WithoutCancel(r.Context())
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CORS headers sent to allowed origins. Bearer tokens rather than cookies
+// carry the user, so credentials are never allowed.
+const (
+	corsAllowMethods  = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	corsAllowHeaders  = "Authorization, Content-Type, Range, If-Range, If-None-Match, X-Request-ID"
+	corsExposeHeaders = "Content-Range, Accept-Ranges, ETag, X-Request-ID"
+	corsMaxAge        = "600"
+)
+
+// CORS lets browsers on the given origins call next. An origin of "*"
+// allows any. Preflight requests from allowed origins are answered here,
+// before authentication, since browsers send them without a token. With no
+// origins, next is returned unchanged and no CORS headers are sent.
+func CORS(next http.Handler, origins []string) http.Handler {
+	if len(origins) == 0 {
+		return next
+	}
+	allowed := make(map[string]bool, len(origins))
+	anyOrigin := false
+	for _, o := range origins {
+		if o == "*" {
+			anyOrigin = true
+		}
+		allowed[strings.TrimSuffix(o, "/")] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		if !anyOrigin && !allowed[origin] {
+			// no CORS headers: the browser blocks the response
+			next.ServeHTTP(w, r)
+			return
+		}
+		if anyOrigin {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", corsAllowMethods)
+			h.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+			h.Set("Access-Control-Max-Age", corsMaxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.Add("Access-Control-Expose-Headers", corsExposeHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
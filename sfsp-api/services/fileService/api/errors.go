@@ -0,0 +1,88 @@
+// Package api holds the pieces shared by every HTTP handler: the JSON error
+// envelope and the versioned router.
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// Machine-readable error codes sent in the "code" field of the envelope.
+const (
+	CodeBadRequest          = "bad_request"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeNotFound            = "not_found"
+	CodeMethodNotAllowed    = "method_not_allowed"
+	CodeConflict            = "conflict"
+	CodePayloadTooLarge     = "payload_too_large"
+	CodeRangeNotSatisfiable = "range_not_satisfiable"
+	CodeInternal            = "internal_error"
+	CodeUnavailable         = "unavailable"
+	CodeIntegrityFailed     = "integrity_failed"
+	CodeQuotaExceeded       = "quota_exceeded"
+)
+
+// ErrorResponse is the body of every error response:
+//
+//	{"success": false, "code": "not_found", "error": "File not found"}
+//
+// "success" and "error" keep the shape the notification endpoints always
+// used, so existing clients continue to work.
+type ErrorResponse struct {
+	Success bool   `json:"success"`
+	Code    string `json:"code"`
+	Error   string `json:"error"`
+}
+
+// CodeForStatus returns the default error code for an HTTP status.
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case http.StatusRequestedRangeNotSatisfiable:
+		return CodeRangeNotSatisfiable
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// Error replies with the JSON error envelope. It takes the same arguments as
+// http.Error and derives the code from the status.
+func Error(w http.ResponseWriter, message string, status int) {
+	ErrorCode(w, message, status, CodeForStatus(status))
+}
+
+// ErrorCode replies with the JSON error envelope using a specific code.
+func ErrorCode(w http.ResponseWriter, message string, status int, code string) {
+	h := w.Header()
+	// headers meant for a successful body must not leak into the error
+	h.Del("Content-Length")
+	h.Del("Content-Disposition")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(ErrorResponse{Success: false, Code: code, Error: message}); err != nil {
+		slog.Warn("Failed to encode error response", "err", err)
+	}
+}
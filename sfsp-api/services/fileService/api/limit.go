@@ -0,0 +1,21 @@
+package api
+
+import "net/http"
+
+// LimitBody caps request bodies at max bytes; a max of zero or less leaves
+// them unlimited. Requests that declare a larger Content-Length are turned
+// away with 413 before the handler runs. Other bodies are cut off at max,
+// so the handler's read fails with an *http.MaxBytesError.
+func LimitBody(next http.Handler, max int64) http.Handler {
+	if max <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > max {
+			Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+		next.ServeHTTP(w, r)
+	})
+}
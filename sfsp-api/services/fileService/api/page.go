@@ -0,0 +1,222 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Page sizes used when a listing request gives no limit, and the most a
+// client may ask for.
+const (
+	DefaultPageLimit = 100
+	MaxPageLimit     = 500
+)
+
+// NextCursorHeader carries the cursor of the next page. It is absent on the
+// last page.
+const NextCursorHeader = "X-Next-Cursor"
+
+// PageRequest holds the paging fields of a listing request. Handlers embed it
+// in their JSON body; fields left empty fall back to the query parameters of
+// the same name, so GET endpoints take them from the URL.
+type PageRequest struct {
+	Limit  int    `json:"limit,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+	Sort   string `json:"sort,omitempty"`
+	Order  string `json:"order,omitempty"`
+}
+
+// Listing describes how an endpoint may be ordered. Sorts maps the sort names
+// clients use to SQL expressions; ID is the unique column that breaks ties so
+// the order is total and a cursor always points at exactly one row. Sort
+// expressions must not be NULL.
+type Listing struct {
+	Sorts        map[string]string
+	ID           string
+	DefaultSort  string
+	DefaultOrder string
+}
+
+// cursor is the decoded form of an opaque page cursor: the sort it was
+// issued for and the key of the last row returned.
+type cursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Key   string `json:"k"`
+	ID    string `json:"i"`
+}
+
+// Page is a validated paging request for one Listing. Build the query with
+// SortKey and Apply, pass each scanned row to Keep, then call Finish.
+type Page struct {
+	Limit int
+	Sort  string
+	Order string
+
+	expr  string
+	id    string
+	after *cursor
+
+	kept int
+	last cursor
+	more bool
+}
+
+// Page validates req against the listing, filling empty fields from the query
+// string and then from the defaults. The error is meant for a 400 response.
+func (l Listing) Page(r *http.Request, req PageRequest) (*Page, error) {
+	q := r.URL.Query()
+	if req.Cursor == "" {
+		req.Cursor = q.Get("cursor")
+	}
+	if req.Sort == "" {
+		req.Sort = q.Get("sort")
+	}
+	if req.Order == "" {
+		req.Order = q.Get("order")
+	}
+	if req.Limit == 0 && q.Get("limit") != "" {
+		n, err := strconv.Atoi(q.Get("limit"))
+		if err != nil {
+			return nil, errors.New("limit must be a number")
+		}
+		req.Limit = n
+	}
+
+	var after *cursor
+	if req.Cursor != "" {
+		c, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if (req.Sort != "" && req.Sort != c.Sort) || (req.Order != "" && req.Order != c.Order) {
+			return nil, errors.New("cursor was issued for a different sort order")
+		}
+		req.Sort, req.Order = c.Sort, c.Order
+		after = &c
+	}
+
+	if req.Sort == "" {
+		req.Sort = l.DefaultSort
+	}
+	expr, ok := l.Sorts[req.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort %q", req.Sort)
+	}
+
+	req.Order = strings.ToLower(req.Order)
+	if req.Order == "" {
+		req.Order = l.DefaultOrder
+	}
+	if req.Order != "asc" && req.Order != "desc" {
+		return nil, errors.New("order must be asc or desc")
+	}
+
+	switch {
+	case req.Limit < 0:
+		return nil, errors.New("limit must not be negative")
+	case req.Limit == 0:
+		req.Limit = DefaultPageLimit
+	case req.Limit > MaxPageLimit:
+		req.Limit = MaxPageLimit
+	}
+
+	return &Page{
+		Limit: req.Limit,
+		Sort:  req.Sort,
+		Order: req.Order,
+		expr:  expr,
+		id:    l.ID,
+		after: after,
+	}, nil
+}
+
+// SortKey is the select-list expression for the row's sort key as text. Scan
+// it and hand it to Keep along with the row's id.
+func (p *Page) SortKey() string {
+	return "(" + p.expr + ")::text"
+}
+
+// SortName is the sort the page was validated for, one of the listing's
+// Sorts keys. Listings that are not built with Apply order by it.
+func (p *Page) SortName() string {
+	return p.Sort
+}
+
+// Descending reports whether the page is ordered newest or largest first.
+func (p *Page) Descending() bool {
+	return p.Order == "desc"
+}
+
+// Apply completes query, which must end inside its WHERE clause, with the
+// keyset condition, ORDER BY and LIMIT, and returns the full argument list.
+// One row more than the limit is fetched to learn whether another page exists.
+func (p *Page) Apply(query string, args ...any) (string, []any) {
+	dir, cmp := "DESC", "<"
+	if p.Order == "asc" {
+		dir, cmp = "ASC", ">"
+	}
+
+	var b strings.Builder
+	b.WriteString(query)
+	if p.after != nil {
+		fmt.Fprintf(&b, " AND (%s, %s::text) %s ($%d, $%d)", p.expr, p.id, cmp, len(args)+1, len(args)+2)
+		args = append(args, p.after.Key, p.after.ID)
+	}
+	fmt.Fprintf(&b, " ORDER BY %s %s, %s::text %s LIMIT $%d", p.expr, dir, p.id, dir, len(args)+1)
+	args = append(args, p.Limit+1)
+	return b.String(), args
+}
+
+// After returns the sort key and id of the last row of the previous page, for
+// listings that are not built with Apply. ok is false on the first page.
+func (p *Page) After() (key, id string, ok bool) {
+	if p.after == nil {
+		return "", "", false
+	}
+	return p.after.Key, p.after.ID, true
+}
+
+// Keep records a returned row. It reports false for the extra row past the
+// limit, which the caller drops before ending the scan.
+func (p *Page) Keep(key, id string) bool {
+	if p.kept == p.Limit {
+		p.more = true
+		return false
+	}
+	p.kept++
+	p.last = cursor{Sort: p.Sort, Order: p.Order, Key: key, ID: id}
+	return true
+}
+
+// Next returns the cursor of the following page, or "" on the last page.
+func (p *Page) Next() string {
+	if !p.more {
+		return ""
+	}
+	raw, _ := json.Marshal(p.last)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// Finish sets the next-cursor header. Call it before writing the body.
+func (p *Page) Finish(w http.ResponseWriter) {
+	h := w.Header()
+	h.Add("Access-Control-Expose-Headers", NextCursorHeader)
+	if next := p.Next(); next != "" {
+		h.Set(NextCursorHeader, next)
+	}
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(raw, &c) != nil || c.Sort == "" || c.ID == "" {
+		return cursor{}, errors.New("invalid cursor")
+	}
+	return c, nil
+}
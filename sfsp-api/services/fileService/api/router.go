@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Version1 is the path prefix of the versioned API.
+const Version1 = "/api/v1"
+
+// Router dispatches requests under a path prefix by method and path
+// pattern. Patterns use net/http syntax, so "/files/{id}" binds r.PathValue("id").
+// Unknown paths and disallowed methods are answered with the JSON error
+// envelope; a 405 also lists the allowed methods in the Allow header.
+type Router struct {
+	prefix string
+	mux    *http.ServeMux
+}
+
+// NewRouter returns a Router serving paths below prefix.
+func NewRouter(prefix string) *Router {
+	return &Router{prefix: strings.TrimSuffix(prefix, "/"), mux: http.NewServeMux()}
+}
+
+// Prefix returns the path prefix the router serves.
+func (rt *Router) Prefix() string {
+	return rt.prefix
+}
+
+// Handle registers h for method requests to path (relative to the prefix).
+func (rt *Router) Handle(method, path string, h http.Handler) {
+	rt.mux.Handle(method+" "+rt.prefix+path, h)
+}
+
+// HandleFunc registers h for method requests to path (relative to the prefix).
+func (rt *Router) HandleFunc(method, path string, h http.HandlerFunc) {
+	rt.Handle(method, path, h)
+}
+
+// Pattern returns the route serving r, without its method, e.g.
+// "/api/v1/files/{id}". It is "" when no route matches.
+func (rt *Router) Pattern(r *http.Request) string {
+	_, pattern := rt.mux.Handler(r)
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		return path
+	}
+	return pattern
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h, pattern := rt.mux.Handler(r)
+	if pattern != "" {
+		rt.mux.ServeHTTP(w, r)
+		return
+	}
+
+	// Let the mux decide between 404 and 405 (and compute Allow), then send
+	// the envelope instead of its plain-text body.
+	probe := &statusProbe{header: http.Header{}}
+	h.ServeHTTP(probe, r)
+	if probe.status == http.StatusMethodNotAllowed {
+		w.Header().Set("Allow", probe.header.Get("Allow"))
+		Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	Error(w, "Endpoint not found", http.StatusNotFound)
+}
+
+// statusProbe records the status and headers a handler writes and discards
+// the body.
+type statusProbe struct {
+	header http.Header
+	status int
+}
+
+func (p *statusProbe) Header() http.Header { return p.header }
+
+func (p *statusProbe) WriteHeader(status int) {
+	if p.status == 0 {
+		p.status = status
+	}
+}
+
+func (p *statusProbe) Write(b []byte) (int, error) {
+	p.WriteHeader(http.StatusOK)
+	return len(b), nil
+}
+
+// Params maps path parameter names to the request field a handler reads
+// them from, e.g. Params{"id": "fileId"}.
+type Params map[string]string
+
+// WithQuery adapts a handler that reads its input from the query string or
+// a form: the path parameters are added to the query, where r.FormValue
+// finds them ahead of any value in the body.
+func WithQuery(params Params, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		for param, field := range params {
+			q.Set(field, r.PathValue(param))
+		}
+		r2 := r.Clone(r.Context())
+		r2.URL.RawQuery = q.Encode()
+		h(w, r2)
+	}
+}
+
+// WithJSON adapts a handler that decodes a JSON object from the body: the
+// path parameters are written into that object, overriding the same fields
+// in the body. A request without a body (such as a GET) is treated as {}.
+func WithJSON(params Params, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fields := map[string]json.RawMessage{}
+		raw, err := io.ReadAll(r.Body)
+		if err != nil {
+			Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		if len(bytes.TrimSpace(raw)) > 0 {
+			if err := json.Unmarshal(raw, &fields); err != nil {
+				Error(w, "Invalid JSON payload", http.StatusBadRequest)
+				return
+			}
+		}
+		for param, field := range params {
+			value, _ := json.Marshal(r.PathValue(param))
+			fields[field] = value
+		}
+
+		body, _ := json.Marshal(fields)
+		r2 := r.Clone(r.Context())
+		r2.Body = io.NopCloser(bytes.NewReader(body))
+		r2.ContentLength = int64(len(body))
+		r2.Header.Set("Content-Type", "application/json")
+		h(w, r2)
+	}
+}
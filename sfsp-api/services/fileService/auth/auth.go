@@ -0,0 +1,269 @@
+// Package auth verifies the signed tokens issued by the API gateway and
+// carries the authenticated user through the request context.
+package auth
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Config selects how tokens are verified. Secret verifies HMAC-signed tokens
+// (the gateway signs with HS256 today); PublicKeyPEM verifies RSA, ECDSA or
+// Ed25519 signatures. At least one of them must be set.
+type Config struct {
+	Secret       []byte
+	PublicKeyPEM []byte
+	// Issuer and Audience are checked against the "iss" and "aud" claims
+	// when set.
+	Issuer   string
+	Audience string
+	// PublicPaths are served without a token (health checks and the like).
+	PublicPaths []string
+	// PublicPrefixes are path prefixes served without a token, for routes
+	// with parameters in the path.
+	PublicPrefixes []string
+}
+
+// User is the identity proven by a verified token.
+type User struct {
+	ID string
+	// Role is the gateway's "role" claim; administrators carry RoleAdmin.
+	Role string
+}
+
+// RoleAdmin is the role the gateway gives administrator tokens.
+const RoleAdmin = "admin"
+
+// IsAdmin reports whether the user is an administrator.
+func (u User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+var (
+	ErrNoVerificationKey = errors.New("auth: no token verification key configured")
+	ErrMissingToken      = errors.New("auth: missing bearer token")
+	ErrInvalidToken      = errors.New("auth: invalid token")
+)
+
+// Verifier validates bearer tokens.
+type Verifier struct {
+	secret    []byte
+	publicKey crypto.PublicKey
+	methods   []string
+	opts      []jwt.ParserOption
+	public    map[string]bool
+	prefixes  []string
+}
+
+// NewVerifier builds a Verifier from cfg.
+func NewVerifier(cfg Config) (*Verifier, error) {
+	v := &Verifier{secret: cfg.Secret, public: map[string]bool{}, prefixes: cfg.PublicPrefixes}
+
+	if len(cfg.PublicKeyPEM) > 0 {
+		key, methods, err := parsePublicKey(cfg.PublicKeyPEM)
+		if err != nil {
+			return nil, err
+		}
+		v.publicKey = key
+		v.methods = append(v.methods, methods...)
+	}
+	if len(cfg.Secret) > 0 {
+		v.methods = append(v.methods, "HS256", "HS384", "HS512")
+	}
+	if len(v.methods) == 0 {
+		return nil, ErrNoVerificationKey
+	}
+
+	v.opts = []jwt.ParserOption{jwt.WithValidMethods(v.methods), jwt.WithExpirationRequired()}
+	if cfg.Issuer != "" {
+		v.opts = append(v.opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		v.opts = append(v.opts, jwt.WithAudience(cfg.Audience))
+	}
+	for _, p := range cfg.PublicPaths {
+		v.public[p] = true
+	}
+	return v, nil
+}
+
+func parsePublicKey(pem []byte) (crypto.PublicKey, []string, error) {
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(pem); err == nil {
+		return key, []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512"}, nil
+	}
+	if key, err := jwt.ParseECPublicKeyFromPEM(pem); err == nil {
+		return key, []string{"ES256", "ES384", "ES512"}, nil
+	}
+	if key, err := jwt.ParseEdPublicKeyFromPEM(pem); err == nil {
+		return key, []string{"EdDSA"}, nil
+	}
+	return nil, nil, errors.New("auth: unsupported or malformed public key")
+}
+
+func (v *Verifier) keyFunc(t *jwt.Token) (interface{}, error) {
+	if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+		return v.secret, nil
+	}
+	if v.publicKey == nil {
+		return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+	}
+	return v.publicKey, nil
+}
+
+// Verify checks the token's signature and standard claims and returns the
+// user it was issued for. The user ID is read from the "userId" claim the
+// gateway sets, falling back to "sub".
+func (v *Verifier) Verify(tokenString string) (User, error) {
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(tokenString, claims, v.keyFunc, v.opts...); err != nil {
+		return User{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	id, _ := claims["userId"].(string)
+	if id == "" {
+		id, _ = claims["sub"].(string)
+	}
+	if id == "" {
+		return User{}, fmt.Errorf("%w: no user claim", ErrInvalidToken)
+	}
+	role, _ := claims["role"].(string)
+	return User{ID: id, Role: role}, nil
+}
+
+func bearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", ErrMissingToken
+	}
+	return strings.TrimSpace(token), nil
+}
+
+func (v *Verifier) isPublic(path string) bool {
+	if v.public[path] {
+		return true
+	}
+	for _, p := range v.prefixes {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware rejects requests without a valid bearer token with 401 and
+// stores the authenticated user in the request context for the handlers.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v.isPublic(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, err := bearerToken(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			api.Error(w, "Missing bearer token", http.StatusUnauthorized)
+			return
+		}
+		user, err := v.Verify(token)
+		if err != nil {
+			logging.FromContext(r.Context()).Warn("Rejected token", "err", err)
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			api.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := logging.With(WithUser(r.Context(), user), "user_id", user.ID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+type contextKey struct{}
+
+// WithUser returns a copy of ctx carrying user.
+func WithUser(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// UserFromContext returns the authenticated user, if any.
+func UserFromContext(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(contextKey{}).(User)
+	return user, ok && user.ID != ""
+}
+
+// ResolveUserID returns the user a request acts as. Behind Middleware that is
+// always the authenticated user, and a client-supplied ID that names someone
+// else is answered with 403. Requests that never passed through Middleware
+// (auth disabled, or a handler invoked directly) keep the client-supplied ID.
+// The caller must return when ok is false.
+func ResolveUserID(w http.ResponseWriter, r *http.Request, claimed string) (userID string, ok bool) {
+	user, authenticated := UserFromContext(r.Context())
+	if !authenticated {
+		return claimed, true
+	}
+	if claimed != "" && claimed != user.ID {
+		api.Error(w, "Forbidden: request is not for the authenticated user", http.StatusForbidden)
+		return "", false
+	}
+	return user.ID, true
+}
+
+// RequireOwner answers 403 unless the authenticated user is ownerID.
+// Unauthenticated requests are not checked, as with ResolveUserID. The caller
+// must return when it reports false.
+func RequireOwner(w http.ResponseWriter, r *http.Request, ownerID string) bool {
+	user, authenticated := UserFromContext(r.Context())
+	if !authenticated || user.ID == ownerID {
+		return true
+	}
+	api.Error(w, "Forbidden: you do not own this file", http.StatusForbidden)
+	return false
+}
+
+// FileOwners looks up who owns a file; store.Store is one.
+type FileOwners interface {
+	FileOwner(ctx context.Context, fileID string) (string, error)
+}
+
+// RequireFileOwner answers 403 unless the authenticated user owns fileID, or
+// 404 when files has no such file. Unauthenticated requests are not checked,
+// as with ResolveUserID. The caller must return when it reports false.
+func RequireFileOwner(w http.ResponseWriter, r *http.Request, files FileOwners, fileID string) bool {
+	if _, ok := UserFromContext(r.Context()); !ok {
+		return true
+	}
+	ctx := api.Detach(r)
+	ownerID, err := files.FileOwner(ctx, fileID)
+	if errors.Is(err, store.ErrNotFound) {
+		api.Error(w, "File not found", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to look up file owner", "err", err)
+		api.Error(w, "Database error", http.StatusInternalServerError)
+		return false
+	}
+	return RequireOwner(w, r, ownerID)
+}
+
+// RequireAdmin answers 403 unless the authenticated user is an administrator.
+// Unauthenticated requests are not checked, as with ResolveUserID. The caller
+// must return when it reports false.
+func RequireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	user, authenticated := UserFromContext(r.Context())
+	if !authenticated || user.IsAdmin() {
+		return true
+	}
+	api.Error(w, "Forbidden: administrators only", http.StatusForbidden)
+	return false
+}
@@ -0,0 +1,216 @@
+// Package config loads the settings of the file service. Each setting has a
+// default, can be set in an optional YAML or JSON file, is overridden by an
+// environment variable and, for a few, by a command line flag. The loaded
+// Config is validated as a whole, so startup reports every mistake at once.
+package config
+
+import (
+	"time"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/storage"
+)
+
+// Config is every setting of the file service. The yaml tag is the key in
+// the config file, env the environment variable and flag the command line
+// flag, if any.
+type Config struct {
+	Server    Server    `yaml:"server"`
+	Database  Database  `yaml:"database"`
+	Storage   Storage   `yaml:"storage"`
+	Auth      Auth      `yaml:"auth"`
+	Uploads   Uploads   `yaml:"uploads"`
+	Shares    Shares    `yaml:"shares"`
+	Janitor   Janitor   `yaml:"janitor"`
+	Downloads Downloads `yaml:"downloads"`
+	CORS      CORS      `yaml:"cors"`
+	Logging   Logging   `yaml:"logging"`
+	Tracing   Tracing   `yaml:"tracing"`
+	Health    Health    `yaml:"health"`
+}
+
+// Server configures the HTTP server.
+type Server struct {
+	Addr string `yaml:"addr" env:"HTTP_ADDR" flag:"addr"`
+	// ReadHeaderTimeout and ReadTimeout bound reading a request's headers
+	// and the whole request. WriteTimeout bounds the response and is off by
+	// default, since downloads stream whole files.
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" env:"HTTP_MAX_HEADER_BYTES"`
+	// MaxBodyBytes caps request bodies; zero leaves them unlimited.
+	MaxBodyBytes int64 `yaml:"max_body_bytes" env:"HTTP_MAX_BODY_BYTES"`
+	// TLSCertFile and TLSKeyFile switch the server to HTTPS when both set.
+	TLSCertFile string `yaml:"tls_cert_file" env:"TLS_CERT_FILE"`
+	TLSKeyFile  string `yaml:"tls_key_file" env:"TLS_KEY_FILE"`
+	// ShutdownTimeout is how long in-flight requests may run after
+	// SIGTERM before their connections are closed.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+}
+
+// Database configures the PostgreSQL connection pool.
+type Database struct {
+	URI string `yaml:"uri" env:"POSTGRES_URI"`
+	// MaxOpenConns and MaxIdleConns size the pool; zero open connections
+	// means no limit.
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+	// Migrate applies pending schema migrations at startup.
+	Migrate bool `yaml:"migrate" env:"DB_MIGRATE"`
+}
+
+// Storage selects and configures the blob store.
+type Storage struct {
+	// Backend is "webdav" (also "owncloud"), "local" or "s3".
+	Backend string `yaml:"backend" env:"STORAGE_BACKEND" flag:"storage"`
+	WebDAV  WebDAV `yaml:"webdav"`
+	Local   Local  `yaml:"local"`
+	S3      S3     `yaml:"s3"`
+}
+
+// WebDAV configures the ownCloud WebDAV backend.
+type WebDAV struct {
+	URL      string `yaml:"url" env:"OWNCLOUD_URL"`
+	Username string `yaml:"username" env:"OWNCLOUD_USERNAME"`
+	Password string `yaml:"password" env:"OWNCLOUD_PASSWORD"`
+}
+
+// Local configures the local filesystem backend.
+type Local struct {
+	Root string `yaml:"root" env:"LOCAL_STORAGE_ROOT"`
+}
+
+// S3 configures the S3-compatible backend.
+type S3 struct {
+	Endpoint  string `yaml:"endpoint" env:"S3_ENDPOINT"`
+	Region    string `yaml:"region" env:"S3_REGION"`
+	Bucket    string `yaml:"bucket" env:"S3_BUCKET"`
+	AccessKey string `yaml:"access_key" env:"S3_ACCESS_KEY"`
+	SecretKey string `yaml:"secret_key" env:"S3_SECRET_KEY"`
+	UseSSL    bool   `yaml:"use_ssl" env:"S3_USE_SSL"`
+	Prefix    string `yaml:"prefix" env:"S3_PREFIX"`
+	// PartSize is the multipart upload part size in bytes; zero keeps the
+	// driver's default.
+	PartSize uint64 `yaml:"part_size" env:"S3_PART_SIZE"`
+}
+
+// Auth configures bearer token verification.
+type Auth struct {
+	Disabled bool `yaml:"disabled" env:"AUTH_DISABLED"`
+	// JWTSecret is shared with the API gateway; JWTPublicKeyFile holds a PEM
+	// public key for asymmetric tokens. At least one is needed.
+	JWTSecret        string `yaml:"jwt_secret" env:"JWT_SECRET"`
+	JWTPublicKeyFile string `yaml:"jwt_public_key_file" env:"JWT_PUBLIC_KEY_FILE"`
+	Issuer           string `yaml:"issuer" env:"JWT_ISSUER"`
+	Audience         string `yaml:"audience" env:"JWT_AUDIENCE"`
+}
+
+// Uploads bounds chunked transfers: uploads, sends, view-only shares and
+// share links.
+type Uploads struct {
+	// MaxChunks and MaxChunkSize are per transfer; zero means no limit.
+	MaxChunks    int   `yaml:"max_chunks" env:"UPLOAD_MAX_CHUNKS"`
+	MaxChunkSize int64 `yaml:"max_chunk_size" env:"UPLOAD_MAX_CHUNK_SIZE"`
+	// MultipartMemory is how many bytes of a multipart form are kept in
+	// memory before the rest spills to temporary files.
+	MultipartMemory int64 `yaml:"multipart_memory" env:"UPLOAD_MULTIPART_MEMORY"`
+}
+
+// Shares limits the expiry senders may choose.
+type Shares struct {
+	DefaultExpiry time.Duration `yaml:"default_expiry" env:"SHARE_DEFAULT_EXPIRY"`
+	// MaxExpiry of zero removes the limit.
+	MaxExpiry  time.Duration `yaml:"max_expiry" env:"SHARE_MAX_EXPIRY"`
+	AllowNever bool          `yaml:"allow_never" env:"SHARE_ALLOW_NEVER"`
+}
+
+// Janitor configures the background cleanup of abandoned uploads, the trash
+// and expired shares.
+type Janitor struct {
+	Enabled        bool          `yaml:"enabled" env:"JANITOR_ENABLED"`
+	TTL            time.Duration `yaml:"ttl" env:"JANITOR_TTL"`
+	Interval       time.Duration `yaml:"interval" env:"JANITOR_INTERVAL"`
+	TrashRetention time.Duration `yaml:"trash_retention" env:"TRASH_RETENTION"`
+}
+
+// Downloads configures download verification.
+type Downloads struct {
+	// VerifyMode is "trailer" or "pre".
+	VerifyMode string `yaml:"verify_mode" env:"DOWNLOAD_VERIFY_MODE"`
+}
+
+// CORS lists the browser origins allowed to call the service directly.
+type CORS struct {
+	// AllowedOrigins are origins such as "https://app.example.com", or "*"
+	// for any. Empty sends no CORS headers, for deployments behind the
+	// gateway.
+	AllowedOrigins []string `yaml:"allowed_origins" env:"CORS_ORIGINS"`
+}
+
+// Logging configures the structured logger.
+type Logging struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL" flag:"log-level"`
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+}
+
+// Tracing configures the OpenTelemetry exporter. The OTLP endpoint, sampler
+// and service name keep their standard OTEL_* variables.
+type Tracing struct {
+	// Exporter is "otlp", "stdout", "file" or "none". Empty picks "otlp"
+	// when an OTLP endpoint is set and "none" otherwise.
+	Exporter string `yaml:"exporter" env:"OTEL_TRACES_EXPORTER"`
+	File     string `yaml:"file" env:"OTEL_TRACES_FILE"`
+}
+
+// Health configures the readiness probe.
+type Health struct {
+	ReadinessTimeout time.Duration `yaml:"readiness_timeout" env:"READINESS_TIMEOUT"`
+}
+
+// Default returns the settings used when nothing overrides them.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:              ":8081",
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       10 * time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			MaxHeaderBytes:    64 << 10,
+			MaxBodyBytes:      1 << 30,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Database: Database{
+			MaxOpenConns:    20,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			Migrate:         true,
+		},
+		Storage: Storage{
+			Backend: storage.KindWebDAV,
+			S3:      S3{UseSSL: true},
+		},
+		Uploads: Uploads{
+			MaxChunks:       10000,
+			MaxChunkSize:    64 << 20,
+			MultipartMemory: 50 << 20,
+		},
+		Shares: Shares{
+			DefaultExpiry: 48 * time.Hour,
+			MaxExpiry:     30 * 24 * time.Hour,
+			AllowNever:    true,
+		},
+		Janitor: Janitor{
+			Enabled:        true,
+			TTL:            24 * time.Hour,
+			Interval:       time.Hour,
+			TrashRetention: 30 * 24 * time.Hour,
+		},
+		Downloads: Downloads{VerifyMode: "trailer"},
+		Logging:   Logging{Level: "info", Format: "json"},
+		Health:    Health{ReadinessTimeout: 2 * time.Second},
+	}
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/tracing"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the config file when the -config flag is not given.
+const FileEnv = "CONFIG_FILE"
+
+// Load builds the Config from, in increasing precedence, the defaults, the
+// config file named by -config or CONFIG_FILE, the environment and the
+// command line flags in args. It returns flag.ErrHelp if args ask for help,
+// and otherwise every problem found, joined into one error.
+func Load(args []string) (*Config, error) {
+	cfg, rest, err := LoadCommand(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(rest, " "))
+	}
+	return cfg, nil
+}
+
+// LoadCommand is Load for a command line that may name a subcommand after
+// the flags; the arguments left once the flags are parsed are returned as
+// rest.
+func LoadCommand(args []string) (cfg *Config, rest []string, err error) {
+	c := Default()
+	cfg = &c
+
+	fs := flag.NewFlagSet("fileService", flag.ContinueOnError)
+	file := fs.String("config", os.Getenv(FileEnv), "YAML or JSON config file (env "+FileEnv+")")
+	flagged := map[string]string{}
+	for _, s := range settings(cfg) {
+		if s.flag == "" {
+			continue
+		}
+		name := s.flag
+		fs.Func(name, fmt.Sprintf("overrides %s (%s)", s.env, s.path), func(v string) error {
+			flagged[name] = v
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	rest = fs.Args()
+
+	if *file != "" {
+		if err := loadFile(cfg, *file); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var errs []error
+	for _, s := range settings(cfg) {
+		// an empty variable counts as unset, as compose files often leave them
+		if v := os.Getenv(s.env); v != "" {
+			if err := set(s.value, v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+			}
+		}
+		if v, ok := flagged[s.flag]; ok && s.flag != "" {
+			if err := set(s.value, v); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", s.flag, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+
+	if cfg.Tracing.Exporter == "" {
+		cfg.Tracing.Exporter = tracing.ExporterNone
+		if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+			cfg.Tracing.Exporter = tracing.ExporterOTLP
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, rest, nil
+}
+
+// loadFile applies the settings in path on top of cfg. JSON is read by the
+// YAML decoder, which accepts it as well. Unknown keys are errors so a typo
+// does not silently leave a default in place.
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && err != io.EOF {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// setting is one leaf of the Config that can be set from the environment.
+type setting struct {
+	path  string // dotted file key, e.g. "server.addr"
+	env   string
+	flag  string
+	value reflect.Value
+}
+
+// settings lists the leaves of cfg that carry an env tag.
+func settings(cfg *Config) []setting {
+	var out []setting
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			path := prefix + f.Tag.Get("yaml")
+			if f.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), path+".")
+				continue
+			}
+			if env := f.Tag.Get("env"); env != "" {
+				out = append(out, setting{path: path, env: env, flag: f.Tag.Get("flag"), value: v.Field(i)})
+			}
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "")
+	return out
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set parses raw into v according to its type. Slices are comma separated.
+func set(v reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, use a Go duration such as \"30s\" or \"48h\"", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q, use \"true\" or \"false\"", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid non-negative integer %q", raw)
+		}
+		v.SetUint(n)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/storage"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/tracing"
+)
+
+// Validate reports every setting that is missing, out of range or
+// inconsistent with another, naming each by its environment variable.
+func (c *Config) Validate() error {
+	var errs []error
+	bad := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	s := c.Server
+	if s.Addr == "" {
+		bad("HTTP_ADDR must not be empty")
+	}
+	if s.ReadHeaderTimeout < 0 || s.ReadTimeout < 0 || s.WriteTimeout < 0 || s.IdleTimeout < 0 {
+		bad("HTTP_*_TIMEOUT must not be negative")
+	}
+	if s.MaxHeaderBytes <= 0 {
+		bad("HTTP_MAX_HEADER_BYTES must be positive, got %d", s.MaxHeaderBytes)
+	}
+	if s.MaxBodyBytes < 0 {
+		bad("HTTP_MAX_BODY_BYTES must not be negative, got %d (0 removes the limit)", s.MaxBodyBytes)
+	}
+	if (s.TLSCertFile == "") != (s.TLSKeyFile == "") {
+		bad("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if s.ShutdownTimeout <= 0 {
+		bad("SHUTDOWN_TIMEOUT must be positive, got %s", s.ShutdownTimeout)
+	}
+
+	d := c.Database
+	if d.URI == "" {
+		bad("POSTGRES_URI is required")
+	}
+	if d.MaxOpenConns < 0 || d.MaxIdleConns < 0 {
+		bad("DB_MAX_OPEN_CONNS and DB_MAX_IDLE_CONNS must not be negative")
+	}
+	if d.MaxOpenConns > 0 && d.MaxIdleConns > d.MaxOpenConns {
+		bad("DB_MAX_IDLE_CONNS (%d) must not exceed DB_MAX_OPEN_CONNS (%d)", d.MaxIdleConns, d.MaxOpenConns)
+	}
+	if d.ConnMaxLifetime < 0 || d.ConnMaxIdleTime < 0 {
+		bad("DB_CONN_MAX_LIFETIME and DB_CONN_MAX_IDLE_TIME must not be negative")
+	}
+
+	switch st := c.Storage; strings.ToLower(st.Backend) {
+	case storage.KindWebDAV, "owncloud":
+		if st.WebDAV.URL == "" {
+			bad("OWNCLOUD_URL is required for the %s storage backend", st.Backend)
+		}
+	case storage.KindLocal:
+		if st.Local.Root == "" {
+			bad("LOCAL_STORAGE_ROOT is required for the local storage backend")
+		}
+	case storage.KindS3:
+		if st.S3.Endpoint == "" || st.S3.Bucket == "" {
+			bad("S3_ENDPOINT and S3_BUCKET are required for the s3 storage backend")
+		}
+	default:
+		bad("STORAGE_BACKEND must be %q, %q or %q, got %q", storage.KindWebDAV, storage.KindLocal, storage.KindS3, st.Backend)
+	}
+
+	if a := c.Auth; !a.Disabled && a.JWTSecret == "" && a.JWTPublicKeyFile == "" {
+		bad("JWT_SECRET or JWT_PUBLIC_KEY_FILE is required unless AUTH_DISABLED is true")
+	}
+
+	u := c.Uploads
+	if u.MaxChunks < 0 || u.MaxChunkSize < 0 {
+		bad("UPLOAD_MAX_CHUNKS and UPLOAD_MAX_CHUNK_SIZE must not be negative (0 removes the limit)")
+	}
+	if u.MultipartMemory <= 0 {
+		bad("UPLOAD_MULTIPART_MEMORY must be positive, got %d", u.MultipartMemory)
+	}
+
+	sh := c.Shares
+	if sh.DefaultExpiry <= 0 {
+		bad("SHARE_DEFAULT_EXPIRY must be positive, got %s", sh.DefaultExpiry)
+	}
+	if sh.MaxExpiry < 0 {
+		bad("SHARE_MAX_EXPIRY must not be negative, got %s (0 removes the limit)", sh.MaxExpiry)
+	}
+	if sh.MaxExpiry > 0 && sh.DefaultExpiry > sh.MaxExpiry {
+		bad("SHARE_DEFAULT_EXPIRY (%s) must not exceed SHARE_MAX_EXPIRY (%s)", sh.DefaultExpiry, sh.MaxExpiry)
+	}
+
+	j := c.Janitor
+	if j.TTL <= 0 || j.Interval <= 0 || j.TrashRetention <= 0 {
+		bad("JANITOR_TTL, JANITOR_INTERVAL and TRASH_RETENTION must be positive")
+	}
+
+	// the modes of fileHandler.DownloadVerifyMode
+	if m := c.Downloads.VerifyMode; m != "trailer" && m != "pre" {
+		bad("DOWNLOAD_VERIFY_MODE must be \"trailer\" or \"pre\", got %q", m)
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			bad("CORS_ORIGINS entry %q must be \"*\" or an origin such as \"https://app.example.com\"", origin)
+		}
+	}
+
+	if _, err := logging.New(io.Discard, logging.Config{Level: c.Logging.Level, Format: c.Logging.Format}); err != nil {
+		bad("LOG_LEVEL or LOG_FORMAT: %v", err)
+	}
+
+	switch t := c.Tracing; t.Exporter {
+	case "", tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout, "console":
+	case tracing.ExporterFile:
+		if t.File == "" {
+			bad("OTEL_TRACES_FILE is required for the file trace exporter")
+		}
+	default:
+		bad("OTEL_TRACES_EXPORTER must be otlp, stdout, file or none, got %q", t.Exporter)
+	}
+
+	if c.Health.ReadinessTimeout <= 0 {
+		bad("READINESS_TIMEOUT must be positive, got %s", c.Health.ReadinessTimeout)
+	}
+
+	return errors.Join(errs...)
+}
@@ -2,7 +2,7 @@ package database
 
 import (
     "context"
-    "log"
+    "log/slog"
     "time"
     "fmt"
     "go.mongodb.org/mongo-driver/mongo"
@@ -23,6 +23,6 @@ func InitMongo(uri string) (*mongo.Client, error) {
         return nil, fmt.Errorf("MongoDB ping error: %w", err)
     }
 
-    log.Println("✅ MongoDB connected")
+    slog.Info("MongoDB connected")
     return client, nil
 }
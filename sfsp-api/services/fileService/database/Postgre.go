@@ -3,27 +3,43 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
+	"time"
 
-	_ "github.com/lib/pq"
-
-	//"github.com/joho/godotenv"
-	"os"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/tracing"
+	"github.com/lib/pq"
 )
 
 // Package database provides functions to connect to a PostgreSQL database.
 
-// connect to the PostgreSQL database
-func InitPostgre() (*sql.DB, error) {
-	db, err := sql.Open("postgres", os.Getenv("POSTGRES_URI"))
+// Config describes the PostgreSQL connection pool.
+type Config struct {
+	URI string
+	// MaxOpenConns of zero means no limit.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// connect to the PostgreSQL database; every SQL call made with a context
+// is traced
+func InitPostgre(cfg Config) (*sql.DB, error) {
+	connector, err := pq.NewConnector(cfg.URI)
 	if err != nil {
 		return nil, fmt.Errorf("PostgreSQL connect error: %w", err)
 	}
+	db := sql.OpenDB(tracing.WrapConnector(connector))
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 
 	if err := db.Ping(); err != nil {
+		_ = db.Close()
 		return nil, fmt.Errorf("PostgreSQL ping error: %w", err)
 	}
 
-	log.Println("✅ PostgreSQL connected")
+	slog.Info("PostgreSQL connected", "max_open_conns", cfg.MaxOpenConns)
 	return db, nil
 }
@@ -0,0 +1,15 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Repository is the part of a connection pool the handlers use. A *sql.DB
+// satisfies it, so does the *sql.DB of a sqlmock connection in tests.
+type Repository interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
@@ -1,112 +1,125 @@
 package fileHandler
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"time"
 
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metadata"
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
 )
 
-func ChangeShareMethodHandler(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseMultipartForm(50 << 20) // 50 MB memory buffer (adjust as needed)
+func (s *Server) ChangeShareMethodHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	err := s.parseMultipartForm(ctx, r)
 	if err != nil {
-		log.Println("Failed to parse multipart form:", err)
-		http.Error(w, "Invalid multipart form", http.StatusBadRequest)
+		logger.Warn("Failed to parse multipart form", "err", err)
+		api.Error(w, "Invalid multipart form", http.StatusBadRequest)
 		return
 	}
 
 	FileID := r.FormValue("fileid")
-	UserID := r.FormValue("userId")
+	UserID, ok := auth.ResolveUserID(w, r, r.FormValue("userId"))
+	if !ok {
+		return
+	}
 	RecipientID := r.FormValue("recipientId")
 	NewShareMethod := r.FormValue("newShareMethod")
 	metadataJSON := r.FormValue("metadata")
 
 	if FileID == "" || UserID == "" || RecipientID == "" || NewShareMethod == "" || metadataJSON == "" {
-		http.Error(w, "Missing required form fields", http.StatusBadRequest)
+		api.Error(w, "Missing required form fields", http.StatusBadRequest)
 		return
 	}
 
 	file, _, err := r.FormFile("encryptedFile")
 	if err != nil {
-		log.Println("Failed to get encrypted file:", err)
-		http.Error(w, "Missing encrypted file", http.StatusBadRequest)
+		logger.Error("Failed to get encrypted file", "err", err)
+		api.Error(w, "Missing encrypted file", http.StatusBadRequest)
 		return
 	}
 	defer func() {
 		if err := file.Close(); err != nil {
-			log.Println("error closing file:", err)
+			logger.Warn("Failed to close file", "err", err)
 		}
 	}()
 
 	if NewShareMethod != "view" && NewShareMethod != "download" {
-		http.Error(w, "Invalid share method. Use 'view' or 'download'", http.StatusBadRequest)
+		api.Error(w, "Invalid share method. Use 'view' or 'download'", http.StatusBadRequest)
+		return
+	}
+
+	expiresAt, err := s.shareExpiry(r.FormValue("expiresIn"), r.FormValue("expiresAt"), s.now())
+	if err != nil {
+		api.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	var ownerID string
-	err = DB.QueryRow("SELECT owner_id FROM files WHERE id = $1", FileID).Scan(&ownerID)
+	ownerID, err := s.store.FileOwner(ctx, FileID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "File not found", http.StatusNotFound)
+		if errors.Is(err, store.ErrNotFound) {
+			api.Error(w, "File not found", http.StatusNotFound)
 			return
 		}
-		log.Println("Database error:", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		logger.Error("Database error", "err", err)
+		api.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
 	if ownerID != UserID {
-		http.Error(w, "Unauthorized: You don't own this file", http.StatusForbidden)
+		api.Error(w, "Unauthorized: You don't own this file", http.StatusForbidden)
 		return
 	}
 
-	currentMethod, err := getCurrentShareMethod(FileID, UserID, RecipientID)
+	currentMethod, err := s.getCurrentShareMethod(ctx, FileID, UserID, RecipientID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "No active sharing found between these users", http.StatusNotFound)
+		if errors.Is(err, store.ErrNotFound) {
+			api.Error(w, "No active sharing found between these users", http.StatusNotFound)
 			return
 		}
-		log.Println("Error checking current share method:", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		logger.Error("Failed to check current share method", "err", err)
+		api.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
 	if currentMethod == NewShareMethod {
-		http.Error(w, fmt.Sprintf("File is already shared using %s method", NewShareMethod), http.StatusBadRequest)
+		api.Error(w, fmt.Sprintf("File is already shared using %s method", NewShareMethod), http.StatusBadRequest)
 		return
 	}
 
 	var responseMessage string
 	switch NewShareMethod {
 	case "view":
-		if err := convertToViewShare(FileID, UserID, RecipientID, metadataJSON); err != nil {
-			log.Println("Failed to convert to view share:", err)
-			http.Error(w, "Failed to convert to view sharing", http.StatusInternalServerError)
+		if err := s.convertToViewShare(ctx, FileID, UserID, RecipientID, metadataJSON, expiresAt); err != nil {
+			logger.Error("Failed to convert to view share", "err", err)
+			api.Error(w, "Failed to convert to view sharing", http.StatusInternalServerError)
 			return
 		}
 		responseMessage = "Successfully converted to view-only sharing"
 	case "download":
-		if err := convertToDownloadShare(FileID, UserID, RecipientID, metadataJSON); err != nil {
-			log.Println("Failed to convert to download share:", err)
-			http.Error(w, "Failed to convert to download sharing", http.StatusInternalServerError)
+		if err := s.convertToDownloadShare(ctx, FileID, UserID, RecipientID, metadataJSON, expiresAt); err != nil {
+			logger.Error("Failed to convert to download share", "err", err)
+			api.Error(w, "Failed to convert to download sharing", http.StatusInternalServerError)
 			return
 		}
 		responseMessage = "Successfully converted to download sharing"
 	}
 
-	_, err = DB.Exec(`
-		INSERT INTO access_logs (file_id, user_id, action, message, view_only)
-		VALUES ($1, $2, $3, $4, $5)
-	`, FileID, UserID, "share_method_changed",
-		fmt.Sprintf("Share method changed from %s to %s for user %s", currentMethod, NewShareMethod, RecipientID),
-		NewShareMethod == "view")
+	err = s.store.AddAccessLog(ctx, store.AccessLog{
+		FileID:   FileID,
+		UserID:   UserID,
+		Action:   "share_method_changed",
+		Message:  fmt.Sprintf("Share method changed from %s to %s for user %s", currentMethod, NewShareMethod, RecipientID),
+		ViewOnly: NewShareMethod == "view",
+	})
 	if err != nil {
-		log.Println("Failed to log share method change:", err)
+		logger.Error("Failed to log share method change", "err", err)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -115,164 +128,113 @@ func ChangeShareMethodHandler(w http.ResponseWriter, r *http.Request) {
 		"previousMethod": currentMethod,
 		"newMethod":      NewShareMethod,
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
-func getCurrentShareMethod(fileID, userID, recipientID string) (string, error) {
-
-	var viewShareID string
-	err := DB.QueryRow(`
-		SELECT id FROM shared_files_view 
-		WHERE sender_id = $1 AND recipient_id = $2 AND file_id = $3 AND revoked = FALSE
-	`, userID, recipientID, fileID).Scan(&viewShareID)
-
+// getCurrentShareMethod returns store.ErrNotFound when userID has not shared
+// the file with recipientID either way.
+func (s *Server) getCurrentShareMethod(ctx context.Context, fileID, userID, recipientID string) (string, error) {
+	_, err := s.store.ActiveViewShare(ctx, userID, recipientID, fileID)
 	if err == nil {
 		return "view", nil
-	} else if err != sql.ErrNoRows {
+	} else if !errors.Is(err, store.ErrNotFound) {
 		return "", err
 	}
 
-	var receivedFileID string
-	err = DB.QueryRow(`
-		SELECT id FROM received_files 
-		WHERE receiver_id = $1 AND sender_id = $2 AND file_id = $3
-	`, recipientID, userID, fileID).Scan(&receivedFileID)
-
+	_, err = s.store.LatestReceivedFile(ctx, userID, recipientID, fileID)
 	if err == nil {
 		return "download", nil
-	} else if err != sql.ErrNoRows {
-		return "", err
 	}
-
-	return "", sql.ErrNoRows
+	return "", err
 }
 
-func convertToViewShare(fileID, userID, recipientID, metadataJSON string) error {
-	tx, err := DB.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer func() {
-		if err := tx.Rollback(); err != nil {
-			log.Println("Rollback error (may be expected if already committed):", err)
-		}
-	}()
-
+func (s *Server) convertToViewShare(ctx context.Context, fileID, userID, recipientID, metadataJSON string, expiresAt time.Time) error {
+	logger := logging.FromContext(ctx)
 	sourcePath := fmt.Sprintf("files/%s/sent/%s", userID, fileID)
-	stream, err := owncloud.DownloadSentFileStream(sourcePath)
+	stream, err := s.blobs.DownloadSentFileStream(ctx, sourcePath)
 	if err != nil {
 		return fmt.Errorf("failed to download file for conversion: %w", err)
 	}
 	defer func() {
 		if err := stream.Close(); err != nil {
-			log.Println("error closing stream:", err)
+			logger.Warn("Failed to close stream", "err", err)
 		}
 	}()
 
 	targetPath := fmt.Sprintf("files/%s/shared_view", userID)
 	sharedFileKey := fmt.Sprintf("%s_%s", fileID, recipientID)
-	if err := owncloud.UploadFileStream(targetPath, sharedFileKey, stream); err != nil {
+	if err := s.blobs.UploadFileStream(ctx, targetPath, sharedFileKey, stream); err != nil {
 		return fmt.Errorf("failed to upload to view directory: %w", err)
 	}
 
-	_, err = tx.Exec(`
-		DELETE FROM received_files 
-		WHERE receiver_id = $1 AND sender_id = $2 AND file_id = $3
-	`, recipientID, userID, fileID)
+	_, err = s.store.ConvertToViewShare(ctx, store.ViewShare{
+		SenderID:      userID,
+		RecipientID:   recipientID,
+		FileID:        fileID,
+		Metadata:      metadataJSON,
+		ExpiresAt:     expiryRef(expiresAt),
+		AccessGranted: true,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to remove from received_files: %w", err)
+		return fmt.Errorf("failed to convert to view share: %w", err)
 	}
-
-	_, err = tx.Exec(`
-		DELETE FROM sent_files 
-		WHERE sender_id = $1 AND recipient_id = $2 AND file_id = $3
-	`, userID, recipientID, fileID)
-	if err != nil {
-		return fmt.Errorf("failed to remove from sent_files: %w", err)
-	}
-
-	_, err = tx.Exec(`
-		INSERT INTO shared_files_view (sender_id, recipient_id, file_id, metadata, expires_at, access_granted)
-		VALUES ($1, $2, $3, $4, $5, TRUE)
-	`, userID, recipientID, fileID, metadataJSON, time.Now().Add(48*time.Hour))
-	if err != nil {
-		return fmt.Errorf("failed to insert into shared_files_view: %w", err)
-	}
-
-	_, err = tx.Exec("UPDATE files SET allow_view_sharing = TRUE WHERE id = $1", fileID)
-	if err != nil {
-		return fmt.Errorf("failed to update file view sharing flag: %w", err)
-	}
-
-	return tx.Commit()
+	return nil
 }
 
-func convertToDownloadShare(fileID, userID, recipientID, metadataJSON string) error {
-	tx, err := DB.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer func() {
-		if err := tx.Rollback(); err != nil {
-			log.Println("Rollback error (may be expected if already committed):", err)
-		}
-	}()
-
+func (s *Server) convertToDownloadShare(ctx context.Context, fileID, userID, recipientID, metadataJSON string, expiresAt time.Time) error {
+	logger := logging.FromContext(ctx)
 	sourcePath := fmt.Sprintf("files/%s/shared_view/%s_%s", userID, fileID, recipientID)
-	stream, err := owncloud.DownloadSentFileStream(sourcePath)
+	stream, err := s.blobs.DownloadSentFileStream(ctx, sourcePath)
 	if err != nil {
 		return fmt.Errorf("failed to download file for conversion: %w", err)
 	}
 	defer func() {
 		if err := stream.Close(); err != nil {
-			log.Println("error closing stream:", err)
+			logger.Warn("Failed to close stream", "err", err)
 		}
 	}()
 
 	targetPath := fmt.Sprintf("files/%s/sent", userID)
-	if err := owncloud.UploadFileStream(targetPath, fileID, stream); err != nil {
+	if err := s.blobs.UploadFileStream(ctx, targetPath, fileID, stream); err != nil {
 		return fmt.Errorf("failed to upload to sent directory: %w", err)
 	}
 
-	_, err = tx.Exec(`
-		UPDATE shared_files_view 
-		SET revoked = TRUE, revoked_at = CURRENT_TIMESTAMP, access_granted = FALSE
-		WHERE sender_id = $1 AND recipient_id = $2 AND file_id = $3 AND revoked = FALSE
-	`, userID, recipientID, fileID)
-	if err != nil {
+	_, err = s.store.RevokeViewShare(ctx, userID, recipientID, fileID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
 		return fmt.Errorf("failed to revoke view access: %w", err)
 	}
 
-	receivedID, err := metadata.InsertReceivedFile(
-		DB,
+	receivedID, err := s.meta.InsertReceivedFile(
+		ctx,
 		recipientID,
 		userID,
 		fileID,
 		metadataJSON,
-		time.Now().Add(48*time.Hour),
+		expiresAt,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert received file: %w", err)
 	}
 
-	if err := metadata.InsertSentFile(DB, userID, recipientID, fileID, metadataJSON); err != nil {
+	if err := s.meta.InsertSentFile(ctx, userID, recipientID, fileID, metadataJSON); err != nil {
 		return fmt.Errorf("failed to insert sent file: %w", err)
 	}
 
-	log.Printf("Converted to download share, receivedID: %s", receivedID)
+	logger.Info("Converted view share to download share", "file_id", fileID, "received_id", receivedID)
 
 	sharePath := fmt.Sprintf("files/%s/shared_view/%s_%s", userID, fileID, recipientID)
-	log.Printf("Deleting view file from storage: %s", sharePath)
-	if err := owncloud.DeleteFile(fmt.Sprintf("%s_%s", fileID, recipientID), fmt.Sprintf("files/%s/shared_view", userID)); err != nil {
-		log.Printf("Warning: Failed to delete view file from storage: %v", err)
+	if err := s.blobs.DeleteFile(ctx, fmt.Sprintf("%s_%s", fileID, recipientID), fmt.Sprintf("files/%s/shared_view", userID)); err != nil {
+		logger.Warn("Failed to delete view copy", "path", sharePath, "err", err)
 
 	}
 
-	return tx.Commit()
+	return nil
 }
 
-func GetShareMethodHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetShareMethodHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	var req struct {
 		FileID      string `json:"fileId"`
 		UserID      string `json:"userId"`
@@ -280,38 +242,43 @@ func GetShareMethodHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		api.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
 		return
 	}
+	req.UserID = userID
 
 	if req.FileID == "" || req.UserID == "" || req.RecipientID == "" {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		api.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
 
-	var ownerID string
-	err := DB.QueryRow("SELECT owner_id FROM files WHERE id = $1", req.FileID).Scan(&ownerID)
+	ownerID, err := s.store.FileOwner(ctx, req.FileID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "File not found", http.StatusNotFound)
+		if errors.Is(err, store.ErrNotFound) {
+			api.Error(w, "File not found", http.StatusNotFound)
 			return
 		}
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		api.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
 	if ownerID != req.UserID {
-		http.Error(w, "Unauthorized", http.StatusForbidden)
+		api.Error(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
 
-	currentMethod, err := getCurrentShareMethod(req.FileID, req.UserID, req.RecipientID)
+	currentMethod, err := s.getCurrentShareMethod(ctx, req.FileID, req.UserID, req.RecipientID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "No active sharing found", http.StatusNotFound)
+		if errors.Is(err, store.ErrNotFound) {
+			api.Error(w, "No active sharing found", http.StatusNotFound)
 			return
 		}
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		api.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
@@ -321,6 +288,6 @@ func GetShareMethodHandler(w http.ResponseWriter, r *http.Request) {
 		"shareMethod": currentMethod,
 		"canConvert":  "true",
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
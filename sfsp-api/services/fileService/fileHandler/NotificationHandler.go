@@ -1,11 +1,14 @@
 package fileHandler
 
 import (
-	"database/sql"
 	"encoding/json"
-	"fmt"
-	"log"
+	"errors"
 	"net/http"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
 )
 
 type Notification struct {
@@ -21,88 +24,81 @@ type Notification struct {
 	Read      bool   `json:"read"`
 }
 
-func NotificationHandler(w http.ResponseWriter, r *http.Request) {
+// notificationListing orders a user's notifications.
+var notificationListing = api.Listing{
+	Sorts:        map[string]string{"timestamp": "notifications.timestamp"},
+	ID:           "notifications.id",
+	DefaultSort:  "timestamp",
+	DefaultOrder: "desc",
+}
+
+func (s *Server) NotificationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Method not allowed",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+		api.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	userID := r.URL.Query().Get("id")
+	userID, ok := auth.ResolveUserID(w, r, r.URL.Query().Get("id"))
+	if !ok {
+		return
+	}
 	if userID == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Missing user ID",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+		api.Error(w, "Missing user ID", http.StatusBadRequest)
 		return
 	}
 
-	if DB == nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Database not initialized",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+	if s.store == nil {
+		api.Error(w, "Database not initialized", http.StatusInternalServerError)
 		return
 	}
 
-	rows, err := DB.Query(`SELECT id, type, "from", "to", file_name, file_id, message, timestamp, status, read 
-		FROM notifications WHERE "to" = $1`, userID)
+	page, err := notificationListing.Page(r, api.PageRequest{})
 	if err != nil {
-		log.Printf("Error querying notifications: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to fetch notifications",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+		api.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Println("error closing rows:", err)
-		}
-	}()
-
-	notifications := []Notification{}
-	for rows.Next() {
-		var n Notification
-		if err := rows.Scan(&n.ID, &n.Type, &n.From, &n.To, &n.FileName, &n.FileID, &n.Message, &n.Timestamp, &n.Status, &n.Read); err != nil {
-			log.Printf("Error scanning notification row: %v", err)
-			continue
-		}
-		notifications = append(notifications, n)
+
+	found, err := s.store.ListNotifications(ctx, userID, page)
+	if err != nil {
+		logger.Error("Failed to query notifications", "err", err)
+		api.Error(w, "Failed to fetch notifications", http.StatusInternalServerError)
+		return
+	}
+
+	notifications := make([]Notification, 0, len(found))
+	for _, n := range found {
+		notifications = append(notifications, Notification{
+			ID:        n.ID,
+			Type:      n.Type,
+			From:      n.From,
+			To:        n.To,
+			FileName:  n.FileName,
+			FileID:    n.FileID,
+			Message:   n.Message,
+			Timestamp: n.Timestamp,
+			Status:    n.Status,
+			Read:      n.Read,
+		})
 	}
 
+	page.Finish(w)
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":       true,
 		"notifications": notifications,
+		"nextCursor":    page.Next(),
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
-func MarkAsReadHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) MarkAsReadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Method not allowed",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+		api.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -111,60 +107,32 @@ func MarkAsReadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Invalid request body",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+		api.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	if req.ID == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Missing notification ID",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+		api.Error(w, "Missing notification ID", http.StatusBadRequest)
 		return
 	}
 
-	if DB == nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Database not initialized",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+	if s.store == nil {
+		api.Error(w, "Database not initialized", http.StatusInternalServerError)
 		return
 	}
 
-	result, err := DB.Exec("UPDATE notifications SET read = TRUE WHERE id = $1", req.ID)
-	if err != nil {
-		log.Printf("Error updating notification read status: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to update notification",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+	if !s.requireNotificationRecipient(w, r, req.ID) {
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		w.WriteHeader(http.StatusNotFound)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Notification not found",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+	err := s.store.MarkNotificationRead(ctx, req.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		api.Error(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to mark notification as read", "notification_id", req.ID, "err", err)
+		api.Error(w, "Failed to update notification", http.StatusInternalServerError)
 		return
 	}
 
@@ -173,19 +141,15 @@ func MarkAsReadHandler(w http.ResponseWriter, r *http.Request) {
 		"success": true,
 		"message": "Notification marked as read",
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
-func RespondToShareRequestHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) RespondToShareRequestHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Method not allowed",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+		api.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -195,146 +159,77 @@ func RespondToShareRequestHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Invalid request body",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+		api.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	if req.ID == "" || req.Status == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Missing ID or status",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+		api.Error(w, "Missing ID or status", http.StatusBadRequest)
 		return
 	}
 
 	if req.Status != "accepted" && req.Status != "declined" && req.Status != "pending" {
-		w.WriteHeader(http.StatusBadRequest)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Invalid status. Must be 'accepted' or 'declined' or 'pending'",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+		api.Error(w, "Invalid status. Must be 'accepted' or 'declined' or 'pending'", http.StatusBadRequest)
 		return
 	}
 
-	if DB == nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Database not initialized",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+	if s.store == nil {
+		api.Error(w, "Database not initialized", http.StatusInternalServerError)
 		return
 	}
 
-	// ✅ Update notification status
-	result, err := DB.Exec("UPDATE notifications SET status = $1, read = TRUE WHERE id = $2", req.Status, req.ID)
-	if err != nil {
-		log.Printf("Error updating notification status: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to update notification",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+	if !s.requireNotificationRecipient(w, r, req.ID) {
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		w.WriteHeader(http.StatusNotFound)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Notification not found",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+	// ✅ Update notification status
+	err := s.store.SetNotificationStatus(ctx, req.ID, req.Status)
+	if errors.Is(err, store.ErrNotFound) {
+		api.Error(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to update notification status", "notification_id", req.ID, "err", err)
+		api.Error(w, "Failed to update notification", http.StatusInternalServerError)
 		return
 	}
 
 	//fetch the file id from the god damn notifications table
 	if req.Status == "accepted" {
-		var fileID, metadata, senderId, recipientId string
-		var receivedFileId sql.NullString
-		var isViewOnly = false
-
 		// Step 1: Get notification info
-		err := DB.QueryRow(`
-		SELECT n.file_id, n."from", n."to", n."received_file_id"
-		FROM notifications n
-		WHERE n.id = $1
-	`, req.ID).Scan(&fileID, &senderId, &recipientId, &receivedFileId)
-
+		n, err := s.store.Notification(ctx, req.ID)
 		if err != nil {
-			log.Printf("Error fetching notification info: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			if err := json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"error":   "Failed to retrieve notification info",
-			}); err != nil {
-				log.Println("Failed to encode response:", err)
-			}
+			logger.Error("Failed to fetch notification", "notification_id", req.ID, "err", err)
+			api.Error(w, "Failed to retrieve notification info", http.StatusInternalServerError)
 			return
 		}
 
-		if receivedFileId.Valid {
-			err = DB.QueryRow(`
-				SELECT metadata
-				FROM received_files
-				WHERE file_id = $1 AND recipient_id = $2 AND id = $3
-			`, fileID, recipientId, receivedFileId.String).Scan(&metadata)
+		// Step 2: Get the key material from the received copy or the view share
+		var metadata string
+		isViewOnly := n.ReceivedFileID == ""
+		if !isViewOnly {
+			var received store.ReceivedFile
+			received, err = s.store.ReceivedFile(ctx, n.ReceivedFileID)
+			if err == nil && (received.FileID != n.FileID || received.RecipientID != n.To) {
+				err = store.ErrNotFound
+			}
+			metadata = received.Metadata
 		} else {
-			isViewOnly = true
-			err = DB.QueryRow(`
-			SELECT metadata 
-			FROM shared_files_view
-			WHERE sender_id = $1 AND recipient_id = $2 AND file_id = $3
-		`, senderId, recipientId, fileID).Scan(&metadata)
+			var share store.ViewShare
+			share, err = s.store.ViewShare(ctx, n.From, n.To, n.FileID)
+			metadata = share.Metadata
 		}
-
 		if err != nil {
-			log.Printf("Error fetching received file metadata: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			if err := json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"error":   "Failed to retrieve file metadata",
-			}); err != nil {
-				log.Println("Failed to encode response:", err)
-			}
+			logger.Error("Failed to fetch received file", "notification_id", req.ID, "err", err)
+			api.Error(w, "Failed to retrieve file metadata", http.StatusInternalServerError)
 			return
 		}
 
 		// Step 3: Get file info from files table
-		var fileName, fileType, fileCID string
-		var fileSize int64
-
-		err = DB.QueryRow(`
-		SELECT file_name, file_type, cid, file_size
-		FROM files
-		WHERE id = $1
-	`, fileID).Scan(&fileName, &fileType, &fileCID, &fileSize)
-
+		file, err := s.store.File(ctx, n.FileID)
 		if err != nil {
-			log.Printf("Error fetching file details: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			if err := json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"error":   "Failed to retrieve file details",
-			}); err != nil {
-				log.Println("Failed to encode response:", err)
-			}
+			logger.Error("Failed to fetch file details", "file_id", n.FileID, "err", err)
+			api.Error(w, "Failed to retrieve file details", http.StatusInternalServerError)
 			return
 		}
 
@@ -343,32 +238,28 @@ func RespondToShareRequestHandler(w http.ResponseWriter, r *http.Request) {
 			"success": true,
 			"message": "Notification status updated",
 			"fileData": map[string]interface{}{
-				"file_id":      fileID,
-				"sender_id":    senderId,
-				"recipient_id": recipientId,
-				"file_name":    fileName,
-				"file_type":    fileType,
-				"cid":          fileCID,
-				"file_size":    fileSize,
+				"file_id":      n.FileID,
+				"sender_id":    n.From,
+				"recipient_id": n.To,
+				"file_name":    file.FileName,
+				"file_type":    file.FileType,
+				"cid":          file.CID,
+				"file_size":    file.FileSize,
 				"metadata":     metadata,
 				"viewOnly":     isViewOnly,
 			},
 		}); err != nil {
-			log.Println("Failed to encode response:", err)
+			logger.Warn("Failed to encode response", "err", err)
 		}
 		return
 	}
 }
 
-func ClearNotificationHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) ClearNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Method not allowed",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+		api.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -376,60 +267,32 @@ func ClearNotificationHandler(w http.ResponseWriter, r *http.Request) {
 		ID string `json:"id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Invalid request body",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+		api.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	if req.ID == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Missing notification ID",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+		api.Error(w, "Missing notification ID", http.StatusBadRequest)
 		return
 	}
 
-	if DB == nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Database not initialized",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+	if s.store == nil {
+		api.Error(w, "Database not initialized", http.StatusInternalServerError)
 		return
 	}
 
-	result, err := DB.Exec("DELETE FROM notifications WHERE id = $1", req.ID)
-	if err != nil {
-		log.Printf("Error deleting notification: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to delete notification",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+	if !s.requireNotificationRecipient(w, r, req.ID) {
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		w.WriteHeader(http.StatusNotFound)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Notification not found",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+	err := s.store.DeleteNotification(ctx, req.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		api.Error(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to delete notification", "notification_id", req.ID, "err", err)
+		api.Error(w, "Failed to delete notification", http.StatusInternalServerError)
 		return
 	}
 
@@ -438,19 +301,15 @@ func ClearNotificationHandler(w http.ResponseWriter, r *http.Request) {
 		"success": true,
 		"message": "Notification deleted",
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
-func AddNotificationHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) AddNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Method not allowed",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+		api.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -466,66 +325,43 @@ func AddNotificationHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Invalid request body",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+		api.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
+	from, ok := auth.ResolveUserID(w, r, notification.From)
+	if !ok {
+		return
+	}
+	notification.From = from
+
 	if notification.Type == "" || notification.From == "" || notification.To == "" ||
 		notification.FileName == "" || notification.FileID == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Missing required fields",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
-		fmt.Println("Notification details:", notification)
+		api.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
 
-	if DB == nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Database not initialized",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+	if s.store == nil {
+		api.Error(w, "Database not initialized", http.StatusInternalServerError)
 		return
 	}
 
-	var notificationID string
-	var err error
-
-	if notification.ViewOnly || notification.ReceivedFileID == "" {
-		err = DB.QueryRow(`INSERT INTO notifications 
-			(type, "from", "to", file_name, file_id, message, status) 
-			VALUES ($1, $2, $3, $4, $5, $6, 'pending') RETURNING id`,
-			notification.Type, notification.From, notification.To,
-			notification.FileName, notification.FileID, notification.Message).Scan(&notificationID)
-	} else {
-		err = DB.QueryRow(`INSERT INTO notifications 
-			(type, "from", "to", file_name, file_id, received_file_id, message, status) 
-			VALUES ($1, $2, $3, $4, $5, $6, $7, 'pending') RETURNING id`,
-			notification.Type, notification.From, notification.To,
-			notification.FileName, notification.FileID, notification.ReceivedFileID, notification.Message).Scan(&notificationID)
+	n := store.Notification{
+		Type:           notification.Type,
+		From:           notification.From,
+		To:             notification.To,
+		FileName:       notification.FileName,
+		FileID:         notification.FileID,
+		ReceivedFileID: notification.ReceivedFileID,
+		Message:        notification.Message,
 	}
-
+	if notification.ViewOnly {
+		n.ReceivedFileID = ""
+	}
+	notificationID, err := s.store.AddNotification(ctx, n)
 	if err != nil {
-		log.Printf("Error adding notification: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to add notification",
-		}); err != nil {
-			log.Println("Failed to encode response:", err)
-		}
+		logger.Error("Failed to add notification", "err", err)
+		api.Error(w, "Failed to add notification", http.StatusInternalServerError)
 		return
 	}
 
@@ -535,6 +371,35 @@ func AddNotificationHandler(w http.ResponseWriter, r *http.Request) {
 		"message": "Notification added",
 		"id":      notificationID,
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
+
+// requireNotificationRecipient answers 403 unless the notification was
+// addressed to the authenticated user, or 404 when it does not exist.
+// Unauthenticated requests are not checked (see auth.ResolveUserID).
+func (s *Server) requireNotificationRecipient(w http.ResponseWriter, r *http.Request, id string) bool {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		return true
+	}
+
+	status, message := 0, ""
+	to, err := s.store.NotificationRecipient(ctx, id)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		status, message = http.StatusNotFound, "Notification not found"
+	case err != nil:
+		logger.Error("Failed to look up notification recipient", "err", err)
+		status, message = http.StatusInternalServerError, "Failed to look up notification"
+	case to != user.ID:
+		status, message = http.StatusForbidden, "Notification belongs to another user"
+	default:
+		return true
+	}
+
+	api.Error(w, message, status)
+	return false
+}
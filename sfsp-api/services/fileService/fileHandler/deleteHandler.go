@@ -5,48 +5,70 @@ import (
 	"encoding/json"
 	//"fmt"
 	"net/http"
-	"log"
 	//"os"
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metadata"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
 )
 
 type deleteRequest struct{
 	FileId string `json:"fileId"`
 	UserID string `json:"userId"`
+	// Permanent skips the trash and deletes the file straight away
+	Permanent bool `json:"permanent"`
 }
 
-func DeleteFileHandler(w http.ResponseWriter, r *http.Request){
+func (s *Server) DeleteFileHandler(w http.ResponseWriter, r *http.Request){
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	var req deleteRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
 	if req.FileId == "" {
-		log.Println("No fileId provided")
-		http.Error(w, "Missing fileId", http.StatusBadRequest)
+		api.Error(w, "Missing fileId", http.StatusBadRequest)
 		return
 	}
 
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
+		return
+	}
+	req.UserID = userID
+
 	if req.UserID == "" {
-		log.Println("No UserId provided")
-		http.Error(w, "Missing UserID", http.StatusBadRequest)
+		api.Error(w, "Missing UserID", http.StatusBadRequest)
 		return
 	}
 
-	err = owncloud.DeleteFile(req.FileId, req.UserID)
-	if err != nil {
-		log.Println("OwnCloud deletefailed failed:", err)
-		http.Error(w, "File delete failed", http.StatusInternalServerError)
+	if !auth.RequireFileOwner(w, r, s.store, req.FileId) {
+		return
+	}
+
+	if !req.Permanent {
+		// 🗑️ Soft delete: the file can be restored until the trash is
+		// emptied or the retention period runs out
+		if err := s.meta.TrashFile(ctx, req.FileId); err != nil {
+			logger.Error("Failed to move file to trash", "err", err)
+			api.Error(w, "File delete failed", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]string{
+			"message": "File moved to trash",
+		}); err != nil {
+			logger.Warn("Failed to encode response", "err", err)
+		}
 		return
 	}
 
-	err = metadata.DeleteFileMetadata(req.FileId)
+	err = s.purgeFile(ctx, req.FileId)
 	if err != nil {
-		log.Println("Metadata failed to delete:", err)
-		http.Error(w, "File delete failed", http.StatusInternalServerError)
+		logger.Error("File delete failed", "err", err)
+		api.Error(w, "File delete failed", http.StatusInternalServerError)
 		return
 	}
 
@@ -56,6 +78,6 @@ func DeleteFileHandler(w http.ResponseWriter, r *http.Request){
 		"message": "File successfully deleted",
 
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
\ No newline at end of file
@@ -5,14 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"log"
 	//"os"
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
 	//"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/crypto"
-	//"database/sql"
+	"errors"
 	"io"
-	"crypto/sha256"
-	"encoding/hex"
 	//"bytes"
 	//_ "github.com/lib/pq" // PostgreSQL driver
 )
@@ -35,73 +35,63 @@ type DownloadResponse struct {
 	Nonce       string `json:"nonce"`
 }
 
-func DownloadHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) DownloadHandler(w http.ResponseWriter, r *http.Request) {
+    ctx := api.Detach(r)
+    logger := logging.FromContext(ctx)
     var req DownloadRequest
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+        api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
         return
     }
 
-    if req.UserID == "" || req.FileId == "" {
-        http.Error(w, "Missing userId or fileId", http.StatusBadRequest)
+    userID, ok := auth.ResolveUserID(w, r, req.UserID)
+    if !ok {
         return
     }
-    log.Println("Got download request:", req.UserID, req.FileId)
+    req.UserID = userID
 
-    var fileName, nonce, fileHash, cid string
-    err := DB.QueryRow(`
-        SELECT file_name, nonce, file_hash, cid FROM files
-        WHERE owner_id = $1 AND id = $2
-    `, req.UserID, req.FileId).Scan(&fileName, &nonce, &fileHash, &cid)
-    if err != nil {
-        log.Println("❌ Failed to retrieve file metadata:", err)
-        http.Error(w, "File not found", http.StatusNotFound)
+    if req.UserID == "" || req.FileId == "" {
+        api.Error(w, "Missing userId or fileId", http.StatusBadRequest)
         return
     }
 
-    log.Println("✅ Found file:", fileName, "nonce:", nonce, "cid:", cid)
-
-    // 🔁 Stream file from OwnCloud final location
-    stream, err := owncloud.DownloadFileStream(req.FileId)
-    if err != nil {
-        log.Println("❌ OwnCloud download failed:", err)
-        http.Error(w, "Download failed", http.StatusInternalServerError)
-        return
+    f, err := s.store.File(ctx, req.FileId)
+    if err == nil && (f.OwnerID != req.UserID || f.DeletedAt != nil) {
+        err = store.ErrNotFound
     }
-    defer func() {
-        if err := stream.Close(); err != nil {
-            log.Println("error closing stream:", err)
-        }
-    }()
-
-    // Hash verification while streaming
-    hasher := sha256.New()
-    tee := io.TeeReader(stream, hasher)
-
-    log.Println("Filename is:", fileName)
-    log.Println("Nonce is: ",nonce)
-
-    // HTTP headers for browser & Node client
-    w.Header().Set("Content-Type", "application/octet-stream")
-    w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
-    w.Header().Set("X-File-Name", fileName)
-    w.Header().Set("X-Nonce", nonce)
-    w.WriteHeader(http.StatusOK)
-
-    // Stream file to client with buffer
-    buf := make([]byte, 32*1024)
-    if _, err := io.CopyBuffer(w, tee, buf); err != nil {
-        log.Println("❌ Failed to stream file:", err)
+    if err != nil {
+        logger.Error("Failed to retrieve file metadata", "err", err)
+        api.Error(w, "File not found", http.StatusNotFound)
         return
     }
 
-    // Verify hash at the end
-    computedHash := hex.EncodeToString(hasher.Sum(nil))
-    if computedHash != fileHash {
-        log.Printf("❌ Hash mismatch: expected %s, got %s", fileHash, computedHash)
-    } else {
-        log.Println("✅ File integrity check passed, hash:", computedHash)
+    // Files without a hash never finished uploading, so their size is not
+    // reliable enough to serve ranges from.
+    size := f.FileSize
+    if f.FileHash == "" {
+        size = -1
     }
+
+    // 🔁 Stream file from storage, honouring Range and conditional headers
+    s.serveBlob(w, r, blobDownload{
+        target: integrityTarget{
+            fileID:    req.FileId,
+            ownerID:   req.UserID,
+            expected:  f.FileHash,
+            corrupted: f.CorruptedAt != nil,
+        },
+        size: size,
+        open: func() (io.ReadCloser, error) { return s.blobs.DownloadFileStream(ctx, req.FileId) },
+        openRange: func(offset, length int64) (io.ReadCloser, error) {
+            return s.blobs.DownloadFileRange(ctx, req.FileId, offset, length)
+        },
+        failMsg: "Download failed",
+    }, func(h http.Header) {
+        // HTTP headers for browser & Node client
+        h.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, f.FileName))
+        h.Set("X-File-Name", f.FileName)
+        h.Set("X-Nonce", f.Nonce)
+    })
 }
 
 
@@ -111,44 +101,86 @@ type DownloadSentRequest struct {
 
 
 
-func DownloadSentFile(w http.ResponseWriter, r *http.Request) {
+func (s *Server) DownloadSentFile(w http.ResponseWriter, r *http.Request) {
+    ctx := api.Detach(r)
+    logger := logging.FromContext(ctx)
     var req DownloadSentRequest
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+        api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
         return
     }
 
     if req.FilePath == "" {
-        http.Error(w, "Missing FilePath", http.StatusBadRequest)
+        api.Error(w, "Missing FilePath", http.StatusBadRequest)
         return
     }
 
-    log.Println("Downloading sent file (stream):", req.FilePath)
-
-    stream, err := owncloud.DownloadSentFileStream(req.FilePath)
-    if err != nil {
-        log.Println("OwnCloud download failed:", err)
-        http.Error(w, "Download failed", http.StatusInternalServerError)
+    if !s.canReadSentFile(w, r, req.FilePath) {
         return
     }
-    defer func() {
-        if err := stream.Close(); err != nil {
-            log.Println("error closing stream:", err)
-        }
-    }()
-
-    w.Header().Set("Content-Type", "application/octet-stream")
-    w.WriteHeader(http.StatusOK)
 
-    hasher := sha256.New()
-    tee := io.TeeReader(stream, hasher)
-
-    if _, err := io.Copy(w, tee); err != nil {
-        log.Println("Failed to stream sent file:", err)
+    target, size, err := s.blobTarget(ctx, req.FilePath)
+    if err != nil {
+        logger.Error("Failed to look up sent file hash", "err", err)
+        api.Error(w, "Database error", http.StatusInternalServerError)
         return
     }
 
-    computedHash := hex.EncodeToString(hasher.Sum(nil))
-    log.Println("Sent file streamed successfully, you should watch Delicious in Dungeon. Hash:", computedHash)
+    s.serveBlob(w, r, blobDownload{
+        target: target,
+        size:   size,
+        open:   func() (io.ReadCloser, error) { return s.blobs.DownloadSentFileStream(ctx, req.FilePath) },
+        openRange: func(offset, length int64) (io.ReadCloser, error) {
+            return s.blobs.DownloadSentFileRange(ctx, req.FilePath, offset, length)
+        },
+        failMsg: "Download failed",
+    }, nil)
 }
 
+// canReadSentFile answers 400 for a malformed path, and 403 unless the
+// authenticated user sent the file at path ("files/<senderId>/sent/<fileId>")
+// or is one of its recipients. Unauthenticated requests only have the path
+// checked (see auth.ResolveUserID).
+func (s *Server) canReadSentFile(w http.ResponseWriter, r *http.Request, path string) bool {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	parts, ok := splitBlobPath(path)
+	if !ok {
+		api.Error(w, "Invalid file path", http.StatusBadRequest)
+		return false
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		return true
+	}
+
+	if len(parts) != 4 || parts[0] != "files" || parts[2] != "sent" {
+		api.Error(w, "Forbidden: not a sent file path", http.StatusForbidden)
+		return false
+	}
+	senderID, fileID := parts[1], parts[3]
+	if senderID == user.ID {
+		return true
+	}
+
+	received, err := s.store.LatestReceivedFile(ctx, senderID, user.ID, fileID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		logger.Error("Failed to check sent file access", "err", err)
+		api.Error(w, "Database error", http.StatusInternalServerError)
+		return false
+	}
+	if err != nil || received.ExpiresAt != nil && !received.ExpiresAt.After(s.now()) {
+		api.Error(w, "Forbidden: file was not sent to you, or the share has expired", http.StatusForbidden)
+		return false
+	}
+	// shares are suspended while the sender has the file in the trash
+	if trashed, err := s.fileInTrash(ctx, fileID); err != nil {
+		logger.Error("Failed to check trash state", "err", err)
+		api.Error(w, "Database error", http.StatusInternalServerError)
+		return false
+	} else if trashed {
+		api.Error(w, "File not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
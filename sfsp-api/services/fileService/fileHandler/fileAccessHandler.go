@@ -1,15 +1,21 @@
 package fileHandler
 
 import (
-	"database/sql"
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
 )
 
 //var DB DBInterface = nil
 
-func AddAccesslogHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) AddAccesslogHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	type reqBody struct {
 		FileID  string `json:"file_id"`
 		UserID  string `json:"user_id"`
@@ -18,103 +24,113 @@ func AddAccesslogHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	var req reqBody
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
 		return
 	}
+	req.UserID = userID
+
 	if req.FileID == "" || req.UserID == "" || req.Action == "" {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		api.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
-	_, err := DB.Exec(`INSERT INTO access_logs (file_id, user_id, action, message) VALUES ($1, $2, $3, $4)`, req.FileID, req.UserID, req.Action, req.MESSAGE)
+	err := s.store.AddAccessLog(ctx, store.AccessLog{FileID: req.FileID, UserID: req.UserID, Action: req.Action, Message: req.MESSAGE})
 	if err != nil {
-		log.Println("Failed to insert access log:", err)
-		http.Error(w, "Failed to add access log", http.StatusInternalServerError)
+		logger.Error("Failed to insert access log", "err", err)
+		api.Error(w, "Failed to add access log", http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusCreated)
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Access log added successfully"}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
-func GetAccesslogHandler(w http.ResponseWriter, r *http.Request) {
+// accessLogListing orders access log entries.
+var accessLogListing = api.Listing{
+	Sorts:        map[string]string{"timestamp": "access_logs.timestamp"},
+	ID:           "access_logs.id",
+	DefaultSort:  "timestamp",
+	DefaultOrder: "desc",
+}
+
+func (s *Server) GetAccesslogHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	fileID := r.URL.Query().Get("file_id")
-	var rows *sql.Rows
-	var err error
+	page, err := accessLogListing.Page(r, api.PageRequest{})
+	if err != nil {
+		api.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var filter store.AccessLogFilter
+	user, authenticated := auth.UserFromContext(r.Context())
 	if fileID != "" {
-		rows, err = DB.Query(`SELECT id, file_id, user_id, action, message, timestamp FROM access_logs WHERE file_id = $1 ORDER BY timestamp DESC`, fileID)
-	} else {
-		rows, err = DB.Query(`SELECT id, file_id, user_id, action, message, timestamp FROM access_logs ORDER BY timestamp DESC`)
+		if !auth.RequireFileOwner(w, r, s.store, fileID) {
+			return
+		}
+		filter.FileID = fileID
+	} else if authenticated {
+		// only the logs of files the caller owns
+		filter.OwnerID = user.ID
 	}
+	entries, err := s.store.ListAccessLogs(ctx, filter, page)
 	if err != nil {
-		log.Println("Failed to query access logs:", err)
-		http.Error(w, "Failed to get access logs", http.StatusInternalServerError)
+		logger.Error("Failed to query access logs", "err", err)
+		api.Error(w, "Failed to get access logs", http.StatusInternalServerError)
 		return
 	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Println("error closing rows:", err)
-		}
-	}()
-	logs := []map[string]any{}
-	for rows.Next() {
-		var id, fileID, userID, action, message string
-		var timestamp string
-		if err := rows.Scan(&id, &fileID, &userID, &action, &message, &timestamp); err != nil {
-			log.Println("Failed to scan access log row:", err)
-			continue
-		}
+	logs := make([]map[string]any, 0, len(entries))
+	for _, l := range entries {
 		logs = append(logs, map[string]any{
-			"id":        id,
-			"file_id":   fileID,
-			"user_id":   userID,
-			"action":    action,
-			"message":   message,
-			"timestamp": timestamp,
+			"id":        l.ID,
+			"file_id":   l.FileID,
+			"user_id":   l.UserID,
+			"action":    l.Action,
+			"message":   l.Message,
+			"timestamp": l.Timestamp,
 		})
 	}
+	page.Finish(w)
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(logs); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
-func GetUsersWithFileAccessHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetUsersWithFileAccessHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	fileID := r.URL.Query().Get("fileId")
 	if fileID == "" {
-		http.Error(w, "fileId is required", http.StatusBadRequest)
+		api.Error(w, "fileId is required", http.StatusBadRequest)
 		return
 	}
 
-	var ownerID string
-	err := DB.QueryRow(`SELECT owner_id FROM files WHERE id = $1`, fileID).Scan(&ownerID)
-	if err != nil {
-		log.Println("Failed to get file owner:", err)
-		http.Error(w, "Failed to get file owner", http.StatusInternalServerError)
+	ownerID, err := s.store.FileOwner(ctx, fileID)
+	if errors.Is(err, store.ErrNotFound) {
+		api.Error(w, "File not found", http.StatusNotFound)
 		return
 	}
-
-	rows, err := DB.Query(`SELECT DISTINCT recipient_id FROM shared_files_view WHERE file_id = $1`, fileID)
 	if err != nil {
-		log.Println("Failed to query users with file access:", err)
-		http.Error(w, "Failed to get users with file access", http.StatusInternalServerError)
+		logger.Error("Failed to get file owner", "err", err)
+		api.Error(w, "Failed to get file owner", http.StatusInternalServerError)
+		return
+	}
+	if !auth.RequireOwner(w, r, ownerID) {
 		return
 	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Println("error closing rows:", err)
-		}
-	}()
 
-	users := []string{}
-	for rows.Next() {
-		var userID string
-		if err := rows.Scan(&userID); err != nil {
-			log.Println("Failed to scan user ID:", err)
-			continue
-		}
-		users = append(users, userID)
+	users, err := s.store.ViewShareRecipients(ctx, fileID)
+	if err != nil {
+		logger.Error("Failed to query users with file access", "err", err)
+		api.Error(w, "Failed to get users with file access", http.StatusInternalServerError)
+		return
 	}
 
 	var response = map[string]any{
@@ -125,6 +141,6 @@ func GetUsersWithFileAccessHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
@@ -1,12 +1,10 @@
 package fileHandler
 
 import (
-	//"context"
-	//"database/sql"
 	//"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	// "os"
 	//"time"
@@ -15,65 +13,107 @@ import (
 	//"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/crypto"
 	//"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
 
-	"github.com/lib/pq"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
 	"strings"
-	//"database/sql"
 )
 
-func CreateFolderHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+func (s *Server) CreateFolderHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 
 	var req struct {
 		UserID   string `json:"userId"`
 		FolderName string `json:"folderName"`
+		ParentID string `json:"parentId"`     // Optional, the folder to create it in
 		ParentPath string `json:"parentPath"` // Optional, e.g., "my/docs"
 		Description string `json:"description"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		api.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
+		return
+	}
+	req.UserID = userID
+
 	if req.UserID == "" || req.FolderName == "" {
-		http.Error(w, "Missing userId or folderName", http.StatusBadRequest)
+		api.Error(w, "Missing userId or folderName", http.StatusBadRequest)
+		return
+	}
+	if req.FolderName == "." || req.FolderName == ".." || strings.Contains(req.FolderName, "/") {
+		api.Error(w, "Invalid folderName", http.StatusBadRequest)
 		return
 	}
 
+	// Resolve the parent folder: by ID, or by the path older clients send
+	var parentID string
+	parentPath := strings.TrimSuffix(req.ParentPath, "/")
+	if req.ParentID != "" {
+		parent, err := s.store.File(ctx, req.ParentID)
+		if err == nil && (parent.OwnerID != req.UserID || parent.FileType != "folder" || parent.DeletedAt != nil) {
+			err = store.ErrNotFound
+		}
+		if errors.Is(err, store.ErrNotFound) {
+			api.Error(w, "Parent folder not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to look up parent folder", "err", err)
+			api.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		parentID, parentPath = parent.ID, parent.CID
+	} else if parentPath != "" {
+		parent, err := s.store.FolderByPath(ctx, req.UserID, parentPath)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			logger.Error("Failed to look up parent folder", "err", err)
+			api.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		parentID = parent.ID
+	}
+
 	// Construct full CID for folder path
 	var fullCID string
-	if req.ParentPath != "" {
-    fullCID = fmt.Sprintf("%s/%s", strings.TrimSuffix(req.ParentPath, "/"), req.FolderName)
+	if parentPath != "" {
+    fullCID = fmt.Sprintf("%s/%s", parentPath, req.FolderName)
     } else {
        fullCID = req.FolderName
    }
 
-	// Insert folder metadata (no file content, just metadata)
-	var folderID string
-	err := DB.QueryRow(`
-		INSERT INTO files (
-			owner_id, file_name, file_type, file_size, cid, nonce, description, tags, created_at
-		) VALUES ($1, $2, 'folder', 0, $3, '', $4, $5, NOW())
-		RETURNING id
-	`,
-		req.UserID,
-		req.FolderName,
-		fullCID,
-		req.Description,
-		pq.Array([]string{"folder"}),
-	).Scan(&folderID)
+	// Insert folder metadata (no file content, just metadata), unless the
+	// parent already holds something with that name
+	folderID, err := s.store.AddFolder(ctx, store.File{
+		OwnerID:     req.UserID,
+		FileName:    req.FolderName,
+		CID:         fullCID,
+		Description: req.Description,
+		Tags:        []string{"folder"},
+		ParentID:    parentID,
+	})
 
+	if errors.Is(err, store.ErrNameTaken) {
+		api.Error(w, "A file or folder with that name already exists", http.StatusConflict)
+		return
+	}
 	if err != nil {
-		log.Println("Failed to insert folder:", err)
-		http.Error(w, "Failed to create folder", http.StatusInternalServerError)
+		logger.Error("Failed to insert folder", "err", err)
+		api.Error(w, "Failed to create folder", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]string{
 		"folderId": folderID,
+		"parentId": parentID,
 		"cid":      fullCID,
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
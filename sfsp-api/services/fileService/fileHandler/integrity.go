@@ -0,0 +1,234 @@
+package fileHandler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metrics"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+)
+
+// Download verification modes. In trailer mode the blob is streamed straight
+// away and the computed hash is sent as an HTTP trailer for the client to
+// check. In pre mode the blob is read and verified in full before any bytes
+// are sent, so a corrupted file is never delivered.
+const (
+	VerifyModeTrailer = "trailer"
+	VerifyModePre     = "pre"
+)
+
+// Trailer and header names used by verified downloads.
+const (
+	HeaderExpectedHash = "X-Expected-Hash"
+	TrailerFileHash    = "X-File-Hash"
+	TrailerIntegrity   = "X-Integrity"
+)
+
+// Values sent in the X-Integrity trailer.
+const (
+	IntegrityVerified   = "verified"
+	IntegrityMismatch   = "mismatch"
+	IntegrityUnverified = "unverified"
+)
+
+var errIntegrity = errors.New("integrity check failed")
+
+// IntegrityFailure describes a blob whose contents no longer match the hash
+// recorded when it was stored.
+type IntegrityFailure struct {
+	FileID   string
+	OwnerID  string
+	Path     string
+	Expected string
+	Computed string
+}
+
+// logIntegrityFailure is the default Config.OnIntegrityFailure.
+func logIntegrityFailure(f IntegrityFailure) {
+	slog.Error("Integrity check failed",
+		"file_id", f.FileID, "owner_id", f.OwnerID, "path", f.Path, "expected", f.Expected, "computed", f.Computed)
+}
+
+// integrityTarget identifies what a download is verified against: either a
+// files row (FileID) or a blob recorded in blob_hashes (Path).
+type integrityTarget struct {
+	fileID    string
+	ownerID   string
+	path      string
+	expected  string
+	corrupted bool
+}
+
+func (s *Server) verifyModeFor(r *http.Request) string {
+	mode := r.URL.Query().Get("verify")
+	if mode == "" {
+		mode = r.Header.Get("X-Verify-Mode")
+	}
+	switch strings.ToLower(mode) {
+	case VerifyModePre:
+		return VerifyModePre
+	case VerifyModeTrailer:
+		return VerifyModeTrailer
+	default:
+		return s.cfg.VerifyMode
+	}
+}
+
+func normaliseBlobPath(p string) string {
+	return strings.TrimLeft(p, "/")
+}
+
+// splitBlobPath returns the segments of a blob path taken from a request. It
+// reports false for paths with empty, "." or ".." segments, which could name
+// a different blob once the storage backend cleans them.
+func splitBlobPath(p string) ([]string, bool) {
+	if strings.Contains(p, "\x00") {
+		return nil, false
+	}
+	parts := strings.Split(normaliseBlobPath(p), "/")
+	for _, part := range parts {
+		if part == "" || part == "." || part == ".." {
+			return nil, false
+		}
+	}
+	return parts, true
+}
+
+// recordBlobHash stores the SHA-256 and size of a blob written outside the
+// files table (sent and view-only copies) so later downloads can be verified
+// and served in ranges.
+func (s *Server) recordBlobHash(ctx context.Context, path, fileID, hashHex string, size int64) error {
+	return s.store.RecordBlobHash(ctx, store.BlobHash{
+		Path:   normaliseBlobPath(path),
+		FileID: fileID,
+		SHA256: hashHex,
+		Size:   size,
+	})
+}
+
+// blobTarget loads the recorded hash and size for a blob. Blobs stored
+// before hashes were recorded have no row; they are served unverified and
+// their size is reported as -1.
+func (s *Server) blobTarget(ctx context.Context, path string) (integrityTarget, int64, error) {
+	target := integrityTarget{path: normaliseBlobPath(path)}
+	b, err := s.store.BlobHash(ctx, target.path)
+	if errors.Is(err, store.ErrNotFound) {
+		return target, -1, nil
+	}
+	if err != nil {
+		return target, -1, err
+	}
+	target.fileID = b.FileID
+	target.expected = b.SHA256
+	target.corrupted = b.CorruptedAt != nil
+	return target, b.Size, nil
+}
+
+// markCorrupted flags the target in the database and raises an alert.
+func (s *Server) markCorrupted(ctx context.Context, t integrityTarget, computed string) {
+	logger := logging.FromContext(ctx)
+	var err error
+	if t.path != "" {
+		metrics.HashMismatches.With("copy").Inc()
+		err = s.store.MarkBlobCorrupted(ctx, t.path)
+	} else {
+		metrics.HashMismatches.With("file").Inc()
+		err = s.store.MarkFileCorrupted(ctx, t.fileID)
+	}
+	if err != nil {
+		logger.Error("Failed to mark file as corrupted", "err", err)
+	}
+
+	if t.fileID != "" && t.ownerID != "" {
+		err = s.store.AddAccessLog(ctx, store.AccessLog{
+			FileID:  t.fileID,
+			UserID:  t.ownerID,
+			Action:  "integrity_failed",
+			Message: fmt.Sprintf("Stored file failed hash verification (expected %s, got %s)", t.expected, computed),
+		})
+		if err != nil {
+			logger.Error("Failed to log integrity failure", "err", err)
+		}
+	}
+
+	s.cfg.OnIntegrityFailure(IntegrityFailure{
+		FileID:   t.fileID,
+		OwnerID:  t.ownerID,
+		Path:     t.path,
+		Expected: t.expected,
+		Computed: computed,
+	})
+}
+
+// preVerify reads the whole blob and compares its hash before anything is
+// sent. It returns errIntegrity (after marking the file) on a mismatch.
+func (s *Server) preVerify(ctx context.Context, t integrityTarget, open func() (io.ReadCloser, error)) error {
+	logger := logging.FromContext(ctx)
+	if t.expected == "" {
+		return nil
+	}
+	stream, err := open()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := stream.Close(); err != nil {
+			logger.Warn("Failed to close stream", "err", err)
+		}
+	}()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, stream); err != nil {
+		return err
+	}
+	computed := hex.EncodeToString(hasher.Sum(nil))
+	if computed != t.expected {
+		s.markCorrupted(ctx, t, computed)
+		return errIntegrity
+	}
+	return nil
+}
+
+// declareIntegrityTrailers announces the verification trailers. It must be
+// called before WriteHeader.
+func declareIntegrityTrailers(w http.ResponseWriter, t integrityTarget) {
+	if t.expected != "" {
+		w.Header().Set(HeaderExpectedHash, t.expected)
+	}
+	w.Header().Set("Trailer", TrailerFileHash+", "+TrailerIntegrity)
+}
+
+// copyVerified streams src to w while hashing it and then sets the
+// verification trailers, marking the file as corrupted on a mismatch.
+func (s *Server) copyVerified(ctx context.Context, w http.ResponseWriter, src io.Reader, t integrityTarget) (string, error) {
+	hasher := sha256.New()
+	buf := make([]byte, 32*1024)
+	n, err := io.CopyBuffer(w, io.TeeReader(src, hasher), buf)
+	metrics.DownloadedBytes.Add(float64(n))
+	if err != nil {
+		return "", err
+	}
+
+	computed := hex.EncodeToString(hasher.Sum(nil))
+	w.Header().Set(TrailerFileHash, computed)
+
+	switch {
+	case t.expected == "":
+		w.Header().Set(TrailerIntegrity, IntegrityUnverified)
+	case computed != t.expected:
+		logging.FromContext(ctx).Warn("Hash mismatch", "file_id", t.fileID, "path", t.path, "expected", t.expected, "computed", computed)
+		w.Header().Set(TrailerIntegrity, IntegrityMismatch)
+		s.markCorrupted(ctx, t, computed)
+	default:
+		w.Header().Set(TrailerIntegrity, IntegrityVerified)
+	}
+	return computed, nil
+}
@@ -0,0 +1,256 @@
+// quota.go
+package fileHandler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+)
+
+// DefaultQuotaTier is the tier of users who were never assigned one. Without
+// a quota_tiers row of that name such users are unlimited.
+const DefaultQuotaTier = "default"
+
+// StorageUsage breaks down the bytes stored for a user.
+type StorageUsage struct {
+	Files      int64 `json:"files"` // vault files, including the trash
+	Versions   int64 `json:"versions"`
+	Sent       int64 `json:"sent"`       // copies sent to other users
+	ViewShares int64 `json:"viewShares"` // view-only copies
+	Links      int64 `json:"links"`      // copies behind active share links
+	Uploads    int64 `json:"uploads"`    // reserved by unfinished uploads
+}
+
+// Total is the number of bytes that count against the quota.
+func (u StorageUsage) Total() int64 {
+	return u.Files + u.Versions + u.Sent + u.ViewShares + u.Links + u.Uploads
+}
+
+// Quota is a user's storage limit and current usage. A nil LimitBytes means
+// the user is unlimited.
+type Quota struct {
+	UserID         string       `json:"userId"`
+	Tier           string       `json:"tier"`
+	LimitBytes     *int64       `json:"limitBytes"`
+	UsedBytes      int64        `json:"usedBytes"`
+	RemainingBytes *int64       `json:"remainingBytes"`
+	Usage          StorageUsage `json:"usage"`
+}
+
+// Allows reports whether n more bytes fit in the quota.
+func (q Quota) Allows(n int64) bool {
+	return q.LimitBytes == nil || q.UsedBytes+n <= *q.LimitBytes
+}
+
+// QuotaTier is a named storage limit administrators assign to users.
+type QuotaTier struct {
+	Name       string `json:"name"`
+	LimitBytes *int64 `json:"limitBytes"`
+}
+
+// LoadQuota reads a user's limit and adds up what they store. The limit is
+// the user's own override if set, else that of their tier.
+func (s *Server) LoadQuota(ctx context.Context, userID string) (Quota, error) {
+	q := Quota{UserID: userID}
+
+	tier, err := s.store.UserQuota(ctx, userID, DefaultQuotaTier)
+	if err != nil {
+		return Quota{}, err
+	}
+	q.Tier = tier.Name
+
+	usage, err := s.store.StorageUsage(ctx, userID)
+	if err != nil {
+		return Quota{}, err
+	}
+	q.Usage = StorageUsage(usage)
+
+	q.UsedBytes = q.Usage.Total()
+	if tier.LimitBytes != nil {
+		remaining := max(*tier.LimitBytes-q.UsedBytes, 0)
+		q.LimitBytes, q.RemainingBytes = tier.LimitBytes, &remaining
+	}
+	return q, nil
+}
+
+// ensureQuota answers 413 unless n more bytes fit in the user's quota. The
+// caller must return when it reports false.
+func (s *Server) ensureQuota(ctx context.Context, w http.ResponseWriter, userID string, n int64) bool {
+	logger := logging.FromContext(ctx)
+	q, err := s.quota(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to load storage quota", "err", err)
+		api.Error(w, "Failed to check storage quota", http.StatusInternalServerError)
+		return false
+	}
+	if !q.Allows(n) {
+		logger.Info("Storage quota exceeded", "user_id", userID, "used", q.UsedBytes, "requested", n)
+		api.ErrorCode(w, fmt.Sprintf("Storage quota exceeded: %d of %d bytes used", q.UsedBytes, *q.LimitBytes),
+			http.StatusRequestEntityTooLarge, api.CodeQuotaExceeded)
+		return false
+	}
+	return true
+}
+
+// ensureCopyQuota checks a chunk of a copy made for sharing (a sent file, a
+// view-only copy or a share link). Copies are only recorded once assembled,
+// so every chunk is checked against an estimate of the whole copy.
+func (s *Server) ensureCopyQuota(ctx context.Context, w http.ResponseWriter, userID string, chunkSize int64, totalChunks int) bool {
+	return s.ensureQuota(ctx, w, userID, chunkSize*int64(max(totalChunks, 1)))
+}
+
+// StorageUsageHandler reports the caller's usage against their quota.
+// Administrators may ask about any user with ?userId=.
+func (s *Server) StorageUsageHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	userID := r.URL.Query().Get("userId")
+	if user, ok := auth.UserFromContext(r.Context()); !ok || !user.IsAdmin() {
+		var allowed bool
+		if userID, allowed = auth.ResolveUserID(w, r, userID); !allowed {
+			return
+		}
+	} else if userID == "" {
+		userID = user.ID
+	}
+	if userID == "" {
+		api.Error(w, "Missing userId", http.StatusBadRequest)
+		return
+	}
+
+	q, err := s.quota(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to load storage quota", "err", err)
+		api.Error(w, "Failed to load storage usage", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(q); err != nil {
+		logger.Warn("Failed to encode response", "err", err)
+	}
+}
+
+func (s *Server) ListQuotaTiersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	stored, err := s.store.QuotaTiers(ctx)
+	if err != nil {
+		logger.Error("Failed to list quota tiers", "err", err)
+		api.Error(w, "Failed to list quota tiers", http.StatusInternalServerError)
+		return
+	}
+	tiers := make([]QuotaTier, len(stored))
+	for i, t := range stored {
+		tiers[i] = QuotaTier(t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tiers); err != nil {
+		logger.Warn("Failed to encode response", "err", err)
+	}
+}
+
+// SetQuotaTierHandler creates a tier or changes its limit. A null limitBytes
+// makes the tier unlimited.
+func (s *Server) SetQuotaTierHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	if !auth.RequireAdmin(w, r) {
+		return
+	}
+
+	var tier QuotaTier
+	if err := json.NewDecoder(r.Body).Decode(&tier); err != nil {
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	if tier.Name == "" {
+		api.Error(w, "Missing tier name", http.StatusBadRequest)
+		return
+	}
+	if tier.LimitBytes != nil && *tier.LimitBytes < 0 {
+		api.Error(w, "limitBytes must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.store.SetQuotaTier(ctx, store.QuotaTier(tier)); err != nil {
+		logger.Error("Failed to save quota tier", "err", err)
+		api.Error(w, "Failed to save quota tier", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Quota tier saved", "tier", tier.Name)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tier); err != nil {
+		logger.Warn("Failed to encode response", "err", err)
+	}
+}
+
+// SetUserQuotaHandler assigns a user to a tier, optionally with a limit of
+// their own that overrides the tier's. An empty tier means the default tier.
+func (s *Server) SetUserQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	if !auth.RequireAdmin(w, r) {
+		return
+	}
+
+	var req struct {
+		UserID     string `json:"userId"`
+		Tier       string `json:"tier"`
+		LimitBytes *int64 `json:"limitBytes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == "" {
+		api.Error(w, "Missing userId", http.StatusBadRequest)
+		return
+	}
+	if req.LimitBytes != nil && *req.LimitBytes < 0 {
+		api.Error(w, "limitBytes must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	// the default tier is stored as no tier, so it follows DefaultQuotaTier
+	var tier string
+	if req.Tier != "" && req.Tier != DefaultQuotaTier {
+		exists, err := s.store.QuotaTierExists(ctx, req.Tier)
+		if err != nil {
+			logger.Error("Failed to look up quota tier", "err", err)
+			api.Error(w, "Failed to save user quota", http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			api.Error(w, "Quota tier not found", http.StatusNotFound)
+			return
+		}
+		tier = req.Tier
+	}
+
+	if err := s.store.SetUserQuota(ctx, req.UserID, tier, req.LimitBytes); err != nil {
+		logger.Error("Failed to save user quota", "err", err)
+		api.Error(w, "Failed to save user quota", http.StatusInternalServerError)
+		return
+	}
+
+	q, err := s.quota(ctx, req.UserID)
+	if err != nil {
+		logger.Error("Failed to load storage quota", "err", err)
+		api.Error(w, "Failed to load storage usage", http.StatusInternalServerError)
+		return
+	}
+	logger.Info("User quota set", "user_id", req.UserID, "tier", q.Tier)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(q); err != nil {
+		logger.Warn("Failed to encode response", "err", err)
+	}
+}
@@ -3,87 +3,107 @@ package fileHandler
 
 import (
 	"crypto/sha256"
-	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"strconv"
-	"time"
 
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metrics"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
 )
 
-func SendByViewHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("==== New SendByView Request ====")
+func (s *Server) SendByViewHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 
-	err := r.ParseMultipartForm(50 << 20)
+	err := s.parseMultipartForm(ctx, r)
 	if err != nil {
-		log.Println("Failed to parse multipart form:", err)
-		http.Error(w, "Invalid multipart form", http.StatusBadRequest)
+		logger.Warn("Failed to parse multipart form", "err", err)
+		api.Error(w, "Invalid multipart form", http.StatusBadRequest)
 		return
 	}
 
 	fileID := r.FormValue("fileid")
-	userID := r.FormValue("userId")
+	userID, ok := auth.ResolveUserID(w, r, r.FormValue("userId"))
+	if !ok {
+		return
+	}
 	recipientID := r.FormValue("recipientUserId")
 	metadataJSON := r.FormValue("metadata")
 	chunkIndexStr := r.FormValue("chunkIndex")
 	totalChunksStr := r.FormValue("totalChunks")
 
 	if fileID == "" || userID == "" || recipientID == "" || metadataJSON == "" {
-		http.Error(w, "Missing required form fields", http.StatusBadRequest)
+		api.Error(w, "Missing required form fields", http.StatusBadRequest)
+		return
+	}
+
+	expiresAt, err := s.shareExpiry(r.FormValue("expiresIn"), r.FormValue("expiresAt"), s.now())
+	if err != nil {
+		api.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	chunkIndex, err := strconv.Atoi(chunkIndexStr)
 	if err != nil {
-		http.Error(w, "Invalid chunkIndex", http.StatusBadRequest)
+		api.Error(w, "Invalid chunkIndex", http.StatusBadRequest)
 		return
 	}
 	totalChunks, err := strconv.Atoi(totalChunksStr)
 	if err != nil {
-		http.Error(w, "Invalid totalChunks", http.StatusBadRequest)
+		api.Error(w, "Invalid totalChunks", http.StatusBadRequest)
 		return
 	}
 
-	var ownerID string
-	err = DB.QueryRow("SELECT owner_id FROM files WHERE id = $1", fileID).Scan(&ownerID)
+	ownerID, err := s.store.FileOwner(ctx, fileID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "File not found", http.StatusNotFound)
+		if errors.Is(err, store.ErrNotFound) {
+			api.Error(w, "File not found", http.StatusNotFound)
 			return
 		}
-		log.Println("Database error:", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		logger.Error("Database error", "err", err)
+		api.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
 	if ownerID != userID {
-		http.Error(w, "Unauthorized: You don't own this file", http.StatusForbidden)
+		api.Error(w, "Unauthorized: You don't own this file", http.StatusForbidden)
 		return
 	}
 
-	file, _, err := r.FormFile("encryptedFile")
+	file, header, err := r.FormFile("encryptedFile")
 	if err != nil {
-		log.Println("Failed to get encrypted file chunk:", err)
-		http.Error(w, "Missing encrypted file chunk", http.StatusBadRequest)
+		logger.Error("Failed to get encrypted file chunk", "err", err)
+		api.Error(w, "Missing encrypted file chunk", http.StatusBadRequest)
 		return
 	}
 	defer func() {
 		if err := file.Close(); err != nil {
-			log.Println("error closing file:", err)
+			logger.Warn("Failed to close file", "err", err)
 		}
 	}()
 
+	if !s.checkChunkLimits(w, totalChunks, header.Size) {
+		return
+	}
+
+	if !s.ensureCopyQuota(ctx, w, userID, header.Size, totalChunks) {
+		return
+	}
+
 	tempChunkName := fmt.Sprintf("%s_chunk_%d", fileID, chunkIndex)
-	if err := owncloud.UploadFileStream("temp", tempChunkName, file); err != nil {
-		log.Println("OwnCloud temp chunk upload failed:", err)
-		http.Error(w, "Chunk upload failed", http.StatusInternalServerError)
+	if err := s.blobs.UploadFileStream(ctx, "temp", tempChunkName, file); err != nil {
+		logger.Error("OwnCloud temp chunk upload failed", "err", err)
+		api.Error(w, "Chunk upload failed", http.StatusInternalServerError)
 		return
 	}
+	metrics.UploadedBytes.With(metrics.KindView).Add(float64(header.Size))
 
 	if chunkIndex != totalChunks-1 {
 		w.Header().Set("Content-Type", "application/json")
@@ -91,106 +111,109 @@ func SendByViewHandler(w http.ResponseWriter, r *http.Request) {
 			"message": fmt.Sprintf("Chunk %d uploaded", chunkIndex),
 			"fileId":  fileID,
 		}); err != nil {
-			log.Println("Failed to encode response:", err)
+			logger.Warn("Failed to encode response", "err", err)
 		}
 		return
 	}
 
 	sharedFileKey := fmt.Sprintf("%s_%s", fileID, recipientID)
 	targetPath := fmt.Sprintf("files/%s/shared_view", userID)
-	log.Printf("🔗 Merging chunks into shared_view path: %s/%s", targetPath, sharedFileKey)
+	logger.Debug("Merging chunks", "file_id", fileID, "path", targetPath+"/"+sharedFileKey)
+	mergeCtx, finishMerge := startMerge(ctx, metrics.KindView)
+	defer finishMerge(false)
 
 	finalReader, finalWriter := io.Pipe()
 	go func() {
 		defer func() {
 			if err := finalWriter.Close(); err != nil {
-				log.Println("error closing final writer:", err)
+				logger.Warn("Failed to close final writer", "err", err)
 			}
 		}()
 
 		for i := 0; i < totalChunks; i++ {
 			chunkPath := fmt.Sprintf("temp/%s_chunk_%d", fileID, i)
-			reader, err := owncloud.DownloadFileStreamTemp(chunkPath)
+			reader, err := s.blobs.DownloadFileStreamTemp(mergeCtx, chunkPath)
 			if err != nil {
-				log.Println("Failed to download temp chunk:", err)
+				logger.Error("Failed to download temp chunk", "err", err)
 				finalWriter.CloseWithError(err)
 				return
 			}
 
 			if _, err := io.Copy(finalWriter, reader); err != nil {
-				log.Println("Failed to copy chunk to final writer:", err)
+				logger.Error("Failed to copy chunk to final writer", "err", err)
 				if err := reader.Close(); err != nil {
-					log.Println("error closing reader:", err)
+					logger.Warn("Failed to close reader", "err", err)
 				}
 				finalWriter.CloseWithError(err)
 				return
 			}
 			if err := reader.Close(); err != nil {
-				log.Println("error closing reader:", err)
+				logger.Warn("Failed to close reader", "err", err)
 			}
-			if err := owncloud.DeleteFileTemp(chunkPath); err != nil {
-				log.Println("Failed to cleanup chunk:", err)
+			if err := s.blobs.DeleteFileTemp(mergeCtx, chunkPath); err != nil {
+				logger.Warn("Failed to clean up chunk", "err", err)
 			}
 		}
 
-		log.Println("Finished merging chunks for view-only share:", sharedFileKey)
 	}()
 
-	if err := owncloud.UploadFileStream(targetPath, sharedFileKey, finalReader); err != nil {
-		log.Println("OwnCloud final upload failed:", err)
-		http.Error(w, "Failed to store encrypted file", http.StatusInternalServerError)
+	hasher := sha256.New()
+	counter := &CountingWriter{w: hasher}
+	if err := s.blobs.UploadFileStream(mergeCtx, targetPath, sharedFileKey, io.TeeReader(finalReader, counter)); err != nil {
+		logger.Error("OwnCloud final upload failed", "err", err)
+		api.Error(w, "Failed to store encrypted file", http.StatusInternalServerError)
 		return
 	}
+	finishMerge(true)
+	if err := s.recordBlobHash(ctx, targetPath+"/"+sharedFileKey, fileID, hex.EncodeToString(hasher.Sum(nil)), counter.Count); err != nil {
+		logger.Error("Failed to record view file hash", "err", err)
+	}
 
-	var existingID string
-	err = DB.QueryRow(`
-        SELECT id FROM shared_files_view 
-        WHERE sender_id = $1 AND recipient_id = $2 AND file_id = $3 AND revoked = FALSE
-    `, userID, recipientID, fileID).Scan(&existingID)
+	existing, err := s.store.ActiveViewShare(ctx, userID, recipientID, fileID)
 
 	var shareID string
-	switch err {
-	case nil:
-		_, err = DB.Exec(`
-            UPDATE shared_files_view 
-            SET metadata = $1, shared_at = CURRENT_TIMESTAMP, expires_at = $2
-            WHERE id = $3
-        `, metadataJSON, time.Now().Add(48*time.Hour), existingID)
-		if err != nil {
-			log.Println("Failed to update shared file:", err)
-			http.Error(w, "Failed to update shared file", http.StatusInternalServerError)
+	switch {
+	case err == nil:
+		if err := s.store.RenewViewShare(ctx, existing.ID, metadataJSON, expiryRef(expiresAt)); err != nil {
+			logger.Error("Failed to update shared file", "err", err)
+			api.Error(w, "Failed to update shared file", http.StatusInternalServerError)
 			return
 		}
-		shareID = existingID
-	case sql.ErrNoRows:
-		err = DB.QueryRow(`
-            INSERT INTO shared_files_view (sender_id, recipient_id, file_id, newfile_id, metadata, expires_at)
-            VALUES ($1, $2, $3, $4, $5, $6)
-            RETURNING id
-        `, userID, recipientID, fileID, fileID, metadataJSON, time.Now().Add(48*time.Hour)).Scan(&shareID)
+		shareID = existing.ID
+	case errors.Is(err, store.ErrNotFound):
+		shareID, err = s.store.AddViewShare(ctx, store.ViewShare{
+			SenderID:      userID,
+			RecipientID:   recipientID,
+			FileID:        fileID,
+			NewFileID:     fileID,
+			Metadata:      metadataJSON,
+			ExpiresAt:     expiryRef(expiresAt),
+			AccessGranted: true,
+		})
 		if err != nil {
-			log.Println("Failed to insert shared file view:", err)
-			http.Error(w, "Failed to track shared file", http.StatusInternalServerError)
+			logger.Error("Failed to insert shared file view", "err", err)
+			api.Error(w, "Failed to track shared file", http.StatusInternalServerError)
 			return
 		}
 	default:
-		log.Println("Database error:", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		logger.Error("Database error", "err", err)
+		api.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
-	_, err = DB.Exec("UPDATE files SET allow_view_sharing = TRUE WHERE id = $1", fileID)
-	if err != nil {
-		log.Println("Failed to update file view sharing flag:", err)
+	if err := s.store.EnableViewSharing(ctx, fileID); err != nil {
+		logger.Error("Failed to update file view sharing flag", "err", err)
 	}
 
-	_, err = DB.Exec(`
-        INSERT INTO access_logs (file_id, user_id, action, message, view_only)
-        VALUES ($1, $2, $3, $4, $5)
-    `, fileID, userID, "shared_view",
-		fmt.Sprintf("File shared with user %s for view-only access", recipientID), true)
+	err = s.store.AddAccessLog(ctx, store.AccessLog{
+		FileID:   fileID,
+		UserID:   userID,
+		Action:   "shared_view",
+		Message:  fmt.Sprintf("File shared with user %s for view-only access", recipientID),
+		ViewOnly: true,
+	})
 	if err != nil {
-		log.Println("Failed to log sharing action:", err)
+		logger.Error("Failed to log sharing action", "err", err)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -198,329 +221,291 @@ func SendByViewHandler(w http.ResponseWriter, r *http.Request) {
 		"message": "File shared for view-only access successfully",
 		"shareId": shareID,
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
-	log.Println("File shared for view-only access successfully, shareId:", shareID)
+	logger.Info("File shared for view-only access", "file_id", fileID, "share_id", shareID)
 }
 
-func RevokeViewAccessHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) RevokeViewAccessHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	var req struct {
 		FileID      string `json:"fileId"`
 		UserID      string `json:"userId"`
 		RecipientID string `json:"recipientId"`
 	}
 
-	// pretty print the request in the color blue
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		api.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("\033[34mRevoke view access request: %+v\033[0m\n", req)
+	logger.Debug("Revoking view access", "file_id", req.FileID, "recipient_id", req.RecipientID)
+
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
+		return
+	}
+	req.UserID = userID
 
 	if req.FileID == "" || req.UserID == "" || req.RecipientID == "" {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		api.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
 
-	var ownerID string
-	err := DB.QueryRow("SELECT owner_id FROM files WHERE id = $1", req.FileID).Scan(&ownerID)
+	ownerID, err := s.store.FileOwner(ctx, req.FileID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "File not found", http.StatusNotFound)
+		if errors.Is(err, store.ErrNotFound) {
+			api.Error(w, "File not found", http.StatusNotFound)
 			return
 		}
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		api.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
 	if ownerID != req.UserID {
-		http.Error(w, "Unauthorized", http.StatusForbidden)
+		api.Error(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
 
-	// Get the newfile_id before revoking so we can delete the file
-	var newFileID string
-	err = DB.QueryRow(`
-		SELECT newfile_id FROM shared_files_view 
-		WHERE sender_id = $1 AND recipient_id = $2 AND file_id = $3 AND revoked = FALSE
-	`, req.UserID, req.RecipientID, req.FileID).Scan(&newFileID)
-
+	share, err := s.store.RevokeViewShare(ctx, req.UserID, req.RecipientID, req.FileID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "No active sharing found to revoke", http.StatusNotFound)
+		if errors.Is(err, store.ErrNotFound) {
+			api.Error(w, "No active sharing found to revoke", http.StatusNotFound)
 			return
 		}
-		log.Println("Failed to get newfile_id:", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		logger.Error("Failed to revoke access", "err", err)
+		api.Error(w, "Failed to revoke access", http.StatusInternalServerError)
 		return
 	}
 
-	// Revoke access
-	result, err := DB.Exec(`
-		UPDATE shared_files_view 
-		SET revoked = TRUE, revoked_at = CURRENT_TIMESTAMP, access_granted = FALSE
-		WHERE sender_id = $1 AND recipient_id = $2 AND file_id = $3 AND revoked = FALSE
-	`, req.UserID, req.RecipientID, req.FileID)
-
-	if err != nil {
-		log.Println("Failed to revoke access:", err)
-		http.Error(w, "Failed to revoke access", http.StatusInternalServerError)
-		return
-	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "No active sharing found to revoke", http.StatusNotFound)
-		return
-	}
-
-	// Delete the shared view file entry and the actual file from storage
-	if newFileID != "" {
-		_, err = DB.Exec("DELETE FROM files WHERE id = $1", newFileID)
-		if err != nil {
-			log.Println("Failed to delete new file entry:", err)
+	// Delete the recipient's re-encrypted copy. Until one is made the share
+	// points at the sender's own file, which must stay.
+	if share.NewFileID != "" && share.NewFileID != req.FileID {
+		if err := s.store.DeleteFile(ctx, share.NewFileID); err != nil {
+			logger.Error("Failed to delete new file entry", "err", err)
 		}
 	}
 
-	_, err = DB.Exec(`
-		INSERT INTO access_logs (file_id, user_id, action, message, view_only)
-		VALUES ($1, $2, $3, $4, $5)
-	`, req.FileID, req.UserID, "revoked_view", fmt.Sprintf("View access revoked for user %s", req.RecipientID), true)
+	err = s.store.AddAccessLog(ctx, store.AccessLog{
+		FileID:   req.FileID,
+		UserID:   req.UserID,
+		Action:   "revoked_view",
+		Message:  fmt.Sprintf("View access revoked for user %s", req.RecipientID),
+		ViewOnly: true,
+	})
 	if err != nil {
-		log.Println("Failed to log revoke action:", err)
+		logger.Error("Failed to log revoke action", "err", err)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]string{
 		"message": "View access revoked successfully",
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
-func GetSharedViewFilesHandler(w http.ResponseWriter, r *http.Request) {
+// sharedViewListing orders the view-only shares a user sent or received.
+var sharedViewListing = api.Listing{
+	Sorts: map[string]string{
+		"sharedAt": "svf.shared_at",
+		"name":     "lower(f.file_name)",
+	},
+	ID:           "svf.id",
+	DefaultSort:  "sharedAt",
+	DefaultOrder: "desc",
+}
+
+func (s *Server) GetSharedViewFilesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	var req struct {
 		UserID string `json:"userId"`
+		api.PageRequest
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		api.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
 		return
 	}
+	req.UserID = userID
 
 	if req.UserID == "" {
-		http.Error(w, "Missing userId", http.StatusBadRequest)
+		api.Error(w, "Missing userId", http.StatusBadRequest)
 		return
 	}
 
-	rows, err := DB.Query(`
-		SELECT svf.id, svf.sender_id, svf.recipient_id, svf.file_id, svf.metadata, svf.shared_at, svf.expires_at,
-			   f.file_name, f.file_type, f.file_size, f.description
-		FROM shared_files_view svf
-		JOIN files f ON svf.file_id = f.id
-		WHERE (svf.recipient_id = $1 OR svf.sender_id = $1) 
-		  AND svf.revoked = FALSE 
-		  AND svf.access_granted = TRUE
-		  AND (svf.expires_at IS NULL OR svf.expires_at > CURRENT_TIMESTAMP)
-		ORDER BY svf.shared_at DESC
-	`, req.UserID)
+	page, err := sharedViewListing.Page(r, req.PageRequest)
+	if err != nil {
+		api.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
+	shares, err := s.store.ListViewShares(ctx, req.UserID, page)
 	if err != nil {
-		log.Println("Failed to get shared view files:", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		logger.Error("Failed to get shared view files", "err", err)
+		api.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Println("error closing rows:", err)
-		}
-	}()
 
 	var files []map[string]interface{}
-	for rows.Next() {
-		var (
-			shareID, senderID, recipientID, fileID, fileName, fileType, description string
-			fileSize                                                                int64
-			metadata                                                                string
-			sharedAt                                                                time.Time
-			expiresAtPtr                                                            *time.Time
-		)
-		err := rows.Scan(
-			&shareID, &senderID, &recipientID, &fileID, &metadata,
-			&sharedAt, &expiresAtPtr, &fileName, &fileType,
-			&fileSize, &description,
-		)
-		if err != nil {
-			log.Println("Failed to scan row:", err)
-			continue
-		}
-
+	for _, v := range shares {
 		file := map[string]interface{}{
-			"share_id":     shareID,
-			"sender_id":    senderID,
-			"recipient_id": recipientID,
-			"file_id":      fileID,
-			"metadata":     metadata,
-			"shared_at":    sharedAt,
-			"file_name":    fileName,
-			"file_type":    fileType,
-			"file_size":    fileSize,
-			"description":  description,
+			"share_id":     v.Share.ID,
+			"sender_id":    v.Share.SenderID,
+			"recipient_id": v.Share.RecipientID,
+			"file_id":      v.Share.FileID,
+			"metadata":     v.Share.Metadata,
+			"shared_at":    v.Share.SharedAt,
+			"file_name":    v.File.FileName,
+			"file_type":    v.File.FileType,
+			"file_size":    v.File.FileSize,
+			"description":  v.File.Description,
 			"view_only":    true,
 		}
-		if expiresAtPtr != nil {
-			file["expires_at"] = *expiresAtPtr
+		if v.Share.ExpiresAt != nil {
+			file["expires_at"] = *v.Share.ExpiresAt
 		}
 
 		files = append(files, file)
 	}
 
+	page.Finish(w)
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(files); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
-func GetViewFileAccessLogs(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetViewFileAccessLogs(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	var req struct {
 		FileID string `json:"fileId"`
 		UserID string `json:"userId"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		api.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
-	rows, err := DB.Query(`
-		SELECT id, action, message, timestamp
-		FROM access_logs
-		WHERE file_id = $1 AND user_id = $2 AND view_only = TRUE
-		ORDER BY timestamp DESC
-		`, req.FileID, req.UserID)
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
+		return
+	}
+	req.UserID = userID
 
+	entries, err := s.store.ListViewAccessLogs(ctx, req.FileID, req.UserID)
 	if err != nil {
-		log.Println("Failed to query access logs", err)
-		http.Error(w, "Database Error", http.StatusInternalServerError)
+		logger.Error("Failed to query access logs", "err", err)
+		api.Error(w, "Database Error", http.StatusInternalServerError)
 		return
 	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Println("error closing rows:", err)
-		}
-	}()
 
 	var logs []map[string]interface{}
-	for rows.Next() {
-		var id, action, message string
-		var timestamp time.Time
-
-		if err := rows.Scan(&id, &action, &message, &timestamp); err != nil {
-			log.Println("Failed to scan access log:", err)
-			continue
-		}
-
+	for _, l := range entries {
 		logs = append(logs, map[string]interface{}{
-			"id":        id,
-			"action":    action,
-			"message":   message,
-			"timestamp": timestamp,
+			"id":        l.ID,
+			"action":    l.Action,
+			"message":   l.Message,
+			"timestamp": l.Timestamp,
 		})
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(logs); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
-func DownloadViewFileHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) DownloadViewFileHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	var req struct {
 		UserID string `json:"userId"`
 		FileID string `json:"fileId"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		api.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
-	if req.UserID == "" || req.FileID == "" {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
 		return
 	}
+	req.UserID = userID
 
-	var senderID, sharedID, metadata string
-	var revoked bool
-	var expiresAt time.Time
-
-	err := DB.QueryRow(`
-        SELECT id, sender_id, metadata, revoked, expires_at 
-        FROM shared_files_view 
-        WHERE recipient_id = $1 AND file_id = $2
-    `, req.UserID, req.FileID).Scan(&sharedID, &senderID, &metadata, &revoked, &expiresAt)
+	if req.UserID == "" || req.FileID == "" {
+		api.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
 
+	share, err := s.store.RecipientViewShare(ctx, req.UserID, req.FileID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "View file access not found", http.StatusNotFound)
+		if errors.Is(err, store.ErrNotFound) {
+			api.Error(w, "View file access not found", http.StatusNotFound)
 		} else {
-			log.Println("Database error:", err)
-			http.Error(w, "Database error", http.StatusInternalServerError)
+			logger.Error("Database error", "err", err)
+			api.Error(w, "Database error", http.StatusInternalServerError)
 		}
 		return
 	}
 
-	if revoked || senderID == "" {
-		http.Error(w, "Access has been revoked", http.StatusForbidden)
+	if share.Revoked || share.SenderID == "" {
+		api.Error(w, "Access has been revoked", http.StatusForbidden)
 		return
 	}
 
-	if time.Now().After(expiresAt) {
-		http.Error(w, "Access has expired", http.StatusForbidden)
+	if share.ExpiresAt != nil && s.now().After(*share.ExpiresAt) {
+		api.Error(w, "Access has expired", http.StatusForbidden)
 		return
 	}
 
-	targetPath := fmt.Sprintf("files/%s/shared_view", senderID)
+	targetPath := fmt.Sprintf("files/%s/shared_view", share.SenderID)
 	sharedFileKey := fmt.Sprintf("%s_%s", req.FileID, req.UserID)
 	fullPath := fmt.Sprintf("%s/%s", targetPath, sharedFileKey)
-	log.Println("Downloading view file (stream):", fullPath)
 
-	stream, err := owncloud.DownloadSentFileStream(fullPath)
+	target, size, err := s.blobTarget(ctx, fullPath)
 	if err != nil {
-		log.Println("Failed to download view file from OwnCloud:", err)
-		http.Error(w, "Failed to retrieve view file", http.StatusInternalServerError)
+		logger.Error("Failed to look up view file hash", "err", err)
+		api.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
-	defer func() {
-		if err := stream.Close(); err != nil {
-			log.Println("error closing stream:", err)
-		}
-	}()
-
-	_, err = DB.Exec(`
-        INSERT INTO access_logs (file_id, user_id, action, message, view_only)
-        VALUES ($1, $2, $3, $4, $5)
-    `, req.FileID, req.UserID, "viewed", "View-only file accessed", true)
-	if err != nil {
-		log.Println("Failed to log view-only access:", err)
-	}
 
 	// 5️⃣ Stream to client (fast & memory-safe)
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("X-View-Only", "true")
-	w.Header().Set("X-File-Id", req.FileID)
-	w.Header().Set("X-Share-Id", sharedID)
-	w.WriteHeader(http.StatusOK)
-
-	hasher := sha256.New()
-	tee := io.TeeReader(stream, hasher)
+	s.serveBlob(w, r, blobDownload{
+		target: target,
+		size:   size,
+		open:   func() (io.ReadCloser, error) { return s.blobs.DownloadSentFileStream(ctx, fullPath) },
+		openRange: func(offset, length int64) (io.ReadCloser, error) {
+			return s.blobs.DownloadSentFileRange(ctx, fullPath, offset, length)
+		},
+		failMsg: "Failed to retrieve view file",
+	}, func(h http.Header) {
+		err := s.store.AddAccessLog(ctx, store.AccessLog{
+			FileID:   req.FileID,
+			UserID:   req.UserID,
+			Action:   "viewed",
+			Message:  "View-only file accessed",
+			ViewOnly: true,
+		})
+		if err != nil {
+			logger.Error("Failed to log view-only access", "err", err)
+		}
 
-	if _, err := io.Copy(w, tee); err != nil {
-		log.Println(" Failed to stream view-only file:", err)
-		return
-	}
+		h.Set("X-View-Only", "true")
+		h.Set("X-File-Id", req.FileID)
+		h.Set("X-Share-Id", share.ID)
+	})
 
-	log.Println("View-only file streamed successfully for user:", req.UserID)
-	log.Printf("File hash: %s\n", hex.EncodeToString(hasher.Sum(nil)))
+	logger.Info("View-only file served", "file_id", req.FileID, "user_id", req.UserID)
 }
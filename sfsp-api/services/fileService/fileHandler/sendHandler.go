@@ -4,28 +4,29 @@ import (
 	"encoding/json"
 	//"encoding/base64"
 	"fmt"
-	"log"
 	"net/http"
-	"time"
 	"strconv"
 	"io"
-        //"crypto/sha256"
-        //"encoding/hex"
+        "crypto/sha256"
+        "encoding/hex"
 
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metadata"
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metrics"
 )
 
 
 
 
-func SendFileHandler(w http.ResponseWriter, r *http.Request) {
-    log.Println("==== New SendFile Request ====")
+func (s *Server) SendFileHandler(w http.ResponseWriter, r *http.Request) {
+    ctx := api.Detach(r)
+    logger := logging.FromContext(ctx)
 
-    err := r.ParseMultipartForm(50 << 20) // 50 MB buffer
+    err := s.parseMultipartForm(ctx, r)
     if err != nil {
-        log.Println("Failed to parse multipart form:", err)
-        http.Error(w, "Invalid multipart form", http.StatusBadRequest)
+        logger.Warn("Failed to parse multipart form", "err", err)
+        api.Error(w, "Invalid multipart form", http.StatusBadRequest)
         return
     }
 
@@ -36,42 +37,67 @@ func SendFileHandler(w http.ResponseWriter, r *http.Request) {
     chunkIndexStr := r.FormValue("chunkIndex")
     totalChunksStr := r.FormValue("totalChunks")
 
+    userID, ok := auth.ResolveUserID(w, r, userID)
+    if !ok {
+        return
+    }
+
     if fileID == "" || userID == "" || recipientID == "" || metadataJSON == "" {
-        http.Error(w, "Missing required form fields", http.StatusBadRequest)
+        api.Error(w, "Missing required form fields", http.StatusBadRequest)
+        return
+    }
+
+    expiresAt, err := s.shareExpiry(r.FormValue("expiresIn"), r.FormValue("expiresAt"), s.now())
+    if err != nil {
+        api.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    // only the owner may share a file
+    if !auth.RequireFileOwner(w, r, s.store, fileID) {
         return
     }
 
     chunkIndex, err := strconv.Atoi(chunkIndexStr)
     if err != nil {
-        http.Error(w, "Invalid chunkIndex", http.StatusBadRequest)
+        api.Error(w, "Invalid chunkIndex", http.StatusBadRequest)
         return
     }
     totalChunks, err := strconv.Atoi(totalChunksStr)
     if err != nil {
-        http.Error(w, "Invalid totalChunks", http.StatusBadRequest)
+        api.Error(w, "Invalid totalChunks", http.StatusBadRequest)
         return
     }
 
     // 🔹 Step 1: Get encrypted chunk
-    file, _, err := r.FormFile("encryptedFile")
+    file, header, err := r.FormFile("encryptedFile")
     if err != nil {
-        log.Println("Failed to get encrypted file chunk:", err)
-        http.Error(w, "Missing encrypted file chunk", http.StatusBadRequest)
+        logger.Error("Failed to get encrypted file chunk", "err", err)
+        api.Error(w, "Missing encrypted file chunk", http.StatusBadRequest)
         return
     }
     defer func() {
         if err := file.Close(); err != nil {
-            log.Println("error closing file:", err)
+            logger.Warn("Failed to close file", "err", err)
         }
     }()
 
+    if !s.checkChunkLimits(w, totalChunks, header.Size) {
+        return
+    }
+
+    if !s.ensureCopyQuota(ctx, w, userID, header.Size, totalChunks) {
+        return
+    }
+
     // 🔹 Step 2: Upload chunk to OwnCloud temp folder
     tempChunkName := fmt.Sprintf("%s_chunk_%d", fileID, chunkIndex)
-    if err := owncloud.UploadFileStream("temp", tempChunkName, file); err != nil {
-        log.Println("OwnCloud temp chunk upload failed:", err)
-        http.Error(w, "Chunk upload failed", http.StatusInternalServerError)
+    if err := s.blobs.UploadFileStream(ctx, "temp", tempChunkName, file); err != nil {
+        logger.Error("OwnCloud temp chunk upload failed", "err", err)
+        api.Error(w, "Chunk upload failed", http.StatusInternalServerError)
         return
     }
+    metrics.UploadedBytes.With(metrics.KindSend).Add(float64(header.Size))
 
     // 🔹 Step 3: If not last chunk → ACK only
     if chunkIndex != totalChunks-1 {
@@ -80,81 +106,89 @@ func SendFileHandler(w http.ResponseWriter, r *http.Request) {
             "message": fmt.Sprintf("Chunk %d uploaded", chunkIndex),
             "fileId":  fileID,
         }); err != nil {
-            log.Println("Failed to encode response:", err)
+            logger.Warn("Failed to encode response", "err", err)
         }
         return
     }
 
     // 🔹 Step 4: Merge chunks to final sent path
-    log.Println("🔗 Merging chunks for file:", fileID)
+    logger.Debug("Merging chunks", "file_id", fileID)
+    mergeCtx, finishMerge := startMerge(ctx, metrics.KindSend)
+    defer finishMerge(false)
     finalReader, finalWriter := io.Pipe()
 
     go func() {
         defer func() {
             if err := finalWriter.Close(); err != nil {
-                log.Println("error closing final writer:", err)
+                logger.Warn("Failed to close final writer", "err", err)
             }
         }()
 
         for i := 0; i < totalChunks; i++ {
             chunkPath := fmt.Sprintf("temp/%s_chunk_%d", fileID, i)
-            reader, err := owncloud.DownloadFileStreamTemp(chunkPath)
+            reader, err := s.blobs.DownloadFileStreamTemp(mergeCtx, chunkPath)
             if err != nil {
-                log.Println("Failed to download temp chunk:", err)
+                logger.Error("Failed to download temp chunk", "err", err)
                 finalWriter.CloseWithError(err)
                 return
             }
 
             if _, err := io.Copy(finalWriter, reader); err != nil {
-                log.Println("Failed to copy chunk to writer:", err)
+                logger.Error("Failed to copy chunk to writer", "err", err)
                 if err := reader.Close(); err != nil {
-                    log.Println("error closing reader:", err)
+                    logger.Warn("Failed to close reader", "err", err)
                 }
                 finalWriter.CloseWithError(err)
                 return
             }
             if err := reader.Close(); err != nil {
-                log.Println("error closing reader:", err)
+                logger.Warn("Failed to close reader", "err", err)
             }
-            if err := owncloud.DeleteFileTemp(chunkPath); err != nil {
-                log.Println("Failed to cleanup chunk:", err)
+            if err := s.blobs.DeleteFileTemp(mergeCtx, chunkPath); err != nil {
+                logger.Warn("Failed to clean up chunk", "err", err)
             }
         }
 
-        log.Println("✅ Finished merging chunks for file:", fileID)
     }()
 
     // 🔹 Step 5: Stream merged file to final sent folder
     sentPath := fmt.Sprintf("files/%s/sent", userID)
-    if err := owncloud.UploadFileStream(sentPath, fileID, finalReader); err != nil {
-        log.Println("OwnCloud final upload failed:", err)
-        http.Error(w, "Failed to store encrypted file", http.StatusInternalServerError)
+    hasher := sha256.New()
+    counter := &CountingWriter{w: hasher}
+    if err := s.blobs.UploadFileStream(mergeCtx, sentPath, fileID, io.TeeReader(finalReader, counter)); err != nil {
+        logger.Error("OwnCloud final upload failed", "err", err)
+        api.Error(w, "Failed to store encrypted file", http.StatusInternalServerError)
         return
     }
+    finishMerge(true)
+    // Remember the hash so DownloadSentFile can verify the copy later
+    if err := s.recordBlobHash(ctx, sentPath+"/"+fileID, fileID, hex.EncodeToString(hasher.Sum(nil)), counter.Count); err != nil {
+        logger.Error("Failed to record sent file hash", "err", err)
+    }
 
     // 🔹 Step 6: Track in DB (sent_files + received_files)
-    receivedID, err := metadata.InsertReceivedFile(
-        DB,
+    receivedID, err := s.meta.InsertReceivedFile(
+        ctx,
         recipientID,
         userID,
         fileID,
         metadataJSON,
-        time.Now().Add(48*time.Hour),
+        expiresAt,
     )
     if err != nil {
-        log.Println("Failed to insert received file:", err)
-        http.Error(w, "Failed to track received file", http.StatusInternalServerError)
+        logger.Error("Failed to insert received file", "err", err)
+        api.Error(w, "Failed to track received file", http.StatusInternalServerError)
         return
     }
 
-    if err := metadata.InsertSentFile(
-        DB,
+    if err := s.meta.InsertSentFile(
+        ctx,
         userID,
         recipientID,
         fileID,
         metadataJSON,
     ); err != nil {
-        log.Println("Failed to insert sent file:", err)
+        logger.Error("Failed to insert sent file", "err", err)
     }
 
     // ✅ Final response
@@ -163,7 +197,7 @@ func SendFileHandler(w http.ResponseWriter, r *http.Request) {
         "message":        "File sent successfully",
         "receivedFileID": receivedID,
     }); err != nil {
-        log.Println("Failed to encode response:", err)
+        logger.Warn("Failed to encode response", "err", err)
     }
-    log.Println("🎉 File sent successfully:", fileID)
+    logger.Info("File sent", "file_id", fileID, "recipient_id", recipientID)
 }
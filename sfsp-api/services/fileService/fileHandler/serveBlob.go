@@ -0,0 +1,213 @@
+package fileHandler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metrics"
+)
+
+// blobDownload describes a stored blob a download handler wants to send.
+type blobDownload struct {
+	target integrityTarget
+	// size of the blob in bytes, or -1 when unknown. Range requests are only
+	// honoured when the size is known.
+	size      int64
+	open      func() (io.ReadCloser, error)
+	openRange func(offset, length int64) (io.ReadCloser, error)
+	// failMsg is sent to the client when the blob cannot be opened.
+	failMsg string
+}
+
+// byteRange is a single satisfiable range within a blob.
+type byteRange struct {
+	start, length int64
+}
+
+func (br byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", br.start, br.start+br.length-1, size)
+}
+
+var errUnsatisfiableRange = errors.New("range not satisfiable")
+
+// etagFor derives a strong ETag from the stored content hash.
+func etagFor(hashHex string) string {
+	if hashHex == "" {
+		return ""
+	}
+	return `"` + hashHex + `"`
+}
+
+// etagMatches reports whether etag is listed in an If-None-Match value.
+// Weak validators compare equal to their strong form, as RFC 9110 requires
+// for If-None-Match.
+func etagMatches(header, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// requestedRange returns the range the client asked for, or nil when the
+// whole blob should be sent. Malformed or multi-range headers are ignored,
+// which RFC 9110 allows.
+func requestedRange(r *http.Request, size int64, etag string) (*byteRange, error) {
+	header := r.Header.Get("Range")
+	if header == "" || size < 0 {
+		return nil, nil
+	}
+	// If-Range only accepts a strong ETag; anything else (including a date,
+	// since we do not send Last-Modified) means the client's copy is stale.
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" && (etag == "" || ifRange != etag) {
+		return nil, nil
+	}
+
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return nil, nil
+	}
+	startStr, endStr, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil, nil
+	}
+
+	if startStr == "" {
+		// suffix range: the last N bytes
+		n, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || n < 0 {
+			return nil, nil
+		}
+		if n == 0 || size == 0 {
+			return nil, errUnsatisfiableRange
+		}
+		if n > size {
+			n = size
+		}
+		return &byteRange{start: size - n, length: n}, nil
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 {
+		return nil, nil
+	}
+	end := size - 1
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return nil, nil
+		}
+	}
+	if start >= size {
+		return nil, errUnsatisfiableRange
+	}
+	if end >= size {
+		end = size - 1
+	}
+	return &byteRange{start: start, length: end - start + 1}, nil
+}
+
+// serveBlob answers a download request for b, handling conditional and
+// range requests and hash verification. beforeSend is called once the blob
+// has been opened, just before the status line is written, so handlers can
+// add their own headers or record the access.
+func (s *Server) serveBlob(w http.ResponseWriter, r *http.Request, b blobDownload, beforeSend func(h http.Header)) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	if b.target.corrupted {
+		logger.Warn("Refusing download of corrupted file", "file_id", b.target.fileID, "path", b.target.path)
+		api.ErrorCode(w, "File failed integrity verification", http.StatusInternalServerError, api.CodeIntegrityFailed)
+		return
+	}
+
+	etag := etagFor(b.target.expected)
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if b.size >= 0 {
+		w.Header().Set("Accept-Ranges", "bytes")
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	rng, err := requestedRange(r, b.size, etag)
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", b.size))
+		api.Error(w, "Requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	// 🔐 In pre-verify mode nothing is sent until the whole blob checks out
+	if s.verifyModeFor(r) == VerifyModePre {
+		if err := s.preVerify(ctx, b.target, b.open); err != nil {
+			if errors.Is(err, errIntegrity) {
+				api.ErrorCode(w, "File failed integrity verification", http.StatusInternalServerError, api.CodeIntegrityFailed)
+				return
+			}
+			logger.Error("Storage download failed", "err", err)
+			api.Error(w, b.failMsg, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var stream io.ReadCloser
+	if rng != nil {
+		stream, err = b.openRange(rng.start, rng.length)
+	} else {
+		stream, err = b.open()
+	}
+	if err != nil {
+		logger.Error("Storage download failed", "err", err)
+		api.Error(w, b.failMsg, http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err := stream.Close(); err != nil {
+			logger.Warn("Failed to close stream", "err", err)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if beforeSend != nil {
+		beforeSend(w.Header())
+	}
+
+	// A partial body cannot be checked against the whole-file hash, so the
+	// client verifies the reassembled file against the ETag instead.
+	if rng != nil {
+		w.Header().Set("Content-Range", rng.contentRange(b.size))
+		w.Header().Set("Content-Length", strconv.FormatInt(rng.length, 10))
+		w.WriteHeader(http.StatusPartialContent)
+
+		buf := make([]byte, 32*1024)
+		n, err := io.CopyBuffer(w, stream, buf)
+		metrics.DownloadedBytes.Add(float64(n))
+		if err != nil {
+			logger.Error("Failed to stream file range", "err", err)
+		}
+		return
+	}
+
+	// Full responses stay chunked (no Content-Length) so the hash trailers
+	// can be delivered after the body.
+	declareIntegrityTrailers(w, b.target)
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := s.copyVerified(ctx, w, stream, b.target); err != nil {
+		logger.Error("Failed to stream file", "err", err)
+	}
+}
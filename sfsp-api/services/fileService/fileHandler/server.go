@@ -0,0 +1,118 @@
+package fileHandler
+
+import (
+	"context"
+	"time"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/database"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metadata"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/storage"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+)
+
+// Config tunes the behaviour of a Server.
+type Config struct {
+	// Limits bounds every chunked transfer.
+	Limits ChunkLimits
+	// Shares is applied to every new share.
+	Shares SharePolicy
+	// TrashRetention is how long a file stays in the trash before the
+	// janitor purges it. It is only used here to report when that will
+	// happen.
+	TrashRetention time.Duration
+	// VerifyMode is the download verification mode used when a request does
+	// not pick one with the "verify" query parameter or the X-Verify-Mode
+	// header.
+	VerifyMode string
+	// OnIntegrityFailure is called whenever a download detects corruption,
+	// e.g. to forward alerts to an external system. The default logs it.
+	OnIntegrityFailure func(IntegrityFailure)
+}
+
+// DefaultConfig is used for zero fields in Config.
+var DefaultConfig = Config{
+	Limits: ChunkLimits{
+		MaxChunks:       10000,
+		MaxChunkSize:    64 << 20,
+		MultipartMemory: 50 << 20,
+	},
+	Shares: SharePolicy{
+		Default:    metadata.DefaultConfig.ShareExpiry,
+		Max:        30 * 24 * time.Hour,
+		AllowNever: true,
+	},
+	TrashRetention:     30 * 24 * time.Hour,
+	VerifyMode:         VerifyModeTrailer,
+	OnIntegrityFailure: logIntegrityFailure,
+}
+
+// Server serves the upload, download, sharing and housekeeping endpoints.
+// It holds everything the handlers depend on, so several servers, each with
+// its own database and storage, can run in the same process.
+type Server struct {
+	store store.Store
+	blobs *owncloud.Client
+	meta  *metadata.Server
+	cfg   Config
+	now   func() time.Time
+	quota func(ctx context.Context, userID string) (Quota, error)
+}
+
+// New returns a server that keeps metadata in db and blobs in backend.
+func New(db database.Repository, backend storage.Backend, cfg Config) *Server {
+	if cfg.Limits == (ChunkLimits{}) {
+		cfg.Limits = DefaultConfig.Limits
+	}
+	if cfg.Limits.MultipartMemory <= 0 {
+		cfg.Limits.MultipartMemory = DefaultConfig.Limits.MultipartMemory
+	}
+	// a zero Max means no limit and a false AllowNever is a choice, so
+	// those are only defaulted along with an unset policy
+	if cfg.Shares == (SharePolicy{}) {
+		cfg.Shares = DefaultConfig.Shares
+	}
+	if cfg.Shares.Default <= 0 {
+		cfg.Shares.Default = DefaultConfig.Shares.Default
+	}
+	if cfg.TrashRetention <= 0 {
+		cfg.TrashRetention = DefaultConfig.TrashRetention
+	}
+	if cfg.VerifyMode == "" {
+		cfg.VerifyMode = DefaultConfig.VerifyMode
+	}
+	if cfg.OnIntegrityFailure == nil {
+		cfg.OnIntegrityFailure = DefaultConfig.OnIntegrityFailure
+	}
+	s := &Server{
+		blobs: owncloud.New(backend),
+		meta:  metadata.New(db, metadata.Config{ShareExpiry: cfg.Shares.Default}),
+		cfg:   cfg,
+		now:   time.Now,
+	}
+	if db != nil {
+		s.store = store.NewPostgres(db)
+	}
+	s.quota = s.LoadQuota
+	return s
+}
+
+// SetStore replaces the store built from the database, here and in the
+// metadata server, e.g. with store.NewMemory in tests.
+func (s *Server) SetStore(st store.Store) {
+	s.store = st
+	s.meta.SetStore(st)
+}
+
+// SetClock overrides the time source, here and in the metadata server;
+// used by tests.
+func (s *Server) SetClock(now func() time.Time) {
+	s.now = now
+	s.meta.SetClock(now)
+}
+
+// SetQuotaLoader overrides how the handlers look up a user's quota; used by
+// tests that are not about quotas.
+func (s *Server) SetQuotaLoader(load func(ctx context.Context, userID string) (Quota, error)) {
+	s.quota = load
+}
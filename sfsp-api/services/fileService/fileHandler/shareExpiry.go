@@ -0,0 +1,68 @@
+package fileHandler
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SharePolicy limits the expiry a sender may choose for a share.
+type SharePolicy struct {
+	// Default is used when the sender does not choose an expiry.
+	Default time.Duration
+	// Max is the longest expiry a sender may choose. Zero means no limit.
+	Max time.Duration
+	// AllowNever lets senders create shares that never expire.
+	AllowNever bool
+}
+
+// shareExpiry works out when a new share expires from the sender's
+// expiresIn (a Go duration such as "72h", or "never") or expiresAt (RFC
+// 3339). At most one may be set; with neither the policy default applies. A
+// zero time means the share never expires. Errors describe what the sender
+// got wrong.
+func (s *Server) shareExpiry(expiresIn, expiresAt string, now time.Time) (time.Time, error) {
+	if expiresIn != "" && expiresAt != "" {
+		return time.Time{}, errors.New("set expiresIn or expiresAt, not both")
+	}
+
+	var d time.Duration
+	switch {
+	case expiresIn == "never":
+		if !s.cfg.Shares.AllowNever {
+			return time.Time{}, errors.New("shares must expire")
+		}
+		return time.Time{}, nil
+	case expiresIn != "":
+		parsed, err := time.ParseDuration(expiresIn)
+		if err != nil {
+			return time.Time{}, errors.New("expiresIn must be a duration such as \"72h\" or \"never\"")
+		}
+		d = parsed
+	case expiresAt != "":
+		at, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			return time.Time{}, errors.New("expiresAt must be an RFC 3339 timestamp")
+		}
+		d = at.Sub(now)
+	default:
+		d = s.cfg.Shares.Default
+	}
+
+	if d <= 0 {
+		return time.Time{}, errors.New("expiry must be in the future")
+	}
+	if s.cfg.Shares.Max > 0 && d > s.cfg.Shares.Max {
+		return time.Time{}, fmt.Errorf("expiry may be at most %s away", s.cfg.Shares.Max)
+	}
+	return now.Add(d), nil
+}
+
+// expiryRef turns a zero expiry into the nil ExpiresAt of a share that
+// never expires.
+func expiryRef(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,674 @@
+package fileHandler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metrics"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+)
+
+var (
+	// LinkMaxPasswordAttempts is how many wrong passwords a share link
+	// accepts before it is locked.
+	LinkMaxPasswordAttempts = 5
+	// LinkLockout is how long a share link stays locked after too many
+	// wrong passwords.
+	LinkLockout = 15 * time.Minute
+)
+
+// ShareLink is a public link as its owner sees it. The token itself is only
+// returned when the link is created; the server keeps just its hash.
+type ShareLink struct {
+	LinkID            string     `json:"linkId"`
+	FileID            string     `json:"fileId"`
+	PasswordProtected bool       `json:"passwordProtected"`
+	ExpiresAt         *time.Time `json:"expiresAt"`
+	MaxDownloads      *int       `json:"maxDownloads"`
+	DownloadCount     int        `json:"downloadCount"`
+	Revoked           bool       `json:"revoked"`
+	CreatedAt         time.Time  `json:"createdAt"`
+}
+
+type shareLinkRequest struct {
+	UserID   string `json:"userId"`
+	FileID   string `json:"fileId"`
+	LinkID   string `json:"linkId"`
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// randomToken returns n random bytes, base64url encoded.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashLinkToken is how link tokens are stored and looked up.
+func hashLinkToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// clientIP is the address a public request came from, for the access log.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// CreateShareLinkHandler stores a ciphertext copy of a file, uploaded in
+// chunks like /upload, and mints a public link to it. The copy is encrypted
+// for the link, so the key never reaches the server; clients keep it in the
+// link's URL fragment. Chunk 0 is sent first and answered with the linkId
+// that the other chunks carry; they may then arrive in any order, and the
+// request completing the upload creates the link. Optional form fields set a
+// password, expiresIn/expiresAt and maxDownloads.
+func (s *Server) CreateShareLinkHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	if err := s.parseMultipartForm(ctx, r); err != nil {
+		logger.Warn("Failed to parse multipart form", "err", err)
+		api.Error(w, "Invalid multipart form", http.StatusBadRequest)
+		return
+	}
+
+	fileID := r.FormValue("fileid")
+	userID, ok := auth.ResolveUserID(w, r, r.FormValue("userId"))
+	if !ok {
+		return
+	}
+	if fileID == "" || userID == "" {
+		api.Error(w, "Missing required form fields", http.StatusBadRequest)
+		return
+	}
+	metadataJSON := r.FormValue("metadata")
+	if metadataJSON == "" {
+		metadataJSON = "{}"
+	}
+
+	expiresAt, err := s.shareExpiry(r.FormValue("expiresIn"), r.FormValue("expiresAt"), s.now())
+	if err != nil {
+		api.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var maxDownloads *int
+	if v := r.FormValue("maxDownloads"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			api.Error(w, "maxDownloads must be a positive number", http.StatusBadRequest)
+			return
+		}
+		maxDownloads = &n
+	}
+	var passwordHash string
+	if password := r.FormValue("password"); password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			api.Error(w, "Password is too long", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to hash link password", "err", err)
+			api.Error(w, "Failed to create link", http.StatusInternalServerError)
+			return
+		}
+		passwordHash = string(hash)
+	}
+
+	chunkIndex, err := strconv.Atoi(r.FormValue("chunkIndex"))
+	if err != nil {
+		api.Error(w, "Invalid chunkIndex", http.StatusBadRequest)
+		return
+	}
+	totalChunks, err := strconv.Atoi(r.FormValue("totalChunks"))
+	if err != nil {
+		api.Error(w, "Invalid totalChunks", http.StatusBadRequest)
+		return
+	}
+	if totalChunks <= 0 || chunkIndex < 0 || chunkIndex >= totalChunks {
+		api.Error(w, "chunkIndex out of range", http.StatusBadRequest)
+		return
+	}
+
+	ownerID, err := s.store.FileOwner(ctx, fileID)
+	if errors.Is(err, store.ErrNotFound) {
+		api.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Database error", "err", err)
+		api.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if ownerID != userID {
+		api.Error(w, "Unauthorized: You don't own this file", http.StatusForbidden)
+		return
+	}
+
+	file, header, err := r.FormFile("encryptedFile")
+	if err != nil {
+		logger.Error("Failed to get encrypted file chunk", "err", err)
+		api.Error(w, "Missing encrypted file chunk", http.StatusBadRequest)
+		return
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Warn("Failed to close file", "err", err)
+		}
+	}()
+
+	if !s.checkChunkLimits(w, totalChunks, header.Size) {
+		return
+	}
+
+	if !s.ensureCopyQuota(ctx, w, userID, header.Size, totalChunks) {
+		return
+	}
+
+	linkID := r.FormValue("linkId")
+	if linkID == "" {
+		if chunkIndex != 0 {
+			api.Error(w, "linkId is required for chunks after the first", http.StatusBadRequest)
+			return
+		}
+		if linkID, err = randomToken(16); err != nil {
+			logger.Error("Failed to generate link id", "err", err)
+			api.Error(w, "Failed to create link", http.StatusInternalServerError)
+			return
+		}
+		err = s.store.AddLinkUpload(ctx, store.LinkUpload{ID: linkID, FileID: fileID, OwnerID: userID, TotalChunks: totalChunks})
+		if err != nil {
+			logger.Error("Failed to start link upload", "file_id", fileID, "err", err)
+			api.Error(w, "Failed to create link", http.StatusInternalServerError)
+			return
+		}
+	} else if !s.checkLinkUpload(ctx, w, linkID, fileID, userID, totalChunks) {
+		return
+	}
+
+	if err := s.blobs.UploadFileStream(ctx, "temp", linkChunkName(linkID, chunkIndex), file); err != nil {
+		logger.Error("OwnCloud temp chunk upload failed", "err", err)
+		api.Error(w, "Chunk upload failed", http.StatusInternalServerError)
+		return
+	}
+	metrics.UploadedBytes.With(metrics.KindLink).Add(float64(header.Size))
+	if err := s.store.RecordLinkUploadChunk(ctx, linkID, chunkIndex, header.Size); err != nil {
+		logger.Error("Failed to record link chunk", "link_id", linkID, "err", err)
+		api.Error(w, "Failed to record chunk", http.StatusInternalServerError)
+		return
+	}
+
+	// only the request that finds every chunk recorded merges them
+	claimed, err := s.store.ClaimLinkUploadAssembly(ctx, linkID)
+	if err != nil {
+		logger.Error("Failed to claim link upload", "link_id", linkID, "err", err)
+		api.Error(w, "Failed to create link", http.StatusInternalServerError)
+		return
+	}
+	if !claimed {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]string{
+			"message": fmt.Sprintf("Chunk %d uploaded", chunkIndex),
+			"fileId":  fileID,
+			"linkId":  linkID,
+		}); err != nil {
+			logger.Warn("Failed to encode response", "err", err)
+		}
+		return
+	}
+	// the chunks are kept until the link exists, so re-sending any of them
+	// retries a merge that failed
+	releaseUpload := func() {
+		if err := s.store.SetLinkUploadStatus(ctx, linkID, UploadStatusUploading); err != nil {
+			logger.Error("Failed to release link upload", "link_id", linkID, "err", err)
+		}
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		logger.Error("Failed to generate link token", "err", err)
+		releaseUpload()
+		api.Error(w, "Failed to create link", http.StatusInternalServerError)
+		return
+	}
+
+	created := s.createShareLink(ctx, w, shareLinkUpload{
+		linkID:       linkID,
+		token:        token,
+		fileID:       fileID,
+		ownerID:      ownerID,
+		metadata:     metadataJSON,
+		passwordHash: passwordHash,
+		expiresAt:    expiresAt,
+		maxDownloads: maxDownloads,
+		chunks:       s.mergeLinkChunks(ctx, linkID, totalChunks),
+	})
+	if !created {
+		releaseUpload()
+		return
+	}
+	if err := s.store.DeleteLinkUpload(ctx, linkID); err != nil {
+		logger.Warn("Failed to forget link upload", "link_id", linkID, "err", err)
+	}
+	for i := 0; i < totalChunks; i++ {
+		if err := s.blobs.DeleteFileTemp(ctx, "temp/"+linkChunkName(linkID, i)); err != nil {
+			logger.Warn("Failed to clean up chunk", "err", err)
+		}
+	}
+}
+
+// checkLinkUpload answers for a chunk that does not belong to the link
+// upload linkID. The caller must return when it reports false.
+func (s *Server) checkLinkUpload(ctx context.Context, w http.ResponseWriter, linkID, fileID, userID string, totalChunks int) bool {
+	logger := logging.FromContext(ctx)
+	u, err := s.store.LinkUpload(ctx, linkID)
+	if errors.Is(err, store.ErrNotFound) {
+		api.Error(w, "Link upload not found", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		logger.Error("Failed to load link upload", "link_id", linkID, "err", err)
+		api.Error(w, "Failed to load link upload", http.StatusInternalServerError)
+		return false
+	}
+	switch {
+	case u.OwnerID != userID:
+		api.Error(w, "Unauthorized: You don't own this upload", http.StatusForbidden)
+	case u.FileID != fileID:
+		api.Error(w, "linkId belongs to another file", http.StatusBadRequest)
+	case u.Status == UploadStatusAssembling:
+		// a chunk stored now could be deleted with the rest once the merge
+		// finishes
+		api.Error(w, "Upload is being assembled", http.StatusConflict)
+	case u.TotalChunks != totalChunks:
+		api.Error(w, fmt.Sprintf("totalChunks does not match link upload (%d)", u.TotalChunks), http.StatusConflict)
+	default:
+		return true
+	}
+	return false
+}
+
+// linkChunkName is where chunk index of the link upload linkID is kept
+// under temp/.
+func linkChunkName(linkID string, index int) string {
+	return fmt.Sprintf("%s_link_chunk_%d", linkID, index)
+}
+
+type shareLinkUpload struct {
+	linkID, token, fileID, ownerID, metadata, passwordHash string
+	maxDownloads                                           *int
+	expiresAt                                              time.Time
+	chunks                                                 io.ReadCloser
+}
+
+// createShareLink stores the merged copy and records the link. It reports
+// whether the link was created; either way the response has been written.
+func (s *Server) createShareLink(ctx context.Context, w http.ResponseWriter, u shareLinkUpload) bool {
+	logger := logging.FromContext(ctx)
+	defer func() {
+		if err := u.chunks.Close(); err != nil {
+			logger.Warn("Failed to close merged chunks", "err", err)
+		}
+	}()
+
+	blobPath := owncloud.LinkPath(u.fileID, u.linkID)
+	hasher := sha256.New()
+	counter := &CountingWriter{w: hasher}
+	mergeCtx, finishMerge := startMerge(ctx, metrics.KindLink)
+	err := s.blobs.UploadFileStream(mergeCtx, "links/"+u.fileID, u.linkID, io.TeeReader(u.chunks, counter))
+	finishMerge(err == nil)
+	if err != nil {
+		logger.Error("OwnCloud final upload failed", "err", err)
+		api.Error(w, "Failed to store encrypted file", http.StatusInternalServerError)
+		return false
+	}
+	if err := s.recordBlobHash(ctx, blobPath, u.fileID, hex.EncodeToString(hasher.Sum(nil)), counter.Count); err != nil {
+		logger.Error("Failed to record link copy hash", "err", err)
+	}
+
+	link := store.ShareLink{
+		ID:           u.linkID,
+		TokenHash:    hashLinkToken(u.token),
+		FileID:       u.fileID,
+		OwnerID:      u.ownerID,
+		BlobPath:     blobPath,
+		Metadata:     u.metadata,
+		PasswordHash: u.passwordHash,
+		MaxDownloads: u.maxDownloads,
+	}
+	if !u.expiresAt.IsZero() {
+		link.ExpiresAt = &u.expiresAt
+	}
+	if err := s.store.AddShareLink(ctx, link); err != nil {
+		logger.Error("Failed to insert share link", "err", err)
+		if err := s.blobs.DeleteLinkCopy(ctx, u.fileID, u.linkID); err != nil {
+			logger.Warn("Failed to clean up link copy", "err", err)
+		}
+		api.Error(w, "Failed to create link", http.StatusInternalServerError)
+		return false
+	}
+
+	err = s.store.AddAccessLog(ctx, store.AccessLog{
+		FileID:  u.fileID,
+		UserID:  u.ownerID,
+		Action:  "share_link_created",
+		Message: fmt.Sprintf("Public share link %s created", u.linkID),
+	})
+	if err != nil {
+		logger.Error("Failed to log link creation", "err", err)
+	}
+
+	resp := map[string]interface{}{
+		"message":           "Share link created",
+		"linkId":            u.linkID,
+		"token":             u.token,
+		"passwordProtected": u.passwordHash != "",
+		"expiresAt":         nil,
+		"maxDownloads":      u.maxDownloads,
+	}
+	if !u.expiresAt.IsZero() {
+		resp["expiresAt"] = u.expiresAt
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Warn("Failed to encode response", "err", err)
+	}
+	logger.Info("Share link created", "file_id", u.fileID, "link_id", u.linkID)
+	return true
+}
+
+// mergeLinkChunks streams the chunks of the link upload linkID in order.
+// They are left in place; the caller deletes them once the copy is stored.
+func (s *Server) mergeLinkChunks(ctx context.Context, linkID string, totalChunks int) io.ReadCloser {
+	logger := logging.FromContext(ctx)
+	reader, writer := io.Pipe()
+	go func() {
+		for i := 0; i < totalChunks; i++ {
+			chunk, err := s.blobs.DownloadFileStreamTemp(ctx, "temp/"+linkChunkName(linkID, i))
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+			_, err = io.Copy(writer, chunk)
+			if cerr := chunk.Close(); cerr != nil {
+				logger.Warn("Failed to close reader", "err", cerr)
+			}
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+		writer.Close()
+	}()
+	return reader
+}
+
+// ListShareLinksHandler returns the caller's share links, optionally only
+// those for one file, newest first.
+func (s *Server) ListShareLinksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	var req shareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
+		return
+	}
+	if userID == "" {
+		api.Error(w, "Missing userId", http.StatusBadRequest)
+		return
+	}
+
+	stored, err := s.store.ListShareLinks(ctx, userID, req.FileID)
+	if err != nil {
+		logger.Error("Failed to list share links", "err", err)
+		api.Error(w, "Failed to list share links", http.StatusInternalServerError)
+		return
+	}
+
+	links := make([]ShareLink, len(stored))
+	for i, l := range stored {
+		links[i] = ShareLink{
+			LinkID:            l.ID,
+			FileID:            l.FileID,
+			PasswordProtected: l.PasswordHash != "",
+			ExpiresAt:         l.ExpiresAt,
+			MaxDownloads:      l.MaxDownloads,
+			DownloadCount:     l.DownloadCount,
+			Revoked:           l.Revoked,
+			CreatedAt:         l.CreatedAt,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(links); err != nil {
+		logger.Warn("Failed to encode response", "err", err)
+	}
+}
+
+// RevokeShareLinkHandler disables a link and deletes its ciphertext copy.
+func (s *Server) RevokeShareLinkHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	var req shareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
+		return
+	}
+	if userID == "" || req.LinkID == "" {
+		api.Error(w, "Missing userId or linkId", http.StatusBadRequest)
+		return
+	}
+
+	link, err := s.store.RevokeShareLink(ctx, userID, req.LinkID)
+	if errors.Is(err, store.ErrNotFound) {
+		api.Error(w, "Share link not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to revoke share link", "err", err)
+		api.Error(w, "Failed to revoke share link", http.StatusInternalServerError)
+		return
+	}
+
+	// the link is already unusable, so a leftover copy is only logged
+	if err := s.blobs.DeleteLinkCopy(ctx, link.FileID, req.LinkID); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logger.Error("Failed to delete link copy", "err", err)
+	} else if err := s.store.DeleteBlobHash(ctx, link.BlobPath); err != nil {
+		logger.Error("Failed to forget link copy hash", "err", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]string{
+		"message": "Share link revoked",
+		"linkId":  req.LinkID,
+	}); err != nil {
+		logger.Warn("Failed to encode response", "err", err)
+	}
+}
+
+// loadPublicLink looks up the link for token and answers for links that
+// cannot be used. The caller must return when ok is false.
+func (s *Server) loadPublicLink(ctx context.Context, w http.ResponseWriter, token string) (l store.ShareLink, ok bool) {
+	logger := logging.FromContext(ctx)
+	if token == "" {
+		api.Error(w, "Missing token", http.StatusBadRequest)
+		return l, false
+	}
+	l, err := s.store.ShareLinkByToken(ctx, hashLinkToken(token))
+	if errors.Is(err, store.ErrNotFound) {
+		api.Error(w, "Link not found", http.StatusNotFound)
+		return l, false
+	}
+	if err != nil {
+		logger.Error("Failed to look up share link", "err", err)
+		api.Error(w, "Database error", http.StatusInternalServerError)
+		return l, false
+	}
+
+	switch {
+	case l.FileTrashed:
+		// suspended while the owner has the file in the trash
+		api.Error(w, "Link not found", http.StatusNotFound)
+	// the janitor revokes used-up links too, so those are checked first
+	case l.ExpiresAt != nil && !s.now().Before(*l.ExpiresAt):
+		api.Error(w, "Link has expired", http.StatusGone)
+	case l.MaxDownloads != nil && l.DownloadCount >= *l.MaxDownloads:
+		api.Error(w, "Download limit reached", http.StatusGone)
+	case l.Revoked:
+		api.Error(w, "Link has been revoked", http.StatusGone)
+	default:
+		return l, true
+	}
+	return l, false
+}
+
+// checkLinkPassword answers 401 for a missing or wrong password and 429
+// while the link is locked. Each wrong password counts towards the lockout.
+// The caller must return when it reports false.
+func (s *Server) checkLinkPassword(ctx context.Context, w http.ResponseWriter, l store.ShareLink, password string) bool {
+	logger := logging.FromContext(ctx)
+	if l.PasswordHash == "" {
+		return true
+	}
+	if l.LockedUntil != nil && s.now().Before(*l.LockedUntil) {
+		retry := int(time.Until(*l.LockedUntil).Seconds()) + 1
+		w.Header().Set("Retry-After", strconv.Itoa(retry))
+		api.Error(w, "Too many wrong passwords, try again later", http.StatusTooManyRequests)
+		return false
+	}
+	if password == "" {
+		api.Error(w, "Password required", http.StatusUnauthorized)
+		return false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(l.PasswordHash), []byte(password)) == nil {
+		return true
+	}
+
+	err := s.store.RecordLinkPasswordFailure(ctx, l.ID, LinkMaxPasswordAttempts, s.now().Add(LinkLockout))
+	if err != nil {
+		logger.Error("Failed to record wrong link password", "err", err)
+	}
+	api.Error(w, "Incorrect password", http.StatusUnauthorized)
+	return false
+}
+
+// PublicLinkInfoHandler tells an anonymous visitor what a link needs before
+// they download it. It does not require a token.
+func (s *Server) PublicLinkInfoHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	var req shareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	l, ok := s.loadPublicLink(ctx, w, req.Token)
+	if !ok {
+		return
+	}
+
+	info := map[string]interface{}{
+		"passwordProtected":  l.PasswordHash != "",
+		"expiresAt":          nil,
+		"downloadsRemaining": nil,
+	}
+	if l.ExpiresAt != nil {
+		info["expiresAt"] = *l.ExpiresAt
+	}
+	if l.MaxDownloads != nil {
+		info["downloadsRemaining"] = *l.MaxDownloads - l.DownloadCount
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		logger.Warn("Failed to encode response", "err", err)
+	}
+}
+
+// PublicLinkDownloadHandler streams the ciphertext behind a share link to
+// anyone holding its token (and password, if it has one). Every request that
+// gets this far counts as a download, so ranges are not offered. The link's
+// metadata is sent base64 encoded in X-Link-Metadata.
+func (s *Server) PublicLinkDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	var req shareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	l, ok := s.loadPublicLink(ctx, w, req.Token)
+	if !ok {
+		return
+	}
+	if !s.checkLinkPassword(ctx, w, l, req.Password) {
+		return
+	}
+
+	// claim a download; this also loses any race for the last one
+	claimed, err := s.store.ClaimLinkDownload(ctx, l.ID)
+	if err != nil {
+		logger.Error("Failed to count link download", "err", err)
+		api.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !claimed {
+		api.Error(w, "Download limit reached", http.StatusGone)
+		return
+	}
+
+	target, _, err := s.blobTarget(ctx, l.BlobPath)
+	if err != nil {
+		logger.Error("Failed to look up link copy hash", "err", err)
+		api.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	s.serveBlob(w, r, blobDownload{
+		target:  target,
+		size:    -1,
+		open:    func() (io.ReadCloser, error) { return s.blobs.DownloadLinkCopy(ctx, l.FileID, l.ID) },
+		failMsg: "Download failed",
+	}, func(h http.Header) {
+		h.Set("X-Link-Metadata", base64.StdEncoding.EncodeToString([]byte(l.Metadata)))
+		err := s.store.AddAccessLog(ctx, store.AccessLog{
+			FileID:  l.FileID,
+			UserID:  l.OwnerID,
+			Action:  "share_link_download",
+			Message: fmt.Sprintf("Downloaded through public share link %s from %s", l.ID, clientIP(r)),
+		})
+		if err != nil {
+			logger.Error("Failed to log link download", "err", err)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package fileHandler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metrics"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// parseMultipartForm parses an upload's form in a span of its own, which
+// for a chunk mostly measures receiving it.
+func (s *Server) parseMultipartForm(ctx context.Context, r *http.Request) error {
+	_, span := tracing.Start(ctx, "parse multipart form")
+	err := r.ParseMultipartForm(s.cfg.Limits.MultipartMemory)
+	tracing.End(span, err)
+	return err
+}
+
+// startMerge records a merge of kind in the metrics and starts its span;
+// the merge's storage calls should use the returned context. Call finish
+// with whether the merge succeeded. Only the first call counts, so a
+// deferred finish(false) can catch every early return.
+func startMerge(ctx context.Context, kind string) (context.Context, func(ok bool)) {
+	finishMetrics := metrics.StartMerge(kind)
+	ctx, span := tracing.Start(ctx, "merge chunks", attribute.String("merge.kind", kind))
+	var once sync.Once
+	return ctx, func(ok bool) {
+		once.Do(func() {
+			finishMetrics(ok)
+			if !ok {
+				span.SetStatus(codes.Error, "merge failed")
+			}
+			span.End()
+		})
+	}
+}
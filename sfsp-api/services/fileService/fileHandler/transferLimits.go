@@ -0,0 +1,34 @@
+package fileHandler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+)
+
+// ChunkLimits bounds chunked transfers: uploads, sends, view-only shares and
+// share links.
+type ChunkLimits struct {
+	// MaxChunks is the most chunks a transfer may have. Zero means no limit.
+	MaxChunks int
+	// MaxChunkSize is the largest chunk in bytes. Zero means no limit.
+	MaxChunkSize int64
+	// MultipartMemory is how many bytes of a chunk's multipart form are
+	// kept in memory; the rest spills to temporary files.
+	MultipartMemory int64
+}
+
+// checkChunkLimits rejects a transfer of totalChunks chunks, or a chunk of
+// size bytes, that the server's limits do not allow, and writes the error.
+func (s *Server) checkChunkLimits(w http.ResponseWriter, totalChunks int, size int64) bool {
+	if max := s.cfg.Limits.MaxChunks; max > 0 && totalChunks > max {
+		api.Error(w, fmt.Sprintf("totalChunks exceeds the limit of %d", max), http.StatusBadRequest)
+		return false
+	}
+	if max := s.cfg.Limits.MaxChunkSize; max > 0 && size > max {
+		api.Error(w, fmt.Sprintf("Chunk exceeds the limit of %d bytes", max), http.StatusRequestEntityTooLarge)
+		return false
+	}
+	return true
+}
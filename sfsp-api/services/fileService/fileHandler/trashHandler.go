@@ -0,0 +1,202 @@
+package fileHandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+)
+
+// TrashedFile is an entry in a user's trash.
+type TrashedFile struct {
+	FileID    string    `json:"fileId"`
+	FileName  string    `json:"fileName"`
+	FileType  string    `json:"fileType"`
+	FileSize  int64     `json:"fileSize"`
+	DeletedAt time.Time `json:"deletedAt"`
+	PurgeAt   time.Time `json:"purgeAt"`
+}
+
+type trashRequest struct {
+	UserID string `json:"userId"`
+	FileID string `json:"fileId"`
+}
+
+// fileInTrash reports whether fileID has been moved to the trash. Unknown
+// files are reported as not trashed.
+func (s *Server) fileInTrash(ctx context.Context, fileID string) (bool, error) {
+	trashed, err := s.store.FileTrashed(ctx, fileID)
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	}
+	return trashed, err
+}
+
+// purgeFile permanently deletes a file: its blob first, so a storage failure
+// leaves the row in place to retry, then its versions, its share link copies
+// and its rows.
+func (s *Server) purgeFile(ctx context.Context, fileID string) error {
+	logger := logging.FromContext(ctx)
+	if err := s.blobs.DeleteStoredFile(ctx, fileID); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := s.blobs.DeleteVersions(ctx, fileID); err != nil {
+		logger.Error("Failed to delete file versions", "err", err)
+	}
+	if err := s.blobs.DeleteLinkCopies(ctx, fileID); err != nil {
+		logger.Error("Failed to delete share link copies", "err", err)
+	}
+	return s.meta.DeleteFileMetadata(ctx, fileID)
+}
+
+// decodeTrashRequest parses a trashRequest and resolves the user. The
+// caller must return when ok is false.
+func decodeTrashRequest(w http.ResponseWriter, r *http.Request) (req trashRequest, ok bool) {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return req, false
+	}
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
+		return req, false
+	}
+	req.UserID = userID
+	if req.UserID == "" {
+		api.Error(w, "Missing userId", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// ListTrashHandler returns the caller's trashed files, most recently
+// deleted first. Items trashed along with their folder are left out; they
+// come back when the folder is restored.
+func (s *Server) ListTrashHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	req, ok := decodeTrashRequest(w, r)
+	if !ok {
+		return
+	}
+
+	trashed, err := s.store.ListTrash(ctx, req.UserID)
+	if err != nil {
+		logger.Error("Failed to list trash", "err", err)
+		api.Error(w, "Failed to list trash", http.StatusInternalServerError)
+		return
+	}
+
+	files := make([]TrashedFile, len(trashed))
+	for i, f := range trashed {
+		files[i] = TrashedFile{
+			FileID:    f.ID,
+			FileName:  f.FileName,
+			FileType:  f.FileType,
+			FileSize:  f.FileSize,
+			DeletedAt: *f.DeletedAt,
+			PurgeAt:   f.DeletedAt.Add(s.cfg.TrashRetention),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(files); err != nil {
+		logger.Warn("Failed to encode response", "err", err)
+	}
+}
+
+// RestoreFromTrashHandler moves a file out of the trash, which also resumes
+// its shares. Restoring a folder brings back everything that was trashed
+// with it.
+func (s *Server) RestoreFromTrashHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	req, ok := decodeTrashRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.FileID == "" {
+		api.Error(w, "Missing fileId", http.StatusBadRequest)
+		return
+	}
+
+	parentTrashed, err := s.store.ParentTrashed(ctx, req.UserID, req.FileID)
+	if errors.Is(err, store.ErrNotFound) {
+		api.Error(w, "File not found in trash", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to look up trashed file", "err", err)
+		api.Error(w, "Failed to restore file", http.StatusInternalServerError)
+		return
+	}
+	if parentTrashed {
+		api.Error(w, "Restore the parent folder first", http.StatusConflict)
+		return
+	}
+
+	err = s.store.RestoreFile(ctx, req.UserID, req.FileID)
+	if errors.Is(err, store.ErrNotFound) {
+		api.Error(w, "File not found in trash", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to restore file from trash", "err", err)
+		api.Error(w, "Failed to restore file", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("File restored from trash", "file_id", req.FileID)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]string{
+		"message": "File restored",
+		"fileId":  req.FileID,
+	}); err != nil {
+		logger.Warn("Failed to encode response", "err", err)
+	}
+}
+
+// EmptyTrashHandler permanently deletes every file in the caller's trash.
+// Files that fail to delete stay in the trash and are listed in "failed".
+func (s *Server) EmptyTrashHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	req, ok := decodeTrashRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ids, err := s.store.TrashedFileIDs(ctx, req.UserID)
+	if err != nil {
+		logger.Error("Failed to list trash", "err", err)
+		api.Error(w, "Failed to empty trash", http.StatusInternalServerError)
+		return
+	}
+
+	purged := 0
+	failed := []string{}
+	for _, id := range ids {
+		if err := s.purgeFile(ctx, id); err != nil {
+			logger.Error("Failed to purge file", "file_id", id, "err", err)
+			failed = append(failed, id)
+			continue
+		}
+		purged++
+	}
+
+	logger.Info("Emptied trash", "user_id", req.UserID, "purged", purged, "failed", len(failed))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Trash emptied",
+		"purged":  purged,
+		"failed":  failed,
+	}); err != nil {
+		logger.Warn("Failed to encode response", "err", err)
+	}
+}
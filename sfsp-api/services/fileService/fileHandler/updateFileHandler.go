@@ -6,142 +6,121 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
-	"log"
 	"net/http"
 	"strings"
 
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
 )
 
 // UpdateFileRequest represents the request to update a file during password reset
 type UpdateFileRequest struct {
 	UserID      string `json:"userId"`
 	FileID      string `json:"fileId"`
-	Nonce       string `json:"nonce"`        // New nonce for the re-encrypted file
-	FileContent string `json:"fileContent"`  // Base64 encoded re-encrypted file content
+	Nonce       string `json:"nonce"`       // New nonce for the re-encrypted file
+	FileContent string `json:"fileContent"` // Base64 encoded re-encrypted file content
 }
 
 // UpdateFileResponse represents the response after updating a file
 type UpdateFileResponse struct {
-	Message     string `json:"message"`
-	FileID      string `json:"fileId"`
-	FileName    string `json:"fileName"`
-	NewHash     string `json:"newHash"`
-	BytesWritten int64  `json:"bytesWritten"`
+	Message         string `json:"message"`
+	FileID          string `json:"fileId"`
+	FileName        string `json:"fileName"`
+	NewHash         string `json:"newHash"`
+	BytesWritten    int64  `json:"bytesWritten"`
+	PreviousVersion int    `json:"previousVersion"` // version the replaced content was saved as
 }
 
 // UpdateFileHandler handles file updates during password reset
-// Updates both the file content in ownCloud and the nonce + hash in PostgreSQL
-func UpdateFileHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("==== Update File Request (Password Reset) ====")
+// Updates both the file content in ownCloud and the nonce + hash in PostgreSQL.
+// The replaced content is kept as a file version first.
+func (s *Server) UpdateFileHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 
 	// 1️⃣ Parse JSON request
 	var req UpdateFileRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Println("❌ Failed to parse JSON:", err)
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		logger.Warn("Failed to parse JSON", "err", err)
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
 		return
 	}
+	req.UserID = userID
 
 	// 2️⃣ Validate required fields
 	if req.UserID == "" || req.FileID == "" || req.Nonce == "" || req.FileContent == "" {
-		log.Println("❌ Missing required fields")
-		http.Error(w, "Missing required fields: userId, fileId, nonce, and fileContent are required", http.StatusBadRequest)
+		api.Error(w, "Missing required fields: userId, fileId, nonce, and fileContent are required", http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("📦 Update request: userId=%s, fileId=%s, nonce=%s, contentLength=%d",
-		req.UserID, req.FileID, req.Nonce[:20]+"...", len(req.FileContent))
+	logger.Debug("Updating file", "user_id", req.UserID, "file_id", req.FileID, "content_length", len(req.FileContent))
 
-	// 3️⃣ Verify file exists and belongs to user
-	var fileName, currentNonce string
-	err := DB.QueryRow(`
-		SELECT file_name, nonce FROM files
-		WHERE owner_id = $1 AND id = $2
-	`, req.UserID, req.FileID).Scan(&fileName, &currentNonce)
-
-	if err != nil {
-		log.Println("❌ File not found or access denied:", err)
-		http.Error(w, "File not found or you don't have permission to update it", http.StatusNotFound)
+	// 3️⃣ Verify file exists, belongs to user and is not in the trash
+	fileName, ok := s.ownedFileName(ctx, w, req.UserID, req.FileID)
+	if !ok {
 		return
 	}
 
-	log.Printf("✅ Found file: %s (current nonce: %s)", fileName, currentNonce[:20]+"...")
-
 	// 4️⃣ Decode base64 file content
 	fileBytes, err := base64.StdEncoding.DecodeString(req.FileContent)
 	if err != nil {
-		log.Println("❌ Failed to decode base64 content:", err)
-		http.Error(w, "Invalid base64 file content", http.StatusBadRequest)
+		logger.Warn("Failed to decode base64 content", "err", err)
+		api.Error(w, "Invalid base64 file content", http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("✅ Decoded file content: %d bytes", len(fileBytes))
-
 	// 5️⃣ Calculate new file hash
 	hasher := sha256.New()
 	hasher.Write(fileBytes)
 	newFileHash := hex.EncodeToString(hasher.Sum(nil))
 
-	log.Printf("✅ Calculated new file hash: %s", newFileHash)
-
-	// 6️⃣ Upload re-encrypted file to ownCloud (replaces old file)
-	fileReader := strings.NewReader(string(fileBytes))
-	err = owncloud.UploadFileStream("files", req.FileID, fileReader)
+	// 6️⃣ Keep the current ciphertext and metadata as a numbered version
+	previousVersion, err := s.snapshotFileVersion(ctx, req.FileID, req.UserID)
 	if err != nil {
-		log.Println("❌ OwnCloud upload failed:", err)
-		http.Error(w, "Failed to upload re-encrypted file to storage", http.StatusInternalServerError)
+		logger.Error("Failed to save previous version", "err", err)
+		api.Error(w, "Failed to save the previous version of the file", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("✅ Uploaded %d bytes to ownCloud for file %s", len(fileBytes), req.FileID)
-
-	// 7️⃣ Update database with new nonce, hash, and file size
-	_, err = DB.Exec(`
-		UPDATE files
-		SET nonce = $1, file_hash = $2, file_size = $3
-		WHERE owner_id = $4 AND id = $5
-	`, req.Nonce, newFileHash, len(fileBytes), req.UserID, req.FileID)
-
+	// Upload re-encrypted file to ownCloud (replaces old file)
+	fileReader := strings.NewReader(string(fileBytes))
+	err = s.blobs.UploadFileStream(ctx, "files", req.FileID, fileReader)
 	if err != nil {
-		log.Println("❌ Failed to update file metadata in database:", err)
-		http.Error(w, "Failed to update file metadata", http.StatusInternalServerError)
+		logger.Error("OwnCloud upload failed", "err", err)
+		api.Error(w, "Failed to upload re-encrypted file to storage", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("✅ Updated database: nonce=%s, hash=%s", req.Nonce[:20]+"...", newFileHash)
-
-	// 8️⃣ Handle shared_files_view updates if this file is shared via view-only
-	// Check if this file has any active view-only shares where it's the newfile_id
-	_, err = DB.Exec(`
-		UPDATE shared_files_view
-		SET newfile_id = $1
-		WHERE newfile_id = $1
-		  AND revoked = FALSE
-		  AND access_granted = TRUE
-	`, req.FileID)
-
+	// 7️⃣ Update database with new nonce, hash, and file size; the new
+	// content also clears any corruption flag
+	err = s.store.SetFileContent(ctx, req.UserID, req.FileID, req.Nonce, newFileHash, int64(len(fileBytes)))
 	if err != nil {
-		log.Println("⚠️  Warning: Failed to update shared_files_view references:", err)
-		// Don't fail the request, just log the warning
-	} else {
-		log.Println("✅ Updated shared_files_view references if any existed")
+		logger.Error("Failed to update file metadata in database", "err", err)
+		api.Error(w, "Failed to update file metadata", http.StatusInternalServerError)
+		return
 	}
 
-	// 9️⃣ Return success response
+	// 8️⃣ Return success response
 	response := UpdateFileResponse{
-		Message:      "File re-encrypted and updated successfully",
-		FileID:       req.FileID,
-		FileName:     fileName,
-		NewHash:      newFileHash,
-		BytesWritten: int64(len(fileBytes)),
+		Message:         "File re-encrypted and updated successfully",
+		FileID:          req.FileID,
+		FileName:        fileName,
+		NewHash:         newFileHash,
+		BytesWritten:    int64(len(fileBytes)),
+		PreviousVersion: previousVersion,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 
-	log.Printf("✅ File update complete: %s (%d bytes)", fileName, len(fileBytes))
+	logger.Info("File re-encrypted", "file_id", req.FileID, "size", len(fileBytes), "previous_version", previousVersion)
 }
@@ -3,32 +3,26 @@ package fileHandler
 
 import (
 	"encoding/json"
+	"errors"
 
-	"log"
 	"net/http"
 
 	"fmt"
 	"io"
 	"strconv"
-	"time"
+	"strings"
 
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metrics"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
 
-	"database/sql"
-
-	"github.com/lib/pq"
 
 	"crypto/sha256"
 	"encoding/hex"
 )
 
-var DB *sql.DB
-
-func SetPostgreClient(db *sql.DB) {
-	// This function is used to set the PostgreSQL client in the fileHandler package
-	DB = db
-}
-
 type CountingWriter struct {
 	w     io.Writer
 	Count int64
@@ -40,13 +34,14 @@ func (cw *CountingWriter) Write(p []byte) (int, error) {
 	return n, err
 }
 
-func UploadHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("==== New Upload Request ====")
+func (s *Server) UploadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 
 	// 1️⃣ Parse multipart form
-	if err := r.ParseMultipartForm(50 << 20); err != nil {
-		log.Println("❌ Failed to parse multipart form:", err)
-		http.Error(w, "Failed to parse multipart form", http.StatusBadRequest)
+	if err := s.parseMultipartForm(ctx, r); err != nil {
+		logger.Warn("Failed to parse multipart form", "err", err)
+		api.Error(w, "Failed to parse multipart form", http.StatusBadRequest)
 		return
 	}
 
@@ -66,29 +61,30 @@ func UploadHandler(w http.ResponseWriter, r *http.Request) {
 		uploadPath = "files"
 	}
 
-	log.Printf("📦 Parsed form: userId=%s, fileName=%s, fileHash=%s, chunk=%s/%s, fileId=%s",
-		userId, fileName, fileHash, chunkIndexStr, totalChunksStr, fileID)
+	logger.Debug("Upload chunk received",
+		"user_id", userId, "file_id", fileID, "chunk_index", chunkIndexStr, "total_chunks", totalChunksStr)
 
-	// 3️⃣ Validate required fields
-	if userId == "" || fileName == "" || fileHash == "" || nonce == "" {
-		log.Println("❌ Missing required fields")
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+	userId, ok := auth.ResolveUserID(w, r, userId)
+	if !ok {
 		return
 	}
 
-	if nonce == "" {
-		log.Println("❌ Missing nonce")
+	// 3️⃣ Validate required fields
+	if userId == "" || fileName == "" || fileHash == "" || nonce == "" {
+		logger.Warn("Upload is missing required fields")
+		api.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
 	}
 
 	// 4️⃣ Parse integers
 	chunkIndex, err := strconv.Atoi(chunkIndexStr)
 	if err != nil {
-		http.Error(w, "Invalid chunkIndex", http.StatusBadRequest)
+		api.Error(w, "Invalid chunkIndex", http.StatusBadRequest)
 		return
 	}
 	totalChunks, err := strconv.Atoi(totalChunksStr)
 	if err != nil {
-		http.Error(w, "Invalid totalChunks", http.StatusBadRequest)
+		api.Error(w, "Invalid totalChunks", http.StatusBadRequest)
 		return
 	}
 
@@ -96,8 +92,8 @@ func UploadHandler(w http.ResponseWriter, r *http.Request) {
 	var tags []string
 	if tagsRaw != "" {
 		if err := json.Unmarshal([]byte(tagsRaw), &tags); err != nil {
-			log.Println("❌ Invalid fileTags JSON:", tagsRaw)
-			http.Error(w, "Invalid fileTags JSON", http.StatusBadRequest)
+			logger.Warn("Invalid fileTags JSON", "err", err)
+			api.Error(w, "Invalid fileTags JSON", http.StatusBadRequest)
 			return
 		}
 	}
@@ -105,122 +101,276 @@ func UploadHandler(w http.ResponseWriter, r *http.Request) {
 	// 6️⃣ Read encrypted chunk
 	srcFile, header, err := r.FormFile("encryptedFile")
 	if err != nil {
-		log.Println("❌ Missing encrypted file:", err)
-		http.Error(w, "Missing encrypted file", http.StatusBadRequest)
+		logger.Warn("Upload is missing the encrypted file", "err", err)
+		api.Error(w, "Missing encrypted file", http.StatusBadRequest)
 		return
 	}
 	defer func() {
 		if err := srcFile.Close(); err != nil {
-			log.Println("error closing srcFile:", err)
+			logger.Warn("Failed to close uploaded chunk", "err", err)
 		}
 	}()
-	log.Println("✅ Received chunk file:", header.Filename)
-	log.Println("When uploading the nonce is:", nonce)
+
+	if !s.checkChunkLimits(w, totalChunks, header.Size) {
+		return
+	}
 
 	// 7️⃣ Handle fileID and DB row
 	if fileID == "" {
 		if chunkIndex == 0 {
+			if !s.ensureQuota(ctx, w, userId, header.Size) {
+				return
+			}
 			// Insert metadata and get fileID
-			log.Println("📝 Creating new file metadata row...")
-			err = DB.QueryRow(`
-                INSERT INTO files (owner_id, file_name, file_type, file_hash, nonce, description, tags, cid, file_size, created_at)
-                VALUES ($1,$2,$3,'',$4,$5,$6,'',0,$7)
-                RETURNING id
-            `, userId, fileName, fileType, nonce, description, pq.Array(tags), time.Now()).Scan(&fileID)
+			fileID, err = s.store.AddFile(ctx, store.File{
+				OwnerID:     userId,
+				FileName:    fileName,
+				FileType:    fileType,
+				Nonce:       nonce,
+				Description: description,
+				Tags:        tags,
+				CreatedAt:   s.now(),
+			})
 			if err != nil {
-				log.Println("❌ DB insert error:", err)
-				http.Error(w, "Failed to create file metadata", http.StatusInternalServerError)
+				logger.Error("Failed to insert file metadata", "err", err)
+				api.Error(w, "Failed to create file metadata", http.StatusInternalServerError)
+				return
+			}
+			logger.Debug("File metadata created", "file_id", fileID)
+
+			if err := s.store.AddUploadSession(ctx, store.UploadSession{FileID: fileID, OwnerID: userId, TotalChunks: totalChunks}); err != nil {
+				logger.Error("Failed to create upload session", "file_id", fileID, "err", err)
+				api.Error(w, "Failed to create upload session", http.StatusInternalServerError)
 				return
 			}
-			log.Println("✅ File metadata created, fileID:", fileID)
 		} else {
-			log.Println("❌ Missing fileId for non-first chunk")
-			http.Error(w, "fileId is required for parallel upload", http.StatusBadRequest)
+			logger.Warn("Missing fileId for a chunk after the first", "chunk_index", chunkIndex)
+			api.Error(w, "fileId is required for parallel upload", http.StatusBadRequest)
 			return
 		}
 	}
 
-	// 8️⃣ Upload chunk to OwnCloud temp folder
+	// 8️⃣ Validate the chunk against the upload session
+	session, err := s.store.UploadSession(ctx, fileID)
+	if errors.Is(err, store.ErrNotFound) {
+		logger.Warn("No upload session for file", "file_id", fileID)
+		api.Error(w, "Upload session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to load upload session", "file_id", fileID, "err", err)
+		api.Error(w, "Failed to load upload session", http.StatusInternalServerError)
+		return
+	}
+	if session.OwnerID != userId {
+		api.Error(w, "Unauthorized: You don't own this upload", http.StatusForbidden)
+		return
+	}
+	switch session.Status {
+	case UploadStatusComplete:
+		api.Error(w, "Upload already completed", http.StatusConflict)
+		return
+	case UploadStatusAssembling:
+		// the chunks are being merged; a chunk stored now could be deleted
+		// with the rest once the merge finishes
+		api.Error(w, "Upload is being assembled", http.StatusConflict)
+		return
+	}
+	if totalChunks <= 0 || chunkIndex < 0 || chunkIndex >= totalChunks {
+		api.Error(w, "chunkIndex out of range", http.StatusBadRequest)
+		return
+	}
+	if session.TotalChunks == 0 {
+		if err := s.store.SetUploadTotal(ctx, fileID, totalChunks); err != nil {
+			logger.Error("Failed to record totalChunks", "file_id", fileID, "err", err)
+			api.Error(w, "Failed to update upload session", http.StatusInternalServerError)
+			return
+		}
+		session.TotalChunks = totalChunks
+	} else if session.TotalChunks != totalChunks {
+		api.Error(w, fmt.Sprintf("totalChunks does not match upload session (%d)", session.TotalChunks), http.StatusConflict)
+		return
+	}
+
+	// The declared size was reserved by StartUploadHandler; only bytes
+	// beyond it need room in the quota.
+	received, replaced, err := s.store.ReceivedUploadBytes(ctx, fileID, chunkIndex)
+	if err != nil {
+		logger.Error("Failed to load received chunks", "file_id", fileID, "err", err)
+		api.Error(w, "Failed to load upload session", http.StatusInternalServerError)
+		return
+	}
+	if grow := received - replaced + header.Size - max(session.FileSize, received); grow > 0 && !s.ensureQuota(ctx, w, userId, grow) {
+		return
+	}
+
+	// 9️⃣ Upload chunk to OwnCloud temp folder, hashing it on the way
 	chunkFileName := fmt.Sprintf("%s_chunk_%d", fileID, chunkIndex)
-	log.Println("⬆️  Uploading chunk to OwnCloud temp:", chunkFileName)
-	if err := owncloud.UploadFileStream("temp", chunkFileName, srcFile); err != nil {
-		log.Println("❌ Failed to upload chunk to OwnCloud:", err)
-		http.Error(w, "Chunk upload failed", http.StatusInternalServerError)
+	chunkPath := "temp/" + chunkFileName
+	chunkHasher := sha256.New()
+	chunkCounter := &CountingWriter{w: chunkHasher}
+	logger.Debug("Uploading chunk to temp storage", "file_id", fileID, "chunk_index", chunkIndex)
+	if err := s.blobs.UploadFileStream(ctx, "temp", chunkFileName, io.TeeReader(srcFile, chunkCounter)); err != nil {
+		logger.Error("Failed to upload chunk", "file_id", fileID, "chunk_index", chunkIndex, "err", err)
+		api.Error(w, "Chunk upload failed", http.StatusInternalServerError)
+		return
+	}
+	metrics.UploadedBytes.With(metrics.KindUpload).Add(float64(chunkCounter.Count))
+	chunkHash := hex.EncodeToString(chunkHasher.Sum(nil))
+
+	if declared := r.FormValue("chunkHash"); declared != "" && !strings.EqualFold(declared, chunkHash) {
+		logger.Warn("Chunk hash mismatch", "file_id", fileID, "chunk_index", chunkIndex, "expected", declared, "got", chunkHash)
+		if err := s.blobs.DeleteFileTemp(ctx, chunkPath); err != nil {
+			logger.Warn("Failed to clean up chunk", "file_id", fileID, "err", err)
+		}
+		api.Error(w, "Chunk hash mismatch", http.StatusBadRequest)
+		return
+	}
+	if session.ChunkSize > 0 && chunkCounter.Count > session.ChunkSize {
+		logger.Warn("Chunk is larger than the session chunk size",
+			"file_id", fileID, "chunk_index", chunkIndex, "size", chunkCounter.Count, "chunk_size", session.ChunkSize)
+		if err := s.blobs.DeleteFileTemp(ctx, chunkPath); err != nil {
+			logger.Warn("Failed to clean up chunk", "file_id", fileID, "err", err)
+		}
+		api.Error(w, "Chunk exceeds declared chunkSize", http.StatusBadRequest)
 		return
 	}
 
-	// 9️⃣ If not last chunk → acknowledge
-	if chunkIndex != totalChunks-1 {
+	if err := s.store.RecordUploadChunk(ctx, fileID, store.UploadChunk{Index: chunkIndex, Size: chunkCounter.Count, Hash: chunkHash}); err != nil {
+		logger.Error("Failed to record chunk", "file_id", fileID, "chunk_index", chunkIndex, "err", err)
+		api.Error(w, "Failed to record chunk", http.StatusInternalServerError)
+		return
+	}
+
+	// 🔟 Assemble only once every chunk is present, and only in one request
+	claimed, err := s.store.ClaimUploadAssembly(ctx, fileID)
+	if err != nil {
+		logger.Error("Failed to check upload completeness", "file_id", fileID, "err", err)
+		api.Error(w, "Failed to update upload session", http.StatusInternalServerError)
+		return
+	}
+	if !claimed {
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(map[string]string{
-			"message":  fmt.Sprintf("Chunk %d uploaded", chunkIndex),
-			"fileHash": fileHash,
-			"fileId":   fileID,
+			"message":   fmt.Sprintf("Chunk %d uploaded", chunkIndex),
+			"fileHash":  fileHash,
+			"fileId":    fileID,
+			"chunkHash": chunkHash,
 		}); err != nil {
-			log.Println("Failed to encode response:", err)
+			logger.Warn("Failed to encode response", "err", err)
 		}
 		return
 	}
 
-	// 🔟 Last chunk → merge using low-memory streaming
-	log.Println("🔗 Starting file merge (streaming)...")
+	// Every chunk is in → merge using low-memory streaming
+	logger.Debug("Merging chunks", "file_id", fileID, "chunks", totalChunks)
+	mergeCtx, finishMerge := startMerge(ctx, metrics.KindUpload)
+	defer finishMerge(false)
+	releaseAssembly := func() {
+		if err := s.store.SetUploadStatus(mergeCtx, fileID, UploadStatusUploading); err != nil {
+			logger.Error("Failed to release upload session", "file_id", fileID, "err", err)
+		}
+	}
+
+	chunks, err := s.listUploadChunks(mergeCtx, fileID)
+	if err != nil || len(chunks) != totalChunks {
+		logger.Error("Failed to list upload chunks", "file_id", fileID, "err", err)
+		releaseAssembly()
+		api.Error(w, "Chunk merge failed", http.StatusInternalServerError)
+		return
+	}
 
 	// Open writer to final OwnCloud file
-	writer, err := owncloud.CreateFileStream("files", fileID)
+	writer, err := s.blobs.CreateFileStream(mergeCtx, "files", fileID)
 	if err != nil {
-		log.Println("❌ OwnCloud final upload failed:", err)
-		http.Error(w, "File assembly failed", http.StatusInternalServerError)
+		logger.Error("Failed to open the merged file for writing", "file_id", fileID, "err", err)
+		releaseAssembly()
+		api.Error(w, "File assembly failed", http.StatusInternalServerError)
 		return
 	}
-	defer func() {
-		if err := writer.Close(); err != nil {
-			log.Println("error closing writer:", err)
-		}
-	}()
+	// abort fails the backend write, so a partly merged file is never stored.
+	abort := func(err error) {
+		writer.CloseWithError(err)
+		releaseAssembly()
+	}
 
 	hasher := sha256.New()
 	countingWriter := &CountingWriter{w: io.MultiWriter(writer, hasher)}
 
-	for i := 0; i < totalChunks; i++ {
-		chunkPath := fmt.Sprintf("temp/%s_chunk_%d", fileID, i)
-		log.Println("🔄 Merging chunk:", chunkPath)
+	for _, chunk := range chunks {
+		chunkPath := fmt.Sprintf("temp/%s_chunk_%d", fileID, chunk.Index)
 
-		reader, err := owncloud.DownloadFileStreamTemp(chunkPath)
+		reader, err := s.blobs.DownloadFileStreamTemp(mergeCtx, chunkPath)
 		if err != nil {
-			log.Println("❌ Failed to open chunk:", err)
-			http.Error(w, "Chunk merge failed", http.StatusInternalServerError)
+			logger.Error("Failed to open chunk", "file_id", fileID, "chunk_index", chunk.Index, "err", err)
+			if err := s.store.ForgetUploadChunk(mergeCtx, fileID, chunk.Index); err != nil {
+				logger.Error("Failed to reset chunk record", "file_id", fileID, "chunk_index", chunk.Index, "err", err)
+			}
+			abort(err)
+			api.Error(w, "Chunk merge failed", http.StatusInternalServerError)
 			return
 		}
 
-		if _, err := io.Copy(countingWriter, reader); err != nil {
-			if err := reader.Close(); err != nil {
-				log.Println("error closing reader:", err)
-			}
-			log.Println("❌ Failed to copy chunk:", err)
-			http.Error(w, "Chunk merge failed", http.StatusInternalServerError)
+		verify := sha256.New()
+		copied, err := io.Copy(io.MultiWriter(countingWriter, verify), reader)
+		if closeErr := reader.Close(); closeErr != nil {
+			logger.Warn("Failed to close chunk", "file_id", fileID, "chunk_index", chunk.Index, "err", closeErr)
+		}
+		if err != nil {
+			logger.Error("Failed to copy chunk", "file_id", fileID, "chunk_index", chunk.Index, "err", err)
+			abort(err)
+			api.Error(w, "Chunk merge failed", http.StatusInternalServerError)
 			return
 		}
-		if err := reader.Close(); err != nil {
-			log.Println("error closing reader:", err)
+		if copied != chunk.Size || hex.EncodeToString(verify.Sum(nil)) != chunk.Hash {
+			logger.Error("Stored chunk does not match what was received", "file_id", fileID, "chunk_index", chunk.Index)
+			if err := s.store.ForgetUploadChunk(mergeCtx, fileID, chunk.Index); err != nil {
+				logger.Error("Failed to reset chunk record", "file_id", fileID, "chunk_index", chunk.Index, "err", err)
+			}
+			abort(errChunkMismatch)
+			api.Error(w, "Chunk merge failed", http.StatusInternalServerError)
+			return
 		}
+	}
 
-		// Delete temp chunk after successful copy
-		if err := owncloud.DeleteFileTemp(chunkPath); err != nil {
-			log.Println("Failed to cleanup chunk:", err)
-		}
+	// The backend only finishes writing the file when the stream is closed;
+	// nothing may be recorded or cleaned up until it has.
+	if err := writer.Close(); err != nil {
+		logger.Error("Failed to store the merged file", "file_id", fileID, "err", err)
+		releaseAssembly()
+		api.Error(w, "File assembly failed", http.StatusInternalServerError)
+		return
 	}
 
-	fileHashHex := hex.EncodeToString(hasher.Sum(nil))
-	log.Println("🔗 Final file hash:", fileHashHex)
-	log.Printf("📦 Final merged size: %d bytes", countingWriter.Count)
+	finishMerge(true)
 
-	_, err = DB.Exec(`
-        UPDATE files SET file_hash=$1, file_size=$2, cid=$3 WHERE id=$4
-    `, fileHashHex, countingWriter.Count, uploadPath+"/"+fileID, fileID)
+	// The hash and size are written before the session is completed and
+	// the chunks are deleted, so a failure here leaves an upload that can
+	// still be retried and that the janitor otherwise reclaims.
+	fileHashHex := hex.EncodeToString(hasher.Sum(nil))
+	err = s.store.SetFileBlob(ctx, fileID, fileHashHex, uploadPath+"/"+fileID, countingWriter.Count)
 	if err != nil {
-		log.Println("❌ DB update error:", err)
-	} else {
-		log.Println("✅ File metadata updated with final size and hash")
+		logger.Error("Failed to store final size and hash", "file_id", fileID, "err", err)
+		releaseAssembly()
+		api.Error(w, "Failed to store file metadata", http.StatusInternalServerError)
+		return
+	}
+	if err := s.store.SetUploadStatus(ctx, fileID, UploadStatusComplete); err != nil {
+		logger.Error("Failed to mark upload session complete", "file_id", fileID, "err", err)
+		releaseAssembly()
+		api.Error(w, "Failed to update upload session", http.StatusInternalServerError)
+		return
+	}
+	if err := s.store.LinkParentFolder(ctx, fileID); err != nil {
+		logger.Warn("Failed to link file to its folder", "file_id", fileID, "err", err)
+	}
+
+	// Delete temp chunks only once the upload is complete, so a failed merge
+	// can be retried without re-sending everything.
+	for _, chunk := range chunks {
+		if err := s.blobs.DeleteFileTemp(ctx, fmt.Sprintf("temp/%s_chunk_%d", fileID, chunk.Index)); err != nil {
+			logger.Warn("Failed to clean up chunk", "file_id", fileID, "err", err)
+		}
 	}
 
 	isViewOnlyReceived := false
@@ -232,33 +382,18 @@ func UploadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if isViewOnlyReceived {
-		log.Println("🔗 Detected view-only received file, updating shared_files_view...")
-		_, err = DB.Exec(`
-			UPDATE shared_files_view 
-			SET newfile_id = $1
-			WHERE recipient_id = $2 
-			AND revoked = FALSE 
-			AND access_granted = TRUE
-			AND EXISTS (
-				SELECT 1 FROM files f 
-				WHERE f.id = shared_files_view.file_id 
-			)
-		`, fileID, userId)
-
-		if err != nil {
-			log.Println("❌ Failed to update shared_files_view newfile_id:", err)
-		} else {
-			log.Println("✅ Updated shared_files_view with new file ID:", fileID)
+		if err := s.store.SetViewShareCopy(ctx, userId, fileID); err != nil {
+			logger.Error("Failed to link view-only share to the new file", "file_id", fileID, "err", err)
 		}
 	}
 
-	log.Println("🎉 File uploaded successfully:", fileID)
+	logger.Info("File uploaded", "file_id", fileID, "size", countingWriter.Count)
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]string{
 		"message": "File uploaded and metadata stored",
 		"fileId":  fileID,
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
@@ -270,48 +405,84 @@ type StartUploadRequest struct {
 	FileTags        []string `json:"fileTags"`
 	Path            string   `json:"path"`
 	Nonce           string   `json:"nonce"`
+	// Optional; when known up front they let the server reject chunks that
+	// do not fit the declared layout. TotalChunks can also be supplied by
+	// the first UploadHandler call instead.
+	TotalChunks int   `json:"totalChunks"`
+	ChunkSize   int64 `json:"chunkSize"`
+	FileSize    int64 `json:"fileSize"`
 }
 
-func StartUploadHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("==== Start Upload Request ====")
+func (s *Server) StartUploadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 
 	var req StartUploadRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Println("❌ Invalid JSON:", err)
-		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		logger.Warn("Invalid JSON body", "err", err)
+		api.Error(w, "Invalid JSON body", http.StatusBadRequest)
 		return
 	}
 
-	log.Println("userId is :", req.UserID)
-	log.Println("Filename is :", req.FileName)
-	log.Println("fileType is :", req.FileType)
-	log.Println("description is: ", req.FileDescription)
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
+		return
+	}
+	req.UserID = userID
 
 	if req.UserID == "" || req.FileName == "" {
-		http.Error(w, "Missing userId or fileName", http.StatusBadRequest)
+		api.Error(w, "Missing userId or fileName", http.StatusBadRequest)
+		return
+	}
+
+	if req.TotalChunks < 0 || req.ChunkSize < 0 || req.FileSize < 0 {
+		api.Error(w, "totalChunks, chunkSize and fileSize must not be negative", http.StatusBadRequest)
+		return
+	}
+	if !s.checkChunkLimits(w, req.TotalChunks, req.ChunkSize) {
+		return
+	}
+
+	// the declared size stays reserved until the upload completes
+	if req.FileSize > 0 && !s.ensureQuota(ctx, w, req.UserID, req.FileSize) {
 		return
 	}
 
 	// Insert initial metadata with empty hash and size 0
-	log.Println("Made it to inserting file metadata in the database")
-	var fileID string
-	err := DB.QueryRow(`
-        INSERT INTO files (owner_id, file_name, file_type, file_hash, nonce, description, tags, cid, file_size, created_at)
-        VALUES ($1,$2,$3,'',$4,$5,$6,$7,0,$8)
-        RETURNING id
-    `, req.UserID, req.FileName, req.FileType, req.Nonce, req.FileDescription, pq.Array(req.FileTags), req.Path, time.Now()).Scan(&fileID)
+	fileID, err := s.store.AddFile(ctx, store.File{
+		OwnerID:     req.UserID,
+		FileName:    req.FileName,
+		FileType:    req.FileType,
+		Nonce:       req.Nonce,
+		Description: req.FileDescription,
+		Tags:        req.FileTags,
+		CID:         req.Path,
+		CreatedAt:   s.now(),
+	})
 	if err != nil {
-		log.Println("❌ DB insert error:", err)
-		http.Error(w, "Failed to start upload", http.StatusInternalServerError)
+		logger.Error("Failed to insert file metadata", "err", err)
+		api.Error(w, "Failed to start upload", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.store.AddUploadSession(ctx, store.UploadSession{
+		FileID:      fileID,
+		OwnerID:     req.UserID,
+		TotalChunks: req.TotalChunks,
+		ChunkSize:   req.ChunkSize,
+		FileSize:    req.FileSize,
+	}); err != nil {
+		logger.Error("Failed to create upload session", "file_id", fileID, "err", err)
+		api.Error(w, "Failed to start upload", http.StatusInternalServerError)
 		return
 	}
 
-	log.Println("✅ Upload started, fileID:", fileID)
+	logger.Info("Upload started", "file_id", fileID, "total_chunks", req.TotalChunks)
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]string{
 		"message": "Upload session started",
 		"fileId":  fileID,
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
@@ -0,0 +1,133 @@
+// uploadSession.go
+package fileHandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+)
+
+// Upload session states. A session starts in "uploading", moves to
+// "assembling" while exactly one request merges the chunks, and ends in
+// "complete". A failed merge puts it back to "uploading" so the client can
+// re-send the chunks reported as missing.
+const (
+	UploadStatusUploading  = store.UploadStatusUploading
+	UploadStatusAssembling = store.UploadStatusAssembling
+	UploadStatusComplete   = store.UploadStatusComplete
+)
+
+// errChunkMismatch aborts a merge when a stored chunk no longer matches the
+// size and hash recorded when it was received.
+var errChunkMismatch = errors.New("stored chunk does not match its record")
+
+// UploadChunk is a chunk the server has received and stored under temp/.
+type UploadChunk struct {
+	Index      int       `json:"index"`
+	Size       int64     `json:"size"`
+	Hash       string    `json:"hash"`
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+// listUploadChunks returns the chunks received for fileID in index order.
+func (s *Server) listUploadChunks(ctx context.Context, fileID string) ([]UploadChunk, error) {
+	received, err := s.store.ListUploadChunks(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	chunks := make([]UploadChunk, len(received))
+	for i, c := range received {
+		chunks[i] = UploadChunk(c)
+	}
+	return chunks, nil
+}
+
+// missingChunks lists the indices in [0, total) that have not been received.
+func missingChunks(total int, received []UploadChunk) []int {
+	seen := make(map[int]bool, len(received))
+	for _, c := range received {
+		seen[c.Index] = true
+	}
+	missing := []int{}
+	for i := 0; i < total; i++ {
+		if !seen[i] {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// UploadStatusResponse tells a client which chunks to (re-)send when resuming
+// an interrupted upload.
+type UploadStatusResponse struct {
+	FileID         string        `json:"fileId"`
+	Status         string        `json:"status"`
+	TotalChunks    int           `json:"totalChunks"`
+	ChunkSize      int64         `json:"chunkSize"`
+	FileSize       int64         `json:"fileSize"`
+	ReceivedChunks []UploadChunk `json:"receivedChunks"`
+	MissingChunks  []int         `json:"missingChunks"`
+	Complete       bool          `json:"complete"`
+}
+
+func (s *Server) UploadStatusHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	fileID := r.URL.Query().Get("fileId")
+	userID, ok := auth.ResolveUserID(w, r, r.URL.Query().Get("userId"))
+	if !ok {
+		return
+	}
+	if fileID == "" || userID == "" {
+		api.Error(w, "Missing fileId or userId", http.StatusBadRequest)
+		return
+	}
+
+	session, err := s.store.UploadSession(ctx, fileID)
+	if errors.Is(err, store.ErrNotFound) {
+		api.Error(w, "Upload session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to load upload session", "err", err)
+		api.Error(w, "Failed to load upload session", http.StatusInternalServerError)
+		return
+	}
+	if session.OwnerID != userID {
+		api.Error(w, "Unauthorized: You don't own this upload", http.StatusForbidden)
+		return
+	}
+
+	chunks, err := s.listUploadChunks(ctx, fileID)
+	if err != nil {
+		logger.Error("Failed to list upload chunks", "err", err)
+		api.Error(w, "Failed to load upload session", http.StatusInternalServerError)
+		return
+	}
+
+	resp := UploadStatusResponse{
+		FileID:         session.FileID,
+		Status:         session.Status,
+		TotalChunks:    session.TotalChunks,
+		ChunkSize:      session.ChunkSize,
+		FileSize:       session.FileSize,
+		ReceivedChunks: chunks,
+		MissingChunks:  missingChunks(session.TotalChunks, chunks),
+		Complete:       session.Status == UploadStatusComplete,
+	}
+	if resp.Complete {
+		resp.MissingChunks = []int{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Warn("Failed to encode response", "err", err)
+	}
+}
@@ -0,0 +1,376 @@
+package fileHandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+)
+
+// FileVersion is a previous state of a file: its blob is kept under
+// versions/<fileId>/<version> and the nonce, hash and size it had are kept
+// in file_versions.
+type FileVersion struct {
+	Version   int       `json:"version"`
+	Nonce     string    `json:"nonce"`
+	FileHash  string    `json:"fileHash"`
+	FileSize  int64     `json:"fileSize"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// FileVersionRequest addresses one file, or one version of it. Version is
+// a json.Number so it may also be sent as a string, as the v1 routes do.
+type FileVersionRequest struct {
+	UserID  string      `json:"userId"`
+	FileID  string      `json:"fileId"`
+	Version json.Number `json:"version"`
+}
+
+// PruneFileVersionsRequest selects the versions to delete: everything
+// beyond the newest Keep versions and everything older than OlderThanDays.
+// At least one of them must be set.
+type PruneFileVersionsRequest struct {
+	UserID        string `json:"userId"`
+	FileID        string `json:"fileId"`
+	Keep          *int   `json:"keep"`
+	OlderThanDays *int   `json:"olderThanDays"`
+}
+
+// snapshotFileVersion saves the current blob and metadata of a file as its
+// next version and returns the version number. Callers must have checked
+// that the user may modify the file. The file row stays locked until the
+// version is recorded, so concurrent updates and restores of the same file
+// take consecutive numbers instead of colliding on the same one.
+func (s *Server) snapshotFileVersion(ctx context.Context, fileID, createdBy string) (int, error) {
+	logger := logging.FromContext(ctx)
+	saved := 0
+	v, err := s.store.AddFileVersion(ctx, fileID, createdBy, func(version int) (string, error) {
+		if err := s.blobs.SaveVersion(ctx, fileID, version); err != nil {
+			return "", err
+		}
+		saved = version
+		return owncloud.VersionPath(fileID, version), nil
+	})
+	if err != nil {
+		if saved != 0 {
+			if delErr := s.blobs.DeleteVersion(ctx, fileID, saved); delErr != nil {
+				logger.Error("Failed to remove unrecorded version blob", "err", delErr)
+			}
+		}
+		return 0, err
+	}
+
+	// lets downloads of the version mark it corrupted on a hash mismatch
+	if v.FileHash != "" {
+		if err := s.recordBlobHash(ctx, v.BlobPath, fileID, v.FileHash, v.FileSize); err != nil {
+			logger.Error("Failed to record version hash", "err", err)
+		}
+	}
+
+	logger.Info("File version saved", "file_id", fileID, "version", v.Version)
+	return v.Version, nil
+}
+
+// ownedFileName answers 404 unless userID owns fileID and it is not in the
+// trash. The caller must return when ok is false.
+func (s *Server) ownedFileName(ctx context.Context, w http.ResponseWriter, userID, fileID string) (fileName string, ok bool) {
+	logger := logging.FromContext(ctx)
+	f, err := s.store.File(ctx, fileID)
+	if errors.Is(err, store.ErrNotFound) || err == nil && (f.OwnerID != userID || f.DeletedAt != nil) {
+		api.Error(w, "File not found", http.StatusNotFound)
+		return "", false
+	}
+	if err != nil {
+		logger.Error("Failed to look up file", "err", err)
+		api.Error(w, "Database error", http.StatusInternalServerError)
+		return "", false
+	}
+	return f.FileName, true
+}
+
+// decodeVersionRequest parses a FileVersionRequest and resolves the user.
+// When needVersion is set the version must be a positive integer. The
+// caller must return when ok is false.
+func decodeVersionRequest(w http.ResponseWriter, r *http.Request, needVersion bool) (req FileVersionRequest, version int, ok bool) {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return req, 0, false
+	}
+
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
+		return req, 0, false
+	}
+	req.UserID = userID
+
+	if req.UserID == "" || req.FileID == "" {
+		api.Error(w, "Missing userId or fileId", http.StatusBadRequest)
+		return req, 0, false
+	}
+	if !needVersion {
+		return req, 0, true
+	}
+
+	version, err := strconv.Atoi(req.Version.String())
+	if err != nil || version < 1 {
+		api.Error(w, "version must be a positive integer", http.StatusBadRequest)
+		return req, 0, false
+	}
+	return req, version, true
+}
+
+func (s *Server) listFileVersions(ctx context.Context, fileID string) ([]FileVersion, error) {
+	stored, err := s.store.ListFileVersions(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]FileVersion, len(stored))
+	for i, v := range stored {
+		versions[i] = FileVersion{
+			Version:   v.Version,
+			Nonce:     v.Nonce,
+			FileHash:  v.FileHash,
+			FileSize:  v.FileSize,
+			CreatedBy: v.CreatedBy,
+			CreatedAt: v.CreatedAt,
+		}
+	}
+	return versions, nil
+}
+
+// ListFileVersionsHandler returns the saved versions of a file, newest first.
+func (s *Server) ListFileVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	req, _, ok := decodeVersionRequest(w, r, false)
+	if !ok {
+		return
+	}
+	if _, ok := s.ownedFileName(ctx, w, req.UserID, req.FileID); !ok {
+		return
+	}
+
+	versions, err := s.listFileVersions(ctx, req.FileID)
+	if err != nil {
+		logger.Error("Failed to list file versions", "err", err)
+		api.Error(w, "Failed to list file versions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"fileId":   req.FileID,
+		"versions": versions,
+	}); err != nil {
+		logger.Warn("Failed to encode response", "err", err)
+	}
+}
+
+// DownloadFileVersionHandler streams the blob of one version, with the same
+// range, conditional and integrity handling as DownloadHandler.
+func (s *Server) DownloadFileVersionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	req, version, ok := decodeVersionRequest(w, r, true)
+	if !ok {
+		return
+	}
+	fileName, ok := s.ownedFileName(ctx, w, req.UserID, req.FileID)
+	if !ok {
+		return
+	}
+
+	v, err := s.store.FileVersion(ctx, req.FileID, version)
+	if errors.Is(err, store.ErrNotFound) {
+		api.Error(w, "Version not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to load file version", "err", err)
+		api.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	size := v.FileSize
+	if v.FileHash == "" {
+		size = -1
+	}
+
+	s.serveBlob(w, r, blobDownload{
+		target: integrityTarget{
+			fileID:    req.FileID,
+			ownerID:   req.UserID,
+			path:      owncloud.VersionPath(req.FileID, version),
+			expected:  v.FileHash,
+			corrupted: v.CorruptedAt != nil,
+		},
+		size: size,
+		open: func() (io.ReadCloser, error) { return s.blobs.DownloadVersionStream(ctx, req.FileID, version) },
+		openRange: func(offset, length int64) (io.ReadCloser, error) {
+			return s.blobs.DownloadVersionRange(ctx, req.FileID, version, offset, length)
+		},
+		failMsg: "Download failed",
+	}, func(h http.Header) {
+		h.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+		h.Set("X-File-Name", fileName)
+		h.Set("X-Nonce", v.Nonce)
+		h.Set("X-File-Version", strconv.Itoa(version))
+	})
+}
+
+// RestoreFileVersionHandler makes a saved version the current file. The
+// state being replaced is saved as a new version first, so a restore can
+// itself be undone.
+func (s *Server) RestoreFileVersionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	req, version, ok := decodeVersionRequest(w, r, true)
+	if !ok {
+		return
+	}
+	if _, ok := s.ownedFileName(ctx, w, req.UserID, req.FileID); !ok {
+		return
+	}
+
+	v, err := s.store.FileVersion(ctx, req.FileID, version)
+	if errors.Is(err, store.ErrNotFound) {
+		api.Error(w, "Version not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to load file version", "err", err)
+		api.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	savedVersion, err := s.snapshotFileVersion(ctx, req.FileID, req.UserID)
+	if err != nil {
+		logger.Error("Failed to save current version before restore", "err", err)
+		api.Error(w, "Failed to save the current version", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.blobs.RestoreVersion(ctx, req.FileID, version); err != nil {
+		logger.Error("Failed to restore version blob", "err", err)
+		api.Error(w, "Failed to restore version", http.StatusInternalServerError)
+		return
+	}
+
+	err = s.store.SetFileContent(ctx, req.UserID, req.FileID, v.Nonce, v.FileHash, v.FileSize)
+	if err != nil {
+		logger.Error("Failed to update file metadata after restore", "err", err)
+		api.Error(w, "Failed to update file metadata", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("File version restored", "file_id", req.FileID, "version", version, "saved_as", savedVersion)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":         "File version restored",
+		"fileId":          req.FileID,
+		"restoredVersion": version,
+		"savedVersion":    savedVersion,
+		"fileHash":        v.FileHash,
+	}); err != nil {
+		logger.Warn("Failed to encode response", "err", err)
+	}
+}
+
+// versionsToPrune picks the versions (sorted newest first) that fall
+// outside the newest keep versions or were created before cutoff. A nil
+// keep or a zero cutoff disables that rule.
+func versionsToPrune(versions []FileVersion, keep *int, cutoff time.Time) []FileVersion {
+	var prune []FileVersion
+	for i, v := range versions {
+		if (keep != nil && i >= *keep) || (!cutoff.IsZero() && v.CreatedAt.Before(cutoff)) {
+			prune = append(prune, v)
+		}
+	}
+	return prune
+}
+
+// PruneFileVersionsHandler deletes saved versions by count and/or age.
+func (s *Server) PruneFileVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	var req PruneFileVersionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
+		return
+	}
+	req.UserID = userID
+
+	if req.UserID == "" || req.FileID == "" {
+		api.Error(w, "Missing userId or fileId", http.StatusBadRequest)
+		return
+	}
+	if req.Keep == nil && req.OlderThanDays == nil {
+		api.Error(w, "Provide keep and/or olderThanDays", http.StatusBadRequest)
+		return
+	}
+	if (req.Keep != nil && *req.Keep < 0) || (req.OlderThanDays != nil && *req.OlderThanDays < 0) {
+		api.Error(w, "keep and olderThanDays must not be negative", http.StatusBadRequest)
+		return
+	}
+	if _, ok := s.ownedFileName(ctx, w, req.UserID, req.FileID); !ok {
+		return
+	}
+
+	versions, err := s.listFileVersions(ctx, req.FileID)
+	if err != nil {
+		logger.Error("Failed to list file versions", "err", err)
+		api.Error(w, "Failed to list file versions", http.StatusInternalServerError)
+		return
+	}
+
+	var cutoff time.Time
+	if req.OlderThanDays != nil {
+		cutoff = s.now().AddDate(0, 0, -*req.OlderThanDays)
+	}
+
+	pruned := []int{}
+	for _, v := range versionsToPrune(versions, req.Keep, cutoff) {
+		if err := s.blobs.DeleteVersion(ctx, req.FileID, v.Version); err != nil {
+			// the blob may already be gone; the row is still removed so the
+			// version stops being listed
+			logger.Error("Failed to delete version blob", "err", err)
+		}
+		if err := s.store.DeleteFileVersion(ctx, req.FileID, v.Version); err != nil {
+			logger.Error("Failed to delete file version", "err", err)
+			api.Error(w, "Failed to prune file versions", http.StatusInternalServerError)
+			return
+		}
+		if err := s.store.DeleteBlobHash(ctx, owncloud.VersionPath(req.FileID, v.Version)); err != nil {
+			logger.Error("Failed to delete version hash", "err", err)
+		}
+		pruned = append(pruned, v.Version)
+	}
+
+	logger.Info("File versions pruned", "file_id", req.FileID, "pruned", len(pruned))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "File versions pruned",
+		"fileId":  req.FileID,
+		"pruned":  pruned,
+	}); err != nil {
+		logger.Warn("Failed to encode response", "err", err)
+	}
+}
@@ -0,0 +1,190 @@
+// Package health serves the liveness and readiness probes of the file
+// service. Liveness only says the process is serving requests; readiness
+// checks the dependencies a request needs (PostgreSQL and the storage
+// backend) and fails while any of them is unreachable.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+)
+
+// DefaultTimeout bounds each dependency check when Checker.Timeout is zero.
+const DefaultTimeout = 2 * time.Second
+
+// Statuses reported by the probes.
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusAlive    = "alive"
+	StatusReady    = "ready"
+	StatusNotReady = "not_ready"
+)
+
+// Check reports whether a dependency is reachable. It must give up when ctx
+// is done.
+type Check func(ctx context.Context) error
+
+// Checker runs the readiness checks of the service.
+type Checker struct {
+	// Timeout bounds each check; checks run concurrently, so it also bounds
+	// the whole probe.
+	Timeout time.Duration
+
+	names  []string
+	checks map[string]Check
+}
+
+// New returns a Checker with no checks that times each one out after
+// timeout, or DefaultTimeout if timeout is not positive.
+func New(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{Timeout: timeout, checks: make(map[string]Check)}
+}
+
+// Add registers a dependency check under name, e.g. "postgresql".
+func (c *Checker) Add(name string, check Check) {
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// Result is the outcome of one dependency check. Errors are logged rather
+// than returned, since the probes are served without authentication.
+type Result struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	err       error
+}
+
+// Report is the body of a readiness probe.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Ready reports whether every check passed.
+func (r Report) Ready() bool {
+	return r.Status == StatusReady
+}
+
+// Run runs every check concurrently, each with its own timeout.
+func (c *Checker) Run(ctx context.Context) Report {
+	results := make([]Result, len(c.names))
+	var wg sync.WaitGroup
+	for i, name := range c.names {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = c.run(ctx, check)
+		}(i, c.checks[name])
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusReady, Checks: make(map[string]Result, len(c.names))}
+	for i, name := range c.names {
+		report.Checks[name] = results[i]
+		if results[i].Status != StatusUp {
+			report.Status = StatusNotReady
+		}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	if err == nil && ctx.Err() != nil {
+		// the check ignored its deadline; its answer came too late
+		err = ctx.Err()
+	}
+	res := Result{Status: StatusUp, LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		res.Status = StatusDown
+		res.err = err
+	}
+	return res
+}
+
+// LiveHandler serves /livez. It checks nothing but that the process can
+// answer, so an orchestrator restarts the service only when it is wedged,
+// not when a dependency is down.
+func LiveHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, map[string]string{"status": StatusAlive})
+}
+
+// ReadyHandler serves /readyz: 200 when every dependency is reachable and
+// 503 otherwise, with the status and latency of each check.
+func (c *Checker) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	report := c.Run(r.Context())
+	logFailures(r, report)
+
+	code := http.StatusOK
+	if !report.Ready() {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, r, code, report)
+}
+
+// LegacyResponse is the body /health has always returned.
+type LegacyResponse struct {
+	Status   string            `json:"status"`
+	Services map[string]string `json:"services"`
+	Message  string            `json:"message"`
+}
+
+// LegacyHandler serves /health for callers written against its original
+// body. It runs the readiness checks and, like /readyz, answers 503 when
+// the service is degraded.
+func (c *Checker) LegacyHandler(w http.ResponseWriter, r *http.Request) {
+	report := c.Run(r.Context())
+	logFailures(r, report)
+
+	resp := LegacyResponse{
+		Status:   "healthy",
+		Services: make(map[string]string, len(report.Checks)),
+		Message:  "File service health check",
+	}
+	for name, res := range report.Checks {
+		if res.Status == StatusUp {
+			resp.Services[name] = "connected"
+		} else {
+			resp.Services[name] = "disconnected"
+		}
+	}
+	code := http.StatusOK
+	if !report.Ready() {
+		resp.Status = "degraded"
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, r, code, resp)
+}
+
+func logFailures(r *http.Request, report Report) {
+	logger := logging.FromContext(r.Context())
+	for name, res := range report.Checks {
+		if res.err != nil {
+			logger.Warn("Readiness check failed", "check", name, "latency_ms", res.LatencyMs, "err", res.err)
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.FromContext(r.Context()).Warn("Failed to encode response", "err", err)
+	}
+}
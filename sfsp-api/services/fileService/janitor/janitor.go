@@ -0,0 +1,558 @@
+// Package janitor reclaims storage and metadata left behind by uploads and
+// sends that were abandoned part-way through, purges files that have been in
+// the trash for longer than the retention period, and ends expired shares and share links.
+package janitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/database"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/storage"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/tracing"
+)
+
+// Config controls how aggressively the janitor reclaims abandoned uploads.
+type Config struct {
+	// TTL is how long an upload may sit idle before it is considered
+	// abandoned.
+	TTL time.Duration
+	// Interval is the time between sweeps.
+	Interval time.Duration
+	// TrashRetention is how long a deleted file stays in the trash before
+	// it is purged.
+	TrashRetention time.Duration
+}
+
+// DefaultConfig is used for zero fields in Config.
+var DefaultConfig = Config{
+	TTL:            24 * time.Hour,
+	Interval:       time.Hour,
+	TrashRetention: 30 * 24 * time.Hour,
+}
+
+// Report describes what a single sweep reclaimed.
+type Report struct {
+	StartedAt         time.Time `json:"startedAt"`
+	FinishedAt        time.Time `json:"finishedAt"`
+	StaleSessions     int       `json:"staleSessions"`
+	FileRowsDeleted   int       `json:"fileRowsDeleted"`
+	TempChunksDeleted int       `json:"tempChunksDeleted"`
+	BytesReclaimed    int64     `json:"bytesReclaimed"`
+	TrashPurged       int       `json:"trashPurged"`
+	SharesExpired     int       `json:"sharesExpired"`
+	Errors            []string  `json:"errors"`
+}
+
+// Stats aggregates every sweep since the process started.
+type Stats struct {
+	Runs                   int       `json:"runs"`
+	TTLSeconds             int64     `json:"ttlSeconds"`
+	IntervalSeconds        int64     `json:"intervalSeconds"`
+	TrashRetentionSeconds  int64     `json:"trashRetentionSeconds"`
+	TotalStaleSessions     int       `json:"totalStaleSessions"`
+	TotalFileRowsDeleted   int       `json:"totalFileRowsDeleted"`
+	TotalTempChunksDeleted int       `json:"totalTempChunksDeleted"`
+	TotalBytesReclaimed    int64     `json:"totalBytesReclaimed"`
+	TotalTrashPurged       int       `json:"totalTrashPurged"`
+	TotalSharesExpired     int       `json:"totalSharesExpired"`
+	LastRun                *Report   `json:"lastRun,omitempty"`
+	NextRunAt              time.Time `json:"nextRunAt,omitempty"`
+}
+
+// Janitor periodically deletes stale upload sessions, their temp chunks and
+// the half-created files rows they belong to.
+type Janitor struct {
+	store   store.Store
+	backend storage.Backend
+	cfg     Config
+	now     func() time.Time
+
+	runMu sync.Mutex // serialises sweeps
+
+	mu    sync.Mutex // guards stats
+	stats Stats
+}
+
+// New returns a janitor that sweeps db and backend.
+func New(db database.Repository, backend storage.Backend, cfg Config) *Janitor {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultConfig.TTL
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultConfig.Interval
+	}
+	if cfg.TrashRetention <= 0 {
+		cfg.TrashRetention = DefaultConfig.TrashRetention
+	}
+	j := &Janitor{
+		backend: backend,
+		cfg:     cfg,
+		now:     time.Now,
+		stats: Stats{
+			TTLSeconds:            int64(cfg.TTL / time.Second),
+			IntervalSeconds:       int64(cfg.Interval / time.Second),
+			TrashRetentionSeconds: int64(cfg.TrashRetention / time.Second),
+		},
+	}
+	if db != nil {
+		j.store = store.NewPostgres(db)
+	}
+	return j
+}
+
+// SetStore replaces the store built from the database, e.g. with
+// store.NewMemory in tests.
+func (j *Janitor) SetStore(st store.Store) {
+	j.store = st
+}
+
+// SetClock overrides the time source; used by tests.
+func (j *Janitor) SetClock(now func() time.Time) {
+	j.now = now
+}
+
+// Start runs a sweep every Interval until ctx is cancelled.
+func (j *Janitor) Start(ctx context.Context) {
+	logger := logging.FromContext(ctx)
+	go func() {
+		ticker := time.NewTicker(j.cfg.Interval)
+		defer ticker.Stop()
+
+		j.setNextRun()
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Info("Janitor stopped")
+				return
+			case <-ticker.C:
+				report, err := j.RunOnce(ctx)
+				if err != nil {
+					logger.Error("Janitor sweep failed", "err", err)
+				} else {
+					logger.Info("Janitor sweep finished",
+						"stale_sessions", report.StaleSessions, "file_rows_deleted", report.FileRowsDeleted,
+						"temp_chunks_deleted", report.TempChunksDeleted, "trash_purged", report.TrashPurged,
+						"bytes_reclaimed", report.BytesReclaimed, "shares_expired", report.SharesExpired)
+				}
+				j.setNextRun()
+			}
+		}
+	}()
+}
+
+func (j *Janitor) setNextRun() {
+	j.mu.Lock()
+	j.stats.NextRunAt = j.now().Add(j.cfg.Interval)
+	j.mu.Unlock()
+}
+
+// RunOnce performs a single sweep. Failures on individual items are
+// collected in the report; an error is only returned if the sweep could not
+// run at all.
+func (j *Janitor) RunOnce(ctx context.Context) (report Report, err error) {
+	j.runMu.Lock()
+	defer j.runMu.Unlock()
+	ctx, span := tracing.Start(ctx, "janitor sweep")
+	defer func() { tracing.End(span, err) }()
+
+	report = Report{StartedAt: j.now(), Errors: []string{}}
+	cutoff := report.StartedAt.Add(-j.cfg.TTL)
+
+	if err := j.reclaimStaleSessions(ctx, cutoff, &report); err != nil {
+		return report, err
+	}
+	if err := j.reclaimStaleLinkUploads(ctx, cutoff, &report); err != nil {
+		return report, err
+	}
+	if err := j.reclaimOrphanedFiles(ctx, cutoff, &report); err != nil {
+		return report, err
+	}
+	if err := j.reclaimTempChunks(ctx, cutoff, &report); err != nil {
+		return report, err
+	}
+	if err := j.purgeTrash(ctx, report.StartedAt.Add(-j.cfg.TrashRetention), &report); err != nil {
+		return report, err
+	}
+	if err := j.expireShares(ctx, report.StartedAt, &report); err != nil {
+		return report, err
+	}
+	if err := j.expireLinks(ctx, report.StartedAt, &report); err != nil {
+		return report, err
+	}
+
+	report.FinishedAt = j.now()
+	j.record(report)
+	return report, nil
+}
+
+func (j *Janitor) record(r Report) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.stats.Runs++
+	j.stats.TotalStaleSessions += r.StaleSessions
+	j.stats.TotalFileRowsDeleted += r.FileRowsDeleted
+	j.stats.TotalTempChunksDeleted += r.TempChunksDeleted
+	j.stats.TotalBytesReclaimed += r.BytesReclaimed
+	j.stats.TotalTrashPurged += r.TrashPurged
+	j.stats.TotalSharesExpired += r.SharesExpired
+	j.stats.LastRun = &r
+}
+
+// Stats returns a snapshot of what the janitor has reclaimed so far.
+func (j *Janitor) Stats() Stats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	s := j.stats
+	if s.LastRun != nil {
+		last := *s.LastRun
+		s.LastRun = &last
+	}
+	return s
+}
+
+// reclaimStaleSessions removes upload sessions that have not seen a chunk
+// since cutoff, together with their temp chunks, any partially assembled
+// blob and the files row if it was never completed.
+func (j *Janitor) reclaimStaleSessions(ctx context.Context, cutoff time.Time, report *Report) error {
+	sessions, err := j.store.StaleUploadSessions(ctx, cutoff)
+	if err != nil {
+		return fmt.Errorf("query stale upload sessions: %w", err)
+	}
+
+	for _, s := range sessions {
+		chunks, err := j.recordedChunks(ctx, s.FileID)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("session %s: %v", s.FileID, err))
+			continue
+		}
+		// Chunks past the highest recorded index may have been written
+		// without being recorded, so sweep every slot the upload could use.
+		slots := chunks.slots
+		if s.TotalChunks > slots {
+			slots = s.TotalChunks
+		}
+		for i := 0; i < slots; i++ {
+			j.removeBlob(fmt.Sprintf("temp/%s_chunk_%d", s.FileID, i), report)
+		}
+		// A merge that died half-way may have left a partial final blob.
+		j.removeBlob("files/"+s.FileID, report)
+
+		deleted, err := j.store.DeleteUploadSession(ctx, s.FileID)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("session %s: %v", s.FileID, err))
+			continue
+		}
+		report.StaleSessions++
+		report.TempChunksDeleted += chunks.count
+		report.BytesReclaimed += chunks.bytes
+		if deleted {
+			report.FileRowsDeleted++
+		}
+	}
+	return nil
+}
+
+type chunkSummary struct {
+	count int   // chunks recorded for the session
+	slots int   // highest recorded index + 1
+	bytes int64 // total size of the recorded chunks
+}
+
+// recordedChunks summarises the chunks recorded for an upload session.
+func (j *Janitor) recordedChunks(ctx context.Context, fileID string) (chunkSummary, error) {
+	chunks, err := j.store.ListUploadChunks(ctx, fileID)
+	if err != nil {
+		return chunkSummary{}, err
+	}
+	summary := chunkSummary{count: len(chunks)}
+	for _, c := range chunks {
+		summary.bytes += c.Size
+		if c.Index+1 > summary.slots {
+			summary.slots = c.Index + 1
+		}
+	}
+	return summary, nil
+}
+
+// reclaimStaleLinkUploads forgets share link uploads that have not seen a
+// chunk since cutoff. Their temp chunks are left to reclaimTempChunks.
+func (j *Janitor) reclaimStaleLinkUploads(ctx context.Context, cutoff time.Time, report *Report) error {
+	n, err := j.store.DeleteStaleLinkUploads(ctx, cutoff)
+	if err != nil {
+		return fmt.Errorf("delete stale link uploads: %w", err)
+	}
+	report.StaleSessions += n
+	return nil
+}
+
+// reclaimOrphanedFiles deletes files rows that were created for an upload
+// (size 0, no hash) but have no upload session, e.g. rows from before
+// sessions existed.
+func (j *Janitor) reclaimOrphanedFiles(ctx context.Context, cutoff time.Time, report *Report) error {
+	ids, err := j.store.OrphanedUploads(ctx, cutoff)
+	if err != nil {
+		return fmt.Errorf("query orphaned file rows: %w", err)
+	}
+
+	for _, id := range ids {
+		j.removeBlob("files/"+id, report)
+		deleted, err := j.store.DeleteIncompleteFile(ctx, id)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("file %s: %v", id, err))
+			continue
+		}
+		if deleted {
+			report.FileRowsDeleted++
+		}
+	}
+	return nil
+}
+
+// reclaimTempChunks removes temp/<fileId>_chunk_<n> and
+// temp/<linkId>_link_chunk_<n> blobs older than cutoff that no live upload
+// session or link upload owns. This also covers chunks left by
+// SendFileHandler and SendByViewHandler, which do not use sessions.
+func (j *Janitor) reclaimTempChunks(ctx context.Context, cutoff time.Time, report *Report) error {
+	lister, ok := j.backend.(storage.Lister)
+	if !ok {
+		return nil
+	}
+	objects, err := lister.List("temp")
+	if err != nil {
+		if errors.Is(err, storage.ErrListUnsupported) || isNotFound(err) {
+			return nil
+		}
+		report.Errors = append(report.Errors, fmt.Sprintf("list temp: %v", err))
+		return nil
+	}
+
+	live, err := j.liveSessions(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		if !obj.ModTime.Before(cutoff) {
+			continue
+		}
+		name := obj.Path[strings.LastIndex(obj.Path, "/")+1:]
+		fileID, _, found := strings.Cut(name, "_chunk_")
+		if !found || live[fileID] {
+			continue
+		}
+		if j.removeBlob(obj.Path, report) {
+			report.TempChunksDeleted++
+			report.BytesReclaimed += obj.Size
+		}
+	}
+	return nil
+}
+
+// liveSessions returns the chunk name prefixes of the live upload sessions
+// and link uploads. Stale link uploads are already gone by now.
+func (j *Janitor) liveSessions(ctx context.Context, cutoff time.Time) (map[string]bool, error) {
+	sessions, err := j.store.LiveUploadSessions(ctx, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("query live upload sessions: %w", err)
+	}
+	links, err := j.store.LinkUploadIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("query link uploads: %w", err)
+	}
+	live := map[string]bool{}
+	for _, id := range sessions {
+		live[id] = true
+	}
+	for _, id := range links {
+		live[id+"_link"] = true
+	}
+	return live, nil
+}
+
+// purgeTrash permanently deletes files that were moved to the trash before
+// cutoff: their blob, their saved versions and their rows. A file whose blob
+// cannot be removed stays in the trash and is retried on the next sweep.
+func (j *Janitor) purgeTrash(ctx context.Context, cutoff time.Time, report *Report) error {
+	files, err := j.store.TrashedBefore(ctx, cutoff)
+	if err != nil {
+		return fmt.Errorf("query trashed files: %w", err)
+	}
+
+	for _, f := range files {
+		if err := j.backend.Remove("files/" + f.ID); err != nil && !isNotFound(err) {
+			report.Errors = append(report.Errors, fmt.Sprintf("trashed file %s: %v", f.ID, err))
+			continue
+		}
+		report.BytesReclaimed += f.FileSize + j.removeUnder("versions/"+f.ID, report) + j.removeUnder("links/"+f.ID, report)
+
+		if err := j.store.PurgeTrashedFile(ctx, f.ID); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("trashed file %s: %v", f.ID, err))
+			continue
+		}
+		report.TrashPurged++
+	}
+	return nil
+}
+
+// removeUnder deletes every blob under prefix (a file's saved versions or
+// share link copies) and returns how many bytes they took up.
+func (j *Janitor) removeUnder(prefix string, report *Report) int64 {
+	lister, ok := j.backend.(storage.Lister)
+	if !ok {
+		return 0
+	}
+	objects, err := lister.List(prefix)
+	if err != nil {
+		if !errors.Is(err, storage.ErrListUnsupported) && !isNotFound(err) {
+			report.Errors = append(report.Errors, fmt.Sprintf("list %s: %v", prefix, err))
+		}
+		return 0
+	}
+	var reclaimed int64
+	for _, obj := range objects {
+		if j.removeBlob(obj.Path, report) {
+			reclaimed += obj.Size
+		}
+	}
+	return reclaimed
+}
+
+// expireShares ends shares whose expiry passed before now: it deletes the
+// recipient's encrypted copy, marks the share expired and notifies the
+// sender and recipient. A share whose copy cannot be removed is retried on
+// the next sweep.
+func (j *Janitor) expireShares(ctx context.Context, now time.Time, report *Report) error {
+	shares, err := j.store.ExpiredShares(ctx, now)
+	if err != nil {
+		return fmt.Errorf("query expired shares: %w", err)
+	}
+
+	for _, s := range shares {
+		path, err := j.expiredSharePath(ctx, s, now)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("share %s: %v", s.ID, err))
+			continue
+		}
+		if path != "" {
+			if err := j.backend.Remove(path); err != nil && !isNotFound(err) {
+				report.Errors = append(report.Errors, fmt.Sprintf("share %s: %v", s.ID, err))
+				continue
+			}
+		}
+		expired, err := j.store.ExpireShare(ctx, s, path, now)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("share %s: %v", s.ID, err))
+			continue
+		}
+		if expired {
+			report.SharesExpired++
+		}
+	}
+	return nil
+}
+
+// expiredSharePath returns the blob to delete for an expired share, or ""
+// when it must be kept. View shares have a copy per recipient, but every
+// recipient of a sent file reads the sender's one sent copy, so that is only
+// deleted once none of their shares is still live.
+func (j *Janitor) expiredSharePath(ctx context.Context, s store.ExpiredShare, now time.Time) (string, error) {
+	if s.View {
+		return fmt.Sprintf("files/%s/shared_view/%s_%s", s.SenderID, s.FileID, s.RecipientID), nil
+	}
+	inUse, err := j.store.SentCopyInUse(ctx, s.SenderID, s.FileID, s.ID, now)
+	if err != nil || inUse {
+		return "", err
+	}
+	return fmt.Sprintf("files/%s/sent/%s", s.SenderID, s.FileID), nil
+}
+
+// expireLinks closes public share links that have expired or run out of
+// downloads: it deletes their copy and marks them revoked. A link whose copy
+// cannot be removed is retried on the next sweep.
+func (j *Janitor) expireLinks(ctx context.Context, now time.Time, report *Report) error {
+	links, err := j.store.UsedUpShareLinks(ctx, now)
+	if err != nil {
+		return fmt.Errorf("query used-up share links: %w", err)
+	}
+
+	for _, l := range links {
+		if err := j.backend.Remove(l.BlobPath); err != nil && !isNotFound(err) {
+			report.Errors = append(report.Errors, fmt.Sprintf("share link %s: %v", l.ID, err))
+			continue
+		}
+		expired, err := j.store.ExpireShareLink(ctx, l, now)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("share link %s: %v", l.ID, err))
+			continue
+		}
+		if expired {
+			report.SharesExpired++
+		}
+	}
+	return nil
+}
+
+// removeBlob deletes path and reports whether something was removed.
+// Missing blobs are expected (the chunk may never have been written) and
+// are not reported as errors.
+func (j *Janitor) removeBlob(path string, report *Report) bool {
+	err := j.backend.Remove(path)
+	if err == nil {
+		return true
+	}
+	if isNotFound(err) {
+		return false
+	}
+	report.Errors = append(report.Errors, fmt.Sprintf("remove %s: %v", path, err))
+	return false
+}
+
+func isNotFound(err error) bool {
+	if errors.Is(err, fs.ErrNotExist) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "not found") || strings.Contains(msg, "404") ||
+		strings.Contains(msg, "no such file") || strings.Contains(msg, "does not exist")
+}
+
+// StatsHandler reports what the janitor has reclaimed. A POST triggers an
+// immediate sweep and returns its report. Only administrators may use it.
+func (j *Janitor) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if !auth.RequireAdmin(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		if err := json.NewEncoder(w).Encode(j.Stats()); err != nil {
+			logger.Warn("Failed to encode response", "err", err)
+		}
+	case http.MethodPost:
+		report, err := j.RunOnce(r.Context())
+		if err != nil {
+			logger.Error("Janitor sweep failed", "err", err)
+			api.Error(w, "Janitor sweep failed", http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			logger.Warn("Failed to encode response", "err", err)
+		}
+	default:
+		api.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
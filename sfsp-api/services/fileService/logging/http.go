@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries a request's correlation ID. The gateway's ID is
+// kept; requests without one get a new ID. Either way it is echoed in the
+// response.
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID accepts the IDs gateways and proxies usually send, such as
+// UUIDs, and nothing that could forge a log line.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type requestIDKey struct{}
+
+// RequestID returns the correlation ID of the request ctx belongs to, or ""
+// outside a request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// Middleware gives each request a correlation ID and a logger carrying it,
+// along with the trace ID when the request is traced, and logs one line per
+// request once it has been served. Responses with a 5xx status are logged
+// as errors.
+//
+// Only the route is logged, never the path: public share link paths hold
+// the link's token.
+func Middleware(next http.Handler, route func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := r.Context()
+		logger := FromContext(ctx).With("request_id", id)
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		ctx = context.WithValue(WithLogger(ctx, logger), requestIDKey{}, id)
+		r = r.WithContext(ctx)
+
+		sw := api.NewStatusWriter(w)
+		next.ServeHTTP(sw, r)
+
+		status := sw.Status()
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		logger.LogAttrs(ctx, level, "request",
+			slog.String("method", r.Method),
+			slog.String("route", route(r)),
+			slog.Int("status", status),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+		)
+	})
+}
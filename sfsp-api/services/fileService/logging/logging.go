@@ -0,0 +1,109 @@
+// Package logging sets up the service's structured logs: a log/slog handler
+// writing JSON, a redaction policy that keeps key material out of the logs,
+// and a per-request logger carrying the request's correlation ID.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Formats a Config can name.
+const (
+	FormatJSON = "json" // one JSON object per line
+	FormatText = "text" // key=value pairs, for reading logs locally
+)
+
+// Redacted replaces the value of every sensitive attribute.
+const Redacted = "[REDACTED]"
+
+type Config struct {
+	Level  string // debug, info, warn or error; info when empty
+	Format string // FormatJSON when empty
+}
+
+// New builds a logger writing to w. Attributes whose key names a secret are
+// redacted, wherever they appear; see Sensitive.
+func New(w io.Writer, cfg Config) (*slog.Logger, error) {
+	var level slog.Level
+	if cfg.Level != "" {
+		if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+			return nil, fmt.Errorf("unknown log level %q", cfg.Level)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redact}
+
+	switch cfg.Format {
+	case "", FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+}
+
+// Setup makes a logger built by New the default, which the standard log
+// package then writes through as well.
+func Setup(w io.Writer, cfg Config) error {
+	logger, err := New(w, cfg)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// sensitiveSuffixes end the keys of attributes that are never logged: the
+// nonces, keys and encrypted metadata clients send, and credentials.
+var sensitiveSuffixes = []string{
+	"nonce", "key", "keys", "metadata", "password", "secret", "token",
+	"authorization", "cookie", "signature",
+}
+
+// Sensitive reports whether an attribute key names a secret, e.g. "nonce",
+// "encrypted_file_key" or "ikPublicKey". Case, "_", "-" and "." are
+// ignored.
+func Sensitive(key string) bool {
+	k := strings.ToLower(key)
+	k = strings.NewReplacer("_", "", "-", "", ".", "").Replace(k)
+	for _, suffix := range sensitiveSuffixes {
+		if strings.HasSuffix(k, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 && (a.Key == slog.MessageKey || a.Key == slog.LevelKey || a.Key == slog.TimeKey) {
+		return a
+	}
+	if Sensitive(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
+
+type contextKey struct{}
+
+// WithLogger returns a copy of ctx carrying logger.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger stored in ctx, or the default logger. The
+// request middleware stores one with the request ID.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// With returns a copy of ctx whose logger adds args to every record.
+func With(ctx context.Context, args ...any) context.Context {
+	return WithLogger(ctx, FromContext(ctx).With(args...))
+}
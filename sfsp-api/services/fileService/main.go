@@ -1,137 +1,428 @@
 package main
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/config"
 	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/database"
 	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/health"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/janitor"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
 	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metadata"
-	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metrics"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/migrations"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/storage"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/tracing"
 	"github.com/joho/godotenv"
 )
 
-type HealthResponse struct {
-	Status   string            `json:"status"`
-	Services map[string]string `json:"services"`
-	Message  string            `json:"message"`
+// newStorageBackend builds the configured storage driver.
+func newStorageBackend(cfg config.Storage) (storage.Backend, error) {
+	return storage.New(storage.Config{
+		Kind:           cfg.Backend,
+		WebDAVURL:      cfg.WebDAV.URL,
+		WebDAVUsername: cfg.WebDAV.Username,
+		WebDAVPassword: cfg.WebDAV.Password,
+		LocalRoot:      cfg.Local.Root,
+		S3: storage.S3Config{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+			UseSSL:    cfg.S3.UseSSL,
+			Prefix:    cfg.S3.Prefix,
+			PartSize:  cfg.S3.PartSize,
+		},
+	})
 }
 
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+func databaseConfig(cfg config.Database) database.Config {
+	return database.Config{
+		URI:             cfg.URI,
+		MaxOpenConns:    cfg.MaxOpenConns,
+		MaxIdleConns:    cfg.MaxIdleConns,
+		ConnMaxLifetime: cfg.ConnMaxLifetime,
+		ConnMaxIdleTime: cfg.ConnMaxIdleTime,
+	}
+}
+
+func janitorConfig(cfg config.Janitor) janitor.Config {
+	return janitor.Config{
+		TTL:            cfg.TTL,
+		Interval:       cfg.Interval,
+		TrashRetention: cfg.TrashRetention,
+	}
+}
 
-	services := make(map[string]string)
+// fileHandlerConfig gathers the settings of the file handlers.
+func fileHandlerConfig(cfg *config.Config) fileHandler.Config {
+	return fileHandler.Config{
+		Limits:         chunkLimits(cfg.Uploads),
+		Shares:         sharePolicy(cfg.Shares),
+		TrashRetention: cfg.Janitor.TrashRetention,
+		VerifyMode:     cfg.Downloads.VerifyMode,
+	}
+}
 
-	db, err := database.InitPostgre()
-	if err != nil || db == nil {
-		services["postgresql"] = "disconnected"
-	} else {
-		services["postgresql"] = "connected"
+func sharePolicy(cfg config.Shares) fileHandler.SharePolicy {
+	return fileHandler.SharePolicy{
+		Default:    cfg.DefaultExpiry,
+		Max:        cfg.MaxExpiry,
+		AllowNever: cfg.AllowNever,
 	}
+}
 
-	status := "healthy"
-	for _, serviceStatus := range services {
-		if serviceStatus == "disconnected" {
-			status = "degraded"
-			break
+func chunkLimits(cfg config.Uploads) fileHandler.ChunkLimits {
+	return fileHandler.ChunkLimits{
+		MaxChunks:       cfg.MaxChunks,
+		MaxChunkSize:    cfg.MaxChunkSize,
+		MultipartMemory: cfg.MultipartMemory,
+	}
+}
+
+// newVerifier builds the token verifier from the shared JWT secret and/or
+// the public key file. It returns nil when authentication is disabled.
+func newVerifier(cfg config.Auth) (*auth.Verifier, error) {
+	if cfg.Disabled {
+		return nil, nil
+	}
+	acfg := auth.Config{
+		Secret:      []byte(cfg.JWTSecret),
+		Issuer:      cfg.Issuer,
+		Audience:    cfg.Audience,
+		PublicPaths: []string{"/livez", "/readyz", "/health", "/metrics", "/publicLink", "/publicDownload"},
+		// anonymous share link routes
+		PublicPrefixes: []string{api.Version1 + "/public/"},
+	}
+	if cfg.JWTPublicKeyFile != "" {
+		pem, err := os.ReadFile(cfg.JWTPublicKeyFile)
+		if err != nil {
+			return nil, err
 		}
+		acfg.PublicKeyPEM = pem
 	}
+	return auth.NewVerifier(acfg)
+}
+
+func tracingConfig(cfg config.Tracing) tracing.Config {
+	return tracing.Config{
+		Exporter:    cfg.Exporter,
+		File:        cfg.File,
+		ServiceName: "fileService",
+	}
+}
 
-	response := HealthResponse{
-		Status:   status,
-		Services: services,
-		Message:  "File service health check",
+func loggingConfig(cfg config.Logging) logging.Config {
+	return logging.Config{Level: cfg.Level, Format: cfg.Format}
+}
+
+// newServer builds the HTTP server for handler.
+func newServer(cfg config.Server, handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+	if cfg.TLSCertFile != "" {
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
 	}
+	return srv
+}
+
+// fatal logs msg as an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
 
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Println("Failed to encode response:", err)
+// routeLabel names the route serving a request in metrics, logs and traces: the
+// v1 pattern, or the path of a legacy route.
+func routeLabel(mux *http.ServeMux, v1 *api.Router) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		_, pattern := mux.Handler(r)
+		if pattern == v1.Prefix()+"/" {
+			return v1.Pattern(r)
+		}
+		return pattern
 	}
 }
 
 func main() {
 
-	err := godotenv.Load()
+	// .env is optional: containers usually set real environment variables
+	envErr := godotenv.Load()
+	if envErr != nil && !errors.Is(envErr, fs.ErrNotExist) {
+		fatal("Error loading .env file", "err", envErr)
+	}
+
+	cfg, command, err := config.LoadCommand(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		// before logging is set up, and one problem per line reads best
+		fmt.Fprintf(os.Stderr, "fileService: invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	if len(command) > 0 && command[0] != "migrate" {
+		fmt.Fprintf(os.Stderr, "fileService: unknown command %q\n", command[0])
+		os.Exit(2)
 	}
 
-	log.Println("Starting File Service...")
-	log.Println("Environment variables loaded successfully")
-	log.Println("ownCloud URL:", os.Getenv("OWNCLOUD_URL"))
+	if err := logging.Setup(os.Stderr, loggingConfig(cfg.Logging)); err != nil {
+		fatal("Failed to set up logging", "err", err)
+	}
+	if envErr != nil {
+		slog.Info("No .env file, using the environment only")
+	}
+	scfg := cfg.Server
 
-	db, err := database.InitPostgre()
+	// SIGINT or SIGTERM starts a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	slog.Info("Starting File Service", "storage_backend", cfg.Storage.Backend)
+
+	tcfg := tracingConfig(cfg.Tracing)
+	shutdownTracing, err := tracing.Setup(context.Background(), tcfg)
 	if err != nil {
-		log.Fatalf("Failed to connect to PostgreSQL: %v", err)
+		fatal("Failed to set up tracing", "err", err)
+	}
+	slog.Info("Tracing configured", "exporter", tcfg.Exporter)
+
+	db, err := database.InitPostgre(databaseConfig(cfg.Database))
+	if err != nil {
+		fatal("Failed to connect to PostgreSQL", "err", err)
+	}
+
+	if db == nil {
+		slog.Error("PostgreSQL connection failed")
+	}
+
+	if len(command) > 0 {
+		err := runMigrate(ctx, db, command[1:], os.Stdout)
+		if errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if err != nil {
+			fatal("Migration failed", "err", err)
+		}
+		return
+	}
+	if cfg.Database.Migrate {
+		applied, err := migrations.Up(ctx, db)
+		if err != nil {
+			fatal("Failed to apply schema migrations", "err", err)
+		}
+		slog.Info("Schema up to date", "applied", applied)
 	}
 
 	if db != nil {
-		log.Println("✅ PostgreSQL connected successfully")
-	} else {
-		log.Println("❌ PostgreSQL connection failed")
+		metrics.RegisterDBStats(db)
 	}
 
-	// Set the PostgreSQL client in the fileHandler package
-	fileHandler.SetPostgreClient(db)
-	metadata.SetPostgreClient(db)
-	//log.Println("✅ PostgreSQL client set in fileHandler and metadata")
+	// initialize the storage backend (ownCloud WebDAV by default)
+	backend, err := newStorageBackend(cfg.Storage)
+	if err != nil {
+		fatal("Failed to initialize storage backend", "err", err)
+	}
+	backend = storage.Instrument(backend, metrics.ObserveStorage)
+	slog.Info("Storage backend ready", "kind", cfg.Storage.Backend)
 
-	//initialize ownCloud client
-	owncloud.InitOwnCloud(os.Getenv("OWNCLOUD_URL"), os.Getenv("OWNCLOUD_USERNAME"), os.Getenv("OWNCLOUD_PASSWORD"))
+	// the handlers share the pool and the backend
+	files := fileHandler.New(db, backend, fileHandlerConfig(cfg))
+	meta := metadata.New(db, metadata.Config{ShareExpiry: cfg.Shares.DefaultExpiry})
 
-	http.HandleFunc("/startUpload", fileHandler.StartUploadHandler)
-	http.HandleFunc("/upload", fileHandler.UploadHandler)
-	http.HandleFunc("/download", fileHandler.DownloadHandler)
+	// clean up abandoned uploads in the background
+	fileJanitor := janitor.New(db, backend, janitorConfig(cfg.Janitor))
+	if cfg.Janitor.Enabled {
+		fileJanitor.Start(ctx)
+		slog.Info("Upload janitor started")
+	}
+
+	// readiness checks ping the shared pool and the storage backend
+	checker := health.New(cfg.Health.ReadinessTimeout)
+	checker.Add("postgresql", func(ctx context.Context) error {
+		if db == nil {
+			return errors.New("not connected")
+		}
+		return db.PingContext(ctx)
+	})
+	checker.Add("storage", func(ctx context.Context) error {
+		return storage.Ping(ctx, backend)
+	})
+
+	verifier, err := newVerifier(cfg.Auth)
+	if err != nil {
+		fatal("Failed to configure token verification", "err", err)
+	}
+
+	// versioned REST API with method enforcement and path parameters
+	mux := http.NewServeMux()
+	v1 := newV1Router(files, meta, fileJanitor)
+	mux.Handle(api.Version1+"/", v1)
+
+	// legacy routes, still used by the API gateway
+	mux.HandleFunc("/startUpload", files.StartUploadHandler)
+	mux.HandleFunc("/upload", files.UploadHandler)
+	mux.HandleFunc("/uploadStatus", files.UploadStatusHandler)
+	mux.HandleFunc("/download", files.DownloadHandler)
 
 	// access log endpoints
-	http.HandleFunc("/addAccesslog", fileHandler.AddAccesslogHandler)
-	http.HandleFunc("/getAccesslog", fileHandler.GetAccesslogHandler)
+	mux.HandleFunc("/addAccesslog", files.AddAccesslogHandler)
+	mux.HandleFunc("/getAccesslog", files.GetAccesslogHandler)
 	// notification endpoints
-	http.HandleFunc("/notifications", fileHandler.NotificationHandler)
-	http.HandleFunc("/notifications/markAsRead", fileHandler.MarkAsReadHandler)
-	http.HandleFunc("/notifications/respond", fileHandler.RespondToShareRequestHandler)
-	http.HandleFunc("/notifications/clear", fileHandler.ClearNotificationHandler)
-	http.HandleFunc("/notifications/add", fileHandler.AddNotificationHandler)
+	mux.HandleFunc("/notifications", files.NotificationHandler)
+	mux.HandleFunc("/notifications/markAsRead", files.MarkAsReadHandler)
+	mux.HandleFunc("/notifications/respond", files.RespondToShareRequestHandler)
+	mux.HandleFunc("/notifications/clear", files.ClearNotificationHandler)
+	mux.HandleFunc("/notifications/add", files.AddNotificationHandler)
 	// metadata endpoints
-	http.HandleFunc("/metadata", metadata.GetUserFilesHandler)
-	http.HandleFunc("/addDescription", metadata.AddDescriptionHandler)
-	http.HandleFunc("/getFileMetadata", metadata.ListFileMetadataHandler)
-	http.HandleFunc("/getNumberOfFiles", metadata.GetUserFileCountHandler)
-	http.HandleFunc("/addPendingFiles", metadata.AddReceivedFileHandler)
-	http.HandleFunc("/getPendingFiles", metadata.GetPendingFilesHandler)
-	http.HandleFunc("/deleteFile", fileHandler.DeleteFileHandler)
-	http.HandleFunc("/sendFile", fileHandler.SendFileHandler)
-	http.HandleFunc("/addTags", metadata.AddTagsHandler)
-	http.HandleFunc("/addUser", metadata.AddUserHandler)
-	http.HandleFunc("/removeTags", metadata.RemoveTagsFromFileHandler)
-	http.HandleFunc("/downloadSentFile", fileHandler.DownloadSentFile)
-	http.HandleFunc("/deleteFolder", metadata.DeleteFolderHandler)
-	
+	mux.HandleFunc("/metadata", meta.GetUserFilesHandler)
+	mux.HandleFunc("/addDescription", meta.AddDescriptionHandler)
+	mux.HandleFunc("/getFileMetadata", meta.ListFileMetadataHandler)
+	mux.HandleFunc("/getNumberOfFiles", meta.GetUserFileCountHandler)
+	mux.HandleFunc("/storageStats", meta.StorageStatsHandler)
+	mux.HandleFunc("/searchFiles", meta.SearchHandler)
+	mux.HandleFunc("/addPendingFiles", meta.AddReceivedFileHandler)
+	mux.HandleFunc("/getPendingFiles", meta.GetPendingFilesHandler)
+	mux.HandleFunc("/deleteFile", files.DeleteFileHandler)
+	mux.HandleFunc("/sendFile", files.SendFileHandler)
+	mux.HandleFunc("/addTags", meta.AddTagsHandler)
+	mux.HandleFunc("/addUser", meta.AddUserHandler)
+	mux.HandleFunc("/removeTags", meta.RemoveTagsFromFileHandler)
+	mux.HandleFunc("/downloadSentFile", files.DownloadSentFile)
+	mux.HandleFunc("/deleteFolder", meta.DeleteFolderHandler)
+
 	// view files endpoints newly added
-	http.HandleFunc("/sendByView", fileHandler.SendByViewHandler)
-	http.HandleFunc("/revokeViewAccess", fileHandler.RevokeViewAccessHandler)
-	http.HandleFunc("/getSharedViewFiles", fileHandler.GetSharedViewFilesHandler)
-	http.HandleFunc("/getViewFileAccessLogs", fileHandler.GetViewFileAccessLogs)
-	http.HandleFunc("/downloadViewFile", fileHandler.DownloadViewFileHandler)
+	mux.HandleFunc("/sendByView", files.SendByViewHandler)
+	mux.HandleFunc("/revokeViewAccess", files.RevokeViewAccessHandler)
+	mux.HandleFunc("/getSharedViewFiles", files.GetSharedViewFilesHandler)
+	mux.HandleFunc("/getViewFileAccessLogs", files.GetViewFileAccessLogs)
+	mux.HandleFunc("/downloadViewFile", files.DownloadViewFileHandler)
 
 	//test from here
-	http.HandleFunc("/addSentFiles", metadata.AddSentFileHandler)
-	http.HandleFunc("/getSentFiles", metadata.GetSentFilesHandler)
+	mux.HandleFunc("/addSentFiles", meta.AddSentFileHandler)
+	mux.HandleFunc("/getSentFiles", meta.GetSentFilesHandler)
 
 	// Folder handling
-	http.HandleFunc("/createFolder", fileHandler.CreateFolderHandler)
-	http.HandleFunc("/updateFilePath", metadata.UpdateFilePathHandler)
+	mux.HandleFunc("/createFolder", files.CreateFolderHandler)
+	mux.HandleFunc("/updateFilePath", meta.UpdateFilePathHandler)
+	mux.HandleFunc("/move", meta.MoveHandler)
 
 	// Password reset - file re-encryption
-	http.HandleFunc("/updateFile", fileHandler.UpdateFileHandler)
+	mux.HandleFunc("/updateFile", files.UpdateFileHandler)
+
+	// Trash
+	mux.HandleFunc("/trash", files.ListTrashHandler)
+	mux.HandleFunc("/restoreFromTrash", files.RestoreFromTrashHandler)
+	mux.HandleFunc("/emptyTrash", files.EmptyTrashHandler)
+
+	// File versions
+	mux.HandleFunc("/fileVersions", files.ListFileVersionsHandler)
+	mux.HandleFunc("/downloadFileVersion", files.DownloadFileVersionHandler)
+	mux.HandleFunc("/restoreFileVersion", files.RestoreFileVersionHandler)
+	mux.HandleFunc("/pruneFileVersions", files.PruneFileVersionsHandler)
 
 	//changeMethod
-	http.HandleFunc("/changeMethod", fileHandler.ChangeShareMethodHandler)
-	http.HandleFunc("/usersWithFileAccess", fileHandler.GetUsersWithFileAccessHandler)
-	http.HandleFunc("/health", healthHandler)
+	mux.HandleFunc("/changeMethod", files.ChangeShareMethodHandler)
+	mux.HandleFunc("/usersWithFileAccess", files.GetUsersWithFileAccessHandler)
+
+	// public share links
+	mux.HandleFunc("/createShareLink", files.CreateShareLinkHandler)
+	mux.HandleFunc("/shareLinks", files.ListShareLinksHandler)
+	mux.HandleFunc("/revokeShareLink", files.RevokeShareLinkHandler)
+	mux.HandleFunc("/publicLink", files.PublicLinkInfoHandler)
+	mux.HandleFunc("/publicDownload", files.PublicLinkDownloadHandler)
+
+	// storage quotas
+	mux.HandleFunc("/storageUsage", files.StorageUsageHandler)
+	mux.HandleFunc("/quotaTiers", files.ListQuotaTiersHandler)
+	mux.HandleFunc("/setQuotaTier", files.SetQuotaTierHandler)
+	mux.HandleFunc("/setUserQuota", files.SetUserQuotaHandler)
+
+	mux.HandleFunc("/livez", health.LiveHandler)
+	mux.HandleFunc("/readyz", checker.ReadyHandler)
+	mux.HandleFunc("/health", checker.LegacyHandler)
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/admin/janitor", fileJanitor.StatsHandler)
+
+	// every route except the probes, /metrics and the public share link routes requires
+	// a valid bearer token
+	var handler http.Handler = mux
+	handler = api.LimitBody(handler, scfg.MaxBodyBytes)
+	if verifier != nil {
+		handler = verifier.Middleware(handler)
+		slog.Info("Token authentication enabled")
+	} else {
+		slog.Warn("AUTH_DISABLED=true: requests are not authenticated")
+	}
+	// preflight requests carry no token, so CORS answers them first
+	handler = api.CORS(handler, cfg.CORS.AllowedOrigins)
+	handler = metrics.Middleware(handler, routeLabel(mux, v1))
+	handler = logging.Middleware(handler, routeLabel(mux, v1))
+	handler = tracing.Middleware(handler, routeLabel(mux, v1))
+
+	srv := newServer(scfg, handler)
+	serveErr := make(chan error, 1)
+	go func() {
+		if scfg.TLSCertFile != "" {
+			serveErr <- srv.ListenAndServeTLS(scfg.TLSCertFile, scfg.TLSKeyFile)
+		} else {
+			serveErr <- srv.ListenAndServe()
+		}
+	}()
+	slog.Info("File Service is running", "addr", scfg.Addr, "tls", scfg.TLSCertFile != "")
 
-	// Start the HTTP server
-	log.Println("File Service is running on port 8081")
-	log.Fatal(http.ListenAndServe(":8081", nil))
+	select {
+	case err := <-serveErr:
+		fatal("HTTP server stopped", "err", err)
+	case <-ctx.Done():
+	}
+	// a second signal kills the process without waiting
+	stop()
+
+	// stop accepting connections and wait for in-flight requests, which
+	// include chunk uploads and the merges they trigger
+	slog.Info("Shutting down", "timeout", scfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), scfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Requests still in flight at the shutdown deadline, closing their connections", "err", err)
+		if err := srv.Close(); err != nil {
+			slog.Error("Failed to close HTTP server", "err", err)
+		}
+	}
+
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("Failed to flush traces", "err", err)
+	}
+	if db != nil {
+		if err := db.Close(); err != nil {
+			slog.Error("Failed to close PostgreSQL pool", "err", err)
+		}
+	}
+	slog.Info("File Service stopped")
 }
@@ -0,0 +1,165 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+)
+
+// Folders are files rows with file_type 'folder'. parent_id links every row
+// to the folder it is in (NULL at the root). cid still carries the path the
+// clients display: "<parent cid>/<name>" for a folder and
+// "files/<folder cid>/<fileId>" for a file, so it is rewritten whenever a
+// folder moves.
+
+// validItemName rejects names that would break the cid paths.
+func validItemName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.Contains(name, "/")
+}
+
+// DeleteFolderHandler moves a folder to the trash. With recursive set its
+// whole subtree goes with it; otherwise the folder must be empty. Every row
+// trashed together gets the same deleted_at, which is how a restore of the
+// folder finds them again.
+func (s *Server) DeleteFolderHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	type DeleteFolderRequest struct {
+		FolderID  string   `json:"folderId"`
+		Recursive bool     `json:"recursive"`
+		Tags      []string `json:"tags"`
+	}
+
+	var req DeleteFolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Warn("Failed to parse JSON", "err", err)
+		api.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if req.FolderID == "" {
+		api.Error(w, "Missing folderId", http.StatusBadRequest)
+		return
+	}
+
+	if !auth.RequireFileOwner(w, r, s.store, req.FolderID) {
+		return
+	}
+
+	trashed, err := s.store.TrashFolder(ctx, req.FolderID, req.Recursive, req.Tags)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		api.Error(w, "Folder not found", http.StatusNotFound)
+		return
+	case errors.Is(err, store.ErrNotFolder):
+		api.Error(w, "Not a folder", http.StatusBadRequest)
+		return
+	case errors.Is(err, store.ErrFolderNotEmpty):
+		api.Error(w, "Folder is not empty; set recursive to delete its contents", http.StatusConflict)
+		return
+	case err != nil:
+		logger.Error("Failed to move folder to trash", "err", err)
+		api.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Folder moved to trash", "folder_id", req.FolderID, "items", trashed)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      "Folder moved to trash",
+		"folderId":     req.FolderID,
+		"itemsTrashed": trashed,
+	}); err != nil {
+		logger.Warn("Failed to encode response", "err", err)
+	}
+}
+
+// MoveRequest moves and/or renames a file or folder. A nil ParentID keeps
+// the current folder and "" moves to the root; an empty Name keeps the
+// current name.
+type MoveRequest struct {
+	FileID   string  `json:"fileId"`
+	ParentID *string `json:"parentId"`
+	Name     string  `json:"name"`
+}
+
+// MoveHandler moves and/or renames a file or folder in one transaction. A
+// folder takes its whole subtree with it. Moving a folder into itself or a
+// subfolder, or onto a name already used in the target folder, is refused
+// with 409.
+func (s *Server) MoveHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	var req MoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.FileID == "" {
+		api.Error(w, "Missing fileId", http.StatusBadRequest)
+		return
+	}
+	if req.ParentID == nil && req.Name == "" {
+		api.Error(w, "Provide parentId and/or name", http.StatusBadRequest)
+		return
+	}
+	if req.Name != "" && !validItemName(req.Name) {
+		api.Error(w, "Invalid name", http.StatusBadRequest)
+		return
+	}
+
+	ownerID, err := s.store.FileOwner(ctx, req.FileID)
+	if errors.Is(err, store.ErrNotFound) {
+		api.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to load file", "err", err)
+		api.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !auth.RequireOwner(w, r, ownerID) {
+		return
+	}
+
+	moved, err := s.store.MoveItem(ctx, store.Move{ID: req.FileID, ParentID: req.ParentID, Name: req.Name})
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		api.Error(w, "File not found", http.StatusNotFound)
+		return
+	case errors.Is(err, store.ErrFolderNotFound):
+		api.Error(w, "Target folder not found", http.StatusNotFound)
+		return
+	case errors.Is(err, store.ErrNotFolder):
+		api.Error(w, "Target is not a folder", http.StatusBadRequest)
+		return
+	case errors.Is(err, store.ErrFolderCycle):
+		api.Error(w, "Cannot move a folder into itself or one of its subfolders", http.StatusConflict)
+		return
+	case errors.Is(err, store.ErrNameTaken):
+		api.Error(w, "An item with that name already exists in the target folder", http.StatusConflict)
+		return
+	case err != nil:
+		logger.Error("Failed to move file", "err", err)
+		api.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":            "Moved successfully",
+		"fileId":             req.FileID,
+		"parentId":           moved.ParentID,
+		"name":               moved.Name,
+		"cid":                moved.CID,
+		"descendantsUpdated": moved.Descendants,
+	}); err != nil {
+		logger.Warn("Failed to encode response", "err", err)
+	}
+}
@@ -1,135 +1,153 @@
 package metadata
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"time"
 
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
 	"github.com/lib/pq"
 )
 
-var DB *sql.DB
+type MetadataQueryRequest struct {
+	UserID string `json:"userId"`
+	api.PageRequest
+}
 
-func SetPostgreClient(db *sql.DB) {
-	// This function is used to set the PostgreSQL client in the metadata package
-	DB = db
+// fileListing orders a user's files for the file listing endpoints.
+var fileListing = api.Listing{
+	Sorts: map[string]string{
+		"createdAt": "created_at",
+		"name":      "lower(file_name)",
+		"size":      "COALESCE(file_size, 0)",
+	},
+	ID:           "id",
+	DefaultSort:  "createdAt",
+	DefaultOrder: "desc",
 }
 
-type MetadataQueryRequest struct {
-	UserID string `json:"userId"`
+var pendingListing = api.Listing{
+	Sorts: map[string]string{
+		"receivedAt": "received_at",
+		"expiresAt":  "COALESCE(expires_at, 'infinity')",
+	},
+	ID:           "id",
+	DefaultSort:  "receivedAt",
+	DefaultOrder: "desc",
 }
 
-func GetUserFilesHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-	log.Println("Inside User files handler")
+var sentListing = api.Listing{
+	Sorts:        map[string]string{"sentAt": "sent_at"},
+	ID:           "id",
+	DefaultSort:  "sentAt",
+	DefaultOrder: "desc",
+}
+
+func (s *Server) GetUserFilesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	var req MetadataQueryRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
 		return
 	}
-	userID := req.UserID
 	if userID == "" {
-		http.Error(w, "Missing userId parameter", http.StatusBadRequest)
+		api.Error(w, "Missing userId parameter", http.StatusBadRequest)
+		return
+	}
+	page, err := fileListing.Page(r, req.PageRequest)
+	if err != nil {
+		api.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	log.Println("🟡 Querying database for user files")
-	rows, err := DB.Query(`
-		SELECT id, file_name, file_type, file_size, description, tags, created_at, cid
-		FROM files
-		WHERE owner_id = $1
-	`, userID)
+	listed, err := s.store.ListFiles(ctx, userID, page)
 	if err != nil {
-		log.Println("PostgreSQL select error:", err)
-		http.Error(w, "Failed to fetch metadata", http.StatusInternalServerError)
+		logger.Error("PostgreSQL select error", "err", err)
+		api.Error(w, "Failed to fetch metadata", http.StatusInternalServerError)
 		return
 	}
-	log.Println("🟢 Query complete")
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Println("error closing rows:", err)
-		}
-	}()
 
 	var files []map[string]interface{}
 	count := 0
-
-	for rows.Next() {
-		var (
-			id, fileName, fileType, description, tags string
-			fileSize                                  int64
-			createdAt                                 time.Time
-			cid                                       string
-		)
-		err := rows.Scan(&id, &fileName, &fileType, &fileSize, &description, &tags, &createdAt, &cid)
-		if err != nil {
-			log.Println("Row scan error:", err)
-			continue
-		}
-
+	for _, f := range listed {
 		files = append(files, map[string]interface{}{
-			"fileId":      id,
-			"fileName":    fileName,
-			"fileType":    fileType,
-			"fileSize":    fileSize,
-			"description": description,
-			"tags":        tags,
-			"createdAt":   createdAt,
-			"cid":         cid,
+			"fileId":      f.ID,
+			"fileName":    f.FileName,
+			"fileType":    f.FileType,
+			"fileSize":    f.FileSize,
+			"description": f.Description,
+			"tags":        tagsText(f.Tags),
+			"createdAt":   f.CreatedAt,
+			"cid":         f.CID,
 		})
 		count++
 	}
 
-	if err = rows.Err(); err != nil {
-		log.Println("Rows iteration error:", err)
-		http.Error(w, "Failed to fetch metadata", http.StatusInternalServerError)
-		return
-	}
-
-	log.Printf("Returning %d files for user %s\n", count, userID)
+	logger.Debug("Listed files", "user_id", userID, "count", count)
 
+	page.Finish(w)
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(files); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
-func ListFileMetadataHandler(w http.ResponseWriter, r *http.Request) {
+// tagsText renders tags as Postgres prints a text array, "{a,b}", which is
+// how GetUserFilesHandler has always returned them.
+func tagsText(tags []string) string {
+	v, _ := pq.StringArray(tags).Value()
+	text, _ := v.(string)
+	return text
+}
+
+func (s *Server) ListFileMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	type MetadataRequest struct {
 		UserID string `json:"userId"`
+		api.PageRequest
 	}
 
 	var req MetadataRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
+		return
+	}
+	req.UserID = userID
+
 	if req.UserID == "" {
-		http.Error(w, "Missing userId", http.StatusBadRequest)
+		api.Error(w, "Missing userId", http.StatusBadRequest)
+		return
+	}
+	page, err := fileListing.Page(r, req.PageRequest)
+	if err != nil {
+		api.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	rows, err := DB.Query(`
-		SELECT id, file_name, file_type, file_size, description, tags, created_at
-		FROM files
-		WHERE owner_id = $1
-	`, req.UserID)
+	listed, err := s.store.ListFiles(ctx, req.UserID, page)
 	if err != nil {
-		log.Println("PostgreSQL query error:", err)
-		http.Error(w, "Failed to fetch metadata", http.StatusInternalServerError)
+		logger.Error("PostgreSQL query error", "err", err)
+		api.Error(w, "Failed to fetch metadata", http.StatusInternalServerError)
 		return
 	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Println("error closing rows:", err)
-		}
-	}()
 
 	type FileMetadata struct {
 		FileID      string    `json:"fileId"`
@@ -142,60 +160,56 @@ func ListFileMetadataHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var files []FileMetadata
-
-	for rows.Next() {
-		var file FileMetadata
-		if err := rows.Scan(
-			&file.FileID,
-			&file.FileName,
-			&file.FileType,
-			&file.FileSize,
-			&file.Description,
-			pq.Array(&file.Tags),
-			&file.CreatedAt,
-		); err != nil {
-			log.Println("Row scan error:", err)
-			continue
-		}
-		files = append(files, file)
-	}
-
-	if err = rows.Err(); err != nil {
-		log.Println("Row iteration error:", err)
-		http.Error(w, "Error reading file data", http.StatusInternalServerError)
-		return
+	for _, f := range listed {
+		files = append(files, FileMetadata{
+			FileID:      f.ID,
+			FileName:    f.FileName,
+			FileType:    f.FileType,
+			FileSize:    f.FileSize,
+			Description: f.Description,
+			Tags:        f.Tags,
+			CreatedAt:   f.CreatedAt,
+		})
 	}
 
+	page.Finish(w)
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(files); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
-func GetUserFileCountHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetUserFileCountHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	var req MetadataQueryRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
+		return
+	}
+	req.UserID = userID
+
 	if req.UserID == "" {
-		http.Error(w, "Missing userId", http.StatusBadRequest)
+		api.Error(w, "Missing userId", http.StatusBadRequest)
 		return
 	}
 
-	var count int
-	err := DB.QueryRow(`SELECT COUNT(*) FROM files WHERE owner_id = $1 AND file_type != 'folder'`, req.UserID).Scan(&count)
+	count, err := s.store.CountFiles(ctx, req.UserID)
 	if err != nil {
-		log.Println("PostgreSQL user count error:", err)
-		http.Error(w, "Failed to retrieve file count", http.StatusInternalServerError)
+		logger.Error("PostgreSQL user count error", "err", err)
+		api.Error(w, "Failed to retrieve file count", http.StatusInternalServerError)
 		return
 	}
 
 	if err := json.NewEncoder(w).Encode(map[string]int{
 		"userFileCount": count,
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
@@ -209,39 +223,48 @@ type AddReceivedFileRequest struct {
 	Metadata            map[string]interface{} `json:"metadata"` // optional
 }
 
-func AddReceivedFileHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) AddReceivedFileHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	var req AddReceivedFileRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
+	senderID, ok := auth.ResolveUserID(w, r, req.SenderID)
+	if !ok {
+		return
+	}
+	req.SenderID = senderID
+
 	if req.SenderID == "" || req.RecipientID == "" || req.FileID == "" {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		api.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+
+	if !auth.RequireFileOwner(w, r, s.store, req.FileID) {
 		return
 	}
 
 	metadataJSON, err := json.Marshal(req.Metadata)
 	if err != nil {
-		http.Error(w, "Failed to encode metadata", http.StatusInternalServerError)
+		api.Error(w, "Failed to encode metadata", http.StatusInternalServerError)
 		return
 	}
 
-	// Insert into received_files
-	_, err = DB.Exec(`
-		INSERT INTO received_files (
-			sender_id, recipient_id, file_id, received_at, expires_at, metadata
-		) VALUES ($1, $2, $3, NOW(), NOW() + INTERVAL '7 days', $4)
-	`,
-		req.SenderID,
-		req.RecipientID,
-		req.FileID,
-		metadataJSON,
-	)
-
+	// the share lasts the policy's default
+	expiresAt := s.now().Add(s.cfg.ShareExpiry)
+	_, err = s.store.AddReceivedFile(ctx, store.ReceivedFile{
+		RecipientID: req.RecipientID,
+		SenderID:    req.SenderID,
+		FileID:      req.FileID,
+		Metadata:    string(metadataJSON),
+		ExpiresAt:   &expiresAt,
+	})
 	if err != nil {
-		log.Println("PostgreSQL insert received_files error:", err)
-		http.Error(w, "Failed to insert received file record", http.StatusInternalServerError)
+		logger.Error("PostgreSQL insert received_files error", "err", err)
+		api.Error(w, "Failed to insert received file record", http.StatusInternalServerError)
 		return
 	}
 
@@ -249,78 +272,75 @@ func AddReceivedFileHandler(w http.ResponseWriter, r *http.Request) {
 	if err := json.NewEncoder(w).Encode(map[string]string{
 		"message": "File shared with recipient",
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
-func GetPendingFilesHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetPendingFilesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	var req MetadataQueryRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Println("JSON decode error:", err)
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		logger.Warn("JSON decode error", "err", err)
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
+		return
+	}
+	req.UserID = userID
+
 	if req.UserID == "" {
-		http.Error(w, "Missing userId", http.StatusBadRequest)
+		api.Error(w, "Missing userId", http.StatusBadRequest)
 		return
 	}
 
-	rows, err := DB.Query(`
-		SELECT id, sender_id, file_id, received_at, expires_at, metadata
-		FROM received_files
-		WHERE recipient_id = $1 AND expires_at > NOW() AND accepted = FALSE
-	`, req.UserID)
+	page, err := pendingListing.Page(r, req.PageRequest)
 	if err != nil {
-		log.Println("PostgreSQL select pending files error:", err)
-		http.Error(w, "Failed to fetch pending files", http.StatusInternalServerError)
+		api.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Println("error closing rows:", err)
-		}
-	}()
 
-	var pendingFiles []map[string]interface{}
-
-	for rows.Next() {
-		var (
-			id, senderID, fileID  string
-			receivedAt, expiresAt time.Time
-			metadataJSON          string
-		)
-
-		if err := rows.Scan(&id, &senderID, &fileID, &receivedAt, &expiresAt, &metadataJSON); err != nil {
-			log.Println("Row scan error:", err)
-			continue
-		}
+	pending, err := s.store.ListReceivedFiles(ctx, store.ReceivedFileFilter{RecipientID: req.UserID, Pending: true}, page)
+	if err != nil {
+		logger.Error("PostgreSQL select pending files error", "err", err)
+		api.Error(w, "Failed to fetch pending files", http.StatusInternalServerError)
+		return
+	}
 
+	var pendingFiles []map[string]interface{}
+	for _, f := range pending {
 		var metadata map[string]interface{}
-		if err := json.Unmarshal([]byte(metadataJSON), &metadata); err != nil {
-			log.Println("Failed to parse metadata:", err)
+		if err := json.Unmarshal([]byte(f.Metadata), &metadata); err != nil {
+			logger.Error("Failed to parse metadata", "err", err)
 			metadata = map[string]interface{}{}
 		}
 
 		pendingFiles = append(pendingFiles, map[string]interface{}{
-			"id":         id,
-			"senderId":   senderID,
-			"fileId":     fileID,
-			"receivedAt": receivedAt,
-			"expiresAt":  expiresAt,
+			"id":         f.ID,
+			"senderId":   f.SenderID,
+			"fileId":     f.FileID,
+			"receivedAt": f.ReceivedAt,
+			"expiresAt":  f.ExpiresAt, // nil when the share never expires
 			"metadata":   metadata,
 		})
 	}
 
+	page.Finish(w)
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]interface{}{
-		"data": pendingFiles,
+		"data":       pendingFiles,
+		"nextCursor": page.Next(),
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
-func AddSentFileHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) AddSentFileHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	type SentFileRequest struct {
 		SenderID    string `json:"senderId"`
 		RecipientID string `json:"recipientId"`
@@ -329,23 +349,33 @@ func AddSentFileHandler(w http.ResponseWriter, r *http.Request) {
 
 	var req SentFileRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	senderID, ok := auth.ResolveUserID(w, r, req.SenderID)
+	if !ok {
 		return
 	}
+	req.SenderID = senderID
 
 	if req.SenderID == "" || req.RecipientID == "" || req.FileID == "" {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		api.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
 
-	_, err := DB.Exec(`
-		INSERT INTO sent_files (sender_id, recipient_id, file_id, sent_at)
-		VALUES ($1, $2, $3, NOW())
-	`, req.SenderID, req.RecipientID, req.FileID)
+	if !auth.RequireFileOwner(w, r, s.store, req.FileID) {
+		return
+	}
 
+	_, err := s.store.AddSentFile(ctx, store.SentFile{
+		SenderID:    req.SenderID,
+		RecipientID: req.RecipientID,
+		FileID:      req.FileID,
+	})
 	if err != nil {
-		log.Println("PostgreSQL insert sent_files error:", err)
-		http.Error(w, "Failed to insert sent file record", http.StatusInternalServerError)
+		logger.Error("PostgreSQL insert sent_files error", "err", err)
+		api.Error(w, "Failed to insert sent file record", http.StatusInternalServerError)
 		return
 	}
 
@@ -353,111 +383,87 @@ func AddSentFileHandler(w http.ResponseWriter, r *http.Request) {
 	if err := json.NewEncoder(w).Encode(map[string]string{
 		"message": "File sent successfully",
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
-func GetSentFilesHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetSentFilesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	var req MetadataQueryRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
 		return
 	}
+	req.UserID = userID
 
 	if req.UserID == "" {
-		http.Error(w, "Missing userId", http.StatusBadRequest)
+		api.Error(w, "Missing userId", http.StatusBadRequest)
 		return
 	}
 
-	rows, err := DB.Query(`
-		SELECT id, recipient_id, file_id, sent_at
-		FROM sent_files
-		WHERE sender_id = $1
-	`, req.UserID)
+	page, err := sentListing.Page(r, req.PageRequest)
 	if err != nil {
-		log.Println("PostgreSQL select sent_files error:", err)
-		http.Error(w, "Failed to fetch sent files", http.StatusInternalServerError)
+		api.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Println("error closing rows:", err)
-		}
-	}()
-
-	var sentFiles []map[string]interface{}
-
-	for rows.Next() {
-		var (
-			id, recipientID, fileID string
-			sentAt                  time.Time
-		)
 
-		err := rows.Scan(&id, &recipientID, &fileID, &sentAt)
-		if err != nil {
-			log.Println("Row scan error:", err)
-			continue
-		}
-
-		sentFile := map[string]interface{}{
-			"id":          id,
-			"recipientId": recipientID,
-			"fileId":      fileID,
-			"sentAt":      sentAt,
-		}
+	sent, err := s.store.ListSentFiles(ctx, req.UserID, page)
+	if err != nil {
+		logger.Error("PostgreSQL select sent_files error", "err", err)
+		api.Error(w, "Failed to fetch sent files", http.StatusInternalServerError)
+		return
+	}
 
-		sentFiles = append(sentFiles, sentFile)
+	var sentFiles []map[string]interface{}
+	for _, f := range sent {
+		sentFiles = append(sentFiles, map[string]interface{}{
+			"id":          f.ID,
+			"recipientId": f.RecipientID,
+			"fileId":      f.FileID,
+			"sentAt":      f.SentAt,
+		})
 	}
 
+	page.Finish(w)
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(sentFiles); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
-var DeleteFileMetadata = func(fileID string) error {
-	tx, err := DB.Begin()
-	if err != nil {
-		log.Println("Failed to begin transaction:", err)
-		return err
-	}
-	defer func() {
-		if err := tx.Rollback(); err != nil {
-			log.Println("Rollback error (may be expected if already committed):", err)
-		}
-	}()
-
-	// Delete from received_files (optional, might cascade)
-	_, err = tx.Exec(`DELETE FROM received_files WHERE file_id = $1`, fileID)
-	if err != nil {
-		log.Println("Error deleting from received_files:", err)
-		return err
-	}
-
-	// Delete from sent_files (optional, might cascade)
-	_, err = tx.Exec(`DELETE FROM sent_files WHERE file_id = $1`, fileID)
-	if err != nil {
-		log.Println("Error deleting from sent_files:", err)
-		return err
-	}
-
-	// Delete from files table
-	_, err = tx.Exec(`DELETE FROM files WHERE id = $1`, fileID)
-	if err != nil {
-		log.Println("Error deleting from files:", err)
+// TrashFile moves a file to the trash. It stays there, hidden from listings
+// and with its shares suspended, until it is restored or purged.
+func (s *Server) TrashFile(ctx context.Context, fileID string) error {
+	logger := logging.FromContext(ctx)
+	if err := s.store.TrashFile(ctx, fileID); err != nil {
+		logger.Error("Failed to move file to trash", "file_id", fileID, "err", err)
 		return err
 	}
+	logger.Info("File moved to trash", "file_id", fileID)
+	return nil
+}
 
-	if err := tx.Commit(); err != nil {
-		log.Println("Transaction commit failed:", err)
+// DeleteFileMetadata removes a file's row and the shares that point at it.
+func (s *Server) DeleteFileMetadata(ctx context.Context, fileID string) error {
+	logger := logging.FromContext(ctx)
+	if err := s.store.DeleteFile(ctx, fileID); err != nil {
+		logger.Error("Failed to delete file metadata", "file_id", fileID, "err", err)
 		return err
 	}
 
-	log.Println("✅ File metadata deleted successfully for file ID:", fileID)
+	logger.Info("File metadata deleted", "file_id", fileID)
 	return nil
 }
 
-func RemoveTagsFromFileHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) RemoveTagsFromFileHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	type TagRemoveRequest struct {
 		FileID string   `json:"fileId"`
 		Tags   []string `json:"tags"`
@@ -465,83 +471,75 @@ func RemoveTagsFromFileHandler(w http.ResponseWriter, r *http.Request) {
 
 	var req TagRemoveRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
 	if req.FileID == "" || len(req.Tags) == 0 {
-		http.Error(w, "Missing fileId or tags", http.StatusBadRequest)
+		api.Error(w, "Missing fileId or tags", http.StatusBadRequest)
 		return
 	}
 
-	_, err := DB.Exec(`
-		UPDATE files
-		SET tags = ARRAY(
-			SELECT UNNEST(tags)
-			EXCEPT SELECT UNNEST($1::text[])
-		)
-		WHERE id = $2
-	`, pq.Array(req.Tags), req.FileID)
+	if !auth.RequireFileOwner(w, r, s.store, req.FileID) {
+		return
+	}
 
+	err := s.store.RemoveTags(ctx, req.FileID, req.Tags)
+	if errors.Is(err, store.ErrNotFound) {
+		api.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		log.Println("PostgreSQL remove tags error:", err)
-		http.Error(w, "Failed to remove tags", http.StatusInternalServerError)
+		logger.Error("PostgreSQL remove tags error", "err", err)
+		api.Error(w, "Failed to remove tags", http.StatusInternalServerError)
 		return
 	}
 
 	if err := json.NewEncoder(w).Encode(map[string]string{
 		"message": "Tags removed successfully",
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
-func GetRecipientIDFromOPK(opkID string) (string, error) {
-	var userID string
-	err := DB.QueryRow(`SELECT user_id FROM one_time_pre_keys WHERE id = $1`, opkID).Scan(&userID)
-	if err != nil {
-		return "", err
-	}
-	return userID, nil
+func (s *Server) GetRecipientIDFromOPK(ctx context.Context, opkID string) (string, error) {
+	return s.store.OneTimePreKeyOwner(ctx, opkID)
 }
 
-var InsertReceivedFile = func(db *sql.DB, recipientId, senderId, fileId, metadataJson string, expiresAt time.Time) (string, error) {
+// InsertReceivedFile records a file sent to recipientId and returns the id
+// of the received_files row.
+func (s *Server) InsertReceivedFile(ctx context.Context, recipientId, senderId, fileId, metadataJson string, expiresAt time.Time) (string, error) {
 	// Step 1: Ensure the recipient exists
-	var exists bool
-	err := db.QueryRow(`
-		SELECT EXISTS (
-			SELECT 1 FROM users WHERE id = $1
-		)
-	`, recipientId).Scan(&exists)
-
+	exists, err := s.store.UserExists(ctx, recipientId)
 	if err != nil {
-		fmt.Println("Failed to check recipient existence")
 		return "", fmt.Errorf("failed to check recipient existence: %w", err)
 	}
 
 	if !exists {
-		fmt.Println("Recipient does not exist")
 		return "", fmt.Errorf("recipient user with id %s does not exist", recipientId)
 	}
 
-	// Step 2: Insert the received file and return its ID
-	var receivedFileID string
-	err = db.QueryRow(`
-		INSERT INTO received_files (
-			recipient_id, sender_id, file_id, received_at, expires_at, metadata
-		) VALUES ($1, $2, $3, NOW(), $4, $5)
-		RETURNING id
-	`, recipientId, senderId, fileId, expiresAt, metadataJson).Scan(&receivedFileID)
-
+	// Step 2: Insert the received file and return its ID. A zero expiresAt
+	// is stored as NULL: the share never expires.
+	f := store.ReceivedFile{
+		RecipientID: recipientId,
+		SenderID:    senderId,
+		FileID:      fileId,
+		Metadata:    metadataJson,
+	}
+	if !expiresAt.IsZero() {
+		f.ExpiresAt = &expiresAt
+	}
+	receivedFileID, err := s.store.AddReceivedFile(ctx, f)
 	if err != nil {
-		fmt.Println("Failed to insert received file into the received_files table")
 		return "", fmt.Errorf("failed to insert received file: %w", err)
 	}
 
 	return receivedFileID, nil
 }
 
-var InsertSentFile = func(db *sql.DB, senderId, recipientId, fileId, metadataJson string) error {
+// InsertSentFile records the key material of a file sent to recipientId.
+func (s *Server) InsertSentFile(ctx context.Context, senderId, recipientId, fileId, metadataJson string) error {
 	var metadata map[string]interface{}
 	if err := json.Unmarshal([]byte(metadataJson), &metadata); err != nil {
 		return fmt.Errorf("failed to parse metadata JSON: %w", err)
@@ -554,12 +552,13 @@ var InsertSentFile = func(db *sql.DB, senderId, recipientId, fileId, metadataJso
 		return fmt.Errorf("missing encryptedAesKey or ekPublicKey in metadata")
 	}
 
-	_, err := db.Exec(`
-		INSERT INTO sent_files (
-			sender_id, recipient_id, file_id, encrypted_file_key, x3dh_ephemeral_pubkey, sent_at
-		) VALUES ($1, $2, $3, $4, $5, NOW())
-	`, senderId, recipientId, fileId, encryptedAESKey, ekPublicKey)
-
+	_, err := s.store.AddSentFile(ctx, store.SentFile{
+		SenderID:            senderId,
+		RecipientID:         recipientId,
+		FileID:              fileId,
+		EncryptedFileKey:    encryptedAESKey,
+		X3DHEphemeralPubKey: ekPublicKey,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to insert into sent_files: %w", err)
 	}
@@ -572,173 +571,69 @@ type AddTagsRequest struct {
 	Tags   []string `json:"tags"`
 }
 
-func AddTagsHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) AddTagsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	var req AddTagsRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Println("Failed to parse JSON:", err)
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logger.Warn("Failed to parse JSON", "err", err)
+		api.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
 	if req.FileID == "" || len(req.Tags) == 0 {
-		http.Error(w, "Missing fileId or tags", http.StatusBadRequest)
+		api.Error(w, "Missing fileId or tags", http.StatusBadRequest)
 		return
 	}
 
-	_, err := DB.Exec(`
-		UPDATE files
-		SET tags = array_cat(COALESCE(tags, '{}'), $1::text[])
-		WHERE id = $2
-	`, pq.Array(req.Tags), req.FileID)
-	if err != nil {
-		log.Println("Failed to update tags:", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-
-	if err := json.NewEncoder(w).Encode(map[string]string{
-		"message": "Tags added successfully",
-	}); err != nil {
-		log.Println("Failed to encode response:", err)
-	}
-}
-
-func DeleteFolderHandler(w http.ResponseWriter, r *http.Request) {
-	type DeleteFolderRequest struct {
-		FolderID   string   `json:"folderId"`
-		ParentPath string   `json:"parentPath"`
-		Recursive  bool     `json:"recursive"`
-		Tags       []string `json:"tags"`
-	}
-
-	var req DeleteFolderRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Println("Failed to parse JSON:", err)
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if !auth.RequireFileOwner(w, r, s.store, req.FileID) {
 		return
 	}
 
-	if req.FolderID == "" {
-		http.Error(w, "Missing folderId", http.StatusBadRequest)
+	err := s.store.AddTags(ctx, req.FileID, req.Tags)
+	if errors.Is(err, store.ErrNotFound) {
+		api.Error(w, "File not found", http.StatusNotFound)
 		return
 	}
-
-	tx, err := DB.Begin()
 	if err != nil {
-		log.Println("Failed to start transaction:", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-	defer func() {
-		if err := tx.Rollback(); err != nil {
-			log.Println("Rollback error (may be expected if already committed):", err)
-		}
-	}()
-
-	if req.Recursive {
-		var folderCID string
-		err := tx.QueryRow(`
-			SELECT cid FROM files WHERE id = $1
-		`, req.FolderID).Scan(&folderCID)
-
-		if err != nil {
-			log.Println("Failed to fetch folder:", err)
-			http.Error(w, "Folder not found", http.StatusNotFound)
-			return
-		}
-
-		if len(req.Tags) > 0 {
-			_, err = tx.Exec(`
-				UPDATE files
-				SET tags = array_cat(COALESCE(tags, '{}'), $1::text[])
-				WHERE cid LIKE 'files/' || $2 || '/%'
-			`, pq.Array(req.Tags), folderCID)
-
-			if err != nil {
-				log.Println("Failed to add tags to descendants:", err)
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
-				return
-			}
-		}
-
-		_, err = tx.Exec(`
-			UPDATE files
-			SET cid = 'files/' || id
-			WHERE cid LIKE 'files/' || $1 || '/%'
-			AND NOT ('folder' = ANY(tags))
-		`, folderCID)
-
-		if err != nil {
-			log.Println("Failed to move files to root:", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-
-		_, err = tx.Exec(`
-			UPDATE files
-			SET cid = regexp_replace(cid, '^files/' || $1 || '/(.+?)(/.*)?$', '\1')
-			WHERE cid LIKE 'files/' || $1 || '/%'
-			AND 'folder' = ANY(tags)
-		`, folderCID)
-
-		if err != nil {
-			log.Println("Failed to move folders to root:", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	if len(req.Tags) > 0 {
-		_, err = tx.Exec(`
-			UPDATE files
-			SET tags = array_cat(COALESCE(tags, '{}'), $1::text[])
-			WHERE id = $2
-		`, pq.Array(req.Tags), req.FolderID)
-
-		if err != nil {
-			log.Println("Failed to add tags to folder:", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	if err = tx.Commit(); err != nil {
-		log.Println("Failed to commit transaction:", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		logger.Error("Failed to update tags", "err", err)
+		api.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+
 	if err := json.NewEncoder(w).Encode(map[string]string{
-		"message": "Folder deleted successfully",
+		"message": "Tags added successfully",
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
-func AddUserHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) AddUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	var req MetadataQueryRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Println("Failed to parse JSON:", err)
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logger.Warn("Failed to parse JSON", "err", err)
+		api.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
 		return
 	}
+	req.UserID = userID
 
 	if req.UserID == "" {
-		http.Error(w, "Missing userId", http.StatusBadRequest)
+		api.Error(w, "Missing userId", http.StatusBadRequest)
 		return
 	}
 
-	_, err := DB.Exec(`
-		INSERT INTO users (id)
-		VALUES ($1)
-		ON CONFLICT (id) DO NOTHING
-	`, req.UserID)
-	if err != nil {
-		log.Println("Failed to insert user:", err)
-		http.Error(w, "Failed to add user", http.StatusInternalServerError)
+	if err := s.store.AddUser(ctx, req.UserID); err != nil {
+		logger.Error("Failed to insert user", "err", err)
+		api.Error(w, "Failed to add user", http.StatusInternalServerError)
 		return
 	}
 
@@ -747,11 +642,13 @@ func AddUserHandler(w http.ResponseWriter, r *http.Request) {
 	if err := json.NewEncoder(w).Encode(map[string]string{
 		"message": "User added successfully",
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
-func AddDescriptionHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) AddDescriptionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	type DescriptionRequest struct {
 		FileID      string `json:"fileId"`
 		Description string `json:"description"`
@@ -759,24 +656,28 @@ func AddDescriptionHandler(w http.ResponseWriter, r *http.Request) {
 
 	var req DescriptionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Println("Failed to parse JSON:", err)
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logger.Warn("Failed to parse JSON", "err", err)
+		api.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
 	if req.FileID == "" || req.Description == "" {
-		http.Error(w, "Missing fileId or description", http.StatusBadRequest)
+		api.Error(w, "Missing fileId or description", http.StatusBadRequest)
+		return
+	}
+
+	if !auth.RequireFileOwner(w, r, s.store, req.FileID) {
 		return
 	}
 
-	_, err := DB.Exec(`
-		UPDATE files
-		SET description = $1
-		WHERE id = $2
-	`, req.Description, req.FileID)
+	err := s.store.SetDescription(ctx, req.FileID, req.Description)
+	if errors.Is(err, store.ErrNotFound) {
+		api.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		log.Println("Failed to update description:", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		logger.Error("Failed to update description", "err", err)
+		api.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
@@ -785,11 +686,13 @@ func AddDescriptionHandler(w http.ResponseWriter, r *http.Request) {
 	if err := json.NewEncoder(w).Encode(map[string]string{
 		"message": "Description updated successfully",
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
 
-func UpdateFilePathHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) UpdateFilePathHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
 	type UpdatePathRequest struct {
 		FileID  string `json:"fileId"`
 		NewPath string `json:"newPath"`
@@ -797,32 +700,41 @@ func UpdateFilePathHandler(w http.ResponseWriter, r *http.Request) {
 
 	var req UpdatePathRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Println("Failed to parse JSON:", err)
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logger.Warn("Failed to parse JSON", "err", err)
+		api.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
 	if req.FileID == "" || req.NewPath == "" {
-		http.Error(w, "Missing fileId or newPath", http.StatusBadRequest)
+		api.Error(w, "Missing fileId or newPath", http.StatusBadRequest)
+		return
+	}
+
+	if !auth.RequireFileOwner(w, r, s.store, req.FileID) {
 		return
 	}
 
-	_, err := DB.Exec(`
-		UPDATE files
-		SET cid = $1
-		WHERE id = $2
-	`, req.NewPath, req.FileID)
+	err := s.store.SetFilePath(ctx, req.FileID, req.NewPath)
+	if errors.Is(err, store.ErrNotFound) {
+		api.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		log.Println("Failed to update file path:", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		logger.Error("Failed to update file path", "err", err)
+		api.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	// keep the folder tree in step with the new path
+	if err := s.store.LinkParentFolder(ctx, req.FileID); err != nil {
+		logger.Error("Failed to link file to its folder", "err", err)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 
 	if err := json.NewEncoder(w).Encode(map[string]string{
 		"message": "File path updated successfully",
 	}); err != nil {
-		log.Println("Failed to encode response:", err)
+		logger.Warn("Failed to encode response", "err", err)
 	}
 }
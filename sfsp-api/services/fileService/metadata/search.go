@@ -0,0 +1,230 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 200
+)
+
+// SearchRequest filters and ranks the caller's files. Every field but
+// userId is optional; with no query the newest files come first.
+type SearchRequest struct {
+	UserID string `json:"userId"`
+	// Query is matched against the file name, description and tags. Every
+	// word must match, and the last letters of a word may be left off.
+	Query         string   `json:"query"`
+	FileTypes     []string `json:"fileTypes"`
+	MinSize       *int64   `json:"minSize"`
+	MaxSize       *int64   `json:"maxSize"`
+	CreatedAfter  string   `json:"createdAfter"`
+	CreatedBefore string   `json:"createdBefore"`
+	// FolderID or FolderPath (a folder's cid) limits the search to that
+	// folder, and with Recursive to everything below it too.
+	FolderID   string `json:"folderId"`
+	FolderPath string `json:"folderPath"`
+	Recursive  bool   `json:"recursive"`
+	// Shared is "shared", "private", "sent", "view" or "link".
+	Shared string `json:"shared"`
+	// Sort is "relevance" (the default with a query), "newest", "oldest",
+	// "name" or "size".
+	Sort   string `json:"sort"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+// SearchResult is one matching file. Highlights are HTML with the matched
+// words wrapped in <mark> tags.
+type SearchResult struct {
+	FileID      string            `json:"fileId"`
+	FileName    string            `json:"fileName"`
+	FileType    string            `json:"fileType"`
+	FileSize    int64             `json:"fileSize"`
+	Description string            `json:"description"`
+	Tags        []string          `json:"tags"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	ParentID    *string           `json:"parentId"`
+	CID         string            `json:"cid"`
+	Rank        float64           `json:"rank"`
+	Highlights  map[string]string `json:"highlights,omitempty"`
+}
+
+// SearchResponse is a page of results with facet counts over every match.
+type SearchResponse struct {
+	Total   int            `json:"total"`
+	Results []SearchResult `json:"results"`
+	Facets  SearchFacets   `json:"facets"`
+}
+
+type SearchFacets struct {
+	FileTypes map[string]int `json:"fileTypes"`
+	Tags      map[string]int `json:"tags"`
+}
+
+// searchShares and searchSorts are the values SearchRequest.Shared and
+// SearchRequest.Sort accept.
+var (
+	searchShares = map[string]bool{"": true, "shared": true, "private": true, "sent": true, "view": true, "link": true}
+	searchSorts  = map[string]bool{"relevance": true, "newest": true, "oldest": true, "name": true, "size": true}
+)
+
+// highlightHTML escapes a highlight from the store for HTML and wraps the
+// matches in <mark> tags, so file names and descriptions cannot inject
+// markup.
+func highlightHTML(headline string) string {
+	escaped := html.EscapeString(headline)
+	return strings.NewReplacer(store.HighlightStart, "<mark>", store.HighlightStop, "</mark>").Replace(escaped)
+}
+
+// searchQuery validates req and turns it into a store query. Words match by
+// prefix, so "quart rep" finds "quarterly report.pdf". Errors describe what
+// the caller got wrong.
+func searchQuery(req SearchRequest) (store.FileQuery, error) {
+	q := store.FileQuery{
+		OwnerID:    req.UserID,
+		Words:      store.SearchWords(req.Query),
+		FileTypes:  req.FileTypes,
+		MinSize:    req.MinSize,
+		MaxSize:    req.MaxSize,
+		FolderID:   req.FolderID,
+		FolderPath: strings.Trim(req.FolderPath, "/"),
+		Recursive:  req.Recursive,
+		Shared:     req.Shared,
+		Sort:       req.Sort,
+		Limit:      req.Limit,
+		Offset:     req.Offset,
+	}
+	if req.MinSize != nil && req.MaxSize != nil && *req.MinSize > *req.MaxSize {
+		return q, fmt.Errorf("minSize must not be larger than maxSize")
+	}
+	for _, bound := range []struct {
+		value, name string
+		t           **time.Time
+	}{
+		{req.CreatedAfter, "createdAfter", &q.CreatedAfter},
+		{req.CreatedBefore, "createdBefore", &q.CreatedBefore},
+	} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, bound.value)
+		if err != nil {
+			return q, fmt.Errorf("%s must be an RFC 3339 timestamp", bound.name)
+		}
+		*bound.t = &t
+	}
+	if req.FolderID != "" && req.FolderPath != "" {
+		return q, fmt.Errorf("set folderId or folderPath, not both")
+	}
+	if !searchShares[req.Shared] {
+		return q, fmt.Errorf("shared must be one of shared, private, sent, view or link")
+	}
+
+	if q.Sort == "" {
+		q.Sort = "newest"
+		if len(q.Words) > 0 {
+			q.Sort = "relevance"
+		}
+	}
+	if !searchSorts[q.Sort] {
+		return q, fmt.Errorf("sort must be one of relevance, newest, oldest, name or size")
+	}
+	return q, nil
+}
+
+// SearchHandler searches the caller's files by name, description and tags,
+// narrowed by type, size, creation date, folder and share state. Results
+// are ranked by relevance with the matches highlighted, and come with
+// file type and tag counts over all matches for faceted navigation.
+func (s *Server) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	var req SearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
+		return
+	}
+	req.UserID = userID
+	if req.UserID == "" {
+		api.Error(w, "Missing userId", http.StatusBadRequest)
+		return
+	}
+
+	if req.Limit <= 0 {
+		req.Limit = defaultSearchLimit
+	}
+	if req.Limit > maxSearchLimit {
+		req.Limit = maxSearchLimit
+	}
+	if req.Offset < 0 {
+		api.Error(w, "offset must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	q, err := searchQuery(req)
+	if err != nil {
+		api.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	found, err := s.store.SearchFiles(ctx, q)
+	if err != nil {
+		logger.Error("Search query failed", "err", err)
+		api.Error(w, "Search failed", http.StatusInternalServerError)
+		return
+	}
+
+	resp := SearchResponse{
+		Total:   found.Total,
+		Results: []SearchResult{},
+		Facets:  SearchFacets{FileTypes: found.FileTypes, Tags: found.Tags},
+	}
+	for _, m := range found.Matches {
+		res := SearchResult{
+			FileID:      m.File.ID,
+			FileName:    m.File.FileName,
+			FileType:    m.File.FileType,
+			FileSize:    m.File.FileSize,
+			Description: m.File.Description,
+			Tags:        m.File.Tags,
+			CreatedAt:   m.File.CreatedAt,
+			CID:         m.File.CID,
+			Rank:        m.Rank,
+		}
+		if m.File.ParentID != "" {
+			parentID := m.File.ParentID
+			res.ParentID = &parentID
+		}
+		if len(q.Words) > 0 {
+			res.Highlights = map[string]string{}
+			if strings.Contains(m.NameHighlight, store.HighlightStart) {
+				res.Highlights["fileName"] = highlightHTML(m.NameHighlight)
+			}
+			if strings.Contains(m.DescriptionHighlight, store.HighlightStart) {
+				res.Highlights["description"] = highlightHTML(m.DescriptionHighlight)
+			}
+		}
+		resp.Results = append(resp.Results, res)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Warn("Failed to encode response", "err", err)
+	}
+}
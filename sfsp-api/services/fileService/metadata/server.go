@@ -0,0 +1,53 @@
+package metadata
+
+import (
+	"time"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/database"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+)
+
+// Config tunes the behaviour of a Server.
+type Config struct {
+	// ShareExpiry is how long a share recorded by AddReceivedFileHandler
+	// lasts: the default of the share expiry policy, since the sender cannot
+	// choose one there.
+	ShareExpiry time.Duration
+}
+
+// DefaultConfig is used for zero fields in Config.
+var DefaultConfig = Config{
+	ShareExpiry: 48 * time.Hour,
+}
+
+// Server serves the file metadata endpoints from one database. Several
+// servers, each with its own database, can run in the same process.
+type Server struct {
+	db    database.Repository
+	store store.Store
+	cfg   Config
+	now   func() time.Time
+}
+
+// New returns a metadata server that reads and writes db.
+func New(db database.Repository, cfg Config) *Server {
+	if cfg.ShareExpiry <= 0 {
+		cfg.ShareExpiry = DefaultConfig.ShareExpiry
+	}
+	s := &Server{db: db, cfg: cfg, now: time.Now}
+	if db != nil {
+		s.store = store.NewPostgres(db)
+	}
+	return s
+}
+
+// SetStore replaces the store built from the database, e.g. with
+// store.NewMemory in tests.
+func (s *Server) SetStore(st store.Store) {
+	s.store = st
+}
+
+// SetClock overrides the time source; used by tests.
+func (s *Server) SetClock(now func() time.Time) {
+	s.now = now
+}
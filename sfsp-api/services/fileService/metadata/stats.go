@@ -0,0 +1,216 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/auth"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/store"
+)
+
+const (
+	defaultLargestFiles = 10
+	maxLargestFiles     = 100
+)
+
+// StorageBucket is the size and number of the files in one group.
+type StorageBucket struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+}
+
+type TypeStats struct {
+	FileType string `json:"fileType"`
+	StorageBucket
+}
+
+// FolderStats covers a folder and everything below it.
+type FolderStats struct {
+	FolderID string  `json:"folderId"`
+	Name     string  `json:"name"`
+	CID      string  `json:"cid"`
+	ParentID *string `json:"parentId"`
+	StorageBucket
+}
+
+type LargeFile struct {
+	FileID    string    `json:"fileId"`
+	FileName  string    `json:"fileName"`
+	FileType  string    `json:"fileType"`
+	FileSize  int64     `json:"fileSize"`
+	CID       string    `json:"cid"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ShareCounts struct {
+	Sent  int64 `json:"sent"`
+	View  int64 `json:"view"`
+	Links int64 `json:"links"`
+	Total int64 `json:"total"`
+}
+
+// StorageStats is a user's storage report. TotalBytes adds up the vault,
+// the trash, saved versions and every copy made for sharing.
+type StorageStats struct {
+	UserID          string        `json:"userId"`
+	TotalBytes      int64         `json:"totalBytes"`
+	Files           StorageBucket `json:"files"`
+	Trash           StorageBucket `json:"trash"`
+	Versions        StorageBucket `json:"versions"`
+	Sent            StorageBucket `json:"sent"`
+	ViewShares      StorageBucket `json:"viewShares"`
+	Links           StorageBucket `json:"links"`
+	Root            StorageBucket `json:"root"` // files outside any folder
+	ByType          []TypeStats   `json:"byType"`
+	ByFolder        []FolderStats `json:"byFolder"`
+	ActiveShares    ShareCounts   `json:"activeShares"`
+	PendingReceived int64         `json:"pendingReceived"`
+	LargestFiles    []LargeFile   `json:"largestFiles"`
+}
+
+// StorageStatsHandler reports how a user's storage is spent: bytes by file
+// type, per folder including subfolders, in the trash, in versions and in
+// shared copies, along with share counts and the largest files.
+func (s *Server) StorageStatsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := api.Detach(r)
+	logger := logging.FromContext(ctx)
+	var req struct {
+		UserID  string `json:"userId"`
+		Largest int    `json:"largest"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	userID, ok := auth.ResolveUserID(w, r, req.UserID)
+	if !ok {
+		return
+	}
+	if userID == "" {
+		api.Error(w, "Missing userId", http.StatusBadRequest)
+		return
+	}
+	if v := r.URL.Query().Get("largest"); v != "" && req.Largest == 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			api.Error(w, "Invalid largest", http.StatusBadRequest)
+			return
+		}
+		req.Largest = n
+	}
+	if req.Largest <= 0 {
+		req.Largest = defaultLargestFiles
+	}
+	if req.Largest > maxLargestFiles {
+		req.Largest = maxLargestFiles
+	}
+
+	stats, err := s.loadStorageStats(ctx, userID, req.Largest)
+	if err != nil {
+		logger.Error("Failed to load storage stats", "err", err)
+		api.Error(w, "Failed to load storage statistics", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		logger.Warn("Failed to encode response", "err", err)
+	}
+}
+
+// loadStorageStats builds the report from the store's running totals (see
+// store.StorageStats), so it costs the same however many files a user has.
+func (s *Server) loadStorageStats(ctx context.Context, userID string, largest int) (*StorageStats, error) {
+	stats := &StorageStats{
+		UserID:       userID,
+		ByType:       []TypeStats{},
+		ByFolder:     []FolderStats{},
+		LargestFiles: []LargeFile{},
+	}
+
+	totals, err := s.store.StorageTotals(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range totals {
+		b := StorageBucket{Bytes: t.Bytes, Files: t.Items}
+		switch t.Kind {
+		case store.StatsKindType:
+			stats.ByType = append(stats.ByType, TypeStats{FileType: t.Key, StorageBucket: b})
+			stats.Files.add(b)
+		case store.StatsKindFolder:
+			if t.Key == "" {
+				stats.Root = b
+			}
+		case store.StatsKindTrash:
+			stats.Trash.add(b)
+		case store.StatsKindVersion:
+			stats.Versions.add(b)
+		case store.StatsKindSent:
+			stats.Sent.add(b)
+		case store.StatsKindView:
+			stats.ViewShares.add(b)
+		case store.StatsKindLink:
+			stats.Links.add(b)
+		}
+	}
+	for _, b := range []StorageBucket{stats.Files, stats.Trash, stats.Versions, stats.Sent, stats.ViewShares, stats.Links} {
+		stats.TotalBytes += b.Bytes
+	}
+
+	folders, err := s.store.FolderTotals(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range folders {
+		f := FolderStats{
+			FolderID:      t.Folder.ID,
+			Name:          t.Folder.FileName,
+			CID:           t.Folder.CID,
+			StorageBucket: StorageBucket{Bytes: t.Bytes, Files: t.Items},
+		}
+		if t.Folder.ParentID != "" {
+			parentID := t.Folder.ParentID
+			f.ParentID = &parentID
+		}
+		stats.ByFolder = append(stats.ByFolder, f)
+	}
+
+	shares, err := s.store.ShareCounts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	stats.ActiveShares = ShareCounts{
+		Sent:  shares.Sent,
+		View:  shares.View,
+		Links: shares.Links,
+		Total: shares.Sent + shares.View + shares.Links,
+	}
+	stats.PendingReceived = shares.PendingReceived
+
+	files, err := s.store.LargestFiles(ctx, userID, largest)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		stats.LargestFiles = append(stats.LargestFiles, LargeFile{
+			FileID:    f.ID,
+			FileName:  f.FileName,
+			FileType:  f.FileType,
+			FileSize:  f.FileSize,
+			CID:       f.CID,
+			CreatedAt: f.CreatedAt,
+		})
+	}
+	return stats, nil
+}
+
+func (b *StorageBucket) add(o StorageBucket) {
+	b.Bytes += o.Bytes
+	b.Files += o.Files
+}
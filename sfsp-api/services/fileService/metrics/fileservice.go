@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Kinds of chunked transfer, used as the "kind" label.
+const (
+	KindUpload = "upload" // vault uploads
+	KindSend   = "send"   // copies sent to another user
+	KindView   = "view"   // view-only copies
+	KindLink   = "link"   // share link copies
+)
+
+// MergeBuckets suit chunk merges, which stream a whole file, in seconds.
+var MergeBuckets = []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+var (
+	UploadedBytes = NewCounterVec("fileservice_uploaded_bytes_total",
+		"Encrypted bytes received in chunks from clients.", "kind")
+	DownloadedBytes = NewCounter("fileservice_downloaded_bytes_total",
+		"Encrypted bytes streamed to clients.")
+
+	mergesInProgress = NewGaugeVec("fileservice_chunk_merges_in_progress",
+		"Chunked transfers being merged into their final blob.", "kind")
+	mergeDuration = NewHistogramVec("fileservice_chunk_merge_duration_seconds",
+		"Time taken to merge the chunks of a transfer.", MergeBuckets, "kind", "result")
+
+	storageDuration = NewHistogramVec("fileservice_storage_operation_duration_seconds",
+		"Latency of storage backend calls. For ReadStream and ReadRange this is the time to open the stream.",
+		DefBuckets, "operation")
+	storageErrors = NewCounterVec("fileservice_storage_operation_errors_total",
+		"Storage backend calls that failed.", "operation")
+
+	HashMismatches = NewCounterVec("fileservice_hash_mismatches_total",
+		"Downloads whose content did not match the recorded SHA-256.", "target")
+)
+
+// StartMerge records a merge of kind as in progress. Call the returned
+// function with whether the merge succeeded once it is done. Only the first
+// call counts, so a deferred finish(false) can catch every early return.
+func StartMerge(kind string) (finish func(ok bool)) {
+	start := time.Now()
+	inProgress := mergesInProgress.With(kind)
+	inProgress.Inc()
+	var once sync.Once
+	return func(ok bool) {
+		once.Do(func() {
+			inProgress.Dec()
+			result := "ok"
+			if !ok {
+				result = "error"
+			}
+			mergeDuration.With(kind, result).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
+// ObserveStorage records a storage backend call. It matches
+// storage.Observer.
+func ObserveStorage(op string, elapsed time.Duration, err error) {
+	storageDuration.With(op).Observe(elapsed.Seconds())
+	if err != nil {
+		storageErrors.With(op).Inc()
+	}
+}
+
+// RegisterDBStats exposes the connection pool statistics of db.
+func RegisterDBStats(db *sql.DB) {
+	gauge := func(name, help string, fn func(s sql.DBStats) float64) {
+		NewGaugeFunc(name, help, func() float64 { return fn(db.Stats()) })
+	}
+	counter := func(name, help string, fn func(s sql.DBStats) float64) {
+		NewCounterFunc(name, help, func() float64 { return fn(db.Stats()) })
+	}
+	gauge("fileservice_db_max_open_connections", "Maximum number of open connections to the database.",
+		func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) })
+	gauge("fileservice_db_open_connections", "Established connections, in use or idle.",
+		func(s sql.DBStats) float64 { return float64(s.OpenConnections) })
+	gauge("fileservice_db_in_use_connections", "Connections currently in use.",
+		func(s sql.DBStats) float64 { return float64(s.InUse) })
+	gauge("fileservice_db_idle_connections", "Idle connections.",
+		func(s sql.DBStats) float64 { return float64(s.Idle) })
+	counter("fileservice_db_wait_count_total", "Times a query waited for a free connection.",
+		func(s sql.DBStats) float64 { return float64(s.WaitCount) })
+	counter("fileservice_db_wait_duration_seconds_total", "Time spent waiting for a free connection.",
+		func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() })
+	counter("fileservice_db_max_idle_closed_total", "Connections closed because of the idle limit.",
+		func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) })
+	counter("fileservice_db_max_lifetime_closed_total", "Connections closed because they reached their maximum lifetime.",
+		func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) })
+}
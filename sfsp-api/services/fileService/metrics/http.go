@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+)
+
+// UnmatchedRoute labels requests no route matched, so unknown paths cannot
+// create new series.
+const UnmatchedRoute = "unmatched"
+
+var (
+	httpRequests = NewCounterVec("fileservice_http_requests_total",
+		"HTTP requests by method, route and status code.", "method", "route", "status")
+	httpDuration = NewHistogramVec("fileservice_http_request_duration_seconds",
+		"Time until the handler returned, including streaming the body.", DefBuckets, "method", "route")
+	httpInFlight = NewGauge("fileservice_http_requests_in_flight",
+		"Requests being served.")
+)
+
+// Middleware counts and times every request. route names the pattern that
+// serves a request, e.g. "/api/v1/files/{id}", or "" when none does.
+func Middleware(next http.Handler, route func(r *http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+
+		label := route(r)
+		if label == "" {
+			label = UnmatchedRoute
+		}
+		sw := api.NewStatusWriter(w)
+		next.ServeHTTP(sw, r)
+
+		method := methodLabel(r.Method)
+		httpRequests.With(method, label, strconv.Itoa(sw.Status())).Inc()
+		httpDuration.With(method, label).Observe(time.Since(start).Seconds())
+	})
+}
+
+// methodLabel keeps made-up methods from creating new series.
+func methodLabel(m string) string {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions:
+		return m
+	}
+	return "OTHER"
+}
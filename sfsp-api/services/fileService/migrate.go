@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/database"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/migrations"
+)
+
+// errUsage marks a migrate command line that could not be understood.
+var errUsage = errors.New("usage: fileService [flags] migrate up | down [n] | status")
+
+// runMigrate carries out "migrate up", "migrate down [n]" (one step by
+// default) or "migrate status" and writes the outcome to out.
+func runMigrate(ctx context.Context, db database.Repository, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "up":
+		if len(args) > 1 {
+			return errUsage
+		}
+		n, err := migrations.Up(ctx, db)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "applied %d migration(s)\n", n)
+	case "down":
+		steps := 1
+		if len(args) > 2 {
+			return errUsage
+		}
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return errUsage
+			}
+			steps = n
+		}
+		n, err := migrations.Down(ctx, db, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "reverted %d migration(s)\n", n)
+	case "status":
+		if len(args) > 1 {
+			return errUsage
+		}
+		version, pending, err := migrations.Status(ctx, db)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "schema version %d\n", version)
+		for _, m := range pending {
+			fmt.Fprintf(out, "pending %04d_%s\n", m.Version, m.Name)
+		}
+	default:
+		return errUsage
+	}
+	return nil
+}
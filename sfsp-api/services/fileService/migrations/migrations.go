@@ -0,0 +1,212 @@
+// Package migrations holds the service's PostgreSQL schema as numbered SQL
+// files embedded in the binary, and applies or reverts them in order while
+// recording progress in a schema_version table.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/database"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockID keys the advisory lock that keeps two instances starting at the
+// same time from applying the same migration twice.
+const lockID = 730146021
+
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one step of the schema, Up applies it and Down reverts it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// All returns every embedded migration ordered by version. Versions must
+// run from 1 without gaps and each needs both an up and a down file.
+func All() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		m := fileName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migration %s: unexpected file name", e.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := fs.ReadFile(files, "sql/"+e.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig := byVersion[version]
+		if mig == nil {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d: named both %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	all := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		all = append(all, *mig)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+	for i, mig := range all {
+		if mig.Version != i+1 {
+			return nil, fmt.Errorf("migration %d: expected version %d", mig.Version, i+1)
+		}
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %d: needs both an up and a down file", mig.Version)
+		}
+	}
+	return all, nil
+}
+
+// Up applies every migration newer than the recorded schema version, each in
+// its own transaction, and returns how many it applied.
+func Up(ctx context.Context, db database.Repository) (int, error) {
+	all, err := All()
+	if err != nil {
+		return 0, err
+	}
+	if err := ensureVersionTable(ctx, db); err != nil {
+		return 0, err
+	}
+	applied := 0
+	for _, mig := range all {
+		done, err := step(ctx, db, func(tx *sql.Tx, current int) (bool, error) {
+			if current >= mig.Version {
+				return false, nil
+			}
+			if _, err := tx.ExecContext(ctx, mig.Up); err != nil {
+				return false, err
+			}
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO schema_version (version, name) VALUES ($1, $2)`, mig.Version, mig.Name)
+			return true, err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %d_%s up: %w", mig.Version, mig.Name, err)
+		}
+		if done {
+			applied++
+		}
+	}
+	return applied, nil
+}
+
+// Down reverts the newest steps migrations, each in its own transaction, and
+// returns how many it reverted.
+func Down(ctx context.Context, db database.Repository, steps int) (int, error) {
+	all, err := All()
+	if err != nil {
+		return 0, err
+	}
+	if err := ensureVersionTable(ctx, db); err != nil {
+		return 0, err
+	}
+	reverted := 0
+	for reverted < steps {
+		var mig Migration
+		done, err := step(ctx, db, func(tx *sql.Tx, current int) (bool, error) {
+			if current == 0 {
+				return false, nil
+			}
+			if current > len(all) {
+				return false, fmt.Errorf("schema version %d is newer than this binary", current)
+			}
+			mig = all[current-1]
+			if _, err := tx.ExecContext(ctx, mig.Down); err != nil {
+				return false, err
+			}
+			_, err := tx.ExecContext(ctx, `DELETE FROM schema_version WHERE version = $1`, mig.Version)
+			return true, err
+		})
+		if err != nil {
+			if mig.Version == 0 {
+				return reverted, err
+			}
+			return reverted, fmt.Errorf("migration %d_%s down: %w", mig.Version, mig.Name, err)
+		}
+		if !done {
+			break
+		}
+		reverted++
+	}
+	return reverted, nil
+}
+
+// Status reports the recorded schema version and the migrations not yet
+// applied.
+func Status(ctx context.Context, db database.Repository) (int, []Migration, error) {
+	all, err := All()
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := ensureVersionTable(ctx, db); err != nil {
+		return 0, nil, err
+	}
+	var version int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version); err != nil {
+		return 0, nil, err
+	}
+	if version >= len(all) {
+		return version, nil, nil
+	}
+	return version, all[version:], nil
+}
+
+func ensureVersionTable(ctx context.Context, db database.Repository) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (
+		version    INT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`)
+	if err != nil {
+		return fmt.Errorf("create schema_version: %w", err)
+	}
+	return nil
+}
+
+// step runs fn in a transaction holding the migration lock, passing it the
+// schema version as of taking the lock. The transaction commits only when fn
+// reports it changed something.
+func step(ctx context.Context, db database.Repository, fn func(tx *sql.Tx, current int) (bool, error)) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, lockID); err != nil {
+		return false, err
+	}
+	var current int
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&current); err != nil {
+		return false, err
+	}
+	done, err := fn(tx, current)
+	if err != nil || !done {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS access_logs;
+DROP TABLE IF EXISTS shared_files_view;
+DROP TABLE IF EXISTS sent_files;
+DROP TABLE IF EXISTS received_files;
+DROP TABLE IF EXISTS files;
+DROP TABLE IF EXISTS one_time_pre_keys;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,94 @@
+-- The tables the service has always used. IF NOT EXISTS lets databases that
+-- were set up by hand adopt the migrations; users and one_time_pre_keys are
+-- shared with the user service.
+
+CREATE TABLE IF NOT EXISTS users (
+  id UUID PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS one_time_pre_keys (
+  id      UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS files (
+  id                 UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  owner_id           UUID NOT NULL,
+  file_name          TEXT NOT NULL,
+  file_type          TEXT NOT NULL DEFAULT 'file',
+  file_hash          TEXT NOT NULL DEFAULT '',
+  nonce              TEXT NOT NULL DEFAULT '',
+  description        TEXT NOT NULL DEFAULT '',
+  tags               TEXT[] DEFAULT '{}',
+  cid                TEXT NOT NULL DEFAULT '',
+  file_size          BIGINT NOT NULL DEFAULT 0,
+  allow_view_sharing BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS files_owner_idx ON files (owner_id);
+
+CREATE TABLE IF NOT EXISTS received_files (
+  id           UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  recipient_id UUID NOT NULL,
+  sender_id    UUID NOT NULL,
+  file_id      UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+  received_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires_at   TIMESTAMPTZ NOT NULL,
+  metadata     TEXT NOT NULL,
+  accepted     BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE INDEX IF NOT EXISTS received_files_recipient_idx ON received_files (recipient_id);
+
+CREATE TABLE IF NOT EXISTS sent_files (
+  id                    UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  sender_id             UUID NOT NULL,
+  recipient_id          UUID NOT NULL,
+  file_id               UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+  encrypted_file_key    TEXT NULL,
+  x3dh_ephemeral_pubkey TEXT NULL,
+  sent_at               TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS sent_files_sender_idx ON sent_files (sender_id);
+
+CREATE TABLE IF NOT EXISTS shared_files_view (
+  id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  sender_id      UUID NOT NULL,
+  recipient_id   UUID NOT NULL,
+  file_id        UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+  newfile_id     UUID NULL,
+  metadata       TEXT NOT NULL,
+  shared_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires_at     TIMESTAMPTZ NULL,
+  revoked        BOOLEAN NOT NULL DEFAULT FALSE,
+  revoked_at     TIMESTAMPTZ NULL,
+  access_granted BOOLEAN NOT NULL DEFAULT TRUE
+);
+CREATE INDEX IF NOT EXISTS shared_files_view_recipient_idx ON shared_files_view (recipient_id);
+CREATE INDEX IF NOT EXISTS shared_files_view_file_idx ON shared_files_view (file_id);
+
+-- access logs and notifications outlive the files they mention
+CREATE TABLE IF NOT EXISTS access_logs (
+  id        UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  file_id   UUID NOT NULL,
+  user_id   UUID NOT NULL,
+  action    TEXT NOT NULL,
+  message   TEXT NOT NULL DEFAULT '',
+  view_only BOOLEAN NOT NULL DEFAULT FALSE,
+  timestamp TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS access_logs_file_idx ON access_logs (file_id, timestamp DESC);
+
+CREATE TABLE IF NOT EXISTS notifications (
+  id               UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  type             TEXT NOT NULL,
+  "from"           UUID NOT NULL,
+  "to"             UUID NOT NULL,
+  file_name        TEXT NOT NULL DEFAULT '',
+  file_id          UUID NOT NULL,
+  received_file_id UUID NULL,
+  message          TEXT NOT NULL DEFAULT '',
+  timestamp        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  status           TEXT NOT NULL DEFAULT 'pending', -- pending | accepted | declined
+  read             BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE INDEX IF NOT EXISTS notifications_to_idx ON notifications ("to", timestamp DESC);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS upload_sessions (
+  file_id      UUID PRIMARY KEY REFERENCES files(id) ON DELETE CASCADE,
+  owner_id     UUID NOT NULL,
+  total_chunks INT NOT NULL DEFAULT 0,
+  chunk_size   BIGINT NOT NULL DEFAULT 0,
+  file_size    BIGINT NOT NULL DEFAULT 0,
+  status       TEXT NOT NULL DEFAULT 'uploading', -- uploading | assembling | complete
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS upload_session_chunks (
+  file_id     UUID NOT NULL REFERENCES upload_sessions(file_id) ON DELETE CASCADE,
+  chunk_index INT NOT NULL,
+  size        BIGINT NOT NULL,
+  hash        TEXT NOT NULL,
+  received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (file_id, chunk_index)
+);
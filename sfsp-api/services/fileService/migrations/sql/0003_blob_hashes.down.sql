@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS blob_hashes;
+ALTER TABLE files DROP COLUMN IF EXISTS corrupted_at;
@@ -0,0 +1,10 @@
+ALTER TABLE files ADD COLUMN IF NOT EXISTS corrupted_at TIMESTAMPTZ NULL;
+
+CREATE TABLE IF NOT EXISTS blob_hashes (
+  path         TEXT PRIMARY KEY,
+  file_id      UUID,
+  sha256       TEXT NOT NULL,
+  size         BIGINT,
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  corrupted_at TIMESTAMPTZ NULL
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS file_versions (
+  id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  file_id    UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+  version    INT NOT NULL,
+  nonce      TEXT NOT NULL,
+  file_hash  TEXT NOT NULL,
+  file_size  BIGINT NOT NULL,
+  blob_path  TEXT NOT NULL,
+  created_by UUID,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (file_id, version)
+);
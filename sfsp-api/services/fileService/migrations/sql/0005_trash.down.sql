@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS files_deleted_at_idx;
+ALTER TABLE files DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,9 @@
+ALTER TABLE files ADD COLUMN IF NOT EXISTS parent_id UUID NULL REFERENCES files(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS files_parent_id_idx ON files (parent_id);
+
+-- link existing folders and files to their parent through the cid path
+UPDATE files f SET parent_id = p.id
+FROM files p
+WHERE f.parent_id IS NULL
+  AND p.owner_id = f.owner_id AND p.file_type = 'folder' AND p.id <> f.id
+  AND (f.cid = 'files/' || p.cid || '/' || f.id OR f.cid = p.cid || '/' || f.file_name);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS shared_files_view_expiry_idx;
+DROP INDEX IF EXISTS received_files_expiry_idx;
+ALTER TABLE shared_files_view DROP COLUMN IF EXISTS expired_at;
+ALTER TABLE received_files DROP COLUMN IF EXISTS expired_at;
+-- shares that never expire get the old hardcoded lifetime of 48 hours
+UPDATE received_files SET expires_at = received_at + INTERVAL '48 hours' WHERE expires_at IS NULL;
+ALTER TABLE received_files ALTER COLUMN expires_at SET NOT NULL;
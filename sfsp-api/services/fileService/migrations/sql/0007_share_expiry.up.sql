@@ -0,0 +1,5 @@
+ALTER TABLE received_files ALTER COLUMN expires_at DROP NOT NULL;
+ALTER TABLE received_files ADD COLUMN IF NOT EXISTS expired_at TIMESTAMPTZ NULL;
+ALTER TABLE shared_files_view ADD COLUMN IF NOT EXISTS expired_at TIMESTAMPTZ NULL;
+CREATE INDEX IF NOT EXISTS received_files_expiry_idx ON received_files (expires_at) WHERE expired_at IS NULL;
+CREATE INDEX IF NOT EXISTS shared_files_view_expiry_idx ON shared_files_view (expires_at) WHERE expired_at IS NULL;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS share_links (
+  id              TEXT PRIMARY KEY,
+  token_hash      TEXT NOT NULL UNIQUE,
+  file_id         UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+  owner_id        UUID NOT NULL,
+  blob_path       TEXT NOT NULL,
+  metadata        TEXT NOT NULL DEFAULT '{}',
+  password_hash   TEXT NULL,
+  expires_at      TIMESTAMPTZ NULL,
+  max_downloads   INT NULL,
+  download_count  INT NOT NULL DEFAULT 0,
+  failed_attempts INT NOT NULL DEFAULT 0,
+  locked_until    TIMESTAMPTZ NULL,
+  revoked_at      TIMESTAMPTZ NULL,
+  created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS share_links_owner_idx ON share_links (owner_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS share_links_open_idx ON share_links (expires_at) WHERE revoked_at IS NULL;
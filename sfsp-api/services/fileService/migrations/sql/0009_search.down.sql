@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS files_owner_created_idx;
+DROP INDEX IF EXISTS files_search_idx;
+DROP TRIGGER IF EXISTS files_search_vector_trigger ON files;
+DROP FUNCTION IF EXISTS files_search_vector_update();
+ALTER TABLE files DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,21 @@
+ALTER TABLE files ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION files_search_vector_update() RETURNS trigger AS $$
+BEGIN
+  NEW.search_vector :=
+    setweight(to_tsvector('simple', COALESCE(NEW.file_name, '')), 'A') ||
+    setweight(to_tsvector('simple', COALESCE(NEW.description, '')), 'B') ||
+    setweight(to_tsvector('simple', array_to_string(COALESCE(NEW.tags, '{}'), ' ')), 'C');
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS files_search_vector_trigger ON files;
+CREATE TRIGGER files_search_vector_trigger
+  BEFORE INSERT OR UPDATE OF file_name, description, tags ON files
+  FOR EACH ROW EXECUTE FUNCTION files_search_vector_update();
+
+UPDATE files SET file_name = file_name WHERE search_vector IS NULL; -- backfill existing rows
+
+CREATE INDEX IF NOT EXISTS files_search_idx ON files USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS files_owner_created_idx ON files (owner_id, created_at DESC) WHERE deleted_at IS NULL;
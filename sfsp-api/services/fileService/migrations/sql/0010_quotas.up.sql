@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS quota_tiers (
+  name        TEXT PRIMARY KEY,
+  limit_bytes BIGINT NULL
+);
+CREATE TABLE IF NOT EXISTS user_quotas (
+  user_id     UUID PRIMARY KEY,
+  tier        TEXT NULL REFERENCES quota_tiers(name),
+  limit_bytes BIGINT NULL,
+  updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+INSERT INTO quota_tiers (name, limit_bytes) VALUES ('default', 5368709120) ON CONFLICT (name) DO NOTHING;
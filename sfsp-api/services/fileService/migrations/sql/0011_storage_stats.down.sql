@@ -0,0 +1,12 @@
+DROP TRIGGER IF EXISTS blob_hashes_storage_stats_trigger ON blob_hashes;
+DROP TRIGGER IF EXISTS blob_hashes_owner_trigger ON blob_hashes;
+DROP TRIGGER IF EXISTS files_storage_stats_trigger ON files;
+DROP FUNCTION IF EXISTS blob_hashes_storage_stats();
+DROP FUNCTION IF EXISTS blob_hashes_set_owner();
+DROP FUNCTION IF EXISTS blob_storage_kind(TEXT);
+DROP FUNCTION IF EXISTS files_storage_stats();
+DROP FUNCTION IF EXISTS files_storage_stats_apply(files, INT);
+DROP FUNCTION IF EXISTS storage_stats_add(UUID, TEXT, TEXT, BIGINT, BIGINT);
+ALTER TABLE blob_hashes DROP COLUMN IF EXISTS owner_id;
+DROP INDEX IF EXISTS files_owner_size_idx;
+DROP TABLE IF EXISTS storage_stats;
@@ -0,0 +1,102 @@
+CREATE TABLE IF NOT EXISTS storage_stats (
+  owner_id UUID   NOT NULL,
+  kind     TEXT   NOT NULL, -- type, folder, trash, version, sent, view or link
+  key      TEXT   NOT NULL DEFAULT '', -- the file_type or folder id
+  bytes    BIGINT NOT NULL DEFAULT 0,
+  items    BIGINT NOT NULL DEFAULT 0,
+  PRIMARY KEY (owner_id, kind, key)
+);
+CREATE INDEX IF NOT EXISTS files_owner_size_idx ON files (owner_id, file_size DESC) WHERE deleted_at IS NULL AND file_type <> 'folder';
+ALTER TABLE blob_hashes ADD COLUMN IF NOT EXISTS owner_id UUID NULL;
+
+CREATE OR REPLACE FUNCTION storage_stats_add(p_owner UUID, p_kind TEXT, p_key TEXT, p_bytes BIGINT, p_items BIGINT) RETURNS void AS $$
+  INSERT INTO storage_stats AS s (owner_id, kind, key, bytes, items) VALUES (p_owner, p_kind, p_key, p_bytes, p_items)
+  ON CONFLICT (owner_id, kind, key) DO UPDATE SET bytes = s.bytes + EXCLUDED.bytes, items = s.items + EXCLUDED.items;
+$$ LANGUAGE sql;
+
+-- a file counts by type and folder while live, and in the trash once deleted
+CREATE OR REPLACE FUNCTION files_storage_stats_apply(f files, dir INT) RETURNS void AS $$
+BEGIN
+  IF f.file_type IS NOT DISTINCT FROM 'folder' OR f.owner_id IS NULL THEN
+    RETURN;
+  END IF;
+  IF f.deleted_at IS NULL THEN
+    PERFORM storage_stats_add(f.owner_id, 'type', COALESCE(f.file_type, ''), dir * COALESCE(f.file_size, 0), dir);
+    PERFORM storage_stats_add(f.owner_id, 'folder', COALESCE(f.parent_id::text, ''), dir * COALESCE(f.file_size, 0), dir);
+  ELSE
+    PERFORM storage_stats_add(f.owner_id, 'trash', '', dir * COALESCE(f.file_size, 0), dir);
+  END IF;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION files_storage_stats() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP <> 'INSERT' THEN PERFORM files_storage_stats_apply(OLD, -1); END IF;
+  IF TG_OP <> 'DELETE' THEN PERFORM files_storage_stats_apply(NEW, 1); END IF;
+  RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION blob_storage_kind(path TEXT) RETURNS TEXT AS $$
+  SELECT CASE
+    WHEN path LIKE 'versions/%' THEN 'version'
+    WHEN path LIKE 'links/%' THEN 'link'
+    WHEN split_part(path, '/', 1) = 'files' AND split_part(path, '/', 3) = 'sent' THEN 'sent'
+    WHEN split_part(path, '/', 1) = 'files' AND split_part(path, '/', 3) = 'shared_view' THEN 'view'
+  END
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION blob_hashes_set_owner() RETURNS trigger AS $$
+BEGIN
+  IF NEW.owner_id IS NULL THEN
+    SELECT owner_id INTO NEW.owner_id FROM files WHERE id = NEW.file_id;
+  END IF;
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION blob_hashes_storage_stats() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP <> 'INSERT' AND OLD.owner_id IS NOT NULL AND blob_storage_kind(OLD.path) IS NOT NULL THEN
+    PERFORM storage_stats_add(OLD.owner_id, blob_storage_kind(OLD.path), '', -COALESCE(OLD.size, 0), -1);
+  END IF;
+  IF TG_OP <> 'DELETE' AND NEW.owner_id IS NOT NULL AND blob_storage_kind(NEW.path) IS NOT NULL THEN
+    PERFORM storage_stats_add(NEW.owner_id, blob_storage_kind(NEW.path), '', COALESCE(NEW.size, 0), 1);
+  END IF;
+  RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+-- recount from scratch with writes held off, then let the triggers take over
+LOCK TABLE files, blob_hashes IN SHARE ROW EXCLUSIVE MODE;
+DROP TRIGGER IF EXISTS files_storage_stats_trigger ON files;
+DROP TRIGGER IF EXISTS blob_hashes_owner_trigger ON blob_hashes;
+DROP TRIGGER IF EXISTS blob_hashes_storage_stats_trigger ON blob_hashes;
+DELETE FROM storage_stats;
+UPDATE blob_hashes b SET owner_id = f.owner_id FROM files f WHERE f.id = b.file_id;
+INSERT INTO storage_stats (owner_id, kind, key, bytes, items)
+SELECT owner_id, kind, key, SUM(COALESCE(size, 0)), COUNT(*) FROM (
+  SELECT owner_id, 'type' AS kind, COALESCE(file_type, '') AS key, file_size AS size FROM files
+  WHERE file_type IS DISTINCT FROM 'folder' AND deleted_at IS NULL
+  UNION ALL
+  SELECT owner_id, 'folder', COALESCE(parent_id::text, ''), file_size FROM files
+  WHERE file_type IS DISTINCT FROM 'folder' AND deleted_at IS NULL
+  UNION ALL
+  SELECT owner_id, 'trash', '', file_size FROM files
+  WHERE file_type IS DISTINCT FROM 'folder' AND deleted_at IS NOT NULL
+  UNION ALL
+  SELECT owner_id, blob_storage_kind(path), '', size FROM blob_hashes
+  WHERE blob_storage_kind(path) IS NOT NULL
+) AS usage
+WHERE owner_id IS NOT NULL
+GROUP BY owner_id, kind, key;
+
+CREATE TRIGGER files_storage_stats_trigger
+  AFTER INSERT OR DELETE OR UPDATE OF owner_id, file_type, file_size, parent_id, deleted_at ON files
+  FOR EACH ROW EXECUTE FUNCTION files_storage_stats();
+CREATE TRIGGER blob_hashes_owner_trigger
+  BEFORE INSERT ON blob_hashes
+  FOR EACH ROW EXECUTE FUNCTION blob_hashes_set_owner();
+CREATE TRIGGER blob_hashes_storage_stats_trigger
+  AFTER INSERT OR DELETE OR UPDATE OF path, size, owner_id ON blob_hashes
+  FOR EACH ROW EXECUTE FUNCTION blob_hashes_storage_stats();
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS files_live_name_idx;
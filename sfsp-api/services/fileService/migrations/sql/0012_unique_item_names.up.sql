@@ -0,0 +1,5 @@
+-- two live items in one folder may not share a name; MoveHandler checks
+-- first, this catches whatever slips past it
+CREATE UNIQUE INDEX IF NOT EXISTS files_live_name_idx
+  ON files (owner_id, parent_id, file_name)
+  WHERE deleted_at IS NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS link_upload_chunks;
+DROP TABLE IF EXISTS link_uploads;
@@ -0,0 +1,19 @@
+-- chunked uploads of share link copies; an upload's id becomes the id of
+-- the link it creates
+CREATE TABLE IF NOT EXISTS link_uploads (
+  id           TEXT PRIMARY KEY,
+  file_id      UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+  owner_id     UUID NOT NULL,
+  total_chunks INT NOT NULL,
+  status       TEXT NOT NULL DEFAULT 'uploading', -- uploading | assembling
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS link_upload_chunks (
+  upload_id   TEXT NOT NULL REFERENCES link_uploads(id) ON DELETE CASCADE,
+  chunk_index INT NOT NULL,
+  size        BIGINT NOT NULL,
+  received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (upload_id, chunk_index)
+);
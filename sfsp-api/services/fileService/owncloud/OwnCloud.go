@@ -1,75 +1,60 @@
 package owncloud
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
-	"os"
 	"io"
+	"io/fs"
+	"path"
 	"strings"
-	"github.com/studio-b12/gowebdav"
-)
-
-type WebDavClient interface {
-	MkdirAll(path string, perm os.FileMode) error
-	Write(name string, data []byte, perm os.FileMode) error
-	WriteStream(name string, src io.Reader, perm os.FileMode) error
-	Read(name string) ([]byte, error)
-	ReadStream(name string) (io.ReadCloser, error)
-	Remove(path string) error
-}
 
-var client WebDavClient
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/logging"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/storage"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
 
-func SetClient(c WebDavClient) {
-	client = c
+// Client lays the file service's blobs out on a storage backend: uploaded
+// files, chunks, sent copies, versions and share link copies.
+type Client struct {
+	backend storage.Backend
 }
 
-type OwnCloudClient struct {
-	*gowebdav.Client
+// New returns a client that stores blobs in backend.
+func New(backend storage.Backend) *Client {
+	return &Client{backend: backend}
 }
 
-func (c *OwnCloudClient) MkdirAll(path string, perm os.FileMode) error {
-	return c.Client.MkdirAll(path, perm)
-}
-func (c *OwnCloudClient) Write(name string, data []byte, perm os.FileMode) error {
-	return c.Client.Write(name, data, perm)
-}
-func (c *OwnCloudClient) WriteStream(name string, src io.Reader, perm os.FileMode) error {
-	return c.Client.WriteStream(name, src, perm)
-}
-func (c *OwnCloudClient) Read(name string) ([]byte, error) {
-	return c.Client.Read(name)
-}
-func (c *OwnCloudClient) ReadStream(name string) (io.ReadCloser, error) {
-	return c.Client.ReadStream(name)
-}
-func (c *OwnCloudClient) Remove(path string) error {
-	return c.Client.Remove(path)
+// Backend returns the storage backend the client writes to.
+func (c *Client) Backend() storage.Backend {
+	return c.backend
 }
 
-func InitOwnCloud(url, username, password string) {
-	c := &OwnCloudClient{
-		Client: gowebdav.NewClient(url, username, password),
-	}
-	client = c
-	log.Println("✅ OwnCloud connected")
+// startSpan starts the span of a storage call, e.g. "owncloud.DeleteFile".
+// Spans of calls that return a stream end once the stream is open.
+func startSpan(ctx context.Context, name, path string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "owncloud."+name, attribute.String("storage.path", path))
 }
 
-var UploadFileStream = func(path, filename string, reader io.Reader) error {
+func (c *Client) UploadFileStream(ctx context.Context, path, filename string, reader io.Reader) (err error) {
     // Trim any leading slashes from the folder
     cleanFolder := strings.TrimLeft(path, "/")
 
     // Construct the full remote file path
     fullPath := cleanFolder + "/" + filename
-    log.Println("Streaming upload to WebDAV:", fullPath)
+    logging.FromContext(ctx).Debug("Uploading to storage", "path", fullPath)
+    _, span := startSpan(ctx, "UploadFileStream", fullPath)
+    defer func() { tracing.End(span, err) }()
 
     // Ensure the folder exists
-    if err := client.MkdirAll(cleanFolder, 0755); err != nil {
+    if err := c.backend.MkdirAll(cleanFolder); err != nil {
         return fmt.Errorf("mkdir failed: %w", err)
     }
 
     // Stream the file to WebDAV
-    if err := client.WriteStream(fullPath, reader, 0644); err != nil {
+    if err := c.backend.WriteStream(fullPath, reader); err != nil {
         return fmt.Errorf("stream write failed: %w", err)
     }
 
@@ -77,81 +62,288 @@ var UploadFileStream = func(path, filename string, reader io.Reader) error {
 }
 
 
-var CreateFileStream = func(path, filename string) (io.WriteCloser, error) {
+// StreamWriter feeds the upload started by CreateFileStream. Close finishes
+// the upload and returns the backend's error once it has completed, so callers
+// only record a blob after Close succeeds. CloseWithError abandons the upload
+// instead, failing the backend write so no partial blob is stored.
+type StreamWriter struct {
+	pw   *io.PipeWriter
+	done chan struct{}
+	err  error
+}
+
+func (w *StreamWriter) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+// Close ends the upload and waits for the backend to finish it.
+func (w *StreamWriter) Close() error {
+	_ = w.pw.Close()
+	<-w.done
+	return w.err
+}
+
+// CloseWithError abandons the upload with err and waits for the backend write
+// to return.
+func (w *StreamWriter) CloseWithError(err error) {
+	_ = w.pw.CloseWithError(err)
+	<-w.done
+}
+
+// CreateFileStream's span lasts until the upload behind the writer ends.
+func (c *Client) CreateFileStream(ctx context.Context, path, filename string) (*StreamWriter, error) {
     // Clean path
     cleanFolder := strings.TrimLeft(path, "/")
     fullPath := cleanFolder + "/" + filename
-    log.Println("Create streaming upload to WebDAV:", fullPath)
+    logging.FromContext(ctx).Debug("Streaming upload to storage", "path", fullPath)
+    _, span := startSpan(ctx, "CreateFileStream", fullPath)
 
     // Ensure folder exists
-    if err := client.MkdirAll(cleanFolder, 0755); err != nil {
-        return nil, fmt.Errorf("mkdir failed: %w", err)
+    if err := c.backend.MkdirAll(cleanFolder); err != nil {
+        err = fmt.Errorf("mkdir failed: %w", err)
+        tracing.End(span, err)
+        return nil, err
     }
 
     // Create pipe
     pr, pw := io.Pipe()
+    w := &StreamWriter{pw: pw, done: make(chan struct{})}
 
     // Launch goroutine to stream to WebDAV
 	go func() {
-		defer func() {
-			if err := pr.Close(); err != nil {
-				log.Println("error closing pipe reader:", err)
-			}
-		}()
-		err := client.WriteStream(fullPath, pr, 0644)
+		defer close(w.done)
+		err := c.backend.WriteStream(fullPath, pr)
+		tracing.End(span, err)
 		if err != nil {
-			log.Println("❌ Stream write failed:", err)
-			pr.CloseWithError(err)
-			return
+			logging.FromContext(ctx).Error("Stream write failed", "path", fullPath, "err", err)
+			w.err = fmt.Errorf("stream write failed: %w", err)
 		}
-		log.Println("✅ Finished streaming to OwnCloud:", fullPath)
+		// unblock any writer still waiting on a backend that stopped reading
+		pr.CloseWithError(err)
 	}()
 
     // Return the writer side to caller
-    return pw, nil
+    return w, nil
 }
 
-var DownloadFileStream = func(fileId string) (io.ReadCloser, error) {
+func (c *Client) DownloadFileStream(ctx context.Context, fileId string) (io.ReadCloser, error) {
 	path := fmt.Sprintf("files/%s", fileId)
-	return client.ReadStream(path)
+	_, span := startSpan(ctx, "DownloadFileStream", path)
+	stream, err := c.backend.ReadStream(path)
+	tracing.End(span, err)
+	return stream, err
 }
 
-var DownloadFileStreamTemp = func(Path string) (io.ReadCloser, error) {
+// DownloadFileRange streams length bytes of a stored file starting at
+// offset, without downloading the bytes before it where the backend allows.
+func (c *Client) DownloadFileRange(ctx context.Context, fileId string, offset, length int64) (io.ReadCloser, error) {
+	path := fmt.Sprintf("files/%s", fileId)
+	_, span := startSpan(ctx, "DownloadFileRange", path)
+	stream, err := storage.ReadRange(c.backend, path, offset, length)
+	tracing.End(span, err)
+	return stream, err
+}
+
+func (c *Client) DownloadFileStreamTemp(ctx context.Context, Path string) (io.ReadCloser, error) {
 	cleanPath := strings.TrimLeft(Path, "/")
-	fmt.Println("CleanPath is: ", cleanPath)
-	log.Println("Downloading (stream) from path:", cleanPath)
-	return client.ReadStream(cleanPath)
+	logging.FromContext(ctx).Debug("Downloading from storage", "path", cleanPath)
+	_, span := startSpan(ctx, "DownloadFileStreamTemp", cleanPath)
+	stream, err := c.backend.ReadStream(cleanPath)
+	tracing.End(span, err)
+	return stream, err
 }
 
-var DeleteFile = func(fileId, userID string) error {
+func (c *Client) DeleteFile(ctx context.Context, fileId, userID string) error {
 	path := "files/" + userID
-	fmt.Println("Path is: ", path)
 	fullPath := fmt.Sprintf("%s/%s", path, fileId)
-	err := client.Remove(fullPath)
+	_, span := startSpan(ctx, "DeleteFile", fullPath)
+	err := c.backend.Remove(fullPath)
+	tracing.End(span, err)
 	if err != nil {
 		return fmt.Errorf("failed to delete the file: %w", err)
 	}
 	return nil
 }
 
-var DeleteFileTemp = func(filePath string) error {
-	log.Println("Deleting temporary file:", filePath)
+// DeleteStoredFile removes the blob of an uploaded file, files/<fileId>.
+func (c *Client) DeleteStoredFile(ctx context.Context, fileId string) error {
+	_, span := startSpan(ctx, "DeleteStoredFile", "files/"+fileId)
+	err := c.backend.Remove("files/" + fileId)
+	tracing.End(span, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete the file: %w", err)
+	}
+	return nil
+}
+
+// LinkPath is where the ciphertext copy behind a share link is kept.
+func LinkPath(fileId, linkId string) string {
+	return fmt.Sprintf("links/%s/%s", fileId, linkId)
+}
+
+// DownloadLinkCopy streams the ciphertext copy behind a share link.
+func (c *Client) DownloadLinkCopy(ctx context.Context, fileId, linkId string) (io.ReadCloser, error) {
+	_, span := startSpan(ctx, "DownloadLinkCopy", LinkPath(fileId, linkId))
+	stream, err := c.backend.ReadStream(LinkPath(fileId, linkId))
+	tracing.End(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download link copy: %w", err)
+	}
+	return stream, nil
+}
+
+// DeleteLinkCopy removes the ciphertext copy behind a share link.
+func (c *Client) DeleteLinkCopy(ctx context.Context, fileId, linkId string) error {
+	_, span := startSpan(ctx, "DeleteLinkCopy", LinkPath(fileId, linkId))
+	err := c.backend.Remove(LinkPath(fileId, linkId))
+	tracing.End(span, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete link copy: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) DeleteFileTemp(ctx context.Context, filePath string) error {
+	logging.FromContext(ctx).Debug("Deleting temporary file", "path", filePath)
 	cleanPath := strings.TrimLeft(filePath, "/")
-	err := client.Remove(cleanPath)
+	_, span := startSpan(ctx, "DeleteFileTemp", cleanPath)
+	err := c.backend.Remove(cleanPath)
+	tracing.End(span, err)
 	if err != nil {
 		return fmt.Errorf("failed to delete temporary file: %w", err)
 	}
 	return nil
 }
 
-var DownloadSentFileStream = func(filePath string) (io.ReadCloser, error) {
-	log.Println("=========================== inside here")
-	log.Println("Path is: ", filePath)
-	stream, err := client.ReadStream(filePath)
+func (c *Client) DownloadSentFileStream(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	logging.FromContext(ctx).Debug("Downloading from storage", "path", filePath)
+	_, span := startSpan(ctx, "DownloadSentFileStream", filePath)
+	stream, err := c.backend.ReadStream(filePath)
+	tracing.End(span, err)
 	if err != nil {
-		log.Println("Failed to stream file:", err)
 		return nil, fmt.Errorf("failed to download file: %w", err)
 	}
 
 	return stream, nil
 }
+
+// DownloadSentFileRange is the ranged counterpart of DownloadSentFileStream.
+func (c *Client) DownloadSentFileRange(ctx context.Context, filePath string, offset, length int64) (io.ReadCloser, error) {
+	_, span := startSpan(ctx, "DownloadSentFileRange", filePath)
+	stream, err := storage.ReadRange(c.backend, filePath, offset, length)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	return stream, nil
+}
+
+// VersionPath is where version n of a file's blob is kept.
+func VersionPath(fileId string, version int) string {
+	return fmt.Sprintf("versions/%s/%d", fileId, version)
+}
+
+func (c *Client) copyBlob(ctx context.Context, name, src, dst string) (err error) {
+	_, span := startSpan(ctx, name, dst)
+	span.SetAttributes(attribute.String("storage.source", src))
+	defer func() { tracing.End(span, err) }()
+
+	stream, err := c.backend.ReadStream(src)
+	if err != nil {
+		return fmt.Errorf("read %s failed: %w", src, err)
+	}
+	defer stream.Close()
+
+	if err := c.backend.MkdirAll(path.Dir(dst)); err != nil {
+		return fmt.Errorf("mkdir failed: %w", err)
+	}
+	if err := c.backend.WriteStream(dst, stream); err != nil {
+		return fmt.Errorf("write %s failed: %w", dst, err)
+	}
+	return nil
+}
+
+// SaveVersion copies the current blob of a file to its version slot.
+func (c *Client) SaveVersion(ctx context.Context, fileId string, version int) error {
+	return c.copyBlob(ctx, "SaveVersion", "files/"+fileId, VersionPath(fileId, version))
+}
+
+// RestoreVersion copies a saved version back over the current blob.
+func (c *Client) RestoreVersion(ctx context.Context, fileId string, version int) error {
+	return c.copyBlob(ctx, "RestoreVersion", VersionPath(fileId, version), "files/"+fileId)
+}
+
+func (c *Client) DownloadVersionStream(ctx context.Context, fileId string, version int) (io.ReadCloser, error) {
+	_, span := startSpan(ctx, "DownloadVersionStream", VersionPath(fileId, version))
+	stream, err := c.backend.ReadStream(VersionPath(fileId, version))
+	tracing.End(span, err)
+	return stream, err
+}
+
+// DownloadVersionRange is the ranged counterpart of DownloadVersionStream.
+func (c *Client) DownloadVersionRange(ctx context.Context, fileId string, version int, offset, length int64) (io.ReadCloser, error) {
+	_, span := startSpan(ctx, "DownloadVersionRange", VersionPath(fileId, version))
+	stream, err := storage.ReadRange(c.backend, VersionPath(fileId, version), offset, length)
+	tracing.End(span, err)
+	return stream, err
+}
+
+func (c *Client) DeleteVersion(ctx context.Context, fileId string, version int) error {
+	_, span := startSpan(ctx, "DeleteVersion", VersionPath(fileId, version))
+	err := c.backend.Remove(VersionPath(fileId, version))
+	tracing.End(span, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete version %d: %w", version, err)
+	}
+	return nil
+}
+
+// DeleteVersions removes every saved version of a file. Backends that
+// cannot list blobs are skipped and their versions are left in place.
+func (c *Client) DeleteVersions(ctx context.Context, fileId string) (err error) {
+	_, span := startSpan(ctx, "DeleteVersions", "versions/"+fileId)
+	defer func() { tracing.End(span, err) }()
+
+	lister, ok := c.backend.(storage.Lister)
+	if !ok {
+		return nil
+	}
+	objects, err := lister.List("versions/" + fileId)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, storage.ErrListUnsupported) {
+			return nil
+		}
+		return fmt.Errorf("failed to list versions: %w", err)
+	}
+	for _, obj := range objects {
+		if err := c.backend.Remove(obj.Path); err != nil {
+			return fmt.Errorf("failed to delete version %s: %w", obj.Path, err)
+		}
+	}
+	return nil
+}
+
+// DeleteLinkCopies removes the copies behind every share link of a file.
+// Like DeleteVersions, it skips backends that cannot list blobs.
+func (c *Client) DeleteLinkCopies(ctx context.Context, fileId string) (err error) {
+	_, span := startSpan(ctx, "DeleteLinkCopies", "links/"+fileId)
+	defer func() { tracing.End(span, err) }()
+
+	lister, ok := c.backend.(storage.Lister)
+	if !ok {
+		return nil
+	}
+	objects, err := lister.List("links/" + fileId)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, storage.ErrListUnsupported) {
+			return nil
+		}
+		return fmt.Errorf("failed to list link copies: %w", err)
+	}
+	for _, obj := range objects {
+		if err := c.backend.Remove(obj.Path); err != nil {
+			return fmt.Errorf("failed to delete link copy %s: %w", obj.Path, err)
+		}
+	}
+	return nil
+}
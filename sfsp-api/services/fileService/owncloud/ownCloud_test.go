@@ -1,6 +1,7 @@
 package owncloud_test
 
 import (
+	"context"
 	"errors"
 	"io"
 	"io/fs"
@@ -9,6 +10,7 @@ import (
 	"testing"
 
 	oc "github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/owncloud"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -41,12 +43,11 @@ func (m *mockWebDAV) Remove(p string) error {
 	return m.Called(p).Error(0)
 }
 
-func setup(t *testing.T) *mockWebDAV {
+// setup returns a client over a mocked WebDAV connection.
+func setup(t *testing.T) (*mockWebDAV, *oc.Client) {
 	t.Helper()
 	c := &mockWebDAV{}
-	oc.SetClient(c)
-	t.Cleanup(func() { oc.SetClient(nil) })
-	return c
+	return c, oc.New(storage.NewWebDAVFromClient(c))
 }
 
 func drain(r io.Reader) bool {
@@ -64,7 +65,7 @@ func rc(s string) io.ReadCloser {
 }
 
 func TestUploadFileStream_Success(t *testing.T) {
-	c := setup(t)
+	c, client := setup(t)
 
 	reader := strings.NewReader("test file content")
 
@@ -79,13 +80,13 @@ func TestUploadFileStream_Success(t *testing.T) {
 		mock.Anything,
 	).Return(nil).Once()
 
-	err := oc.UploadFileStream("/test/folder", "test.txt", reader)
+	err := client.UploadFileStream(context.Background(), "/test/folder", "test.txt", reader)
 	require.NoError(t, err)
 	c.AssertExpectations(t)
 }
 
 func TestUploadFileStream_MkdirFails(t *testing.T) {
-	c := setup(t)
+	c, client := setup(t)
 	reader := strings.NewReader("x")
 
 	c.On("MkdirAll",
@@ -93,14 +94,14 @@ func TestUploadFileStream_MkdirFails(t *testing.T) {
 		mock.Anything,
 	).Return(errors.New("mkdir failed")).Once()
 
-	err := oc.UploadFileStream("/test/folder", "test.txt", reader)
+	err := client.UploadFileStream(context.Background(), "/test/folder", "test.txt", reader)
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "mkdir failed")
 	c.AssertExpectations(t)
 }
 
 func TestUploadFileStream_WriteStreamFails(t *testing.T) {
-	c := setup(t)
+	c, client := setup(t)
 	reader := strings.NewReader("x")
 
 	c.On("MkdirAll",
@@ -114,14 +115,14 @@ func TestUploadFileStream_WriteStreamFails(t *testing.T) {
 		mock.Anything,
 	).Return(errors.New("write failed")).Once()
 
-	err := oc.UploadFileStream("/test/folder", "test.txt", reader)
+	err := client.UploadFileStream(context.Background(), "/test/folder", "test.txt", reader)
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "write failed")
 	c.AssertExpectations(t)
 }
 
 func TestUploadFileStream_PathCleaning(t *testing.T) {
-	c := setup(t)
+	c, client := setup(t)
 	reader := strings.NewReader("x")
 
 	c.On("MkdirAll",
@@ -135,13 +136,13 @@ func TestUploadFileStream_PathCleaning(t *testing.T) {
 		mock.Anything,
 	).Return(nil).Once()
 
-	err := oc.UploadFileStream("///test/folder///", "test.txt", reader)
+	err := client.UploadFileStream(context.Background(), "///test/folder///", "test.txt", reader)
 	require.NoError(t, err)
 	c.AssertExpectations(t)
 }
 
 func TestCreateFileStream_Success(t *testing.T) {
-	c := setup(t)
+	c, client := setup(t)
 
 	c.On("MkdirAll",
 		mock.MatchedBy(func(p string) bool { return clean(p) == "test/folder" }),
@@ -160,7 +161,7 @@ func TestCreateFileStream_Success(t *testing.T) {
 		done <- struct{}{}
 	}).Return(nil).Once()
 
-	w, err := oc.CreateFileStream("/test/folder", "test.txt")
+	w, err := client.CreateFileStream(context.Background(), "/test/folder", "test.txt")
 	require.NoError(t, err)
 	require.NotNil(t, w)
 
@@ -174,14 +175,14 @@ func TestCreateFileStream_Success(t *testing.T) {
 }
 
 func TestCreateFileStream_MkdirFails(t *testing.T) {
-	c := setup(t)
+	c, client := setup(t)
 
 	c.On("MkdirAll",
 		mock.MatchedBy(func(p string) bool { return clean(p) == "test/folder" }),
 		mock.Anything,
 	).Return(errors.New("mkdir failed")).Once()
 
-	w, err := oc.CreateFileStream("/test/folder", "test.txt")
+	w, err := client.CreateFileStream(context.Background(), "/test/folder", "test.txt")
 	require.Error(t, err)
 	require.Nil(t, w)
 	assert.Contains(t, err.Error(), "mkdir failed")
@@ -189,14 +190,14 @@ func TestCreateFileStream_MkdirFails(t *testing.T) {
 }
 
 func TestDownloadFileStream_Success(t *testing.T) {
-	c := setup(t)
+	c, client := setup(t)
 
 	fileID := "test-file-123"
 	exp := "files/test-file-123"
 
 	c.On("ReadStream", exp).Return(rc("test file content"), nil).Once()
 
-	r, err := oc.DownloadFileStream(fileID)
+	r, err := client.DownloadFileStream(context.Background(), fileID)
 	require.NoError(t, err)
 
 	b, err := io.ReadAll(r)
@@ -206,23 +207,23 @@ func TestDownloadFileStream_Success(t *testing.T) {
 }
 
 func TestDownloadFileStream_ReadStreamFails(t *testing.T) {
-	c := setup(t)
+	c, client := setup(t)
 
 	c.On("ReadStream", "files/nonexistent-file").Return(nil, errors.New("file not found")).Once()
 
-	r, err := oc.DownloadFileStream("nonexistent-file")
+	r, err := client.DownloadFileStream(context.Background(), "nonexistent-file")
 	require.Error(t, err)
 	require.Nil(t, r)
 	c.AssertExpectations(t)
 }
 
 func TestDownloadSentFileStream_Success(t *testing.T) {
-	c := setup(t)
+	c, client := setup(t)
 
 	p := "sent/file.txt"
 	c.On("ReadStream", p).Return(rc("sent file content"), nil).Once()
 
-	r, err := oc.DownloadSentFileStream(p)
+	r, err := client.DownloadSentFileStream(context.Background(), p)
 	require.NoError(t, err)
 
 	b, err := io.ReadAll(r)
@@ -232,39 +233,39 @@ func TestDownloadSentFileStream_Success(t *testing.T) {
 }
 
 func TestDownloadSentFileStream_ReadStreamFails(t *testing.T) {
-	c := setup(t)
+	c, client := setup(t)
 
 	c.On("ReadStream", "sent/missing.txt").Return(nil, errors.New("file not found")).Once()
 
-	r, err := oc.DownloadSentFileStream("sent/missing.txt")
+	r, err := client.DownloadSentFileStream(context.Background(), "sent/missing.txt")
 	require.Error(t, err)
 	require.Nil(t, r)
 	c.AssertExpectations(t)
 }
 
 func TestDeleteFile_Success(t *testing.T) {
-	c := setup(t)
+	c, client := setup(t)
 
 	c.On("Remove", "files/user-456/file-123").Return(nil).Once()
 
-	err := oc.DeleteFile("file-123", "user-456")
+	err := client.DeleteFile(context.Background(), "file-123", "user-456")
 	require.NoError(t, err)
 	c.AssertExpectations(t)
 }
 
 func TestDeleteFile_RemoveFails(t *testing.T) {
-	c := setup(t)
+	c, client := setup(t)
 
 	c.On("Remove", "files/user-456/file-123").Return(errors.New("delete failed")).Once()
 
-	err := oc.DeleteFile("file-123", "user-456")
+	err := client.DeleteFile(context.Background(), "file-123", "user-456")
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to delete")
 	c.AssertExpectations(t)
 }
 
 func TestDownloadFileStreamTemp_Success(t *testing.T) {
-	c := setup(t)
+	c, client := setup(t)
 
 	inputPath := "/temp/file.txt"
 	expected := "temp/file.txt"
@@ -273,7 +274,7 @@ func TestDownloadFileStreamTemp_Success(t *testing.T) {
 		mock.MatchedBy(func(p string) bool { return clean(p) == expected }),
 	).Return(rc("chunk data"), nil).Once()
 
-	r, err := oc.DownloadFileStreamTemp(inputPath)
+	r, err := client.DownloadFileStreamTemp(context.Background(), inputPath)
 	require.NoError(t, err)
 	require.NotNil(t, r)
 
@@ -284,7 +285,7 @@ func TestDownloadFileStreamTemp_Success(t *testing.T) {
 }
 
 func TestDownloadFileStreamTemp_PathCleaning(t *testing.T) {
-	c := setup(t)
+	c, client := setup(t)
 
 	inputPath := "///temp/file.txt"
 	expected := "temp/file.txt"
@@ -293,7 +294,7 @@ func TestDownloadFileStreamTemp_PathCleaning(t *testing.T) {
 		mock.MatchedBy(func(p string) bool { return clean(p) == expected }),
 	).Return(rc("chunk data"), nil).Once()
 
-	r, err := oc.DownloadFileStreamTemp(inputPath)
+	r, err := client.DownloadFileStreamTemp(context.Background(), inputPath)
 	require.NoError(t, err)
 	require.NotNil(t, r)
 
@@ -304,7 +305,7 @@ func TestDownloadFileStreamTemp_PathCleaning(t *testing.T) {
 }
 
 func TestDeleteFileTemp_Success(t *testing.T) {
-	c := setup(t)
+	c, client := setup(t)
 
 	input := "/temp/file.txt"
 	expected := "temp/file.txt"
@@ -313,13 +314,13 @@ func TestDeleteFileTemp_Success(t *testing.T) {
 		mock.MatchedBy(func(p string) bool { return clean(p) == expected }),
 	).Return(nil).Once()
 
-	err := oc.DeleteFileTemp(input)
+	err := client.DeleteFileTemp(context.Background(), input)
 	require.NoError(t, err)
 	c.AssertExpectations(t)
 }
 
 func TestDeleteFileTemp_RemoveFails(t *testing.T) {
-	c := setup(t)
+	c, client := setup(t)
 
 	input := "/temp/file.txt"
 	expected := "temp/file.txt"
@@ -328,14 +329,14 @@ func TestDeleteFileTemp_RemoveFails(t *testing.T) {
 		mock.MatchedBy(func(p string) bool { return clean(p) == expected }),
 	).Return(errors.New("delete failed")).Once()
 
-	err := oc.DeleteFileTemp(input)
+	err := client.DeleteFileTemp(context.Background(), input)
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to delete temporary file")
 	c.AssertExpectations(t)
 }
 
 func TestDeleteFileTemp_PathCleaning(t *testing.T) {
-	c := setup(t)
+	c, client := setup(t)
 
 	input := "///temp/file.txt"
 	expected := "temp/file.txt"
@@ -344,7 +345,48 @@ func TestDeleteFileTemp_PathCleaning(t *testing.T) {
 		mock.MatchedBy(func(p string) bool { return clean(p) == expected }),
 	).Return(nil).Once()
 
-	err := oc.DeleteFileTemp(input)
+	err := client.DeleteFileTemp(context.Background(), input)
 	require.NoError(t, err)
 	c.AssertExpectations(t)
 }
+
+func TestClient_LocalRoundTrip(t *testing.T) {
+	b, err := storage.NewLocal(t.TempDir())
+	require.NoError(t, err)
+	client := oc.New(b)
+
+	require.NoError(t, client.UploadFileStream(context.Background(), "temp", "f1_chunk_0", strings.NewReader("AAA")))
+
+	r, err := client.DownloadFileStreamTemp(context.Background(), "/temp/f1_chunk_0")
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, "AAA", string(data))
+
+	require.NoError(t, client.DeleteFileTemp(context.Background(), "temp/f1_chunk_0"))
+	_, err = client.DownloadFileStreamTemp(context.Background(), "temp/f1_chunk_0")
+	assert.Error(t, err)
+}
+
+func TestDownloadFileRange_LocalBackend(t *testing.T) {
+	b, err := storage.NewLocal(t.TempDir())
+	require.NoError(t, err)
+	client := oc.New(b)
+
+	require.NoError(t, client.UploadFileStream(context.Background(), "files", "f1", strings.NewReader("0123456789")))
+
+	r, err := client.DownloadFileRange(context.Background(), "f1", 4, 3)
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, "456", string(data))
+
+	r, err = client.DownloadSentFileRange(context.Background(), "/files/f1", 8, 2)
+	require.NoError(t, err)
+	data, err = io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, "89", string(data))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/api"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/fileHandler"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/janitor"
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/metadata"
+)
+
+// newV1Router registers the versioned REST API. Path parameters are handed
+// to the existing handlers through api.WithJSON / api.WithQuery, so the
+// handlers serve both these routes and the legacy unversioned ones.
+func newV1Router(files *fileHandler.Server, meta *metadata.Server, fileJanitor *janitor.Janitor) *api.Router {
+	rt := api.NewRouter(api.Version1)
+	fileID := api.Params{"id": "fileId"}
+
+	// uploads
+	rt.HandleFunc(http.MethodPost, "/uploads", files.StartUploadHandler)
+	rt.HandleFunc(http.MethodGet, "/uploads/{id}", api.WithQuery(fileID, files.UploadStatusHandler))
+	rt.HandleFunc(http.MethodPost, "/uploads/{id}/chunks", api.WithQuery(fileID, files.UploadHandler))
+
+	// files owned by the caller
+	rt.HandleFunc(http.MethodGet, "/files", api.WithJSON(nil, meta.GetUserFilesHandler))
+	rt.HandleFunc(http.MethodGet, "/files/metadata", api.WithJSON(nil, meta.ListFileMetadataHandler))
+	rt.HandleFunc(http.MethodGet, "/files/count", api.WithJSON(nil, meta.GetUserFileCountHandler))
+	rt.HandleFunc(http.MethodGet, "/files/stats", api.WithJSON(nil, meta.StorageStatsHandler))
+	rt.HandleFunc(http.MethodGet, "/files/search", api.WithJSON(nil, meta.SearchHandler))
+	rt.HandleFunc(http.MethodPost, "/files/search", api.WithJSON(nil, meta.SearchHandler))
+	rt.HandleFunc(http.MethodPut, "/files/{id}", api.WithJSON(fileID, files.UpdateFileHandler))
+	rt.HandleFunc(http.MethodDelete, "/files/{id}", api.WithJSON(fileID, files.DeleteFileHandler))
+	rt.HandleFunc(http.MethodGet, "/files/{id}/content", api.WithJSON(fileID, files.DownloadHandler))
+	rt.HandleFunc(http.MethodPost, "/files/{id}/tags", api.WithJSON(fileID, meta.AddTagsHandler))
+	rt.HandleFunc(http.MethodDelete, "/files/{id}/tags", api.WithJSON(fileID, meta.RemoveTagsFromFileHandler))
+	rt.HandleFunc(http.MethodPut, "/files/{id}/description", api.WithJSON(fileID, meta.AddDescriptionHandler))
+	rt.HandleFunc(http.MethodPut, "/files/{id}/path", api.WithJSON(fileID, meta.UpdateFilePathHandler))
+	rt.HandleFunc(http.MethodPost, "/files/{id}/move", api.WithJSON(fileID, meta.MoveHandler))
+	rt.HandleFunc(http.MethodGet, "/files/{id}/access", api.WithQuery(fileID, files.GetUsersWithFileAccessHandler))
+	rt.HandleFunc(http.MethodGet, "/files/{id}/logs", api.WithQuery(api.Params{"id": "file_id"}, files.GetAccesslogHandler))
+	rt.HandleFunc(http.MethodPost, "/files/{id}/logs", api.WithJSON(api.Params{"id": "file_id"}, files.AddAccesslogHandler))
+
+	// versions
+	fileVersion := api.Params{"id": "fileId", "version": "version"}
+	rt.HandleFunc(http.MethodGet, "/files/{id}/versions", api.WithJSON(fileID, files.ListFileVersionsHandler))
+	rt.HandleFunc(http.MethodPost, "/files/{id}/versions/prune", api.WithJSON(fileID, files.PruneFileVersionsHandler))
+	rt.HandleFunc(http.MethodGet, "/files/{id}/versions/{version}/content", api.WithJSON(fileVersion, files.DownloadFileVersionHandler))
+	rt.HandleFunc(http.MethodPost, "/files/{id}/versions/{version}/restore", api.WithJSON(fileVersion, files.RestoreFileVersionHandler))
+
+	// sharing
+	rt.HandleFunc(http.MethodPost, "/files/{id}/send", api.WithQuery(api.Params{"id": "fileid"}, files.SendFileHandler))
+	rt.HandleFunc(http.MethodPost, "/files/{id}/view-shares", api.WithQuery(api.Params{"id": "fileid"}, files.SendByViewHandler))
+	rt.HandleFunc(http.MethodDelete, "/files/{id}/view-shares", api.WithJSON(fileID, files.RevokeViewAccessHandler))
+	rt.HandleFunc(http.MethodPut, "/files/{id}/share-method", api.WithQuery(api.Params{"id": "fileid"}, files.ChangeShareMethodHandler))
+	rt.HandleFunc(http.MethodGet, "/files/{id}/view", api.WithJSON(fileID, files.DownloadViewFileHandler))
+	rt.HandleFunc(http.MethodGet, "/files/{id}/view-logs", api.WithJSON(fileID, files.GetViewFileAccessLogs))
+	rt.HandleFunc(http.MethodGet, "/view-shares", api.WithJSON(nil, files.GetSharedViewFilesHandler))
+	rt.HandleFunc(http.MethodGet, "/sent", api.WithJSON(nil, meta.GetSentFilesHandler))
+	rt.HandleFunc(http.MethodPost, "/sent", meta.AddSentFileHandler)
+	rt.HandleFunc(http.MethodGet, "/sent/content/{path...}", api.WithJSON(api.Params{"path": "filePath"}, files.DownloadSentFile))
+	rt.HandleFunc(http.MethodGet, "/received", api.WithJSON(nil, meta.GetPendingFilesHandler))
+	rt.HandleFunc(http.MethodPost, "/received", meta.AddReceivedFileHandler)
+
+	// public share links; /public/ is served without a token
+	linkToken := api.Params{"token": "token"}
+	rt.HandleFunc(http.MethodPost, "/files/{id}/links", api.WithQuery(api.Params{"id": "fileid"}, files.CreateShareLinkHandler))
+	rt.HandleFunc(http.MethodGet, "/files/{id}/links", api.WithJSON(fileID, files.ListShareLinksHandler))
+	rt.HandleFunc(http.MethodGet, "/links", api.WithJSON(nil, files.ListShareLinksHandler))
+	rt.HandleFunc(http.MethodDelete, "/links/{id}", api.WithJSON(api.Params{"id": "linkId"}, files.RevokeShareLinkHandler))
+	rt.HandleFunc(http.MethodGet, "/public/links/{token}", api.WithJSON(linkToken, files.PublicLinkInfoHandler))
+	rt.HandleFunc(http.MethodGet, "/public/links/{token}/content", api.WithJSON(linkToken, files.PublicLinkDownloadHandler))
+	rt.HandleFunc(http.MethodPost, "/public/links/{token}/content", api.WithJSON(linkToken, files.PublicLinkDownloadHandler))
+
+	// trash
+	rt.HandleFunc(http.MethodGet, "/trash", api.WithJSON(nil, files.ListTrashHandler))
+	rt.HandleFunc(http.MethodDelete, "/trash", api.WithJSON(nil, files.EmptyTrashHandler))
+	rt.HandleFunc(http.MethodPost, "/trash/{id}/restore", api.WithJSON(fileID, files.RestoreFromTrashHandler))
+
+	// folders
+	rt.HandleFunc(http.MethodPost, "/folders", files.CreateFolderHandler)
+	rt.HandleFunc(http.MethodDelete, "/folders/{id}", api.WithJSON(api.Params{"id": "folderId"}, meta.DeleteFolderHandler))
+	rt.HandleFunc(http.MethodPost, "/folders/{id}/move", api.WithJSON(fileID, meta.MoveHandler))
+
+	// notifications
+	notificationID := api.Params{"id": "id"}
+	rt.HandleFunc(http.MethodGet, "/notifications", files.NotificationHandler)
+	rt.HandleFunc(http.MethodPost, "/notifications", files.AddNotificationHandler)
+	rt.HandleFunc(http.MethodPost, "/notifications/{id}/read", api.WithJSON(notificationID, files.MarkAsReadHandler))
+	rt.HandleFunc(http.MethodPost, "/notifications/{id}/respond", api.WithJSON(notificationID, files.RespondToShareRequestHandler))
+	rt.HandleFunc(http.MethodPost, "/notifications/{id}/clear", api.WithJSON(notificationID, files.ClearNotificationHandler))
+
+	// storage quotas
+	rt.HandleFunc(http.MethodGet, "/quota", files.StorageUsageHandler)
+	rt.HandleFunc(http.MethodGet, "/quota/tiers", files.ListQuotaTiersHandler)
+
+	// users and administration
+	rt.HandleFunc(http.MethodPost, "/users", meta.AddUserHandler)
+	rt.HandleFunc(http.MethodPut, "/admin/quota/tiers/{name}", api.WithJSON(api.Params{"name": "name"}, files.SetQuotaTierHandler))
+	rt.HandleFunc(http.MethodPut, "/admin/users/{id}/quota", api.WithJSON(api.Params{"id": "userId"}, files.SetUserQuotaHandler))
+	rt.HandleFunc(http.MethodGet, "/admin/janitor", fileJanitor.StatsHandler)
+	rt.HandleFunc(http.MethodPost, "/admin/janitor", fileJanitor.StatsHandler)
+
+	return rt
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Observer is told about every call an instrumented backend makes: the
+// Backend method ("WriteStream", "ReadStream", "Remove", ...), how long it
+// took and the error it returned.
+type Observer func(op string, elapsed time.Duration, err error)
+
+// Instrument wraps b so every call is reported to observe. The wrapper is
+// always a Lister, a RangeReader and a Pinger; backends that are not fall
+// back to ErrListUnsupported, a full read and no check, as they would
+// unwrapped.
+func Instrument(b Backend, observe Observer) Backend {
+	return &instrumented{b: b, observe: observe}
+}
+
+type instrumented struct {
+	b       Backend
+	observe Observer
+}
+
+func (i *instrumented) record(op string, start time.Time, err error) {
+	i.observe(op, time.Since(start), err)
+}
+
+func (i *instrumented) MkdirAll(path string) error {
+	start := time.Now()
+	err := i.b.MkdirAll(path)
+	i.record("MkdirAll", start, err)
+	return err
+}
+
+func (i *instrumented) WriteStream(path string, src io.Reader) error {
+	start := time.Now()
+	err := i.b.WriteStream(path, src)
+	i.record("WriteStream", start, err)
+	return err
+}
+
+func (i *instrumented) ReadStream(path string) (io.ReadCloser, error) {
+	start := time.Now()
+	rc, err := i.b.ReadStream(path)
+	i.record("ReadStream", start, err)
+	return rc, err
+}
+
+func (i *instrumented) Remove(path string) error {
+	start := time.Now()
+	err := i.b.Remove(path)
+	i.record("Remove", start, err)
+	return err
+}
+
+func (i *instrumented) List(dir string) ([]ObjectInfo, error) {
+	lister, ok := i.b.(Lister)
+	if !ok {
+		return nil, ErrListUnsupported
+	}
+	start := time.Now()
+	objects, err := lister.List(dir)
+	i.record("List", start, err)
+	return objects, err
+}
+
+func (i *instrumented) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	start := time.Now()
+	rc, err := ReadRange(i.b, path, offset, length)
+	i.record("ReadRange", start, err)
+	return rc, err
+}
+
+// Ping is not reported to observe: readiness probes would otherwise swamp
+// the latency of real storage traffic.
+func (i *instrumented) Ping(ctx context.Context) error {
+	return Ping(ctx, i.b)
+}
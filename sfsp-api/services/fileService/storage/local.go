@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// LocalBackend stores blobs as plain files below a root directory. It is
+// meant for development and single-node deployments without ownCloud.
+type LocalBackend struct {
+	root string
+}
+
+// NewLocal creates the root directory if needed and returns a backend
+// rooted there.
+func NewLocal(root string) (*LocalBackend, error) {
+	if root == "" {
+		return nil, fmt.Errorf("storage: local backend requires a root directory")
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("storage: resolve local root: %w", err)
+	}
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return nil, fmt.Errorf("storage: create local root: %w", err)
+	}
+	return &LocalBackend{root: abs}, nil
+}
+
+func (b *LocalBackend) resolve(p string) (string, error) {
+	key, err := cleanKey(p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(b.root, filepath.FromSlash(key)), nil
+}
+
+func (b *LocalBackend) MkdirAll(path string) error {
+	full, err := b.resolve(path)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(full, 0755)
+}
+
+// WriteStream writes to a temporary file next to the destination and renames
+// it into place, so readers never observe a partially written blob.
+func (b *LocalBackend) WriteStream(path string, src io.Reader) error {
+	full, err := b.resolve(path)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(full)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := io.Copy(tmp, src); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), full)
+}
+
+func (b *LocalBackend) ReadStream(path string) (io.ReadCloser, error) {
+	full, err := b.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(full)
+}
+
+// ReadRange seeks to offset instead of reading the leading bytes.
+func (b *LocalBackend) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	full, err := b.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(full)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return limitReadCloser(f, length), nil
+}
+
+func (b *LocalBackend) List(dir string) ([]ObjectInfo, error) {
+	key, err := cleanKey(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(b.root, filepath.FromSlash(key)))
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]ObjectInfo, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		objects = append(objects, ObjectInfo{Path: path.Join(key, e.Name()), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	return objects, nil
+}
+
+func (b *LocalBackend) Remove(path string) error {
+	full, err := b.resolve(path)
+	if err != nil {
+		return err
+	}
+	return os.Remove(full)
+}
+
+// Ping checks that the root directory still exists.
+func (b *LocalBackend) Ping(ctx context.Context) error {
+	info, err := os.Stat(b.root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("storage: local root %s is not a directory", b.root)
+	}
+	return nil
+}
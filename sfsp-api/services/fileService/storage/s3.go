@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// defaultS3PartSize keeps memory bounded when streaming uploads of unknown
+// length; the SDK otherwise buffers parts of several hundred megabytes.
+const defaultS3PartSize = 16 << 20
+
+// S3Config configures the S3-compatible driver (AWS S3, MinIO, Ceph RGW, ...).
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	// Prefix is prepended to every key, so several deployments can share a
+	// bucket.
+	Prefix string
+	// PartSize is the multipart upload part size in bytes.
+	PartSize uint64
+}
+
+// S3Backend stores blobs as objects in a single bucket.
+type S3Backend struct {
+	client   *minio.Client
+	bucket   string
+	prefix   string
+	partSize uint64
+}
+
+// NewS3 returns a backend for the bucket described by cfg. It does not
+// contact the server; the first request will surface connection errors.
+func NewS3(cfg S3Config) (*S3Backend, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("storage: s3 backend requires an endpoint and a bucket")
+	}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: create s3 client: %w", err)
+	}
+	partSize := cfg.PartSize
+	if partSize == 0 {
+		partSize = defaultS3PartSize
+	}
+	prefix, err := cleanKey(cfg.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Backend{client: client, bucket: cfg.Bucket, prefix: prefix, partSize: partSize}, nil
+}
+
+func (b *S3Backend) key(p string) (string, error) {
+	key, err := cleanKey(p)
+	if err != nil {
+		return "", err
+	}
+	if b.prefix != "" {
+		key = b.prefix + "/" + key
+	}
+	return key, nil
+}
+
+// MkdirAll is a no-op: object stores have no directories.
+func (b *S3Backend) MkdirAll(string) error {
+	return nil
+}
+
+func (b *S3Backend) WriteStream(path string, src io.Reader) error {
+	key, err := b.key(path)
+	if err != nil {
+		return err
+	}
+	_, err = b.client.PutObject(context.Background(), b.bucket, key, src, -1, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+		PartSize:    b.partSize,
+	})
+	return err
+}
+
+func (b *S3Backend) ReadStream(path string) (io.ReadCloser, error) {
+	key, err := b.key(path)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := b.client.GetObject(context.Background(), b.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy; stat it so a missing object fails here rather than
+	// on the first read.
+	if _, err := obj.Stat(); err != nil {
+		_ = obj.Close()
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (b *S3Backend) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	key, err := b.key(path)
+	if err != nil {
+		return nil, err
+	}
+	opts := minio.GetObjectOptions{}
+	switch {
+	case length > 0:
+		err = opts.SetRange(offset, offset+length-1)
+	case offset > 0:
+		err = opts.SetRange(offset, 0) // bytes=offset-
+	}
+	if err != nil {
+		return nil, err
+	}
+	obj, err := b.client.GetObject(context.Background(), b.bucket, key, opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := obj.Stat(); err != nil {
+		_ = obj.Close()
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (b *S3Backend) Remove(path string) error {
+	key, err := b.key(path)
+	if err != nil {
+		return err
+	}
+	return b.client.RemoveObject(context.Background(), b.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (b *S3Backend) List(dir string) ([]ObjectInfo, error) {
+	key, err := b.key(dir)
+	if err != nil {
+		return nil, err
+	}
+	var objects []ObjectInfo
+	for obj := range b.client.ListObjects(context.Background(), b.bucket, minio.ListObjectsOptions{Prefix: key + "/"}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		if strings.HasSuffix(obj.Key, "/") {
+			continue
+		}
+		p := obj.Key
+		if b.prefix != "" {
+			p = strings.TrimPrefix(p, b.prefix+"/")
+		}
+		objects = append(objects, ObjectInfo{Path: p, Size: obj.Size, ModTime: obj.LastModified})
+	}
+	return objects, nil
+}
+
+// Ping checks that the bucket exists and the credentials can see it.
+func (b *S3Backend) Ping(ctx context.Context) error {
+	ok, err := b.client.BucketExists(ctx, b.bucket)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("storage: s3 bucket %q does not exist", b.bucket)
+	}
+	return nil
+}
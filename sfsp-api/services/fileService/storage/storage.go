@@ -0,0 +1,161 @@
+// Package storage defines the blob store abstraction the file service writes
+// encrypted file contents to, along with its WebDAV, local filesystem and
+// S3-compatible drivers.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// Backend is implemented by every storage driver. Paths are slash separated
+// and relative to the root of the store, e.g. "temp/<fileId>_chunk_0" or
+// "files/<userId>/sent/<fileId>".
+type Backend interface {
+	// MkdirAll makes sure the directory at path exists. Drivers without a
+	// directory concept (S3) treat it as a no-op.
+	MkdirAll(path string) error
+	// WriteStream stores everything read from src at path, replacing any
+	// existing object.
+	WriteStream(path string, src io.Reader) error
+	// ReadStream opens the object at path for reading.
+	ReadStream(path string) (io.ReadCloser, error)
+	// Remove deletes the object at path.
+	Remove(path string) error
+}
+
+// ObjectInfo describes a stored blob returned by Lister.
+type ObjectInfo struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Lister is implemented by backends that can enumerate the blobs directly
+// inside a directory. Callers type-assert for it since it is optional.
+type Lister interface {
+	List(dir string) ([]ObjectInfo, error)
+}
+
+// RangeReader is implemented by backends that can read part of a blob
+// without transferring the bytes before it. A negative length reads to the
+// end of the blob.
+type RangeReader interface {
+	ReadRange(path string, offset, length int64) (io.ReadCloser, error)
+}
+
+// Pinger is implemented by backends that can cheaply check the store is
+// reachable, for readiness probes. Ping must give up when ctx is done.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping checks that b is reachable. Backends that are not a Pinger are
+// assumed to be.
+func Ping(ctx context.Context, b Backend) error {
+	if p, ok := b.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// ReadRange reads length bytes of the blob at path starting at offset. It
+// uses the backend's RangeReader when available and otherwise falls back to
+// skipping the leading bytes of a full read.
+func ReadRange(b Backend, path string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("storage: negative range offset %d", offset)
+	}
+	if rr, ok := b.(RangeReader); ok {
+		return rr.ReadRange(path, offset, length)
+	}
+	rc, err := b.ReadStream(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, rc, offset); err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	return limitReadCloser(rc, length), nil
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// limitReadCloser caps rc at n bytes; a negative n leaves it unlimited.
+func limitReadCloser(rc io.ReadCloser, n int64) io.ReadCloser {
+	if n < 0 {
+		return rc
+	}
+	return limitedReadCloser{Reader: io.LimitReader(rc, n), Closer: rc}
+}
+
+// ErrInvalidPath is returned when a path escapes the root of the store.
+var ErrInvalidPath = errors.New("storage: invalid path")
+
+// ErrListUnsupported is returned when a backend cannot enumerate blobs.
+var ErrListUnsupported = errors.New("storage: backend does not support listing")
+
+// Kinds of backend accepted by New.
+const (
+	KindWebDAV = "webdav"
+	KindLocal  = "local"
+	KindS3     = "s3"
+)
+
+// Config selects and configures a storage driver.
+type Config struct {
+	Kind string
+
+	// WebDAV / ownCloud
+	WebDAVURL      string
+	WebDAVUsername string
+	WebDAVPassword string
+
+	// Local filesystem
+	LocalRoot string
+
+	// S3-compatible object storage
+	S3 S3Config
+}
+
+// New builds the Backend described by cfg. An empty Kind selects WebDAV so
+// existing ownCloud deployments keep working without extra configuration.
+func New(cfg Config) (Backend, error) {
+	switch strings.ToLower(cfg.Kind) {
+	case "", KindWebDAV, "owncloud":
+		if cfg.WebDAVURL == "" {
+			return nil, fmt.Errorf("storage: webdav backend requires a URL")
+		}
+		return NewWebDAV(cfg.WebDAVURL, cfg.WebDAVUsername, cfg.WebDAVPassword), nil
+	case KindLocal:
+		return NewLocal(cfg.LocalRoot)
+	case KindS3:
+		return NewS3(cfg.S3)
+	default:
+		return nil, fmt.Errorf("storage: unknown backend %q", cfg.Kind)
+	}
+}
+
+// cleanKey normalises p to a relative slash-separated key and rejects paths
+// that would climb above the root of the store.
+func cleanKey(p string) (string, error) {
+	if strings.Contains(p, "\x00") {
+		return "", ErrInvalidPath
+	}
+	for _, part := range strings.Split(p, "/") {
+		if part == ".." {
+			return "", ErrInvalidPath
+		}
+	}
+	key := strings.TrimLeft(path.Clean("/"+p), "/")
+	return key, nil
+}
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/studio-b12/gowebdav"
+)
+
+// WebDavClient is the subset of the gowebdav client the WebDAV driver uses.
+// It is an interface so tests can substitute an in-memory fake.
+type WebDavClient interface {
+	MkdirAll(path string, perm os.FileMode) error
+	Write(name string, data []byte, perm os.FileMode) error
+	WriteStream(name string, src io.Reader, perm os.FileMode) error
+	Read(name string) ([]byte, error)
+	ReadStream(name string) (io.ReadCloser, error)
+	Remove(path string) error
+}
+
+// WebDAVBackend stores blobs on a WebDAV server such as ownCloud.
+type WebDAVBackend struct {
+	client WebDavClient
+
+	// set by NewWebDAV so Ping can send its own request with a context;
+	// the gowebdav client does not take one
+	url                string
+	username, password string
+}
+
+// NewWebDAV connects a WebDAV backend to the server at url.
+func NewWebDAV(url, username, password string) *WebDAVBackend {
+	b := NewWebDAVFromClient(gowebdav.NewClient(url, username, password))
+	b.url, b.username, b.password = url, username, password
+	return b
+}
+
+// NewWebDAVFromClient wraps an existing WebDAV client.
+func NewWebDAVFromClient(c WebDavClient) *WebDAVBackend {
+	return &WebDAVBackend{client: c}
+}
+
+// Client returns the underlying WebDAV client.
+func (b *WebDAVBackend) Client() WebDavClient {
+	return b.client
+}
+
+func (b *WebDAVBackend) MkdirAll(path string) error {
+	key, err := cleanKey(path)
+	if err != nil {
+		return err
+	}
+	return b.client.MkdirAll(key, 0755)
+}
+
+func (b *WebDAVBackend) WriteStream(path string, src io.Reader) error {
+	key, err := cleanKey(path)
+	if err != nil {
+		return err
+	}
+	return b.client.WriteStream(key, src, 0644)
+}
+
+func (b *WebDAVBackend) ReadStream(path string) (io.ReadCloser, error) {
+	key, err := cleanKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return b.client.ReadStream(key)
+}
+
+func (b *WebDAVBackend) Remove(path string) error {
+	key, err := cleanKey(path)
+	if err != nil {
+		return err
+	}
+	return b.client.Remove(key)
+}
+
+// webDavDirReader is satisfied by the gowebdav client but not required of
+// every WebDavClient, so test fakes do not need to implement it.
+type webDavDirReader interface {
+	ReadDir(path string) ([]os.FileInfo, error)
+}
+
+func (b *WebDAVBackend) List(dir string) ([]ObjectInfo, error) {
+	rd, ok := b.client.(webDavDirReader)
+	if !ok {
+		return nil, ErrListUnsupported
+	}
+	key, err := cleanKey(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := rd.ReadDir(key)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]ObjectInfo, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		objects = append(objects, ObjectInfo{Path: key + "/" + e.Name(), Size: e.Size(), ModTime: e.ModTime()})
+	}
+	return objects, nil
+}
+
+// webDavRangeReader is satisfied by the gowebdav client, which sends a
+// Range request and falls back to skipping bytes if the server ignores it.
+type webDavRangeReader interface {
+	ReadStreamRange(path string, offset, length int64) (io.ReadCloser, error)
+}
+
+// ReadRange needs a positive length to issue a Range request: gowebdav
+// returns an empty body for open-ended ranges when the server ignores Range.
+func (b *WebDAVBackend) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	key, err := cleanKey(path)
+	if err != nil {
+		return nil, err
+	}
+	if rr, ok := b.client.(webDavRangeReader); ok && length > 0 {
+		return rr.ReadStreamRange(key, offset, length)
+	}
+	rc, err := b.client.ReadStream(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, rc, offset); err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	return limitReadCloser(rc, length), nil
+}
+
+// webDavStater is satisfied by the gowebdav client, whose Stat sends a
+// Depth: 0 PROPFIND.
+type webDavStater interface {
+	Stat(path string) (os.FileInfo, error)
+}
+
+// Ping sends a Depth: 0 PROPFIND for the root collection, which asks for
+// the properties of the root only and is cheap for the server to answer.
+func (b *WebDAVBackend) Ping(ctx context.Context) error {
+	if b.url == "" {
+		return b.pingClient(ctx)
+	}
+	req, err := http.NewRequestWithContext(ctx, "PROPFIND", b.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Depth", "0")
+	if b.username != "" {
+		req.SetBasicAuth(b.username, b.password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("storage: webdav PROPFIND returned %s", resp.Status)
+	}
+	return nil
+}
+
+// pingClient stats the root through a client handed to NewWebDAVFromClient.
+// The call cannot be cancelled, so Ping stops waiting for it when ctx is done.
+func (b *WebDAVBackend) pingClient(ctx context.Context) error {
+	st, ok := b.client.(webDavStater)
+	if !ok {
+		return nil
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := st.Stat("/")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,2054 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// textTime is how Memory renders Notification and AccessLog timestamps. It is
+// fixed width in UTC, so the text sorts in time order.
+const textTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// Memory is a Store that keeps everything in maps, for tests and local
+// development without a database. It applies the schema's defaults and
+// references, so handlers see the same results as with Postgres, but nothing
+// outlives the process. The zero value is not usable; call NewMemory.
+type Memory struct {
+	mu            sync.Mutex
+	files         map[string]File
+	received      map[string]ReceivedFile
+	sent          map[string]SentFile
+	views         map[string]ViewShare
+	notifications map[string]Notification
+	accessLogs    map[string]AccessLog
+	sessions      map[string]UploadSession
+	chunks        map[string]map[int]UploadChunk
+	versions      map[string]map[int]FileVersion
+	blobHashes    map[string]BlobHash
+	links         map[string]ShareLink
+	linkFailures  map[string]int
+	linkUploads   map[string]LinkUpload
+	linkChunks    map[string]map[int]int64
+	tiers         map[string]QuotaTier
+	userQuotas    map[string]QuotaTier
+	users         map[string]bool
+	preKeys       map[string]string
+	now           func() time.Time
+}
+
+var _ Store = (*Memory)(nil)
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		files:         map[string]File{},
+		received:      map[string]ReceivedFile{},
+		sent:          map[string]SentFile{},
+		views:         map[string]ViewShare{},
+		notifications: map[string]Notification{},
+		accessLogs:    map[string]AccessLog{},
+		sessions:      map[string]UploadSession{},
+		chunks:        map[string]map[int]UploadChunk{},
+		versions:      map[string]map[int]FileVersion{},
+		blobHashes:    map[string]BlobHash{},
+		links:         map[string]ShareLink{},
+		linkFailures:  map[string]int{},
+		linkUploads:   map[string]LinkUpload{},
+		linkChunks:    map[string]map[int]int64{},
+		tiers:         map[string]QuotaTier{},
+		userQuotas:    map[string]QuotaTier{},
+		users:         map[string]bool{},
+		preKeys:       map[string]string{},
+		now:           time.Now,
+	}
+}
+
+// SetClock overrides the time source used for the timestamps the store
+// sets; used by tests.
+func (m *Memory) SetClock(now func() time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = now
+}
+
+// newID returns a random (version 4) UUID, like gen_random_uuid.
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// insert adds v under id, generating the id when it is empty, and fails like
+// a primary key would if it is taken.
+func insert[T any](rows map[string]T, id string, set func(*T, string), v T) (string, error) {
+	if id == "" {
+		id = newID()
+	}
+	if _, ok := rows[id]; ok {
+		return "", fmt.Errorf("store: duplicate id %s", id)
+	}
+	set(&v, id)
+	rows[id] = v
+	return id, nil
+}
+
+// fillPage returns the rows of one page, ordered by sort key and then id as
+// the Postgres listings are. key gives a row's sort key and id.
+func fillPage[T any](rows []T, page Page, key func(T) (string, string)) []T {
+	before := func(aKey, aID, bKey, bID string) bool {
+		if aKey != bKey {
+			return aKey < bKey
+		}
+		return aID < bID
+	}
+	desc := page.Descending()
+	sort.Slice(rows, func(i, j int) bool {
+		iKey, iID := key(rows[i])
+		jKey, jID := key(rows[j])
+		if desc {
+			return before(jKey, jID, iKey, iID)
+		}
+		return before(iKey, iID, jKey, jID)
+	})
+
+	afterKey, afterID, paged := page.After()
+	out := []T{}
+	for _, row := range rows {
+		k, id := key(row)
+		if paged {
+			if desc && !before(k, id, afterKey, afterID) || !desc && !before(afterKey, afterID, k, id) {
+				continue
+			}
+		}
+		if !page.Keep(k, id) {
+			break
+		}
+		out = append(out, row)
+	}
+	return out
+}
+
+func (m *Memory) requireFile(id string) error {
+	if _, ok := m.files[id]; !ok {
+		return fmt.Errorf("store: file %s: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+func (m *Memory) File(ctx context.Context, id string) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[id]
+	if !ok {
+		return File{}, ErrNotFound
+	}
+	f.Tags = append([]string{}, f.Tags...)
+	return f, nil
+}
+
+func (m *Memory) FileOwner(ctx context.Context, id string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[id]
+	if !ok || f.DeletedAt != nil {
+		return "", ErrNotFound
+	}
+	return f.OwnerID, nil
+}
+
+func (m *Memory) AddFile(ctx context.Context, f File) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f.ParentID != "" {
+		if err := m.requireFile(f.ParentID); err != nil {
+			return "", err
+		}
+	}
+	if f.FileType == "" {
+		f.FileType = "file"
+	}
+	if f.CreatedAt.IsZero() {
+		f.CreatedAt = m.now()
+	}
+	f.Tags = append([]string{}, f.Tags...)
+	return insert(m.files, f.ID, func(f *File, id string) { f.ID = id }, f)
+}
+
+// ListFiles sorts by the fileListing sorts of the metadata package: name,
+// size or, by default, creation time.
+func (m *Memory) ListFiles(ctx context.Context, ownerID string, page Page) ([]File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rows []File
+	for _, f := range m.files {
+		if f.OwnerID == ownerID && f.DeletedAt == nil {
+			f.Tags = append([]string{}, f.Tags...)
+			rows = append(rows, f)
+		}
+	}
+	return fillPage(rows, page, func(f File) (string, string) {
+		switch page.SortName() {
+		case "name":
+			return strings.ToLower(f.FileName), f.ID
+		case "size":
+			return fmt.Sprintf("%020d", f.FileSize), f.ID
+		}
+		return f.CreatedAt.UTC().Format(textTime), f.ID
+	}), nil
+}
+
+func (m *Memory) CountFiles(ctx context.Context, ownerID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, f := range m.files {
+		if f.OwnerID == ownerID && f.FileType != "folder" && f.DeletedAt == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// updateFile applies fn to the file with the given id.
+func (m *Memory) updateFile(id string, fn func(*File)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[id]
+	if !ok {
+		return ErrNotFound
+	}
+	fn(&f)
+	m.files[id] = f
+	return nil
+}
+
+func (m *Memory) AddTags(ctx context.Context, id string, tags []string) error {
+	return m.updateFile(id, func(f *File) { f.Tags = append(append([]string{}, f.Tags...), tags...) })
+}
+
+// RemoveTags also drops duplicate tags, as the set difference in Postgres does.
+func (m *Memory) RemoveTags(ctx context.Context, id string, tags []string) error {
+	return m.updateFile(id, func(f *File) {
+		drop := map[string]bool{}
+		for _, t := range tags {
+			drop[t] = true
+		}
+		kept := []string{}
+		for _, t := range f.Tags {
+			if !drop[t] {
+				kept = append(kept, t)
+				drop[t] = true
+			}
+		}
+		f.Tags = kept
+	})
+}
+
+func (m *Memory) SetDescription(ctx context.Context, id, description string) error {
+	return m.updateFile(id, func(f *File) { f.Description = description })
+}
+
+func (m *Memory) SetFilePath(ctx context.Context, id, cid string) error {
+	return m.updateFile(id, func(f *File) { f.CID = cid })
+}
+
+func (m *Memory) SetFileContent(ctx context.Context, ownerID, id, nonce, fileHash string, fileSize int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[id]
+	if !ok || f.OwnerID != ownerID {
+		return ErrNotFound
+	}
+	f.Nonce, f.FileHash, f.FileSize, f.CorruptedAt = nonce, fileHash, fileSize, nil
+	m.files[id] = f
+	return nil
+}
+
+func (m *Memory) SetFileBlob(ctx context.Context, id, fileHash, cid string, fileSize int64) error {
+	return m.updateFile(id, func(f *File) { f.FileHash, f.FileSize, f.CID = fileHash, fileSize, cid })
+}
+
+func (m *Memory) EnableViewSharing(ctx context.Context, id string) error {
+	return m.updateFile(id, func(f *File) { f.AllowViewSharing = true })
+}
+
+// DeleteFile removes everything that references the file, as the schema's
+// cascades do, and detaches its children.
+func (m *Memory) DeleteFile(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteFile(id)
+	return nil
+}
+
+// deleteFile is DeleteFile with the lock held.
+func (m *Memory) deleteFile(id string) {
+	delete(m.files, id)
+	for fid, f := range m.files {
+		if f.ParentID == id {
+			f.ParentID = ""
+			m.files[fid] = f
+		}
+	}
+	for rid, f := range m.received {
+		if f.FileID == id {
+			delete(m.received, rid)
+		}
+	}
+	for sid, f := range m.sent {
+		if f.FileID == id {
+			delete(m.sent, sid)
+		}
+	}
+	for vid, v := range m.views {
+		if v.FileID == id {
+			delete(m.views, vid)
+		}
+	}
+	for lid, l := range m.links {
+		if l.FileID == id {
+			delete(m.links, lid)
+			delete(m.linkFailures, lid)
+		}
+	}
+	for uid, u := range m.linkUploads {
+		if u.FileID == id {
+			delete(m.linkUploads, uid)
+			delete(m.linkChunks, uid)
+		}
+	}
+	delete(m.sessions, id)
+	delete(m.chunks, id)
+	delete(m.versions, id)
+}
+
+func (m *Memory) TrashFile(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.files[id]; ok && f.DeletedAt == nil {
+		now := m.now()
+		f.DeletedAt = &now
+		m.files[id] = f
+	}
+	return nil
+}
+
+func (m *Memory) FileTrashed(ctx context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[id]
+	if !ok {
+		return false, ErrNotFound
+	}
+	return f.DeletedAt != nil, nil
+}
+
+func (m *Memory) ListTrash(ctx context.Context, ownerID string) ([]File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	files := []File{}
+	for _, f := range m.files {
+		if f.OwnerID != ownerID || f.DeletedAt == nil {
+			continue
+		}
+		if p, ok := m.files[f.ParentID]; ok && p.DeletedAt != nil && p.DeletedAt.Equal(*f.DeletedAt) {
+			continue
+		}
+		f.Tags = append([]string{}, f.Tags...)
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].DeletedAt.After(*files[j].DeletedAt) })
+	return files, nil
+}
+
+func (m *Memory) TrashedFileIDs(ctx context.Context, ownerID string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := []string{}
+	for _, f := range m.files {
+		if f.OwnerID == ownerID && f.DeletedAt != nil {
+			ids = append(ids, f.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (m *Memory) ParentTrashed(ctx context.Context, ownerID, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[id]
+	if !ok || f.OwnerID != ownerID || f.DeletedAt == nil {
+		return false, ErrNotFound
+	}
+	p, ok := m.files[f.ParentID]
+	return ok && p.DeletedAt != nil, nil
+}
+
+func (m *Memory) RestoreFile(ctx context.Context, ownerID, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	root, ok := m.files[id]
+	if !ok || root.OwnerID != ownerID || root.DeletedAt == nil {
+		return ErrNotFound
+	}
+	var restore func(id string, deletedAt time.Time)
+	restore = func(id string, deletedAt time.Time) {
+		f := m.files[id]
+		f.DeletedAt = nil
+		m.files[id] = f
+		for cid, c := range m.files {
+			if c.ParentID == id && c.DeletedAt != nil && c.DeletedAt.Equal(deletedAt) {
+				restore(cid, deletedAt)
+			}
+		}
+	}
+	restore(id, *root.DeletedAt)
+	return nil
+}
+
+func (m *Memory) ReceivedFile(ctx context.Context, id string) (ReceivedFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.received[id]
+	if !ok {
+		return ReceivedFile{}, ErrNotFound
+	}
+	return f, nil
+}
+
+func (m *Memory) ListReceivedFiles(ctx context.Context, filter ReceivedFileFilter, page Page) ([]ReceivedFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	var rows []ReceivedFile
+	for _, f := range m.received {
+		if f.RecipientID != filter.RecipientID {
+			continue
+		}
+		if filter.Pending && (f.Accepted || f.ExpiresAt != nil && !f.ExpiresAt.After(now) ||
+			m.files[f.FileID].DeletedAt != nil) {
+			continue
+		}
+		rows = append(rows, f)
+	}
+	return fillPage(rows, page, func(f ReceivedFile) (string, string) {
+		if page.SortName() == "expiresAt" {
+			if f.ExpiresAt == nil {
+				return "infinity", f.ID
+			}
+			return f.ExpiresAt.UTC().Format(textTime), f.ID
+		}
+		return f.ReceivedAt.UTC().Format(textTime), f.ID
+	}), nil
+}
+
+func (m *Memory) AddReceivedFile(ctx context.Context, f ReceivedFile) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.requireFile(f.FileID); err != nil {
+		return "", err
+	}
+	if f.ReceivedAt.IsZero() {
+		f.ReceivedAt = m.now()
+	}
+	return insert(m.received, f.ID, func(f *ReceivedFile, id string) { f.ID = id }, f)
+}
+
+// ListSentFiles orders by SentAt, the only sort sent files offer.
+func (m *Memory) ListSentFiles(ctx context.Context, senderID string, page Page) ([]SentFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rows []SentFile
+	for _, f := range m.sent {
+		if f.SenderID == senderID {
+			rows = append(rows, f)
+		}
+	}
+	return fillPage(rows, page, func(f SentFile) (string, string) {
+		return f.SentAt.UTC().Format(textTime), f.ID
+	}), nil
+}
+
+func (m *Memory) AddSentFile(ctx context.Context, f SentFile) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.requireFile(f.FileID); err != nil {
+		return "", err
+	}
+	if f.SentAt.IsZero() {
+		f.SentAt = m.now()
+	}
+	return insert(m.sent, f.ID, func(f *SentFile, id string) { f.ID = id }, f)
+}
+
+func (m *Memory) ViewShare(ctx context.Context, senderID, recipientID, fileID string) (ViewShare, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.latestViewShare(func(v ViewShare) bool {
+		return v.SenderID == senderID && v.RecipientID == recipientID && v.FileID == fileID
+	})
+}
+
+func (m *Memory) ViewShareRecipients(ctx context.Context, fileID string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seen := map[string]bool{}
+	users := []string{}
+	for _, v := range m.views {
+		if v.FileID == fileID && !seen[v.RecipientID] {
+			seen[v.RecipientID] = true
+			users = append(users, v.RecipientID)
+		}
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+func (m *Memory) AddViewShare(ctx context.Context, v ViewShare) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.requireFile(v.FileID); err != nil {
+		return "", err
+	}
+	if v.SharedAt.IsZero() {
+		v.SharedAt = m.now()
+	}
+	return insert(m.views, v.ID, func(v *ViewShare, id string) { v.ID = id }, v)
+}
+
+// latestViewShare returns the most recently shared view share that keep
+// accepts.
+func (m *Memory) latestViewShare(keep func(ViewShare) bool) (ViewShare, error) {
+	var latest ViewShare
+	found := false
+	for _, v := range m.views {
+		if keep(v) && (!found || v.SharedAt.After(latest.SharedAt)) {
+			latest, found = v, true
+		}
+	}
+	if !found {
+		return ViewShare{}, ErrNotFound
+	}
+	return latest, nil
+}
+
+func (m *Memory) ActiveViewShare(ctx context.Context, senderID, recipientID, fileID string) (ViewShare, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.latestViewShare(func(v ViewShare) bool {
+		return v.SenderID == senderID && v.RecipientID == recipientID && v.FileID == fileID && !v.Revoked
+	})
+}
+
+func (m *Memory) RecipientViewShare(ctx context.Context, recipientID, fileID string) (ViewShare, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.files[fileID]; ok && f.DeletedAt != nil {
+		return ViewShare{}, ErrNotFound
+	}
+	return m.latestViewShare(func(v ViewShare) bool { return v.RecipientID == recipientID && v.FileID == fileID })
+}
+
+func (m *Memory) ListViewShares(ctx context.Context, userID string, page Page) ([]SharedView, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	var rows []SharedView
+	for _, v := range m.views {
+		if v.RecipientID != userID && v.SenderID != userID || v.Revoked || !v.AccessGranted ||
+			v.ExpiresAt != nil && !v.ExpiresAt.After(now) {
+			continue
+		}
+		f, ok := m.files[v.FileID]
+		if !ok || f.DeletedAt != nil {
+			continue
+		}
+		rows = append(rows, SharedView{Share: v, File: File{
+			ID: f.ID, FileName: f.FileName, FileType: f.FileType, FileSize: f.FileSize, Description: f.Description,
+		}})
+	}
+	return fillPage(rows, page, func(v SharedView) (string, string) {
+		if page.SortName() == "name" {
+			return strings.ToLower(v.File.FileName), v.Share.ID
+		}
+		return v.Share.SharedAt.UTC().Format(textTime), v.Share.ID
+	}), nil
+}
+
+func (m *Memory) RenewViewShare(ctx context.Context, id, metadata string, expiresAt *time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.views[id]
+	if !ok {
+		return ErrNotFound
+	}
+	v.Metadata, v.SharedAt, v.ExpiresAt = metadata, m.now(), expiresAt
+	m.views[id] = v
+	return nil
+}
+
+func (m *Memory) RevokeViewShare(ctx context.Context, senderID, recipientID, fileID string) (ViewShare, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	revoked, err := m.latestViewShare(func(v ViewShare) bool {
+		return v.SenderID == senderID && v.RecipientID == recipientID && v.FileID == fileID && !v.Revoked
+	})
+	if err != nil {
+		return revoked, err
+	}
+	now := m.now()
+	for id, v := range m.views {
+		if v.SenderID == senderID && v.RecipientID == recipientID && v.FileID == fileID && !v.Revoked {
+			v.Revoked, v.RevokedAt, v.AccessGranted = true, &now, false
+			m.views[id] = v
+		}
+	}
+	revoked.Revoked, revoked.RevokedAt, revoked.AccessGranted = true, &now, false
+	return revoked, nil
+}
+
+func (m *Memory) SetViewShareCopy(ctx context.Context, recipientID, newFileID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, v := range m.views {
+		if v.RecipientID == recipientID && !v.Revoked && v.AccessGranted {
+			v.NewFileID = newFileID
+			m.views[id] = v
+		}
+	}
+	return nil
+}
+
+func (m *Memory) ConvertToViewShare(ctx context.Context, v ViewShare) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[v.FileID]
+	if !ok {
+		return "", fmt.Errorf("add view share: store: file %s: %w", v.FileID, ErrNotFound)
+	}
+	for id, r := range m.received {
+		if r.RecipientID == v.RecipientID && r.SenderID == v.SenderID && r.FileID == v.FileID {
+			delete(m.received, id)
+		}
+	}
+	for id, s := range m.sent {
+		if s.SenderID == v.SenderID && s.RecipientID == v.RecipientID && s.FileID == v.FileID {
+			delete(m.sent, id)
+		}
+	}
+	v.SharedAt = m.now()
+	id, err := insert(m.views, v.ID, func(v *ViewShare, id string) { v.ID = id }, v)
+	if err != nil {
+		return "", fmt.Errorf("add view share: %w", err)
+	}
+	f.AllowViewSharing = true
+	m.files[v.FileID] = f
+	return id, nil
+}
+
+func (m *Memory) LatestReceivedFile(ctx context.Context, senderID, recipientID, fileID string) (ReceivedFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var latest ReceivedFile
+	found := false
+	for _, r := range m.received {
+		if r.SenderID != senderID || r.RecipientID != recipientID || r.FileID != fileID {
+			continue
+		}
+		if !found || r.ReceivedAt.After(latest.ReceivedAt) {
+			latest, found = r, true
+		}
+	}
+	if !found {
+		return ReceivedFile{}, ErrNotFound
+	}
+	return latest, nil
+}
+
+func (m *Memory) Notification(ctx context.Context, id string) (Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.notifications[id]
+	if !ok {
+		return Notification{}, ErrNotFound
+	}
+	return n, nil
+}
+
+func (m *Memory) NotificationRecipient(ctx context.Context, id string) (string, error) {
+	n, err := m.Notification(ctx, id)
+	return n.To, err
+}
+
+// ListNotifications orders by Timestamp whatever sort the page asks for,
+// since that is the only one notifications offer.
+func (m *Memory) ListNotifications(ctx context.Context, userID string, page Page) ([]Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rows []Notification
+	for _, n := range m.notifications {
+		if n.To == userID {
+			rows = append(rows, n)
+		}
+	}
+	return fillPage(rows, page, func(n Notification) (string, string) { return n.Timestamp, n.ID }), nil
+}
+
+func (m *Memory) AddNotification(ctx context.Context, n Notification) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n.Status, n.Read = "pending", false
+	if n.Timestamp == "" {
+		n.Timestamp = m.now().UTC().Format(textTime)
+	}
+	return insert(m.notifications, n.ID, func(n *Notification, id string) { n.ID = id }, n)
+}
+
+// updateNotification applies fn to the notification with the given id.
+func (m *Memory) updateNotification(id string, fn func(*Notification)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.notifications[id]
+	if !ok {
+		return ErrNotFound
+	}
+	fn(&n)
+	m.notifications[id] = n
+	return nil
+}
+
+func (m *Memory) MarkNotificationRead(ctx context.Context, id string) error {
+	return m.updateNotification(id, func(n *Notification) { n.Read = true })
+}
+
+func (m *Memory) SetNotificationStatus(ctx context.Context, id, status string) error {
+	return m.updateNotification(id, func(n *Notification) { n.Status, n.Read = status, true })
+}
+
+func (m *Memory) DeleteNotification(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.notifications[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.notifications, id)
+	return nil
+}
+
+func (m *Memory) AddAccessLog(ctx context.Context, l AccessLog) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l.Timestamp == "" {
+		l.Timestamp = m.now().UTC().Format(textTime)
+	}
+	_, err := insert(m.accessLogs, l.ID, func(l *AccessLog, id string) { l.ID = id }, l)
+	return err
+}
+
+// ListAccessLogs orders by Timestamp, as ListNotifications does.
+func (m *Memory) ListAccessLogs(ctx context.Context, filter AccessLogFilter, page Page) ([]AccessLog, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rows []AccessLog
+	for _, l := range m.accessLogs {
+		if filter.FileID != "" && l.FileID != filter.FileID {
+			continue
+		}
+		if filter.OwnerID != "" && m.files[l.FileID].OwnerID != filter.OwnerID {
+			continue
+		}
+		rows = append(rows, l)
+	}
+	return fillPage(rows, page, func(l AccessLog) (string, string) { return l.Timestamp, l.ID }), nil
+}
+
+func (m *Memory) ListViewAccessLogs(ctx context.Context, fileID, userID string) ([]AccessLog, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	logs := []AccessLog{}
+	for _, l := range m.accessLogs {
+		if l.FileID == fileID && l.UserID == userID && l.ViewOnly {
+			logs = append(logs, l)
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool {
+		if logs[i].Timestamp != logs[j].Timestamp {
+			return logs[i].Timestamp > logs[j].Timestamp
+		}
+		return logs[i].ID > logs[j].ID
+	})
+	return logs, nil
+}
+
+func (m *Memory) AddUploadSession(ctx context.Context, u UploadSession) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.requireFile(u.FileID); err != nil {
+		return err
+	}
+	if _, ok := m.sessions[u.FileID]; ok {
+		return fmt.Errorf("store: duplicate upload session %s", u.FileID)
+	}
+	now := m.now()
+	u.Status, u.CreatedAt, u.UpdatedAt = UploadStatusUploading, now, now
+	m.sessions[u.FileID] = u
+	return nil
+}
+
+func (m *Memory) UploadSession(ctx context.Context, fileID string) (UploadSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.sessions[fileID]
+	if !ok {
+		return UploadSession{}, ErrNotFound
+	}
+	return u, nil
+}
+
+// updateSession applies fn to the session of fileID, if there is one.
+func (m *Memory) updateSession(fileID string, fn func(*UploadSession)) {
+	if u, ok := m.sessions[fileID]; ok {
+		fn(&u)
+		u.UpdatedAt = m.now()
+		m.sessions[fileID] = u
+	}
+}
+
+func (m *Memory) SetUploadTotal(ctx context.Context, fileID string, totalChunks int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if u, ok := m.sessions[fileID]; ok && u.TotalChunks == 0 {
+		m.updateSession(fileID, func(u *UploadSession) { u.TotalChunks = totalChunks })
+	}
+	return nil
+}
+
+func (m *Memory) SetUploadStatus(ctx context.Context, fileID, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.updateSession(fileID, func(u *UploadSession) { u.Status = status })
+	return nil
+}
+
+func (m *Memory) ClaimUploadAssembly(ctx context.Context, fileID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.sessions[fileID]
+	if !ok || u.Status != UploadStatusUploading || u.TotalChunks == 0 || len(m.chunks[fileID]) != u.TotalChunks {
+		return false, nil
+	}
+	m.updateSession(fileID, func(u *UploadSession) { u.Status = UploadStatusAssembling })
+	return true, nil
+}
+
+func (m *Memory) RecordUploadChunk(ctx context.Context, fileID string, c UploadChunk) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sessions[fileID]; !ok {
+		return fmt.Errorf("store: upload session %s: %w", fileID, ErrNotFound)
+	}
+	if m.chunks[fileID] == nil {
+		m.chunks[fileID] = map[int]UploadChunk{}
+	}
+	c.ReceivedAt = m.now()
+	m.chunks[fileID][c.Index] = c
+	m.updateSession(fileID, func(*UploadSession) {})
+	return nil
+}
+
+func (m *Memory) ForgetUploadChunk(ctx context.Context, fileID string, index int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.chunks[fileID], index)
+	return nil
+}
+
+func (m *Memory) ListUploadChunks(ctx context.Context, fileID string) ([]UploadChunk, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chunks := []UploadChunk{}
+	for _, c := range m.chunks[fileID] {
+		chunks = append(chunks, c)
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Index < chunks[j].Index })
+	return chunks, nil
+}
+
+func (m *Memory) ReceivedUploadBytes(ctx context.Context, fileID string, index int) (total, atIndex int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.chunks[fileID] {
+		total += c.Size
+		if c.Index == index {
+			atIndex = c.Size
+		}
+	}
+	return total, atIndex, nil
+}
+
+// AddFileVersion holds the lock while save runs, as Postgres holds the row
+// lock, so save must not call back into the store.
+func (m *Memory) AddFileVersion(ctx context.Context, fileID, createdBy string, save func(version int) (string, error)) (FileVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v := FileVersion{FileID: fileID, CreatedBy: createdBy}
+	f, ok := m.files[fileID]
+	if !ok || f.DeletedAt != nil {
+		return v, fmt.Errorf("load current file: %w", ErrNotFound)
+	}
+	v.Nonce, v.FileHash, v.FileSize = f.Nonce, f.FileHash, f.FileSize
+	for n := range m.versions[fileID] {
+		v.Version = max(v.Version, n)
+	}
+	v.Version++
+
+	var err error
+	if v.BlobPath, err = save(v.Version); err != nil {
+		return v, fmt.Errorf("save version blob: %w", err)
+	}
+	v.CreatedAt = m.now()
+	if m.versions[fileID] == nil {
+		m.versions[fileID] = map[int]FileVersion{}
+	}
+	m.versions[fileID][v.Version] = v
+	return v, nil
+}
+
+func (m *Memory) ListFileVersions(ctx context.Context, fileID string) ([]FileVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	versions := []FileVersion{}
+	for _, v := range m.versions[fileID] {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+	return versions, nil
+}
+
+func (m *Memory) FileVersion(ctx context.Context, fileID string, version int) (FileVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.versions[fileID][version]
+	if !ok {
+		return FileVersion{}, ErrNotFound
+	}
+	if b, ok := m.blobHashes[v.BlobPath]; ok {
+		v.CorruptedAt = b.CorruptedAt
+	}
+	return v, nil
+}
+
+func (m *Memory) DeleteFileVersion(ctx context.Context, fileID string, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.versions[fileID], version)
+	return nil
+}
+
+func (m *Memory) BlobHash(ctx context.Context, path string) (BlobHash, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.blobHashes[path]
+	if !ok {
+		return BlobHash{Path: path, Size: -1}, ErrNotFound
+	}
+	return b, nil
+}
+
+func (m *Memory) RecordBlobHash(ctx context.Context, b BlobHash) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b.CorruptedAt = nil
+	m.blobHashes[b.Path] = b
+	return nil
+}
+
+func (m *Memory) DeleteBlobHash(ctx context.Context, path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.blobHashes, path)
+	return nil
+}
+
+func (m *Memory) MarkBlobCorrupted(ctx context.Context, path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if b, ok := m.blobHashes[path]; ok {
+		now := m.now()
+		b.CorruptedAt = &now
+		m.blobHashes[path] = b
+	}
+	return nil
+}
+
+func (m *Memory) MarkFileCorrupted(ctx context.Context, fileID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.files[fileID]; ok {
+		now := m.now()
+		f.CorruptedAt = &now
+		m.files[fileID] = f
+	}
+	return nil
+}
+
+func (m *Memory) AddShareLink(ctx context.Context, l ShareLink) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.requireFile(l.FileID); err != nil {
+		return err
+	}
+	l.DownloadCount, l.Revoked, l.LockedUntil, l.FileTrashed = 0, false, nil, false
+	l.CreatedAt = m.now()
+	_, err := insert(m.links, l.ID, func(l *ShareLink, id string) { l.ID = id }, l)
+	return err
+}
+
+func (m *Memory) ShareLinkByToken(ctx context.Context, tokenHash string) (ShareLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, l := range m.links {
+		if l.TokenHash == tokenHash {
+			l.FileTrashed = m.files[l.FileID].DeletedAt != nil
+			return l, nil
+		}
+	}
+	return ShareLink{}, ErrNotFound
+}
+
+func (m *Memory) ListShareLinks(ctx context.Context, ownerID, fileID string) ([]ShareLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	links := []ShareLink{}
+	for _, l := range m.links {
+		if l.OwnerID == ownerID && (fileID == "" || l.FileID == fileID) {
+			links = append(links, l)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if !links[i].CreatedAt.Equal(links[j].CreatedAt) {
+			return links[i].CreatedAt.After(links[j].CreatedAt)
+		}
+		return links[i].ID < links[j].ID
+	})
+	return links, nil
+}
+
+func (m *Memory) RevokeShareLink(ctx context.Context, ownerID, id string) (ShareLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.links[id]
+	if !ok || l.OwnerID != ownerID || l.Revoked {
+		return ShareLink{}, ErrNotFound
+	}
+	l.Revoked = true
+	m.links[id] = l
+	return l, nil
+}
+
+func (m *Memory) RecordLinkPasswordFailure(ctx context.Context, id string, maxAttempts int, lockUntil time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.links[id]
+	if !ok {
+		return nil
+	}
+	if m.linkFailures[id]+1 < maxAttempts {
+		m.linkFailures[id]++
+		return nil
+	}
+	m.linkFailures[id] = 0
+	l.LockedUntil = &lockUntil
+	m.links[id] = l
+	return nil
+}
+
+func (m *Memory) ClaimLinkDownload(ctx context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.links[id]
+	if !ok || l.Revoked || l.MaxDownloads != nil && l.DownloadCount >= *l.MaxDownloads {
+		return false, nil
+	}
+	l.DownloadCount++
+	m.links[id] = l
+	m.linkFailures[id] = 0
+	return true, nil
+}
+
+func (m *Memory) AddLinkUpload(ctx context.Context, u LinkUpload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.requireFile(u.FileID); err != nil {
+		return err
+	}
+	now := m.now()
+	u.Status, u.CreatedAt, u.UpdatedAt = UploadStatusUploading, now, now
+	_, err := insert(m.linkUploads, u.ID, func(u *LinkUpload, id string) { u.ID = id }, u)
+	return err
+}
+
+func (m *Memory) LinkUpload(ctx context.Context, id string) (LinkUpload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.linkUploads[id]
+	if !ok {
+		return LinkUpload{}, ErrNotFound
+	}
+	return u, nil
+}
+
+// updateLinkUpload applies fn to the upload id, if there is one.
+func (m *Memory) updateLinkUpload(id string, fn func(*LinkUpload)) {
+	if u, ok := m.linkUploads[id]; ok {
+		fn(&u)
+		u.UpdatedAt = m.now()
+		m.linkUploads[id] = u
+	}
+}
+
+func (m *Memory) RecordLinkUploadChunk(ctx context.Context, id string, index int, size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.linkUploads[id]; !ok {
+		return fmt.Errorf("store: link upload %s: %w", id, ErrNotFound)
+	}
+	if m.linkChunks[id] == nil {
+		m.linkChunks[id] = map[int]int64{}
+	}
+	m.linkChunks[id][index] = size
+	m.updateLinkUpload(id, func(*LinkUpload) {})
+	return nil
+}
+
+func (m *Memory) ClaimLinkUploadAssembly(ctx context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.linkUploads[id]
+	if !ok || u.Status != UploadStatusUploading || len(m.linkChunks[id]) != u.TotalChunks {
+		return false, nil
+	}
+	m.updateLinkUpload(id, func(u *LinkUpload) { u.Status = UploadStatusAssembling })
+	return true, nil
+}
+
+func (m *Memory) SetLinkUploadStatus(ctx context.Context, id, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.updateLinkUpload(id, func(u *LinkUpload) { u.Status = status })
+	return nil
+}
+
+func (m *Memory) DeleteLinkUpload(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.linkUploads, id)
+	delete(m.linkChunks, id)
+	return nil
+}
+
+func (m *Memory) UserQuota(ctx context.Context, userID, defaultTier string) (QuotaTier, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q := m.userQuotas[userID]
+	if q.Name == "" {
+		q.Name = defaultTier
+	}
+	if q.LimitBytes == nil {
+		q.LimitBytes = m.tiers[q.Name].LimitBytes
+	}
+	return q, nil
+}
+
+// SetUserQuota stores an empty tier as is; UserQuota reads it as the
+// default tier.
+func (m *Memory) SetUserQuota(ctx context.Context, userID, tier string, limitBytes *int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.userQuotas[userID] = QuotaTier{Name: tier, LimitBytes: limitBytes}
+	return nil
+}
+
+func (m *Memory) QuotaTiers(ctx context.Context) ([]QuotaTier, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tiers := []QuotaTier{}
+	for _, t := range m.tiers {
+		tiers = append(tiers, t)
+	}
+	sort.Slice(tiers, func(i, j int) bool {
+		a, b := tiers[i].LimitBytes, tiers[j].LimitBytes
+		switch {
+		case a != nil && b != nil && *a != *b:
+			return *a < *b
+		case (a == nil) != (b == nil):
+			return b == nil
+		}
+		return tiers[i].Name < tiers[j].Name
+	})
+	return tiers, nil
+}
+
+func (m *Memory) QuotaTierExists(ctx context.Context, name string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.tiers[name]
+	return ok, nil
+}
+
+func (m *Memory) SetQuotaTier(ctx context.Context, t QuotaTier) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tiers[t.Name] = t
+	return nil
+}
+
+// StorageUsage ignores blobs whose size was not recorded, as SUM ignores
+// NULL.
+func (m *Memory) StorageUsage(ctx context.Context, userID string) (Usage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var u Usage
+	for _, f := range m.files {
+		if f.OwnerID != userID {
+			continue
+		}
+		u.Files += f.FileSize
+		for _, v := range m.versions[f.ID] {
+			u.Versions += v.FileSize
+		}
+	}
+	for _, b := range m.blobHashes {
+		switch {
+		case b.Size < 0:
+		case strings.HasPrefix(b.Path, "files/"+userID+"/sent/"):
+			u.Sent += b.Size
+		case strings.HasPrefix(b.Path, "files/"+userID+"/shared_view/"):
+			u.ViewShares += b.Size
+		}
+	}
+	for _, l := range m.links {
+		if b, ok := m.blobHashes[l.BlobPath]; ok && l.OwnerID == userID && !l.Revoked && b.Size >= 0 {
+			u.Links += b.Size
+		}
+	}
+	for id, s := range m.sessions {
+		if s.OwnerID != userID || s.Status == UploadStatusComplete {
+			continue
+		}
+		var received int64
+		for _, c := range m.chunks[id] {
+			received += c.Size
+		}
+		u.Uploads += max(s.FileSize, received)
+	}
+	return u, nil
+}
+
+// descendants returns the ids of everything below the folder id, in the
+// trash or not.
+func (m *Memory) descendants(id string) []string {
+	var ids []string
+	for fid, f := range m.files {
+		if f.ParentID == id && fid != id {
+			ids = append(ids, fid)
+			ids = append(ids, m.descendants(fid)...)
+		}
+	}
+	return ids
+}
+
+// nameTaken reports whether a live item other than exceptID is called name
+// in the folder parentID of ownerID.
+func (m *Memory) nameTaken(ownerID, parentID, name, exceptID string) bool {
+	for _, f := range m.files {
+		if f.OwnerID == ownerID && f.ParentID == parentID && f.FileName == name && f.DeletedAt == nil && f.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+// FolderByPath picks the lowest id when several live folders share a cid.
+func (m *Memory) FolderByPath(ctx context.Context, ownerID, cid string) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var folder File
+	for _, f := range m.files {
+		if f.OwnerID == ownerID && f.FileType == "folder" && f.CID == cid && f.DeletedAt == nil &&
+			(folder.ID == "" || f.ID < folder.ID) {
+			folder = f
+		}
+	}
+	if folder.ID == "" {
+		return File{}, ErrNotFound
+	}
+	folder.Tags = append([]string{}, folder.Tags...)
+	return folder, nil
+}
+
+func (m *Memory) AddFolder(ctx context.Context, f File) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f.ParentID != "" {
+		if err := m.requireFile(f.ParentID); err != nil {
+			return "", err
+		}
+	}
+	if m.nameTaken(f.OwnerID, f.ParentID, f.FileName, "") {
+		return "", ErrNameTaken
+	}
+	f.FileType, f.FileSize, f.Nonce, f.CreatedAt = "folder", 0, "", m.now()
+	f.Tags = append([]string{}, f.Tags...)
+	return insert(m.files, "", func(f *File, id string) { f.ID = id }, f)
+}
+
+func (m *Memory) LinkParentFolder(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[id]
+	if !ok {
+		return nil
+	}
+	f.ParentID = ""
+	for _, p := range m.files {
+		if p.OwnerID == f.OwnerID && p.FileType == "folder" && p.DeletedAt == nil && p.ID != f.ID &&
+			(f.CID == "files/"+p.CID+"/"+f.ID || f.CID == p.CID+"/"+f.FileName) {
+			f.ParentID = p.ID
+			break
+		}
+	}
+	m.files[id] = f
+	return nil
+}
+
+func (m *Memory) TrashFolder(ctx context.Context, id string, recursive bool, tags []string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	folder, ok := m.files[id]
+	if !ok || folder.DeletedAt != nil {
+		return 0, ErrNotFound
+	}
+	if folder.FileType != "folder" {
+		return 0, ErrNotFolder
+	}
+	if !recursive {
+		for _, f := range m.files {
+			if f.ParentID == id && f.DeletedAt == nil {
+				return 0, ErrFolderNotEmpty
+			}
+		}
+	}
+
+	now := m.now()
+	var trashed int64
+	for _, fid := range append([]string{id}, m.descendants(id)...) {
+		f := m.files[fid]
+		if f.DeletedAt != nil {
+			continue
+		}
+		f.Tags = append(append([]string{}, f.Tags...), tags...)
+		f.DeletedAt = &now
+		m.files[fid] = f
+		trashed++
+	}
+	return trashed, nil
+}
+
+func (m *Memory) MoveItem(ctx context.Context, mv Move) (Moved, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var moved Moved
+	item, ok := m.files[mv.ID]
+	if !ok || item.DeletedAt != nil {
+		return moved, ErrNotFound
+	}
+	isFolder := item.FileType == "folder"
+
+	target := item.ParentID
+	if mv.ParentID != nil {
+		target = *mv.ParentID
+	}
+	var parentCID string
+	if target != "" {
+		if target == mv.ID {
+			return moved, ErrFolderCycle
+		}
+		parent, ok := m.files[target]
+		if !ok || parent.DeletedAt != nil || parent.OwnerID != item.OwnerID {
+			return moved, ErrFolderNotFound
+		}
+		if parent.FileType != "folder" {
+			return moved, ErrNotFolder
+		}
+		parentCID = parent.CID
+		if isFolder {
+			for a, ok := parent, true; ok; a, ok = m.files[a.ParentID] {
+				if a.ID == mv.ID {
+					return moved, ErrFolderCycle
+				}
+			}
+		}
+	}
+
+	moved.Name = item.FileName
+	if mv.Name != "" {
+		moved.Name = mv.Name
+	}
+	if m.nameTaken(item.OwnerID, target, moved.Name, mv.ID) {
+		return moved, ErrNameTaken
+	}
+
+	moved.ParentID = target
+	moved.CID = fileCID(parentCID, mv.ID)
+	if isFolder {
+		moved.CID = folderCID(parentCID, moved.Name)
+	}
+	oldCID := item.CID
+	item.ParentID, item.FileName, item.CID = target, moved.Name, moved.CID
+	m.files[mv.ID] = item
+
+	if isFolder && moved.CID != oldCID {
+		for _, fid := range m.descendants(mv.ID) {
+			f := m.files[fid]
+			switch {
+			case strings.HasPrefix(f.CID, oldCID+"/"):
+				f.CID = moved.CID + strings.TrimPrefix(f.CID, oldCID)
+			case strings.HasPrefix(f.CID, "files/"+oldCID+"/"):
+				f.CID = "files/" + moved.CID + strings.TrimPrefix(f.CID, "files/"+oldCID)
+			}
+			m.files[fid] = f
+			moved.Descendants++
+		}
+	}
+	return moved, nil
+}
+
+// shared reports whether the file has a live share of the given kind, as
+// FileQuery.Shared means it.
+func (m *Memory) shared(fileID, kind string, now time.Time) bool {
+	switch kind {
+	case "sent":
+		for _, r := range m.received {
+			if r.FileID == fileID && r.ExpiredAt == nil && (r.ExpiresAt == nil || r.ExpiresAt.After(now)) {
+				return true
+			}
+		}
+	case "view":
+		for _, v := range m.views {
+			if v.FileID == fileID && !v.Revoked && v.ExpiredAt == nil {
+				return true
+			}
+		}
+	case "link":
+		for _, l := range m.links {
+			if l.FileID == fileID && !l.Revoked {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// searchWeights rank a word found in the name, description and tags the way
+// the search_vector weights A, B and C do in ts_rank_cd.
+var searchWeights = []float64{1, 0.4, 0.2}
+
+// matchWords reports whether every word starts a word of the file, and
+// ranks the file by where the words were found.
+func matchWords(f File, words []string) (float64, bool) {
+	fields := [][]string{SearchWords(f.FileName), SearchWords(f.Description), SearchWords(strings.Join(f.Tags, " "))}
+	var rank float64
+	for _, w := range words {
+		best := 0.0
+		for i, field := range fields {
+			for _, token := range field {
+				if strings.HasPrefix(token, w) {
+					best = max(best, searchWeights[i])
+				}
+			}
+		}
+		if best == 0 {
+			return 0, false
+		}
+		rank += best
+	}
+	return rank, true
+}
+
+// highlight marks the words of text that start with one of words, as
+// ts_headline would.
+func highlight(text string, words []string) string {
+	var b strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+			j++
+		}
+		token := string(runes[i:j])
+		marked := false
+		for _, w := range words {
+			if strings.HasPrefix(strings.ToLower(token), w) {
+				marked = true
+				break
+			}
+		}
+		if marked {
+			b.WriteString(HighlightStart + token + HighlightStop)
+		} else {
+			b.WriteString(token)
+		}
+		i = j
+	}
+	return b.String()
+}
+
+// SearchFiles splits names, descriptions and tags into words at anything
+// but letters and digits, where Postgres keeps "report.pdf" whole. Ranks
+// and highlights approximate ts_rank_cd and ts_headline; highlights cover
+// the whole description.
+func (m *Memory) SearchFiles(ctx context.Context, q FileQuery) (FileMatches, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := FileMatches{Matches: []FileMatch{}, FileTypes: map[string]int{}, Tags: map[string]int{}}
+	now := m.now()
+
+	shared := func(string) bool { return true }
+	switch q.Shared {
+	case "":
+	case "shared", "private":
+		want := q.Shared == "shared"
+		shared = func(id string) bool {
+			return (m.shared(id, "sent", now) || m.shared(id, "view", now) || m.shared(id, "link", now)) == want
+		}
+	case "sent", "view", "link":
+		shared = func(id string) bool { return m.shared(id, q.Shared, now) }
+	default:
+		return result, fmt.Errorf("store: unknown share state %q", q.Shared)
+	}
+
+	folderID, inFolder := q.FolderID, q.FolderID != "" || q.FolderPath != ""
+	if q.FolderID == "" && q.FolderPath != "" {
+		for _, f := range m.files {
+			if f.OwnerID == q.OwnerID && f.FileType == "folder" && f.DeletedAt == nil && f.CID == q.FolderPath {
+				folderID = f.ID
+				break
+			}
+		}
+	}
+	var below map[string]bool
+	if inFolder && q.Recursive {
+		below = map[string]bool{}
+		if folderID != "" {
+			for _, id := range m.descendants(folderID) {
+				below[id] = true
+			}
+		}
+	}
+
+	var matches []FileMatch
+	for _, f := range m.files {
+		if f.OwnerID != q.OwnerID || f.DeletedAt != nil {
+			continue
+		}
+		if len(q.FileTypes) > 0 && !contains(q.FileTypes, f.FileType) ||
+			q.MinSize != nil && f.FileSize < *q.MinSize || q.MaxSize != nil && f.FileSize > *q.MaxSize ||
+			q.CreatedAfter != nil && f.CreatedAt.Before(*q.CreatedAfter) ||
+			q.CreatedBefore != nil && !f.CreatedAt.Before(*q.CreatedBefore) {
+			continue
+		}
+		if below != nil && !below[f.ID] || below == nil && inFolder && (folderID == "" || f.ParentID != folderID) {
+			continue
+		}
+		if !shared(f.ID) {
+			continue
+		}
+		match := FileMatch{File: f}
+		if len(q.Words) > 0 {
+			rank, ok := matchWords(f, q.Words)
+			if !ok {
+				continue
+			}
+			match.Rank = rank
+			match.NameHighlight = highlight(f.FileName, q.Words)
+			match.DescriptionHighlight = highlight(f.Description, q.Words)
+		}
+		match.File.Tags = append([]string{}, f.Tags...)
+		matches = append(matches, match)
+	}
+
+	var less func(a, b FileMatch) (bool, bool)
+	switch q.Sort {
+	case "relevance":
+		less = func(a, b FileMatch) (bool, bool) {
+			if a.Rank != b.Rank {
+				return a.Rank > b.Rank, true
+			}
+			return a.File.CreatedAt.After(b.File.CreatedAt), !a.File.CreatedAt.Equal(b.File.CreatedAt)
+		}
+	case "newest":
+		less = func(a, b FileMatch) (bool, bool) {
+			return a.File.CreatedAt.After(b.File.CreatedAt), !a.File.CreatedAt.Equal(b.File.CreatedAt)
+		}
+	case "oldest":
+		less = func(a, b FileMatch) (bool, bool) {
+			return a.File.CreatedAt.Before(b.File.CreatedAt), !a.File.CreatedAt.Equal(b.File.CreatedAt)
+		}
+	case "name":
+		less = func(a, b FileMatch) (bool, bool) {
+			x, y := strings.ToLower(a.File.FileName), strings.ToLower(b.File.FileName)
+			return x < y, x != y
+		}
+	case "size":
+		less = func(a, b FileMatch) (bool, bool) {
+			return a.File.FileSize > b.File.FileSize, a.File.FileSize != b.File.FileSize
+		}
+	default:
+		return result, fmt.Errorf("store: unknown sort %q", q.Sort)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if before, differ := less(matches[i], matches[j]); differ {
+			return before
+		}
+		return matches[i].File.ID < matches[j].File.ID
+	})
+
+	result.Total = len(matches)
+	for _, match := range matches {
+		result.FileTypes[match.File.FileType]++
+		for _, t := range match.File.Tags {
+			result.Tags[t]++
+		}
+	}
+	if len(result.Tags) > searchFacetLimit {
+		tags := make([]string, 0, len(result.Tags))
+		for t := range result.Tags {
+			tags = append(tags, t)
+		}
+		sort.Slice(tags, func(i, j int) bool {
+			if result.Tags[tags[i]] != result.Tags[tags[j]] {
+				return result.Tags[tags[i]] > result.Tags[tags[j]]
+			}
+			return tags[i] < tags[j]
+		})
+		for _, t := range tags[searchFacetLimit:] {
+			delete(result.Tags, t)
+		}
+	}
+
+	start := min(max(q.Offset, 0), len(matches))
+	end := min(start+max(q.Limit, 0), len(matches))
+	result.Matches = append(result.Matches, matches[start:end]...)
+	return result, nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// blobKind is the StorageTotal kind a blob counts as, or "" for none.
+func blobKind(path string) string {
+	parts := strings.SplitN(path, "/", 4)
+	switch {
+	case strings.HasPrefix(path, "versions/"):
+		return StatsKindVersion
+	case strings.HasPrefix(path, "links/"):
+		return StatsKindLink
+	case len(parts) >= 3 && parts[0] == "files" && parts[2] == "sent":
+		return StatsKindSent
+	case len(parts) >= 3 && parts[0] == "files" && parts[2] == "shared_view":
+		return StatsKindView
+	}
+	return ""
+}
+
+// StorageTotals counts blobs for the owner of their file, as the
+// blob_hashes trigger does.
+func (m *Memory) StorageTotals(ctx context.Context, ownerID string) ([]StorageTotal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	totals := map[[2]string]*StorageTotal{}
+	add := func(kind, key string, bytes int64) {
+		t := totals[[2]string{kind, key}]
+		if t == nil {
+			t = &StorageTotal{Kind: kind, Key: key}
+			totals[[2]string{kind, key}] = t
+		}
+		t.Bytes += bytes
+		t.Items++
+	}
+	for _, f := range m.files {
+		if f.OwnerID != ownerID || f.FileType == "folder" {
+			continue
+		}
+		if f.DeletedAt != nil {
+			add(StatsKindTrash, "", f.FileSize)
+			continue
+		}
+		add(StatsKindType, f.FileType, f.FileSize)
+		add(StatsKindFolder, f.ParentID, f.FileSize)
+	}
+	for _, b := range m.blobHashes {
+		kind := blobKind(b.Path)
+		if f, ok := m.files[b.FileID]; !ok || f.OwnerID != ownerID || kind == "" {
+			continue
+		}
+		add(kind, "", max(b.Size, 0))
+	}
+
+	out := []StorageTotal{}
+	for _, t := range totals {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.Key < b.Key
+	})
+	return out, nil
+}
+
+func (m *Memory) FolderTotals(ctx context.Context, ownerID string) ([]FolderTotal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// only the owner's files count, but the walk goes through every folder,
+	// as the storage_stats rows are per owner
+	var walk func(id string, t *FolderTotal)
+	walk = func(id string, t *FolderTotal) {
+		for _, f := range m.files {
+			switch {
+			case f.ParentID != id || f.DeletedAt != nil:
+			case f.FileType == "folder":
+				walk(f.ID, t)
+			case f.OwnerID == ownerID:
+				t.Bytes += f.FileSize
+				t.Items++
+			}
+		}
+	}
+	totals := []FolderTotal{}
+	for _, f := range m.files {
+		if f.OwnerID != ownerID || f.FileType != "folder" || f.DeletedAt != nil {
+			continue
+		}
+		t := FolderTotal{Folder: f}
+		t.Folder.Tags = append([]string{}, f.Tags...)
+		walk(f.ID, &t)
+		totals = append(totals, t)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].Bytes != totals[j].Bytes {
+			return totals[i].Bytes > totals[j].Bytes
+		}
+		return totals[i].Folder.ID < totals[j].Folder.ID
+	})
+	return totals, nil
+}
+
+func (m *Memory) ShareCounts(ctx context.Context, userID string) (ShareCounts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	var c ShareCounts
+	for _, r := range m.received {
+		live := r.ExpiresAt == nil || r.ExpiresAt.After(now)
+		if r.SenderID == userID && r.ExpiredAt == nil && live {
+			c.Sent++
+		}
+		if r.RecipientID == userID && !r.Accepted && live {
+			c.PendingReceived++
+		}
+	}
+	for _, v := range m.views {
+		if v.SenderID == userID && !v.Revoked && v.ExpiredAt == nil {
+			c.View++
+		}
+	}
+	for _, l := range m.links {
+		if l.OwnerID == userID && !l.Revoked {
+			c.Links++
+		}
+	}
+	return c, nil
+}
+
+func (m *Memory) LargestFiles(ctx context.Context, ownerID string, n int) ([]File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	files := []File{}
+	for _, f := range m.files {
+		if f.OwnerID == ownerID && f.FileType != "folder" && f.DeletedAt == nil {
+			f.Tags = append([]string{}, f.Tags...)
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].FileSize != files[j].FileSize {
+			return files[i].FileSize > files[j].FileSize
+		}
+		return files[i].ID < files[j].ID
+	})
+	return files[:min(max(n, 0), len(files))], nil
+}
+
+func (m *Memory) StaleUploadSessions(ctx context.Context, cutoff time.Time) ([]UploadSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sessions := []UploadSession{}
+	for _, u := range m.sessions {
+		if u.Status != UploadStatusComplete && u.UpdatedAt.Before(cutoff) {
+			sessions = append(sessions, u)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].FileID < sessions[j].FileID })
+	return sessions, nil
+}
+
+func (m *Memory) LiveUploadSessions(ctx context.Context, cutoff time.Time) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := []string{}
+	for _, u := range m.sessions {
+		if u.Status != UploadStatusComplete && !u.UpdatedAt.Before(cutoff) {
+			ids = append(ids, u.FileID)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// incomplete reports whether f was never given any content.
+func incomplete(f File) bool {
+	return f.FileSize == 0 && f.FileHash == ""
+}
+
+func (m *Memory) DeleteUploadSession(ctx context.Context, fileID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.chunks, fileID)
+	delete(m.sessions, fileID)
+	if f, ok := m.files[fileID]; ok && incomplete(f) {
+		m.deleteFile(fileID)
+		return true, nil
+	}
+	return false, nil
+}
+
+func (m *Memory) DeleteStaleLinkUploads(ctx context.Context, cutoff time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for id, u := range m.linkUploads {
+		if u.UpdatedAt.Before(cutoff) {
+			delete(m.linkUploads, id)
+			delete(m.linkChunks, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) LinkUploadIDs(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := []string{}
+	for id := range m.linkUploads {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (m *Memory) OrphanedUploads(ctx context.Context, cutoff time.Time) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := []string{}
+	for id, f := range m.files {
+		if _, uploading := m.sessions[id]; incomplete(f) && f.FileType != "folder" && f.CreatedAt.Before(cutoff) && !uploading {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (m *Memory) DeleteIncompleteFile(ctx context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.files[id]; ok && incomplete(f) {
+		m.deleteFile(id)
+		return true, nil
+	}
+	return false, nil
+}
+
+func (m *Memory) TrashedBefore(ctx context.Context, cutoff time.Time) ([]File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	files := []File{}
+	for _, f := range m.files {
+		if f.DeletedAt != nil && f.DeletedAt.Before(cutoff) {
+			f.Tags = append([]string{}, f.Tags...)
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ID < files[j].ID })
+	return files, nil
+}
+
+func (m *Memory) PurgeTrashedFile(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.files[id]; ok && f.DeletedAt != nil {
+		m.deleteFile(id)
+	}
+	return nil
+}
+
+func (m *Memory) ExpiredShares(ctx context.Context, now time.Time) ([]ExpiredShare, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	shares := []ExpiredShare{}
+	for _, r := range m.received {
+		if r.ExpiresAt != nil && r.ExpiresAt.Before(now) && r.ExpiredAt == nil {
+			shares = append(shares, ExpiredShare{ID: r.ID, SenderID: r.SenderID, RecipientID: r.RecipientID,
+				FileID: r.FileID, FileName: m.files[r.FileID].FileName})
+		}
+	}
+	for _, v := range m.views {
+		if v.ExpiresAt != nil && v.ExpiresAt.Before(now) && v.ExpiredAt == nil && !v.Revoked {
+			shares = append(shares, ExpiredShare{ID: v.ID, SenderID: v.SenderID, RecipientID: v.RecipientID,
+				FileID: v.FileID, FileName: m.files[v.FileID].FileName, View: true})
+		}
+	}
+	sort.Slice(shares, func(i, j int) bool { return shares[i].ID < shares[j].ID })
+	return shares, nil
+}
+
+func (m *Memory) SentCopyInUse(ctx context.Context, senderID, fileID, exceptID string, now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.received {
+		if r.SenderID == senderID && r.FileID == fileID && r.ID != exceptID &&
+			r.ExpiredAt == nil && (r.ExpiresAt == nil || !r.ExpiresAt.Before(now)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *Memory) ExpireShare(ctx context.Context, s ExpiredShare, blobPath string, now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s.View {
+		v, ok := m.views[s.ID]
+		if !ok || v.ExpiredAt != nil {
+			return false, nil
+		}
+		v.ExpiredAt, v.AccessGranted = &now, false
+		m.views[s.ID] = v
+	} else {
+		r, ok := m.received[s.ID]
+		if !ok || r.ExpiredAt != nil {
+			return false, nil
+		}
+		r.ExpiredAt = &now
+		m.received[s.ID] = r
+	}
+	if blobPath != "" {
+		delete(m.blobHashes, blobPath)
+	}
+	for _, n := range shareExpiryNotices(s) {
+		n.Status, n.Timestamp = "pending", m.now().UTC().Format(textTime)
+		if _, err := insert(m.notifications, "", func(n *Notification, id string) { n.ID = id }, n); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (m *Memory) UsedUpShareLinks(ctx context.Context, now time.Time) ([]ShareLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	links := []ShareLink{}
+	for _, l := range m.links {
+		if !l.Revoked && (l.ExpiresAt != nil && l.ExpiresAt.Before(now) ||
+			l.MaxDownloads != nil && l.DownloadCount >= *l.MaxDownloads) {
+			links = append(links, l)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].ID < links[j].ID })
+	return links, nil
+}
+
+func (m *Memory) ExpireShareLink(ctx context.Context, l ShareLink, now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	link, ok := m.links[l.ID]
+	if !ok || link.Revoked {
+		return false, nil
+	}
+	link.Revoked = true
+	m.links[l.ID] = link
+	delete(m.blobHashes, l.BlobPath)
+	return true, nil
+}
+
+func (m *Memory) UserExists(ctx context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.users[id], nil
+}
+
+func (m *Memory) AddUser(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.users[id] = true
+	return nil
+}
+
+func (m *Memory) AddOneTimePreKey(ctx context.Context, userID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.users[userID] {
+		return "", fmt.Errorf("store: user %s: %w", userID, ErrNotFound)
+	}
+	id := newID()
+	m.preKeys[id] = userID
+	return id, nil
+}
+
+func (m *Memory) OneTimePreKeyOwner(ctx context.Context, keyID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	userID, ok := m.preKeys[keyID]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return userID, nil
+}
@@ -0,0 +1,368 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// File is a row of the files table. Optional references are "" when unset.
+type File struct {
+	ID               string
+	OwnerID          string
+	FileName         string
+	FileType         string
+	FileHash         string
+	Nonce            string
+	Description      string
+	Tags             []string
+	CID              string
+	FileSize         int64
+	AllowViewSharing bool
+	ParentID         string
+	CreatedAt        time.Time
+	// CorruptedAt is set once a download found the stored blob damaged.
+	CorruptedAt *time.Time
+	// DeletedAt is set while the file is in the trash.
+	DeletedAt *time.Time
+}
+
+// ReceivedFile is a copy of a file sent to another user, as stored in
+// received_files. Metadata is the sender's encrypted key material.
+type ReceivedFile struct {
+	ID          string
+	RecipientID string
+	SenderID    string
+	FileID      string
+	Metadata    string
+	Accepted    bool
+	ReceivedAt  time.Time
+	ExpiresAt   *time.Time
+	ExpiredAt   *time.Time
+}
+
+// SentFile is the sender's record of a file sent to another user.
+type SentFile struct {
+	ID                  string
+	SenderID            string
+	RecipientID         string
+	FileID              string
+	EncryptedFileKey    string
+	X3DHEphemeralPubKey string
+	SentAt              time.Time
+}
+
+// ViewShare is a view-only share from shared_files_view. NewFileID is the
+// recipient's re-encrypted copy, "" until it has been made.
+type ViewShare struct {
+	ID            string
+	SenderID      string
+	RecipientID   string
+	FileID        string
+	NewFileID     string
+	Metadata      string
+	SharedAt      time.Time
+	ExpiresAt     *time.Time
+	ExpiredAt     *time.Time
+	Revoked       bool
+	RevokedAt     *time.Time
+	AccessGranted bool
+}
+
+// SharedView is a view-only share listed with the file it shares.
+type SharedView struct {
+	Share ViewShare
+	File  File
+}
+
+// Notification is a message to a user, usually about a file shared with
+// them. ReceivedFileID links it to the copy it offers, "" for view-only
+// shares. Timestamp is kept as text, the form clients have always received.
+type Notification struct {
+	ID             string
+	Type           string
+	From           string
+	To             string
+	FileName       string
+	FileID         string
+	ReceivedFileID string
+	Message        string
+	Timestamp      string
+	Status         string
+	Read           bool
+}
+
+// AccessLog is one entry of a file's access history. Timestamp is text, as
+// for Notification.
+type AccessLog struct {
+	ID        string
+	FileID    string
+	UserID    string
+	Action    string
+	Message   string
+	ViewOnly  bool
+	Timestamp string
+}
+
+// Upload session states. A session starts uploading, is assembling while
+// one request merges its chunks, and ends complete.
+const (
+	UploadStatusUploading  = "uploading"
+	UploadStatusAssembling = "assembling"
+	UploadStatusComplete   = "complete"
+)
+
+// UploadSession is a chunked upload, as stored in upload_sessions.
+type UploadSession struct {
+	FileID      string
+	OwnerID     string
+	TotalChunks int
+	ChunkSize   int64
+	FileSize    int64
+	Status      string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// UploadChunk is a chunk received for an upload session.
+type UploadChunk struct {
+	Index      int
+	Size       int64
+	Hash       string
+	ReceivedAt time.Time
+}
+
+// FileVersion is an earlier state of a file from file_versions. CorruptedAt
+// is that of its blob, set by FileVersion only.
+type FileVersion struct {
+	FileID      string
+	Version     int
+	Nonce       string
+	FileHash    string
+	FileSize    int64
+	BlobPath    string
+	CreatedBy   string
+	CreatedAt   time.Time
+	CorruptedAt *time.Time
+}
+
+// BlobHash is the SHA-256 and size recorded for a blob stored outside the
+// files table. FileID is "" and Size -1 when they were not recorded.
+type BlobHash struct {
+	Path        string
+	FileID      string
+	SHA256      string
+	Size        int64
+	CorruptedAt *time.Time
+}
+
+// ShareLink is a public link to a copy of a file. The token itself is never
+// stored, only its hash; PasswordHash is "" for links without a password.
+type ShareLink struct {
+	ID            string
+	TokenHash     string
+	FileID        string
+	OwnerID       string
+	BlobPath      string
+	Metadata      string
+	PasswordHash  string
+	ExpiresAt     *time.Time
+	MaxDownloads  *int
+	DownloadCount int
+	LockedUntil   *time.Time
+	Revoked       bool
+	CreatedAt     time.Time
+	// FileTrashed is set by ShareLinkByToken while the file is in the trash.
+	FileTrashed bool
+}
+
+// LinkUpload is a chunked upload of a share link copy, as stored in
+// link_uploads. Its ID becomes the ID of the link. It is uploading or
+// assembling, like an UploadSession, and deleted once the link exists.
+type LinkUpload struct {
+	ID          string
+	FileID      string
+	OwnerID     string
+	TotalChunks int
+	Status      string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// QuotaTier is a named storage limit. A nil LimitBytes is unlimited.
+type QuotaTier struct {
+	Name       string
+	LimitBytes *int64
+}
+
+// Usage breaks down the bytes stored for a user.
+type Usage struct {
+	Files      int64
+	Versions   int64
+	Sent       int64
+	ViewShares int64
+	Links      int64
+	Uploads    int64
+}
+
+// Move moves and/or renames an item. A nil ParentID keeps the current
+// folder and "" moves to the root; an empty Name keeps the current name.
+type Move struct {
+	ID       string
+	ParentID *string
+	Name     string
+}
+
+// Moved is where MoveItem put an item. Descendants counts the items below a
+// folder whose cid was rewritten.
+type Moved struct {
+	ParentID    string
+	Name        string
+	CID         string
+	Descendants int64
+}
+
+// FileQuery filters and orders SearchFiles. Empty fields match everything.
+type FileQuery struct {
+	OwnerID string
+	// Words must each match the start of a word in the name, description or
+	// tags of the file.
+	Words     []string
+	FileTypes []string
+	MinSize   *int64
+	MaxSize   *int64
+	// CreatedAfter is inclusive, CreatedBefore exclusive.
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// FolderID or FolderPath (a folder's cid) keeps the files in that
+	// folder, and with Recursive those below it too.
+	FolderID   string
+	FolderPath string
+	Recursive  bool
+	// Shared is "shared", "private", "sent", "view" or "link".
+	Shared string
+	// Sort is "relevance", "newest", "oldest", "name" or "size".
+	Sort   string
+	Limit  int
+	Offset int
+}
+
+// Highlights in FileMatch start with HighlightStart and end with
+// HighlightStop.
+const (
+	HighlightStart = "[[mark]]"
+	HighlightStop  = "[[/mark]]"
+)
+
+// FileMatch is a file SearchFiles found. Without Words, Rank is 0 and the
+// highlights are "".
+type FileMatch struct {
+	File                 File
+	Rank                 float64
+	NameHighlight        string
+	DescriptionHighlight string
+}
+
+// FileMatches is a page of FileMatch. Total and the counts by file type and
+// by tag (the most used ones only) cover every match.
+type FileMatches struct {
+	Total     int
+	Matches   []FileMatch
+	FileTypes map[string]int
+	Tags      map[string]int
+}
+
+// The kinds of StorageTotal. Live files are counted by type and by the
+// folder holding them, keyed by file type and folder id ("" for the root);
+// the other kinds have the key "".
+const (
+	StatsKindType    = "type"
+	StatsKindFolder  = "folder"
+	StatsKindTrash   = "trash"
+	StatsKindVersion = "version"
+	StatsKindSent    = "sent"
+	StatsKindView    = "view"
+	StatsKindLink    = "link"
+)
+
+// StorageTotal is the size and number of a user's files of one kind.
+type StorageTotal struct {
+	Kind  string
+	Key   string
+	Bytes int64
+	Items int64
+}
+
+// FolderTotal is a folder with the size and number of the files in it and
+// below it.
+type FolderTotal struct {
+	Folder File
+	Bytes  int64
+	Items  int64
+}
+
+// ShareCounts counts a user's live shares and the copies offered to them
+// that they have not accepted yet.
+type ShareCounts struct {
+	Sent            int64
+	View            int64
+	Links           int64
+	PendingReceived int64
+}
+
+// ExpiredShare is a share whose expiry has passed: a received file, or a
+// view-only share when View is set.
+type ExpiredShare struct {
+	ID          string
+	SenderID    string
+	RecipientID string
+	FileID      string
+	FileName    string
+	View        bool
+}
+
+// searchFacetLimit caps the number of tags in FileMatches.Tags.
+const searchFacetLimit = 20
+
+// SearchWords splits free text into the lower-case words of a
+// FileQuery. Anything but letters and digits separates words, which keeps
+// tsquery operators out of user input.
+func SearchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// folderCID is the cid of a folder called name inside the folder whose cid
+// is parentCID ("" for the root).
+func folderCID(parentCID, name string) string {
+	if parentCID == "" {
+		return name
+	}
+	return parentCID + "/" + name
+}
+
+// fileCID is the cid of file fileID inside the folder whose cid is
+// parentCID ("" for the root).
+func fileCID(parentCID, fileID string) string {
+	if parentCID == "" {
+		return "files/" + fileID
+	}
+	return "files/" + parentCID + "/" + fileID
+}
+
+// shareExpiryNotices are the notifications ExpireShare sends the recipient
+// and the sender of s.
+func shareExpiryNotices(s ExpiredShare) []Notification {
+	name := s.FileName
+	if name == "" {
+		name = "a file"
+	}
+	return []Notification{
+		{Type: "share_expired", From: s.SenderID, To: s.RecipientID, FileName: s.FileName, FileID: s.FileID,
+			Message: fmt.Sprintf("Your access to %s has expired", name)},
+		{Type: "share_expired", From: s.RecipientID, To: s.SenderID, FileName: s.FileName, FileID: s.FileID,
+			Message: fmt.Sprintf("Your share of %s has expired", name)},
+	}
+}
@@ -0,0 +1,1928 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/COS301-SE-2025/Secure-File-Sharing-Platform/sfsp-api/services/fileService/database"
+	"github.com/lib/pq"
+)
+
+const (
+	fileColumns = `id, owner_id, file_name, file_type, file_hash, nonce, description, tags, cid, file_size,
+		allow_view_sharing, parent_id, created_at, corrupted_at, deleted_at`
+	receivedFileColumns = `id, recipient_id, sender_id, file_id, metadata, accepted, received_at, expires_at, expired_at`
+	sentFileColumns     = `id, sender_id, recipient_id, file_id, encrypted_file_key, x3dh_ephemeral_pubkey, sent_at`
+	viewShareColumns    = `id, sender_id, recipient_id, file_id, newfile_id, metadata, shared_at, expires_at, expired_at,
+		revoked, revoked_at, access_granted`
+	notificationColumns = `id, type, "from", "to", file_name, file_id, message, timestamp, status, read, received_file_id`
+	accessLogColumns    = `id, file_id, user_id, action, message, timestamp, view_only`
+)
+
+// Postgres is a Store backed by the service's PostgreSQL schema.
+type Postgres struct {
+	db database.Repository
+}
+
+var _ Store = (*Postgres)(nil)
+
+// NewPostgres returns a store that reads and writes db.
+func NewPostgres(db database.Repository) *Postgres {
+	return &Postgres{db: db}
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// notFound turns sql.ErrNoRows into ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// affected reports ErrNotFound when an update or delete matched no row.
+func affected(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// qualified prefixes each of columns, a column list such as fileColumns,
+// with alias.
+func qualified(alias, columns string) string {
+	cols := strings.Split(columns, ",")
+	for i, c := range cols {
+		cols[i] = alias + "." + strings.TrimSpace(c)
+	}
+	return strings.Join(cols, ", ")
+}
+
+// isUniqueViolation reports whether err is PostgreSQL refusing a duplicate
+// key, e.g. a second live item with the same name in a folder.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// nullable passes "" as NULL for optional columns.
+func nullable(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// scanFile scans fileColumns followed by extra.
+func scanFile(row scanner, extra ...any) (File, error) {
+	var f File
+	var parentID sql.NullString
+	dest := append([]any{&f.ID, &f.OwnerID, &f.FileName, &f.FileType, &f.FileHash, &f.Nonce, &f.Description,
+		pq.Array(&f.Tags), &f.CID, &f.FileSize, &f.AllowViewSharing, &parentID, &f.CreatedAt, &f.CorruptedAt,
+		&f.DeletedAt}, extra...)
+	err := row.Scan(dest...)
+	f.ParentID = parentID.String
+	return f, err
+}
+
+func (p *Postgres) File(ctx context.Context, id string) (File, error) {
+	f, err := scanFile(p.db.QueryRowContext(ctx, `SELECT `+fileColumns+` FROM files WHERE id = $1`, id))
+	return f, notFound(err)
+}
+
+func (p *Postgres) FileOwner(ctx context.Context, id string) (string, error) {
+	var ownerID string
+	err := p.db.QueryRowContext(ctx, "SELECT owner_id FROM files WHERE id = $1 AND deleted_at IS NULL", id).Scan(&ownerID)
+	return ownerID, notFound(err)
+}
+
+func (p *Postgres) AddFile(ctx context.Context, f File) (string, error) {
+	if f.FileType == "" {
+		f.FileType = "file"
+	}
+	if f.Tags == nil {
+		f.Tags = []string{}
+	}
+	var createdAt *time.Time
+	if !f.CreatedAt.IsZero() {
+		createdAt = &f.CreatedAt
+	}
+	var id string
+	err := p.db.QueryRowContext(ctx, `INSERT INTO files
+		(id, owner_id, file_name, file_type, file_hash, nonce, description, tags, cid, file_size, allow_view_sharing, parent_id,
+		 created_at)
+		VALUES (COALESCE($1::uuid, gen_random_uuid()), $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12,
+		 COALESCE($13::timestamptz, NOW())) RETURNING id`,
+		nullable(f.ID), f.OwnerID, f.FileName, f.FileType, f.FileHash, f.Nonce, f.Description, pq.Array(f.Tags),
+		f.CID, f.FileSize, f.AllowViewSharing, nullable(f.ParentID), createdAt).Scan(&id)
+	return id, err
+}
+
+func (p *Postgres) ListFiles(ctx context.Context, ownerID string, page Page) ([]File, error) {
+	query, args := page.Apply(`SELECT `+fileColumns+`, `+page.SortKey()+`
+		FROM files WHERE owner_id = $1 AND deleted_at IS NULL`, ownerID)
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	files := []File{}
+	for rows.Next() {
+		var sortKey string
+		f, err := scanFile(rows, &sortKey)
+		if err != nil {
+			return nil, err
+		}
+		if !page.Keep(sortKey, f.ID) {
+			break
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+func (p *Postgres) CountFiles(ctx context.Context, ownerID string) (int, error) {
+	var n int
+	err := p.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM files
+		WHERE owner_id = $1 AND file_type != 'folder' AND deleted_at IS NULL`, ownerID).Scan(&n)
+	return n, err
+}
+
+func (p *Postgres) AddTags(ctx context.Context, id string, tags []string) error {
+	return affected(p.db.ExecContext(ctx, `UPDATE files
+		SET tags = array_cat(COALESCE(tags, '{}'), $1::text[])
+		WHERE id = $2`, pq.Array(tags), id))
+}
+
+func (p *Postgres) RemoveTags(ctx context.Context, id string, tags []string) error {
+	return affected(p.db.ExecContext(ctx, `UPDATE files
+		SET tags = ARRAY(SELECT UNNEST(tags) EXCEPT SELECT UNNEST($1::text[]))
+		WHERE id = $2`, pq.Array(tags), id))
+}
+
+func (p *Postgres) SetDescription(ctx context.Context, id, description string) error {
+	return affected(p.db.ExecContext(ctx, `UPDATE files SET description = $1 WHERE id = $2`, description, id))
+}
+
+func (p *Postgres) SetFilePath(ctx context.Context, id, cid string) error {
+	return affected(p.db.ExecContext(ctx, `UPDATE files SET cid = $1 WHERE id = $2`, cid, id))
+}
+
+func (p *Postgres) SetFileContent(ctx context.Context, ownerID, id, nonce, fileHash string, fileSize int64) error {
+	return affected(p.db.ExecContext(ctx, `UPDATE files
+		SET nonce = $1, file_hash = $2, file_size = $3, corrupted_at = NULL
+		WHERE owner_id = $4 AND id = $5`, nonce, fileHash, fileSize, ownerID, id))
+}
+
+func (p *Postgres) SetFileBlob(ctx context.Context, id, fileHash, cid string, fileSize int64) error {
+	return affected(p.db.ExecContext(ctx, `UPDATE files SET file_hash = $1, file_size = $2, cid = $3 WHERE id = $4`,
+		fileHash, fileSize, cid, id))
+}
+
+func (p *Postgres) EnableViewSharing(ctx context.Context, id string) error {
+	return affected(p.db.ExecContext(ctx, "UPDATE files SET allow_view_sharing = TRUE WHERE id = $1", id))
+}
+
+// DeleteFile deletes the shares itself instead of leaving them to the
+// foreign keys, all in one transaction.
+func (p *Postgres) DeleteFile(ctx context.Context, id string) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// a no-op once committed; after a failed statement the error that
+	// matters is that one
+	defer func() { _ = tx.Rollback() }()
+	for _, query := range []string{
+		`DELETE FROM received_files WHERE file_id = $1`,
+		`DELETE FROM sent_files WHERE file_id = $1`,
+		`DELETE FROM files WHERE id = $1`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (p *Postgres) TrashFile(ctx context.Context, id string) error {
+	_, err := p.db.ExecContext(ctx, `UPDATE files SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, id)
+	return err
+}
+
+func (p *Postgres) FileTrashed(ctx context.Context, id string) (bool, error) {
+	var trashed bool
+	err := p.db.QueryRowContext(ctx, `SELECT deleted_at IS NOT NULL FROM files WHERE id = $1`, id).Scan(&trashed)
+	return trashed, notFound(err)
+}
+
+func (p *Postgres) ListTrash(ctx context.Context, ownerID string) ([]File, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT `+fileColumns+`
+		FROM files
+		WHERE owner_id = $1 AND deleted_at IS NOT NULL
+		  AND NOT EXISTS (
+			SELECT 1 FROM files p WHERE p.id = files.parent_id AND p.deleted_at = files.deleted_at
+		  )
+		ORDER BY deleted_at DESC`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	files := []File{}
+	for rows.Next() {
+		f, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+func (p *Postgres) TrashedFileIDs(ctx context.Context, ownerID string) ([]string, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT id FROM files WHERE owner_id = $1 AND deleted_at IS NOT NULL`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (p *Postgres) ParentTrashed(ctx context.Context, ownerID, id string) (bool, error) {
+	var trashed bool
+	err := p.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM files p WHERE p.id = f.parent_id AND p.deleted_at IS NOT NULL)
+		FROM files f
+		WHERE f.owner_id = $1 AND f.id = $2 AND f.deleted_at IS NOT NULL`, ownerID, id).Scan(&trashed)
+	return trashed, notFound(err)
+}
+
+// RestoreFile only brings back descendants trashed in the same operation,
+// which share the folder's deleted_at; anything deleted from the folder
+// earlier stays in the trash.
+func (p *Postgres) RestoreFile(ctx context.Context, ownerID, id string) error {
+	return affected(p.db.ExecContext(ctx, `
+		WITH RECURSIVE tree AS (
+			SELECT id, deleted_at FROM files WHERE id = $2 AND owner_id = $1
+			UNION
+			SELECT f.id, f.deleted_at FROM files f JOIN tree t ON f.parent_id = t.id
+			WHERE f.deleted_at = t.deleted_at
+		)
+		UPDATE files SET deleted_at = NULL
+		WHERE id IN (SELECT id FROM tree) AND deleted_at IS NOT NULL`, ownerID, id))
+}
+
+// scanReceivedFile scans receivedFileColumns followed by extra.
+func scanReceivedFile(row scanner, extra ...any) (ReceivedFile, error) {
+	var f ReceivedFile
+	dest := append([]any{&f.ID, &f.RecipientID, &f.SenderID, &f.FileID, &f.Metadata, &f.Accepted,
+		&f.ReceivedAt, &f.ExpiresAt, &f.ExpiredAt}, extra...)
+	err := row.Scan(dest...)
+	return f, err
+}
+
+func (p *Postgres) ReceivedFile(ctx context.Context, id string) (ReceivedFile, error) {
+	f, err := scanReceivedFile(p.db.QueryRowContext(ctx,
+		`SELECT `+receivedFileColumns+` FROM received_files WHERE id = $1`, id))
+	return f, notFound(err)
+}
+
+func (p *Postgres) ListReceivedFiles(ctx context.Context, filter ReceivedFileFilter, page Page) ([]ReceivedFile, error) {
+	where := "recipient_id = $1"
+	if filter.Pending {
+		where += ` AND (expires_at IS NULL OR expires_at > NOW()) AND accepted = FALSE
+		  AND NOT EXISTS (SELECT 1 FROM files f WHERE f.id = received_files.file_id AND f.deleted_at IS NOT NULL)`
+	}
+	query, args := page.Apply(`SELECT `+receivedFileColumns+`, `+page.SortKey()+`
+		FROM received_files WHERE `+where, filter.RecipientID)
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	files := []ReceivedFile{}
+	for rows.Next() {
+		var sortKey string
+		f, err := scanReceivedFile(rows, &sortKey)
+		if err != nil {
+			return nil, err
+		}
+		if !page.Keep(sortKey, f.ID) {
+			break
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+func (p *Postgres) AddReceivedFile(ctx context.Context, f ReceivedFile) (string, error) {
+	var id string
+	err := p.db.QueryRowContext(ctx, `INSERT INTO received_files
+		(id, recipient_id, sender_id, file_id, metadata, accepted, expires_at)
+		VALUES (COALESCE($1::uuid, gen_random_uuid()), $2, $3, $4, $5, $6, $7) RETURNING id`,
+		nullable(f.ID), f.RecipientID, f.SenderID, f.FileID, f.Metadata, f.Accepted, f.ExpiresAt).Scan(&id)
+	return id, err
+}
+
+func (p *Postgres) ListSentFiles(ctx context.Context, senderID string, page Page) ([]SentFile, error) {
+	query, args := page.Apply(`SELECT `+sentFileColumns+`, `+page.SortKey()+`
+		FROM sent_files WHERE sender_id = $1`, senderID)
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	files := []SentFile{}
+	for rows.Next() {
+		var f SentFile
+		var key, pubKey sql.NullString
+		var sortKey string
+		if err := rows.Scan(&f.ID, &f.SenderID, &f.RecipientID, &f.FileID, &key, &pubKey, &f.SentAt, &sortKey); err != nil {
+			return nil, err
+		}
+		if !page.Keep(sortKey, f.ID) {
+			break
+		}
+		f.EncryptedFileKey, f.X3DHEphemeralPubKey = key.String, pubKey.String
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+func (p *Postgres) AddSentFile(ctx context.Context, f SentFile) (string, error) {
+	var id string
+	err := p.db.QueryRowContext(ctx, `INSERT INTO sent_files
+		(id, sender_id, recipient_id, file_id, encrypted_file_key, x3dh_ephemeral_pubkey)
+		VALUES (COALESCE($1::uuid, gen_random_uuid()), $2, $3, $4, $5, $6) RETURNING id`,
+		nullable(f.ID), f.SenderID, f.RecipientID, f.FileID,
+		nullable(f.EncryptedFileKey), nullable(f.X3DHEphemeralPubKey)).Scan(&id)
+	return id, err
+}
+
+// scanViewShare scans viewShareColumns followed by extra.
+func scanViewShare(row scanner, extra ...any) (ViewShare, error) {
+	var v ViewShare
+	var newFileID sql.NullString
+	dest := append([]any{&v.ID, &v.SenderID, &v.RecipientID, &v.FileID, &newFileID, &v.Metadata, &v.SharedAt,
+		&v.ExpiresAt, &v.ExpiredAt, &v.Revoked, &v.RevokedAt, &v.AccessGranted}, extra...)
+	err := row.Scan(dest...)
+	v.NewFileID = newFileID.String
+	return v, err
+}
+
+func (p *Postgres) ViewShare(ctx context.Context, senderID, recipientID, fileID string) (ViewShare, error) {
+	v, err := scanViewShare(p.db.QueryRowContext(ctx, `SELECT `+viewShareColumns+` FROM shared_files_view
+		WHERE sender_id = $1 AND recipient_id = $2 AND file_id = $3
+		ORDER BY shared_at DESC LIMIT 1`, senderID, recipientID, fileID))
+	return v, notFound(err)
+}
+
+func (p *Postgres) ViewShareRecipients(ctx context.Context, fileID string) ([]string, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT DISTINCT recipient_id FROM shared_files_view WHERE file_id = $1`, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []string{}
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		users = append(users, userID)
+	}
+	return users, rows.Err()
+}
+
+func (p *Postgres) AddViewShare(ctx context.Context, v ViewShare) (string, error) {
+	var id string
+	err := p.db.QueryRowContext(ctx, `INSERT INTO shared_files_view
+		(id, sender_id, recipient_id, file_id, newfile_id, metadata, expires_at, access_granted)
+		VALUES (COALESCE($1::uuid, gen_random_uuid()), $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+		nullable(v.ID), v.SenderID, v.RecipientID, v.FileID, nullable(v.NewFileID), v.Metadata,
+		v.ExpiresAt, v.AccessGranted).Scan(&id)
+	return id, err
+}
+
+func (p *Postgres) ActiveViewShare(ctx context.Context, senderID, recipientID, fileID string) (ViewShare, error) {
+	v, err := scanViewShare(p.db.QueryRowContext(ctx, `SELECT `+viewShareColumns+` FROM shared_files_view
+		WHERE sender_id = $1 AND recipient_id = $2 AND file_id = $3 AND revoked = FALSE
+		ORDER BY shared_at DESC LIMIT 1`, senderID, recipientID, fileID))
+	return v, notFound(err)
+}
+
+func (p *Postgres) RecipientViewShare(ctx context.Context, recipientID, fileID string) (ViewShare, error) {
+	v, err := scanViewShare(p.db.QueryRowContext(ctx, `SELECT `+viewShareColumns+` FROM shared_files_view v
+		WHERE recipient_id = $1 AND file_id = $2
+		  AND NOT EXISTS (SELECT 1 FROM files f WHERE f.id = v.file_id AND f.deleted_at IS NOT NULL)
+		ORDER BY shared_at DESC LIMIT 1`, recipientID, fileID))
+	return v, notFound(err)
+}
+
+// ListViewShares fills in the id, name, type, size and description of each
+// file. The page's sort keys refer to the share as svf and the file as f.
+func (p *Postgres) ListViewShares(ctx context.Context, userID string, page Page) ([]SharedView, error) {
+	query, args := page.Apply(`SELECT `+qualified("svf", viewShareColumns)+`,
+			f.file_name, f.file_type, f.file_size, f.description, `+page.SortKey()+`
+		FROM shared_files_view svf
+		JOIN files f ON svf.file_id = f.id
+		WHERE (svf.recipient_id = $1 OR svf.sender_id = $1)
+		  AND svf.revoked = FALSE
+		  AND svf.access_granted = TRUE
+		  AND (svf.expires_at IS NULL OR svf.expires_at > NOW())
+		  AND f.deleted_at IS NULL`, userID)
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	shares := []SharedView{}
+	for rows.Next() {
+		var v SharedView
+		var sortKey string
+		v.Share, err = scanViewShare(rows, &v.File.FileName, &v.File.FileType, &v.File.FileSize, &v.File.Description, &sortKey)
+		if err != nil {
+			return nil, err
+		}
+		if !page.Keep(sortKey, v.Share.ID) {
+			break
+		}
+		v.File.ID = v.Share.FileID
+		shares = append(shares, v)
+	}
+	return shares, rows.Err()
+}
+
+func (p *Postgres) RenewViewShare(ctx context.Context, id, metadata string, expiresAt *time.Time) error {
+	return affected(p.db.ExecContext(ctx, `UPDATE shared_files_view
+		SET metadata = $1, shared_at = NOW(), expires_at = $2 WHERE id = $3`, metadata, expiresAt, id))
+}
+
+func (p *Postgres) RevokeViewShare(ctx context.Context, senderID, recipientID, fileID string) (ViewShare, error) {
+	v, err := scanViewShare(p.db.QueryRowContext(ctx, `UPDATE shared_files_view
+		SET revoked = TRUE, revoked_at = NOW(), access_granted = FALSE
+		WHERE sender_id = $1 AND recipient_id = $2 AND file_id = $3 AND revoked = FALSE
+		RETURNING `+viewShareColumns, senderID, recipientID, fileID))
+	return v, notFound(err)
+}
+
+func (p *Postgres) SetViewShareCopy(ctx context.Context, recipientID, newFileID string) error {
+	_, err := p.db.ExecContext(ctx, `UPDATE shared_files_view SET newfile_id = $1
+		WHERE recipient_id = $2 AND revoked = FALSE AND access_granted = TRUE`, newFileID, recipientID)
+	return err
+}
+
+func (p *Postgres) ConvertToViewShare(ctx context.Context, v ViewShare) (string, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM received_files
+		WHERE recipient_id = $1 AND sender_id = $2 AND file_id = $3`, v.RecipientID, v.SenderID, v.FileID); err != nil {
+		return "", fmt.Errorf("remove received files: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sent_files
+		WHERE sender_id = $1 AND recipient_id = $2 AND file_id = $3`, v.SenderID, v.RecipientID, v.FileID); err != nil {
+		return "", fmt.Errorf("remove sent files: %w", err)
+	}
+	var id string
+	err = tx.QueryRowContext(ctx, `INSERT INTO shared_files_view
+		(id, sender_id, recipient_id, file_id, newfile_id, metadata, expires_at, access_granted)
+		VALUES (COALESCE($1::uuid, gen_random_uuid()), $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+		nullable(v.ID), v.SenderID, v.RecipientID, v.FileID, nullable(v.NewFileID), v.Metadata,
+		v.ExpiresAt, v.AccessGranted).Scan(&id)
+	if err != nil {
+		return "", fmt.Errorf("add view share: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE files SET allow_view_sharing = TRUE WHERE id = $1", v.FileID); err != nil {
+		return "", fmt.Errorf("allow view sharing: %w", err)
+	}
+	return id, tx.Commit()
+}
+
+func (p *Postgres) LatestReceivedFile(ctx context.Context, senderID, recipientID, fileID string) (ReceivedFile, error) {
+	f, err := scanReceivedFile(p.db.QueryRowContext(ctx, `SELECT `+receivedFileColumns+` FROM received_files
+		WHERE sender_id = $1 AND recipient_id = $2 AND file_id = $3
+		ORDER BY received_at DESC LIMIT 1`, senderID, recipientID, fileID))
+	return f, notFound(err)
+}
+
+// descendantsCTE selects every item below the folder bound to $1 as "tree".
+const descendantsCTE = `
+	WITH RECURSIVE tree AS (
+		SELECT id FROM files WHERE parent_id = $1
+		UNION
+		SELECT f.id FROM files f JOIN tree t ON f.parent_id = t.id
+	)`
+
+func (p *Postgres) FolderByPath(ctx context.Context, ownerID, cid string) (File, error) {
+	f, err := scanFile(p.db.QueryRowContext(ctx, `SELECT `+fileColumns+` FROM files
+		WHERE owner_id = $1 AND file_type = 'folder' AND cid = $2 AND deleted_at IS NULL
+		LIMIT 1`, ownerID, cid))
+	return f, notFound(err)
+}
+
+func (p *Postgres) AddFolder(ctx context.Context, f File) (string, error) {
+	if f.Tags == nil {
+		f.Tags = []string{}
+	}
+	var id string
+	err := p.db.QueryRowContext(ctx, `INSERT INTO files
+		(owner_id, file_name, file_type, file_size, cid, nonce, description, tags, parent_id)
+		SELECT $1, $2, 'folder', 0, $3, '', $4, $5, $6
+		WHERE NOT EXISTS (
+			SELECT 1 FROM files
+			WHERE owner_id = $1 AND parent_id IS NOT DISTINCT FROM $6 AND file_name = $2 AND deleted_at IS NULL
+		)
+		RETURNING id`,
+		f.OwnerID, f.FileName, f.CID, f.Description, pq.Array(f.Tags), nullable(f.ParentID)).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) || isUniqueViolation(err) {
+		return "", ErrNameTaken
+	}
+	return id, err
+}
+
+func (p *Postgres) LinkParentFolder(ctx context.Context, id string) error {
+	_, err := p.db.ExecContext(ctx, `
+		UPDATE files f SET parent_id = (
+			SELECT p.id FROM files p
+			WHERE p.owner_id = f.owner_id AND p.file_type = 'folder' AND p.deleted_at IS NULL AND p.id <> f.id
+			  AND (f.cid = 'files/' || p.cid || '/' || f.id OR f.cid = p.cid || '/' || f.file_name)
+			LIMIT 1
+		)
+		WHERE f.id = $1
+	`, id)
+	return err
+}
+
+func (p *Postgres) TrashFolder(ctx context.Context, id string, recursive bool, tags []string) (int64, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var fileType string
+	err = tx.QueryRowContext(ctx, `
+		SELECT COALESCE(file_type, '') FROM files
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`, id).Scan(&fileType)
+	if err != nil {
+		return 0, notFound(err)
+	}
+	if fileType != "folder" {
+		return 0, ErrNotFolder
+	}
+
+	if !recursive {
+		var hasChildren bool
+		err = tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM files WHERE parent_id = $1 AND deleted_at IS NULL)
+		`, id).Scan(&hasChildren)
+		if err != nil {
+			return 0, fmt.Errorf("check folder contents: %w", err)
+		}
+		if hasChildren {
+			return 0, ErrFolderNotEmpty
+		}
+	}
+
+	if len(tags) > 0 {
+		_, err = tx.ExecContext(ctx, descendantsCTE+`
+			UPDATE files
+			SET tags = array_cat(COALESCE(tags, '{}'), $2::text[])
+			WHERE (id = $1 OR id IN (SELECT id FROM tree)) AND deleted_at IS NULL
+		`, id, pq.Array(tags))
+		if err != nil {
+			return 0, fmt.Errorf("tag folder contents: %w", err)
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, descendantsCTE+`
+		UPDATE files SET deleted_at = NOW()
+		WHERE (id = $1 OR id IN (SELECT id FROM tree)) AND deleted_at IS NULL
+	`, id)
+	if err != nil {
+		return 0, fmt.Errorf("trash folder: %w", err)
+	}
+	trashed, _ := res.RowsAffected()
+	return trashed, tx.Commit()
+}
+
+// MoveItem takes an advisory lock per owner for the length of the
+// transaction: the cycle and name checks read rows that a concurrent move
+// could change. The unique index on live names backs up the name check.
+func (p *Postgres) MoveItem(ctx context.Context, m Move) (Moved, error) {
+	var moved Moved
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return moved, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.ExecContext(ctx, `
+		SELECT pg_advisory_xact_lock(hashtext(owner_id::text)) FROM files WHERE id = $1
+	`, m.ID)
+	if err != nil {
+		return moved, fmt.Errorf("lock the owner's tree: %w", err)
+	}
+
+	var ownerID, fileType, oldCID string
+	var parentID sql.NullString
+	err = tx.QueryRowContext(ctx, `
+		SELECT owner_id, file_name, COALESCE(file_type, ''), COALESCE(cid, ''), parent_id
+		FROM files
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`, m.ID).Scan(&ownerID, &moved.Name, &fileType, &oldCID, &parentID)
+	if err != nil {
+		return moved, notFound(err)
+	}
+	isFolder := fileType == "folder"
+
+	// resolve the target folder and its cid
+	target := parentID
+	if m.ParentID != nil {
+		target = sql.NullString{String: *m.ParentID, Valid: *m.ParentID != ""}
+	}
+	var parentCID string
+	if target.Valid {
+		if target.String == m.ID {
+			return moved, ErrFolderCycle
+		}
+		var parentOwner, parentType string
+		err = tx.QueryRowContext(ctx, `
+			SELECT owner_id, COALESCE(file_type, ''), COALESCE(cid, '')
+			FROM files
+			WHERE id = $1 AND deleted_at IS NULL
+		`, target.String).Scan(&parentOwner, &parentType, &parentCID)
+		if errors.Is(err, sql.ErrNoRows) || err == nil && parentOwner != ownerID {
+			return moved, ErrFolderNotFound
+		}
+		if err != nil {
+			return moved, fmt.Errorf("load target folder: %w", err)
+		}
+		if parentType != "folder" {
+			return moved, ErrNotFolder
+		}
+
+		if isFolder {
+			var cycle bool
+			err = tx.QueryRowContext(ctx, `
+				WITH RECURSIVE ancestors AS (
+					SELECT id, parent_id FROM files WHERE id = $1
+					UNION
+					SELECT f.id, f.parent_id FROM files f JOIN ancestors a ON f.id = a.parent_id
+				)
+				SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)
+			`, target.String, m.ID).Scan(&cycle)
+			if err != nil {
+				return moved, fmt.Errorf("check for folder cycle: %w", err)
+			}
+			if cycle {
+				return moved, ErrFolderCycle
+			}
+		}
+	}
+
+	if m.Name != "" {
+		moved.Name = m.Name
+	}
+
+	var taken bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM files
+			WHERE owner_id = $1 AND parent_id IS NOT DISTINCT FROM $2 AND file_name = $3
+			  AND deleted_at IS NULL AND id <> $4
+		)
+	`, ownerID, target, moved.Name, m.ID).Scan(&taken)
+	if err != nil {
+		return moved, fmt.Errorf("check for name collision: %w", err)
+	}
+	if taken {
+		return moved, ErrNameTaken
+	}
+
+	moved.ParentID = target.String
+	moved.CID = fileCID(parentCID, m.ID)
+	if isFolder {
+		moved.CID = folderCID(parentCID, moved.Name)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE files SET parent_id = $1, file_name = $2, cid = $3 WHERE id = $4
+	`, target, moved.Name, moved.CID, m.ID)
+	if isUniqueViolation(err) {
+		return moved, ErrNameTaken
+	}
+	if err != nil {
+		return moved, fmt.Errorf("move item: %w", err)
+	}
+
+	if isFolder && moved.CID != oldCID {
+		// rewrite the path prefix of everything below the folder, in both
+		// the folder ("<cid>/…") and file ("files/<cid>/…") forms
+		res, err := tx.ExecContext(ctx, descendantsCTE+`
+			UPDATE files SET cid = CASE
+				WHEN left(cid, length($2) + 1) = $2 || '/' THEN $3 || substr(cid, length($2) + 1)
+				WHEN left(cid, length($2) + 7) = 'files/' || $2 || '/' THEN 'files/' || $3 || substr(cid, length($2) + 7)
+				ELSE cid
+			END
+			WHERE id IN (SELECT id FROM tree)
+		`, m.ID, oldCID, moved.CID)
+		if err != nil {
+			return moved, fmt.Errorf("update folder contents: %w", err)
+		}
+		moved.Descendants, _ = res.RowsAffected()
+	}
+	return moved, tx.Commit()
+}
+
+// shareStates are the EXISTS checks behind FileQuery.Shared, for a file
+// aliased f.
+var shareStates = map[string]string{
+	"sent": `EXISTS (SELECT 1 FROM received_files s WHERE s.file_id = f.id
+		AND s.expired_at IS NULL AND (s.expires_at IS NULL OR s.expires_at > NOW()))`,
+	"view": `EXISTS (SELECT 1 FROM shared_files_view s WHERE s.file_id = f.id
+		AND s.revoked = FALSE AND s.expired_at IS NULL)`,
+	"link": `EXISTS (SELECT 1 FROM share_links s WHERE s.file_id = f.id AND s.revoked_at IS NULL)`,
+}
+
+var searchOrders = map[string]string{
+	"relevance": "rank DESC, f.created_at DESC",
+	"newest":    "f.created_at DESC",
+	"oldest":    "f.created_at ASC",
+	"name":      "lower(f.file_name) ASC",
+	"size":      "f.file_size DESC NULLS LAST",
+}
+
+// headlineMarks makes ts_headline mark matches the way FileMatch promises.
+const headlineMarks = `StartSel="` + HighlightStart + `", StopSel="` + HighlightStop + `"`
+
+// searchFilter collects the WHERE clause for a search and its arguments.
+type searchFilter struct {
+	conds []string
+	args  []any
+}
+
+// add appends a condition; "?" in cond is replaced by the next placeholder.
+func (f *searchFilter) add(cond string, arg any) {
+	f.args = append(f.args, arg)
+	f.conds = append(f.conds, strings.Replace(cond, "?", fmt.Sprintf("$%d", len(f.args)), 1))
+}
+
+func (f *searchFilter) where() string {
+	return strings.Join(f.conds, " AND ")
+}
+
+// searchConditions turns q into conditions on files f. tsQuery is the
+// placeholder for the text query, or "" without one.
+func searchConditions(q FileQuery) (filter searchFilter, tsQuery string, err error) {
+	filter.add("f.owner_id = ?", q.OwnerID)
+	filter.conds = append(filter.conds, "f.deleted_at IS NULL")
+
+	if len(q.Words) > 0 {
+		words := make([]string, len(q.Words))
+		for i, w := range q.Words {
+			words[i] = w + ":*"
+		}
+		filter.add("f.search_vector @@ to_tsquery('simple', ?)", strings.Join(words, " & "))
+		tsQuery = fmt.Sprintf("$%d", len(filter.args))
+	}
+	if len(q.FileTypes) > 0 {
+		filter.add("f.file_type = ANY(?)", pq.Array(q.FileTypes))
+	}
+	if q.MinSize != nil {
+		filter.add("f.file_size >= ?", *q.MinSize)
+	}
+	if q.MaxSize != nil {
+		filter.add("f.file_size <= ?", *q.MaxSize)
+	}
+	if q.CreatedAfter != nil {
+		filter.add("f.created_at >= ?", *q.CreatedAfter)
+	}
+	if q.CreatedBefore != nil {
+		filter.add("f.created_at < ?", *q.CreatedBefore)
+	}
+
+	folder := ""
+	switch {
+	case q.FolderID != "":
+		filter.args = append(filter.args, q.FolderID)
+		folder = fmt.Sprintf("$%d", len(filter.args))
+	case q.FolderPath != "":
+		// the owner is always $1
+		filter.args = append(filter.args, q.FolderPath)
+		folder = fmt.Sprintf(`(SELECT id FROM files
+			WHERE owner_id = $1 AND file_type = 'folder' AND deleted_at IS NULL AND cid = $%d)`, len(filter.args))
+	}
+	if folder != "" && q.Recursive {
+		filter.conds = append(filter.conds, `f.id IN (
+			WITH RECURSIVE tree AS (
+				SELECT id FROM files WHERE parent_id = `+folder+`
+				UNION
+				SELECT c.id FROM files c JOIN tree t ON c.parent_id = t.id
+			)
+			SELECT id FROM tree)`)
+	} else if folder != "" {
+		filter.conds = append(filter.conds, "f.parent_id = "+folder)
+	}
+
+	switch q.Shared {
+	case "":
+	case "shared", "private":
+		shared := "(" + shareStates["sent"] + " OR " + shareStates["view"] + " OR " + shareStates["link"] + ")"
+		if q.Shared == "private" {
+			shared = "NOT " + shared
+		}
+		filter.conds = append(filter.conds, shared)
+	default:
+		cond, ok := shareStates[q.Shared]
+		if !ok {
+			return filter, "", fmt.Errorf("store: unknown share state %q", q.Shared)
+		}
+		filter.conds = append(filter.conds, cond)
+	}
+	return filter, tsQuery, nil
+}
+
+func (p *Postgres) SearchFiles(ctx context.Context, q FileQuery) (FileMatches, error) {
+	result := FileMatches{Matches: []FileMatch{}, FileTypes: map[string]int{}, Tags: map[string]int{}}
+	filter, tsQuery, err := searchConditions(q)
+	if err != nil {
+		return result, err
+	}
+	order, ok := searchOrders[q.Sort]
+	if !ok {
+		return result, fmt.Errorf("store: unknown sort %q", q.Sort)
+	}
+
+	rank, nameHighlight, descriptionHighlight := "0", "''", "''"
+	if tsQuery != "" {
+		query := "to_tsquery('simple', " + tsQuery + ")"
+		rank = "ts_rank_cd(f.search_vector, " + query + ")"
+		nameHighlight = "ts_headline('simple', f.file_name, " + query + ", '" + headlineMarks + ", HighlightAll=true')"
+		descriptionHighlight = "ts_headline('simple', COALESCE(f.description, ''), " + query + ", '" + headlineMarks + ", MaxFragments=2')"
+	}
+
+	args := append(filter.args, q.Limit, q.Offset)
+	rows, err := p.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s, %s AS rank, %s, %s, COUNT(*) OVER ()
+		FROM files f
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`, qualified("f", fileColumns), rank, nameHighlight, descriptionHighlight, filter.where(), order,
+		len(args)-1, len(args)), args...)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m FileMatch
+		m.File, err = scanFile(rows, &m.Rank, &m.NameHighlight, &m.DescriptionHighlight, &result.Total)
+		if err != nil {
+			return result, err
+		}
+		if tsQuery == "" {
+			m.NameHighlight, m.DescriptionHighlight = "", ""
+		}
+		result.Matches = append(result.Matches, m)
+	}
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	// a page past the end still reports how many files matched
+	if len(result.Matches) == 0 && q.Offset > 0 {
+		err := p.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM files f WHERE "+filter.where(), filter.args...).Scan(&result.Total)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	facets := []struct {
+		sql    string
+		counts map[string]int
+	}{
+		{`SELECT COALESCE(f.file_type, ''), COUNT(*) FROM files f WHERE ` + filter.where() + ` GROUP BY 1`, result.FileTypes},
+		{fmt.Sprintf(`SELECT t.tag, COUNT(*) FROM files f, unnest(f.tags) AS t(tag) WHERE %s
+			GROUP BY 1 ORDER BY 2 DESC, 1 LIMIT %d`, filter.where(), searchFacetLimit), result.Tags},
+	}
+	for _, facet := range facets {
+		if err := p.countBy(ctx, facet.counts, facet.sql, filter.args...); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// countBy runs a query of (key, count) rows into counts.
+func (p *Postgres) countBy(ctx context.Context, counts map[string]int, query string, args ...any) error {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var n int
+		if err := rows.Scan(&key, &n); err != nil {
+			return err
+		}
+		counts[key] = n
+	}
+	return rows.Err()
+}
+
+// StorageTotals reads storage_stats, which triggers on files and
+// blob_hashes keep up to date, so it costs the same however many files the
+// owner has.
+func (p *Postgres) StorageTotals(ctx context.Context, ownerID string) ([]StorageTotal, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT kind, key, bytes, items FROM storage_stats
+		WHERE owner_id = $1 AND items <> 0
+		ORDER BY kind, bytes DESC, key
+	`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	totals := []StorageTotal{}
+	for rows.Next() {
+		var t StorageTotal
+		if err := rows.Scan(&t.Kind, &t.Key, &t.Bytes, &t.Items); err != nil {
+			return nil, err
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
+
+// FolderTotals adds up the folder totals of storage_stats. Only folder rows
+// are walked, so the cost grows with the number of folders rather than
+// files.
+func (p *Postgres) FolderTotals(ctx context.Context, ownerID string) ([]FolderTotal, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		WITH RECURSIVE tree AS (
+			SELECT id AS root_id, id FROM files
+			WHERE owner_id = $1 AND file_type = 'folder' AND deleted_at IS NULL
+			UNION ALL
+			SELECT t.root_id, c.id FROM files c JOIN tree t ON c.parent_id = t.id
+			WHERE c.file_type = 'folder' AND c.deleted_at IS NULL
+		)
+		SELECT `+qualified("f", fileColumns)+`, COALESCE(SUM(s.bytes), 0), COALESCE(SUM(s.items), 0)
+		FROM tree t
+		JOIN files f ON f.id = t.root_id
+		LEFT JOIN storage_stats s ON s.owner_id = $1 AND s.kind = 'folder' AND s.key = t.id::text
+		GROUP BY f.id
+		ORDER BY COALESCE(SUM(s.bytes), 0) DESC, f.id
+	`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	totals := []FolderTotal{}
+	for rows.Next() {
+		var t FolderTotal
+		if t.Folder, err = scanFile(rows, &t.Bytes, &t.Items); err != nil {
+			return nil, err
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
+
+func (p *Postgres) ShareCounts(ctx context.Context, userID string) (ShareCounts, error) {
+	var c ShareCounts
+	err := p.db.QueryRowContext(ctx, `
+		SELECT
+		  (SELECT COUNT(*) FROM received_files
+		    WHERE sender_id = $1 AND expired_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())),
+		  (SELECT COUNT(*) FROM shared_files_view
+		    WHERE sender_id = $1 AND revoked = FALSE AND expired_at IS NULL),
+		  (SELECT COUNT(*) FROM share_links WHERE owner_id = $1 AND revoked_at IS NULL),
+		  (SELECT COUNT(*) FROM received_files
+		    WHERE recipient_id = $1 AND accepted = FALSE AND (expires_at IS NULL OR expires_at > NOW()))
+	`, userID).Scan(&c.Sent, &c.View, &c.Links, &c.PendingReceived)
+	return c, err
+}
+
+func (p *Postgres) LargestFiles(ctx context.Context, ownerID string, n int) ([]File, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT `+fileColumns+` FROM files
+		WHERE owner_id = $1 AND file_type <> 'folder' AND deleted_at IS NULL AND file_size IS NOT NULL
+		ORDER BY file_size DESC, id
+		LIMIT $2`, ownerID, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	files := []File{}
+	for rows.Next() {
+		f, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// queryIDs runs a query of single text columns.
+func (p *Postgres) queryIDs(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (p *Postgres) StaleUploadSessions(ctx context.Context, cutoff time.Time) ([]UploadSession, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT file_id, total_chunks
+		FROM upload_sessions
+		WHERE status <> 'complete' AND updated_at < $1
+	`, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := []UploadSession{}
+	for rows.Next() {
+		var u UploadSession
+		if err := rows.Scan(&u.FileID, &u.TotalChunks); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, u)
+	}
+	return sessions, rows.Err()
+}
+
+func (p *Postgres) LiveUploadSessions(ctx context.Context, cutoff time.Time) ([]string, error) {
+	return p.queryIDs(ctx, `
+		SELECT file_id::text FROM upload_sessions
+		WHERE status <> 'complete' AND updated_at >= $1
+	`, cutoff)
+}
+
+func (p *Postgres) DeleteUploadSession(ctx context.Context, fileID string) (bool, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM upload_session_chunks WHERE file_id = $1`, fileID); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM upload_sessions WHERE file_id = $1`, fileID); err != nil {
+		return false, err
+	}
+	res, err := tx.ExecContext(ctx, `
+		DELETE FROM files
+		WHERE id = $1 AND file_size = 0 AND COALESCE(file_hash, '') = ''
+	`, fileID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, tx.Commit()
+}
+
+func (p *Postgres) DeleteStaleLinkUploads(ctx context.Context, cutoff time.Time) (int, error) {
+	res, err := p.db.ExecContext(ctx, `DELETE FROM link_uploads WHERE updated_at < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+func (p *Postgres) LinkUploadIDs(ctx context.Context) ([]string, error) {
+	return p.queryIDs(ctx, `SELECT id FROM link_uploads`)
+}
+
+func (p *Postgres) OrphanedUploads(ctx context.Context, cutoff time.Time) ([]string, error) {
+	return p.queryIDs(ctx, `
+		SELECT f.id
+		FROM files f
+		WHERE f.file_size = 0
+		  AND COALESCE(f.file_hash, '') = ''
+		  AND COALESCE(f.file_type, '') <> 'folder'
+		  AND f.created_at < $1
+		  AND NOT EXISTS (SELECT 1 FROM upload_sessions s WHERE s.file_id = f.id)
+	`, cutoff)
+}
+
+func (p *Postgres) DeleteIncompleteFile(ctx context.Context, id string) (bool, error) {
+	res, err := p.db.ExecContext(ctx, `
+		DELETE FROM files
+		WHERE id = $1 AND file_size = 0 AND COALESCE(file_hash, '') = ''
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (p *Postgres) TrashedBefore(ctx context.Context, cutoff time.Time) ([]File, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT `+fileColumns+` FROM files
+		WHERE deleted_at IS NOT NULL AND deleted_at < $1`, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	files := []File{}
+	for rows.Next() {
+		f, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// PurgeTrashedFile leaves a file restored in the meantime alone.
+func (p *Postgres) PurgeTrashedFile(ctx context.Context, id string) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var trashed bool
+	err = tx.QueryRowContext(ctx, `SELECT TRUE FROM files WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE`, id).Scan(&trashed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM received_files WHERE file_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sent_files WHERE file_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM files WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *Postgres) ExpiredShares(ctx context.Context, now time.Time) ([]ExpiredShare, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT r.id, r.sender_id, r.recipient_id, r.file_id, COALESCE(f.file_name, ''), FALSE
+		FROM received_files r
+		LEFT JOIN files f ON f.id = r.file_id
+		WHERE r.expires_at < $1 AND r.expired_at IS NULL
+		UNION ALL
+		SELECT v.id, v.sender_id, v.recipient_id, v.file_id, COALESCE(f.file_name, ''), TRUE
+		FROM shared_files_view v
+		LEFT JOIN files f ON f.id = v.file_id
+		WHERE v.expires_at < $1 AND v.expired_at IS NULL AND v.revoked = FALSE
+	`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	shares := []ExpiredShare{}
+	for rows.Next() {
+		var s ExpiredShare
+		if err := rows.Scan(&s.ID, &s.SenderID, &s.RecipientID, &s.FileID, &s.FileName, &s.View); err != nil {
+			return nil, err
+		}
+		shares = append(shares, s)
+	}
+	return shares, rows.Err()
+}
+
+func (p *Postgres) SentCopyInUse(ctx context.Context, senderID, fileID, exceptID string, now time.Time) (bool, error) {
+	var inUse bool
+	err := p.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM received_files
+			WHERE sender_id = $1 AND file_id = $2 AND id <> $3
+			  AND expired_at IS NULL AND (expires_at IS NULL OR expires_at >= $4)
+		)
+	`, senderID, fileID, exceptID, now).Scan(&inUse)
+	return inUse, err
+}
+
+func (p *Postgres) ExpireShare(ctx context.Context, s ExpiredShare, blobPath string, now time.Time) (bool, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `UPDATE received_files SET expired_at = $2 WHERE id = $1 AND expired_at IS NULL`
+	if s.View {
+		query = `UPDATE shared_files_view SET expired_at = $2, access_granted = FALSE WHERE id = $1 AND expired_at IS NULL`
+	}
+	res, err := tx.ExecContext(ctx, query, s.ID, now)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	if blobPath != "" {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM blob_hashes WHERE path = $1`, blobPath); err != nil {
+			return false, err
+		}
+	}
+	for _, n := range shareExpiryNotices(s) {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO notifications (type, "from", "to", file_name, file_id, message, status)
+			VALUES ($1, $2, $3, $4, $5, $6, 'pending')
+		`, n.Type, n.From, n.To, n.FileName, n.FileID, n.Message)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+func (p *Postgres) UsedUpShareLinks(ctx context.Context, now time.Time) ([]ShareLink, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT id, blob_path
+		FROM share_links
+		WHERE revoked_at IS NULL
+		  AND (expires_at < $1 OR download_count >= max_downloads)
+	`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	links := []ShareLink{}
+	for rows.Next() {
+		var l ShareLink
+		if err := rows.Scan(&l.ID, &l.BlobPath); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+func (p *Postgres) ExpireShareLink(ctx context.Context, l ShareLink, now time.Time) (bool, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `UPDATE share_links SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL`, l.ID, now)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM blob_hashes WHERE path = $1`, l.BlobPath); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// scanNotification scans notificationColumns followed by extra.
+func scanNotification(row scanner, extra ...any) (Notification, error) {
+	var n Notification
+	var receivedFileID sql.NullString
+	dest := append([]any{&n.ID, &n.Type, &n.From, &n.To, &n.FileName, &n.FileID, &n.Message,
+		&n.Timestamp, &n.Status, &n.Read, &receivedFileID}, extra...)
+	err := row.Scan(dest...)
+	n.ReceivedFileID = receivedFileID.String
+	return n, err
+}
+
+func (p *Postgres) Notification(ctx context.Context, id string) (Notification, error) {
+	n, err := scanNotification(p.db.QueryRowContext(ctx,
+		`SELECT `+notificationColumns+` FROM notifications WHERE id = $1`, id))
+	return n, notFound(err)
+}
+
+func (p *Postgres) NotificationRecipient(ctx context.Context, id string) (string, error) {
+	var to string
+	err := p.db.QueryRowContext(ctx, `SELECT "to" FROM notifications WHERE id = $1`, id).Scan(&to)
+	return to, notFound(err)
+}
+
+func (p *Postgres) ListNotifications(ctx context.Context, userID string, page Page) ([]Notification, error) {
+	query, args := page.Apply(`SELECT `+notificationColumns+`, `+page.SortKey()+`
+		FROM notifications WHERE "to" = $1`, userID)
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	notifications := []Notification{}
+	for rows.Next() {
+		var sortKey string
+		n, err := scanNotification(rows, &sortKey)
+		if err != nil {
+			return nil, err
+		}
+		if !page.Keep(sortKey, n.ID) {
+			break
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (p *Postgres) AddNotification(ctx context.Context, n Notification) (string, error) {
+	var id string
+	var err error
+	if n.ReceivedFileID == "" {
+		err = p.db.QueryRowContext(ctx, `INSERT INTO notifications
+			(type, "from", "to", file_name, file_id, message, status)
+			VALUES ($1, $2, $3, $4, $5, $6, 'pending') RETURNING id`,
+			n.Type, n.From, n.To, n.FileName, n.FileID, n.Message).Scan(&id)
+	} else {
+		err = p.db.QueryRowContext(ctx, `INSERT INTO notifications
+			(type, "from", "to", file_name, file_id, received_file_id, message, status)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, 'pending') RETURNING id`,
+			n.Type, n.From, n.To, n.FileName, n.FileID, n.ReceivedFileID, n.Message).Scan(&id)
+	}
+	return id, err
+}
+
+func (p *Postgres) MarkNotificationRead(ctx context.Context, id string) error {
+	return affected(p.db.ExecContext(ctx, "UPDATE notifications SET read = TRUE WHERE id = $1", id))
+}
+
+func (p *Postgres) SetNotificationStatus(ctx context.Context, id, status string) error {
+	return affected(p.db.ExecContext(ctx, "UPDATE notifications SET status = $1, read = TRUE WHERE id = $2", status, id))
+}
+
+func (p *Postgres) DeleteNotification(ctx context.Context, id string) error {
+	return affected(p.db.ExecContext(ctx, "DELETE FROM notifications WHERE id = $1", id))
+}
+
+func (p *Postgres) AddAccessLog(ctx context.Context, l AccessLog) error {
+	_, err := p.db.ExecContext(ctx, `INSERT INTO access_logs (file_id, user_id, action, message, view_only)
+		VALUES ($1, $2, $3, $4, $5)`, l.FileID, l.UserID, l.Action, l.Message, l.ViewOnly)
+	return err
+}
+
+func (p *Postgres) ListAccessLogs(ctx context.Context, filter AccessLogFilter, page Page) ([]AccessLog, error) {
+	var where []string
+	var args []any
+	if filter.FileID != "" {
+		args = append(args, filter.FileID)
+		where = append(where, fmt.Sprintf("file_id = $%d", len(args)))
+	}
+	if filter.OwnerID != "" {
+		args = append(args, filter.OwnerID)
+		where = append(where, fmt.Sprintf("file_id IN (SELECT id FROM files WHERE owner_id = $%d)", len(args)))
+	}
+	if len(where) == 0 {
+		where = append(where, "TRUE")
+	}
+	query := `SELECT ` + accessLogColumns + `, ` + page.SortKey() + ` FROM access_logs WHERE ` + strings.Join(where, " AND ")
+	query, args = page.Apply(query, args...)
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	logs := []AccessLog{}
+	for rows.Next() {
+		var l AccessLog
+		var sortKey string
+		if err := rows.Scan(&l.ID, &l.FileID, &l.UserID, &l.Action, &l.Message, &l.Timestamp, &l.ViewOnly, &sortKey); err != nil {
+			return nil, err
+		}
+		if !page.Keep(sortKey, l.ID) {
+			break
+		}
+		logs = append(logs, l)
+	}
+	return logs, rows.Err()
+}
+
+func (p *Postgres) ListViewAccessLogs(ctx context.Context, fileID, userID string) ([]AccessLog, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT `+accessLogColumns+` FROM access_logs
+		WHERE file_id = $1 AND user_id = $2 AND view_only = TRUE
+		ORDER BY timestamp DESC`, fileID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	logs := []AccessLog{}
+	for rows.Next() {
+		var l AccessLog
+		if err := rows.Scan(&l.ID, &l.FileID, &l.UserID, &l.Action, &l.Message, &l.Timestamp, &l.ViewOnly); err != nil {
+			return nil, err
+		}
+		logs = append(logs, l)
+	}
+	return logs, rows.Err()
+}
+
+func (p *Postgres) AddUploadSession(ctx context.Context, u UploadSession) error {
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO upload_sessions (file_id, owner_id, total_chunks, chunk_size, file_size, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, 'uploading', NOW(), NOW())
+	`, u.FileID, u.OwnerID, u.TotalChunks, u.ChunkSize, u.FileSize)
+	return err
+}
+
+func (p *Postgres) UploadSession(ctx context.Context, fileID string) (UploadSession, error) {
+	var u UploadSession
+	err := p.db.QueryRowContext(ctx, `
+		SELECT file_id, owner_id, total_chunks, chunk_size, file_size, status, created_at, updated_at
+		FROM upload_sessions
+		WHERE file_id = $1
+	`, fileID).Scan(&u.FileID, &u.OwnerID, &u.TotalChunks, &u.ChunkSize, &u.FileSize, &u.Status, &u.CreatedAt, &u.UpdatedAt)
+	return u, notFound(err)
+}
+
+func (p *Postgres) SetUploadTotal(ctx context.Context, fileID string, totalChunks int) error {
+	_, err := p.db.ExecContext(ctx, `
+		UPDATE upload_sessions SET total_chunks = $1, updated_at = NOW()
+		WHERE file_id = $2 AND total_chunks = 0
+	`, totalChunks, fileID)
+	return err
+}
+
+func (p *Postgres) SetUploadStatus(ctx context.Context, fileID, status string) error {
+	_, err := p.db.ExecContext(ctx, `UPDATE upload_sessions SET status = $1, updated_at = NOW() WHERE file_id = $2`, status, fileID)
+	return err
+}
+
+func (p *Postgres) ClaimUploadAssembly(ctx context.Context, fileID string) (bool, error) {
+	res, err := p.db.ExecContext(ctx, `
+		UPDATE upload_sessions s
+		SET status = 'assembling', updated_at = NOW()
+		WHERE s.file_id = $1
+		  AND s.status = 'uploading'
+		  AND s.total_chunks > 0
+		  AND (SELECT COUNT(*) FROM upload_session_chunks c WHERE c.file_id = s.file_id) = s.total_chunks
+	`, fileID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (p *Postgres) RecordUploadChunk(ctx context.Context, fileID string, c UploadChunk) error {
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO upload_session_chunks (file_id, chunk_index, size, hash, received_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (file_id, chunk_index) DO UPDATE
+		SET size = EXCLUDED.size, hash = EXCLUDED.hash, received_at = EXCLUDED.received_at
+	`, fileID, c.Index, c.Size, c.Hash)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `UPDATE upload_sessions SET updated_at = NOW() WHERE file_id = $1`, fileID)
+	return err
+}
+
+func (p *Postgres) ForgetUploadChunk(ctx context.Context, fileID string, index int) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM upload_session_chunks WHERE file_id = $1 AND chunk_index = $2`, fileID, index)
+	return err
+}
+
+func (p *Postgres) ListUploadChunks(ctx context.Context, fileID string) ([]UploadChunk, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT chunk_index, size, hash, received_at
+		FROM upload_session_chunks
+		WHERE file_id = $1
+		ORDER BY chunk_index
+	`, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	chunks := []UploadChunk{}
+	for rows.Next() {
+		var c UploadChunk
+		if err := rows.Scan(&c.Index, &c.Size, &c.Hash, &c.ReceivedAt); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, c)
+	}
+	return chunks, rows.Err()
+}
+
+func (p *Postgres) ReceivedUploadBytes(ctx context.Context, fileID string, index int) (total, atIndex int64, err error) {
+	err = p.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(size), 0), COALESCE(SUM(size) FILTER (WHERE chunk_index = $2), 0)
+		FROM upload_session_chunks
+		WHERE file_id = $1
+	`, fileID, index).Scan(&total, &atIndex)
+	return total, atIndex, err
+}
+
+// AddFileVersion keeps the file row locked until the version is recorded,
+// so concurrent snapshots take consecutive numbers instead of colliding.
+func (p *Postgres) AddFileVersion(ctx context.Context, fileID, createdBy string, save func(version int) (string, error)) (FileVersion, error) {
+	v := FileVersion{FileID: fileID, CreatedBy: createdBy}
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return v, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT nonce, file_hash, file_size FROM files
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`, fileID).Scan(&v.Nonce, &v.FileHash, &v.FileSize)
+	if err != nil {
+		return v, fmt.Errorf("load current file: %w", notFound(err))
+	}
+	err = tx.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(version), 0) + 1 FROM file_versions WHERE file_id = $1
+	`, fileID).Scan(&v.Version)
+	if err != nil {
+		return v, fmt.Errorf("next version: %w", err)
+	}
+
+	if v.BlobPath, err = save(v.Version); err != nil {
+		return v, fmt.Errorf("save version blob: %w", err)
+	}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO file_versions (file_id, version, nonce, file_hash, file_size, blob_path, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		RETURNING created_at
+	`, fileID, v.Version, v.Nonce, v.FileHash, v.FileSize, v.BlobPath, createdBy).Scan(&v.CreatedAt)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		return v, fmt.Errorf("record version: %w", err)
+	}
+	return v, nil
+}
+
+func (p *Postgres) ListFileVersions(ctx context.Context, fileID string) ([]FileVersion, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT version, nonce, file_hash, file_size, blob_path, COALESCE(created_by, ''), created_at
+		FROM file_versions
+		WHERE file_id = $1
+		ORDER BY version DESC
+	`, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	versions := []FileVersion{}
+	for rows.Next() {
+		v := FileVersion{FileID: fileID}
+		if err := rows.Scan(&v.Version, &v.Nonce, &v.FileHash, &v.FileSize, &v.BlobPath, &v.CreatedBy, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+func (p *Postgres) FileVersion(ctx context.Context, fileID string, version int) (FileVersion, error) {
+	v := FileVersion{FileID: fileID, Version: version}
+	err := p.db.QueryRowContext(ctx, `
+		SELECT v.nonce, v.file_hash, v.file_size, v.blob_path, COALESCE(v.created_by, ''), v.created_at, b.corrupted_at
+		FROM file_versions v
+		LEFT JOIN blob_hashes b ON b.path = v.blob_path
+		WHERE v.file_id = $1 AND v.version = $2
+	`, fileID, version).Scan(&v.Nonce, &v.FileHash, &v.FileSize, &v.BlobPath, &v.CreatedBy, &v.CreatedAt, &v.CorruptedAt)
+	return v, notFound(err)
+}
+
+func (p *Postgres) DeleteFileVersion(ctx context.Context, fileID string, version int) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM file_versions WHERE file_id = $1 AND version = $2`, fileID, version)
+	return err
+}
+
+func (p *Postgres) BlobHash(ctx context.Context, path string) (BlobHash, error) {
+	b := BlobHash{Path: path}
+	var fileID sql.NullString
+	var size sql.NullInt64
+	err := p.db.QueryRowContext(ctx, `
+		SELECT file_id, sha256, size, corrupted_at FROM blob_hashes WHERE path = $1
+	`, path).Scan(&fileID, &b.SHA256, &size, &b.CorruptedAt)
+	b.FileID, b.Size = fileID.String, -1
+	if size.Valid {
+		b.Size = size.Int64
+	}
+	return b, notFound(err)
+}
+
+func (p *Postgres) RecordBlobHash(ctx context.Context, b BlobHash) error {
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO blob_hashes (path, file_id, sha256, size, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (path) DO UPDATE
+		SET file_id = EXCLUDED.file_id, sha256 = EXCLUDED.sha256, size = EXCLUDED.size,
+		    created_at = EXCLUDED.created_at, corrupted_at = NULL
+	`, b.Path, b.FileID, b.SHA256, b.Size)
+	return err
+}
+
+func (p *Postgres) DeleteBlobHash(ctx context.Context, path string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM blob_hashes WHERE path = $1`, path)
+	return err
+}
+
+func (p *Postgres) MarkBlobCorrupted(ctx context.Context, path string) error {
+	_, err := p.db.ExecContext(ctx, `UPDATE blob_hashes SET corrupted_at = NOW() WHERE path = $1`, path)
+	return err
+}
+
+func (p *Postgres) MarkFileCorrupted(ctx context.Context, fileID string) error {
+	_, err := p.db.ExecContext(ctx, `UPDATE files SET corrupted_at = NOW() WHERE id = $1`, fileID)
+	return err
+}
+
+func (p *Postgres) AddShareLink(ctx context.Context, l ShareLink) error {
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO share_links (
+			id, token_hash, file_id, owner_id, blob_path, metadata, password_hash, expires_at, max_downloads
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, l.ID, l.TokenHash, l.FileID, l.OwnerID, l.BlobPath, l.Metadata,
+		nullable(l.PasswordHash), l.ExpiresAt, l.MaxDownloads)
+	return err
+}
+
+func (p *Postgres) ShareLinkByToken(ctx context.Context, tokenHash string) (ShareLink, error) {
+	l := ShareLink{TokenHash: tokenHash}
+	var maxDownloads sql.NullInt64
+	err := p.db.QueryRowContext(ctx, `
+		SELECT l.id, l.file_id, l.owner_id, l.blob_path, l.metadata, COALESCE(l.password_hash, ''),
+		       l.expires_at, l.locked_until, l.max_downloads, l.download_count,
+		       l.revoked_at IS NOT NULL, f.deleted_at IS NOT NULL
+		FROM share_links l
+		JOIN files f ON f.id = l.file_id
+		WHERE l.token_hash = $1
+	`, tokenHash).Scan(&l.ID, &l.FileID, &l.OwnerID, &l.BlobPath, &l.Metadata, &l.PasswordHash,
+		&l.ExpiresAt, &l.LockedUntil, &maxDownloads, &l.DownloadCount, &l.Revoked, &l.FileTrashed)
+	l.MaxDownloads = nullableInt(maxDownloads)
+	return l, notFound(err)
+}
+
+func (p *Postgres) ListShareLinks(ctx context.Context, ownerID, fileID string) ([]ShareLink, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT id, file_id, COALESCE(password_hash, ''), expires_at, max_downloads, download_count,
+		       revoked_at IS NOT NULL, created_at
+		FROM share_links
+		WHERE owner_id = $1 AND ($2 = '' OR file_id::text = $2)
+		ORDER BY created_at DESC
+	`, ownerID, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	links := []ShareLink{}
+	for rows.Next() {
+		l := ShareLink{OwnerID: ownerID}
+		var maxDownloads sql.NullInt64
+		if err := rows.Scan(&l.ID, &l.FileID, &l.PasswordHash, &l.ExpiresAt, &maxDownloads,
+			&l.DownloadCount, &l.Revoked, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		l.MaxDownloads = nullableInt(maxDownloads)
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// nullableInt is the inverse of storing a *int.
+func nullableInt(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	v := int(n.Int64)
+	return &v
+}
+
+func (p *Postgres) RevokeShareLink(ctx context.Context, ownerID, id string) (ShareLink, error) {
+	l := ShareLink{ID: id, OwnerID: ownerID, Revoked: true}
+	err := p.db.QueryRowContext(ctx, `
+		UPDATE share_links SET revoked_at = NOW()
+		WHERE id = $1 AND owner_id = $2 AND revoked_at IS NULL
+		RETURNING file_id, blob_path
+	`, id, ownerID).Scan(&l.FileID, &l.BlobPath)
+	return l, notFound(err)
+}
+
+func (p *Postgres) RecordLinkPasswordFailure(ctx context.Context, id string, maxAttempts int, lockUntil time.Time) error {
+	_, err := p.db.ExecContext(ctx, `
+		UPDATE share_links SET
+			failed_attempts = CASE WHEN failed_attempts + 1 >= $2 THEN 0 ELSE failed_attempts + 1 END,
+			locked_until = CASE WHEN failed_attempts + 1 >= $2 THEN $3 ELSE locked_until END
+		WHERE id = $1
+	`, id, maxAttempts, lockUntil)
+	return err
+}
+
+func (p *Postgres) ClaimLinkDownload(ctx context.Context, id string) (bool, error) {
+	res, err := p.db.ExecContext(ctx, `
+		UPDATE share_links SET download_count = download_count + 1, failed_attempts = 0
+		WHERE id = $1 AND revoked_at IS NULL AND (max_downloads IS NULL OR download_count < max_downloads)
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (p *Postgres) AddLinkUpload(ctx context.Context, u LinkUpload) error {
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO link_uploads (id, file_id, owner_id, total_chunks, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, 'uploading', NOW(), NOW())
+	`, u.ID, u.FileID, u.OwnerID, u.TotalChunks)
+	return err
+}
+
+func (p *Postgres) LinkUpload(ctx context.Context, id string) (LinkUpload, error) {
+	var u LinkUpload
+	err := p.db.QueryRowContext(ctx, `
+		SELECT id, file_id, owner_id, total_chunks, status, created_at, updated_at
+		FROM link_uploads
+		WHERE id = $1
+	`, id).Scan(&u.ID, &u.FileID, &u.OwnerID, &u.TotalChunks, &u.Status, &u.CreatedAt, &u.UpdatedAt)
+	return u, notFound(err)
+}
+
+func (p *Postgres) RecordLinkUploadChunk(ctx context.Context, id string, index int, size int64) error {
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO link_upload_chunks (upload_id, chunk_index, size, received_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (upload_id, chunk_index) DO UPDATE
+		SET size = EXCLUDED.size, received_at = EXCLUDED.received_at
+	`, id, index, size)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `UPDATE link_uploads SET updated_at = NOW() WHERE id = $1`, id)
+	return err
+}
+
+func (p *Postgres) ClaimLinkUploadAssembly(ctx context.Context, id string) (bool, error) {
+	res, err := p.db.ExecContext(ctx, `
+		UPDATE link_uploads u
+		SET status = 'assembling', updated_at = NOW()
+		WHERE u.id = $1
+		  AND u.status = 'uploading'
+		  AND (SELECT COUNT(*) FROM link_upload_chunks c WHERE c.upload_id = u.id) = u.total_chunks
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (p *Postgres) SetLinkUploadStatus(ctx context.Context, id, status string) error {
+	_, err := p.db.ExecContext(ctx, `UPDATE link_uploads SET status = $1, updated_at = NOW() WHERE id = $2`, status, id)
+	return err
+}
+
+func (p *Postgres) DeleteLinkUpload(ctx context.Context, id string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM link_uploads WHERE id = $1`, id)
+	return err
+}
+
+func (p *Postgres) UserQuota(ctx context.Context, userID, defaultTier string) (QuotaTier, error) {
+	var t QuotaTier
+	err := p.db.QueryRowContext(ctx, `
+		SELECT COALESCE(q.tier, $2), COALESCE(q.limit_bytes, t.limit_bytes)
+		FROM (SELECT 1) AS one
+		LEFT JOIN user_quotas q ON q.user_id = $1
+		LEFT JOIN quota_tiers t ON t.name = COALESCE(q.tier, $2)
+	`, userID, defaultTier).Scan(&t.Name, &t.LimitBytes)
+	return t, err
+}
+
+func (p *Postgres) SetUserQuota(ctx context.Context, userID, tier string, limitBytes *int64) error {
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO user_quotas (user_id, tier, limit_bytes, updated_at) VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET tier = EXCLUDED.tier, limit_bytes = EXCLUDED.limit_bytes, updated_at = NOW()
+	`, userID, nullable(tier), limitBytes)
+	return err
+}
+
+func (p *Postgres) QuotaTiers(ctx context.Context) ([]QuotaTier, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT name, limit_bytes FROM quota_tiers ORDER BY limit_bytes NULLS LAST, name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tiers := []QuotaTier{}
+	for rows.Next() {
+		var t QuotaTier
+		if err := rows.Scan(&t.Name, &t.LimitBytes); err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, t)
+	}
+	return tiers, rows.Err()
+}
+
+func (p *Postgres) QuotaTierExists(ctx context.Context, name string) (bool, error) {
+	var exists bool
+	err := p.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM quota_tiers WHERE name = $1)`, name).Scan(&exists)
+	return exists, err
+}
+
+func (p *Postgres) SetQuotaTier(ctx context.Context, t QuotaTier) error {
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO quota_tiers (name, limit_bytes) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET limit_bytes = EXCLUDED.limit_bytes
+	`, t.Name, t.LimitBytes)
+	return err
+}
+
+// StorageUsage counts unfinished uploads at their declared size, or what has
+// arrived if that is more; a completed upload counts through files instead.
+func (p *Postgres) StorageUsage(ctx context.Context, userID string) (Usage, error) {
+	var u Usage
+	err := p.db.QueryRowContext(ctx, `
+		SELECT
+		  (SELECT COALESCE(SUM(file_size), 0) FROM files WHERE owner_id = $1),
+		  (SELECT COALESCE(SUM(v.file_size), 0) FROM file_versions v JOIN files f ON f.id = v.file_id WHERE f.owner_id = $1),
+		  (SELECT COALESCE(SUM(size), 0) FROM blob_hashes WHERE path LIKE $2),
+		  (SELECT COALESCE(SUM(size), 0) FROM blob_hashes WHERE path LIKE $3),
+		  (SELECT COALESCE(SUM(b.size), 0) FROM share_links l JOIN blob_hashes b ON b.path = l.blob_path
+		    WHERE l.owner_id = $1 AND l.revoked_at IS NULL),
+		  (SELECT COALESCE(SUM(GREATEST(s.file_size,
+		      (SELECT COALESCE(SUM(c.size), 0) FROM upload_session_chunks c WHERE c.file_id = s.file_id))), 0)
+		    FROM upload_sessions s WHERE s.owner_id = $1 AND s.status <> 'complete')
+	`, userID, "files/"+userID+"/sent/%", "files/"+userID+"/shared_view/%").
+		Scan(&u.Files, &u.Versions, &u.Sent, &u.ViewShares, &u.Links, &u.Uploads)
+	return u, err
+}
+
+func (p *Postgres) UserExists(ctx context.Context, id string) (bool, error) {
+	var exists bool
+	err := p.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM users WHERE id = $1
+		)
+	`, id).Scan(&exists)
+	return exists, err
+}
+
+func (p *Postgres) AddUser(ctx context.Context, id string) error {
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO users (id)
+		VALUES ($1)
+		ON CONFLICT (id) DO NOTHING
+	`, id)
+	return err
+}
+
+func (p *Postgres) AddOneTimePreKey(ctx context.Context, userID string) (string, error) {
+	var id string
+	err := p.db.QueryRowContext(ctx, `INSERT INTO one_time_pre_keys (user_id) VALUES ($1) RETURNING id`, userID).Scan(&id)
+	return id, err
+}
+
+func (p *Postgres) OneTimePreKeyOwner(ctx context.Context, keyID string) (string, error) {
+	var userID string
+	err := p.db.QueryRowContext(ctx, `SELECT user_id FROM one_time_pre_keys WHERE id = $1`, keyID).Scan(&userID)
+	return userID, notFound(err)
+}
@@ -0,0 +1,420 @@
+// Package store is the service's data access layer. It describes the rows
+// the handlers work with as typed models and reads and writes them through
+// small interfaces, implemented once for PostgreSQL and once in memory for
+// tests and local development.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the requested row does not exist.
+	ErrNotFound = errors.New("store: not found")
+	// ErrNameTaken is returned when a folder already holds a live item with
+	// the name.
+	ErrNameTaken = errors.New("store: name taken")
+	// ErrNotFolder is returned when a folder was expected but the item is a
+	// file.
+	ErrNotFolder = errors.New("store: not a folder")
+	// ErrFolderNotEmpty is returned when a folder that must be empty is not.
+	ErrFolderNotEmpty = errors.New("store: folder not empty")
+	// ErrFolderNotFound is returned when the folder to move into does not
+	// exist, is in the trash or belongs to someone else.
+	ErrFolderNotFound = errors.New("store: folder not found")
+	// ErrFolderCycle is returned when a folder would be moved into itself or
+	// one of its subfolders.
+	ErrFolderCycle = errors.New("store: folder cycle")
+)
+
+// Page is one page of a listing; api.Page implements it. Postgres completes
+// its query with SortKey and Apply, while Memory orders the rows itself by
+// SortName and Descending and skips past After. Both pass each row to Keep.
+type Page interface {
+	SortName() string
+	Descending() bool
+	SortKey() string
+	Apply(query string, args ...any) (string, []any)
+	After() (key, id string, ok bool)
+	Keep(key, id string) bool
+}
+
+// Files reads and writes file records.
+type Files interface {
+	// File returns the file with the given id, whether or not it is in the
+	// trash.
+	File(ctx context.Context, id string) (File, error)
+	// FileOwner returns the id of the user who owns the file. Files in the
+	// trash are not found.
+	FileOwner(ctx context.Context, id string) (string, error)
+	// AddFile stores f and returns its id, generated when f.ID is empty.
+	// CreatedAt defaults to now.
+	AddFile(ctx context.Context, f File) (string, error)
+	// ListFiles returns one page of the files ownerID has outside the trash,
+	// sorted by "createdAt", "name" or "size".
+	ListFiles(ctx context.Context, ownerID string, page Page) ([]File, error)
+	// CountFiles counts the files, not folders, ownerID has outside the trash.
+	CountFiles(ctx context.Context, ownerID string) (int, error)
+	AddTags(ctx context.Context, id string, tags []string) error
+	RemoveTags(ctx context.Context, id string, tags []string) error
+	SetDescription(ctx context.Context, id, description string) error
+	// SetFilePath moves the file to cid, its path in storage.
+	SetFilePath(ctx context.Context, id, cid string) error
+	// SetFileContent records new content for the file of ownerID and clears
+	// any earlier corruption.
+	SetFileContent(ctx context.Context, ownerID, id, nonce, fileHash string, fileSize int64) error
+	// SetFileBlob records the hash, size and path of a finished upload.
+	SetFileBlob(ctx context.Context, id, fileHash, cid string, fileSize int64) error
+	// EnableViewSharing marks the file as shared for viewing.
+	EnableViewSharing(ctx context.Context, id string) error
+	// DeleteFile removes the file along with the copies sent of it.
+	DeleteFile(ctx context.Context, id string) error
+}
+
+// Trash moves files in and out of the trash.
+type Trash interface {
+	// TrashFile moves the file to the trash. A file already there keeps the
+	// time it was trashed.
+	TrashFile(ctx context.Context, id string) error
+	// FileTrashed reports whether the file is in the trash.
+	FileTrashed(ctx context.Context, id string) (bool, error)
+	// ListTrash returns the files ownerID has in the trash, most recently
+	// trashed first, leaving out those trashed along with their folder.
+	ListTrash(ctx context.Context, ownerID string) ([]File, error)
+	// TrashedFileIDs returns the ids of every file ownerID has in the trash.
+	TrashedFileIDs(ctx context.Context, ownerID string) ([]string, error)
+	// ParentTrashed reports whether the folder holding the trashed file is
+	// in the trash too. The file must be in ownerID's trash.
+	ParentTrashed(ctx context.Context, ownerID, id string) (bool, error)
+	// RestoreFile takes the file out of ownerID's trash along with everything
+	// that was trashed with it.
+	RestoreFile(ctx context.Context, ownerID, id string) error
+}
+
+// Shares reads and writes the records of files sent to other users, both
+// as copies (received and sent files) and as view-only shares.
+type Shares interface {
+	ReceivedFile(ctx context.Context, id string) (ReceivedFile, error)
+	// ListReceivedFiles returns one page of the files matching filter,
+	// sorted by "receivedAt" or "expiresAt".
+	ListReceivedFiles(ctx context.Context, filter ReceivedFileFilter, page Page) ([]ReceivedFile, error)
+	AddReceivedFile(ctx context.Context, f ReceivedFile) (string, error)
+
+	// ListSentFiles returns one page of the files senderID sent, sorted by
+	// "sentAt".
+	ListSentFiles(ctx context.Context, senderID string, page Page) ([]SentFile, error)
+	AddSentFile(ctx context.Context, f SentFile) (string, error)
+
+	// ViewShare returns the most recent view-only share of fileID from
+	// senderID to recipientID.
+	ViewShare(ctx context.Context, senderID, recipientID, fileID string) (ViewShare, error)
+	// ViewShareRecipients returns every user fileID was shared with for
+	// viewing, once each.
+	ViewShareRecipients(ctx context.Context, fileID string) ([]string, error)
+	AddViewShare(ctx context.Context, v ViewShare) (string, error)
+	// ActiveViewShare returns the view-only share of fileID from senderID to
+	// recipientID that has not been revoked.
+	ActiveViewShare(ctx context.Context, senderID, recipientID, fileID string) (ViewShare, error)
+	// RecipientViewShare returns the most recent view-only share of fileID
+	// to recipientID, revoked or not, unless the file is in the trash.
+	RecipientViewShare(ctx context.Context, recipientID, fileID string) (ViewShare, error)
+	// ListViewShares returns one page of the live view-only shares userID
+	// sent or received, of files outside the trash, sorted by "sharedAt" or
+	// "name".
+	ListViewShares(ctx context.Context, userID string, page Page) ([]SharedView, error)
+	// RenewViewShare replaces the key material and expiry of a share and
+	// shares it again from now.
+	RenewViewShare(ctx context.Context, id, metadata string, expiresAt *time.Time) error
+	// RevokeViewShare revokes the active share of fileID from senderID to
+	// recipientID and returns it.
+	RevokeViewShare(ctx context.Context, senderID, recipientID, fileID string) (ViewShare, error)
+	// SetViewShareCopy points the live shares to recipientID at newFileID,
+	// the copy the recipient re-encrypted.
+	SetViewShareCopy(ctx context.Context, recipientID, newFileID string) error
+	// ConvertToViewShare replaces the copies of v.FileID sent from v.SenderID
+	// to v.RecipientID with the view-only share v, and returns its id.
+	ConvertToViewShare(ctx context.Context, v ViewShare) (string, error)
+	// LatestReceivedFile returns the copy of fileID that recipientID most
+	// recently received from senderID.
+	LatestReceivedFile(ctx context.Context, senderID, recipientID, fileID string) (ReceivedFile, error)
+}
+
+// Folders arranges files in folders. A folder is a file of type "folder";
+// ParentID links every item to the folder holding it, "" at the root. CID
+// carries the path clients display: "<folder cid>/<name>" for a folder and
+// "files/<folder cid>/<fileId>" for a file.
+type Folders interface {
+	// FolderByPath returns the live folder of ownerID whose cid is cid.
+	FolderByPath(ctx context.Context, ownerID, cid string) (File, error)
+	// AddFolder stores f as a folder and returns its id. It fails with
+	// ErrNameTaken when f.ParentID already holds a live item named
+	// f.FileName.
+	AddFolder(ctx context.Context, f File) (string, error)
+	// LinkParentFolder points the item at the folder its cid places it in,
+	// or at the root when there is no such folder.
+	LinkParentFolder(ctx context.Context, id string) error
+	// TrashFolder moves a live folder to the trash, adding tags to it and to
+	// everything below it first, and returns how many items it trashed.
+	// Everything trashed together gets the same deleted time. Unless
+	// recursive is set, a folder that holds live items is refused with
+	// ErrFolderNotEmpty.
+	TrashFolder(ctx context.Context, id string, recursive bool, tags []string) (int64, error)
+	// MoveItem moves and/or renames a live item, taking everything below a
+	// folder along, and rewrites the cids. Moves of one owner's items run
+	// one at a time.
+	MoveItem(ctx context.Context, m Move) (Moved, error)
+}
+
+// Search finds files by their name, description and tags.
+type Search interface {
+	// SearchFiles returns one page of the files matching q, with the number
+	// of matches by file type and by tag over all of them.
+	SearchFiles(ctx context.Context, q FileQuery) (FileMatches, error)
+}
+
+// StorageStats adds up where a user's storage goes. The totals are kept
+// per (owner, kind, key); see the StatsKind constants.
+type StorageStats interface {
+	// StorageTotals returns the non-empty totals of ownerID, ordered by
+	// kind, then bytes, largest first.
+	StorageTotals(ctx context.Context, ownerID string) ([]StorageTotal, error)
+	// FolderTotals returns every live folder of ownerID with the files in
+	// it and below it, largest first.
+	FolderTotals(ctx context.Context, ownerID string) ([]FolderTotal, error)
+	// ShareCounts counts the live shares of userID and the offers waiting
+	// for them.
+	ShareCounts(ctx context.Context, userID string) (ShareCounts, error)
+	// LargestFiles returns the n largest live files of ownerID.
+	LargestFiles(ctx context.Context, ownerID string, n int) ([]File, error)
+}
+
+// Sweeps finds and removes what abandoned uploads, the trash and expired
+// shares leave behind.
+type Sweeps interface {
+	// StaleUploadSessions returns the incomplete sessions that have not
+	// seen a chunk since cutoff.
+	StaleUploadSessions(ctx context.Context, cutoff time.Time) ([]UploadSession, error)
+	// LiveUploadSessions returns the file ids of the incomplete sessions
+	// that have seen a chunk since cutoff.
+	LiveUploadSessions(ctx context.Context, cutoff time.Time) ([]string, error)
+	// DeleteUploadSession forgets a session and its chunks, and the file if
+	// the upload never completed. It reports whether the file was deleted.
+	DeleteUploadSession(ctx context.Context, fileID string) (bool, error)
+	// DeleteStaleLinkUploads forgets the link uploads that have not seen a
+	// chunk since cutoff and returns how many there were.
+	DeleteStaleLinkUploads(ctx context.Context, cutoff time.Time) (int, error)
+	// LinkUploadIDs returns the ids of every link upload.
+	LinkUploadIDs(ctx context.Context) ([]string, error)
+	// OrphanedUploads returns the ids of the files created before cutoff for
+	// an upload that never completed and has no session.
+	OrphanedUploads(ctx context.Context, cutoff time.Time) ([]string, error)
+	// DeleteIncompleteFile deletes a file whose upload never completed and
+	// reports whether there was one.
+	DeleteIncompleteFile(ctx context.Context, id string) (bool, error)
+	// TrashedBefore returns the files moved to the trash before cutoff.
+	TrashedBefore(ctx context.Context, cutoff time.Time) ([]File, error)
+	// PurgeTrashedFile deletes a file that is still in the trash, with the
+	// copies sent of it.
+	PurgeTrashedFile(ctx context.Context, id string) error
+	// ExpiredShares returns the live shares, both copies and view-only,
+	// whose expiry passed before now.
+	ExpiredShares(ctx context.Context, now time.Time) ([]ExpiredShare, error)
+	// SentCopyInUse reports whether a live copy of fileID from senderID
+	// other than exceptID still reads the sender's sent blob at now.
+	SentCopyInUse(ctx context.Context, senderID, fileID, exceptID string, now time.Time) (bool, error)
+	// ExpireShare marks the share expired at now, forgets the hash of
+	// blobPath unless it is "" and notifies both parties. It reports false if
+	// the share had already expired.
+	ExpireShare(ctx context.Context, s ExpiredShare, blobPath string, now time.Time) (bool, error)
+	// UsedUpShareLinks returns the live links that expired before now or
+	// have no downloads left.
+	UsedUpShareLinks(ctx context.Context, now time.Time) ([]ShareLink, error)
+	// ExpireShareLink revokes a live link at now and forgets the hash of its
+	// copy. It reports false if the link was already revoked.
+	ExpireShareLink(ctx context.Context, l ShareLink, now time.Time) (bool, error)
+}
+
+// Notifications reads and writes the notifications shown to users.
+type Notifications interface {
+	Notification(ctx context.Context, id string) (Notification, error)
+	// NotificationRecipient returns the id of the user the notification is
+	// addressed to.
+	NotificationRecipient(ctx context.Context, id string) (string, error)
+	// ListNotifications returns one page of the notifications addressed to
+	// userID.
+	ListNotifications(ctx context.Context, userID string, page Page) ([]Notification, error)
+	// AddNotification stores n as pending and returns its id.
+	AddNotification(ctx context.Context, n Notification) (string, error)
+	MarkNotificationRead(ctx context.Context, id string) error
+	// SetNotificationStatus records the recipient's answer, which also marks
+	// the notification read.
+	SetNotificationStatus(ctx context.Context, id, status string) error
+	DeleteNotification(ctx context.Context, id string) error
+}
+
+// AccessLogs records and lists who did what to which file.
+type AccessLogs interface {
+	AddAccessLog(ctx context.Context, l AccessLog) error
+	// ListAccessLogs returns one page of the entries matching filter.
+	ListAccessLogs(ctx context.Context, filter AccessLogFilter, page Page) ([]AccessLog, error)
+	// ListViewAccessLogs returns every view-only entry userID left on
+	// fileID, newest first.
+	ListViewAccessLogs(ctx context.Context, fileID, userID string) ([]AccessLog, error)
+}
+
+// ReceivedFileFilter narrows ListReceivedFiles.
+type ReceivedFileFilter struct {
+	RecipientID string
+	// Pending keeps the offers the recipient has neither accepted nor let
+	// expire, of files that are not in the trash.
+	Pending bool
+}
+
+// AccessLogFilter narrows ListAccessLogs. Empty fields match everything.
+type AccessLogFilter struct {
+	// FileID keeps the entries of one file.
+	FileID string
+	// OwnerID keeps the entries of the files the user owns.
+	OwnerID string
+}
+
+// UploadSessions tracks chunked uploads and the chunks received for them.
+type UploadSessions interface {
+	// AddUploadSession starts a session in the uploading state.
+	AddUploadSession(ctx context.Context, u UploadSession) error
+	UploadSession(ctx context.Context, fileID string) (UploadSession, error)
+	// SetUploadTotal records the chunk count of a session started without
+	// one. It never overwrites a count that is already known.
+	SetUploadTotal(ctx context.Context, fileID string, totalChunks int) error
+	SetUploadStatus(ctx context.Context, fileID, status string) error
+	// ClaimUploadAssembly moves the session to assembling if, and only if,
+	// every expected chunk has been recorded. Of concurrent callers only one
+	// is told it won.
+	ClaimUploadAssembly(ctx context.Context, fileID string) (bool, error)
+
+	// RecordUploadChunk stores c, replacing an earlier chunk with its index.
+	RecordUploadChunk(ctx context.Context, fileID string, c UploadChunk) error
+	// ForgetUploadChunk drops a chunk so it is reported as missing again.
+	ForgetUploadChunk(ctx context.Context, fileID string, index int) error
+	// ListUploadChunks returns the chunks received, in index order.
+	ListUploadChunks(ctx context.Context, fileID string) ([]UploadChunk, error)
+	// ReceivedUploadBytes returns the bytes received for an upload so far and
+	// how many of them belong to chunk index.
+	ReceivedUploadBytes(ctx context.Context, fileID string, index int) (total, atIndex int64, err error)
+}
+
+// FileVersions keeps the earlier states of files.
+type FileVersions interface {
+	// AddFileVersion records the current content of a file outside the
+	// trash as its next version. save is called with the version number
+	// while the file is locked, so concurrent callers get consecutive
+	// numbers; it stores the blob and returns its path. Nothing is recorded
+	// when save fails.
+	AddFileVersion(ctx context.Context, fileID, createdBy string, save func(version int) (string, error)) (FileVersion, error)
+	// ListFileVersions returns the versions of a file, newest first.
+	ListFileVersions(ctx context.Context, fileID string) ([]FileVersion, error)
+	// FileVersion returns one version, with CorruptedAt set from its blob
+	// hash.
+	FileVersion(ctx context.Context, fileID string, version int) (FileVersion, error)
+	DeleteFileVersion(ctx context.Context, fileID string, version int) error
+}
+
+// BlobHashes records the hashes of blobs stored outside the files table, so
+// downloads of them can be verified.
+type BlobHashes interface {
+	BlobHash(ctx context.Context, path string) (BlobHash, error)
+	// RecordBlobHash stores b, replacing the record of a blob at the same
+	// path and clearing its corruption.
+	RecordBlobHash(ctx context.Context, b BlobHash) error
+	DeleteBlobHash(ctx context.Context, path string) error
+	MarkBlobCorrupted(ctx context.Context, path string) error
+	MarkFileCorrupted(ctx context.Context, fileID string) error
+}
+
+// ShareLinks reads and writes public share links.
+type ShareLinks interface {
+	AddShareLink(ctx context.Context, l ShareLink) error
+	// ShareLinkByToken returns the link whose token hashes to tokenHash.
+	ShareLinkByToken(ctx context.Context, tokenHash string) (ShareLink, error)
+	// ListShareLinks returns the links of ownerID, newest first, only those
+	// to fileID unless it is "".
+	ListShareLinks(ctx context.Context, ownerID, fileID string) ([]ShareLink, error)
+	// RevokeShareLink revokes a live link of ownerID and returns it.
+	RevokeShareLink(ctx context.Context, ownerID, id string) (ShareLink, error)
+	// RecordLinkPasswordFailure counts a wrong password. Reaching
+	// maxAttempts locks the link until lockUntil and starts the count again.
+	RecordLinkPasswordFailure(ctx context.Context, id string, maxAttempts int, lockUntil time.Time) error
+	// ClaimLinkDownload counts a download and resets the wrong passwords. It
+	// reports false when the link is revoked or has no downloads left.
+	ClaimLinkDownload(ctx context.Context, id string) (bool, error)
+}
+
+// LinkUploads tracks the chunked uploads of share link copies and the
+// chunks received for them.
+type LinkUploads interface {
+	// AddLinkUpload starts an upload in the uploading state.
+	AddLinkUpload(ctx context.Context, u LinkUpload) error
+	LinkUpload(ctx context.Context, id string) (LinkUpload, error)
+	// RecordLinkUploadChunk notes that chunk index, of size bytes, is
+	// stored, replacing an earlier chunk with its index.
+	RecordLinkUploadChunk(ctx context.Context, id string, index int, size int64) error
+	// ClaimLinkUploadAssembly moves the upload to assembling if, and only
+	// if, every expected chunk has been recorded. Of concurrent callers only
+	// one is told it won.
+	ClaimLinkUploadAssembly(ctx context.Context, id string) (bool, error)
+	SetLinkUploadStatus(ctx context.Context, id, status string) error
+	// DeleteLinkUpload forgets the upload and its chunks.
+	DeleteLinkUpload(ctx context.Context, id string) error
+}
+
+// Quotas reads and writes storage limits and adds up what users store.
+type Quotas interface {
+	// UserQuota returns the tier of userID, defaultTier if they were never
+	// assigned one, with the limit that applies to them: their own if set,
+	// else the tier's.
+	UserQuota(ctx context.Context, userID, defaultTier string) (QuotaTier, error)
+	// SetUserQuota assigns userID to tier, "" for the default tier, with an
+	// optional limit of their own.
+	SetUserQuota(ctx context.Context, userID, tier string, limitBytes *int64) error
+	// QuotaTiers returns every tier, smallest limit first.
+	QuotaTiers(ctx context.Context) ([]QuotaTier, error)
+	QuotaTierExists(ctx context.Context, name string) (bool, error)
+	// SetQuotaTier creates the tier or changes its limit.
+	SetQuotaTier(ctx context.Context, t QuotaTier) error
+	// StorageUsage adds up the bytes stored for userID.
+	StorageUsage(ctx context.Context, userID string) (Usage, error)
+}
+
+// Users reads and writes the users files can be sent to.
+type Users interface {
+	UserExists(ctx context.Context, id string) (bool, error)
+	// AddUser records a user. Adding a known user is not an error.
+	AddUser(ctx context.Context, id string) error
+	// AddOneTimePreKey stores a one-time pre-key of userID and returns its id.
+	AddOneTimePreKey(ctx context.Context, userID string) (string, error)
+	// OneTimePreKeyOwner returns the id of the user a one-time pre-key
+	// belongs to.
+	OneTimePreKeyOwner(ctx context.Context, keyID string) (string, error)
+}
+
+// Store is everything the handlers need from the database.
+type Store interface {
+	Files
+	Trash
+	Shares
+	Folders
+	Search
+	StorageStats
+	Sweeps
+	Notifications
+	AccessLogs
+	UploadSessions
+	FileVersions
+	BlobHashes
+	ShareLinks
+	LinkUploads
+	Quotas
+	Users
+}
@@ -0,0 +1,167 @@
+package tracing
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WrapConnector traces the connections c opens: every query, statement,
+// transaction begin, commit and rollback gets a client span, a child of the
+// span in the context the call was made with (QueryContext, ExecContext,
+// BeginTx, ...). Open the pool with sql.OpenDB.
+//
+// A query span covers the time until the first rows are available, not
+// reading them. Arguments are never recorded, only the statement text.
+func WrapConnector(c driver.Connector) driver.Connector {
+	return &connector{c}
+}
+
+type connector struct{ driver.Connector }
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	cn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{cn}, nil
+}
+
+// startSQL starts a span named after the statement's operation, e.g.
+// "SELECT".
+func startSQL(ctx context.Context, query string) (context.Context, trace.Span) {
+	op := operation(query)
+	attrs := []attribute.KeyValue{semconv.DBSystemNamePostgreSQL, semconv.DBOperationName(op)}
+	if op != query {
+		attrs = append(attrs, semconv.DBQueryText(query))
+	}
+	return Tracer().Start(ctx, op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// operation is the first keyword of query, upper-cased.
+func operation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "SQL"
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// endSQL ends a span, treating driver.ErrSkip (the driver asking
+// database/sql to take another path) as success.
+func endSQL(span trace.Span, err error) {
+	if errors.Is(err, driver.ErrSkip) {
+		err = nil
+	}
+	End(span, err)
+}
+
+// conn forwards to the driver's connection, tracing the context-aware
+// methods. database/sql prefers those, so the context-free Prepare, Begin,
+// Query and Exec are never reached through the pool.
+type conn struct{ driver.Conn }
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startSQL(ctx, query)
+	rows, err := q.QueryContext(ctx, query, args)
+	endSQL(span, err)
+	return rows, err
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startSQL(ctx, query)
+	res, err := e.ExecContext(ctx, query, args)
+	endSQL(span, err)
+	return res, err
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	ctx, span := startSQL(ctx, query)
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	endSQL(span, err)
+	return stmt, err
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	spanCtx, span := startSQL(ctx, "BEGIN")
+	var t driver.Tx
+	var err error
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		t, err = b.BeginTx(spanCtx, opts)
+	} else {
+		t, err = c.Conn.Begin()
+	}
+	endSQL(span, err)
+	if err != nil {
+		return nil, err
+	}
+	// Commit and Rollback take no context; their spans join the trace that
+	// began the transaction.
+	return &tx{Tx: t, ctx: ctx}, nil
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type tx struct {
+	driver.Tx
+	ctx context.Context
+}
+
+func (t *tx) Commit() error {
+	_, span := startSQL(t.ctx, "COMMIT")
+	err := t.Tx.Commit()
+	endSQL(span, err)
+	return err
+}
+
+func (t *tx) Rollback() error {
+	_, span := startSQL(t.ctx, "ROLLBACK")
+	err := t.Tx.Rollback()
+	endSQL(span, err)
+	return err
+}